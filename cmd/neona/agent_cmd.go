@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fentz26/neona/internal/agentbridge"
+	"github.com/fentz26/neona/internal/update"
+	"github.com/spf13/cobra"
+)
+
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Connect editor agents to the task queue and memory",
+}
+
+var agentRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Serve the task queue and memory to an editor over MCP on stdio",
+	Long: `Runs a bridge that speaks the Model Context Protocol (MCP) on stdin and
+stdout, so an editor's agent (Cursor, Claude and other MCP clients) can list
+and claim tasks, read their context, comment on them and search and write
+memory, through the daemon at --api.
+
+The editor starts the bridge itself; register it as an MCP server, e.g. in
+.cursor/mcp.json:
+
+  {"mcpServers": {"neona": {"command": "neona", "args": ["agent", "run"]}}}
+
+Tasks the agent claims are held as --holder and kept alive with heartbeats
+until it completes or releases them; those still held when the editor exits
+are released back to the queue. Logs go to stderr.`,
+	Args: cobra.NoArgs,
+	RunE: runAgent,
+}
+
+var agentHolder string
+
+func init() {
+	agentCmd.AddCommand(agentRunCmd)
+	rootCmd.AddCommand(agentCmd)
+
+	hostname, _ := os.Hostname()
+	agentRunCmd.Flags().StringVar(&agentHolder, "holder", fmt.Sprintf("agent@%s", hostname), "Holder ID for the tasks the agent claims")
+}
+
+func runAgent(cmd *cobra.Command, args []string) error {
+	// stdout carries the protocol, so nothing else may be written to it
+	log.SetOutput(os.Stderr)
+	if _, err := CheckHealth(); err != nil {
+		log.Printf("Daemon at %s is not reachable yet: %v", apiAddr, err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	bridge := agentbridge.New(apiClient(), agentbridge.Config{
+		HolderID: agentHolder,
+		Version:  update.GetCurrentVersion(),
+	})
+	log.Printf("Serving MCP on stdio as %s", agentHolder)
+	return bridge.Serve(ctx, os.Stdin, os.Stdout)
+}
@@ -1,102 +1,73 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
-	"fmt"
-	"io"
 	"net/http"
-	"time"
+	"sync"
+
+	"github.com/fentz26/neona/pkg/client"
 )
 
-// DefaultClientTimeout is the default timeout for API requests.
-const DefaultClientTimeout = 10 * time.Second
+var (
+	apiClientOnce sync.Once
+	apiSDK        *client.Client
+)
 
-// apiClient is the shared HTTP client with timeout.
-var apiClient = &http.Client{
-	Timeout: DefaultClientTimeout,
+// apiClient returns the shared client for apiAddr. It is built lazily so
+// that the --api flags have been parsed.
+func apiClient() *client.Client {
+	apiClientOnce.Do(func() {
+		apiConfig.Addr, apiConfig.APIKey = apiAddr, apiKey
+		apiSDK = client.New(apiConfig)
+	})
+	return apiSDK
 }
 
-// apiGet performs a GET request to the API with timeout.
-func apiGet(path string) ([]byte, error) {
-	url := apiAddr + path
-	resp, err := apiClient.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("API request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("API error (%d): %s", resp.StatusCode, string(body))
-	}
+// APIError is returned for responses with a 4xx or 5xx status.
+type APIError = client.APIError
 
-	return body, nil
+// apiGet performs a GET request to the API, retrying transient failures.
+func apiGet(path string) ([]byte, error) {
+	return apiDo(http.MethodGet, path, nil)
 }
 
-// apiPost performs a POST request to the API with timeout.
+// apiPost performs a POST request to the API. POSTs are only retried when
+// they carry an Idempotency-Key.
 func apiPost(path string, data interface{}) ([]byte, error) {
-	url := apiAddr + path
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return nil, err
 	}
+	return apiDo(http.MethodPost, path, jsonData)
+}
 
-	resp, err := apiClient.Post(url, "application/json", bytes.NewReader(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("API request failed: %w", err)
+// apiDo sends a request, first replaying writes queued while the daemon was
+// offline. When the daemon is offline it offers to start it (see
+// offline.go) and retries once if it came up.
+func apiDo(method, path string, body []byte) ([]byte, error) {
+	replayJournalOnce()
+	resp, err := apiSend(method, path, body, nil)
+	if isOffline(err) && startOffline() {
+		replayJournalOnce()
+		resp, err = apiSend(method, path, body, nil)
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("API error (%d): %s", resp.StatusCode, string(body))
+	if isOffline(err) {
+		return nil, &OfflineError{Addr: apiAddr, Err: err}
 	}
+	return resp, err
+}
 
-	return body, nil
+// apiSend sends one request with optional extra headers.
+func apiSend(method, path string, body []byte, header http.Header) ([]byte, error) {
+	return apiClient().Raw(method, path, body, header)
 }
 
 // CheckHealth checks if the daemon is healthy and returns the health response.
 // Unlike other API calls, this returns the parsed HealthResponse even on non-200
 // responses, allowing callers to inspect the health payload alongside the error.
 func CheckHealth() (*HealthResponse, error) {
-	url := apiAddr + "/health"
-	resp, err := apiClient.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("API request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	var health HealthResponse
-	if err := json.Unmarshal(body, &health); err != nil {
-		return nil, fmt.Errorf("failed to parse health response: %w", err)
-	}
-
-	// Return both payload and error on non-200 status
-	if resp.StatusCode != http.StatusOK {
-		return &health, fmt.Errorf("health check failed (status %d): %s", resp.StatusCode, string(body))
-	}
-
-	return &health, nil
+	return apiClient().Health()
 }
 
 // HealthResponse matches the server's health response structure.
-type HealthResponse struct {
-	OK      bool   `json:"ok"`
-	DB      string `json:"db"`
-	Version string `json:"version"`
-	Time    string `json:"time"`
-}
+type HealthResponse = client.HealthResponse
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Generate load against the daemon and report latencies",
+	Long: `Creates tasks and drives each through claim, an optional run, and
+complete from concurrent workers, then reports request latency percentiles
+and error rates per operation. Use it to size a daemon before pointing a
+fleet of agents at it.
+
+Tasks carry the --label label (default "bench") and are claimed by ID, so real
+pending tasks are never picked up; the daemon's own scheduler workers may still
+claim a few bench tasks first, which then count as claim errors. Run commands
+must be allowed by the daemon's connector, e.g.:
+
+  neona bench --tasks 1000 --concurrency 50 --cmd "git status"`,
+	RunE: runBench,
+}
+
+var (
+	benchTasks       int
+	benchConcurrency int
+	benchCommand     string
+	benchLabel       string
+	benchTTL         int
+)
+
+func init() {
+	benchCmd.Flags().IntVarP(&benchTasks, "tasks", "n", 200, "Number of tasks to create")
+	benchCmd.Flags().IntVarP(&benchConcurrency, "concurrency", "c", 10, "Number of concurrent workers")
+	benchCmd.Flags().StringVar(&benchCommand, "cmd", "", "Command to run on each task before completing it (default: no run)")
+	benchCmd.Flags().StringVar(&benchLabel, "label", "bench", "Label for the tasks bench creates")
+	benchCmd.Flags().IntVar(&benchTTL, "ttl", 60, "Lease TTL in seconds")
+}
+
+// Operations bench measures, in report order.
+var benchOps = []string{"create", "claim", "run", "complete"}
+
+// benchStats collects request latencies and errors per operation.
+type benchStats struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+	firstErr  map[string]string
+}
+
+func newBenchStats() *benchStats {
+	return &benchStats{
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+		firstErr:  make(map[string]string),
+	}
+}
+
+// time runs one request and records its latency or error.
+func (s *benchStats) time(op string, fn func() ([]byte, error)) ([]byte, error) {
+	start := time.Now()
+	resp, err := fn()
+	elapsed := time.Since(start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.errors[op]++
+		if _, ok := s.firstErr[op]; !ok {
+			s.firstErr[op] = err.Error()
+		}
+		return nil, err
+	}
+	s.latencies[op] = append(s.latencies[op], elapsed)
+	return resp, nil
+}
+
+func runBench(cmd *cobra.Command, args []string) error {
+	if benchTasks < 1 || benchConcurrency < 1 {
+		return fmt.Errorf("--tasks and --concurrency must be at least 1")
+	}
+	var command string
+	var cmdArgs []string
+	if fields := strings.Fields(benchCommand); len(fields) > 0 {
+		command, cmdArgs = fields[0], fields[1:]
+	}
+	if _, err := CheckHealth(); err != nil {
+		return fmt.Errorf("daemon not reachable at %s: %w", apiAddr, err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stats := newBenchStats()
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < benchConcurrency; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			holder := fmt.Sprintf("bench-%d", w)
+			for ctx.Err() == nil {
+				i := int(next.Add(1))
+				if i > benchTasks {
+					return
+				}
+				benchTask(stats, i, holder, command, cmdArgs)
+			}
+		}(w)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	done := len(stats.latencies["complete"])
+	fmt.Printf("%d of %d tasks completed in %s (%.1f tasks/s, %d workers)\n\n",
+		done, benchTasks, elapsed.Round(time.Millisecond), float64(done)/elapsed.Seconds(), benchConcurrency)
+	printBenchReport(stats, command != "")
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted")
+	}
+	return nil
+}
+
+// benchTask drives one task through its lifecycle, stopping at the first
+// failed step.
+func benchTask(stats *benchStats, i int, holder, command string, cmdArgs []string) {
+	resp, err := stats.time("create", func() ([]byte, error) {
+		return apiPost("/tasks", map[string]interface{}{
+			"title":  fmt.Sprintf("bench task %d", i),
+			"labels": []string{benchLabel},
+		})
+	})
+	if err != nil {
+		return
+	}
+	var task struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(resp, &task); err != nil {
+		return
+	}
+
+	resp, err = stats.time("claim", func() ([]byte, error) {
+		return apiPost("/tasks/"+task.ID+"/claim", map[string]interface{}{"holder_id": holder, "ttl_sec": benchTTL})
+	})
+	if err != nil {
+		return
+	}
+	var lease struct {
+		HolderToken string `json:"holder_token"`
+	}
+	if err := json.Unmarshal(resp, &lease); err != nil {
+		return
+	}
+
+	if command != "" {
+		_, err := stats.time("run", func() ([]byte, error) {
+			return apiPost("/tasks/"+task.ID+"/run", map[string]interface{}{
+				"holder_id": holder, "holder_token": lease.HolderToken, "command": command, "args": cmdArgs,
+			})
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	stats.time("complete", func() ([]byte, error) {
+		return apiPost("/tasks/"+task.ID+"/complete", map[string]string{"holder_id": holder, "holder_token": lease.HolderToken})
+	})
+}
+
+func printBenchReport(stats *benchStats, withRun bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "OP\tOK\tERRORS\tERROR %\tP50\tP90\tP99\tMAX")
+	for _, op := range benchOps {
+		if op == "run" && !withRun {
+			continue
+		}
+		lat := stats.latencies[op]
+		sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+		total := len(lat) + stats.errors[op]
+		rate := 0.0
+		if total > 0 {
+			rate = 100 * float64(stats.errors[op]) / float64(total)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\n", op, len(lat), stats.errors[op], rate,
+			percentile(lat, 50), percentile(lat, 90), percentile(lat, 99), percentile(lat, 100))
+	}
+	w.Flush()
+
+	for _, op := range benchOps {
+		if msg, ok := stats.firstErr[op]; ok {
+			fmt.Fprintf(os.Stderr, "First %s error: %s\n", op, strings.TrimSpace(msg))
+		}
+	}
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted latencies,
+// or "-" when there are none.
+func percentile(sorted []time.Duration, p int) string {
+	if len(sorted) == 0 {
+		return "-"
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1].Round(10 * time.Microsecond).String()
+}
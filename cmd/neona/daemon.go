@@ -9,23 +9,135 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/fentz26/neona/internal/audit"
+	"github.com/fentz26/neona/internal/auth"
+	"github.com/fentz26/neona/internal/cloudsync"
+	"github.com/fentz26/neona/internal/connectors"
 	"github.com/fentz26/neona/internal/connectors/localexec"
+	"github.com/fentz26/neona/internal/connectors/plugin"
+	"github.com/fentz26/neona/internal/connectors/scripts"
 	"github.com/fentz26/neona/internal/controlplane"
+	"github.com/fentz26/neona/internal/crash"
+	"github.com/fentz26/neona/internal/digest"
+	"github.com/fentz26/neona/internal/leader"
 	"github.com/fentz26/neona/internal/mcp"
+	"github.com/fentz26/neona/internal/paths"
 	"github.com/fentz26/neona/internal/scheduler"
 	"github.com/fentz26/neona/internal/store"
+	"github.com/fentz26/neona/internal/update"
+	"github.com/fentz26/neona/internal/workspace"
+	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 )
 
 var (
-	listenAddr string
-	dbPath     string
+	listenAddr   string
+	dbPath       string
+	drainTimeout time.Duration
+	labelLimits  map[string]int
+	pollInterval time.Duration
+	pollJitter   time.Duration
+	maxClaims    int
+	rateLimits   []string
+	taskRate     string
+	adminToken   string
+	encryptDB    bool
+	apiKeysPath  string
+	workdirRoots []string
+	runEnvAllow  []string
+	runEnvBase   map[string]string
+	runOutputMax int
+	envInherit   []string
+	connEnvSpecs []string
+	memoryDedup  float64
+
+	redactEnabled  bool
+	redactPatterns []string
+	redactSkip     []string
+
+	requireChecklist bool
+	claimsPath       string
+	leaseAutotune    bool
+
+	sandboxBackend string
+	sandboxProfile string
+	sandboxLabels  map[string]string
+
+	scriptsDir string
+	pluginsDir string
+
+	worktreeCfg workspace.WorktreeConfig
+	worktreePRs bool
+	prCfg       workspace.PullRequestConfig
+
+	digestEnabled  bool
+	digestInterval time.Duration
+	digestWebhooks []string
+
+	cloudSyncEnabled  bool
+	cloudSyncE2E      bool
+	cloudSyncInterval time.Duration
+	cloudSyncCfg      cloudsync.Config
+
+	slaInterval time.Duration
+	slaWebhooks []string
+	staleFactor int
+
+	dbWarnMB        int64
+	dbWarnRows      int64
+	dbCheckInterval time.Duration
+
+	agentCommand    string
+	agentEndpoints  map[string]string
+	agentAckTimeout time.Duration
+
+	daemonMode string
+	instanceID string
+
+	haEnabled bool
+	leaderTTL time.Duration
+	advertise string
 )
 
+// cloudSyncToken returns the access token of the user logged in with
+// neona login, or "" if there is none. Credentials are reread on each call
+// so a login after the daemon started is picked up.
+func cloudSyncToken() (string, error) {
+	m, err := auth.NewManager()
+	if err != nil {
+		return "", err
+	}
+	if !m.IsAuthenticated() {
+		return "", nil
+	}
+	return m.GetSession().AccessToken, nil
+}
+
+// parseConnectorEnvInherit parses --connector-env-inherit values into
+// patterns by connector name.
+func parseConnectorEnvInherit(specs []string) (map[string][]string, error) {
+	m := make(map[string][]string)
+	for _, spec := range specs {
+		name, list, ok := strings.Cut(spec, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("--connector-env-inherit %q: want CONNECTOR=PATTERN[,PATTERN...]", spec)
+		}
+		var patterns []string
+		for _, p := range strings.Split(list, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				patterns = append(patterns, p)
+			}
+		}
+		m[name] = patterns
+	}
+	return m, nil
+}
+
 var daemonCmd = &cobra.Command{
 	Use:   "daemon",
 	Short: "Start the Neona daemon (neonad)",
@@ -34,26 +146,108 @@ var daemonCmd = &cobra.Command{
 }
 
 func init() {
-	homeDir, _ := os.UserHomeDir()
-	defaultDB := filepath.Join(homeDir, ".neona", "neona.db")
+	defaultDB := paths.DBPath()
 
-	daemonCmd.Flags().StringVar(&listenAddr, "listen", "127.0.0.1:7466", "Listen address for the API server")
+	daemonCmd.Flags().StringVar(&listenAddr, "listen", "127.0.0.1:7466", "Listen address for the API server (host:port or unix:///path/to/neona.sock)")
 	daemonCmd.Flags().StringVar(&dbPath, "db", defaultDB, "Path to SQLite database")
+	daemonCmd.Flags().DurationVar(&drainTimeout, "drain-timeout", scheduler.DefaultConfig().DrainTimeout(), "How long shutdown waits for in-flight workers to finish")
+	daemonCmd.Flags().DurationVar(&pollInterval, "poll-interval", scheduler.DefaultConfig().PollInterval(), "How long the scheduler waits between dispatch cycles")
+	daemonCmd.Flags().DurationVar(&pollJitter, "poll-jitter", time.Duration(scheduler.DefaultConfig().PollJitterMs)*time.Millisecond, "Add a random delay of up to this long to each dispatch cycle")
+	daemonCmd.Flags().IntVar(&maxClaims, "max-claims-per-cycle", 0, "Claim at most N tasks per dispatch cycle (0: fill all free capacity)")
+	daemonCmd.Flags().StringArrayVar(&rateLimits, "rate-limit", nil, "Dispatch at most N tasks a minute through a connector, as CONNECTOR=N or CONNECTOR=N:BURST (repeatable)")
+	daemonCmd.Flags().StringVar(&taskRate, "task-rate-limit", "", "Dispatch the same task at most N times a minute, as N or N:BURST")
+	daemonCmd.Flags().StringToIntVar(&labelLimits, "label-limit", nil, "Run at most N tasks carrying a label at once, as LABEL=N (repeatable)")
+	daemonCmd.Flags().BoolVar(&encryptDB, "encrypt", false, "Encrypt memory content and run output at rest (key from OS keychain or NEONA_DB_KEY)")
+	daemonCmd.Flags().StringVar(&apiKeysPath, "api-keys", "", "YAML file mapping principals to API keys; enables API authentication")
+	daemonCmd.Flags().StringSliceVar(&workdirRoots, "workdir-root", nil, "Directory task workdirs must be inside (repeatable; default: the daemon's working directory)")
+	daemonCmd.Flags().StringSliceVar(&runEnvAllow, "run-env-allow", controlplane.DefaultEnvAllowlist, "Variable names (globs allowed) run requests may set")
+	daemonCmd.Flags().StringToStringVar(&runEnvBase, "run-env", nil, "Variable set for every command the daemon runs, as KEY=VALUE (repeatable)")
+	daemonCmd.Flags().StringSliceVar(&envInherit, "env-inherit", connectors.DefaultEnvInherit, "Daemon variables (globs allowed) commands inherit; * passes the whole environment")
+	daemonCmd.Flags().StringArrayVar(&connEnvSpecs, "connector-env-inherit", nil, "--env-inherit for one connector, as CONNECTOR=PATTERN[,PATTERN...] (repeatable)")
+	daemonCmd.Flags().IntVar(&runOutputMax, "run-output-limit", store.DefaultRunOutputLimit, "Bytes of stdout and of stderr kept per run (0 keeps everything)")
+	daemonCmd.Flags().Float64Var(&memoryDedup, "memory-dedup-similarity", 0, "Also merge memory items whose words overlap a recent item in the scope by this fraction, 0 to 1 (0: exact duplicates only)")
+	daemonCmd.Flags().BoolVar(&redactEnabled, "redact", false, "Mask API keys, tokens, private keys and emails in memory and run output before storing them")
+	daemonCmd.Flags().StringArrayVar(&redactPatterns, "redact-pattern", nil, "Extra pattern for --redact, as NAME=REGEX (repeatable; a group named secret masks only that part)")
+	daemonCmd.Flags().StringSliceVar(&redactSkip, "redact-skip", nil, "Built-in --redact patterns to turn off, e.g. email")
+	daemonCmd.Flags().BoolVar(&requireChecklist, "require-checklist", false, "Refuse to complete tasks until every checklist item is checked")
+	daemonCmd.Flags().StringVar(&claimsPath, "claim-config", paths.ClaimsPath(), "YAML file of lease TTLs and claim limits, with per-project overrides (used when it exists)")
+	daemonCmd.Flags().BoolVar(&leaseAutotune, "lease-autotune", false, "Give scheduler workers lease TTLs from the p95 run time of recent tasks with the same labels")
+	daemonCmd.Flags().StringVar(&sandboxBackend, "sandbox", "", "Sandbox backend for commands: auto, bwrap, firejail or sandbox-exec (default: none)")
+	daemonCmd.Flags().StringVar(&sandboxProfile, "sandbox-profile", "", "Sandbox profile for every run: strict or network (needs --sandbox)")
+	daemonCmd.Flags().StringToStringVar(&sandboxLabels, "sandbox-label", nil, "Sandbox profile for tasks carrying a label, as LABEL=PROFILE (repeatable; none opts out)")
+	daemonCmd.Flags().StringVar(&scriptsDir, "scripts-dir", paths.ScriptsPath(), "Directory of vetted scripts run by tasks with connector scripts (used when it exists)")
+	daemonCmd.Flags().StringVar(&pluginsDir, "plugins-dir", paths.PluginsPath(), "Directory of connector plugin executables started with the daemon (used when it exists)")
+	daemonCmd.Flags().StringVar(&worktreeCfg.Repo, "worktree-repo", "", "Give each claimed task its own git worktree of this repository")
+	daemonCmd.Flags().StringVar(&worktreeCfg.Dir, "worktree-dir", filepath.Join(paths.DataDir(), "worktrees"), "Directory holding per-task worktrees")
+	daemonCmd.Flags().StringVar(&worktreeCfg.BaseRef, "worktree-base", "HEAD", "Commit-ish task branches start from")
+	daemonCmd.Flags().StringVar(&worktreeCfg.BranchPrefix, "worktree-branch-prefix", "neona/", "Prefix for task branch names")
+	daemonCmd.Flags().StringVar(&worktreeCfg.Preserve, "worktree-preserve", workspace.PreserveFailed, "Keep worktrees of finished tasks: never, failed or always")
+	daemonCmd.Flags().BoolVar(&worktreePRs, "worktree-pr", false, "Push the branch and open a GitHub pull request when a task completes in its worktree with commits (needs gh)")
+	daemonCmd.Flags().StringVar(&prCfg.Remote, "worktree-pr-remote", "origin", "Remote task branches are pushed to")
+	daemonCmd.Flags().StringVar(&prCfg.Base, "worktree-pr-base", "", "Branch pull requests target (default: the repository's default branch)")
+	daemonCmd.Flags().BoolVar(&prCfg.Draft, "worktree-pr-draft", false, "Open pull requests as drafts")
+	daemonCmd.Flags().BoolVar(&digestEnabled, "digest", false, "Write a periodic activity digest into memory (tag: digest)")
+	daemonCmd.Flags().DurationVar(&digestInterval, "digest-interval", 24*time.Hour, "How often --digest writes a digest")
+	daemonCmd.Flags().StringSliceVar(&digestWebhooks, "digest-webhook", nil, "Incoming webhook URL to post each digest to (repeatable)")
+	daemonCmd.Flags().BoolVar(&cloudSyncEnabled, "cloud-sync", false, "Mirror tasks to neona.app for the logged-in user and pull their team's tasks (see neona sync status)")
+	daemonCmd.Flags().StringVar(&cloudSyncCfg.URL, "cloud-sync-url", cloudsync.DefaultURL, "Sync API of the hosted backend")
+	daemonCmd.Flags().DurationVar(&cloudSyncInterval, "cloud-sync-interval", 5*time.Minute, "How often --cloud-sync syncs")
+	daemonCmd.Flags().StringSliceVar(&cloudSyncCfg.Labels, "cloud-sync-label", nil, "Only push tasks with one of these labels (repeatable; default: all tasks)")
+	daemonCmd.Flags().BoolVar(&cloudSyncCfg.Memory, "cloud-sync-memory", false, "Also push summaries of new memory items")
+	daemonCmd.Flags().StringSliceVar(&cloudSyncCfg.MemoryScopes, "cloud-sync-memory-scope", nil, "Only push memory summaries from these scopes (repeatable)")
+	daemonCmd.Flags().StringVar(&cloudSyncCfg.Team, "cloud-sync-team", "", "Team whose tasks are pulled down (default: push only)")
+	daemonCmd.Flags().BoolVar(&cloudSyncE2E, "cloud-sync-e2e", false, "Encrypt synced content with the keys from neona sync key init (passphrase from NEONA_SYNC_PASSPHRASE)")
+	daemonCmd.Flags().StringSliceVar(&cloudSyncCfg.PlaintextDevices, "cloud-sync-plaintext-device", nil, "With --cloud-sync-e2e, accept unencrypted tasks from this teammate's device (repeatable; others are rejected)")
+	daemonCmd.Flags().StringVar(&cloudSyncCfg.Conflicts, "cloud-sync-conflicts", cloudsync.PolicyNewest, "Status kept when a task changed on both sides: newest, local or remote")
+	daemonCmd.Flags().DurationVar(&slaInterval, "sla-interval", 30*time.Second, "How often to check for tasks open past their due time and for stale claims")
+	daemonCmd.Flags().StringSliceVar(&slaWebhooks, "sla-webhook", nil, "Incoming webhook URL to post missed task deadlines and stale claims to (repeatable)")
+	daemonCmd.Flags().IntVar(&staleFactor, "stale-factor", controlplane.DefaultStaleFactor, "Flag claims with no heartbeat or run for this many lease TTLs as stale (0 disables)")
+	daemonCmd.Flags().Int64Var(&dbWarnMB, "db-warn-size", controlplane.DefaultDBMaxBytes>>20, "Warn when the database file grows past this many MiB (0 disables)")
+	daemonCmd.Flags().Int64Var(&dbWarnRows, "db-warn-rows", controlplane.DefaultDBMaxRows, "Warn when a table such as runs or pdr grows past this many rows (0 disables)")
+	daemonCmd.Flags().DurationVar(&dbCheckInterval, "db-check-interval", 10*time.Minute, "How often to measure the database against --db-warn-size and --db-warn-rows")
+	daemonCmd.Flags().StringVar(&agentCommand, "agent-command", "", "Command line the scheduler hands tasks without commands to, with the task on stdin, e.g. \"claude -p\" (default: leave them to API workers)")
+	daemonCmd.Flags().StringToStringVar(&agentEndpoints, "agent-endpoint", nil, "Remote agent the scheduler pushes tasks without commands to, as NAME=CALLBACK_URL (repeatable; offered in name order)")
+	daemonCmd.Flags().DurationVar(&agentAckTimeout, "agent-ack-timeout", scheduler.DefaultAckTimeout, "How long a remote agent has to accept a task before the next is tried or the task is requeued")
+	daemonCmd.Flags().StringVar(&daemonMode, "mode", modeAll, "What this daemon runs: api (HTTP endpoints only), worker (scheduler only) or all")
+	hostname, _ := os.Hostname()
+	daemonCmd.Flags().StringVar(&instanceID, "instance-id", hostname, "Name of this daemon's scheduler in the database, so it recovers only its own workers; give each worker daemon sharing a database its own, kept across restarts")
+	daemonCmd.Flags().BoolVar(&haEnabled, "ha", false, "Share the database with other daemons; only the elected leader runs the scheduler and digest")
+	daemonCmd.Flags().DurationVar(&leaderTTL, "leader-ttl", leader.DefaultTTL, "How long --ha leadership lasts without renewal, and so how soon a follower takes over")
+	daemonCmd.Flags().StringVar(&advertise, "advertise", "", "API URL other --ha daemons redirect writes to (default: http:// plus --listen)")
+	daemonCmd.Flags().StringVar(&adminToken, "admin-token", "", "Bearer token enabling /admin/ endpoints (or set NEONA_ADMIN_TOKEN)")
 }
 
-// setupLogging configures logging to write to both stdout and a log file
-func setupLogging() (*os.File, error) {
-	homeDir, err := os.UserHomeDir()
+// Daemon modes. API and worker daemons pointed at the same database split
+// one daemon's work so execution can be scaled on separate machines.
+const (
+	modeAll    = "all"
+	modeAPI    = "api"
+	modeWorker = "worker"
+)
+
+// haInstance is the scheduler instance --ha daemons share. Only the leader
+// runs the scheduler, so a newly elected leader recovers the workers of the
+// one it replaced.
+const haInstance = "ha"
+
+// buildMCPRouter builds the router for cfg's strategy, falling back to the
+// keyword router if the strategy cannot be built.
+func buildMCPRouter(cfg *mcp.Config, registry *mcp.Registry) mcp.Router {
+	router, err := mcp.NewRouterFromConfig(cfg, registry)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
+		log.Printf("Warning: %v (using keyword router)", err)
+		return mcp.NewRouter(cfg, registry)
 	}
+	return router
+}
 
-	logDir := filepath.Join(homeDir, ".neona")
-	if err := os.MkdirAll(logDir, 0755); err != nil {
+// setupLogging configures logging to write to both stdout and a log file
+func setupLogging() (*os.File, error) {
+	logPath := paths.LogPath()
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
 		return nil, fmt.Errorf("failed to create log directory: %w", err)
 	}
 
-	logPath := filepath.Join(logDir, "neona.log")
 	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open log file: %w", err)
@@ -68,6 +262,76 @@ func setupLogging() (*os.File, error) {
 }
 
 func runDaemon(cmd *cobra.Command, args []string) error {
+	switch daemonMode {
+	case modeAll, modeAPI, modeWorker:
+	default:
+		return fmt.Errorf("--mode must be api, worker or all, not %q", daemonMode)
+	}
+	if daemonMode == modeAPI && haEnabled {
+		return fmt.Errorf("--ha elects the daemon that runs the scheduler; api daemons never do, so run them without it")
+	}
+	if instanceID == "" && daemonMode == modeWorker && !haEnabled {
+		return fmt.Errorf("--instance-id is required when the hostname is unknown")
+	}
+	serveAPI := daemonMode != modeWorker
+	runWorkers := daemonMode != modeAPI
+	if worktreePRs && worktreeCfg.Repo == "" {
+		return fmt.Errorf("--worktree-pr requires --worktree-repo")
+	}
+	redactor, err := buildRedactor(redactPatterns, redactSkip)
+	if err != nil {
+		return err
+	}
+	connEnvInherit, err := parseConnectorEnvInherit(connEnvSpecs)
+	if err != nil {
+		return err
+	}
+	// inheritFor returns a connector's --env-inherit, marking an override
+	// as used.
+	inheritFor := func(conn string) []string {
+		if patterns, ok := connEnvInherit[conn]; ok {
+			delete(connEnvInherit, conn)
+			return patterns
+		}
+		return envInherit
+	}
+	if pollInterval < time.Millisecond {
+		return fmt.Errorf("--poll-interval must be at least 1ms, not %s", pollInterval)
+	}
+	if pollJitter < 0 {
+		return fmt.Errorf("--poll-jitter must not be negative, not %s", pollJitter)
+	}
+	if maxClaims < 0 {
+		return fmt.Errorf("--max-claims-per-cycle must not be negative, not %d", maxClaims)
+	}
+	connectorRates, err := scheduler.ParseRateLimits(rateLimits)
+	if err != nil {
+		return fmt.Errorf("--rate-limit: %w", err)
+	}
+	var taskRateLimit scheduler.RateLimit
+	if taskRate != "" {
+		if taskRateLimit, err = scheduler.ParseRateLimit(taskRate); err != nil {
+			return fmt.Errorf("--task-rate-limit: %w", err)
+		}
+	}
+	if memoryDedup < 0 || memoryDedup > 1 {
+		return fmt.Errorf("--memory-dedup-similarity must be between 0 and 1, not %g", memoryDedup)
+	}
+	if agentCommand != "" && len(agentEndpoints) > 0 {
+		return fmt.Errorf("--agent-command and --agent-endpoint both take tasks without commands; use one")
+	}
+	for label, profile := range sandboxLabels {
+		if err := localexec.CheckSandboxProfile(profile); err != nil {
+			return fmt.Errorf("--sandbox-label %s: %w", label, err)
+		}
+		if profile != localexec.SandboxNone && sandboxBackend == "" {
+			return fmt.Errorf("--sandbox-label %s=%s requires --sandbox", label, profile)
+		}
+	}
+
+	// Move files left in ~/.neona by older releases before opening them
+	migrated, migrateErr := paths.MigrateLegacy()
+
 	// Setup logging to file and stdout
 	logFile, err := setupLogging()
 	if err != nil {
@@ -78,26 +342,208 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 		defer logFile.Close()
 	}
 
-	log.Println("Starting Neona daemon...")
+	log.Printf("Starting Neona daemon (mode %s)...", daemonMode)
+	for _, path := range migrated {
+		log.Printf("Migrated legacy file to %s", path)
+	}
+	if migrateErr != nil {
+		log.Printf("Warning: failed to migrate %s: %v", paths.LegacyDir(), migrateErr)
+	}
 
 	// Initialize store
 	s, err := store.New(dbPath)
 	if err != nil {
 		return err
 	}
+	// Closed last on every return path, after the audit writer's flush
+	defer func() {
+		if err := s.Close(); err != nil {
+			log.Printf("Database close error: %v", err)
+		}
+	}()
+	if encryptDB {
+		key, err := loadEncryptionKey()
+		if err != nil {
+			return fmt.Errorf("database encryption: %w", err)
+		}
+		cipher, err := store.NewCipher(key)
+		if err != nil {
+			return fmt.Errorf("database encryption: %w", err)
+		}
+		s.SetCipher(cipher)
+		log.Println("Encryption at rest enabled for memory and run output")
+	}
+
+	s.SetRunOutputLimit(runOutputMax)
+	s.SetMemoryDedup(memoryDedup)
+	if redactEnabled {
+		s.SetRedactor(redactor)
+		log.Println("Redaction enabled for memory and run output")
+	}
 
 	// Initialize components
-	pdr := audit.NewPDRWriter(s)
+	// Audit records are queued and written in batches; Close flushes them
+	pdr := audit.NewBufferedPDRWriter(s, 64, 100*time.Millisecond)
+	defer func() {
+		if err := pdr.Close(); err != nil {
+			log.Printf("Audit flush error: %v", err)
+		}
+	}()
+	// Panics in handlers and workers are recovered and written up here
+	crashes := crash.NewReporter(paths.CrashesPath(), update.GetCurrentVersion(), pdr.Recent)
 	workDir, _ := os.Getwd()
 	connector := localexec.New(workDir)
+	connector.SetBaseEnv(runEnvBase)
+	connector.SetEnvInherit(inheritFor(connector.Name()))
+	connector.SetOutputLimit(runOutputMax)
+	if sandboxBackend != "" || sandboxProfile != "" {
+		if err := connector.SetSandbox(sandboxBackend, sandboxProfile); err != nil {
+			return fmt.Errorf("sandbox: %w", err)
+		}
+		log.Printf("Sandboxing commands with %s (default profile %q)", connector.SandboxBackend(), sandboxProfile)
+	}
 
 	// Create service and server
 	service := controlplane.NewService(s, pdr, connector)
+	service.SetEnvAllowlist(runEnvAllow)
+	service.SetSandboxLabels(sandboxLabels)
+	service.SetRequireChecklist(requireChecklist)
+	service.SetStaleFactor(staleFactor)
+	claimConfig := controlplane.DefaultClaimConfig()
+	if _, err := os.Stat(claimsPath); err == nil || cmd.Flags().Changed("claim-config") {
+		if claimConfig, err = controlplane.LoadClaimConfig(claimsPath); err != nil {
+			return fmt.Errorf("claim config: %w", err)
+		}
+		log.Printf("Claim config loaded from %s (lease TTL %ds, %d project overrides)", claimsPath, claimConfig.LeaseTTLSec, len(claimConfig.Projects))
+	}
+	service.SetClaimConfig(claimConfig)
+	service.SetDBQuota(controlplane.DBQuota{MaxBytes: dbWarnMB << 20, MaxRows: dbWarnRows})
+	var library *scripts.Library
+	if _, err := os.Stat(scriptsDir); err == nil || cmd.Flags().Changed("scripts-dir") {
+		library = scripts.New(scriptsDir)
+		library.SetOutputLimit(runOutputMax)
+		library.SetEnvInherit(inheritFor(library.Name()))
+		list, err := library.List()
+		if err != nil {
+			return fmt.Errorf("scripts: %w", err)
+		}
+		service.AddConnector(library)
+		log.Printf("Script library %s: %d scripts", scriptsDir, len(list))
+	}
+	var plugins []*plugin.Plugin
+	if _, err := os.Stat(pluginsDir); err == nil || cmd.Flags().Changed("plugins-dir") {
+		reserved := []string{connector.Name()}
+		if library != nil {
+			reserved = append(reserved, library.Name())
+		}
+		plugins, err = plugin.Discover(pluginsDir, envInherit, reserved...)
+		if err != nil {
+			return fmt.Errorf("plugins: %w", err)
+		}
+		for _, p := range plugins {
+			p.SetOutputLimit(runOutputMax)
+			if patterns, ok := connEnvInherit[p.Name()]; ok {
+				// Restarted with its own policy on first use
+				delete(connEnvInherit, p.Name())
+				p.SetEnvInherit(patterns)
+				p.Close()
+			}
+			service.AddConnector(p)
+			log.Printf("Plugin connector %s started from %s", p.Name(), p.Path())
+		}
+	}
+	for name := range connEnvInherit {
+		log.Printf("Warning: --connector-env-inherit names %s, which is not a connector", name)
+	}
+	// Stops the plugin processes on every return path
+	defer func() {
+		for _, p := range plugins {
+			p.Close()
+		}
+	}()
+	if len(workdirRoots) == 0 {
+		workdirRoots = []string{workDir}
+	}
+	if worktreeCfg.Repo != "" {
+		worktrees, err := workspace.NewWorktreeManager(worktreeCfg)
+		if err != nil {
+			return err
+		}
+		service.SetWorktrees(worktrees)
+		if worktreePRs {
+			service.SetPullRequests(prCfg)
+			log.Printf("Opening pull requests for completed task branches (remote %s)", prCfg.Remote)
+		}
+		workdirRoots = append(workdirRoots, worktrees.Dir())
+		log.Printf("Per-task worktrees of %s in %s", worktreeCfg.Repo, worktrees.Dir())
+	}
+	roots, err := workspace.NewRoots(workdirRoots...)
+	if err != nil {
+		return err
+	}
+	service.SetWorkRoots(roots)
+	log.Printf("Task workdirs allowed under %s", strings.Join(roots.List(), ", "))
 	server := controlplane.NewServer(service, s, listenAddr)
+	if adminToken == "" {
+		adminToken = os.Getenv("NEONA_ADMIN_TOKEN")
+	}
+	server.SetAdminToken(adminToken)
+	server.SetCrashReporter(crashes)
+	if library != nil {
+		server.SetScriptLibrary(library)
+	}
+	if apiKeysPath != "" {
+		keys, viewers, err := controlplane.LoadAPIKeys(apiKeysPath)
+		if err != nil {
+			return fmt.Errorf("api keys: %w", err)
+		}
+		server.SetAPIKeys(keys)
+		server.SetViewers(viewers...)
+		log.Printf("API authentication enabled for %d principals", len(keys))
+	}
 
 	// Create and start scheduler
 	schedulerCfg := scheduler.DefaultConfig()
+	schedulerCfg.DrainTimeoutSec = int(drainTimeout.Seconds())
+	schedulerCfg.PollIntervalMs = int(pollInterval.Milliseconds())
+	schedulerCfg.PollJitterMs = int(pollJitter.Milliseconds())
+	schedulerCfg.MaxClaimsPerCycle = maxClaims
+	schedulerCfg.RateLimits = connectorRates
+	schedulerCfg.TaskRateLimit = taskRateLimit
+	for label, limit := range labelLimits {
+		if limit < 1 {
+			return fmt.Errorf("--label-limit %s=%d: the limit must be at least 1", label, limit)
+		}
+	}
+	schedulerCfg.ByLabel = labelLimits
 	sched := scheduler.New(s, pdr, connector, schedulerCfg)
+	sched.SetCrashReporter(crashes)
+	sched.SetRunner(service)
+	sched.SetLeaseTTL(claimConfig.LeaseTTLSec)
+	if haEnabled {
+		sched.SetInstanceID(haInstance)
+	} else {
+		sched.SetInstanceID(instanceID)
+	}
+	if leaseAutotune {
+		sched.SetLeaseTuning(scheduler.DefaultLeaseTuning(claimConfig.MaxLeaseTTLSec))
+	}
+	if fields := strings.Fields(agentCommand); len(fields) > 0 {
+		sched.AddExecutor(&scheduler.AgentExecutor{Conn: connector, Runs: s, Runner: service, Command: fields[0], Args: fields[1:]})
+	}
+
+	// Requeue tasks left behind by the previous run's workers, whether it
+	// shut down gracefully or crashed. Only this daemon's workers are
+	// recovered, so worker daemons sharing the database leave each other's
+	// tasks alone. With --ha only the leader does this, once elected; api
+	// daemons never do, as their workers run elsewhere.
+	recoverTasks := func() {
+		if n, err := sched.Recover(); err != nil {
+			log.Printf("Warning: failed to recover worker state: %v", err)
+		} else if n > 0 {
+			log.Printf("Recovered %d tasks from previous workers", n)
+		}
+	}
 
 	// Initialize MCP router
 	mcpConfig, err := mcp.LoadConfigFromHome()
@@ -107,35 +553,179 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 	}
 	registry := mcp.NewRegistry()
 	registry.RegisterDefaults()
-	mcpRouter := mcp.NewRouter(mcpConfig, registry)
-	log.Printf("MCP router initialized with %d servers", registry.Count())
+	mcpRouter := mcp.NewCachingRouter(buildMCPRouter(mcpConfig, registry), mcpConfig, mcp.DefaultRouteCacheTTL)
+	log.Printf("MCP router initialized with %d servers (strategy %s)", registry.Count(), mcpConfig.Strategy)
 
 	// Wire MCP router to scheduler and server
 	sched.SetMCPRouter(mcpRouter)
 	server.SetMCPRouter(mcpRouter)
 
+	if len(agentEndpoints) > 0 {
+		agentAPI := advertise
+		if agentAPI == "" && serveAPI && !strings.HasPrefix(listenAddr, "unix://") {
+			agentAPI = "http://" + listenAddr
+		}
+		sched.AddExecutor(&scheduler.DispatchExecutor{
+			Agents:     remoteAgents(agentEndpoints),
+			Store:      s,
+			API:        agentAPI,
+			Router:     mcpRouter,
+			PDR:        pdr,
+			AckTimeout: agentAckTimeout,
+		})
+		log.Printf("Dispatching tasks without commands to %d remote agents", len(agentEndpoints))
+	}
+
 	// Wire scheduler to server for /workers endpoint
 	server.SetScheduler(sched)
 
-	sched.Start()
-	defer sched.Stop()
+	var digestJob *digest.Job
+	if digestEnabled {
+		var notifiers []digest.Notifier
+		for _, url := range digestWebhooks {
+			notifiers = append(notifiers, digest.NewWebhookNotifier(url))
+		}
+		digestJob = digest.NewJob(s, digestInterval, notifiers...)
+		log.Printf("Digest enabled every %s (%d webhooks)", digestInterval, len(notifiers))
+	}
+
+	// Cloud sync runs next to the digest, on the daemon running the scheduler
+	var syncer *cloudsync.Syncer
+	if cloudSyncEnabled {
+		if err := cloudsync.CheckPolicy(cloudSyncCfg.Conflicts); err != nil {
+			return fmt.Errorf("--cloud-sync-conflicts: %w", err)
+		}
+		cfg := cloudSyncCfg
+		cfg.Interval = cloudSyncInterval
+		cfg.StatePath = paths.CloudSyncPath()
+		cfg.Token = cloudSyncToken
+		if cloudSyncE2E {
+			keys, err := loadSyncKeys()
+			if err != nil {
+				return fmt.Errorf("--cloud-sync-e2e: %w", err)
+			}
+			cfg.Keys = keys
+		}
+		syncer = cloudsync.New(s, cfg)
+		server.SetCloudSync(syncer)
+		log.Printf("Cloud sync enabled every %s to %s (end-to-end encrypted: %v)", cloudSyncInterval, cfg.URL, cloudSyncE2E)
+	}
+
+	// Missed deadlines and stale claims are reported by the daemon running
+	// the scheduler
+	var slaNotifiers []controlplane.Notifier
+	for _, url := range slaWebhooks {
+		slaNotifiers = append(slaNotifiers, digest.NewWebhookNotifier(url))
+	}
+	deadlines := controlplane.NewDeadlineJob(service, slaInterval, slaNotifiers...)
+	staleClaims := controlplane.NewStaleJob(service, slaInterval, slaNotifiers...)
+	dbQuota := controlplane.NewDBQuotaJob(service, dbCheckInterval)
+
+	// Writes by other daemons, such as workers in --mode worker, bypass this
+	// one's read caches
+	if haEnabled || daemonMode == modeAPI {
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		defer stopWatch()
+		go s.WatchExternalWrites(watchCtx, 250*time.Millisecond)
+	}
+
+	// Jobs covering the whole database, which must run on one daemon only
+	startJobs := func() {
+		deadlines.Start()
+		staleClaims.Start()
+		dbQuota.Start()
+		if digestJob != nil {
+			digestJob.Start()
+		}
+		if syncer != nil {
+			syncer.Start()
+		}
+	}
+	stopJobs := func() {
+		deadlines.Stop()
+		staleClaims.Stop()
+		dbQuota.Stop()
+		if digestJob != nil {
+			digestJob.Stop()
+		}
+		if syncer != nil {
+			syncer.Stop()
+		}
+	}
+
+	var elector *leader.Elector
+	switch {
+	case haEnabled:
+		if advertise == "" && serveAPI {
+			if strings.HasPrefix(listenAddr, "unix://") {
+				return fmt.Errorf("--ha on a unix socket needs --advertise")
+			}
+			advertise = "http://" + listenAddr
+		}
+		elector = leader.New(s, uuid.New().String(), advertise, leaderTTL)
+		elector.OnChange(func() {
+			recoverTasks()
+			sched.Start()
+			startJobs()
+		}, func() {
+			sched.Stop()
+			stopJobs()
+		})
+		if serveAPI {
+			server.SetLeader(elector)
+		}
+		elector.Start()
+		if !elector.IsLeader() {
+			log.Printf("Following leader at %s", elector.LeaderAddr())
+		}
+	case daemonMode == modeWorker:
+		// Every worker daemon dispatches tasks, but one elected among them
+		// runs the jobs
+		log.Printf("Worker instance %s", instanceID)
+		recoverTasks()
+		sched.Start()
+		elector = leader.New(s, uuid.New().String(), "", leaderTTL)
+		elector.OnChange(startJobs, stopJobs)
+		elector.Start()
+	case runWorkers:
+		recoverTasks()
+		sched.Start()
+		startJobs()
+	}
 
 	// Set up signal handling for graceful shutdown
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
-	// Channel to receive server errors
-	serverErr := make(chan error, 1)
-
-	// Start server in goroutine
+	// SIGHUP reloads mcp.yaml and drops cached routing decisions
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
 	go func() {
-		err := server.Start()
-		if err != nil && err != http.ErrServerClosed {
-			serverErr <- err
+		for range hupCh {
+			cfg, err := mcp.LoadConfigFromHome()
+			if err != nil {
+				log.Printf("MCP config reload failed, keeping current config: %v", err)
+				continue
+			}
+			mcpRouter.Reload(buildMCPRouter(cfg, registry), cfg)
+			log.Printf("MCP config reloaded (strategy %s, version %s)", cfg.Strategy, mcp.ConfigVersion(cfg))
 		}
-		close(serverErr)
 	}()
 
+	// Channel to receive server errors; never ready for worker daemons,
+	// which serve no API
+	var serverErr chan error
+	if serveAPI {
+		serverErr = make(chan error, 1)
+		go func() {
+			err := server.Start()
+			if err != nil && err != http.ErrServerClosed {
+				serverErr <- err
+			}
+			close(serverErr)
+		}()
+	}
+
 	// Wait for shutdown signal or server error
 	select {
 	case sig := <-sigCh:
@@ -143,7 +733,19 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 	case err := <-serverErr:
 		if err != nil {
 			log.Printf("Server error: %v", err)
-			s.Close()
+			if digestJob != nil {
+				digestJob.Stop()
+			}
+			if syncer != nil {
+				syncer.Stop()
+			}
+			deadlines.Stop()
+			staleClaims.Stop()
+			dbQuota.Stop()
+			sched.Stop()
+			if elector != nil {
+				elector.Stop()
+			}
 			return err
 		}
 	}
@@ -152,16 +754,40 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer shutdownCancel()
 
-	log.Println("Shutting down HTTP server...")
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("HTTP server shutdown error: %v", err)
+	if serveAPI {
+		log.Println("Shutting down HTTP server...")
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("HTTP server shutdown error: %v", err)
+		}
 	}
 
-	log.Println("Closing database connection...")
-	if err := s.Close(); err != nil {
-		log.Printf("Database close error: %v", err)
+	// Stop dispatching and let in-flight workers finish before closing the store
+	log.Println("Draining scheduler...")
+	sched.Drain(schedulerCfg.DrainTimeout())
+	deadlines.Stop()
+	staleClaims.Stop()
+	dbQuota.Stop()
+	if digestJob != nil {
+		digestJob.Stop()
+	}
+	if syncer != nil {
+		syncer.Stop()
+	}
+	// Hand leadership over now rather than when the lease expires
+	if elector != nil {
+		elector.Stop()
 	}
 
 	log.Println("Shutdown complete")
 	return nil
 }
+
+// remoteAgents returns the --agent-endpoint agents sorted by name.
+func remoteAgents(endpoints map[string]string) []scheduler.RemoteAgent {
+	agents := make([]scheduler.RemoteAgent, 0, len(endpoints))
+	for name, url := range endpoints {
+		agents = append(agents, scheduler.RemoteAgent{Name: name, URL: url})
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name < agents[j].Name })
+	return agents
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/fentz26/neona/internal/paths"
+	"github.com/fentz26/neona/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Inspect and repair the database",
+}
+
+var dbCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Find inconsistent leases, runs, claims and locks",
+	Long: `Checks the database for leases on tasks that are missing or no longer
+claimed, runs of deleted tasks, tasks claimed or running without an active
+lease, and expired locks that were never released. The command exits with
+status 1 when it finds anything.
+
+With --repair, the issues are fixed in one transaction: orphaned leases and
+runs and expired locks are deleted, and tasks claimed without a lease go back
+to pending. Each repair is recorded as a db.repair PDR. Stop the daemon
+first: a worker whose lease just lapsed would lose its task.`,
+	Args: cobra.NoArgs,
+	RunE: runDBCheck,
+}
+
+var (
+	dbCheckDB     string
+	dbCheckRepair bool
+)
+
+func init() {
+	dbCmd.AddCommand(dbCheckCmd)
+	rootCmd.AddCommand(dbCmd)
+
+	dbCheckCmd.Flags().StringVar(&dbCheckDB, "db", paths.DBPath(), "Path to SQLite database")
+	dbCheckCmd.Flags().BoolVar(&dbCheckRepair, "repair", false, "Fix the issues found")
+}
+
+func runDBCheck(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(dbCheckDB); err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+	s, err := store.New(dbCheckDB)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	var issues []store.IntegrityIssue
+	if dbCheckRepair {
+		issues, err = s.RepairIntegrity()
+	} else {
+		issues, err = s.CheckIntegrity()
+	}
+	if err != nil {
+		return err
+	}
+	if len(issues) == 0 {
+		fmt.Println("No issues found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ISSUE\tID\tTASK\tDETAIL")
+	for _, issue := range issues {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", issue.Kind, truncateID(issue.ID), truncateID(issue.TaskID), issue.Detail)
+	}
+	w.Flush()
+
+	if dbCheckRepair {
+		fmt.Printf("\nRepaired %d issues\n", len(issues))
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "\nFound %d issues; run with --repair to fix them\n", len(issues))
+	s.Close()
+	os.Exit(1)
+	return nil
+}
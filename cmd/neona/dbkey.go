@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/fentz26/neona/internal/keyring"
+	"github.com/fentz26/neona/internal/store"
+)
+
+const (
+	keyringService = "neona"
+	keyringAccount = "db-encryption-key"
+)
+
+// loadEncryptionKey returns the database content encryption key. The key is
+// taken from $NEONA_DB_KEY (base64) if set, otherwise from the OS keychain,
+// where a new random key is created on first use.
+func loadEncryptionKey() ([]byte, error) {
+	if encoded := os.Getenv("NEONA_DB_KEY"); encoded != "" {
+		return decodeKey(encoded, "NEONA_DB_KEY")
+	}
+
+	encoded, err := keyring.Get(keyringService, keyringAccount)
+	if err == nil {
+		return decodeKey(encoded, "keychain")
+	}
+	if !errors.Is(err, keyring.ErrNotFound) {
+		return nil, fmt.Errorf("read key from keychain: %w (set NEONA_DB_KEY instead)", err)
+	}
+
+	key := make([]byte, store.EncryptionKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+	if err := keyring.Set(keyringService, keyringAccount, base64.StdEncoding.EncodeToString(key)); err != nil {
+		return nil, fmt.Errorf("save key to keychain: %w", err)
+	}
+	log.Printf("Created database encryption key in the OS keychain (service %q, account %q)", keyringService, keyringAccount)
+	return key, nil
+}
+
+func decodeKey(encoded, source string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decode key from %s: %w", source, err)
+	}
+	if len(key) != store.EncryptionKeySize {
+		return nil, fmt.Errorf("key from %s must be %d bytes, got %d", source, store.EncryptionKeySize, len(key))
+	}
+	return key, nil
+}
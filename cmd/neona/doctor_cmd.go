@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/fentz26/neona/internal/crash"
+	"github.com/fentz26/neona/internal/paths"
+	"github.com/fentz26/neona/internal/update"
+	"github.com/spf13/cobra"
+)
+
+var doctorReport bool
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the local Neona setup and crash reports",
+	Long: `Shows the version, the directories Neona uses, whether the daemon answers
+and the crash reports the daemon has written.
+
+With --report, prints the newest crash report for attaching to a bug report.
+It holds the panic, its stack and the last audit actions before the crash;
+read it through before sharing.`,
+	Args: cobra.NoArgs,
+	RunE: runDoctor,
+}
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorReport, "report", false, "Print the newest crash report to share it")
+	rootCmd.AddCommand(doctorCmd)
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	reports, err := crash.List(paths.CrashesPath())
+	if err != nil {
+		return err
+	}
+	if doctorReport {
+		if len(reports) == 0 {
+			fmt.Printf("No crash reports in %s\n", paths.CrashesPath())
+			return nil
+		}
+		data, err := os.ReadFile(reports[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Crash report %s:\n", reports[0])
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("Neona %s (%s/%s, %s)\n", update.GetCurrentVersion(), runtime.GOOS, runtime.GOARCH, runtime.Version())
+	fmt.Printf("Data dir:      %s\n", paths.DataDir())
+	fmt.Printf("Config dir:    %s\n", paths.ConfigDir())
+	if _, err := os.Stat(paths.DBPath()); err != nil {
+		fmt.Printf("Database:      %s (not found)\n", paths.DBPath())
+	} else {
+		fmt.Printf("Database:      %s\n", paths.DBPath())
+	}
+	if health, err := CheckHealth(); err != nil {
+		fmt.Printf("Daemon:        not reachable at %s (%v)\n", apiAddr, err)
+	} else {
+		fmt.Printf("Daemon:        %s, version %s, db %s\n", apiAddr, health.Version, health.DB)
+	}
+
+	if len(reports) == 0 {
+		fmt.Println("Crash reports: none")
+		return nil
+	}
+	fmt.Printf("Crash reports: %d in %s\n", len(reports), paths.CrashesPath())
+	if latest, err := crash.Load(reports[0]); err == nil {
+		fmt.Printf("  Newest: %s in %s: %s\n", latest.Time.Local().Format("2006-01-02 15:04"), latest.Component, latest.Panic)
+	}
+	fmt.Println("Run `neona doctor --report` to print it for a bug report.")
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fentz26/neona/internal/mcp"
+	"github.com/fentz26/neona/internal/workspace"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export Neona state for other tools",
+}
+
+var exportRulesCmd = &cobra.Command{
+	Use:   "rules [dir]",
+	Short: "Write agent instruction files (CLAUDE.md, Cursor rules) from project memory and policy",
+	Long: `Renders the project's shared state into the instruction file each agent
+reads, so every tool works from the same rules: the policy in .ai/policy.yaml,
+the MCP servers that are always on, and the project's memory, including rule
+files synced with neona memory sync.
+
+Formats:
+  claude   CLAUDE.md; the rules go in a marked block and the rest of the
+           file is left as written
+  cursor   .cursor/rules/neona.mdc, generated as a whole
+
+Without --format, files are written for the agents detected in the
+repository containing dir (default: the current directory).`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runExportRules,
+}
+
+var (
+	exportFormats []string
+	exportProject string
+	exportStdout  bool
+)
+
+func init() {
+	exportCmd.AddCommand(exportRulesCmd)
+
+	exportRulesCmd.Flags().StringSliceVar(&exportFormats, "format", nil, "Formats to write: "+strings.Join(workspace.RuleFormatNames(), ", ")+" (default: detected)")
+	exportRulesCmd.Flags().StringVar(&exportProject, "project", "", "Project name (default: the repository directory's name)")
+	exportRulesCmd.Flags().BoolVar(&exportStdout, "stdout", false, "Print the rules instead of writing files")
+}
+
+func runExportRules(cmd *cobra.Command, args []string) error {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	_, src, err := workspace.FindRuleFiles(dir, true)
+	if err != nil {
+		return err
+	}
+	root := src.Root
+
+	var formats []workspace.RuleFormat
+	for _, name := range exportFormats {
+		f, ok := workspace.RuleFormats[name]
+		if !ok {
+			return fmt.Errorf("unknown format %q (want %s)", name, strings.Join(workspace.RuleFormatNames(), ", "))
+		}
+		formats = append(formats, f)
+	}
+	if len(formats) == 0 {
+		if formats = workspace.DetectRuleFormats(root); len(formats) == 0 {
+			return fmt.Errorf("no agent instruction files found in %s; pass --format %s", root, strings.Join(workspace.RuleFormatNames(), ","))
+		}
+	}
+
+	project := exportProject
+	if project == "" {
+		project = filepath.Base(root)
+	}
+	export, err := buildRulesExport(root, "project:"+project)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range formats {
+		if exportStdout {
+			fmt.Print(export.Render(f))
+			continue
+		}
+		changed, err := workspace.WriteRules(root, f, export)
+		if err != nil {
+			return err
+		}
+		if changed {
+			fmt.Printf("Wrote %s\n", f.Path)
+		} else {
+			fmt.Printf("%s is up to date\n", f.Path)
+		}
+	}
+	return nil
+}
+
+// buildRulesExport gathers the policy in root, the always-on MCP servers
+// and the memory items in scope.
+func buildRulesExport(root, scope string) (workspace.RulesExport, error) {
+	export := workspace.RulesExport{Scope: scope}
+	policy, err := workspace.LoadPolicy(root)
+	if err != nil {
+		return export, err
+	}
+	export.Policy = policy
+
+	cfg, err := mcp.LoadConfigFromHome()
+	if err != nil {
+		return export, fmt.Errorf("loading MCP config: %w", err)
+	}
+	if cfg.Enabled {
+		reg := mcp.NewRegistry()
+		reg.RegisterDefaults()
+		for _, name := range cfg.AlwaysOn {
+			if cfg.IsAlwaysOff(name) {
+				continue
+			}
+			tool := workspace.RuleTool{Name: name}
+			if server, ok := reg.Get(name); ok {
+				tool.Categories = server.Categories
+			}
+			export.Tools = append(export.Tools, tool)
+		}
+	}
+
+	resp, err := apiGet("/memory?" + url.Values{"scope": {scope}}.Encode())
+	if err != nil {
+		return export, err
+	}
+	var items []MemoryItem
+	if err := json.Unmarshal(resp, &items); err != nil {
+		return export, fmt.Errorf("failed to parse response: %w", err)
+	}
+	// Synced files by path, then notes oldest first, so unchanged state
+	// renders the same file
+	for i := len(items) - 1; i >= 0; i-- {
+		export.Notes = append(export.Notes, workspace.RuleNote{Content: items[i].Content, Source: items[i].Source})
+	}
+	sort.SliceStable(export.Notes, func(i, j int) bool {
+		a, b := export.Notes[i], export.Notes[j]
+		if (a.Source == "") != (b.Source == "") {
+			return a.Source != ""
+		}
+		return a.Source < b.Source
+	})
+	return export, nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fentz26/neona/internal/controlplane"
+	"github.com/fentz26/neona/internal/paths"
+	"github.com/fentz26/neona/pkg/client"
+)
+
+// journalEntry is a write queued while the daemon was offline.
+type journalEntry struct {
+	// ID is sent as the Idempotency-Key so a replay that is retried after a
+	// lost response does not create a task twice.
+	ID       string          `json:"id"`
+	Path     string          `json:"path"`
+	Body     json.RawMessage `json:"body"`
+	What     string          `json:"what"`
+	QueuedAt time.Time       `json:"queued_at"`
+	// Conflict says why replay held the entry back. Held entries wait for
+	// neona sync --force or --drop.
+	Conflict string `json:"conflict,omitempty"`
+}
+
+func appendJournal(path string, entries []journalEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// readJournal returns the queued entries, oldest first. A missing journal
+// is empty.
+func readJournal(path string) ([]journalEntry, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []journalEntry
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var e journalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// writeJournal replaces the journal, removing it when entries is empty.
+func writeJournal(path string, entries []journalEntry) error {
+	if len(entries) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if err := appendJournal(tmp, entries); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// replayResult summarizes a replay.
+type replayResult struct {
+	Sent int
+	// Held lists entries kept back for a conflict.
+	Held []journalEntry
+	// Pending counts entries not attempted because the daemon was
+	// unreachable or failing.
+	Pending int
+	// Offline is set when the daemon could not be reached.
+	Offline bool
+}
+
+var (
+	replayMu sync.Mutex
+	replayed bool
+)
+
+// replayJournalOnce sends queued writes before a command's first request
+// that finds the daemon up.
+func replayJournalOnce() {
+	replayMu.Lock()
+	defer replayMu.Unlock()
+	if replayed {
+		return
+	}
+	res, err := replayJournal(paths.JournalPath(), false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: offline journal: %v\n", err)
+	}
+	replayed = !res.Offline
+	if len(res.Held) > 0 {
+		fmt.Fprintf(os.Stderr, "%d queued write(s) held back for conflicts; review them with neona sync --list\n", len(res.Held))
+	}
+}
+
+// replayJournal sends queued writes in order. Unless force is set, entries
+// that conflict with the daemon's current state, or that it rejects, are
+// held in the journal instead of being sent or lost. Replay stops at the
+// first entry the daemon cannot take right now.
+//
+// The journal is renamed while it is replayed so concurrent commands do not
+// send the same entries; entries queued meanwhile are kept after the
+// remaining ones.
+func replayJournal(path string, force bool) (replayResult, error) {
+	var res replayResult
+	claimed := fmt.Sprintf("%s.%d", path, os.Getpid())
+	if err := os.Rename(path, claimed); err != nil {
+		return res, nil // nothing queued
+	}
+	entries, err := readJournal(claimed)
+	if err != nil {
+		return res, fmt.Errorf("unreadable, left at %s: %w", claimed, err)
+	}
+
+	var keep []journalEntry
+	for i, e := range entries {
+		if !force {
+			if e.Conflict == "" {
+				reason, err := journalConflict(e)
+				if err != nil {
+					res.Offline = isOffline(err)
+					res.Pending = len(entries) - i
+					keep = append(keep, entries[i:]...)
+					break
+				}
+				e.Conflict = reason
+			}
+			if e.Conflict != "" {
+				res.Held = append(res.Held, e)
+				keep = append(keep, e)
+				continue
+			}
+		}
+
+		_, err := apiSend(http.MethodPost, e.Path, e.Body, http.Header{controlplane.IdempotencyHeader: {e.ID}})
+		var apiErr *APIError
+		switch {
+		case err == nil:
+			res.Sent++
+			fmt.Fprintf(os.Stderr, "Sent queued %s\n", e.What)
+			continue
+		case errors.As(err, &apiErr) && apiErr.StatusCode < 500:
+			e.Conflict = "rejected by the daemon: " + apiErr.Message
+			res.Held = append(res.Held, e)
+			keep = append(keep, e)
+			continue
+		}
+		res.Offline = isOffline(err)
+		res.Pending = len(entries) - i
+		keep = append(keep, entries[i:]...)
+		break
+	}
+
+	// Keep entries queued by other commands during the replay
+	current, err := readJournal(path)
+	if err != nil {
+		return res, err
+	}
+	if err := writeJournal(path, append(keep, current...)); err != nil {
+		return res, fmt.Errorf("requeue failed, left at %s: %w", claimed, err)
+	}
+	os.Remove(claimed)
+	return res, nil
+}
+
+// journalConflict checks whether a queued write still makes sense against
+// the daemon's current state, returning the reason when it does not.
+func journalConflict(e journalEntry) (string, error) {
+	switch {
+	case e.Path == "/tasks":
+		var req struct {
+			Title string `json:"title"`
+		}
+		json.Unmarshal(e.Body, &req)
+		resp, err := apiSend(http.MethodGet, "/tasks", nil, nil)
+		if err != nil {
+			return "", err
+		}
+		var tasks []struct {
+			ID     string `json:"id"`
+			Title  string `json:"title"`
+			Status string `json:"status"`
+		}
+		if err := json.Unmarshal(resp, &tasks); err != nil {
+			return "", err
+		}
+		for _, t := range tasks {
+			if t.Status != "completed" && t.Status != "failed" && strings.EqualFold(strings.TrimSpace(t.Title), strings.TrimSpace(req.Title)) {
+				return fmt.Sprintf("open task %s already has this title", truncateID(t.ID)), nil
+			}
+		}
+
+	case e.Path == "/memory":
+		var req struct {
+			Content string `json:"content"`
+		}
+		json.Unmarshal(e.Body, &req)
+		resp, err := apiSend(http.MethodGet, "/memory?q="+url.QueryEscape(req.Content), nil, nil)
+		if err != nil {
+			return "", err
+		}
+		var items []struct {
+			ID      string `json:"id"`
+			Content string `json:"content"`
+		}
+		if err := json.Unmarshal(resp, &items); err != nil {
+			return "", err
+		}
+		for _, item := range items {
+			if item.Content == req.Content {
+				return fmt.Sprintf("memory item %s already has this content", truncateID(item.ID)), nil
+			}
+		}
+
+	case strings.HasSuffix(e.Path, "/comments"):
+		_, err := apiSend(http.MethodGet, strings.TrimSuffix(e.Path, "/comments"), nil, nil)
+		if client.IsNotFound(err) {
+			return "the task no longer exists", nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
@@ -4,10 +4,10 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/fentz26/neona/internal/paths"
 	"github.com/spf13/cobra"
 )
 
@@ -42,11 +42,7 @@ func init() {
 }
 
 func getLogPath() (string, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
-	}
-	return filepath.Join(homeDir, ".neona", "neona.log"), nil
+	return paths.LogPath(), nil
 }
 
 func runLog(cmd *cobra.Command, args []string) error {
@@ -62,7 +58,7 @@ func runLog(cmd *cobra.Command, args []string) error {
 		fmt.Println("The daemon may be logging to stdout/stderr. To capture logs:")
 		fmt.Println("")
 		fmt.Println("  1. Run 'neona daemon' in a terminal to see live output")
-		fmt.Println("  2. Or redirect output: neona daemon > ~/.neona/neona.log 2>&1 &")
+		fmt.Printf("  2. Or redirect output: neona daemon > %s 2>&1 &\n", logPath)
 		fmt.Println("")
 		fmt.Println("If running via systemd, check with: journalctl -u neona")
 		return nil
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/fentz26/neona/internal/apiclient"
 	"github.com/fentz26/neona/internal/update"
 	"github.com/spf13/cobra"
 )
@@ -13,15 +14,22 @@ var rootCmd = &cobra.Command{
 	Short: "Neona - AI Control Plane CLI",
 	Long:  `Neona is a CLI-centric AI Control Plane that coordinates multiple AI tools under shared rules, knowledge, and policy.`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if apiConfigErr != nil {
+			fmt.Fprintln(os.Stderr, "Error:", apiConfigErr)
+			os.Exit(1)
+		}
+
 		// Skip update check for certain commands
 		skipCommands := map[string]bool{
 			"update":    true,
 			"version":   true,
 			"uninstall": true,
 			"help":      true,
+			"doctor":    true,
 		}
 
-		if skipCommands[cmd.Name()] {
+		// The agent bridge's stdout is its protocol stream
+		if skipCommands[cmd.Name()] || cmd.HasParent() && cmd.Parent().Name() == "agent" {
 			return
 		}
 
@@ -42,18 +50,35 @@ var rootCmd = &cobra.Command{
 
 var (
 	apiAddr string
+	apiKey  string
+
+	// apiConfig holds the client settings from the environment, which the
+	// --api flags override.
+	apiConfig    apiclient.Config
+	apiConfigErr error
 )
 
 func init() {
-	rootCmd.PersistentFlags().StringVar(&apiAddr, "api", "http://127.0.0.1:7466", "API server address")
+	apiConfig, apiConfigErr = apiclient.FromEnv()
+	rootCmd.PersistentFlags().StringVar(&apiAddr, "api", apiConfig.Addr, "API server address (or set "+apiclient.AddrEnv+")")
+	rootCmd.PersistentFlags().StringVar(&apiKey, "api-key", apiConfig.APIKey, "API key for daemons started with --api-keys (or set NEONA_API_KEY)")
+	rootCmd.PersistentFlags().DurationVar(&apiConfig.Timeout, "api-timeout", apiConfig.Timeout, "Timeout for each API request attempt, 0 for none (or set "+apiclient.TimeoutEnv+")")
+	rootCmd.PersistentFlags().IntVar(&apiConfig.Retries, "api-retries", apiConfig.Retries, "Retries for idempotent API requests that fail transiently (or set "+apiclient.RetriesEnv+")")
 
 	// Add subcommands
 	rootCmd.AddCommand(daemonCmd)
 	rootCmd.AddCommand(taskCmd)
+	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(memoryCmd)
 	rootCmd.AddCommand(tuiCmd)
 	rootCmd.AddCommand(mcpCmd)
 	rootCmd.AddCommand(logCmd)
+	rootCmd.AddCommand(scriptsCmd)
+	rootCmd.AddCommand(benchCmd)
+	rootCmd.AddCommand(topCmd)
+	rootCmd.AddCommand(syncCmd)
+	rootCmd.AddCommand(redactCmd)
+	rootCmd.AddCommand(exportCmd)
 }
 
 func main() {
@@ -178,14 +178,17 @@ func runMCPRoute(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	// Apply override if specified
-	var r mcp.Router = router
+	// Preview with the configured strategy, applying any override
+	r, err := mcp.NewRouterFromConfig(router.GetConfig(), router.GetRegistry())
+	if err != nil {
+		return err
+	}
 	if mcpOverride != "" {
 		overrides := strings.Split(mcpOverride, ",")
 		for i := range overrides {
 			overrides[i] = strings.TrimSpace(overrides[i])
 		}
-		r = router.Override(overrides)
+		r = r.Override(overrides)
 	}
 
 	task := mcp.Task{
@@ -210,6 +213,14 @@ func runMCPRoute(cmd *cobra.Command, args []string) error {
 	if len(result.MatchedRules) > 0 {
 		fmt.Printf("\nMatched rules: %s\n", strings.Join(result.MatchedRules, ", "))
 	}
+	fmt.Printf("Strategy: %s", result.Strategy)
+	if result.Cached {
+		fmt.Print(" (cached)")
+	}
+	if result.FallbackReason != "" {
+		fmt.Printf(" (fallback: %s)", result.FallbackReason)
+	}
+	fmt.Println()
 
 	fmt.Printf("\nTool budget: %d/%d", result.FilteredTools, router.GetConfig().MaxToolsPerTask)
 	if result.FilteredTools < result.TotalTools {
@@ -3,10 +3,13 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"text/tabwriter"
 
+	"github.com/fentz26/neona/internal/workspace"
 	"github.com/spf13/cobra"
 )
 
@@ -27,22 +30,60 @@ var memoryQueryCmd = &cobra.Command{
 	RunE:  runMemoryQuery,
 }
 
+var memoryPromoteCmd = &cobra.Command{
+	Use:   "promote <memory-id>",
+	Short: "Share a memory item more widely, e.g. from its task to a project",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runMemoryPromote,
+}
+
+var memorySyncCmd = &cobra.Command{
+	Use:   "sync [dir]",
+	Short: "Sync a repository's rule files (AGENTS.md, .cursorrules, ...) into project memory",
+	Long: `Reads the agent rule and knowledge files committed in the repository
+containing dir (default: the current directory), such as AGENTS.md,
+CLAUDE.md, .cursorrules and .cursor/rules/*.mdc, and keeps one memory item
+per file in scope project:<name>. Files whose content changed since the last
+sync replace their item, and items for files no longer in the repository
+are removed.
+
+Files are read as committed at HEAD; pass --worktree to read them from disk
+instead. With --check nothing is written: the command lists stale files and
+exits 1 if there are any.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runMemorySync,
+}
+
 var (
 	memContent string
 	memTags    string
 	memTaskID  string
 	memQuery   string
+	memScope   string
+
+	memSyncProject  string
+	memSyncCheck    bool
+	memSyncWorktree bool
 )
 
 func init() {
-	memoryCmd.AddCommand(memoryAddCmd, memoryQueryCmd)
+	memoryCmd.AddCommand(memoryAddCmd, memoryQueryCmd, memoryPromoteCmd, memorySyncCmd)
 
 	memoryAddCmd.Flags().StringVar(&memContent, "content", "", "Memory content (required)")
 	memoryAddCmd.Flags().StringVar(&memTags, "tags", "", "Comma-separated tags")
 	memoryAddCmd.Flags().StringVar(&memTaskID, "task", "", "Associated task ID")
+	memoryAddCmd.Flags().StringVar(&memScope, "scope", "", "global or project:<name> (default: the task, or global without one)")
 	memoryAddCmd.MarkFlagRequired("content")
 
 	memoryQueryCmd.Flags().StringVar(&memQuery, "q", "", "Search query")
+	memoryQueryCmd.Flags().StringVar(&memScope, "scope", "", "Comma-separated scopes to search, e.g. project:web,global")
+
+	memoryPromoteCmd.Flags().StringVar(&memScope, "scope", "", "Wider scope: project:<name> or global (required)")
+	memoryPromoteCmd.MarkFlagRequired("scope")
+
+	memorySyncCmd.Flags().StringVar(&memSyncProject, "project", "", "Project name (default: the repository directory's name)")
+	memorySyncCmd.Flags().BoolVar(&memSyncCheck, "check", false, "Report stale files without syncing; exit 1 if any")
+	memorySyncCmd.Flags().BoolVar(&memSyncWorktree, "worktree", false, "Read files from disk, including uncommitted edits")
 }
 
 // MemoryItem represents a memory entry from the API
@@ -51,6 +92,8 @@ type MemoryItem struct {
 	TaskID  string `json:"task_id"`
 	Content string `json:"content"`
 	Tags    string `json:"tags"`
+	Scope   string `json:"scope"`
+	Source  string `json:"source"`
 }
 
 func runMemoryAdd(cmd *cobra.Command, args []string) error {
@@ -58,29 +101,45 @@ func runMemoryAdd(cmd *cobra.Command, args []string) error {
 		"content": memContent,
 		"tags":    memTags,
 		"task_id": memTaskID,
+		"scope":   memScope,
 	}
 
-	resp, err := apiPost("/memory", body)
-	if err != nil {
+	resp, queued, err := apiPostOrQueue("/memory", body, "memory item")
+	if err != nil || queued {
 		return err
 	}
 
-	var result map[string]interface{}
+	var result struct {
+		ID        string `json:"id"`
+		SeenCount int    `json:"seen_count"`
+		Duplicate bool   `json:"duplicate"`
+	}
 	if err := json.Unmarshal(resp, &result); err != nil {
 		return err
 	}
 
-	fmt.Printf("Created memory item: %s\n", result["id"])
+	if result.Duplicate {
+		fmt.Printf("Already in memory as %s (seen %d times)\n", result.ID, result.SeenCount)
+		return nil
+	}
+	fmt.Printf("Created memory item: %s\n", result.ID)
 	return nil
 }
 
 func runMemoryQuery(cmd *cobra.Command, args []string) error {
-	url := "/memory"
+	params := url.Values{}
 	if memQuery != "" {
-		url += "?q=" + memQuery
+		params.Set("q", memQuery)
+	}
+	if memScope != "" {
+		params.Set("scope", memScope)
+	}
+	path := "/memory"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
 	}
 
-	resp, err := apiGet(url)
+	resp, err := apiGet(path)
 	if err != nil {
 		return err
 	}
@@ -115,15 +174,109 @@ func runMemoryQuery(cmd *cobra.Command, args []string) error {
 
 	// Output results in table format
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "ID\tTASK\tCONTENT\tTAGS")
+	fmt.Fprintln(w, "ID\tTASK\tSCOPE\tCONTENT\tTAGS")
 
 	for _, item := range items {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
 			truncateID(item.ID),
 			truncateID(item.TaskID),
+			scopeLabel(item.Scope),
 			truncate(item.Content, 50),
 			item.Tags)
 	}
 	w.Flush()
 	return nil
 }
+
+// scopeLabel shortens task scopes, whose IDs are long, for tables.
+func scopeLabel(scope string) string {
+	if id, ok := strings.CutPrefix(scope, "task:"); ok {
+		return "task:" + truncateID(id)
+	}
+	return scope
+}
+
+func runMemoryPromote(cmd *cobra.Command, args []string) error {
+	resp, err := apiPost("/memory/"+args[0]+"/promote", map[string]string{"scope": memScope})
+	if err != nil {
+		return err
+	}
+
+	var item MemoryItem
+	if err := json.Unmarshal(resp, &item); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	fmt.Printf("Memory item %s is now in scope %s\n", truncateID(item.ID), item.Scope)
+	return nil
+}
+
+func runMemorySync(cmd *cobra.Command, args []string) error {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	files, src, err := workspace.FindRuleFiles(dir, memSyncWorktree)
+	if err != nil {
+		return err
+	}
+	project := memSyncProject
+	if project == "" {
+		project = filepath.Base(src.Root)
+	}
+
+	list := []map[string]string{}
+	for _, f := range files {
+		list = append(list, map[string]string{"path": f.Path, "content": f.Content})
+	}
+	resp, err := apiPost("/memory/sync", map[string]interface{}{"project": project, "files": list, "dry_run": memSyncCheck})
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Scope string `json:"scope"`
+		Files []struct {
+			Path     string `json:"path"`
+			Status   string `json:"status"`
+			MemoryID string `json:"memory_id"`
+		} `json:"files"`
+		Stale int `json:"stale"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	from := src.Root
+	if src.Commit != "" {
+		from += " at " + src.Commit[:min(len(src.Commit), 12)]
+	}
+	if len(result.Files) == 0 {
+		fmt.Printf("No rule files in %s\n", from)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tSTATUS\tMEMORY")
+	for _, f := range result.Files {
+		status := f.Status
+		if memSyncCheck && status != "unchanged" {
+			status = "stale (" + status + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", f.Path, status, truncateID(f.MemoryID))
+	}
+	w.Flush()
+
+	switch {
+	case memSyncCheck && result.Stale > 0:
+		fmt.Fprintf(os.Stderr, "\n%d rule file(s) in %s are stale; run neona memory sync to update them\n", result.Stale, result.Scope)
+		os.Exit(1)
+	case memSyncCheck:
+		fmt.Printf("\n%s is up to date with %s\n", result.Scope, from)
+	default:
+		fmt.Printf("\nSynced %s from %s (%d changed)\n", result.Scope, from, result.Stale)
+	}
+	return nil
+}
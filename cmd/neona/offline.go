@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fentz26/neona/internal/paths"
+	"github.com/google/uuid"
+)
+
+// offlineEnv selects what the CLI does when the daemon is not running:
+// "prompt" (the default) asks on a terminal and fails otherwise, "start"
+// starts the daemon, "queue" journals writes that can wait, and "fail"
+// just reports it.
+const offlineEnv = "NEONA_OFFLINE"
+
+// OfflineError is returned when the daemon cannot be reached at all.
+type OfflineError struct {
+	Addr string
+	Err  error
+}
+
+func (e *OfflineError) Error() string {
+	return fmt.Sprintf("daemon not running at %s (start it with `neona daemon`, or set %s=start)", e.Addr, offlineEnv)
+}
+
+func (e *OfflineError) Unwrap() error {
+	return e.Err
+}
+
+// isOffline reports whether err means the request never reached the API:
+// nothing listening, no route, or no DNS, as on a laptop off the network.
+// A daemon that answered with an error is not offline.
+func isOffline(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return errors.As(err, &opErr) && opErr.Op == "dial" || errors.As(err, &dnsErr)
+}
+
+func offlineMode() string {
+	return strings.ToLower(strings.TrimSpace(os.Getenv(offlineEnv)))
+}
+
+// interactive reports whether the user can answer a prompt.
+func interactive() bool {
+	for _, f := range []*os.File{os.Stdin, os.Stderr} {
+		info, err := f.Stat()
+		if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// confirm asks a yes/no question on stderr; an empty answer is yes.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [Y/n] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
+
+var (
+	startOfflineOnce sync.Once
+	startedOffline   bool
+)
+
+// startOffline starts the daemon after a request found it offline, asking
+// first unless NEONA_OFFLINE says what to do. It decides once per command,
+// so a declined prompt is not repeated for every request.
+func startOffline() bool {
+	startOfflineOnce.Do(func() {
+		switch offlineMode() {
+		case "start":
+		case "", "prompt":
+			if !interactive() || !confirm(fmt.Sprintf("Daemon not running at %s. Start it now?", apiAddr)) {
+				return
+			}
+		default:
+			return
+		}
+		if err := startDaemon(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to start daemon: %v\n", err)
+			return
+		}
+		startedOffline = true
+	})
+	return startedOffline
+}
+
+// apiPostOrQueue is apiPost for writes that can wait for the daemon. When
+// the daemon is offline and the user agrees (or NEONA_OFFLINE=queue), the
+// write is added to the journal and queued is true; it is sent the next
+// time any command reaches the daemon. what describes the write in
+// messages, e.g. "task \"Fix login\"".
+func apiPostOrQueue(path string, data interface{}, what string) (resp []byte, queued bool, err error) {
+	resp, err = apiPost(path, data)
+	var offline *OfflineError
+	if !errors.As(err, &offline) {
+		return resp, false, err
+	}
+	switch offlineMode() {
+	case "queue":
+	case "", "prompt":
+		if !interactive() || !confirm(fmt.Sprintf("Queue the %s until the daemon is back?", what)) {
+			return nil, false, err
+		}
+	default:
+		return nil, false, err
+	}
+
+	body, jerr := json.Marshal(data)
+	if jerr != nil {
+		return nil, false, jerr
+	}
+	entry := journalEntry{ID: uuid.New().String(), Path: path, Body: body, What: what, QueuedAt: time.Now().UTC()}
+	if jerr := appendJournal(paths.JournalPath(), []journalEntry{entry}); jerr != nil {
+		return nil, false, fmt.Errorf("queue %s: %w", what, jerr)
+	}
+	fmt.Fprintf(os.Stderr, "Daemon offline: queued %s; it is sent the next time neona reaches the daemon (see neona sync).\n", what)
+	return nil, true, nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// selfPath returns the binary the command was started as. After an update
+// that path holds the new binary, while os.Executable may still name the
+// old one.
+func selfPath() (string, error) {
+	if bin, err := exec.LookPath(os.Args[0]); err == nil {
+		return bin, nil
+	}
+	return os.Executable()
+}
@@ -12,10 +12,12 @@ func configureDaemonProc(cmd *exec.Cmd) {
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
 }
 
+// restartSelf replaces the process with the updated binary, keeping its
+// arguments, environment and pid.
 func restartSelf() error {
-	argv0, err := exec.LookPath(os.Args[0])
+	bin, err := selfPath()
 	if err != nil {
 		return err
 	}
-	return syscall.Exec(argv0, os.Args, os.Environ())
+	return syscall.Exec(bin, os.Args, os.Environ())
 }
@@ -3,18 +3,47 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
+	"syscall"
 )
 
+// detachedProcess is DETACHED_PROCESS: the child gets no console, so
+// closing the TUI's console window does not take the daemon with it.
+const detachedProcess = 0x00000008
+
 func configureDaemonProc(cmd *exec.Cmd) {
-	// Windows doesn't use Setsid.
-	// By default, started processes can be independent enough for our simple use case.
+	// The Windows counterpart of Setsid: a new process group without the
+	// parent's console, so Ctrl+C in the TUI does not reach the daemon
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess,
+		HideWindow:    true,
+	}
 }
 
+// restartSelf runs the updated binary with the same arguments and exits
+// with its status. Windows has no exec, so the old process stays behind,
+// passing its console through, until the new one finishes.
 func restartSelf() error {
-	fmt.Println("Please restart Neona to use the new version.")
+	bin, err := selfPath()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(bin, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// Ctrl+C reaches both processes through the shared console; the new
+	// one decides what it means
+	signal.Ignore(os.Interrupt)
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		return fmt.Errorf("run %s: %w", bin, err)
+	}
 	os.Exit(0)
 	return nil
 }
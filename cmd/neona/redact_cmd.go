@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/fentz26/neona/internal/paths"
+	"github.com/fentz26/neona/internal/redact"
+	"github.com/fentz26/neona/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var redactCmd = &cobra.Command{
+	Use:   "redact",
+	Short: "Find secrets stored in memory and run output",
+}
+
+var redactScanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Audit the database for leaked secrets",
+	Long: `Reads every memory item and run output in the database and lists the
+API keys, tokens, private keys and emails found in them, using the same
+patterns as the daemon's --redact. Matches are shown shortened. The command
+exits with status 1 when it finds anything, so it can gate CI jobs.
+
+The database is read directly, so the daemon can keep running.`,
+	RunE: runRedactScan,
+}
+
+var (
+	redactScanDB        string
+	redactScanEncrypted bool
+	redactScanPatterns  []string
+	redactScanSkip      []string
+)
+
+func init() {
+	redactCmd.AddCommand(redactScanCmd)
+
+	redactScanCmd.Flags().StringVar(&redactScanDB, "db", paths.DBPath(), "Path to SQLite database")
+	redactScanCmd.Flags().BoolVar(&redactScanEncrypted, "encrypted", false, "The daemon runs with --encrypt; read the key as it does")
+	redactScanCmd.Flags().StringArrayVar(&redactScanPatterns, "pattern", nil, "Extra pattern, as NAME=REGEX (repeatable)")
+	redactScanCmd.Flags().StringSliceVar(&redactScanSkip, "skip", nil, "Built-in patterns to turn off, e.g. email")
+}
+
+// buildRedactor builds a redactor from the built-in patterns minus skip,
+// plus the NAME=REGEX specs given.
+func buildRedactor(specs, skip []string) (*redact.Redactor, error) {
+	var extra []redact.Pattern
+	for _, spec := range specs {
+		p, err := redact.ParsePattern(spec)
+		if err != nil {
+			return nil, err
+		}
+		extra = append(extra, p)
+	}
+	patterns, err := redact.Select(skip, extra...)
+	if err != nil {
+		return nil, err
+	}
+	return redact.New(patterns...), nil
+}
+
+func runRedactScan(cmd *cobra.Command, args []string) error {
+	redactor, err := buildRedactor(redactScanPatterns, redactScanSkip)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(redactScanDB); err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+	s, err := store.New(redactScanDB)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if redactScanEncrypted {
+		key, err := loadEncryptionKey()
+		if err != nil {
+			return fmt.Errorf("database encryption: %w", err)
+		}
+		cipher, err := store.NewCipher(key)
+		if err != nil {
+			return fmt.Errorf("database encryption: %w", err)
+		}
+		s.SetCipher(cipher)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	found, items := 0, 0
+	err = s.ScanContent(func(ref store.ContentRef, content string) error {
+		findings := redactor.Scan(content)
+		if len(findings) == 0 {
+			return nil
+		}
+		if found == 0 {
+			fmt.Fprintln(w, "WHERE\tID\tTASK\tPATTERN\tMATCH")
+		}
+		items++
+		for _, f := range findings {
+			found++
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", ref.Kind, truncateID(ref.ID), truncateID(ref.TaskID), f.Pattern, redact.Mask(f.Match))
+		}
+		return nil
+	})
+	w.Flush()
+	if err == store.ErrEncryptedContent {
+		return fmt.Errorf("%w (pass --encrypted)", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if found == 0 {
+		fmt.Println("No secrets found")
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "\nFound %d possible secrets in %d stored items\n", found, items)
+	os.Exit(1)
+	return nil
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fentz26/neona/internal/connectors/localexec"
+	"github.com/fentz26/neona/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Execute commands for tasks",
+}
+
+var runExecCmd = &cobra.Command{
+	Use:   "exec <task-id> -- command [args...]",
+	Short: "Run an allowlisted command for a task on this machine",
+	Long: `Claims the task (or verifies this holder already owns it), runs an
+allowlisted command in the current directory with output streamed to the
+terminal, and heartbeats the lease while the command runs.
+
+The run is recorded on the task. On exit code 0 the task is completed;
+otherwise the claim is released so another worker can retry it. The
+command's exit code becomes neona's exit code.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runRunExec,
+}
+
+var runRetryCmd = &cobra.Command{
+	Use:   "retry <run-id>",
+	Short: "Run a recorded run's command again",
+	Long: `Re-executes a run's command and args for its task through the daemon,
+subject to the task's claim and the daemon's policies, as "task run" does.
+The new run records which run it retried, so the two can be compared with
+"task log". The original run's stdin is not replayed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRunRetry,
+}
+
+var (
+	execHolder string
+	execToken  string
+	execTTL    int
+
+	retryHolder string
+	retryToken  string
+	retryEnv    map[string]string
+)
+
+func init() {
+	runCmd.AddCommand(runExecCmd, runRetryCmd)
+
+	hostname, _ := os.Hostname()
+	runExecCmd.Flags().StringVar(&execHolder, "holder", fmt.Sprintf("cli@%s", hostname), "Holder ID for the lease")
+	runExecCmd.Flags().StringVar(&execToken, "token", "", "Holder token when the task is already claimed (or set "+holderTokenEnv+")")
+	runExecCmd.Flags().IntVar(&execTTL, "ttl", 0, "Lease TTL in seconds, renewed every third of it (default: the daemon's for the task's project)")
+
+	runRetryCmd.Flags().StringVar(&retryHolder, "holder", fmt.Sprintf("cli@%s", hostname), "Holder ID of the task's claim")
+	runRetryCmd.Flags().StringVar(&retryToken, "token", "", "Holder token from the claim (or set "+holderTokenEnv+")")
+	runRetryCmd.Flags().StringToStringVar(&retryEnv, "env", nil, "Set a variable for the command, as KEY=VALUE (repeatable; the daemon's --run-env-allow must permit it)")
+}
+
+func runRunRetry(cmd *cobra.Command, args []string) error {
+	token := retryToken
+	if token == "" {
+		token = os.Getenv(holderTokenEnv)
+	}
+	resp, err := apiPost("/runs/"+args[0]+"/retry", map[string]interface{}{
+		"holder_id":    retryHolder,
+		"holder_token": token,
+		"env":          retryEnv,
+	})
+	if err != nil {
+		return deniedCommandError(err)
+	}
+
+	var run struct {
+		ID       string   `json:"id"`
+		TaskID   string   `json:"task_id"`
+		Command  string   `json:"command"`
+		Args     []string `json:"args"`
+		ExitCode int      `json:"exit_code"`
+		Stdout   string   `json:"stdout"`
+		Stderr   string   `json:"stderr"`
+		RetryOf  string   `json:"retry_of"`
+	}
+	if err := json.Unmarshal(resp, &run); err != nil {
+		return err
+	}
+
+	fmt.Printf("Run ID:    %s\n", run.ID)
+	fmt.Printf("Retry of:  %s\n", run.RetryOf)
+	fmt.Printf("Command:   %s\n", strings.Join(append([]string{run.Command}, run.Args...), " "))
+	fmt.Printf("Exit Code: %d\n", run.ExitCode)
+	fmt.Println("\n--- STDOUT ---")
+	fmt.Println(run.Stdout)
+	if run.Stderr != "" {
+		fmt.Println("\n--- STDERR ---")
+		fmt.Println(run.Stderr)
+	}
+	return nil
+}
+
+func runRunExec(cmd *cobra.Command, args []string) error {
+	if dash := cmd.ArgsLenAtDash(); dash != 1 {
+		return fmt.Errorf("usage: neona run exec <task-id> -- command [args...]")
+	}
+	if execTTL != 0 && execTTL < 3 {
+		return fmt.Errorf("--ttl must be at least 3 seconds")
+	}
+	taskID, command, cmdArgs := args[0], args[1], args[2:]
+
+	workDir, err := execWorkDir(taskID)
+	if err != nil {
+		return err
+	}
+	if execTTL, err = leaseTTL(taskID, execTTL); err != nil {
+		return err
+	}
+	if conn := localexec.New(workDir); !conn.IsAllowed(command, cmdArgs) {
+		return fmt.Errorf("command not allowed: %s %s (allowed commands include: %s)", command, strings.Join(cmdArgs, " "), strings.Join(conn.SuggestAllowed(command, cmdArgs, 3), ", "))
+	}
+
+	if err := ensureClaim(taskID); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lost := make(chan error, 1)
+	go heartbeatLease(ctx, taskID, lost, cancel)
+
+	var stdout, stderr bytes.Buffer
+	c := exec.CommandContext(ctx, command, cmdArgs...)
+	c.Dir = workDir
+	c.Stdin = os.Stdin
+	c.Stdout = io.MultiWriter(os.Stdout, &stdout)
+	c.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	c.Env = append(os.Environ(), "NEONA_TASK_ID="+taskID, "NEONA_HOLDER_ID="+execHolder, holderTokenEnv+"="+execToken)
+
+	exitCode := 0
+	runErr := c.Run()
+	cancel()
+	if runErr != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(runErr, &exitErr) {
+			releaseClaim(taskID)
+			return fmt.Errorf("run %s: %w", command, runErr)
+		}
+		exitCode = exitErr.ExitCode()
+	}
+
+	select {
+	case err := <-lost:
+		return fmt.Errorf("lease on task %s lost while running: %w", taskID, err)
+	default:
+	}
+
+	_, err = apiPost("/tasks/"+taskID+"/runs", map[string]interface{}{
+		"holder_id":    execHolder,
+		"holder_token": execToken,
+		"command":      command,
+		"args":         cmdArgs,
+		"exit_code":    exitCode,
+		"stdout":       stdout.String(),
+		"stderr":       stderr.String(),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record run: %v\n", err)
+	}
+
+	if exitCode == 0 {
+		if _, err := apiPost("/tasks/"+taskID+"/complete", map[string]string{"holder_id": execHolder, "holder_token": execToken}); err != nil {
+			return fmt.Errorf("complete task %s: %w", taskID, err)
+		}
+		fmt.Fprintf(os.Stderr, "Completed task %s\n", taskID)
+		return nil
+	}
+
+	releaseClaim(taskID)
+	fmt.Fprintf(os.Stderr, "Command exited with %d; released task %s\n", exitCode, taskID)
+	if exitCode < 0 {
+		exitCode = 1 // killed by a signal
+	}
+	os.Exit(exitCode)
+	return nil
+}
+
+// ensureClaim claims a pending task, or renews the lease if execHolder
+// already owns it and execToken is that claim's holder token.
+func ensureClaim(taskID string) error {
+	resp, err := apiGet("/tasks/" + taskID)
+	if err != nil {
+		return err
+	}
+	var task struct {
+		Status    string `json:"status"`
+		ClaimedBy string `json:"claimed_by"`
+	}
+	if err := json.Unmarshal(resp, &task); err != nil {
+		return err
+	}
+
+	switch {
+	case task.Status == "pending":
+		resp, err := apiPost("/tasks/"+taskID+"/claim", map[string]interface{}{"holder_id": execHolder, "ttl_sec": execTTL})
+		if err != nil {
+			return err
+		}
+		var lease struct {
+			HolderToken string `json:"holder_token"`
+		}
+		if err := json.Unmarshal(resp, &lease); err != nil {
+			return err
+		}
+		execToken = lease.HolderToken
+		return nil
+	case (task.Status == "claimed" || task.Status == "running") && task.ClaimedBy == execHolder:
+		if execToken == "" {
+			execToken = os.Getenv(holderTokenEnv)
+		}
+		return renewLease(taskID)
+	case task.ClaimedBy != "":
+		return fmt.Errorf("task %s is %s by %s", taskID, task.Status, task.ClaimedBy)
+	default:
+		return fmt.Errorf("task %s is %s", taskID, task.Status)
+	}
+}
+
+// leaseTTL returns the TTL the daemon grants claims and heartbeats on the
+// task that ask for ttlSec, 0 asking for its default, so that heartbeats
+// keep pace with its claim config. Daemons without GET /config grant what
+// is asked.
+func leaseTTL(taskID string, ttlSec int) (int, error) {
+	cfg, err := apiClient().DaemonConfig()
+	if client.IsNotFound(err) {
+		if ttlSec == 0 {
+			ttlSec = client.DefaultLeaseTTLSec
+		}
+		return ttlSec, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	task, err := apiClient().Task(taskID)
+	if err != nil {
+		return 0, err
+	}
+	return cfg.Claims.For(client.TaskProject(task)).TTL(ttlSec), nil
+}
+
+func renewLease(taskID string) error {
+	_, err := apiPost("/tasks/"+taskID+"/heartbeat", map[string]interface{}{"holder_id": execHolder, "holder_token": execToken, "ttl_sec": execTTL})
+	return err
+}
+
+// heartbeatLease renews the lease until ctx is done. If the daemon rejects
+// a renewal the lease is gone, so the command is cancelled via cancel and
+// the error is sent on lost; transient failures are only reported.
+func heartbeatLease(ctx context.Context, taskID string, lost chan<- error, cancel context.CancelFunc) {
+	ticker := time.NewTicker(time.Duration(execTTL) * time.Second / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := renewLease(taskID)
+			if client.IsForbidden(err) {
+				lost <- err
+				cancel()
+				return
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: lease heartbeat failed: %v\n", err)
+			}
+		}
+	}
+}
+
+func releaseClaim(taskID string) {
+	if _, err := apiPost("/tasks/"+taskID+"/release", map[string]string{"holder_id": execHolder, "holder_token": execToken}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to release task %s: %v\n", taskID, err)
+	}
+}
+
+// execWorkDir returns the task's workdir, or the current directory when it
+// has none.
+func execWorkDir(taskID string) (string, error) {
+	resp, err := apiGet("/tasks/" + taskID)
+	if err != nil {
+		return "", err
+	}
+	var task struct {
+		WorkDir string `json:"workdir"`
+	}
+	if err := json.Unmarshal(resp, &task); err != nil {
+		return "", err
+	}
+	if task.WorkDir == "" {
+		return os.Getwd()
+	}
+	if info, err := os.Stat(task.WorkDir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("task %s workdir %s is not a directory on this machine", taskID, task.WorkDir)
+	}
+	return task.WorkDir, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fentz26/neona/internal/connectors/scripts"
+	"github.com/spf13/cobra"
+)
+
+var scriptsCmd = &cobra.Command{
+	Use:   "scripts",
+	Short: "List the vetted scripts tasks can run",
+	Long: `Lists the scripts the daemon exposes through the scripts connector.
+Run one from a task created with --connector scripts:
+
+  neona task run <task-id> --cmd "rebuild-index 3 full"`,
+	RunE: runScripts,
+}
+
+func runScripts(cmd *cobra.Command, args []string) error {
+	resp, err := apiGet("/scripts")
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Enabled bool             `json:"enabled"`
+		Dir     string           `json:"dir"`
+		Scripts []scripts.Script `json:"scripts"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if !result.Enabled {
+		fmt.Println("Script library not enabled (start the daemon with --scripts-dir)")
+		return nil
+	}
+	if len(result.Scripts) == 0 {
+		fmt.Printf("No scripts in %s\n", result.Dir)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tARGS\tDESCRIPTION")
+	for _, s := range result.Scripts {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Name, argSynopsis(s.Args), s.Description)
+	}
+	w.Flush()
+	return nil
+}
+
+// argSynopsis renders a script's arguments usage-style, e.g.
+// "<shard:int> [mode:full|incremental]".
+func argSynopsis(args []scripts.Arg) string {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		spec := a.Name
+		if len(a.Enum) > 0 {
+			spec += ":" + strings.Join(a.Enum, "|")
+		} else if a.Type != "" && a.Type != "string" {
+			spec += ":" + a.Type
+		}
+		if a.Required {
+			parts[i] = "<" + spec + ">"
+		} else {
+			parts[i] = "[" + spec + "]"
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fentz26/neona/internal/cloudsync"
+	"github.com/fentz26/neona/internal/paths"
+	"github.com/spf13/cobra"
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Send writes queued while the daemon was offline",
+	Long: `Replays the offline journal: task creations, memory items and comments
+queued while the daemon was unreachable (see NEONA_OFFLINE). Commands also
+replay it automatically once they reach the daemon.
+
+Before each write is sent it is checked against the daemon's current state.
+A queued task whose title matches an open task, a memory item whose content
+already exists, or a comment on a task that is gone is held back as a
+conflict, as is a write the daemon rejects. Review held writes with --list,
+then send them anyway with --force or discard them with --drop.
+
+The daemon's neona.app cloud sync, if enabled, is shown by neona sync status.`,
+	RunE: runSync,
+}
+
+var syncStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the state of the daemon's cloud sync",
+	Long: `Shows what the daemon syncs with neona.app (start it with --cloud-sync),
+when it last synced and with what result, and the latest tasks whose status
+changed both locally and in the cloud, with the side that was kept.`,
+	Args: cobra.NoArgs,
+	RunE: runSyncStatus,
+}
+
+var (
+	syncList  bool
+	syncForce bool
+	syncDrop  []string
+)
+
+func init() {
+	syncCmd.Flags().BoolVar(&syncList, "list", false, "List queued writes without sending them")
+	syncCmd.Flags().BoolVar(&syncForce, "force", false, "Send queued writes even if they conflict")
+	syncCmd.Flags().StringSliceVar(&syncDrop, "drop", nil, "Discard queued writes by ID prefix, or \"conflicts\" for all held ones (repeatable)")
+	syncCmd.AddCommand(syncStatusCmd)
+}
+
+func runSync(cmd *cobra.Command, args []string) error {
+	path := paths.JournalPath()
+	if syncList {
+		return listJournal(path)
+	}
+	if len(syncDrop) > 0 {
+		return dropJournal(path, syncDrop)
+	}
+
+	// Replay explicitly rather than through apiDo so --force applies
+	replayMu.Lock()
+	replayed = true
+	replayMu.Unlock()
+	res, err := replayJournal(path, syncForce)
+	if err != nil {
+		return err
+	}
+	if res.Sent == 0 && len(res.Held) == 0 && res.Pending == 0 {
+		fmt.Println("Nothing queued")
+		return nil
+	}
+
+	if res.Sent > 0 || len(res.Held) > 0 {
+		fmt.Printf("Sent %d queued write(s)\n", res.Sent)
+	}
+	for _, e := range res.Held {
+		fmt.Printf("Held %s %s: %s\n", truncateID(e.ID), e.What, e.Conflict)
+	}
+	if len(res.Held) > 0 {
+		fmt.Println("Send held writes with neona sync --force, or discard them with neona sync --drop <id>")
+	}
+	if res.Pending > 0 {
+		if res.Offline {
+			return &OfflineError{Addr: apiAddr}
+		}
+		return fmt.Errorf("%d queued write(s) not sent; the daemon is failing requests", res.Pending)
+	}
+	return nil
+}
+
+func listJournal(path string) error {
+	entries, err := readJournal(path)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("Nothing queued")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tQUEUED\tWRITE\tSTATUS")
+	for _, e := range entries {
+		status := "queued"
+		if e.Conflict != "" {
+			status = "held: " + e.Conflict
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", truncateID(e.ID), e.QueuedAt.Local().Format("2006-01-02 15:04"), e.What, status)
+	}
+	w.Flush()
+	return nil
+}
+
+func dropJournal(path string, drop []string) error {
+	entries, err := readJournal(path)
+	if err != nil {
+		return err
+	}
+
+	var keep []journalEntry
+	dropped := 0
+	for _, e := range entries {
+		if matchesDrop(e, drop) {
+			fmt.Printf("Dropped %s %s\n", truncateID(e.ID), e.What)
+			dropped++
+			continue
+		}
+		keep = append(keep, e)
+	}
+	if dropped == 0 {
+		return fmt.Errorf("no queued write matches %s", strings.Join(drop, ", "))
+	}
+	return writeJournal(path, keep)
+}
+
+func matchesDrop(e journalEntry, drop []string) bool {
+	for _, d := range drop {
+		if d == "conflicts" && e.Conflict != "" || d != "conflicts" && strings.HasPrefix(e.ID, d) {
+			return true
+		}
+	}
+	return false
+}
+
+func runSyncStatus(cmd *cobra.Command, args []string) error {
+	resp, err := apiGet("/cloud/status")
+	if err != nil {
+		return err
+	}
+	var st cloudsync.Status
+	if err := json.Unmarshal(resp, &st); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if !st.Enabled {
+		fmt.Println("Cloud sync not enabled (start the daemon with --cloud-sync)")
+		return nil
+	}
+
+	fmt.Printf("Backend:    %s\n", st.URL)
+	if st.Device != "" {
+		fmt.Printf("Device:     %s\n", st.Device)
+	}
+	pushing := "all tasks"
+	if len(st.Labels) > 0 {
+		pushing = "tasks labelled " + strings.Join(st.Labels, ", ")
+	}
+	if st.Memory {
+		pushing += ", memory summaries"
+	}
+	fmt.Printf("Pushing:    %s\n", pushing)
+	if st.Team != "" {
+		fmt.Printf("Pulling:    team %s\n", st.Team)
+	} else {
+		fmt.Println("Pulling:    off (no --cloud-sync-team)")
+	}
+	fmt.Printf("Conflicts:  keep %s\n", st.Policy)
+	switch {
+	case st.Encrypted && st.KeyID != "":
+		fmt.Printf("Encryption: end-to-end, key %s\n", st.KeyID)
+	case st.Encrypted:
+		fmt.Println("Encryption: end-to-end")
+	default:
+		fmt.Println("Encryption: off (see neona sync key)")
+	}
+	if len(st.PlaintextDevices) > 0 {
+		fmt.Printf("Plaintext:  accepted from %s\n", strings.Join(st.PlaintextDevices, ", "))
+	}
+	if st.Rejected > 0 {
+		fmt.Printf("Rejected:   %d unencrypted task(s) from other devices\n", st.Rejected)
+	}
+	switch {
+	case st.LastSync == nil:
+		fmt.Println("Last sync:  never")
+	case st.LastError != "":
+		fmt.Printf("Last sync:  %s, failed: %s\n", st.LastSync.Local().Format("2006-01-02 15:04:05"), st.LastError)
+	default:
+		fmt.Printf("Last sync:  %s, ok\n", st.LastSync.Local().Format("2006-01-02 15:04:05"))
+	}
+	fmt.Printf("Totals:     %d pushed, %d pulled, %d linked task(s)\n", st.Pushed, st.Pulled, st.Linked)
+
+	if len(st.Conflicts) == 0 {
+		return nil
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK\tAT\tLOCAL\tREMOTE\tKEPT")
+	for i := len(st.Conflicts) - 1; i >= 0; i-- {
+		c := st.Conflicts[i]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", truncateID(c.TaskID), c.At.Local().Format("2006-01-02 15:04"), c.LocalStatus, c.RemoteStatus, c.Kept)
+	}
+	w.Flush()
+	return nil
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fentz26/neona/internal/cloudsync"
+	"github.com/fentz26/neona/internal/keyring"
+	"github.com/fentz26/neona/internal/paths"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// syncPassphraseEnv supplies the cloud sync passphrase without a prompt, as
+// the daemon needs.
+const syncPassphraseEnv = "NEONA_SYNC_PASSPHRASE"
+
+// syncKeyAccount is the keychain account of a cloud sync user key created
+// with --keychain.
+const syncKeyAccount = "cloud-sync-key"
+
+var syncKeyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Manage the keys cloud sync encrypts content with",
+	Long: `With a key file, a daemon started with --cloud-sync-e2e encrypts task
+titles, descriptions and labels and memory summaries before they are synced,
+so neona.app stores ciphertext only. IDs, statuses and times stay readable.
+
+The key file (cloud-keys.json in the config directory) is opened with a
+passphrase, taken from NEONA_SYNC_PASSPHRASE or asked for, or with a key in
+the OS keychain (--keychain). Copy it to every device that syncs the same
+content. Keep the recovery codes printed by init: each opens the file if the
+passphrase or keychain entry is lost.`,
+}
+
+var syncKeyInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the key file and print its recovery codes",
+	Args:  cobra.NoArgs,
+	RunE:  runSyncKeyInit,
+}
+
+var syncKeyRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Encrypt with a new key from now on",
+	Long: `Adds a new key and makes it current. Content encrypted before stays
+readable; the daemon pushes everything again under the new key on its next
+sync.`,
+	Args: cobra.NoArgs,
+	RunE: runSyncKeyRotate,
+}
+
+var syncKeyRecoverCmd = &cobra.Command{
+	Use:   "recover [code]",
+	Short: "Open the key file with a recovery code and set a new passphrase",
+	Long: `Opens the key file with a recovery code, then protects it with a new
+passphrase (or a new keychain key, if it used one) and prints new recovery
+codes. The old passphrase and codes stop working.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runSyncKeyRecover,
+}
+
+var syncKeyCodesCmd = &cobra.Command{
+	Use:   "codes",
+	Short: "Replace the recovery codes",
+	Args:  cobra.NoArgs,
+	RunE:  runSyncKeyCodes,
+}
+
+var (
+	syncKeyKeychain bool
+	syncKeyForce    bool
+)
+
+func init() {
+	syncKeyInitCmd.Flags().BoolVar(&syncKeyKeychain, "keychain", false, "Keep a random key in the OS keychain instead of using a passphrase")
+	syncKeyInitCmd.Flags().BoolVar(&syncKeyForce, "force", false, "Replace an existing key file; content encrypted with it becomes unreadable")
+	syncKeyCmd.AddCommand(syncKeyInitCmd, syncKeyRotateCmd, syncKeyRecoverCmd, syncKeyCodesCmd)
+	syncCmd.AddCommand(syncKeyCmd)
+}
+
+func runSyncKeyInit(cmd *cobra.Command, args []string) error {
+	path := paths.CloudKeysPath()
+	if _, err := os.Stat(path); err == nil && !syncKeyForce {
+		return fmt.Errorf("%s already exists (pass --force to replace it)", path)
+	}
+	userKey, kdf, err := newSyncUserKey(syncKeyKeychain)
+	if err != nil {
+		return err
+	}
+	u, codes, err := cloudsync.NewKeyFile(userKey, kdf)
+	if err != nil {
+		return err
+	}
+	if err := u.File.Save(path); err != nil {
+		return err
+	}
+	fmt.Printf("Created %s (key %s)\n", path, u.Keys.Current)
+	printRecoveryCodes(codes)
+	return nil
+}
+
+func runSyncKeyRotate(cmd *cobra.Command, args []string) error {
+	u, err := unlockSyncKeys()
+	if err != nil {
+		return err
+	}
+	id, err := u.Rotate()
+	if err != nil {
+		return err
+	}
+	if err := u.File.Save(paths.CloudKeysPath()); err != nil {
+		return err
+	}
+	fmt.Printf("Now encrypting with key %s; the daemon pushes everything again on its next sync\n", id)
+	return nil
+}
+
+func runSyncKeyRecover(cmd *cobra.Command, args []string) error {
+	f, err := cloudsync.LoadKeyFile(paths.CloudKeysPath())
+	if err != nil {
+		return err
+	}
+	var code string
+	if len(args) > 0 {
+		code = args[0]
+	} else {
+		if code, err = prompt("Recovery code: "); err != nil {
+			return err
+		}
+	}
+	u, err := f.UnlockRecovery(code)
+	if err != nil {
+		return err
+	}
+	userKey, kdf, err := newSyncUserKey(f.KDF == nil)
+	if err != nil {
+		return err
+	}
+	if err := u.SetUserKey(userKey, kdf); err != nil {
+		return err
+	}
+	codes, err := u.NewRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	if err := u.File.Save(paths.CloudKeysPath()); err != nil {
+		return err
+	}
+	fmt.Println("Recovered the key file")
+	printRecoveryCodes(codes)
+	return nil
+}
+
+func runSyncKeyCodes(cmd *cobra.Command, args []string) error {
+	u, err := unlockSyncKeys()
+	if err != nil {
+		return err
+	}
+	codes, err := u.NewRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	if err := u.File.Save(paths.CloudKeysPath()); err != nil {
+		return err
+	}
+	printRecoveryCodes(codes)
+	return nil
+}
+
+func printRecoveryCodes(codes []string) {
+	fmt.Println()
+	fmt.Println("Recovery codes (store them somewhere safe; they are not shown again):")
+	for _, c := range codes {
+		fmt.Println("  " + c)
+	}
+}
+
+// loadSyncKeys opens the key file for the daemon and returns a loader that
+// rereads it on each call, so a rotation is picked up while it runs.
+func loadSyncKeys() (func() (*cloudsync.Keys, error), error) {
+	path := paths.CloudKeysPath()
+	f, err := cloudsync.LoadKeyFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no key file at %s (run neona sync key init)", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	userKey, err := syncUserKey(f)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Unlock(userKey); err != nil {
+		return nil, err
+	}
+	return func() (*cloudsync.Keys, error) {
+		f, err := cloudsync.LoadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		u, err := f.Unlock(userKey)
+		if err != nil {
+			return nil, err
+		}
+		return u.Keys, nil
+	}, nil
+}
+
+// unlockSyncKeys opens the key file with its passphrase or keychain key.
+func unlockSyncKeys() (*cloudsync.Unlocked, error) {
+	f, err := cloudsync.LoadKeyFile(paths.CloudKeysPath())
+	if err != nil {
+		return nil, err
+	}
+	userKey, err := syncUserKey(f)
+	if err != nil {
+		return nil, err
+	}
+	return f.Unlock(userKey)
+}
+
+// syncUserKey returns the key that opens f: from the keychain, or derived
+// from the passphrase.
+func syncUserKey(f *cloudsync.KeyFile) ([]byte, error) {
+	if f.KDF == nil {
+		encoded, err := keyring.Get(keyringService, syncKeyAccount)
+		if err != nil {
+			return nil, fmt.Errorf("read cloud sync key from keychain: %w", err)
+		}
+		return base64.StdEncoding.DecodeString(encoded)
+	}
+	pass, err := syncPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	return cloudsync.DeriveKey(pass, *f.KDF), nil
+}
+
+// newSyncUserKey creates a user key: a random one saved in the keychain, or
+// one derived from a new passphrase.
+func newSyncUserKey(keychain bool) ([]byte, *cloudsync.KDF, error) {
+	if keychain {
+		key, err := cloudsync.NewUserKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := keyring.Set(keyringService, syncKeyAccount, base64.StdEncoding.EncodeToString(key)); err != nil {
+			return nil, nil, fmt.Errorf("save key to keychain: %w", err)
+		}
+		return key, nil, nil
+	}
+	pass, err := syncPassphrase(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	kdf, err := cloudsync.NewKDF()
+	if err != nil {
+		return nil, nil, err
+	}
+	return cloudsync.DeriveKey(pass, *kdf), kdf, nil
+}
+
+// syncPassphrase returns $NEONA_SYNC_PASSPHRASE, or asks for the passphrase
+// on a terminal, twice if confirm is set.
+func syncPassphrase(confirm bool) (string, error) {
+	if pass := os.Getenv(syncPassphraseEnv); pass != "" {
+		return pass, nil
+	}
+	if !interactive() {
+		return "", fmt.Errorf("no passphrase: set %s", syncPassphraseEnv)
+	}
+	pass, err := readSecret("Cloud sync passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		if len(pass) < 8 {
+			return "", errors.New("passphrase must be at least 8 characters")
+		}
+		again, err := readSecret("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != pass {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return pass, nil
+}
+
+func readSecret(label string) (string, error) {
+	fmt.Fprint(os.Stderr, label)
+	data, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return string(data), err
+}
+
+func prompt(label string) (string, error) {
+	fmt.Fprint(os.Stderr, label)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(line), err
+}
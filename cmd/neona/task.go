@@ -2,11 +2,18 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"sort"
 	"strings"
 	"text/tabwriter"
+	"time"
 
+	"github.com/fentz26/neona/internal/transport"
+	"github.com/fentz26/neona/pkg/client"
 	"github.com/spf13/cobra"
 )
 
@@ -41,6 +48,23 @@ var taskClaimCmd = &cobra.Command{
 	RunE:  runTaskClaim,
 }
 
+var taskClaimNextCmd = &cobra.Command{
+	Use:   "claim-next [-- command [args...]]",
+	Short: "Claim the next eligible pending task",
+	Long: `Atomically claims the pending task of highest priority matching the
+filters, the oldest of those, and prints it (with its lease) as JSON.
+
+If a command is given after --, it is executed instead of printing, with
+NEONA_TASK_ID, NEONA_LEASE_ID, NEONA_HOLDER_ID, NEONA_HOLDER_TOKEN, NEONA_API,
+NEONA_WORKDIR and NEONA_TASK_JSON set in its environment; the command's exit code
+becomes neona's exit code. It runs in the task's workdir when it has one.
+
+Exits with status 2 when no task is eligible, so shell workers can poll:
+
+  until neona task claim-next --label build -- ./work.sh; do sleep 5; done`,
+	RunE: runTaskClaimNext,
+}
+
 var taskReleaseCmd = &cobra.Command{
 	Use:   "release [task-id]",
 	Short: "Release a task claim",
@@ -50,7 +74,7 @@ var taskReleaseCmd = &cobra.Command{
 
 var taskRunCmd = &cobra.Command{
 	Use:   "run [task-id]",
-	Short: "Run a command for a task",
+	Short: "Run a command, or the task's pipeline, for a task",
 	Args:  cobra.ExactArgs(1),
 	RunE:  runTaskRun,
 }
@@ -62,45 +86,183 @@ var taskLogCmd = &cobra.Command{
 	RunE:  runTaskLog,
 }
 
+var taskCommentCmd = &cobra.Command{
+	Use:   "comment [task-id] [message...]",
+	Short: "Comment on a task",
+	Long: `Adds a comment to the task's discussion thread. Comments are for
+conversation about the task and are kept apart from memory.
+
+If the task is claimed by someone else, its holder is notified through
+/events.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runTaskComment,
+}
+
+var taskCommentsCmd = &cobra.Command{
+	Use:   "comments [task-id]",
+	Short: "Show a task's discussion thread",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runTaskComments,
+}
+
 var (
-	taskTitle  string
-	taskDesc   string
-	taskStatus string
-	holderID   string
-	ttlSec     int
-	runCommand string
-	runArgs    string
+	taskTitle    string
+	taskDesc     string
+	taskDescFile string
+	taskMutexKey string
+	taskLabels   []string
+	taskConn     string
+	taskWorkDir  string
+	taskParent   string
+	taskPriority int
+	taskEstimate time.Duration
+	taskDue      string
+	taskAfter    string
+	taskSteps    []string
+	showTree     bool
+	showRuns     int
+	showHistory  int
+	taskStatus   string
+	taskStale    bool
+	holderID     string
+	ttlSec       int
+	runCommand   string
+	runArgs      string
+	runStdinFile string
+	runPTY       bool
+	runEnv       map[string]string
+	runTimeout   time.Duration
+	runDryRun    bool
+	runPipeline  bool
+	logLimit     int
+	logOffset    int
+	claimLabel   string
+	claimConn    string
+	holderToken  string
+	author       string
 )
 
+// holderTokenEnv names the environment variable holding the token issued
+// with a claim, used by release and run when --token is not given.
+const holderTokenEnv = "NEONA_HOLDER_TOKEN"
+
+func holderTokenOrEnv() string {
+	if holderToken != "" {
+		return holderToken
+	}
+	return os.Getenv(holderTokenEnv)
+}
+
 func init() {
-	taskCmd.AddCommand(taskAddCmd, taskListCmd, taskShowCmd, taskClaimCmd, taskReleaseCmd, taskRunCmd, taskLogCmd)
+	taskCmd.AddCommand(taskAddCmd, taskListCmd, taskShowCmd, taskClaimCmd, taskClaimNextCmd, taskReleaseCmd, taskRunCmd, taskLogCmd, taskCommentCmd, taskCommentsCmd)
 
 	taskAddCmd.Flags().StringVar(&taskTitle, "title", "", "Task title (required)")
 	taskAddCmd.Flags().StringVar(&taskDesc, "desc", "", "Task description")
+	taskAddCmd.Flags().StringVar(&taskDescFile, "desc-file", "", "Read the description from a markdown file (- reads stdin); YAML frontmatter sets acceptance criteria, commands, labels and connector")
+	taskAddCmd.MarkFlagsMutuallyExclusive("desc", "desc-file")
+	taskAddCmd.Flags().StringVar(&taskMutexKey, "mutex-key", "", "Tasks sharing this key never run concurrently")
+	taskAddCmd.Flags().StringSliceVar(&taskLabels, "label", nil, "Label to attach (repeatable)")
+	taskAddCmd.Flags().StringVar(&taskConn, "connector", "", "Restrict the task to workers for this connector")
+	taskAddCmd.Flags().StringVar(&taskWorkDir, "workdir", "", "Directory the task's commands run in (must be inside a daemon --workdir-root)")
+	taskAddCmd.Flags().StringVar(&taskParent, "parent", "", "Make the task a subtask of this task")
+	taskAddCmd.Flags().IntVar(&taskPriority, "priority", 0, "Claim the task before pending tasks of lower priority (higher is more urgent; default 0, may be negative)")
+	taskAddCmd.Flags().DurationVar(&taskEstimate, "estimate", 0, "How long the task is expected to take (e.g. 90m)")
+	taskAddCmd.Flags().StringVar(&taskDue, "due", "", "Deadline, as RFC3339 or a duration from now (e.g. 48h)")
+	taskAddCmd.Flags().StringArrayVar(&taskSteps, "step", nil, "Pipeline step, e.g. 'go test ./...' (repeatable, run in order; a leading - continues past a failure)")
+	taskAddCmd.Flags().StringVar(&taskAfter, "not-before", "", "Don't dispatch before this time, as RFC3339 or a duration from now (e.g. 2h)")
 	taskAddCmd.MarkFlagRequired("title")
 
-	taskListCmd.Flags().StringVar(&taskStatus, "status", "", "Filter by status (pending, claimed, running, completed, failed)")
+	taskListCmd.Flags().StringVar(&taskStatus, "status", "", "Filter by status (pending, claimed, running, completed, failed), or scheduled for delayed pending tasks")
+	taskListCmd.Flags().BoolVar(&taskStale, "stale", false, "List claims with no heartbeat or run for the daemon's --stale-factor lease TTLs")
+
+	taskShowCmd.Flags().BoolVar(&showTree, "tree", false, "Show the task and its subtasks as a tree")
+	taskShowCmd.Flags().IntVar(&showRuns, "runs", 5, "Recent runs to show")
+	taskShowCmd.Flags().IntVar(&showHistory, "history", 20, "Recent audit records to show")
 
 	hostname, _ := os.Hostname()
 	defaultHolder := fmt.Sprintf("cli@%s", hostname)
 	taskClaimCmd.Flags().StringVar(&holderID, "holder", defaultHolder, "Holder ID for the lease")
-	taskClaimCmd.Flags().IntVar(&ttlSec, "ttl", 300, "Lease TTL in seconds")
+	taskClaimCmd.Flags().IntVar(&ttlSec, "ttl", 0, "Lease TTL in seconds (default: the daemon's, see GET /config)")
+
+	taskClaimNextCmd.Flags().StringVar(&holderID, "holder", defaultHolder, "Holder ID for the lease")
+	taskClaimNextCmd.Flags().IntVar(&ttlSec, "ttl", 0, "Lease TTL in seconds (default: the daemon's, see GET /config)")
+	taskClaimNextCmd.Flags().StringVar(&claimLabel, "label", "", "Only claim tasks carrying this label")
+	taskClaimNextCmd.Flags().StringVar(&claimConn, "connector", "", "Only claim tasks for this connector (or for any connector)")
 
 	taskReleaseCmd.Flags().StringVar(&holderID, "holder", defaultHolder, "Holder ID")
+	taskReleaseCmd.Flags().StringVar(&holderToken, "token", "", "Holder token from the claim (or set "+holderTokenEnv+")")
 
 	taskRunCmd.Flags().StringVar(&holderID, "holder", defaultHolder, "Holder ID")
+	taskRunCmd.Flags().StringVar(&holderToken, "token", "", "Holder token from the claim (or set "+holderTokenEnv+")")
 	taskRunCmd.Flags().StringVar(&runCommand, "cmd", "", "Command to run (e.g., 'git status')")
-	taskRunCmd.MarkFlagRequired("cmd")
+	taskRunCmd.Flags().StringVar(&runStdinFile, "stdin-file", "", "Feed this file to the command's stdin (- reads neona's own stdin)")
+	taskRunCmd.Flags().BoolVar(&runPTY, "pty", false, "Run the command on a pseudo-terminal, for programs that only prompt on one")
+	taskRunCmd.Flags().StringToStringVar(&runEnv, "env", nil, "Set a variable for the command, as KEY=VALUE (repeatable; the daemon's --run-env-allow must permit it)")
+	taskRunCmd.Flags().DurationVar(&runTimeout, "timeout", 0, "Stop the command after this long, e.g. 10m (0 for no limit; whole seconds)")
+	taskRunCmd.Flags().BoolVar(&runDryRun, "dry-run", false, "Check the command against the daemon's policies and show what would run, without running it")
+	taskRunCmd.Flags().BoolVar(&runPipeline, "pipeline", false, "Run the task's steps in order instead of one command")
+	taskRunCmd.MarkFlagsOneRequired("cmd", "pipeline")
+	for _, flag := range []string{"cmd", "stdin-file", "pty", "timeout", "dry-run"} {
+		taskRunCmd.MarkFlagsMutuallyExclusive("pipeline", flag)
+	}
+
+	taskLogCmd.Flags().IntVar(&logLimit, "limit", 20, "Runs to show, newest first (at most 200)")
+	taskLogCmd.Flags().IntVar(&logOffset, "offset", 0, "Newer runs to skip")
+
+	taskCommentCmd.Flags().StringVar(&author, "author", "", "Comment author (default: $USER, or the API key's principal)")
 }
 
 func runTaskAdd(cmd *cobra.Command, args []string) error {
-	body := map[string]string{
+	if taskDescFile != "" {
+		var desc []byte
+		var err error
+		if taskDescFile == "-" {
+			desc, err = io.ReadAll(os.Stdin)
+		} else {
+			desc, err = os.ReadFile(taskDescFile)
+		}
+		if err != nil {
+			return fmt.Errorf("read description: %w", err)
+		}
+		taskDesc = string(desc)
+	}
+	body := map[string]interface{}{
 		"title":       taskTitle,
 		"description": taskDesc,
+		"mutex_key":   taskMutexKey,
+		"labels":      taskLabels,
+		"connector":   taskConn,
+		"workdir":     taskWorkDir,
+		"parent_id":   taskParent,
+		"priority":    taskPriority,
+	}
+	if len(taskSteps) > 0 {
+		steps, err := parseSteps(taskSteps)
+		if err != nil {
+			return err
+		}
+		body["steps"] = steps
+	}
+	if taskEstimate > 0 {
+		body["estimate_sec"] = int(taskEstimate.Seconds())
+	}
+	if taskDue != "" {
+		due, err := parseFutureTime("--due", taskDue, time.Now())
+		if err != nil {
+			return err
+		}
+		body["due_at"] = due
+	}
+	if taskAfter != "" {
+		at, err := parseFutureTime("--not-before", taskAfter, time.Now())
+		if err != nil {
+			return err
+		}
+		body["not_before"] = at
 	}
 
-	resp, err := apiPost("/tasks", body)
-	if err != nil {
+	resp, queued, err := apiPostOrQueue("/tasks", body, fmt.Sprintf("task %q", taskTitle))
+	if err != nil || queued {
 		return err
 	}
 
@@ -113,8 +275,75 @@ func runTaskAdd(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// parseSteps reads --step flags into pipeline steps. A leading "-", as in
+// make, lets the pipeline continue when the step fails.
+func parseSteps(lines []string) ([]map[string]interface{}, error) {
+	steps := make([]map[string]interface{}, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		rest, cont := strings.CutPrefix(line, "-")
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("--step %q has no command", line)
+		}
+		steps = append(steps, map[string]interface{}{
+			"command":           fields[0],
+			"args":              fields[1:],
+			"continue_on_error": cont,
+		})
+	}
+	return steps, nil
+}
+
+// parseFutureTime reads a time flag such as --due: an RFC3339 time, or a
+// duration added to now.
+func parseFutureTime(flag, v string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("%s must be in the future", flag)
+		}
+		return now.Add(d).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: want an RFC3339 time or a duration such as 48h", flag)
+	}
+	return t.UTC(), nil
+}
+
+// localTime formats an RFC3339 timestamp from the API for display.
+func localTime(v string) string {
+	if at, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return at.Local().Format("2006-01-02 15:04")
+	}
+	return v
+}
+
+// dueLabel describes a task's deadline for listings: when it is due, and
+// whether it is overdue or was missed.
+func dueLabel(t map[string]interface{}) string {
+	due, _ := t["due_at"].(string)
+	if due == "" {
+		return ""
+	}
+	label := localTime(due)
+	switch {
+	case t["overdue"] == true:
+		label += " OVERDUE"
+	case t["sla_breached"] == true:
+		label += " (missed)"
+	}
+	return label
+}
+
 func runTaskList(cmd *cobra.Command, args []string) error {
 	url := "/tasks"
+	if taskStale {
+		if taskStatus != "" {
+			return fmt.Errorf("--stale and --status cannot be combined")
+		}
+		taskStatus = "stale"
+	}
 	if taskStatus != "" {
 		url += "?status=" + taskStatus
 	}
@@ -135,23 +364,39 @@ func runTaskList(cmd *cobra.Command, args []string) error {
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "ID\tTITLE\tSTATUS\tCLAIMED BY")
+	last := "DUE"
+	if taskStale {
+		last = "QUIET SINCE"
+	}
+	fmt.Fprintf(w, "ID\tTITLE\tSTATUS\tPRIORITY\tCLAIMED BY\t%s\n", last)
 	for _, t := range tasks {
 		id := truncateID(t["id"].(string))
 		title := truncate(t["title"].(string), 40)
 		status := t["status"].(string)
+		if t["scheduled"] == true {
+			status = "scheduled"
+		}
 		claimedBy := ""
 		if cb, ok := t["claimed_by"].(string); ok {
 			claimedBy = cb
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", id, title, status, claimedBy)
+		label := dueLabel(t)
+		if taskStale {
+			at, _ := t["last_activity_at"].(string)
+			label = localTime(at)
+		}
+		priority, _ := t["priority"].(float64)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", id, title, status, int(priority), claimedBy, label)
 	}
 	w.Flush()
 	return nil
 }
 
 func runTaskShow(cmd *cobra.Command, args []string) error {
-	resp, err := apiGet("/tasks/" + args[0])
+	if showTree {
+		return printTaskTree(args[0])
+	}
+	resp, err := apiGet(fmt.Sprintf("/tasks/%s?expand=all&runs_limit=%d&history_limit=%d", args[0], max(showRuns, 1), max(showHistory, 1)))
 	if err != nil {
 		return err
 	}
@@ -160,16 +405,116 @@ func runTaskShow(cmd *cobra.Command, args []string) error {
 	if err := json.Unmarshal(resp, &task); err != nil {
 		return err
 	}
+	var view taskView
+	if err := json.Unmarshal(resp, &view); err != nil {
+		return err
+	}
 
 	fmt.Printf("ID:          %s\n", task["id"])
 	fmt.Printf("Title:       %s\n", task["title"])
 	fmt.Printf("Description: %s\n", task["description"])
 	fmt.Printf("Status:      %s\n", task["status"])
+	if nb, ok := task["not_before"].(string); ok && nb != "" {
+		label := localTime(nb)
+		if task["scheduled"] == true {
+			label += " (scheduled)"
+		}
+		fmt.Printf("Not Before:  %s\n", label)
+	}
 	if cb, ok := task["claimed_by"].(string); ok && cb != "" {
 		fmt.Printf("Claimed By:  %s\n", cb)
 	}
+	if mk, ok := task["mutex_key"].(string); ok && mk != "" {
+		fmt.Printf("Mutex Key:   %s\n", mk)
+	}
+	if labels, ok := task["labels"].([]interface{}); ok && len(labels) > 0 {
+		parts := make([]string, len(labels))
+		for i, l := range labels {
+			parts[i] = fmt.Sprint(l)
+		}
+		fmt.Printf("Labels:      %s\n", strings.Join(parts, ", "))
+	}
+	if conn, ok := task["connector"].(string); ok && conn != "" {
+		fmt.Printf("Connector:   %s\n", conn)
+	}
+	if dir, ok := task["workdir"].(string); ok && dir != "" {
+		fmt.Printf("Workdir:     %s\n", dir)
+	}
+	if pr, ok := task["pr_url"].(string); ok && pr != "" {
+		fmt.Printf("PR:          %s\n", pr)
+	}
+	if parent, ok := task["parent_id"].(string); ok && parent != "" {
+		fmt.Printf("Parent:      %s\n", parent)
+	}
+	if priority, ok := task["priority"].(float64); ok && priority != 0 {
+		fmt.Printf("Priority:    %d\n", int(priority))
+	}
+	if est, ok := task["estimate_sec"].(float64); ok && est > 0 {
+		fmt.Printf("Estimate:    %s\n", time.Duration(est)*time.Second)
+	}
+	if due := dueLabel(task); due != "" {
+		fmt.Printf("Due:         %s\n", due)
+	}
+	if commands, ok := task["commands"].([]interface{}); ok && len(commands) > 0 {
+		fmt.Println("Commands:")
+		for _, c := range commands {
+			fmt.Printf("  - %s\n", c)
+		}
+	}
+	if steps, ok := task["steps"].([]interface{}); ok && len(steps) > 0 {
+		fmt.Println("Steps:")
+		for i, st := range steps {
+			step, _ := st.(map[string]interface{})
+			line := fmt.Sprint(step["command"])
+			if args, ok := step["args"].([]interface{}); ok {
+				for _, a := range args {
+					line += fmt.Sprintf(" %v", a)
+				}
+			}
+			if name, ok := step["name"].(string); ok && name != "" {
+				line = name + ": " + line
+			}
+			if when, ok := step["when"].(string); ok && when != "" {
+				line += "  (when " + when + ")"
+			}
+			if step["continue_on_error"] == true {
+				line += "  (continues on error)"
+			}
+			fmt.Printf("  %d. %s\n", i+1, line)
+		}
+	}
 	fmt.Printf("Created:     %s\n", task["created_at"])
 	fmt.Printf("Updated:     %s\n", task["updated_at"])
+	printTaskView(view)
+
+	// The checklist starts out as the task's acceptance criteria
+	items, err := fetchChecklist(args[0])
+	if err != nil {
+		return err
+	}
+	if len(items) > 0 {
+		done := 0
+		for _, item := range items {
+			if item.Done {
+				done++
+			}
+		}
+		fmt.Printf("\nChecklist (%d/%d):\n", done, len(items))
+		printChecklist(items)
+	}
+
+	resp, err = apiGet("/tasks/" + args[0] + "/comments")
+	if err != nil {
+		return err
+	}
+	var comments []map[string]interface{}
+	if err := json.Unmarshal(resp, &comments); err != nil {
+		return err
+	}
+	if len(comments) > 0 {
+		fmt.Printf("\nComments (%d):\n", len(comments))
+		printComments(comments)
+	}
 
 	return nil
 }
@@ -193,12 +538,76 @@ func runTaskClaim(cmd *cobra.Command, args []string) error {
 	fmt.Printf("Claimed task %s\n", args[0])
 	fmt.Printf("Lease ID: %s\n", lease["id"])
 	fmt.Printf("Expires:  %s\n", lease["expires_at"])
+	fmt.Printf("Token:    %s\n", lease["holder_token"])
+	fmt.Printf("\nRelease and run require the token:\n  export %s=%s\n", holderTokenEnv, lease["holder_token"])
 	return nil
 }
 
-func runTaskRelease(cmd *cobra.Command, args []string) error {
+// exitNoTask is claim-next's exit status when no task is eligible.
+const exitNoTask = 2
+
+func runTaskClaimNext(cmd *cobra.Command, args []string) error {
 	body := map[string]interface{}{
 		"holder_id": holderID,
+		"ttl_sec":   ttlSec,
+		"label":     claimLabel,
+		"connector": claimConn,
+	}
+
+	resp, err := apiPost("/tasks/claim-next", body)
+	if err != nil {
+		return err
+	}
+	if len(resp) == 0 {
+		fmt.Fprintln(os.Stderr, "No eligible pending task")
+		os.Exit(exitNoTask)
+	}
+
+	var claim struct {
+		Task struct {
+			ID      string `json:"id"`
+			WorkDir string `json:"workdir"`
+		} `json:"task"`
+		Lease struct {
+			ID          string `json:"id"`
+			HolderToken string `json:"holder_token"`
+		} `json:"lease"`
+	}
+	if err := json.Unmarshal(resp, &claim); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		fmt.Println(strings.TrimSpace(string(resp)))
+		return nil
+	}
+
+	c := exec.Command(args[0], args[1:]...)
+	c.Dir = claim.Task.WorkDir
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	c.Env = append(os.Environ(),
+		"NEONA_TASK_ID="+claim.Task.ID,
+		"NEONA_WORKDIR="+claim.Task.WorkDir,
+		"NEONA_LEASE_ID="+claim.Lease.ID,
+		"NEONA_HOLDER_ID="+holderID,
+		holderTokenEnv+"="+claim.Lease.HolderToken,
+		"NEONA_API="+apiAddr,
+		"NEONA_TASK_JSON="+strings.TrimSpace(string(resp)),
+	)
+	if err := c.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		return fmt.Errorf("run %s for task %s: %w", args[0], claim.Task.ID, err)
+	}
+	return nil
+}
+
+func runTaskRelease(cmd *cobra.Command, args []string) error {
+	body := map[string]interface{}{
+		"holder_id":    holderID,
+		"holder_token": holderTokenOrEnv(),
 	}
 
 	_, err := apiPost("/tasks/"+args[0]+"/release", body)
@@ -211,6 +620,10 @@ func runTaskRelease(cmd *cobra.Command, args []string) error {
 }
 
 func runTaskRun(cmd *cobra.Command, args []string) error {
+	if runPipeline {
+		return runTaskPipeline(args[0])
+	}
+
 	// Parse command string into command and args
 	parts := strings.Fields(runCommand)
 	if len(parts) == 0 {
@@ -218,14 +631,36 @@ func runTaskRun(cmd *cobra.Command, args []string) error {
 	}
 
 	body := map[string]interface{}{
-		"holder_id": holderID,
-		"command":   parts[0],
-		"args":      parts[1:],
+		"holder_id":    holderID,
+		"holder_token": holderTokenOrEnv(),
+		"command":      parts[0],
+		"args":         parts[1:],
+		"pty":          runPTY,
+		"env":          runEnv,
+		"timeout_sec":  int(runTimeout.Round(time.Second) / time.Second),
+		"dry_run":      runDryRun,
+	}
+	if runStdinFile != "" {
+		var stdin []byte
+		var err error
+		if runStdinFile == "-" {
+			stdin, err = io.ReadAll(os.Stdin)
+		} else {
+			stdin, err = os.ReadFile(runStdinFile)
+		}
+		if err != nil {
+			return fmt.Errorf("read stdin: %w", err)
+		}
+		body["stdin"] = string(stdin)
 	}
 
 	resp, err := apiPost("/tasks/"+args[0]+"/run", body)
 	if err != nil {
-		return err
+		return deniedCommandError(err)
+	}
+
+	if runDryRun {
+		return printRunPlan(resp)
 	}
 
 	var run map[string]interface{}
@@ -244,8 +679,131 @@ func runTaskRun(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// runTaskPipeline runs a task's steps and prints a line per run.
+func runTaskPipeline(taskID string) error {
+	resp, err := apiPost("/tasks/"+taskID+"/pipeline", map[string]interface{}{
+		"holder_id":    holderID,
+		"holder_token": holderTokenOrEnv(),
+		"env":          runEnv,
+	})
+	if err != nil {
+		return deniedCommandError(err)
+	}
+
+	var res struct {
+		Status  string                       `json:"status"`
+		Skipped int                          `json:"skipped"`
+		Outputs map[string]map[string]string `json:"outputs"`
+		Runs    []struct {
+			ID       string   `json:"id"`
+			Command  string   `json:"command"`
+			Args     []string `json:"args"`
+			ExitCode int      `json:"exit_code"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(resp, &res); err != nil {
+		return err
+	}
+	for _, run := range res.Runs {
+		fmt.Printf("%-8s exit %-3d %s\n", truncateID(run.ID), run.ExitCode, strings.Join(append([]string{run.Command}, run.Args...), " "))
+	}
+	if res.Skipped > 0 {
+		fmt.Printf("%d steps skipped\n", res.Skipped)
+	}
+	steps := make([]string, 0, len(res.Outputs))
+	for step := range res.Outputs {
+		steps = append(steps, step)
+	}
+	sort.Strings(steps)
+	for _, step := range steps {
+		names := make([]string, 0, len(res.Outputs[step]))
+		for name := range res.Outputs[step] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s.%s = %s\n", step, name, res.Outputs[step][name])
+		}
+	}
+	fmt.Printf("Task %s\n", res.Status)
+	return nil
+}
+
+// printRunPlan prints the daemon's answer to a dry run.
+func printRunPlan(resp []byte) error {
+	var plan struct {
+		Connector  string            `json:"connector"`
+		Path       string            `json:"path"`
+		Command    string            `json:"command"`
+		Args       []string          `json:"args"`
+		Dir        string            `json:"dir"`
+		Env        map[string]string `json:"env"`
+		StdinLen   int               `json:"stdin_len"`
+		PTY        bool              `json:"pty"`
+		MCPServers []string          `json:"mcp_servers"`
+		// Capabilities maps each optional feature to whether the connector
+		// supports it.
+		Capabilities map[string]bool `json:"capabilities"`
+	}
+	if err := json.Unmarshal(resp, &plan); err != nil {
+		return err
+	}
+
+	fmt.Println("Dry run: the command was not executed")
+	fmt.Printf("Connector: %s\n", plan.Connector)
+	fmt.Printf("Command:   %s\n", strings.Join(append([]string{plan.Command}, plan.Args...), " "))
+	if plan.Path != "" {
+		fmt.Printf("Path:      %s\n", plan.Path)
+	}
+	if plan.Dir != "" {
+		fmt.Printf("Workdir:   %s\n", plan.Dir)
+	}
+	names := make([]string, 0, len(plan.Env))
+	for name := range plan.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("Env:       %s=%s\n", name, plan.Env[name])
+	}
+	if plan.StdinLen > 0 || plan.PTY {
+		fmt.Printf("Stdin:     %d bytes (pty: %t)\n", plan.StdinLen, plan.PTY)
+	}
+	if len(plan.MCPServers) > 0 {
+		fmt.Printf("MCP:       %s\n", strings.Join(plan.MCPServers, ", "))
+	}
+	var supported []string
+	for feature, ok := range plan.Capabilities {
+		if ok {
+			supported = append(supported, feature)
+		}
+	}
+	if len(supported) > 0 {
+		sort.Strings(supported)
+		fmt.Printf("Supports:  %s\n", strings.Join(supported, ", "))
+	}
+	return nil
+}
+
+// deniedCommandError turns the daemon's refusal of a command outside its
+// allowlist into a message naming the closest allowed commands.
+func deniedCommandError(err error) error {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != client.CodeCommandDenied {
+		return err
+	}
+	var denied client.CommandDenied
+	if json.Unmarshal([]byte(apiErr.Body), &denied) != nil || denied.Error == "" {
+		return err
+	}
+	if len(denied.Suggestions) == 0 {
+		return errors.New(denied.Error)
+	}
+	return fmt.Errorf("%s (allowed commands include: %s)", denied.Error, strings.Join(denied.Suggestions, ", "))
+}
+
 func runTaskLog(cmd *cobra.Command, args []string) error {
-	resp, err := apiGet("/tasks/" + args[0] + "/logs")
+	resp, err := apiGet(fmt.Sprintf("/tasks/%s/logs?limit=%d&offset=%d", args[0], logLimit, logOffset))
 	if err != nil {
 		return err
 	}
@@ -261,16 +819,225 @@ func runTaskLog(cmd *cobra.Command, args []string) error {
 	}
 
 	for i, run := range runs {
-		fmt.Printf("=== Run %d ===\n", i+1)
+		fmt.Printf("=== Run %d ===\n", logOffset+i+1)
 		fmt.Printf("ID:        %s\n", run["id"])
 		fmt.Printf("Command:   %s\n", run["command"])
 		fmt.Printf("Exit Code: %.0f\n", run["exit_code"].(float64))
 		fmt.Printf("Started:   %s\n", run["started_at"])
+		if retryOf, ok := run["retry_of"].(string); ok && retryOf != "" {
+			fmt.Printf("Retry of:  %s\n", retryOf)
+		}
 		if stdout, ok := run["stdout"].(string); ok && stdout != "" {
 			fmt.Println("Stdout:", truncate(stdout, 200))
 		}
+		if truncated, _ := run["truncated"].(bool); truncated {
+			fmt.Println("Output was cut at the daemon's --run-output-limit")
+		}
 		fmt.Println()
 	}
+	if len(runs) == logLimit {
+		fmt.Printf("Older runs: neona task log %s --offset %d\n", args[0], logOffset+logLimit)
+	}
+	return nil
+}
+
+func runTaskComment(cmd *cobra.Command, args []string) error {
+	body := map[string]string{
+		"author": commentAuthor(),
+		"body":   strings.Join(args[1:], " "),
+	}
+	resp, queued, err := apiPostOrQueue("/tasks/"+args[0]+"/comments", body, "comment on task "+args[0])
+	if err != nil || queued {
+		return err
+	}
+
+	var comment map[string]interface{}
+	if err := json.Unmarshal(resp, &comment); err != nil {
+		return err
+	}
+	fmt.Printf("Comment added: %s\n", comment["id"])
+	return nil
+}
+
+// commentAuthor returns the --author flag, or $USER when no API key is in
+// use. With an API key the daemon defaults the author to its principal.
+func commentAuthor() string {
+	if author != "" {
+		return author
+	}
+	if apiKey != "" || os.Getenv(transport.APIKeyEnv) != "" {
+		return ""
+	}
+	if user := os.Getenv("USER"); user != "" {
+		return user
+	}
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("cli@%s", hostname)
+}
+
+func runTaskComments(cmd *cobra.Command, args []string) error {
+	resp, err := apiGet("/tasks/" + args[0] + "/comments")
+	if err != nil {
+		return err
+	}
+
+	var comments []map[string]interface{}
+	if err := json.Unmarshal(resp, &comments); err != nil {
+		return err
+	}
+	printComments(comments)
+	return nil
+}
+
+func printComments(comments []map[string]interface{}) {
+	if len(comments) == 0 {
+		fmt.Println("No comments")
+		return
+	}
+	for _, c := range comments {
+		fmt.Printf("[%s] %s:\n", c["created_at"], c["author"])
+		for _, line := range strings.Split(fmt.Sprint(c["body"]), "\n") {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+}
+
+// taskView holds the sections of GET /tasks/{id}?expand=all that task show
+// prints.
+type taskView struct {
+	Lease *struct {
+		ID        string    `json:"id"`
+		HolderID  string    `json:"holder_id"`
+		ExpiresAt time.Time `json:"expires_at"`
+	} `json:"lease"`
+	Runs []struct {
+		Command   string    `json:"command"`
+		Args      []string  `json:"args"`
+		ExitCode  int       `json:"exit_code"`
+		StartedAt time.Time `json:"started_at"`
+		EndedAt   time.Time `json:"ended_at"`
+	} `json:"runs"`
+	RunCount int `json:"run_count"`
+	Memory   *struct {
+		Count  int `json:"count"`
+		Recent []struct {
+			Content string `json:"content"`
+		} `json:"recent"`
+	} `json:"memory"`
+	History []struct {
+		Action    string    `json:"action"`
+		Outcome   string    `json:"outcome"`
+		Details   string    `json:"details"`
+		Timestamp time.Time `json:"timestamp"`
+	} `json:"history"`
+	Routing *struct {
+		MCPs       []string `json:"mcps"`
+		TotalTools int      `json:"total_tools"`
+		Strategy   string   `json:"strategy"`
+		Cached     bool     `json:"cached"`
+	} `json:"routing"`
+}
+
+func printTaskView(v taskView) {
+	if v.Lease != nil {
+		fmt.Printf("\nLease: %s held by %s, expires in %s\n", truncateID(v.Lease.ID), v.Lease.HolderID, time.Until(v.Lease.ExpiresAt).Round(time.Second))
+	}
+
+	if v.RunCount > 0 {
+		fmt.Printf("\nRuns (%d of %d, newest first):\n", len(v.Runs), v.RunCount)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, r := range v.Runs {
+			duration := "running"
+			if !r.EndedAt.IsZero() {
+				duration = r.EndedAt.Sub(r.StartedAt).Round(time.Millisecond).String()
+			}
+			command := strings.TrimSpace(r.Command + " " + strings.Join(r.Args, " "))
+			fmt.Fprintf(w, "  %s\texit %d\t%s\t%s\n", r.StartedAt.Local().Format("2006-01-02 15:04:05"), r.ExitCode, duration, truncate(command, 50))
+		}
+		w.Flush()
+	}
+
+	if v.Memory != nil && v.Memory.Count > 0 {
+		fmt.Printf("\nMemory (%d):\n", v.Memory.Count)
+		for _, item := range v.Memory.Recent {
+			fmt.Printf("  - %s\n", truncate(strings.Join(strings.Fields(item.Content), " "), 70))
+		}
+	}
+
+	if v.Routing != nil {
+		mcps := strings.Join(v.Routing.MCPs, ", ")
+		if mcps == "" {
+			mcps = "none"
+		}
+		cached := ""
+		if v.Routing.Cached {
+			cached = ", cached"
+		}
+		fmt.Printf("\nRouting: %s (%d tools, %s%s)\n", mcps, v.Routing.TotalTools, v.Routing.Strategy, cached)
+	}
+
+	if len(v.History) > 0 {
+		fmt.Println("\nHistory:")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, h := range v.History {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", h.Timestamp.Local().Format("2006-01-02 15:04:05"), h.Action, h.Outcome, h.Details)
+		}
+		w.Flush()
+	}
+}
+
+// treeTask is the part of a task the subtask tree shows.
+type treeTask struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Status    string    `json:"status"`
+	ParentID  string    `json:"parent_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// printTaskTree prints a task and its subtasks, recursively.
+func printTaskTree(taskID string) error {
+	resp, err := apiGet("/tasks")
+	if err != nil {
+		return err
+	}
+	var tasks []treeTask
+	if err := json.Unmarshal(resp, &tasks); err != nil {
+		return err
+	}
+
+	var root *treeTask
+	children := make(map[string][]treeTask)
+	for i, t := range tasks {
+		if t.ID == taskID {
+			root = &tasks[i]
+		}
+		if t.ParentID != "" {
+			children[t.ParentID] = append(children[t.ParentID], t)
+		}
+	}
+	// The list is by priority; show subtasks in creation order
+	for _, subs := range children {
+		sort.SliceStable(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	}
+	if root == nil {
+		return fmt.Errorf("task %s not found", taskID)
+	}
+
+	fmt.Printf("%s  %s [%s]\n", truncateID(root.ID), root.Title, root.Status)
+	var walk func(id, indent string)
+	walk = func(id, indent string) {
+		subs := children[id]
+		for i, t := range subs {
+			branch, next := "├── ", "│   "
+			if i == len(subs)-1 {
+				branch, next = "└── ", "    "
+			}
+			fmt.Printf("%s%s%s  %s [%s]\n", indent, branch, truncateID(t.ID), t.Title, t.Status)
+			walk(t.ID, indent+next)
+		}
+	}
+	walk(root.ID, "")
 	return nil
 }
 
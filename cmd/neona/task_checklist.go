@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var taskChecklistCmd = &cobra.Command{
+	Use:   "checklist [task-id] [item...]",
+	Short: "Show a task's checklist, or add items to it",
+	Long: `Without items, prints the task's checklist. Each further argument is
+added as an unchecked item. Acceptance criteria given when the task was
+created start out as checklist items.
+
+When the daemon runs with --require-checklist, a task cannot be completed
+until every item is checked.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runTaskChecklist,
+}
+
+var taskCheckCmd = &cobra.Command{
+	Use:   "check [task-id] [item]",
+	Short: "Check a checklist item",
+	Long:  `Checks an item, given by its number in neona task checklist or a prefix of its ID.`,
+	Args:  cobra.ExactArgs(2),
+	RunE:  func(cmd *cobra.Command, args []string) error { return runTaskCheck(args, true) },
+}
+
+var taskUncheckCmd = &cobra.Command{
+	Use:   "uncheck [task-id] [item]",
+	Short: "Uncheck a checklist item",
+	Args:  cobra.ExactArgs(2),
+	RunE:  func(cmd *cobra.Command, args []string) error { return runTaskCheck(args, false) },
+}
+
+// checklistItem is a checklist item as returned by the API.
+type checklistItem struct {
+	ID        string `json:"id"`
+	Position  int    `json:"position"`
+	Text      string `json:"text"`
+	Done      bool   `json:"done"`
+	CheckedBy string `json:"checked_by"`
+}
+
+func init() {
+	taskCmd.AddCommand(taskChecklistCmd, taskCheckCmd, taskUncheckCmd)
+	for _, c := range []*cobra.Command{taskCheckCmd, taskUncheckCmd} {
+		c.Flags().StringVar(&author, "author", "", "Who checked the item (default: $USER, or the API key's principal)")
+	}
+}
+
+func runTaskChecklist(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 {
+		resp, err := apiPost("/tasks/"+args[0]+"/checklist", map[string][]string{"items": args[1:]})
+		if err != nil {
+			return err
+		}
+		var added []checklistItem
+		if err := json.Unmarshal(resp, &added); err != nil {
+			return err
+		}
+		fmt.Printf("Added %d item(s)\n", len(added))
+		return nil
+	}
+
+	items, err := fetchChecklist(args[0])
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		fmt.Println("No checklist")
+		return nil
+	}
+	printChecklist(items)
+	return nil
+}
+
+func runTaskCheck(args []string, done bool) error {
+	items, err := fetchChecklist(args[0])
+	if err != nil {
+		return err
+	}
+	item, err := findChecklistItem(items, args[1])
+	if err != nil {
+		return err
+	}
+
+	action := "uncheck"
+	if done {
+		action = "check"
+	}
+	resp, err := apiPost("/tasks/"+args[0]+"/checklist/"+item.ID+"/"+action, map[string]string{"by": commentAuthor()})
+	if err != nil {
+		return err
+	}
+	var updated checklistItem
+	if err := json.Unmarshal(resp, &updated); err != nil {
+		return err
+	}
+	printChecklist([]checklistItem{updated})
+	return nil
+}
+
+func fetchChecklist(taskID string) ([]checklistItem, error) {
+	resp, err := apiGet("/tasks/" + taskID + "/checklist")
+	if err != nil {
+		return nil, err
+	}
+	var items []checklistItem
+	if err := json.Unmarshal(resp, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// findChecklistItem resolves ref, an item number or ID prefix.
+func findChecklistItem(items []checklistItem, ref string) (*checklistItem, error) {
+	if n, err := strconv.Atoi(ref); err == nil {
+		for i := range items {
+			if items[i].Position == n {
+				return &items[i], nil
+			}
+		}
+		return nil, fmt.Errorf("no checklist item %d", n)
+	}
+	var found *checklistItem
+	for i := range items {
+		if strings.HasPrefix(items[i].ID, ref) {
+			if found != nil {
+				return nil, fmt.Errorf("checklist item ID prefix %q is ambiguous", ref)
+			}
+			found = &items[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no checklist item %q", ref)
+	}
+	return found, nil
+}
+
+func printChecklist(items []checklistItem) {
+	for _, item := range items {
+		mark := " "
+		by := ""
+		if item.Done {
+			mark = "x"
+			if item.CheckedBy != "" {
+				by = " (" + item.CheckedBy + ")"
+			}
+		}
+		fmt.Printf("  %2d. [%s] %s%s\n", item.Position, mark, item.Text, by)
+	}
+}
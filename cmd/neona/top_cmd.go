@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fentz26/neona/pkg/client"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var topCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Monitor workers, leases and the queue, refreshing in place",
+	Long: `Shows the daemon's active workers with their lease TTLs, the depth of the
+task queue and recent completions, refreshed every --interval until
+interrupted, like top. Tasks claimed through the API by external workers are
+listed along with the scheduler's own.
+
+When the output is not a terminal, each refresh is printed after the last;
+--once prints a single one and exits.`,
+	Args: cobra.NoArgs,
+	RunE: runTop,
+}
+
+var (
+	topInterval time.Duration
+	topRecent   int
+	topOnce     bool
+)
+
+func init() {
+	topCmd.Flags().DurationVarP(&topInterval, "interval", "n", 2*time.Second, "Time between refreshes")
+	topCmd.Flags().IntVar(&topRecent, "recent", 10, "Number of recent completions to show")
+	topCmd.Flags().BoolVar(&topOnce, "once", false, "Print one refresh and exit")
+}
+
+// topSnapshot is what one refresh of neona top fetched.
+type topSnapshot struct {
+	stats   *client.Stats
+	workers *client.WorkersStats
+	tasks   []client.Task
+}
+
+func fetchTop() (*topSnapshot, error) {
+	c := apiClient()
+	stats, err := c.Stats()
+	if err != nil {
+		return nil, err
+	}
+	workers, err := c.Workers()
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := c.Tasks("")
+	if err != nil {
+		return nil, err
+	}
+	return &topSnapshot{stats: stats, workers: workers, tasks: tasks}, nil
+}
+
+func runTop(cmd *cobra.Command, args []string) error {
+	if topInterval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+	if topOnce {
+		snap, err := fetchTop()
+		if err != nil {
+			return err
+		}
+		renderTop(os.Stdout, snap, time.Now())
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fd := int(os.Stdout.Fd())
+	live := term.IsTerminal(fd)
+	if live {
+		// Draw on the alternate screen with the cursor hidden, as top does,
+		// leaving the shell's scrollback as it was on exit
+		fmt.Print("\033[?1049h\033[?25l")
+		defer fmt.Print("\033[?25h\033[?1049l")
+	}
+
+	ticker := time.NewTicker(topInterval)
+	defer ticker.Stop()
+	for {
+		var buf bytes.Buffer
+		now := time.Now()
+		if snap, err := fetchTop(); err != nil {
+			topHeader(&buf, now)
+			fmt.Fprintf(&buf, "\nDaemon unreachable: %v\nRetrying every %s\n", err, topInterval)
+		} else {
+			renderTop(&buf, snap, now)
+		}
+		if live {
+			drawTop(buf.String(), fd)
+		} else {
+			buf.WriteString("\n")
+			os.Stdout.Write(buf.Bytes())
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// drawTop replaces the screen with out, cut to the terminal's size so that
+// nothing scrolls.
+func drawTop(out string, fd int) {
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	if width, height, err := term.GetSize(fd); err == nil {
+		if len(lines) > height {
+			lines = lines[:height]
+		}
+		for i, line := range lines {
+			if r := []rune(line); len(r) > width {
+				lines[i] = string(r[:width])
+			}
+		}
+	}
+	// Overwrite in place, clearing what is left of each line and below the
+	// last, rather than clearing the screen first, which flickers
+	fmt.Print("\033[H" + strings.Join(lines, "\033[K\n") + "\033[K\033[J")
+}
+
+func topHeader(w io.Writer, now time.Time) {
+	fmt.Fprintf(w, "neona top - %s - %s\n", apiAddr, now.Format("15:04:05"))
+}
+
+// renderTop writes one refresh: a summary of the scheduler and the queue,
+// the tasks being worked on and the latest to finish.
+func renderTop(w io.Writer, snap *topSnapshot, now time.Time) {
+	stats, workers := snap.stats, snap.workers
+	topHeader(w, now)
+	fmt.Fprintf(w, "Scheduler: %s   Workers: %d/%d\n", stats.Scheduler, workers.ActiveWorkers, workers.GlobalMax)
+	fmt.Fprintf(w, "Queue: %d pending (%d scheduled, %d throttled), %d overdue\n",
+		stats.Tasks[string(client.TaskStatusPending)], stats.Scheduled, workers.ThrottledTasks, stats.Overdue)
+	fmt.Fprintf(w, "Tasks: %d total, %d claimed, %d running, %d completed, %d failed\n", stats.Total,
+		stats.Tasks[string(client.TaskStatusClaimed)], stats.Tasks[string(client.TaskStatusRunning)],
+		stats.Tasks[string(client.TaskStatusCompleted)], stats.Tasks[string(client.TaskStatusFailed)])
+	fmt.Fprintf(w, "Claims: %s by the scheduler, %s through the API\n", topClaims(workers.Claims), topClaims(workers.APIClaims))
+	for _, warning := range stats.DBWarnings {
+		fmt.Fprintf(w, "Warning: %s\n", warning.Message)
+	}
+
+	var active []string
+	scheduled := make(map[string]bool, len(workers.Workers))
+	sorted := append([]client.Worker(nil), workers.Workers...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].StartedAt.Before(sorted[j].StartedAt) })
+	for _, wk := range sorted {
+		scheduled[wk.TaskID] = true
+		ttl := "expired"
+		if left := wk.LeaseExpires.Sub(now); left > 0 {
+			ttl = left.Round(time.Second).String()
+		}
+		active = append(active, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s", wk.WorkerID, truncateID(wk.TaskID), truncate(wk.TaskTitle, 40),
+			wk.ConnectorName, now.Sub(wk.StartedAt).Round(time.Second), ttl))
+	}
+	// External workers' leases are not listed by the API; show how long
+	// they have held the task instead
+	var recent []client.Task
+	for _, t := range snap.tasks {
+		switch t.Status {
+		case client.TaskStatusClaimed, client.TaskStatusRunning:
+			if scheduled[t.ID] {
+				continue
+			}
+			elapsed := "-"
+			if t.ClaimedAt != nil {
+				elapsed = now.Sub(*t.ClaimedAt).Round(time.Second).String()
+			}
+			active = append(active, fmt.Sprintf("%s\t%s\t%s\tapi\t%s\t-", t.ClaimedBy, truncateID(t.ID), truncate(t.Title, 40), elapsed))
+		case client.TaskStatusCompleted, client.TaskStatusFailed:
+			recent = append(recent, t)
+		}
+	}
+	fmt.Fprintln(w, "\nACTIVE")
+	if len(active) == 0 {
+		fmt.Fprintln(w, "No tasks are being worked on")
+	} else {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "HOLDER\tTASK\tTITLE\tCONNECTOR\tELAPSED\tLEASE TTL")
+		fmt.Fprintln(tw, strings.Join(active, "\n"))
+		tw.Flush()
+	}
+
+	if topRecent <= 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nRECENT")
+	if len(recent) == 0 {
+		fmt.Fprintln(w, "No tasks have finished")
+		return
+	}
+	sort.Slice(recent, func(i, j int) bool { return recent[i].UpdatedAt.After(recent[j].UpdatedAt) })
+	if len(recent) > topRecent {
+		recent = recent[:topRecent]
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FINISHED\tTASK\tTITLE\tSTATUS")
+	for _, t := range recent {
+		fmt.Fprintf(tw, "%s ago\t%s\t%s\t%s\n", now.Sub(t.UpdatedAt).Round(time.Second), truncateID(t.ID), truncate(t.Title, 40), t.Status)
+	}
+	tw.Flush()
+}
+
+// topClaims summarizes claim attempts, e.g. "12 claims (0 conflicts, 3.2ms avg)".
+func topClaims(c client.ClaimStats) string {
+	if c.Attempts == 0 {
+		return "no claims"
+	}
+	return fmt.Sprintf("%d claims (%d conflicts, %.1fms avg)", c.Attempts, c.Conflicts, c.AvgLatencyMs)
+}
@@ -2,13 +2,15 @@ package main
 
 import (
 	"fmt"
-	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/fentz26/neona/internal/apiclient"
+	"github.com/fentz26/neona/internal/transport"
 	"github.com/spf13/cobra"
 )
 
@@ -18,9 +20,22 @@ var tuiCmd = &cobra.Command{
 	RunE:  runTUI,
 }
 
+// tuiReadOnlyEnv tells the TUI to refuse commands that change tasks; it
+// matches tui.ReadOnlyEnv.
+const tuiReadOnlyEnv = "NEONA_TUI_READ_ONLY"
+
+var tuiReadOnly bool
+
+func init() {
+	tuiCmd.Flags().BoolVar(&tuiReadOnly, "read-only", false, "Observer mode for shared screens: disable add, claim, run, release and other commands that change tasks")
+}
+
 func runTUI(cmd *cobra.Command, args []string) error {
-	// 1. Check if Daemon is running
+	// 1. Check if Daemon is running. An observer does not start one.
 	if !isDaemonRunning(apiAddr) {
+		if tuiReadOnly {
+			return fmt.Errorf("daemon not reachable at %s", apiAddr)
+		}
 		fmt.Println("⚡ Neona Daemon not running. Starting background service...")
 		if err := startDaemon(); err != nil {
 			return fmt.Errorf("failed to start daemon: %w", err)
@@ -99,17 +114,22 @@ func runPythonTUI(path string) error {
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	cmd.Env = os.Environ()
+	// Point the TUI at the daemon this command resolved
+	cmd.Env = append(os.Environ(), apiclient.AddrEnv+"="+apiAddr)
+	if apiKey != "" {
+		cmd.Env = append(cmd.Env, transport.APIKeyEnv+"="+apiKey)
+	}
+	if tuiReadOnly {
+		cmd.Env = append(cmd.Env, tuiReadOnlyEnv+"=1")
+	}
 	return cmd.Run()
 }
 
 func isDaemonRunning(addr string) bool {
-	// Simple health check (timeout 1s)
-	client := http.Client{Timeout: 500 * time.Millisecond}
-	// We'll just check the root or a health endpoint.
-	// Since we don't have a dedicated health endpoint documented, checking root is usually safe if it returns something or even 404 vs connection refused.
-	// Actually, let's assume if we can connect, it's up.
-	resp, err := client.Get(addr)
+	// Simple health check (timeout 500ms, no retries, as callers poll);
+	// any response means it's up.
+	client, base := apiclient.NewClient(apiclient.Config{Addr: addr, Timeout: 500 * time.Millisecond})
+	resp, err := client.Get(base + "/health")
 	if err != nil {
 		return false
 	}
@@ -124,13 +144,19 @@ func startDaemon() error {
 	}
 
 	// Start "neona daemon" in background
-	cmd := exec.Command(exe, "daemon")
+	args := []string{"daemon"}
+	if _, ok := transport.SocketPath(apiAddr); ok {
+		args = append(args, "--listen", apiAddr)
+	} else if u, err := url.Parse(apiAddr); err == nil && u.Host != "" {
+		args = append(args, "--listen", u.Host)
+	}
+	cmd := exec.Command(exe, args...)
 	// Detach process so it survives TUI exit
 	configureDaemonProc(cmd)
 
 	// Redirect output to avoiding writing to TUI screen, or log to file?
 	// For now, let's silence it or it might mess up the TUI.
-	// Ideally log to ~/.neona/daemon.log, but nil is fine for now (goes to /dev/null usually if not set or inherits).
+	// Ideally log to the daemon log file, but nil is fine for now (goes to /dev/null usually if not set or inherits).
 	// Better to explicitly nil stdin/out/err to avoid holding terminal open.
 	cmd.Stdin = nil
 	cmd.Stdout = nil
@@ -140,16 +166,22 @@ func startDaemon() error {
 		return err
 	}
 
-	// Wait for it to become ready
-	fmt.Print("   Waiting for daemon...")
-	for i := 0; i < 20; i++ { // Wait up to 5 seconds
+	// Wait up to 5 seconds for it to become ready, probing quickly at first
+	// and backing off so a slow start is not hammered.
+	// Progress goes to stderr so it does not mix with command output
+	fmt.Fprint(os.Stderr, "   Waiting for daemon...")
+	deadline := time.Now().Add(5 * time.Second)
+	for delay := 50 * time.Millisecond; time.Now().Before(deadline); {
 		if isDaemonRunning(apiAddr) {
-			fmt.Println(" Done.")
+			fmt.Fprintln(os.Stderr, " Done.")
 			return nil
 		}
-		time.Sleep(250 * time.Millisecond)
-		fmt.Print(".")
+		time.Sleep(delay)
+		if delay *= 2; delay > time.Second {
+			delay = time.Second
+		}
+		fmt.Fprint(os.Stderr, ".")
 	}
-	fmt.Println(" Timeout!")
+	fmt.Fprintln(os.Stderr, " Timeout!")
 	return fmt.Errorf("daemon started but API not reachable at %s", apiAddr)
 }
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/fentz26/neona/internal/paths"
 	"github.com/spf13/cobra"
 )
 
@@ -18,12 +19,12 @@ var (
 var uninstallCmd = &cobra.Command{
 	Use:   "uninstall",
 	Short: "Uninstall Neona CLI and optionally remove data",
-	Long:  `Uninstall the Neona CLI binary and optionally remove the configuration/data directory (~/.neona).`,
+	Long:  `Uninstall the Neona CLI binary and optionally remove the data and configuration directories.`,
 	RunE:  runUninstall,
 }
 
 func init() {
-	uninstallCmd.Flags().BoolVar(&fullUninstall, "full", false, "Remove both binary and all data (~/.neona) without prompting")
+	uninstallCmd.Flags().BoolVar(&fullUninstall, "full", false, "Remove both binary and all data and configuration without prompting")
 	uninstallCmd.Flags().BoolVar(&keepData, "keep-data", false, "Remove binary but keep data (skip prompt)")
 
 	rootCmd.AddCommand(uninstallCmd)
@@ -43,11 +44,14 @@ func runUninstall(cmd *cobra.Command, args []string) error {
 		binPath = evalPath
 	}
 
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
+	// Data, config and any unmigrated legacy directory
+	var dataDirs []string
+	for _, dir := range []string{paths.DataDir(), paths.ConfigDir(), paths.LegacyDir()} {
+		if _, err := os.Stat(dir); err == nil {
+			dataDirs = append(dataDirs, dir)
+		}
 	}
-	dataDir := filepath.Join(homeDir, ".neona")
+	dataDir := strings.Join(dataDirs, ", ")
 
 	var removeData bool
 
@@ -86,11 +90,13 @@ func runUninstall(cmd *cobra.Command, args []string) error {
 
 	// 1. Remove Data (if requested)
 	if removeData {
-		fmt.Printf("   Removing data directory (%s)... ", dataDir)
-		if err := os.RemoveAll(dataDir); err != nil {
-			fmt.Printf("Failed: %v\n", err)
-		} else {
-			fmt.Println("Done")
+		for _, dir := range dataDirs {
+			fmt.Printf("   Removing data directory (%s)... ", dir)
+			if err := os.RemoveAll(dir); err != nil {
+				fmt.Printf("Failed: %v\n", err)
+			} else {
+				fmt.Println("Done")
+			}
 		}
 	} else {
 		fmt.Println("   Keeping data directory.")
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fentz26/neona/internal/bundle"
+	"github.com/fentz26/neona/internal/paths"
+	"github.com/fentz26/neona/internal/store"
+	"github.com/fentz26/neona/internal/update"
+	"github.com/spf13/cobra"
+)
+
+var workspaceCmd = &cobra.Command{
+	Use:   "workspace",
+	Short: "Move the whole workspace between machines as one bundle",
+}
+
+var workspaceExportCmd = &cobra.Command{
+	Use:   "export <bundle>",
+	Short: "Write tasks, memory, the audit trail and config to a bundle",
+	Long: `Writes every task, memory item and PDR in the database, along with
+mcp.yaml, claims.yaml and the scripts directory from the config directory,
+to a bundle.
+Name it .tar.gz, or .tar.zst to compress it with the zstd command.
+
+Run history, comments, checklists and leases are not included, nor are
+credentials, cloud sync keys and plugins. The database is read directly, so
+the daemon can keep running.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runWorkspaceExport,
+}
+
+var workspaceImportCmd = &cobra.Command{
+	Use:   "import <bundle>",
+	Short: "Merge a bundle into this workspace, or replace it",
+	Long: `Merges a bundle made by neona workspace export into the database and
+config directory. Tasks, memory items and PDRs already present are skipped,
+as are memory items duplicating one in their scope, and existing config files
+are kept. Claimed and running tasks come back as pending.
+
+With --replace, the database's tasks (with their runs, comments and
+checklists), memory and audit trail are deleted first, and config files in
+the bundle overwrite existing ones. Stop the daemon before importing.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runWorkspaceImport,
+}
+
+var (
+	workspaceDB        string
+	workspaceEncrypted bool
+	workspaceNoConfig  bool
+	workspaceReplace   bool
+)
+
+func init() {
+	workspaceCmd.AddCommand(workspaceExportCmd, workspaceImportCmd)
+	rootCmd.AddCommand(workspaceCmd)
+
+	for _, cmd := range []*cobra.Command{workspaceExportCmd, workspaceImportCmd} {
+		cmd.Flags().StringVar(&workspaceDB, "db", paths.DBPath(), "Path to SQLite database")
+		cmd.Flags().BoolVar(&workspaceEncrypted, "encrypted", false, "The daemon runs with --encrypt; read the key as it does")
+		cmd.Flags().BoolVar(&workspaceNoConfig, "no-config", false, "Leave out the config files")
+	}
+	workspaceImportCmd.Flags().BoolVar(&workspaceReplace, "replace", false, "Delete the workspace's tasks, memory and audit trail first, and overwrite config files")
+}
+
+// openWorkspaceStore opens the database for a workspace command, with the
+// daemon's encryption key when --encrypted is set.
+func openWorkspaceStore() (*store.Store, error) {
+	s, err := store.New(workspaceDB)
+	if err != nil {
+		return nil, err
+	}
+	if workspaceEncrypted {
+		key, err := loadEncryptionKey()
+		if err == nil {
+			var cipher *store.Cipher
+			if cipher, err = store.NewCipher(key); err == nil {
+				s.SetCipher(cipher)
+			}
+		}
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("database encryption: %w", err)
+		}
+	}
+	return s, nil
+}
+
+func runWorkspaceExport(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(workspaceDB); err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+	s, err := openWorkspaceStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	snap, err := s.Snapshot()
+	if err == store.ErrEncryptedContent {
+		return fmt.Errorf("%w (pass --encrypted)", err)
+	}
+	if err != nil {
+		return err
+	}
+	var files []bundle.File
+	if !workspaceNoConfig {
+		if files, err = bundle.ReadConfig(paths.ConfigDir()); err != nil {
+			return fmt.Errorf("read config: %w", err)
+		}
+	}
+	b := bundle.New(snap, files, update.GetCurrentVersion())
+	if err := bundle.Create(args[0], b); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d tasks, %d memory items, %d PDRs and %d config files to %s\n",
+		b.Manifest.Tasks, b.Manifest.Memory, b.Manifest.PDR, len(files), args[0])
+	return nil
+}
+
+func runWorkspaceImport(cmd *cobra.Command, args []string) error {
+	b, err := bundle.Open(args[0])
+	if err != nil {
+		return err
+	}
+	if _, err := CheckHealth(); err == nil {
+		return fmt.Errorf("the daemon at %s is running; stop it before importing", apiAddr)
+	}
+	s, err := openWorkspaceStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	res, err := s.Restore(&b.Snapshot, workspaceReplace)
+	if err != nil {
+		return err
+	}
+	verb := "Merged"
+	if workspaceReplace {
+		verb = "Replaced the workspace with"
+	}
+	fmt.Printf("%s %d tasks, %d memory items and %d PDRs from %s", verb, res.Tasks, res.Memory, res.PDR, args[0])
+	if res.Skipped > 0 {
+		fmt.Printf(" (%d already present)", res.Skipped)
+	}
+	fmt.Println()
+
+	if workspaceNoConfig || len(b.Files) == 0 {
+		return nil
+	}
+	written, kept, err := bundle.WriteConfig(paths.ConfigDir(), b.Files, workspaceReplace)
+	if len(written) > 0 {
+		fmt.Printf("Wrote config: %s\n", strings.Join(written, ", "))
+	}
+	if len(kept) > 0 {
+		fmt.Printf("Kept existing config: %s (pass --replace to overwrite)\n", strings.Join(kept, ", "))
+	}
+	return err
+}
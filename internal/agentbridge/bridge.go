@@ -0,0 +1,302 @@
+// Package agentbridge serves Neona's task queue and memory to editor agents
+// over the Model Context Protocol (MCP), so that Cursor, Claude and other
+// MCP clients can claim tasks, read their context and write memory without
+// speaking Neona's REST API.
+//
+// A bridge is a process the editor starts (neona agent run) and talks to
+// on stdio: newline-delimited JSON-RPC 2.0 messages, one per line, as MCP's
+// stdio transport specifies. The bridge forwards tool calls to the daemon
+// through pkg/client:
+//
+//	{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}
+//	{"jsonrpc":"2.0","id":1,"result":{"protocolVersion":"2025-06-18","capabilities":{"tools":{}},"serverInfo":{"name":"neona","version":"..."}}}
+//
+//	{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"claim_task","arguments":{"label":"frontend"}}}
+//	{"jsonrpc":"2.0","id":2,"result":{"content":[{"type":"text","text":"{...}"}]}}
+//
+// Tasks the agent claims are held by the bridge: it keeps their leases
+// alive with heartbeats until the agent completes or releases them, and
+// releases those still held when the editor closes stdin.
+package agentbridge
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fentz26/neona/pkg/client"
+)
+
+// ProtocolVersions are the MCP revisions the bridge speaks, newest first.
+// Only tools are served, which all of them handle alike.
+var ProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// maxMessage bounds a single request line.
+const maxMessage = 16 << 20
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Config configures a bridge.
+type Config struct {
+	// HolderID is who the bridge claims tasks as, e.g. cursor@laptop.
+	HolderID string
+	// Version is reported to the editor as the server version.
+	Version string
+}
+
+// Bridge serves one editor session.
+type Bridge struct {
+	api    *client.Client
+	config Config
+
+	mu   sync.Mutex
+	held map[string]*heldLease // by task ID
+	wg   sync.WaitGroup
+}
+
+// heldLease is a claim the bridge keeps alive for the agent.
+type heldLease struct {
+	lease *client.Lease
+	stop  context.CancelFunc
+}
+
+// New creates a bridge to the daemon api talks to.
+func New(api *client.Client, cfg Config) *Bridge {
+	return &Bridge{api: api, config: cfg, held: make(map[string]*heldLease)}
+}
+
+// Serve answers requests read from r on w until r ends or ctx is done, then
+// releases the tasks still held. Notifications get no answer, and requests
+// are answered in order.
+func (b *Bridge) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	defer b.releaseAll()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxMessage)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			return err
+		case line := <-lines:
+			if len(line) == 0 {
+				continue
+			}
+			if resp := b.handle(line); resp != nil {
+				if err := enc.Encode(resp); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// handle answers one message, returning nil for notifications.
+func (b *Bridge) handle(line []byte) *response {
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return errorResponse(json.RawMessage("null"), codeParseError, "parse error: "+err.Error())
+	}
+	if len(req.ID) == 0 {
+		// Notifications, such as notifications/initialized, need no answer
+		return nil
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, codeInvalidRequest, "invalid request")
+	}
+
+	var result interface{}
+	var err *rpcError
+	switch req.Method {
+	case "initialize":
+		result, err = b.initialize(req.Params)
+	case "ping":
+		result = struct{}{}
+	case "tools/list":
+		result = map[string]interface{}{"tools": toolList()}
+	case "tools/call":
+		result, err = b.callTool(req.Params)
+	default:
+		err = &rpcError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+	if err != nil {
+		return errorResponse(req.ID, err.Code, err.Message)
+	}
+	return &response{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
+
+func errorResponse(id json.RawMessage, code int, msg string) *response {
+	return &response{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: msg}}
+}
+
+// initialize agrees on the protocol revision: the editor's if the bridge
+// speaks it, else the newest the bridge does.
+func (b *Bridge) initialize(params json.RawMessage) (interface{}, *rpcError) {
+	var p struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: err.Error()}
+		}
+	}
+	version := ProtocolVersions[0]
+	for _, v := range ProtocolVersions {
+		if v == p.ProtocolVersion {
+			version = v
+		}
+	}
+	return map[string]interface{}{
+		"protocolVersion": version,
+		"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+		"serverInfo":      map[string]string{"name": "neona", "version": b.config.Version},
+		"instructions": "Neona is the task queue and shared memory of this workspace. " +
+			"Claim a task with claim_task before working on it, read its context with get_task and search_memory, " +
+			"record what you learn with add_memory, and finish with complete_task or release_task.",
+	}, nil
+}
+
+// hold keeps a claimed lease alive until it is dropped, heartbeating every
+// interval.
+func (b *Bridge) hold(lease *client.Lease, interval time.Duration) {
+	ctx, stop := context.WithCancel(context.Background())
+	b.mu.Lock()
+	if old := b.held[lease.TaskID]; old != nil {
+		old.stop()
+	}
+	b.held[lease.TaskID] = &heldLease{lease: lease, stop: stop}
+	b.mu.Unlock()
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := b.api.Heartbeat(lease, 0); err != nil {
+					log.Printf("Heartbeat for task %s failed: %v", lease.TaskID, err)
+					if client.IsNotFound(err) || client.IsConflict(err) || client.IsForbidden(err) {
+						// The lease is gone; stop holding it, unless the
+						// task was claimed again meanwhile
+						b.mu.Lock()
+						if h := b.held[lease.TaskID]; h != nil && h.lease == lease {
+							delete(b.held, lease.TaskID)
+						}
+						b.mu.Unlock()
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// lease returns the held lease of a task, given its ID or a prefix of it
+// matching one held task, or nil.
+func (b *Bridge) lease(taskID string) *client.Lease {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if h := b.held[taskID]; h != nil {
+		return h.lease
+	}
+	var found *client.Lease
+	for id, h := range b.held {
+		if strings.HasPrefix(id, taskID) {
+			if found != nil {
+				return nil
+			}
+			found = h.lease
+		}
+	}
+	return found
+}
+
+// drop stops holding a task's lease.
+func (b *Bridge) drop(taskID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if h := b.held[taskID]; h != nil {
+		h.stop()
+		delete(b.held, taskID)
+	}
+}
+
+// releaseAll returns the tasks still held to the queue.
+func (b *Bridge) releaseAll() {
+	b.mu.Lock()
+	held := b.held
+	b.held = make(map[string]*heldLease)
+	b.mu.Unlock()
+	for taskID, h := range held {
+		h.stop()
+		if err := b.api.Release(h.lease); err != nil {
+			log.Printf("Releasing task %s failed: %v", taskID, err)
+		} else {
+			log.Printf("Released task %s", taskID)
+		}
+	}
+	b.wg.Wait()
+}
+
+// Held returns the IDs of the tasks the bridge holds.
+func (b *Bridge) Held() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ids := make([]string, 0, len(b.held))
+	for id := range b.held {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,200 @@
+package agentbridge
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/testutil"
+	"github.com/fentz26/neona/pkg/client"
+)
+
+// session drives a bridge over pipes, as an editor would.
+type session struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *bufio.Reader
+	nextID int
+	done   chan error
+}
+
+func startSession(t *testing.T, b *Bridge) *session {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	s := &session{t: t, in: inW, out: bufio.NewReader(outR), done: make(chan error, 1)}
+	go func() {
+		err := b.Serve(context.Background(), inR, outW)
+		outW.Close()
+		s.done <- err
+	}()
+	return s
+}
+
+func (s *session) send(line string) {
+	s.t.Helper()
+	if _, err := io.WriteString(s.in, line+"\n"); err != nil {
+		s.t.Fatalf("write request: %v", err)
+	}
+}
+
+func (s *session) call(method string, params interface{}) response {
+	s.t.Helper()
+	s.nextID++
+	data, _ := json.Marshal(params)
+	s.send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":%q,"params":%s}`, s.nextID, method, data))
+	line, err := s.out.ReadBytes('\n')
+	if err != nil {
+		s.t.Fatalf("read response: %v", err)
+	}
+	var resp response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		s.t.Fatalf("decode response %s: %v", line, err)
+	}
+	if string(resp.ID) != fmt.Sprint(s.nextID) {
+		s.t.Fatalf("response id = %s, want %d", resp.ID, s.nextID)
+	}
+	return resp
+}
+
+// tool calls a tool, returning its text and whether it failed.
+func (s *session) tool(name string, args map[string]string) (string, bool) {
+	s.t.Helper()
+	resp := s.call("tools/call", map[string]interface{}{"name": name, "arguments": args})
+	if resp.Error != nil {
+		s.t.Fatalf("%s: %+v", name, resp.Error)
+	}
+	var res struct {
+		Content []struct{ Text string }
+		IsError bool
+	}
+	data, _ := json.Marshal(resp.Result)
+	json.Unmarshal(data, &res)
+	if len(res.Content) != 1 {
+		s.t.Fatalf("%s content = %s", name, data)
+	}
+	return res.Content[0].Text, res.IsError
+}
+
+func (s *session) close() {
+	s.t.Helper()
+	s.in.Close()
+	select {
+	case err := <-s.done:
+		if err != nil {
+			s.t.Fatalf("Serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		s.t.Fatal("Serve did not return after stdin closed")
+	}
+}
+
+func TestBridge(t *testing.T) {
+	d := testutil.StartDaemon(t, testutil.Options{})
+	api := client.New(client.Config{Addr: d.URL, Timeout: 5 * time.Second})
+	low, err := api.CreateTask(client.CreateTaskRequest{Title: "Write docs", Labels: []string{"docs"}})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	high, err := api.CreateTask(client.CreateTaskRequest{Title: "Fix login", Labels: []string{"frontend"}, Priority: 5})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+
+	b := New(api, Config{HolderID: "cursor@test", Version: "test"})
+	s := startSession(t, b)
+
+	resp := s.call("initialize", map[string]string{"protocolVersion": "2025-03-26"})
+	if resp.Error != nil {
+		t.Fatalf("initialize: %+v", resp.Error)
+	}
+	if v := resp.Result.(map[string]interface{})["protocolVersion"]; v != "2025-03-26" {
+		t.Errorf("protocolVersion = %v, want the editor's", v)
+	}
+	// Notifications are not answered; the next response is the ping's
+	s.send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	if resp := s.call("ping", nil); resp.Error != nil {
+		t.Fatalf("ping: %+v", resp.Error)
+	}
+	if resp := s.call("resources/list", nil); resp.Error == nil || resp.Error.Code != codeMethodNotFound {
+		t.Errorf("resources/list error = %+v, want method not found", resp.Error)
+	}
+
+	resp = s.call("tools/list", nil)
+	data, _ := json.Marshal(resp.Result)
+	for _, name := range []string{"list_tasks", "get_task", "claim_task", "complete_task", "release_task", "add_comment", "search_memory", "add_memory"} {
+		if !strings.Contains(string(data), `"name":"`+name+`"`) {
+			t.Errorf("tools/list lacks %s", name)
+		}
+	}
+
+	if text, isErr := s.tool("list_tasks", nil); isErr || strings.Index(text, high.ID) > strings.Index(text, low.ID) {
+		t.Errorf("list_tasks = %s, want %s listed first", text, high.ID)
+	}
+	if text, isErr := s.tool("complete_task", map[string]string{"task_id": high.ID}); !isErr || !strings.Contains(text, "not claimed") {
+		t.Errorf("complete_task before claiming = %q, %v; want an error", text, isErr)
+	}
+	if _, isErr := s.tool("get_task", nil); !isErr {
+		t.Error("get_task without task_id succeeded")
+	}
+
+	// Claiming the next frontend task holds it for the agent
+	if text, isErr := s.tool("claim_task", map[string]string{"label": "frontend"}); isErr || !strings.Contains(text, high.ID) {
+		t.Fatalf("claim_task = %q, %v", text, isErr)
+	}
+	if held := b.Held(); len(held) != 1 || held[0] != high.ID {
+		t.Fatalf("Held = %v, want [%s]", held, high.ID)
+	}
+	if task, _ := api.Task(high.ID); task.ClaimedBy != "cursor@test" {
+		t.Errorf("ClaimedBy = %q", task.ClaimedBy)
+	}
+	if text, isErr := s.tool("get_task", map[string]string{"task_id": high.ID[:8]}); isErr || !strings.Contains(text, "Fix login") {
+		t.Errorf("get_task = %q, %v", text, isErr)
+	}
+	if _, isErr := s.tool("add_comment", map[string]string{"task_id": high.ID, "body": "Looking into it"}); isErr {
+		t.Error("add_comment failed")
+	}
+	if text, isErr := s.tool("add_memory", map[string]string{"content": "Login tokens live in the session store", "task_id": high.ID}); isErr {
+		t.Errorf("add_memory = %q", text)
+	}
+	if text, isErr := s.tool("search_memory", map[string]string{"query": "session store"}); isErr || !strings.Contains(text, "Login tokens") {
+		t.Errorf("search_memory = %q, %v", text, isErr)
+	}
+	if text, isErr := s.tool("complete_task", map[string]string{"task_id": high.ID[:8]}); isErr {
+		t.Fatalf("complete_task = %q", text)
+	}
+	if task, _ := api.Task(high.ID); task.Status != client.TaskStatusCompleted {
+		t.Errorf("status after complete_task = %s", task.Status)
+	}
+
+	// A task still held when the editor goes away is released
+	if text, isErr := s.tool("claim_task", map[string]string{"task_id": low.ID}); isErr {
+		t.Fatalf("claim_task = %q", text)
+	}
+	s.close()
+	if held := b.Held(); len(held) != 0 {
+		t.Errorf("Held after close = %v", held)
+	}
+	if task, _ := api.Task(low.ID); task.Status != client.TaskStatusPending {
+		t.Errorf("status after close = %s, want pending", task.Status)
+	}
+}
+
+func TestHandleMalformed(t *testing.T) {
+	b := New(nil, Config{})
+	if resp := b.handle([]byte("{not json")); resp == nil || resp.Error.Code != codeParseError {
+		t.Errorf("malformed line = %+v, want a parse error", resp)
+	}
+	if resp := b.handle([]byte(`{"id":1,"method":"ping"}`)); resp == nil || resp.Error.Code != codeInvalidRequest {
+		t.Errorf("missing jsonrpc = %+v, want an invalid request", resp)
+	}
+	resp := b.handle([]byte(`{"jsonrpc":"2.0","id":"a","method":"tools/call","params":{"name":"nope"}}`))
+	if resp == nil || resp.Error == nil || resp.Error.Code != codeInvalidParams || string(resp.ID) != `"a"` {
+		t.Errorf("unknown tool = %+v, want invalid params", resp)
+	}
+}
@@ -0,0 +1,368 @@
+package agentbridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fentz26/neona/pkg/client"
+)
+
+// maxMemoryResults caps the memory items a tool returns.
+const maxMemoryResults = 20
+
+// tool is a tool offered to the editor's agent.
+type tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+
+	call func(b *Bridge, args json.RawMessage) (interface{}, error)
+}
+
+// object is the JSON schema of an object with the given string properties.
+func object(props map[string]string, required ...string) map[string]interface{} {
+	properties := make(map[string]interface{}, len(props))
+	for name, desc := range props {
+		properties[name] = map[string]string{"type": "string", "description": desc}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+var tools = []tool{
+	{
+		Name:        "list_tasks",
+		Description: "List Neona tasks by priority, highest first, optionally only those with a status.",
+		InputSchema: object(map[string]string{
+			"status": "pending, claimed, running, completed, failed, scheduled or stale; empty lists every task",
+		}),
+		call: (*Bridge).listTasks,
+	},
+	{
+		Name:        "get_task",
+		Description: "Read a task with its context: description, acceptance criteria, lease, recent runs, comments, checklist, and the memory recorded for it and its project.",
+		InputSchema: object(map[string]string{"task_id": "Task ID, or a unique prefix of one"}, "task_id"),
+		call:        (*Bridge).getTask,
+	},
+	{
+		Name:        "claim_task",
+		Description: "Claim a task to work on it: the given one, or else the next pending task, optionally with a label. The claim is kept alive until complete_task or release_task.",
+		InputSchema: object(map[string]string{
+			"task_id": "Task to claim; empty claims the next pending task",
+			"label":   "Only claim the next task carrying this label",
+		}),
+		call: (*Bridge).claimTask,
+	},
+	{
+		Name:        "complete_task",
+		Description: "Mark a task claimed in this session as completed.",
+		InputSchema: object(map[string]string{"task_id": "Task ID, or a unique prefix of one"}, "task_id"),
+		call:        (*Bridge).completeTask,
+	},
+	{
+		Name:        "release_task",
+		Description: "Give up a task claimed in this session, returning it to the queue for someone else.",
+		InputSchema: object(map[string]string{"task_id": "Task ID, or a unique prefix of one"}, "task_id"),
+		call:        (*Bridge).releaseTask,
+	},
+	{
+		Name:        "add_comment",
+		Description: "Add a comment to a task's discussion thread, e.g. progress or a question for its author.",
+		InputSchema: object(map[string]string{
+			"task_id": "Task ID, or a unique prefix of one",
+			"body":    "Comment text",
+		}, "task_id", "body"),
+		call: (*Bridge).addComment,
+	},
+	{
+		Name:        "search_memory",
+		Description: "Search the workspace's shared memory: notes, decisions and conventions recorded by people and agents.",
+		InputSchema: object(map[string]string{
+			"query": "Words to search for; empty returns the newest items",
+			"scope": "Only search this scope: global, project:<name> or task:<id>",
+		}),
+		call: (*Bridge).searchMemory,
+	},
+	{
+		Name:        "add_memory",
+		Description: "Record something worth remembering for later tasks, such as a decision, a convention or a gotcha.",
+		InputSchema: object(map[string]string{
+			"content": "What to remember",
+			"tags":    "Comma-separated tags",
+			"task_id": "Task the memory came from",
+			"scope":   "global, project:<name> or task:<id>; defaults to the task's scope, or global",
+		}, "content"),
+		call: (*Bridge).addMemory,
+	},
+}
+
+// toolList returns the tools offered to the editor.
+func toolList() []tool {
+	return tools
+}
+
+// callTool handles tools/call. A failing tool is reported in the result,
+// for the agent to read, rather than as a protocol error.
+func (b *Bridge) callTool(params json.RawMessage) (interface{}, *rpcError) {
+	var p struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	var t *tool
+	for i := range tools {
+		if tools[i].Name == p.Name {
+			t = &tools[i]
+		}
+	}
+	if t == nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "unknown tool: " + p.Name}
+	}
+	if len(p.Arguments) == 0 || string(p.Arguments) == "null" {
+		p.Arguments = json.RawMessage("{}")
+	}
+
+	out, err := t.call(b, p.Arguments)
+	text := ""
+	if err == nil {
+		if s, ok := out.(string); ok {
+			text = s
+		} else {
+			data, _ := json.MarshalIndent(out, "", "  ")
+			text = string(data)
+		}
+	} else {
+		text = err.Error()
+	}
+	return map[string]interface{}{
+		"content": []map[string]string{{"type": "text", "text": text}},
+		"isError": err != nil,
+	}, nil
+}
+
+// decode reads a tool's arguments into v, checking required ones are set.
+func decode(args json.RawMessage, v interface{}, required ...string) error {
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	var set map[string]interface{}
+	json.Unmarshal(args, &set)
+	for _, name := range required {
+		if s, _ := set[name].(string); s == "" {
+			return fmt.Errorf("%s is required", name)
+		}
+	}
+	return nil
+}
+
+// taskSummary is a task as listed by list_tasks.
+type taskSummary struct {
+	ID        string     `json:"id"`
+	Title     string     `json:"title"`
+	Status    string     `json:"status"`
+	Priority  int        `json:"priority,omitempty"`
+	Labels    []string   `json:"labels,omitempty"`
+	ClaimedBy string     `json:"claimed_by,omitempty"`
+	DueAt     *time.Time `json:"due_at,omitempty"`
+}
+
+func (b *Bridge) listTasks(args json.RawMessage) (interface{}, error) {
+	var a struct {
+		Status string `json:"status"`
+	}
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	tasks, err := b.api.Tasks(a.Status)
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return "No tasks found", nil
+	}
+	list := make([]taskSummary, len(tasks))
+	for i, t := range tasks {
+		status := string(t.Status)
+		if t.Scheduled {
+			status = client.ListScheduled
+		}
+		list[i] = taskSummary{ID: t.ID, Title: t.Title, Status: status, Priority: t.Priority,
+			Labels: t.Labels, ClaimedBy: t.ClaimedBy, DueAt: t.DueAt}
+	}
+	return list, nil
+}
+
+// taskContext is what get_task returns.
+type taskContext struct {
+	Task          *client.TaskView       `json:"task"`
+	Comments      []client.Comment       `json:"comments,omitempty"`
+	Checklist     []client.ChecklistItem `json:"checklist,omitempty"`
+	ProjectMemory []client.MemoryItem    `json:"project_memory,omitempty"`
+}
+
+func (b *Bridge) getTask(args json.RawMessage) (interface{}, error) {
+	var a struct {
+		TaskID string `json:"task_id"`
+	}
+	if err := decode(args, &a, "task_id"); err != nil {
+		return nil, err
+	}
+	view, err := b.api.TaskView(a.TaskID, []string{"lease", "runs", "memory"}, 3, 0)
+	if err != nil {
+		return nil, err
+	}
+	tc := &taskContext{Task: view}
+	if tc.Comments, err = b.api.Comments(view.ID, time.Time{}); err != nil {
+		return nil, err
+	}
+	if tc.Checklist, err = b.api.Checklist(view.ID); err != nil {
+		return nil, err
+	}
+	if project := client.TaskProject(view.Task); project != "" {
+		if tc.ProjectMemory, err = b.api.Memory("", "project:"+project); err != nil {
+			return nil, err
+		}
+		if len(tc.ProjectMemory) > maxMemoryResults {
+			tc.ProjectMemory = tc.ProjectMemory[:maxMemoryResults]
+		}
+	}
+	return tc, nil
+}
+
+// claimed is what claim_task returns.
+type claimed struct {
+	Task           *client.Task `json:"task"`
+	LeaseExpiresAt time.Time    `json:"lease_expires_at"`
+	Note           string       `json:"note"`
+}
+
+func (b *Bridge) claimTask(args json.RawMessage) (interface{}, error) {
+	var a struct {
+		TaskID string `json:"task_id"`
+		Label  string `json:"label"`
+	}
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	var task *client.Task
+	var lease *client.Lease
+	if a.TaskID != "" {
+		var err error
+		if lease, err = b.api.Claim(a.TaskID, b.config.HolderID, 0); err != nil {
+			return nil, err
+		}
+		if task, err = b.api.Task(lease.TaskID); err != nil {
+			return nil, err
+		}
+	} else {
+		res, err := b.api.ClaimNext(b.config.HolderID, a.Label, "", 0)
+		if err != nil {
+			return nil, err
+		}
+		if res == nil {
+			return "No pending task is eligible to claim", nil
+		}
+		task, lease = res.Task, res.Lease
+	}
+
+	// Heartbeat at a third of the TTL, as the daemon advises
+	interval := time.Duration(lease.TTLSec) * time.Second / 3
+	if interval < time.Second {
+		interval = time.Second
+	}
+	b.hold(lease, interval)
+	return &claimed{
+		Task:           task,
+		LeaseExpiresAt: lease.ExpiresAt,
+		Note:           "Claimed as " + b.config.HolderID + "; the claim is kept alive until complete_task or release_task.",
+	}, nil
+}
+
+// claimedLease returns the lease of a task claimed in this session.
+func (b *Bridge) claimedLease(args json.RawMessage) (*client.Lease, error) {
+	var a struct {
+		TaskID string `json:"task_id"`
+	}
+	if err := decode(args, &a, "task_id"); err != nil {
+		return nil, err
+	}
+	lease := b.lease(a.TaskID)
+	if lease == nil {
+		return nil, fmt.Errorf("task %s is not claimed in this session; claim it with claim_task first", a.TaskID)
+	}
+	return lease, nil
+}
+
+func (b *Bridge) completeTask(args json.RawMessage) (interface{}, error) {
+	lease, err := b.claimedLease(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.api.Complete(lease); err != nil {
+		return nil, err
+	}
+	b.drop(lease.TaskID)
+	return "Completed task " + lease.TaskID, nil
+}
+
+func (b *Bridge) releaseTask(args json.RawMessage) (interface{}, error) {
+	lease, err := b.claimedLease(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.api.Release(lease); err != nil {
+		return nil, err
+	}
+	b.drop(lease.TaskID)
+	return "Released task " + lease.TaskID, nil
+}
+
+func (b *Bridge) addComment(args json.RawMessage) (interface{}, error) {
+	var a struct {
+		TaskID string `json:"task_id"`
+		Body   string `json:"body"`
+	}
+	if err := decode(args, &a, "task_id", "body"); err != nil {
+		return nil, err
+	}
+	return b.api.Comment(a.TaskID, b.config.HolderID, a.Body)
+}
+
+func (b *Bridge) searchMemory(args json.RawMessage) (interface{}, error) {
+	var a struct {
+		Query string `json:"query"`
+		Scope string `json:"scope"`
+	}
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	var scopes []string
+	if a.Scope != "" {
+		scopes = append(scopes, a.Scope)
+	}
+	items, err := b.api.Memory(a.Query, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return "No memory items found", nil
+	}
+	if len(items) > maxMemoryResults {
+		items = items[:maxMemoryResults]
+	}
+	return items, nil
+}
+
+func (b *Bridge) addMemory(args json.RawMessage) (interface{}, error) {
+	var req client.MemoryRequest
+	if err := decode(args, &req, "content"); err != nil {
+		return nil, err
+	}
+	return b.api.AddMemory(req)
+}
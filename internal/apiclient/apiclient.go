@@ -0,0 +1,230 @@
+// Package apiclient builds the HTTP client the CLI and TUI use to reach the
+// daemon: pooled connections to the API address, a timeout on each attempt,
+// and retries with backoff for requests that are safe to repeat.
+package apiclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/fentz26/neona/internal/transport"
+)
+
+// Environment variables read by FromEnv. The API key comes from
+// transport.APIKeyEnv.
+const (
+	AddrEnv    = "NEONA_API"
+	TimeoutEnv = "NEONA_API_TIMEOUT"
+	RetriesEnv = "NEONA_API_RETRIES"
+)
+
+// Defaults for a Config not overridden by the environment or flags.
+const (
+	DefaultAddr    = "http://127.0.0.1:7466"
+	DefaultTimeout = 10 * time.Second
+	DefaultRetries = 2
+	DefaultBackoff = 200 * time.Millisecond
+)
+
+// maxBackoff caps the wait between attempts, including one asked for with
+// Retry-After.
+const maxBackoff = 5 * time.Second
+
+// maxIdleConns is how many idle connections to the daemon are kept for
+// reuse.
+const maxIdleConns = 16
+
+// Config configures a client.
+type Config struct {
+	// Addr is the API address, as accepted by transport.NewClient.
+	Addr   string
+	APIKey string
+	// Timeout bounds each attempt, including reading the response body;
+	// zero means no limit.
+	Timeout time.Duration
+	// Retries is how many times a failed idempotent request is repeated.
+	Retries int
+	// Backoff is the wait before the first retry; it doubles after each.
+	Backoff time.Duration
+}
+
+// FromEnv returns the default config overridden by NEONA_API,
+// NEONA_API_KEY, NEONA_API_TIMEOUT (a duration such as 30s) and
+// NEONA_API_RETRIES. On a malformed value it returns the config read so
+// far with an error naming the variable.
+func FromEnv() (Config, error) {
+	cfg := Config{
+		Addr:    DefaultAddr,
+		APIKey:  os.Getenv(transport.APIKeyEnv),
+		Timeout: DefaultTimeout,
+		Retries: DefaultRetries,
+		Backoff: DefaultBackoff,
+	}
+	if v := os.Getenv(AddrEnv); v != "" {
+		cfg.Addr = v
+	}
+	if v := os.Getenv(TimeoutEnv); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("%s=%q: want a duration such as 30s", TimeoutEnv, v)
+		}
+		cfg.Timeout = d
+	}
+	if v := os.Getenv(RetriesEnv); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("%s=%q: want a number of retries, 0 or more", RetriesEnv, v)
+		}
+		cfg.Retries = n
+	}
+	return cfg, nil
+}
+
+// NewClient returns an HTTP client configured by cfg and the base URL to
+// prefix request paths with.
+func NewClient(cfg Config) (*http.Client, string) {
+	addr := cfg.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+	client, base := transport.NewClient(addr, 0)
+
+	rt, ok := client.Transport.(*http.Transport)
+	if !ok {
+		rt = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	rt.MaxIdleConnsPerHost = maxIdleConns
+	client.Transport = &retryTransport{
+		base:    rt,
+		timeout: cfg.Timeout,
+		retries: cfg.Retries,
+		backoff: cfg.Backoff,
+	}
+	return transport.WithAPIKey(client, cfg.APIKey), base
+}
+
+// retryTransport repeats idempotent requests that failed in transit or were
+// answered with a status meaning "try again".
+type retryTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retries := t.retries
+	if !idempotent(req) {
+		retries = 0
+	}
+	delay := t.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := t.attempt(req)
+		if attempt >= retries || !temporary(req, resp, err) {
+			return resp, err
+		}
+
+		wait := delay
+		if resp != nil {
+			if d := retryAfter(resp); d > 0 {
+				wait = d
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if wait > maxBackoff {
+			wait = maxBackoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		if delay *= 2; delay > maxBackoff {
+			delay = maxBackoff
+		}
+
+		if req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// attempt sends req once under the per-attempt timeout. The timeout stays
+// in force until the response body is closed.
+func (t *retryTransport) attempt(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// idempotent reports whether req can be sent again without changing its
+// effect: a method that is idempotent by definition, or one carrying an
+// Idempotency-Key the daemon deduplicates on. A body that cannot be rewound
+// rules out a retry.
+func idempotent(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// temporary reports whether a failed attempt is worth repeating: a transport
+// error other than the caller giving up, or a gateway or availability error,
+// such as a daemon with no elected leader yet.
+func temporary(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return req.Context().Err() == nil && !errors.Is(err, context.Canceled)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter is the wait a response asks for in whole seconds, or zero.
+func retryAfter(resp *http.Response) time.Duration {
+	n, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || n <= 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// cancelBody releases an attempt's timeout once its body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
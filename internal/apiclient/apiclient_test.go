@@ -0,0 +1,143 @@
+package apiclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer fails the first failures requests with status, then echoes
+// the request body. It counts every request.
+func flakyServer(t *testing.T, failures int32, status int) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		io.Copy(w, r.Body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func testConfig(addr string) Config {
+	return Config{Addr: addr, Timeout: time.Second, Retries: 2, Backoff: time.Millisecond}
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	srv, calls := flakyServer(t, 2, http.StatusServiceUnavailable)
+	client, base := NewClient(testConfig(srv.URL))
+
+	resp, err := client.Get(base + "/tasks")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || *calls != 3 {
+		t.Errorf("got status %d after %d calls, want 200 after 3", resp.StatusCode, *calls)
+	}
+
+	// Out of retries the last response is returned as is
+	srv, calls = flakyServer(t, 5, http.StatusBadGateway)
+	client, base = NewClient(testConfig(srv.URL))
+	resp, err = client.Get(base + "/tasks")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || *calls != 3 {
+		t.Errorf("got status %d after %d calls, want 502 after 3", resp.StatusCode, *calls)
+	}
+
+	// Other errors are the daemon's answer, not a transient failure
+	srv, calls = flakyServer(t, 1, http.StatusInternalServerError)
+	client, base = NewClient(testConfig(srv.URL))
+	resp, err = client.Get(base + "/tasks")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError || *calls != 1 {
+		t.Errorf("got status %d after %d calls, want 500 after 1", resp.StatusCode, *calls)
+	}
+}
+
+func TestRetryPost(t *testing.T) {
+	srv, calls := flakyServer(t, 1, http.StatusServiceUnavailable)
+	client, base := NewClient(testConfig(srv.URL))
+
+	resp, err := client.Post(base+"/tasks", "application/json", strings.NewReader(`{"title":"a"}`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || *calls != 1 {
+		t.Errorf("plain POST: got status %d after %d calls, want 503 after 1", resp.StatusCode, *calls)
+	}
+
+	// With an Idempotency-Key the body is sent again in full
+	req, _ := http.NewRequest(http.MethodPost, base+"/tasks", strings.NewReader(`{"title":"b"}`))
+	req.Header.Set("Idempotency-Key", "k1")
+	atomic.StoreInt32(calls, 0)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || *calls != 2 || string(body) != `{"title":"b"}` {
+		t.Errorf("keyed POST: got status %d body %q after %d calls, want 200 with the body after 2", resp.StatusCode, body, *calls)
+	}
+}
+
+func TestAttemptTimeout(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL)
+	cfg.Timeout = 50 * time.Millisecond
+	client, base := NewClient(cfg)
+	resp, err := client.Get(base + "/health")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "ok" || atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("got %q after %d calls, want ok after the slow first attempt timed out", body, calls)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv(AddrEnv, "unix:///tmp/neona.sock")
+	t.Setenv(TimeoutEnv, "3s")
+	t.Setenv(RetriesEnv, "0")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv failed: %v", err)
+	}
+	if cfg.Addr != "unix:///tmp/neona.sock" || cfg.Timeout != 3*time.Second || cfg.Retries != 0 || cfg.Backoff != DefaultBackoff {
+		t.Errorf("FromEnv = %+v", cfg)
+	}
+
+	t.Setenv(RetriesEnv, "-1")
+	if _, err := FromEnv(); err == nil || !strings.Contains(err.Error(), RetriesEnv) {
+		t.Errorf("FromEnv with negative retries: err = %v, want one naming %s", err, RetriesEnv)
+	}
+}
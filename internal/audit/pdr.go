@@ -5,25 +5,196 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"log"
+	"sync"
+	"time"
 
 	"github.com/fentz26/neona/internal/models"
-	"github.com/fentz26/neona/internal/store"
+	"github.com/google/uuid"
 )
 
+// Store persists PDR entries. store.Store and store.Memory implement it.
+type Store interface {
+	WritePDR(action, inputsHash, outcome, taskID, details string) (*models.PDREntry, error)
+	// WritePDRBatch writes entries that already carry their ID and
+	// timestamp, all or none.
+	WritePDRBatch(entries []*models.PDREntry) error
+}
+
 // PDRWriter writes Process Decision Records for audit trails.
+//
+// A writer created with NewPDRWriter writes each record synchronously. One
+// created with NewBufferedPDRWriter queues records and writes them in batches,
+// one transaction per batch; call Close to flush on shutdown.
 type PDRWriter struct {
-	store *store.Store
+	store Store
+
+	mu sync.Mutex
+	// recent holds the last recentActions records, oldest first
+	recent []models.PDREntry
+
+	// Buffered mode only. flushMu serializes flushes, so a Flush returns
+	// only once records queued before it are written, even those a
+	// concurrent flush took.
+	flushMu  sync.Mutex
+	pending  []*models.PDREntry
+	maxBatch int
+	flushCh  chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+	closed   bool
 }
 
+// recentActions is how many records Recent returns.
+const recentActions = 20
+
+// maxPending bounds the records a buffered writer keeps while the store
+// fails to write them; beyond it the oldest are dropped.
+const maxPending = 10000
+
 // NewPDRWriter creates a new PDR writer.
-func NewPDRWriter(s *store.Store) *PDRWriter {
+func NewPDRWriter(s Store) *PDRWriter {
 	return &PDRWriter{store: s}
 }
 
+// NewBufferedPDRWriter creates a PDR writer that flushes queued records every
+// interval, or as soon as maxBatch records are waiting.
+func NewBufferedPDRWriter(s Store, maxBatch int, interval time.Duration) *PDRWriter {
+	if maxBatch <= 0 {
+		maxBatch = 64
+	}
+	w := &PDRWriter{
+		store:    s,
+		maxBatch: maxBatch,
+		flushCh:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go w.flushLoop(interval)
+	return w
+}
+
 // Record writes a PDR entry for a state-mutating action.
 func (w *PDRWriter) Record(action string, inputs interface{}, outcome, taskID, details string) (*models.PDREntry, error) {
 	inputsHash := hashInputs(inputs)
-	return w.store.WritePDR(action, inputsHash, outcome, taskID, details)
+	if w.flushCh == nil {
+		entry, err := w.store.WritePDR(action, inputsHash, outcome, taskID, details)
+		if entry != nil {
+			w.mu.Lock()
+			w.remember(entry)
+			w.mu.Unlock()
+		}
+		return entry, err
+	}
+
+	entry := &models.PDREntry{
+		ID:         uuid.New().String(),
+		Action:     action,
+		InputsHash: inputsHash,
+		Outcome:    outcome,
+		TaskID:     taskID,
+		Details:    details,
+		Timestamp:  time.Now().UTC(),
+	}
+
+	w.mu.Lock()
+	w.remember(entry)
+	if w.closed {
+		w.mu.Unlock()
+		return entry, w.store.WritePDRBatch([]*models.PDREntry{entry})
+	}
+	w.pending = append(w.pending, entry)
+	full := len(w.pending) >= w.maxBatch
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	return entry, nil
+}
+
+// remember adds entry to the recent records. w.mu must be held.
+func (w *PDRWriter) remember(entry *models.PDREntry) {
+	if len(w.recent) == recentActions {
+		w.recent = append(w.recent[:0], w.recent[1:]...)
+	}
+	w.recent = append(w.recent, *entry)
+}
+
+// Recent returns the last records written through w, oldest first, for
+// crash reports. It does not touch the store.
+func (w *PDRWriter) Recent() []models.PDREntry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]models.PDREntry(nil), w.recent...)
+}
+
+// Flush writes any queued records. Records that fail to be written are
+// queued again for the next flush. It is a no-op for unbuffered writers.
+func (w *PDRWriter) Flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if err := w.store.WritePDRBatch(batch); err != nil {
+		log.Printf("audit: failed to write %d PDR records, retrying on the next flush: %v", len(batch), err)
+		w.mu.Lock()
+		w.pending = append(batch, w.pending...)
+		if dropped := len(w.pending) - maxPending; dropped > 0 {
+			log.Printf("audit: dropping %d PDR records queued too long", dropped)
+			w.pending = w.pending[dropped:]
+		}
+		w.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close stops background flushing and writes any queued records.
+func (w *PDRWriter) Close() error {
+	if w.flushCh == nil {
+		return nil
+	}
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.done)
+	<-w.stopped
+	return w.Flush()
+}
+
+func (w *PDRWriter) flushLoop(interval time.Duration) {
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer close(w.stopped)
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		case <-w.flushCh:
+		}
+		w.Flush()
+	}
 }
 
 // hashInputs creates a SHA256 hash of the inputs for reproducibility.
@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+func TestBufferedPDRWriter_FlushesOnCloseAndBatchSize(t *testing.T) {
+	st, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer st.Close()
+
+	// A long interval means only the batch size or Close can trigger a flush
+	w := NewBufferedPDRWriter(st, 2, time.Hour)
+
+	gen := st.Generation()
+	if _, err := w.Record("first", nil, "success", "", ""); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if st.Generation() != gen {
+		t.Error("Expected a single record to stay queued")
+	}
+
+	w.Record("second", nil, "success", "", "")
+	deadline := time.Now().Add(2 * time.Second)
+	for st.Generation() == gen && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st.Generation() == gen {
+		t.Fatal("Expected a full batch to be flushed")
+	}
+
+	gen = st.Generation()
+	w.Record("third", nil, "success", "", "")
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if st.Generation() == gen {
+		t.Error("Expected Close to flush queued records")
+	}
+
+	// Records after Close are written synchronously rather than dropped
+	gen = st.Generation()
+	w.Record("late", nil, "success", "", "")
+	if st.Generation() == gen {
+		t.Error("Expected record after Close to be written")
+	}
+}
+
+func TestPDRWriter_Recent(t *testing.T) {
+	w := NewPDRWriter(store.NewMemory())
+	for i := 0; i < recentActions+5; i++ {
+		w.Record(fmt.Sprintf("action-%d", i), nil, "success", "", "")
+	}
+
+	recent := w.Recent()
+	if len(recent) != recentActions {
+		t.Fatalf("Expected the last %d records, got %d", recentActions, len(recent))
+	}
+	if recent[0].Action != "action-5" || recent[len(recent)-1].Action != fmt.Sprintf("action-%d", recentActions+4) {
+		t.Errorf("Expected the newest records oldest first, got %s..%s", recent[0].Action, recent[len(recent)-1].Action)
+	}
+}
+
+// flakyStore fails batch writes while failing is set.
+type flakyStore struct {
+	*store.Memory
+	failing bool
+}
+
+func (s *flakyStore) WritePDRBatch(entries []*models.PDREntry) error {
+	if s.failing {
+		return errors.New("database is locked")
+	}
+	return s.Memory.WritePDRBatch(entries)
+}
+
+func TestBufferedPDRWriter_RetriesFailedFlush(t *testing.T) {
+	st := &flakyStore{Memory: store.NewMemory(), failing: true}
+	w := NewBufferedPDRWriter(st, 64, time.Hour)
+	defer w.Close()
+
+	w.Record("task.create", nil, "success", "t1", "")
+	if err := w.Flush(); err == nil {
+		t.Fatal("Expected the flush to fail")
+	}
+	w.Record("task.claim", nil, "success", "t1", "")
+
+	st.failing = false
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	entries, _ := st.ListTaskPDRs("t1", 10)
+	if len(entries) != 2 || entries[0].Action != "task.create" || entries[1].Action != "task.claim" {
+		t.Errorf("Expected both records written in order after the retry, got %+v", entries)
+	}
+}
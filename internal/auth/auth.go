@@ -15,6 +15,9 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/fentz26/neona/internal/clock"
+	"github.com/fentz26/neona/internal/paths"
 )
 
 const (
@@ -58,17 +61,13 @@ type Manager struct {
 	configDir   string
 	authURL     string
 	credentials *Credentials
+	clock       clock.Clock
 	mu          sync.RWMutex
 }
 
 // NewManager creates a new auth manager.
 func NewManager() (*Manager, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
-	}
-
-	configDir := filepath.Join(homeDir, ".config", "neona")
+	configDir := paths.ConfigDir()
 	if err := os.MkdirAll(configDir, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create config directory: %w", err)
 	}
@@ -76,6 +75,7 @@ func NewManager() (*Manager, error) {
 	m := &Manager{
 		configDir: configDir,
 		authURL:   DefaultAuthURL,
+		clock:     clock.Real,
 	}
 
 	// Try to load existing credentials
@@ -84,6 +84,13 @@ func NewManager() (*Manager, error) {
 	return m, nil
 }
 
+// SetClock replaces the clock token expiry is checked against.
+func (m *Manager) SetClock(c clock.Clock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = c
+}
+
 // IsAuthenticated checks if the user is currently authenticated.
 func (m *Manager) IsAuthenticated() bool {
 	m.mu.RLock()
@@ -95,7 +102,7 @@ func (m *Manager) IsAuthenticated() bool {
 
 	// Check if token is expired (with 5 minute buffer)
 	expiresAt := time.Unix(m.credentials.Session.ExpiresAt, 0)
-	return time.Now().Before(expiresAt.Add(-5 * time.Minute))
+	return m.clock.Now().Before(expiresAt.Add(-5 * time.Minute))
 }
 
 // GetUser returns the current user if authenticated.
@@ -164,7 +171,7 @@ func (m *Manager) Login(ctx context.Context) (*Session, error) {
 		m.mu.Lock()
 		m.credentials = &Credentials{
 			Session:   result.Session,
-			CreatedAt: time.Now().Unix(),
+			CreatedAt: m.clock.Now().Unix(),
 		}
 		m.mu.Unlock()
 
@@ -234,7 +241,7 @@ func (m *Manager) LoginWithToken(tokenJSON string) (*Session, error) {
 	// Check if token is expired
 	if session.ExpiresAt > 0 {
 		expiresAt := time.Unix(session.ExpiresAt, 0)
-		if time.Now().After(expiresAt) {
+		if m.clock.Now().After(expiresAt) {
 			return nil, fmt.Errorf("token has expired")
 		}
 	}
@@ -243,7 +250,7 @@ func (m *Manager) LoginWithToken(tokenJSON string) (*Session, error) {
 	m.mu.Lock()
 	m.credentials = &Credentials{
 		Session:   session,
-		CreatedAt: time.Now().Unix(),
+		CreatedAt: m.clock.Now().Unix(),
 	}
 	m.mu.Unlock()
 
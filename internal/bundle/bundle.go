@@ -0,0 +1,371 @@
+// Package bundle reads and writes workspace bundles: a tar archive holding
+// a store snapshot and the user's configuration files, for moving Neona to
+// another machine or sharing a reproducible setup.
+//
+// A bundle holds manifest.json, tasks.jsonl, memory.jsonl, pdr.jsonl and
+// the configuration under config/. Bundles named .tar.gz or .tgz are
+// gzip-compressed and .tar.zst bundles are compressed with the zstd command;
+// .tar bundles are not compressed.
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+// Format and Version identify a bundle in its manifest.
+const (
+	Format  = "neona-bundle"
+	Version = 1
+)
+
+// Entry names within the archive.
+const (
+	manifestEntry = "manifest.json"
+	tasksEntry    = "tasks.jsonl"
+	memoryEntry   = "memory.jsonl"
+	pdrEntry      = "pdr.jsonl"
+	configPrefix  = "config/"
+)
+
+// ConfigEntries lists the configuration a bundle carries, relative to the
+// config directory: the MCP routing config, the claim config and the vetted
+// scripts.
+// Credentials, cloud sync keys and plugins, which are binaries built for
+// one machine, stay behind.
+var ConfigEntries = []string{"mcp.yaml", "claims.yaml", "scripts"}
+
+// ErrNotBundle is returned when an archive has no bundle manifest.
+var ErrNotBundle = errors.New("not a neona bundle")
+
+// Manifest describes a bundle.
+type Manifest struct {
+	Format       string    `json:"format"`
+	Version      int       `json:"version"`
+	CreatedAt    time.Time `json:"created_at"`
+	NeonaVersion string    `json:"neona_version,omitempty"`
+	Tasks        int       `json:"tasks"`
+	Memory       int       `json:"memory"`
+	PDR          int       `json:"pdr"`
+	Files        []string  `json:"files"`
+}
+
+// File is a configuration file, by slash-separated path relative to the
+// config directory.
+type File struct {
+	Path string
+	Mode os.FileMode
+	Data []byte
+}
+
+// Bundle is the content of a workspace bundle.
+type Bundle struct {
+	Manifest Manifest
+	Snapshot store.Snapshot
+	Files    []File
+}
+
+// New returns a bundle of a snapshot and configuration files, with its
+// manifest filled in.
+func New(snap *store.Snapshot, files []File, neonaVersion string) *Bundle {
+	b := &Bundle{
+		Manifest: Manifest{
+			Format:       Format,
+			Version:      Version,
+			CreatedAt:    time.Now().UTC(),
+			NeonaVersion: neonaVersion,
+			Tasks:        len(snap.Tasks),
+			Memory:       len(snap.Memory),
+			PDR:          len(snap.PDR),
+			Files:        []string{},
+		},
+		Snapshot: *snap,
+		Files:    files,
+	}
+	for _, f := range files {
+		b.Manifest.Files = append(b.Manifest.Files, f.Path)
+	}
+	return b
+}
+
+// ReadConfig reads the ConfigEntries that exist under dir.
+func ReadConfig(dir string) ([]File, error) {
+	var files []File
+	for _, entry := range ConfigEntries {
+		root := filepath.Join(dir, entry)
+		err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if errors.Is(err, os.ErrNotExist) && p == root {
+				return filepath.SkipDir
+			}
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, File{Path: filepath.ToSlash(rel), Mode: info.Mode().Perm(), Data: data})
+			return nil
+		})
+		if err != nil && !errors.Is(err, filepath.SkipDir) {
+			return nil, err
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// WriteConfig writes files under dir. Existing files are kept unless
+// overwrite is set; it returns the paths written and those kept.
+func WriteConfig(dir string, files []File, overwrite bool) (written, kept []string, err error) {
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if _, err := os.Stat(p); err == nil && !overwrite {
+			kept = append(kept, f.Path)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			return written, kept, err
+		}
+		if err := os.WriteFile(p, f.Data, f.Mode|0600); err != nil {
+			return written, kept, err
+		}
+		written = append(written, f.Path)
+	}
+	return written, kept, nil
+}
+
+// Write writes b to w as an uncompressed tar archive.
+func Write(w io.Writer, b *Bundle) error {
+	tw := tar.NewWriter(w)
+	modTime := b.Manifest.CreatedAt
+	add := func(name string, mode os.FileMode, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: int64(mode), Size: int64(len(data)), ModTime: modTime, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	manifest, err := json.MarshalIndent(b.Manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := add(manifestEntry, 0644, manifest); err != nil {
+		return err
+	}
+	snap := &b.Snapshot
+	for _, e := range []struct {
+		name string
+		n    int
+		row  func(i int) interface{}
+	}{
+		{tasksEntry, len(snap.Tasks), func(i int) interface{} { return snap.Tasks[i] }},
+		{memoryEntry, len(snap.Memory), func(i int) interface{} { return snap.Memory[i] }},
+		{pdrEntry, len(snap.PDR), func(i int) interface{} { return snap.PDR[i] }},
+	} {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for i := 0; i < e.n; i++ {
+			if err := enc.Encode(e.row(i)); err != nil {
+				return fmt.Errorf("%s: %w", e.name, err)
+			}
+		}
+		if err := add(e.name, 0644, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	for _, f := range b.Files {
+		if err := add(configPrefix+f.Path, f.Mode, f.Data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// Read reads a bundle from an uncompressed tar archive. Configuration paths
+// that would leave the config directory are rejected.
+func Read(r io.Reader) (*Bundle, error) {
+	b := &Bundle{}
+	seenManifest := false
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read bundle: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		switch name := hdr.Name; {
+		case name == manifestEntry:
+			if err := json.NewDecoder(tr).Decode(&b.Manifest); err != nil {
+				return nil, fmt.Errorf("read manifest: %w", err)
+			}
+			if b.Manifest.Format != Format {
+				return nil, ErrNotBundle
+			}
+			if b.Manifest.Version > Version {
+				return nil, fmt.Errorf("bundle version %d is newer than this neona supports (%d); update neona", b.Manifest.Version, Version)
+			}
+			seenManifest = true
+		case name == tasksEntry:
+			err = readLines(tr, func(dec *json.Decoder) error {
+				var t models.Task
+				err := dec.Decode(&t)
+				b.Snapshot.Tasks = append(b.Snapshot.Tasks, t)
+				return err
+			})
+		case name == memoryEntry:
+			err = readLines(tr, func(dec *json.Decoder) error {
+				var m models.MemoryItem
+				err := dec.Decode(&m)
+				b.Snapshot.Memory = append(b.Snapshot.Memory, m)
+				return err
+			})
+		case name == pdrEntry:
+			err = readLines(tr, func(dec *json.Decoder) error {
+				var e models.PDREntry
+				err := dec.Decode(&e)
+				b.Snapshot.PDR = append(b.Snapshot.PDR, e)
+				return err
+			})
+		case strings.HasPrefix(name, configPrefix):
+			rel := strings.TrimPrefix(name, configPrefix)
+			if rel == "" || path.IsAbs(rel) || !filepath.IsLocal(filepath.FromSlash(rel)) {
+				return nil, fmt.Errorf("bundle entry %q is outside the config directory", name)
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("read %s: %w", name, err)
+			}
+			b.Files = append(b.Files, File{Path: path.Clean(rel), Mode: os.FileMode(hdr.Mode).Perm(), Data: data})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", hdr.Name, err)
+		}
+	}
+	if !seenManifest {
+		return nil, ErrNotBundle
+	}
+	return b, nil
+}
+
+func readLines(r io.Reader, decode func(dec *json.Decoder) error) error {
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		if err := decode(dec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compression magic numbers, for Open.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Create writes b to a file, compressed as its name says.
+func Create(name string, b *Bundle) (err error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(name)
+		}
+	}()
+
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		zw := gzip.NewWriter(f)
+		if err := Write(zw, b); err != nil {
+			return err
+		}
+		return zw.Close()
+	case strings.HasSuffix(name, ".tar.zst"):
+		var buf bytes.Buffer
+		if err := Write(&buf, b); err != nil {
+			return err
+		}
+		return zstd(&buf, f, "-q", "-c")
+	case strings.HasSuffix(name, ".tar"):
+		return Write(f, b)
+	default:
+		return fmt.Errorf("%s: name the bundle .tar.gz, .tar.zst or .tar", name)
+	}
+}
+
+// Open reads a bundle file, detecting its compression from its content.
+func Open(name string) (*Bundle, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	head, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return Read(zr)
+	case bytes.HasPrefix(head, zstdMagic):
+		var buf bytes.Buffer
+		if err := zstd(br, &buf, "-q", "-d", "-c"); err != nil {
+			return nil, err
+		}
+		return Read(&buf)
+	default:
+		return Read(br)
+	}
+}
+
+// zstd runs the zstd command as a filter from r to w.
+func zstd(r io.Reader, w io.Writer, args ...string) error {
+	bin, err := exec.LookPath("zstd")
+	if err != nil {
+		return errors.New("zstd is not installed; install it or use a .tar.gz bundle")
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(bin, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = r, w, &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("zstd: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
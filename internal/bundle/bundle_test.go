@@ -0,0 +1,104 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+func TestCreateAndOpen(t *testing.T) {
+	cfg := t.TempDir()
+	os.WriteFile(filepath.Join(cfg, "mcp.yaml"), []byte("strategy: auto\n"), 0600)
+	os.MkdirAll(filepath.Join(cfg, "scripts"), 0700)
+	os.WriteFile(filepath.Join(cfg, "scripts", "deploy.sh"), []byte("#!/bin/sh\n"), 0755)
+	os.WriteFile(filepath.Join(cfg, "credentials.json"), []byte("secret"), 0600)
+
+	files, err := ReadConfig(cfg)
+	if err != nil {
+		t.Fatalf("ReadConfig failed: %v", err)
+	}
+	if len(files) != 2 || files[0].Path != "mcp.yaml" || files[1].Path != "scripts/deploy.sh" || files[1].Mode != 0755 {
+		t.Fatalf("ReadConfig = %+v, want mcp.yaml and the script only", files)
+	}
+
+	due := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	snap := &store.Snapshot{
+		Tasks:  []models.Task{{ID: "t1", Title: "Ship", Status: models.TaskStatusPending, Labels: []string{"release"}, DueAt: &due}},
+		Memory: []models.MemoryItem{{ID: "m1", Content: "Use staging first", Scope: models.MemoryScopeGlobal, SeenCount: 2}},
+		PDR:    []models.PDREntry{{ID: "p1", Action: "task.create", Outcome: "success", TaskID: "t1"}},
+	}
+	name := filepath.Join(t.TempDir(), "ws.tar.gz")
+	if err := Create(name, New(snap, files, "1.2.3")); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	b, err := Open(name)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if b.Manifest.Tasks != 1 || b.Manifest.NeonaVersion != "1.2.3" || len(b.Manifest.Files) != 2 {
+		t.Errorf("Manifest = %+v", b.Manifest)
+	}
+	if len(b.Snapshot.Tasks) != 1 || !b.Snapshot.Tasks[0].DueAt.Equal(due) || b.Snapshot.Tasks[0].Labels[0] != "release" {
+		t.Errorf("Tasks = %+v", b.Snapshot.Tasks)
+	}
+	if len(b.Snapshot.Memory) != 1 || b.Snapshot.Memory[0].SeenCount != 2 || len(b.Snapshot.PDR) != 1 {
+		t.Errorf("Memory = %+v, PDR = %+v", b.Snapshot.Memory, b.Snapshot.PDR)
+	}
+
+	// Existing files are kept unless overwriting
+	dest := t.TempDir()
+	os.WriteFile(filepath.Join(dest, "mcp.yaml"), []byte("mine\n"), 0600)
+	written, kept, err := WriteConfig(dest, b.Files, false)
+	if err != nil || len(written) != 1 || len(kept) != 1 || kept[0] != "mcp.yaml" {
+		t.Fatalf("WriteConfig = %v, %v, %v", written, kept, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "mcp.yaml")); string(data) != "mine\n" {
+		t.Errorf("Expected mcp.yaml kept, got %q", data)
+	}
+	if info, err := os.Stat(filepath.Join(dest, "scripts", "deploy.sh")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("Expected the script written executable, got %v, %v", info, err)
+	}
+	if _, _, err := WriteConfig(dest, b.Files, true); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "mcp.yaml")); string(data) != "strategy: auto\n" {
+		t.Errorf("Expected mcp.yaml replaced, got %q", data)
+	}
+
+	if err := Create(filepath.Join(t.TempDir(), "ws.zip"), New(snap, nil, "")); err == nil {
+		t.Error("Expected an unknown extension rejected")
+	}
+}
+
+func TestReadRejects(t *testing.T) {
+	archive := func(entries map[string]string) *bytes.Buffer {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for name, data := range entries {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+			tw.Write([]byte(data))
+		}
+		tw.Close()
+		return &buf
+	}
+	manifest := `{"format":"neona-bundle","version":1}`
+
+	if _, err := Read(archive(map[string]string{"tasks.jsonl": ""})); !errors.Is(err, ErrNotBundle) {
+		t.Errorf("Expected ErrNotBundle without a manifest, got %v", err)
+	}
+	if _, err := Read(archive(map[string]string{"manifest.json": `{"format":"neona-bundle","version":99}`})); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("Expected a newer version rejected, got %v", err)
+	}
+	if _, err := Read(archive(map[string]string{"manifest.json": manifest, "config/../../.bashrc": "x"})); err == nil {
+		t.Error("Expected a path outside the config directory rejected")
+	}
+}
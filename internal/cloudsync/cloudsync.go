@@ -0,0 +1,648 @@
+// Package cloudsync mirrors a daemon's tasks, and optionally summaries of
+// its memory, to the hosted neona.app backend for a logged-in user, and
+// pulls down the tasks of their team.
+//
+// Each pass pushes what changed locally since the previous one, then pulls
+// what changed in the team's feed. Tasks pulled down are created locally
+// with the "cloud" label and linked to their remote record; later status
+// changes flow both ways through the link. When a linked task's status
+// changed on both sides between passes, the conflict policy picks one and
+// the conflict is kept for `neona sync status`.
+package cloudsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fentz26/neona/internal/clock"
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+	"github.com/google/uuid"
+)
+
+// DefaultURL is the hosted backend's sync API.
+const DefaultURL = "https://api.neona.app/v1/sync"
+
+// Label marks tasks pulled down from the backend.
+const Label = "cloud"
+
+// Conflict policies: which side's status a task keeps when both changed.
+const (
+	PolicyNewest = "newest" // the side updated last; local on a tie
+	PolicyLocal  = "local"
+	PolicyRemote = "remote"
+)
+
+// summaryLen caps the content sent for each memory item.
+const summaryLen = 280
+
+// ErrNotLoggedIn is reported while no user is logged in; nothing is synced.
+var ErrNotLoggedIn = errors.New("not logged in (run neona login)")
+
+// Store is the store access the syncer needs. store.Store implements it.
+type Store interface {
+	ListTasksUpdatedBetween(since, until time.Time, statuses ...models.TaskStatus) ([]models.Task, error)
+	QueryMemory(query string, scopes ...string) ([]models.MemoryItem, error)
+	CreateTaskWithOptions(title, description string, opts store.TaskOptions) (*models.Task, error)
+	GetTask(id string) (*models.Task, error)
+	UpdateTaskStatus(id string, status models.TaskStatus) error
+}
+
+// Config says what is synced and how.
+type Config struct {
+	URL      string
+	Interval time.Duration
+	// Token returns the logged-in user's access token, or "" when nobody
+	// is logged in. It is called on every pass, so a later login is
+	// picked up.
+	Token func() (string, error)
+	// StatePath is the JSON file the sync state is kept in.
+	StatePath string
+
+	// Labels, if set, limits pushed tasks to those carrying one of them.
+	// Linked tasks are always pushed.
+	Labels []string
+	// Memory pushes summaries of new memory items, from MemoryScopes only
+	// if set.
+	Memory       bool
+	MemoryScopes []string
+	// Team, if set, is the team whose tasks are pulled down.
+	Team string
+	// Conflicts is the conflict policy; empty means PolicyNewest.
+	Conflicts string
+	// Keys, if set, returns the sync keys content is sealed with before it
+	// is pushed (see KeyFile). It is called on every pass, so a rotation
+	// is picked up; content is then pushed again under the new key.
+	Keys func() (*Keys, error)
+	// PlaintextDevices are teammates' devices that sync without
+	// encryption. With Keys set, pulled tasks whose content is not sealed
+	// are rejected unless they come from one of these.
+	PlaintextDevices []string
+}
+
+// CheckPolicy reports whether policy is a known conflict policy.
+func CheckPolicy(policy string) error {
+	switch policy {
+	case "", PolicyNewest, PolicyLocal, PolicyRemote:
+		return nil
+	}
+	return fmt.Errorf("unknown conflict policy %q: want %s, %s or %s", policy, PolicyNewest, PolicyLocal, PolicyRemote)
+}
+
+// TaskSummary is a task as the backend holds it.
+type TaskSummary struct {
+	// ID is the backend's; empty for a task pushed for the first time.
+	ID      string `json:"id,omitempty"`
+	LocalID string `json:"local_id,omitempty"`
+	// Device is the installation the task comes from.
+	Device      string    `json:"device"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	Status      string    `json:"status"`
+	Labels      []string  `json:"labels,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// MemorySummary is the start of a memory item, enough to find it by.
+type MemorySummary struct {
+	LocalID   string    `json:"local_id"`
+	Scope     string    `json:"scope"`
+	Tags      string    `json:"tags,omitempty"`
+	Summary   string    `json:"summary"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PushRequest is the body of POST {URL}/push.
+type PushRequest struct {
+	Device string          `json:"device"`
+	Tasks  []TaskSummary   `json:"tasks"`
+	Memory []MemorySummary `json:"memory,omitempty"`
+}
+
+// PushResponse returns the pushed tasks with their backend IDs.
+type PushResponse struct {
+	Tasks []TaskSummary `json:"tasks"`
+}
+
+// PullResponse is the answer to GET {URL}/pull: the team's tasks changed
+// since the cursor, and the cursor to pass next.
+type PullResponse struct {
+	Tasks  []TaskSummary `json:"tasks"`
+	Cursor string        `json:"cursor"`
+}
+
+// Status is what `neona sync status` shows.
+type Status struct {
+	Enabled   bool       `json:"enabled"`
+	URL       string     `json:"url,omitempty"`
+	Device    string     `json:"device,omitempty"`
+	Labels    []string   `json:"labels,omitempty"`
+	Memory    bool       `json:"memory,omitempty"`
+	Team      string     `json:"team,omitempty"`
+	Policy    string     `json:"conflict_policy,omitempty"`
+	Encrypted bool       `json:"encrypted,omitempty"`
+	KeyID     string     `json:"key_id,omitempty"`
+	LastSync  *time.Time `json:"last_sync,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	Pushed    int        `json:"pushed"`
+	Pulled    int        `json:"pulled"`
+	Linked    int        `json:"linked"`
+	Conflicts []Conflict `json:"conflicts"`
+
+	// PlaintextDevices are the teammates' devices accepted unencrypted.
+	PlaintextDevices []string `json:"plaintext_devices,omitempty"`
+	// Rejected counts pulled tasks refused because their content was not
+	// sealed.
+	Rejected int `json:"rejected,omitempty"`
+}
+
+// Syncer runs sync passes every Interval.
+type Syncer struct {
+	store  Store
+	cfg    Config
+	client *http.Client
+	clock  clock.Clock
+
+	// mu serializes passes and guards the state file
+	mu sync.Mutex
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a syncer.
+func New(s Store, cfg Config) *Syncer {
+	if cfg.URL == "" {
+		cfg.URL = DefaultURL
+	}
+	if cfg.Conflicts == "" {
+		cfg.Conflicts = PolicyNewest
+	}
+	return &Syncer{store: s, cfg: cfg, client: &http.Client{Timeout: 30 * time.Second}, clock: clock.Real}
+}
+
+// SetClock replaces the clock passes are timed with. It should be the
+// store's clock.
+func (y *Syncer) SetClock(c clock.Clock) {
+	y.clock = c
+}
+
+// Start runs a pass now and then every Interval until Stop is called.
+func (y *Syncer) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	y.cancel = cancel
+	y.wg.Add(1)
+	go func() {
+		defer y.wg.Done()
+		interval := y.cfg.Interval
+		if interval <= 0 {
+			interval = 5 * time.Minute
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := y.Sync(ctx); err != nil && !errors.Is(err, ErrNotLoggedIn) {
+				log.Printf("Cloud sync: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the syncer and waits for a pass in progress to finish.
+func (y *Syncer) Stop() {
+	if y.cancel != nil {
+		y.cancel()
+	}
+	y.wg.Wait()
+}
+
+// Sync runs one pass: push, then pull. The outcome is recorded in the
+// state whether or not it succeeds.
+func (y *Syncer) Sync(ctx context.Context) error {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+
+	st, err := loadState(y.cfg.StatePath)
+	if err != nil {
+		return fmt.Errorf("load state: %w", err)
+	}
+	if st.Device == "" {
+		st.Device = uuid.New().String()
+	}
+	err = y.pass(ctx, st)
+	st.LastSync = y.clock.Now()
+	st.LastError = ""
+	if err != nil {
+		st.LastError = err.Error()
+	}
+	if saveErr := st.save(y.cfg.StatePath); saveErr != nil && err == nil {
+		err = fmt.Errorf("save state: %w", saveErr)
+	}
+	return err
+}
+
+func (y *Syncer) pass(ctx context.Context, st *state) error {
+	if y.cfg.Token == nil {
+		return ErrNotLoggedIn
+	}
+	token, err := y.cfg.Token()
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return ErrNotLoggedIn
+	}
+	var keys *Keys
+	if y.cfg.Keys != nil {
+		if keys, err = y.cfg.Keys(); err != nil {
+			return fmt.Errorf("sync keys: %w", err)
+		}
+		if keys.Current != st.KeyID {
+			// Push everything again under the new key
+			st.PushedUntil, st.KeyID = time.Time{}, keys.Current
+		}
+	}
+	if err := y.push(ctx, st, token, keys); err != nil {
+		return fmt.Errorf("push: %w", err)
+	}
+	if y.cfg.Team != "" {
+		if err := y.pull(ctx, st, token, keys); err != nil {
+			return fmt.Errorf("pull: %w", err)
+		}
+	}
+	return nil
+}
+
+// push sends the tasks and memory items changed since the last push,
+// sealed with keys if set.
+func (y *Syncer) push(ctx context.Context, st *state, token string, keys *Keys) error {
+	now := y.clock.Now()
+	tasks, err := y.store.ListTasksUpdatedBetween(st.PushedUntil, now)
+	if err != nil {
+		return err
+	}
+	req := PushRequest{Device: st.Device, Tasks: []TaskSummary{}}
+	for _, t := range tasks {
+		link := st.linkByTask(t.ID)
+		if link == nil && !hasAnyLabel(t.Labels, y.cfg.Labels) {
+			continue
+		}
+		summary := TaskSummary{
+			LocalID:     t.ID,
+			Device:      st.Device,
+			Title:       t.Title,
+			Description: t.Description,
+			Status:      string(t.Status),
+			Labels:      t.Labels,
+			CreatedAt:   t.CreatedAt,
+			UpdatedAt:   t.UpdatedAt,
+		}
+		if link != nil {
+			summary.ID = link.RemoteID
+		}
+		if err := summary.seal(keys); err != nil {
+			return err
+		}
+		req.Tasks = append(req.Tasks, summary)
+	}
+	if y.cfg.Memory {
+		// QueryMemory returns the newest items only, plenty between passes
+		items, err := y.store.QueryMemory("", y.cfg.MemoryScopes...)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if item.CreatedAt.Before(st.PushedUntil) || !item.CreatedAt.Before(now) {
+				continue
+			}
+			summary := MemorySummary{
+				LocalID:   item.ID,
+				Scope:     item.Scope,
+				Tags:      item.Tags,
+				Summary:   summarize(item.Content),
+				CreatedAt: item.CreatedAt,
+			}
+			if err := summary.seal(keys); err != nil {
+				return err
+			}
+			req.Memory = append(req.Memory, summary)
+		}
+	}
+
+	if len(req.Tasks) > 0 || len(req.Memory) > 0 {
+		var resp PushResponse
+		if err := y.do(ctx, token, http.MethodPost, "/push", req, &resp); err != nil {
+			return err
+		}
+		for _, remote := range resp.Tasks {
+			if remote.ID == "" || remote.LocalID == "" {
+				continue
+			}
+			if link := st.linkByTask(remote.LocalID); link != nil {
+				link.RemoteID, link.Status, link.SyncedAt = remote.ID, remote.Status, now
+			} else {
+				st.Links = append(st.Links, Link{TaskID: remote.LocalID, RemoteID: remote.ID, Status: remote.Status, SyncedAt: now})
+			}
+		}
+		st.Pushed += len(req.Tasks) + len(req.Memory)
+	}
+	st.PushedUntil = now
+	return nil
+}
+
+// pull applies the team's tasks changed since the last pull, opening their
+// content with keys.
+func (y *Syncer) pull(ctx context.Context, st *state, token string, keys *Keys) error {
+	q := url.Values{"team": {y.cfg.Team}}
+	if st.PullCursor != "" {
+		q.Set("since", st.PullCursor)
+	}
+	var resp PullResponse
+	if err := y.do(ctx, token, http.MethodGet, "/pull?"+q.Encode(), nil, &resp); err != nil {
+		return err
+	}
+	now := y.clock.Now()
+	for _, remote := range resp.Tasks {
+		if remote.Device == st.Device || remote.ID == "" {
+			continue
+		}
+		err := remote.open(keys, y.plaintextAllowed(remote.Device))
+		if errors.Is(err, ErrUnsealed) {
+			log.Printf("Cloud sync: rejected task %s from device %s: its content is not encrypted", remote.ID, remote.Device)
+			st.Rejected++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("task %s: %w", remote.ID, err)
+		}
+		if err := y.apply(st, remote, now); err != nil {
+			return fmt.Errorf("task %s: %w", remote.ID, err)
+		}
+	}
+	if resp.Cursor != "" {
+		st.PullCursor = resp.Cursor
+	}
+	return nil
+}
+
+// plaintextAllowed reports whether device may sync content unencrypted.
+func (y *Syncer) plaintextAllowed(device string) bool {
+	for _, d := range y.cfg.PlaintextDevices {
+		if d == device {
+			return true
+		}
+	}
+	return false
+}
+
+// apply brings one pulled task into the store.
+func (y *Syncer) apply(st *state, remote TaskSummary, now time.Time) error {
+	link := st.linkByRemote(remote.ID)
+	if link == nil {
+		task, err := y.store.CreateTaskWithOptions(remote.Title, remote.Description, store.TaskOptions{
+			Labels: appendLabel(remote.Labels, Label),
+		})
+		if err != nil {
+			return err
+		}
+		if remote.Status != "" && remote.Status != string(task.Status) {
+			if err := y.store.UpdateTaskStatus(task.ID, models.TaskStatus(remote.Status)); err != nil {
+				return err
+			}
+		}
+		st.Links = append(st.Links, Link{TaskID: task.ID, RemoteID: remote.ID, Status: remote.Status, SyncedAt: now})
+		st.Pulled++
+		return nil
+	}
+
+	local, err := y.store.GetTask(link.TaskID)
+	if err != nil {
+		return err
+	}
+	if local == nil || remote.Status == link.Status {
+		// Deleted here, or nothing new there
+		return nil
+	}
+	keep := PolicyRemote
+	if string(local.Status) != link.Status && string(local.Status) != remote.Status {
+		keep = y.resolve(local, remote)
+		st.addConflict(Conflict{
+			TaskID:       local.ID,
+			RemoteID:     remote.ID,
+			LocalStatus:  string(local.Status),
+			RemoteStatus: remote.Status,
+			Kept:         keep,
+			At:           now,
+		})
+	}
+	if keep == PolicyRemote {
+		if err := y.store.UpdateTaskStatus(local.ID, models.TaskStatus(remote.Status)); err != nil {
+			return err
+		}
+		link.Status = remote.Status
+		st.Pulled++
+	}
+	// A local status that won is pushed on the next pass
+	link.SyncedAt = now
+	return nil
+}
+
+// resolve returns the side a conflicting task keeps.
+func (y *Syncer) resolve(local *models.Task, remote TaskSummary) string {
+	switch y.cfg.Conflicts {
+	case PolicyLocal, PolicyRemote:
+		return y.cfg.Conflicts
+	}
+	if remote.UpdatedAt.After(local.UpdatedAt) {
+		return PolicyRemote
+	}
+	return PolicyLocal
+}
+
+// Status returns the sync settings and the outcome of the last pass.
+func (y *Syncer) Status() (*Status, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	st, err := loadState(y.cfg.StatePath)
+	if err != nil {
+		return nil, err
+	}
+	status := &Status{
+		Enabled:   true,
+		URL:       y.cfg.URL,
+		Device:    st.Device,
+		Labels:    y.cfg.Labels,
+		Memory:    y.cfg.Memory,
+		Team:      y.cfg.Team,
+		Policy:    y.cfg.Conflicts,
+		Encrypted: y.cfg.Keys != nil,
+		KeyID:     st.KeyID,
+		LastError: st.LastError,
+		Pushed:    st.Pushed,
+		Pulled:    st.Pulled,
+		Linked:    len(st.Links),
+		Conflicts: st.Conflicts,
+
+		PlaintextDevices: y.cfg.PlaintextDevices,
+		Rejected:         st.Rejected,
+	}
+	if !st.LastSync.IsZero() {
+		status.LastSync = &st.LastSync
+	}
+	if status.Conflicts == nil {
+		status.Conflicts = []Conflict{}
+	}
+	return status, nil
+}
+
+// do sends a request to the backend and decodes its JSON answer into out.
+func (y *Syncer) do(ctx context.Context, token, method, path string, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(y.cfg.URL, "/")+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := y.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// seal encrypts the task's content with keys, if set, each field bound to
+// the task's local ID and the field's name.
+func (t *TaskSummary) seal(keys *Keys) error {
+	if keys == nil {
+		return nil
+	}
+	var err error
+	if t.Title, err = keys.Seal(t.Title, Bind(t.LocalID, "title")); err != nil {
+		return err
+	}
+	if t.Description, err = keys.Seal(t.Description, Bind(t.LocalID, "description")); err != nil {
+		return err
+	}
+	labels := make([]string, len(t.Labels))
+	for i, l := range t.Labels {
+		if labels[i], err = keys.Seal(l, Bind(t.LocalID, labelField(i))); err != nil {
+			return err
+		}
+	}
+	t.Labels = labels
+	return nil
+}
+
+// open decrypts content sealed by seal. Sealed content needs keys; content
+// that is not sealed is refused with ErrUnsealed when there are keys,
+// unless plaintext is true.
+func (t *TaskSummary) open(keys *Keys, plaintext bool) error {
+	field := func(v, name string) (string, error) {
+		if plaintext && !Sealed(v) {
+			return v, nil
+		}
+		return keys.Open(v, Bind(t.LocalID, name))
+	}
+	var err error
+	if t.Title, err = field(t.Title, "title"); err != nil {
+		return err
+	}
+	if t.Description, err = field(t.Description, "description"); err != nil {
+		return err
+	}
+	for i, l := range t.Labels {
+		if t.Labels[i], err = field(l, labelField(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// labelField names the i'th label for Bind, so labels cannot be reordered.
+func labelField(i int) string {
+	return "labels." + strconv.Itoa(i)
+}
+
+// seal encrypts the memory item's summary and tags with keys, if set, bound
+// to the item's local ID and the field's name.
+func (m *MemorySummary) seal(keys *Keys) error {
+	if keys == nil {
+		return nil
+	}
+	var err error
+	if m.Summary, err = keys.Seal(m.Summary, Bind(m.LocalID, "summary")); err != nil {
+		return err
+	}
+	m.Tags, err = keys.Seal(m.Tags, Bind(m.LocalID, "tags"))
+	return err
+}
+
+func hasAnyLabel(labels, want []string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	for _, l := range labels {
+		for _, w := range want {
+			if l == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func appendLabel(labels []string, label string) []string {
+	for _, l := range labels {
+		if l == label {
+			return labels
+		}
+	}
+	return append(append([]string(nil), labels...), label)
+}
+
+// summarize returns the first summaryLen runes of content on one line.
+func summarize(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	if r := []rune(content); len(r) > summaryLen {
+		return string(r[:summaryLen]) + "…"
+	}
+	return content
+}
@@ -0,0 +1,346 @@
+package cloudsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/clock"
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+// fakeBackend records pushes and serves a fixed team feed.
+type fakeBackend struct {
+	mu     sync.Mutex
+	pushes []PushRequest
+	feed   []TaskSummary
+	auth   string
+}
+
+func (b *fakeBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.auth = r.Header.Get("Authorization")
+	switch r.URL.Path {
+	case "/push":
+		var req PushRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b.pushes = append(b.pushes, req)
+		resp := PushResponse{}
+		for _, t := range req.Tasks {
+			if t.ID == "" {
+				t.ID = "r-" + t.LocalID
+			}
+			resp.Tasks = append(resp.Tasks, t)
+		}
+		json.NewEncoder(w).Encode(resp)
+	case "/pull":
+		if r.URL.Query().Get("team") == "" {
+			http.Error(w, "no team", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(PullResponse{Tasks: b.feed, Cursor: "c1"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (b *fakeBackend) lastPush() PushRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pushes) == 0 {
+		return PushRequest{}
+	}
+	return b.pushes[len(b.pushes)-1]
+}
+
+func setup(t *testing.T, cfg Config) (*store.Store, *Syncer, *fakeBackend, *clock.Fake) {
+	t.Helper()
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	clk := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	s.SetClock(clk)
+
+	backend := &fakeBackend{}
+	srv := httptest.NewServer(backend)
+	t.Cleanup(srv.Close)
+
+	cfg.URL = srv.URL
+	cfg.StatePath = filepath.Join(t.TempDir(), "cloud-sync.json")
+	if cfg.Token == nil {
+		cfg.Token = func() (string, error) { return "tok", nil }
+	}
+	y := New(s, cfg)
+	y.SetClock(clk)
+	return s, y, backend, clk
+}
+
+func TestSyncPush(t *testing.T) {
+	s, y, backend, clk := setup(t, Config{Labels: []string{"team"}, Memory: true})
+
+	shared, _ := s.CreateTaskWithOptions("Shared", "", store.TaskOptions{Labels: []string{"team"}})
+	s.CreateTask("Private", "")
+	s.AddMemory("", strings.Repeat("word ", 100), "notes")
+	clk.Advance(time.Second)
+
+	if err := y.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	push := backend.lastPush()
+	if backend.auth != "Bearer tok" {
+		t.Errorf("Expected the token sent, got %q", backend.auth)
+	}
+	if len(push.Tasks) != 1 || push.Tasks[0].LocalID != shared.ID || push.Tasks[0].ID != "" {
+		t.Fatalf("Expected only the labelled task pushed, got %+v", push.Tasks)
+	}
+	if len(push.Memory) != 1 || len([]rune(push.Memory[0].Summary)) != summaryLen+1 {
+		t.Errorf("Expected one summarized memory item, got %+v", push.Memory)
+	}
+
+	// The pushed task is now linked, and sent with its ID once it changes
+	s.UpdateTaskStatus(shared.ID, models.TaskStatusCompleted)
+	clk.Advance(time.Second)
+	if err := y.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	push = backend.lastPush()
+	if len(push.Tasks) != 1 || push.Tasks[0].ID != "r-"+shared.ID {
+		t.Errorf("Expected the linked task pushed with its ID, got %+v", push.Tasks)
+	}
+	if n := len(backend.pushes); n != 2 {
+		t.Fatalf("Expected 2 pushes, got %d", n)
+	}
+
+	// Nothing changed: nothing is sent
+	clk.Advance(time.Second)
+	y.Sync(context.Background())
+	if n := len(backend.pushes); n != 2 {
+		t.Errorf("Expected no push without changes, got %d pushes", n)
+	}
+
+	st, err := y.Status()
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if !st.Enabled || st.Linked != 1 || st.Pushed != 3 || st.LastSync == nil || st.LastError != "" {
+		t.Errorf("Unexpected status: %+v", st)
+	}
+}
+
+func TestSyncPull(t *testing.T) {
+	s, y, backend, clk := setup(t, Config{Team: "core"})
+	y.Sync(context.Background())
+	st, _ := y.Status()
+	backend.feed = []TaskSummary{
+		{ID: "r1", Device: "other", Title: "Review RFC", Status: string(models.TaskStatusPending), Labels: []string{"rfc"}},
+		{ID: "r2", Device: st.Device, Title: "Mine", Status: string(models.TaskStatusPending)},
+	}
+
+	if err := y.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	tasks, _ := s.ListTasks("")
+	if len(tasks) != 1 || tasks[0].Title != "Review RFC" {
+		t.Fatalf("Expected the team task created, got %+v", tasks)
+	}
+	if labels := strings.Join(tasks[0].Labels, ","); labels != "rfc,cloud" {
+		t.Errorf("Expected labels rfc,cloud, got %s", labels)
+	}
+
+	// A remote status change is applied to the linked task
+	clk.Advance(time.Second)
+	backend.feed = []TaskSummary{{ID: "r1", Device: "other", Title: "Review RFC", Status: string(models.TaskStatusCompleted)}}
+	if err := y.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	task, _ := s.GetTask(tasks[0].ID)
+	if task.Status != models.TaskStatusCompleted {
+		t.Errorf("Expected the remote status applied, got %s", task.Status)
+	}
+	if tasks, _ := s.ListTasks(""); len(tasks) != 1 {
+		t.Errorf("Expected the linked task not duplicated, got %d tasks", len(tasks))
+	}
+}
+
+func TestSyncConflicts(t *testing.T) {
+	tests := []struct {
+		policy     string
+		remoteLate bool
+		want       models.TaskStatus
+		kept       string
+	}{
+		{PolicyNewest, true, models.TaskStatusCompleted, PolicyRemote},
+		{PolicyNewest, false, models.TaskStatusFailed, PolicyLocal},
+		{PolicyLocal, true, models.TaskStatusFailed, PolicyLocal},
+		{PolicyRemote, false, models.TaskStatusCompleted, PolicyRemote},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+"/"+tt.kept, func(t *testing.T) {
+			s, y, backend, clk := setup(t, Config{Team: "core", Conflicts: tt.policy})
+			backend.feed = []TaskSummary{{ID: "r1", Device: "other", Title: "Deploy", Status: string(models.TaskStatusPending)}}
+			y.Sync(context.Background())
+			tasks, _ := s.ListTasks("")
+
+			// Both sides change the status before the next pass
+			clk.Advance(time.Minute)
+			s.UpdateTaskStatus(tasks[0].ID, models.TaskStatusFailed)
+			remoteAt := clk.Now().Add(-time.Second)
+			if tt.remoteLate {
+				remoteAt = clk.Now().Add(time.Second)
+			}
+			backend.feed = []TaskSummary{{ID: "r1", Device: "other", Title: "Deploy", Status: string(models.TaskStatusCompleted), UpdatedAt: remoteAt}}
+			if err := y.Sync(context.Background()); err != nil {
+				t.Fatalf("Sync failed: %v", err)
+			}
+
+			task, _ := s.GetTask(tasks[0].ID)
+			if task.Status != tt.want {
+				t.Errorf("Expected status %s, got %s", tt.want, task.Status)
+			}
+			st, _ := y.Status()
+			if len(st.Conflicts) != 1 || st.Conflicts[0].Kept != tt.kept {
+				t.Errorf("Expected one conflict keeping %s, got %+v", tt.kept, st.Conflicts)
+			}
+		})
+	}
+}
+
+func TestSyncNotLoggedIn(t *testing.T) {
+	s, y, backend, _ := setup(t, Config{Token: func() (string, error) { return "", nil }})
+	s.CreateTask("Anything", "")
+
+	if err := y.Sync(context.Background()); err != ErrNotLoggedIn {
+		t.Fatalf("Expected ErrNotLoggedIn, got %v", err)
+	}
+	if len(backend.pushes) != 0 {
+		t.Error("Expected nothing pushed while logged out")
+	}
+	st, _ := y.Status()
+	if st.LastError != ErrNotLoggedIn.Error() {
+		t.Errorf("Expected the error in the status, got %q", st.LastError)
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	for _, p := range []string{"", PolicyNewest, PolicyLocal, PolicyRemote} {
+		if err := CheckPolicy(p); err != nil {
+			t.Errorf("CheckPolicy(%q) failed: %v", p, err)
+		}
+	}
+	if err := CheckPolicy("mine"); err == nil {
+		t.Error("Expected an unknown policy rejected")
+	}
+}
+
+func TestSyncEncrypted(t *testing.T) {
+	keys := &Keys{}
+	keys.Rotate()
+	s, y, backend, clk := setup(t, Config{Team: "core", Memory: true, Keys: func() (*Keys, error) { return keys, nil }})
+
+	task, _ := s.CreateTaskWithOptions("Rotate prod credentials", "Vault path secret/prod", store.TaskOptions{Labels: []string{"ops"}})
+	s.AddMemory("", "The prod password lives in vault", "ops")
+	sealed, _ := keys.Seal("Review incident notes", Bind("l1", "title"))
+	backend.feed = []TaskSummary{{ID: "r1", LocalID: "l1", Device: "other", Title: sealed, Status: string(models.TaskStatusPending)}}
+	clk.Advance(time.Second)
+
+	if err := y.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	push := backend.lastPush()
+	for _, v := range []string{push.Tasks[0].Title, push.Tasks[0].Description, push.Tasks[0].Labels[0], push.Memory[0].Summary, push.Memory[0].Tags} {
+		if !Sealed(v) {
+			t.Errorf("Expected content sealed, got %q", v)
+		}
+	}
+	if push.Tasks[0].Status != string(models.TaskStatusPending) {
+		t.Errorf("Expected the status in clear, got %q", push.Tasks[0].Status)
+	}
+	tasks, _ := s.ListTasks("")
+	found := false
+	for _, tk := range tasks {
+		found = found || tk.Title == "Review incident notes"
+	}
+	if !found {
+		t.Errorf("Expected the pulled task decrypted, got %+v", tasks)
+	}
+
+	// After a rotation everything is pushed again under the new key
+	clk.Advance(time.Second)
+	current, _ := keys.Rotate()
+	if err := y.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	push = backend.lastPush()
+	resealed := false
+	for _, tk := range push.Tasks {
+		if tk.LocalID == task.ID {
+			resealed = strings.HasPrefix(tk.Title, sealedPrefix+current+":")
+		}
+	}
+	if !resealed {
+		t.Errorf("Expected the task pushed again under key %s, got %+v", current, push.Tasks)
+	}
+	if st, _ := y.Status(); !st.Encrypted || st.KeyID != current {
+		t.Errorf("Unexpected status: %+v", st)
+	}
+}
+
+func TestSyncSealedWithoutKeys(t *testing.T) {
+	_, y, backend, _ := setup(t, Config{Team: "core"})
+	keys := &Keys{}
+	keys.Rotate()
+	sealed, _ := keys.Seal("Secret plans", Bind("l1", "title"))
+	backend.feed = []TaskSummary{{ID: "r1", Device: "other", Title: sealed, Status: string(models.TaskStatusPending)}}
+
+	if err := y.Sync(context.Background()); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey, got %v", err)
+	}
+}
+
+func TestSyncEncryptedRejectsTampering(t *testing.T) {
+	keys := &Keys{}
+	keys.Rotate()
+	s, y, backend, _ := setup(t, Config{Team: "core", Keys: func() (*Keys, error) { return keys, nil }, PlaintextDevices: []string{"intern"}})
+
+	// Plaintext from a device not known to sync unencrypted is refused,
+	// from one that is it is taken as is
+	backend.feed = []TaskSummary{
+		{ID: "r1", LocalID: "l1", Device: "other", Title: "Injected by the backend", Status: string(models.TaskStatusPending)},
+		{ID: "r2", LocalID: "l2", Device: "intern", Title: "Tidy the docs", Status: string(models.TaskStatusPending)},
+	}
+	if err := y.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	tasks, _ := s.ListTasks("")
+	if len(tasks) != 1 || tasks[0].Title != "Tidy the docs" {
+		t.Errorf("Expected only the allowed plaintext task pulled, got %+v", tasks)
+	}
+	st, _ := y.Status()
+	if st.Rejected != 1 || len(st.PlaintextDevices) != 1 {
+		t.Errorf("Expected one rejected task in the status, got %+v", st)
+	}
+
+	// A title sealed for another task does not open as this one's
+	sealed, _ := keys.Seal("Review incident notes", Bind("l3", "title"))
+	backend.feed = []TaskSummary{{ID: "r4", LocalID: "l4", Device: "other", Title: sealed, Status: string(models.TaskStatusPending)}}
+	if err := y.Sync(context.Background()); err == nil {
+		t.Error("Expected a swapped title refused")
+	}
+	if tasks, _ := s.ListTasks(""); len(tasks) != 1 {
+		t.Errorf("Expected no task pulled from the swapped title, got %d", len(tasks))
+	}
+}
@@ -0,0 +1,411 @@
+package cloudsync
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// End-to-end encryption seals the content of what is synced (task titles,
+// descriptions and labels, memory summaries and tags) before it leaves the
+// daemon, so the backend stores ciphertext only. IDs, devices, statuses and
+// times stay readable: the backend needs them to link, order and merge.
+//
+// Content is sealed with the sync keys, kept in a key file wrapped twice
+// over: the keys under a random master key, and the master key under the
+// user key and under each recovery code. The user key is derived from a
+// passphrase or kept in the OS keychain. Rotating adds a sync key without
+// touching the master key; changing the passphrase or recovering with a code
+// rewraps the master key without touching the sync keys.
+
+// sealedPrefix marks values sealed with a sync key:
+// "e2e:v1:<key id>:" + base64(nonce || ciphertext). The ciphertext is bound
+// to the record and field it was sealed for (see Bind), so a backend cannot
+// move it to another record or field.
+const sealedPrefix = "e2e:v1:"
+
+// keySize is the length of sync, master and user keys (AES-256).
+const keySize = 32
+
+// DefaultIterations is the PBKDF2-SHA256 work factor for passphrases.
+const DefaultIterations = 600000
+
+// Recovery codes carry 100 random bits, so they need no costly derivation.
+const (
+	recoveryCodes      = 8
+	recoveryIterations = 10000
+)
+
+var (
+	// ErrWrongKey is returned when a key file does not open with the key,
+	// passphrase or recovery code given.
+	ErrWrongKey = errors.New("wrong passphrase, key or recovery code")
+	// ErrUnknownKey is returned for content sealed with a sync key this
+	// device does not have.
+	ErrUnknownKey = errors.New("content sealed with an unknown sync key")
+	// ErrUnsealed is returned for content that is not sealed although this
+	// device has sync keys.
+	ErrUnsealed = errors.New("content not sealed")
+)
+
+// Keys are the sync keys by ID. Content is sealed with Current and opened
+// with whichever key sealed it, so rotating keeps older content readable.
+type Keys struct {
+	Current string            `json:"current"`
+	Keys    map[string][]byte `json:"keys"`
+}
+
+// Rotate adds a new key and makes it current, returning its ID.
+func (k *Keys) Rotate() (string, error) {
+	id := make([]byte, 4)
+	key := make([]byte, keySize)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	if k.Keys == nil {
+		k.Keys = make(map[string][]byte)
+	}
+	k.Current = hex.EncodeToString(id)
+	k.Keys[k.Current] = key
+	return k.Current, nil
+}
+
+// Bind returns the associated data sealing the field of record id binds
+// content to.
+func Bind(id, field string) string {
+	return id + "\x00" + field
+}
+
+// Seal encrypts v with the current key, bound to bound (see Bind). Empty
+// values stay empty.
+func (k *Keys) Seal(v, bound string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	sealed, err := seal(k.Keys[k.Current], []byte(v), []byte(bound))
+	if err != nil {
+		return "", err
+	}
+	return sealedPrefix + k.Current + ":" + sealed, nil
+}
+
+// Open decrypts a value Seal returned for the same bound. Without keys,
+// values that are not sealed are returned as is; with keys they fail with
+// ErrUnsealed, so a backend cannot pass off plaintext of its own.
+func (k *Keys) Open(v, bound string) (string, error) {
+	rest, ok := strings.CutPrefix(v, sealedPrefix)
+	if !ok {
+		if v != "" && k != nil {
+			return "", ErrUnsealed
+		}
+		return v, nil
+	}
+	id, data, _ := strings.Cut(rest, ":")
+	key := k.key(id)
+	if key == nil {
+		return "", fmt.Errorf("%w %s", ErrUnknownKey, id)
+	}
+	plain, err := open(key, data, []byte(bound))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func (k *Keys) key(id string) []byte {
+	if k == nil {
+		return nil
+	}
+	return k.Keys[id]
+}
+
+// Sealed reports whether v was sealed with a sync key.
+func Sealed(v string) bool {
+	return strings.HasPrefix(v, sealedPrefix)
+}
+
+// KDF is how a user key is derived from a passphrase.
+type KDF struct {
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+}
+
+// NewKDF returns a KDF with a fresh salt and the default work factor.
+func NewKDF() (*KDF, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return &KDF{Salt: salt, Iterations: DefaultIterations}, nil
+}
+
+// DeriveKey derives a user key from secret with PBKDF2-HMAC-SHA256.
+func DeriveKey(secret string, kdf KDF) []byte {
+	prf := hmac.New(sha256.New, []byte(secret))
+	var out []byte
+	for block := uint32(1); len(out) < keySize; block++ {
+		prf.Reset()
+		prf.Write(kdf.Salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < kdf.Iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:keySize]
+}
+
+// NewUserKey returns a random user key, for keeping in the keychain.
+func NewUserKey() ([]byte, error) {
+	key := make([]byte, keySize)
+	_, err := rand.Read(key)
+	return key, err
+}
+
+// KeyFile holds the sync keys, wrapped so that only the user key or a
+// recovery code opens them.
+type KeyFile struct {
+	Version int `json:"version"`
+	// KDF derives the user key from the passphrase; nil when the user key
+	// is kept in the keychain.
+	KDF *KDF `json:"kdf,omitempty"`
+	// Master is the master key sealed with the user key.
+	Master string `json:"master"`
+	// Recovery holds the master key sealed with each recovery code.
+	Recovery []Recovery `json:"recovery"`
+	// Keys is the sync keys' JSON sealed with the master key.
+	Keys string `json:"keys"`
+}
+
+// Recovery is the master key sealed with one recovery code.
+type Recovery struct {
+	Salt   []byte `json:"salt"`
+	Master string `json:"master"`
+}
+
+// Unlocked is a key file opened with the user key or a recovery code.
+type Unlocked struct {
+	File   *KeyFile
+	Keys   *Keys
+	master []byte
+}
+
+// NewKeyFile creates a key file with one sync key, sealed with userKey. kdf
+// is how userKey was derived from a passphrase, or nil for a keychain key.
+// It returns the file's recovery codes, which are not stored anywhere.
+func NewKeyFile(userKey []byte, kdf *KDF) (*Unlocked, []string, error) {
+	u := &Unlocked{File: &KeyFile{Version: 1}, Keys: &Keys{}}
+	u.master = make([]byte, keySize)
+	if _, err := rand.Read(u.master); err != nil {
+		return nil, nil, err
+	}
+	if _, err := u.Keys.Rotate(); err != nil {
+		return nil, nil, err
+	}
+	if err := u.saveKeys(); err != nil {
+		return nil, nil, err
+	}
+	if err := u.SetUserKey(userKey, kdf); err != nil {
+		return nil, nil, err
+	}
+	codes, err := u.NewRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	return u, codes, nil
+}
+
+// LoadKeyFile reads the key file at path.
+func LoadKeyFile(path string) (*KeyFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f KeyFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// Save writes the key file through a temporary file.
+func (f *KeyFile) Save(path string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Unlock opens the key file with the user key.
+func (f *KeyFile) Unlock(userKey []byte) (*Unlocked, error) {
+	master, err := open(userKey, f.Master, nil)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return f.unlock(master)
+}
+
+// UnlockRecovery opens the key file with a recovery code. Set a new user
+// key and new recovery codes afterwards; the code stays valid until then.
+func (f *KeyFile) UnlockRecovery(code string) (*Unlocked, error) {
+	code = normalizeCode(code)
+	for _, r := range f.Recovery {
+		master, err := open(DeriveKey(code, KDF{Salt: r.Salt, Iterations: recoveryIterations}), r.Master, nil)
+		if err == nil {
+			return f.unlock(master)
+		}
+	}
+	return nil, ErrWrongKey
+}
+
+func (f *KeyFile) unlock(master []byte) (*Unlocked, error) {
+	data, err := open(master, f.Keys, nil)
+	if err != nil {
+		return nil, fmt.Errorf("open sync keys: %w", err)
+	}
+	var keys Keys
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("parse sync keys: %w", err)
+	}
+	return &Unlocked{File: f, Keys: &keys, master: master}, nil
+}
+
+// Rotate adds a new sync key and makes it current. Content sealed before
+// stays readable with the old keys.
+func (u *Unlocked) Rotate() (string, error) {
+	id, err := u.Keys.Rotate()
+	if err != nil {
+		return "", err
+	}
+	return id, u.saveKeys()
+}
+
+// SetUserKey seals the master key with a new user key, as derived with kdf
+// (nil for a keychain key). The old passphrase or key no longer opens the
+// file.
+func (u *Unlocked) SetUserKey(userKey []byte, kdf *KDF) error {
+	sealed, err := seal(userKey, u.master, nil)
+	if err != nil {
+		return err
+	}
+	u.File.Master, u.File.KDF = sealed, kdf
+	return nil
+}
+
+// NewRecoveryCodes replaces the recovery codes and returns the new ones.
+func (u *Unlocked) NewRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodes)
+	entries := make([]Recovery, recoveryCodes)
+	for i := range codes {
+		raw := make([]byte, 25)
+		salt := make([]byte, 16)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		code := base32.StdEncoding.EncodeToString(raw)[:20]
+		sealed, err := seal(DeriveKey(code, KDF{Salt: salt, Iterations: recoveryIterations}), u.master, nil)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code[0:5] + "-" + code[5:10] + "-" + code[10:15] + "-" + code[15:20]
+		entries[i] = Recovery{Salt: salt, Master: sealed}
+	}
+	u.File.Recovery = entries
+	return codes, nil
+}
+
+func (u *Unlocked) saveKeys() error {
+	data, err := json.Marshal(u.Keys)
+	if err != nil {
+		return err
+	}
+	sealed, err := seal(u.master, data, nil)
+	if err != nil {
+		return err
+	}
+	u.File.Keys = sealed
+	return nil
+}
+
+// normalizeCode accepts recovery codes in any case, with or without dashes
+// and spaces.
+func normalizeCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func seal(key, plaintext, aad []byte) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, aad)), nil
+}
+
+func open(key []byte, value string, aad []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("decode sealed content: %w", err)
+	}
+	n := aead.NonceSize()
+	if len(data) < n {
+		return nil, errors.New("sealed content too short")
+	}
+	plain, err := aead.Open(nil, data[:n], data[n:], aad)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt content (wrong key?): %w", err)
+	}
+	return plain, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", keySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
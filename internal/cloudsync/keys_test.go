@@ -0,0 +1,128 @@
+package cloudsync
+
+import (
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeriveKey(t *testing.T) {
+	// RFC 7914 section 11, PBKDF2-HMAC-SHA256 with one iteration
+	got := hex.EncodeToString(DeriveKey("passwd", KDF{Salt: []byte("salt"), Iterations: 1}))
+	if want := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"; got != want {
+		t.Errorf("DeriveKey = %s, want %s", got, want)
+	}
+}
+
+func TestKeyFile(t *testing.T) {
+	kdf := &KDF{Salt: []byte("0123456789abcdef"), Iterations: 1000}
+	userKey := DeriveKey("correct horse", *kdf)
+	u, codes, err := NewKeyFile(userKey, kdf)
+	if err != nil {
+		t.Fatalf("NewKeyFile failed: %v", err)
+	}
+	if len(codes) != recoveryCodes {
+		t.Fatalf("Expected %d recovery codes, got %d", recoveryCodes, len(codes))
+	}
+	sealed, err := u.Keys.Seal("Rotate the prod database password", Bind("t1", "title"))
+	if err != nil || !Sealed(sealed) || strings.Contains(sealed, "prod") {
+		t.Fatalf("Unexpected sealed value %q: %v", sealed, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "cloud-keys.json")
+	if err := u.File.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	f, err := LoadKeyFile(path)
+	if err != nil {
+		t.Fatalf("LoadKeyFile failed: %v", err)
+	}
+	if _, err := f.Unlock(DeriveKey("wrong horse", *f.KDF)); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected ErrWrongKey for a wrong passphrase, got %v", err)
+	}
+	u, err = f.Unlock(DeriveKey("correct horse", *f.KDF))
+	if err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+
+	// Rotating keeps content sealed with the old key readable
+	old := u.Keys.Current
+	if _, err := u.Rotate(); err != nil || u.Keys.Current == old {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if plain, err := u.Keys.Open(sealed, Bind("t1", "title")); err != nil || plain != "Rotate the prod database password" {
+		t.Errorf("Expected the old content readable, got %q: %v", plain, err)
+	}
+	if v, _ := u.Keys.Seal("x", Bind("t1", "title")); !strings.HasPrefix(v, sealedPrefix+u.Keys.Current+":") {
+		t.Errorf("Expected new content sealed with the new key, got %q", v)
+	}
+
+	// A recovery code opens the file and the new passphrase replaces the old
+	r, err := u.File.UnlockRecovery(strings.ToLower(strings.ReplaceAll(codes[3], "-", " ")))
+	if err != nil {
+		t.Fatalf("UnlockRecovery failed: %v", err)
+	}
+	if len(r.Keys.Keys) != 2 {
+		t.Errorf("Expected both sync keys recovered, got %d", len(r.Keys.Keys))
+	}
+	newKDF := &KDF{Salt: []byte("fedcba9876543210"), Iterations: 1000}
+	if err := r.SetUserKey(DeriveKey("new passphrase", *newKDF), newKDF); err != nil {
+		t.Fatalf("SetUserKey failed: %v", err)
+	}
+	if _, err := r.File.Unlock(userKey); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected the old passphrase rejected, got %v", err)
+	}
+	if _, err := r.File.Unlock(DeriveKey("new passphrase", *newKDF)); err != nil {
+		t.Errorf("Unlock with the new passphrase failed: %v", err)
+	}
+	if _, err := r.NewRecoveryCodes(); err != nil {
+		t.Fatalf("NewRecoveryCodes failed: %v", err)
+	}
+	if _, err := r.File.UnlockRecovery(codes[3]); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected replaced recovery codes rejected, got %v", err)
+	}
+}
+
+func TestKeysOpen(t *testing.T) {
+	var keys *Keys
+	if v, err := keys.Open("plain text", Bind("t1", "title")); err != nil || v != "plain text" {
+		t.Errorf("Expected plaintext passed through, got %q: %v", v, err)
+	}
+	other := &Keys{}
+	other.Rotate()
+	sealed, _ := other.Seal("secret", Bind("t1", "title"))
+	if _, err := keys.Open(sealed, Bind("t1", "title")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey without keys, got %v", err)
+	}
+	mine := &Keys{}
+	mine.Rotate()
+	if _, err := mine.Open(sealed, Bind("t1", "title")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey for another key, got %v", err)
+	}
+}
+
+func TestKeysBound(t *testing.T) {
+	keys := &Keys{}
+	keys.Rotate()
+	sealed, _ := keys.Seal("Rotate prod credentials", Bind("t1", "title"))
+	if plain, err := keys.Open(sealed, Bind("t1", "title")); err != nil || plain != "Rotate prod credentials" {
+		t.Fatalf("Open = %q, %v", plain, err)
+	}
+
+	// Content moved to another record or field does not open
+	for _, bound := range []string{Bind("t2", "title"), Bind("t1", "description"), ""} {
+		if _, err := keys.Open(sealed, bound); err == nil {
+			t.Errorf("Expected content bound elsewhere rejected for %q", bound)
+		}
+	}
+
+	// With keys, plaintext is refused; empty values are not content
+	if _, err := keys.Open("Injected title", Bind("t1", "title")); !errors.Is(err, ErrUnsealed) {
+		t.Errorf("Expected ErrUnsealed for plaintext, got %v", err)
+	}
+	if v, err := keys.Open("", Bind("t1", "description")); err != nil || v != "" {
+		t.Errorf("Expected an empty value passed through, got %q: %v", v, err)
+	}
+}
@@ -0,0 +1,114 @@
+package cloudsync
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxConflicts caps the conflicts kept in the state for `sync status`.
+const maxConflicts = 20
+
+// state is what the syncer remembers between passes, kept as JSON in the
+// data directory so every daemon sharing it reports the same status.
+type state struct {
+	// Device identifies this installation to the backend, which uses it to
+	// tell the tasks it mirrors from the tasks it pulls.
+	Device string `json:"device"`
+	// PushedUntil is when the last push started; tasks and memory changed
+	// since are pushed next.
+	PushedUntil time.Time `json:"pushed_until"`
+	// PullCursor is the backend's position in the team's task feed.
+	PullCursor string `json:"pull_cursor,omitempty"`
+	// KeyID is the sync key content was last pushed under.
+	KeyID string `json:"key_id,omitempty"`
+
+	LastSync  time.Time  `json:"last_sync"`
+	LastError string     `json:"last_error,omitempty"`
+	Pushed    int        `json:"pushed"`
+	Pulled    int        `json:"pulled"`
+	Rejected  int        `json:"rejected,omitempty"` // pulled tasks refused as not sealed
+	Links     []Link     `json:"links,omitempty"`
+	Conflicts []Conflict `json:"conflicts,omitempty"`
+}
+
+// Link ties a local task to its record in the backend.
+type Link struct {
+	TaskID   string `json:"task_id"`
+	RemoteID string `json:"remote_id"`
+	// Status is the status both sides agreed on at the last sync; a side
+	// whose status differs from it has changed since.
+	Status   string    `json:"status"`
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+// Conflict is a task whose status changed on both sides between syncs.
+type Conflict struct {
+	TaskID       string `json:"task_id"`
+	RemoteID     string `json:"remote_id"`
+	LocalStatus  string `json:"local_status"`
+	RemoteStatus string `json:"remote_status"`
+	// Kept is the side whose status won: local or remote.
+	Kept string    `json:"kept"`
+	At   time.Time `json:"at"`
+}
+
+// loadState reads the state at path; a missing file is a fresh state.
+func loadState(path string) (*state, error) {
+	st := &state{}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, st); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// save writes the state through a temporary file so readers never see a
+// partial one.
+func (st *state) save(path string) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (st *state) linkByTask(taskID string) *Link {
+	for i := range st.Links {
+		if st.Links[i].TaskID == taskID {
+			return &st.Links[i]
+		}
+	}
+	return nil
+}
+
+func (st *state) linkByRemote(remoteID string) *Link {
+	for i := range st.Links {
+		if st.Links[i].RemoteID == remoteID {
+			return &st.Links[i]
+		}
+	}
+	return nil
+}
+
+func (st *state) addConflict(c Conflict) {
+	st.Conflicts = append(st.Conflicts, c)
+	if n := len(st.Conflicts); n > maxConflicts {
+		st.Conflicts = st.Conflicts[n-maxConflicts:]
+	}
+}
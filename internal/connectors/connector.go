@@ -1,7 +1,15 @@
 // Package connectors defines the connector interface for Neona.
 package connectors
 
-import "context"
+import (
+	"bytes"
+	"context"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
 
 // ExecResult holds the result of a command execution.
 type ExecResult struct {
@@ -10,6 +18,283 @@ type ExecResult struct {
 	ExitCode int      `json:"exit_code"`
 	Stdout   string   `json:"stdout"`
 	Stderr   string   `json:"stderr"`
+	// Truncated reports whether output past the connector's limit was
+	// dropped.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// DefaultOutputLimit is how many bytes of each output stream connectors
+// keep unless configured otherwise.
+const DefaultOutputLimit = 1 << 20
+
+// LimitedBuffer collects the first Limit bytes written to it and discards
+// the rest, so a verbose command cannot exhaust the daemon's memory. Writes
+// never fail, letting the command run to completion. A Limit of 0 or less
+// keeps everything.
+type LimitedBuffer struct {
+	Limit     int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+// Write implements io.Writer.
+func (b *LimitedBuffer) Write(p []byte) (int, error) {
+	if b.Limit <= 0 {
+		return b.buf.Write(p)
+	}
+	room := b.Limit - b.buf.Len()
+	if len(p) <= room {
+		return b.buf.Write(p)
+	}
+	if !b.truncated {
+		// Stop at a rune boundary; the buffer is full from here on
+		cut := room
+		for cut > 0 && !utf8.RuneStart(p[cut]) {
+			cut--
+		}
+		b.buf.Write(p[:cut])
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+// String returns the collected output.
+func (b *LimitedBuffer) String() string {
+	return b.buf.String()
+}
+
+// Truncated reports whether any output was discarded.
+func (b *LimitedBuffer) Truncated() bool {
+	return b.truncated
+}
+
+type workDirKey struct{}
+
+// WithWorkDir returns a context telling connectors to run commands in dir
+// instead of their default directory.
+func WithWorkDir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, workDirKey{}, dir)
+}
+
+// WorkDirFromContext returns the directory set by WithWorkDir, or "".
+func WorkDirFromContext(ctx context.Context) string {
+	dir, _ := ctx.Value(workDirKey{}).(string)
+	return dir
+}
+
+type envKey struct{}
+
+// WithEnv returns a context telling connectors to set these variables for
+// the command, on top of the connector's base environment.
+func WithEnv(ctx context.Context, env map[string]string) context.Context {
+	return context.WithValue(ctx, envKey{}, env)
+}
+
+// EnvFromContext returns the variables set by WithEnv, or nil.
+func EnvFromContext(ctx context.Context) map[string]string {
+	env, _ := ctx.Value(envKey{}).(map[string]string)
+	return env
+}
+
+// MergeEnv returns base ("KEY=VALUE" entries) with each overrides map
+// applied in order; later values win.
+func MergeEnv(base []string, overrides ...map[string]string) []string {
+	index := make(map[string]int, len(base))
+	env := make([]string, 0, len(base))
+	for _, kv := range base {
+		name, _, _ := strings.Cut(kv, "=")
+		if i, ok := index[name]; ok {
+			env[i] = kv
+			continue
+		}
+		index[name] = len(env)
+		env = append(env, kv)
+	}
+	for _, o := range overrides {
+		names := make([]string, 0, len(o))
+		for name := range o {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			kv := name + "=" + o[name]
+			if i, ok := index[name]; ok {
+				env[i] = kv
+				continue
+			}
+			index[name] = len(env)
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// DefaultEnvInherit lists the daemon variables commands inherit unless a
+// connector is configured otherwise: what programs need to find each other,
+// their caches and temporary directories, and nothing that usually holds a
+// credential. Everything else in the daemon's environment, such as API
+// tokens, is withheld from commands.
+var DefaultEnvInherit = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LANGUAGE", "LC_*", "TERM", "TZ", "TMPDIR",
+	"GOPATH", "GOROOT", "GOCACHE", "GOMODCACHE", "GOFLAGS", "GOTOOLCHAIN",
+	// Windows
+	"SYSTEMROOT", "SYSTEMDRIVE", "WINDIR", "COMSPEC", "PATHEXT", "TEMP", "TMP",
+	"USERPROFILE", "APPDATA", "LOCALAPPDATA", "PROGRAMDATA", "PROGRAMFILES",
+}
+
+// ScrubEnv returns the entries of environ ("KEY=VALUE") whose names match
+// one of the inherit patterns, path.Match globs such as "LC_*". "*" keeps
+// everything. Names are matched case-insensitively on Windows, where the
+// environment is.
+func ScrubEnv(environ, inherit []string) []string {
+	kept := make([]string, 0, len(inherit))
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if runtime.GOOS == "windows" {
+			name = strings.ToUpper(name)
+		}
+		for _, pattern := range inherit {
+			if runtime.GOOS == "windows" {
+				pattern = strings.ToUpper(pattern)
+			}
+			if ok, _ := path.Match(pattern, name); ok {
+				kept = append(kept, kv)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+type sandboxKey struct{}
+
+// WithSandbox returns a context telling connectors which sandbox profile to
+// run the command under, overriding their default.
+func WithSandbox(ctx context.Context, profile string) context.Context {
+	return context.WithValue(ctx, sandboxKey{}, profile)
+}
+
+// SandboxFromContext returns the profile set by WithSandbox, or "".
+func SandboxFromContext(ctx context.Context) string {
+	profile, _ := ctx.Value(sandboxKey{}).(string)
+	return profile
+}
+
+type inputKey struct{}
+
+// Input is what a command reads while it runs.
+type Input struct {
+	// Stdin is fed to the command's standard input, which is then closed.
+	Stdin []byte
+	// PTY runs the command on a pseudo-terminal, for programs that prompt
+	// only when attached to one. Stdin is typed into the terminal and the
+	// terminal's output is returned as stdout. Connectors that cannot
+	// provide a terminal fail the command.
+	PTY bool
+}
+
+// WithInput returns a context telling connectors what the command reads.
+func WithInput(ctx context.Context, in Input) context.Context {
+	return context.WithValue(ctx, inputKey{}, in)
+}
+
+// InputFromContext returns the input set by WithInput; the zero Input means
+// an empty stdin and no terminal.
+func InputFromContext(ctx context.Context) Input {
+	in, _ := ctx.Value(inputKey{}).(Input)
+	return in
+}
+
+// CommandDeniedError is returned for a command a connector's allowlist
+// rejects. Suggestions names the closest allowed commands, nearest first.
+type CommandDeniedError struct {
+	Command     string   `json:"command"`
+	Args        []string `json:"args"`
+	Suggestions []string `json:"suggestions"`
+}
+
+func (e *CommandDeniedError) Error() string {
+	return "command not allowed: " + strings.TrimSpace(e.Command+" "+strings.Join(e.Args, " "))
+}
+
+// Suggester is implemented by connectors that can name the allowed
+// commands closest to a denied one.
+type Suggester interface {
+	// SuggestAllowed returns up to n allowed commands, nearest first.
+	SuggestAllowed(cmd string, args []string, n int) []string
+}
+
+// ArgValidator is implemented by connectors that check a command's
+// arguments against a schema before it is run.
+type ArgValidator interface {
+	// ValidateArgs explains why args are not acceptable for an allowed
+	// command, or returns nil.
+	ValidateArgs(cmd string, args []string) error
+}
+
+// ExecPlan describes how a connector would run a command.
+type ExecPlan struct {
+	// Path is the resolved executable, when the connector can tell.
+	Path    string   `json:"path,omitempty"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Dir     string   `json:"dir,omitempty"`
+	// Env holds the variables set on top of the daemon's environment.
+	Env map[string]string `json:"env,omitempty"`
+	// Sandbox names the sandbox profile the command runs under, and
+	// SandboxArgv the full wrapped command line.
+	Sandbox     string   `json:"sandbox,omitempty"`
+	SandboxArgv []string `json:"sandbox_argv,omitempty"`
+}
+
+// Planner is implemented by connectors that can describe a command's
+// execution without starting it.
+type Planner interface {
+	// Plan applies the same checks and context as Execute and returns
+	// what would run.
+	Plan(ctx context.Context, cmd string, args []string) (*ExecPlan, error)
+}
+
+// Capabilities lists the optional features a connector supports, so a run
+// needing one it lacks can be refused before anything is executed.
+type Capabilities struct {
+	// Streaming means output can be read while the command runs.
+	Streaming bool `json:"streaming"`
+	// Stdin means Input.Stdin is fed to the command.
+	Stdin bool `json:"stdin"`
+	// PTY means Input.PTY is honored.
+	PTY bool `json:"pty"`
+	// WorkDir means the command runs in the directory from WithWorkDir.
+	WorkDir bool `json:"workdir"`
+	// Env means the variables from WithEnv are set for the command.
+	Env bool `json:"env"`
+	// Timeout means the command is stopped once its context is done.
+	Timeout bool `json:"timeout"`
+	// Sandbox means the profile from WithSandbox is applied.
+	Sandbox bool `json:"sandbox"`
+}
+
+// Missing returns the names of the features need asks for that c lacks,
+// e.g. ["stdin", "pty"].
+func (c Capabilities) Missing(need Capabilities) []string {
+	var missing []string
+	for _, f := range []struct {
+		name       string
+		need, have bool
+	}{
+		{"streaming", need.Streaming, c.Streaming},
+		{"stdin", need.Stdin, c.Stdin},
+		{"pty", need.PTY, c.PTY},
+		{"workdir", need.WorkDir, c.WorkDir},
+		{"env", need.Env, c.Env},
+		{"timeout", need.Timeout, c.Timeout},
+		{"sandbox", need.Sandbox, c.Sandbox},
+	} {
+		if f.need && !f.have {
+			missing = append(missing, f.name)
+		}
+	}
+	return missing
 }
 
 // Connector defines the interface for executing commands.
@@ -17,7 +302,13 @@ type Connector interface {
 	// Name returns the connector identifier.
 	Name() string
 
-	// Execute runs a command and returns the result.
+	// Capabilities reports the optional features Execute supports.
+	Capabilities() Capabilities
+
+	// Execute runs a command and returns the result. It runs in the
+	// directory from WorkDirFromContext when one is set, with the variables
+	// from EnvFromContext, under the profile from SandboxFromContext, and
+	// reads the input from InputFromContext.
 	Execute(ctx context.Context, cmd string, args []string) (*ExecResult, error)
 
 	// IsAllowed checks if a command is allowed to execute.
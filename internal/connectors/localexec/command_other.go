@@ -0,0 +1,18 @@
+//go:build !windows
+
+package localexec
+
+import (
+	"context"
+	"os/exec"
+)
+
+// normalizeCommand maps a command to its allowlist name.
+func normalizeCommand(cmd string) string {
+	return cmd
+}
+
+// newCommand builds the process for an allowlisted command.
+func newCommand(ctx context.Context, cmd string, args []string) (*exec.Cmd, error) {
+	return exec.CommandContext(ctx, cmd, args...), nil
+}
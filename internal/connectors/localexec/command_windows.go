@@ -0,0 +1,47 @@
+//go:build windows
+
+package localexec
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// normalizeCommand maps a command to its allowlist name.
+func normalizeCommand(cmd string) string {
+	return normalizeWindowsCommand(cmd)
+}
+
+// newCommand builds the process for an allowlisted command. Batch files
+// run through cmd.exe with cmd-aware quoting and PowerShell scripts with
+// powershell -File, which passes arguments through verbatim; everything
+// else is started directly.
+func newCommand(ctx context.Context, cmd string, args []string) (*exec.Cmd, error) {
+	path, err := exec.LookPath(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".bat", ".cmd":
+		comspec := os.Getenv("ComSpec")
+		if comspec == "" {
+			comspec = `C:\Windows\System32\cmd.exe`
+		}
+		line, err := batchCommandLine(comspec, path, args)
+		if err != nil {
+			return nil, err
+		}
+		c := exec.CommandContext(ctx, comspec)
+		c.SysProcAttr = &syscall.SysProcAttr{CmdLine: line}
+		return c, nil
+	case ".ps1":
+		psArgs := append([]string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", path}, args...)
+		return exec.CommandContext(ctx, "powershell.exe", psArgs...), nil
+	}
+	return exec.CommandContext(ctx, path, args...), nil
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package localexec
+
+import "testing"
+
+func TestIsAllowed_WindowsNames(t *testing.T) {
+	l := New("")
+	for _, cmd := range []string{"git", "git.exe", "GIT.EXE", "Git"} {
+		if !l.IsAllowed(cmd, []string{"status"}) {
+			t.Errorf("IsAllowed(%q, status) = false, want true", cmd)
+		}
+	}
+	if l.IsAllowed(`C:\tmp\git.exe`, []string{"status"}) {
+		t.Error("A path to an executable must not match the allowlist")
+	}
+}
@@ -5,8 +5,9 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
-	"strings"
+	"runtime"
 
 	"github.com/fentz26/neona/internal/connectors"
 )
@@ -19,12 +20,40 @@ var allowedCommands = map[string][]string{
 
 // LocalExec implements the Connector interface for local command execution.
 type LocalExec struct {
-	workDir string
+	workDir     string
+	baseEnv     map[string]string
+	envInherit  []string
+	outputLimit int
+
+	sandbox        string // backend; "" disables sandboxing
+	sandboxProfile string // applied when a run selects none
 }
 
 // New creates a new LocalExec connector.
 func New(workDir string) *LocalExec {
-	return &LocalExec{workDir: workDir}
+	return &LocalExec{workDir: workDir, envInherit: connectors.DefaultEnvInherit, outputLimit: connectors.DefaultOutputLimit}
+}
+
+// SetOutputLimit caps how many bytes of stdout and of stderr are kept per
+// command; 0 or less keeps everything.
+// Must be called before executing commands - not safe for concurrent use.
+func (l *LocalExec) SetOutputLimit(n int) {
+	l.outputLimit = n
+}
+
+// SetBaseEnv sets variables every command gets on top of the daemon's
+// environment. Per-run variables override them.
+// Must be called before executing commands - not safe for concurrent use.
+func (l *LocalExec) SetBaseEnv(env map[string]string) {
+	l.baseEnv = env
+}
+
+// SetEnvInherit sets which of the daemon's variables commands inherit, as
+// glob patterns; see connectors.ScrubEnv. The default is
+// connectors.DefaultEnvInherit.
+// Must be called before executing commands - not safe for concurrent use.
+func (l *LocalExec) SetEnvInherit(patterns []string) {
+	l.envInherit = patterns
 }
 
 // Name returns the connector identifier.
@@ -32,9 +61,22 @@ func (l *LocalExec) Name() string {
 	return "localexec"
 }
 
+// Capabilities reports what Execute supports. PTY mode needs Linux and
+// sandboxing a configured backend.
+func (l *LocalExec) Capabilities() connectors.Capabilities {
+	return connectors.Capabilities{
+		Stdin:   true,
+		PTY:     runtime.GOOS == "linux",
+		WorkDir: true,
+		Env:     true,
+		Timeout: true,
+		Sandbox: l.sandbox != "",
+	}
+}
+
 // IsAllowed checks if a command is in the allowlist.
 func (l *LocalExec) IsAllowed(cmd string, args []string) bool {
-	allowedSubcmds, ok := allowedCommands[cmd]
+	allowedSubcmds, ok := allowedCommands[normalizeCommand(cmd)]
 	if !ok {
 		return false
 	}
@@ -53,22 +95,90 @@ func (l *LocalExec) IsAllowed(cmd string, args []string) bool {
 	return false
 }
 
+// SuggestAllowed returns up to n allowlisted commands ("git status") ranked
+// by edit distance to the command and its subcommand.
+func (l *LocalExec) SuggestAllowed(cmd string, args []string, n int) []string {
+	attempted := normalizeCommand(cmd)
+	if len(args) > 0 {
+		attempted += " " + args[0]
+	}
+
+	var allowed []string
+	for name, subcmds := range allowedCommands {
+		for _, sub := range subcmds {
+			allowed = append(allowed, name+" "+sub)
+		}
+	}
+	return connectors.Nearest(attempted, allowed, n)
+}
+
+// Plan reports how Execute would run a command without starting it.
+func (l *LocalExec) Plan(ctx context.Context, cmd string, args []string) (*connectors.ExecPlan, error) {
+	if !l.IsAllowed(cmd, args) {
+		return nil, l.denied(cmd, args)
+	}
+
+	plan := &connectors.ExecPlan{Command: cmd, Args: args, Dir: l.dir(ctx)}
+	if path, err := exec.LookPath(cmd); err == nil {
+		plan.Path = path
+	}
+	if profile := l.sandboxFor(connectors.SandboxFromContext(ctx)); profile != "" {
+		argv, err := l.sandboxArgv(cmd, args, plan.Dir, profile)
+		if err != nil {
+			return nil, err
+		}
+		plan.Sandbox = profile + " (" + l.sandbox + ")"
+		plan.SandboxArgv = argv
+	}
+	if env := connectors.EnvFromContext(ctx); len(env) > 0 || len(l.baseEnv) > 0 {
+		plan.Env = make(map[string]string, len(l.baseEnv)+len(env))
+		for _, vars := range []map[string]string{l.baseEnv, env} {
+			for name, value := range vars {
+				plan.Env[name] = value
+			}
+		}
+	}
+	return plan, nil
+}
+
 // Execute runs a command if it's in the allowlist.
 func (l *LocalExec) Execute(ctx context.Context, cmd string, args []string) (*connectors.ExecResult, error) {
 	if !l.IsAllowed(cmd, args) {
-		return nil, fmt.Errorf("command not allowed: %s %s", cmd, strings.Join(args, " "))
+		return nil, l.denied(cmd, args)
 	}
 
-	execCmd := exec.CommandContext(ctx, cmd, args...)
-	if l.workDir != "" {
-		execCmd.Dir = l.workDir
+	var execCmd *exec.Cmd
+	if profile := l.sandboxFor(connectors.SandboxFromContext(ctx)); profile != "" {
+		argv, err := l.sandboxArgv(cmd, args, l.dir(ctx), profile)
+		if err != nil {
+			return nil, err
+		}
+		execCmd = exec.CommandContext(ctx, argv[0], argv[1:]...)
+	} else {
+		c, err := newCommand(ctx, cmd, args)
+		if err != nil {
+			return nil, fmt.Errorf("exec error: %w", err)
+		}
+		execCmd = c
 	}
+	execCmd.Dir = l.dir(ctx)
 
-	var stdout, stderr bytes.Buffer
-	execCmd.Stdout = &stdout
-	execCmd.Stderr = &stderr
+	execCmd.Env = connectors.MergeEnv(connectors.ScrubEnv(os.Environ(), l.envInherit), l.baseEnv, connectors.EnvFromContext(ctx))
 
-	err := execCmd.Run()
+	in := connectors.InputFromContext(ctx)
+	stdout := &connectors.LimitedBuffer{Limit: l.outputLimit}
+	stderr := &connectors.LimitedBuffer{Limit: l.outputLimit}
+	var err error
+	if in.PTY {
+		err = runPTY(ctx, execCmd, in.Stdin, stdout)
+	} else {
+		if in.Stdin != nil {
+			execCmd.Stdin = bytes.NewReader(in.Stdin)
+		}
+		execCmd.Stdout = stdout
+		execCmd.Stderr = stderr
+		err = execCmd.Run()
+	}
 
 	exitCode := 0
 	if err != nil {
@@ -80,10 +190,44 @@ func (l *LocalExec) Execute(ctx context.Context, cmd string, args []string) (*co
 	}
 
 	return &connectors.ExecResult{
-		Command:  cmd,
-		Args:     args,
-		ExitCode: exitCode,
-		Stdout:   stdout.String(),
-		Stderr:   stderr.String(),
+		Command:   cmd,
+		Args:      args,
+		ExitCode:  exitCode,
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.Truncated() || stderr.Truncated(),
 	}, nil
 }
+
+// dir returns the directory a command runs in: the context's workdir, else
+// the connector's own ("" is the daemon's working directory).
+func (l *LocalExec) dir(ctx context.Context) string {
+	if dir := connectors.WorkDirFromContext(ctx); dir != "" {
+		return dir
+	}
+	return l.workDir
+}
+
+func (l *LocalExec) denied(cmd string, args []string) error {
+	return &connectors.CommandDeniedError{Command: cmd, Args: args, Suggestions: l.SuggestAllowed(cmd, args, 3)}
+}
+
+// sandboxArgv returns the command line running cmd under a sandbox profile.
+// It fails rather than run the command unconfined.
+func (l *LocalExec) sandboxArgv(cmd string, args []string, dir, profile string) ([]string, error) {
+	p, ok := SandboxProfiles[profile]
+	if !ok {
+		return nil, CheckSandboxProfile(profile)
+	}
+	if l.sandbox == "" {
+		return nil, fmt.Errorf("sandbox profile %q requested but no sandbox backend is configured", profile)
+	}
+	path, err := exec.LookPath(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("exec error: %w", err)
+	}
+	if dir, err = sandboxDir(dir); err != nil {
+		return nil, err
+	}
+	return wrapSandbox(l.sandbox, p, dir, path, args)
+}
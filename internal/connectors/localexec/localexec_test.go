@@ -2,7 +2,14 @@ package localexec
 
 import (
 	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
 	"testing"
+
+	"github.com/fentz26/neona/internal/connectors"
 )
 
 func TestIsAllowed(t *testing.T) {
@@ -59,6 +66,26 @@ func TestExecute_NotAllowed(t *testing.T) {
 	}
 }
 
+func TestExecute_WorkDirFromContext(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	if out, err := exec.Command("git", "init", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+
+	// The default directory is not a repository; the context overrides it
+	l := New(t.TempDir())
+	result, err := l.Execute(connectors.WithWorkDir(context.Background(), repo), "git", []string{"status"})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if result.ExitCode != 0 {
+		t.Errorf("Expected git status of the context workdir, got exit %d: %s%s", result.ExitCode, result.Stdout, result.Stderr)
+	}
+}
+
 func TestName(t *testing.T) {
 	exec := New("")
 	if exec.Name() != "localexec" {
@@ -66,6 +93,26 @@ func TestName(t *testing.T) {
 	}
 }
 
+func TestCapabilities(t *testing.T) {
+	l := New("")
+	caps := l.Capabilities()
+	if !caps.Stdin || !caps.WorkDir || !caps.Env || !caps.Timeout || caps.Streaming {
+		t.Errorf("Unexpected capabilities: %+v", caps)
+	}
+	if caps.PTY != (runtime.GOOS == "linux") {
+		t.Errorf("Expected PTY mode only on Linux, got %v", caps.PTY)
+	}
+	if missing := caps.Missing(connectors.Capabilities{Env: true, Sandbox: true}); len(missing) != 1 || missing[0] != "sandbox" {
+		t.Errorf("Expected sandboxing missing without a backend, got %v", missing)
+	}
+	if err := l.SetSandbox(SandboxBwrap, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !l.Capabilities().Sandbox {
+		t.Error("Expected sandboxing with a backend")
+	}
+}
+
 func joinTestArgs(args []string) string {
 	result := ""
 	for _, a := range args {
@@ -73,3 +120,134 @@ func joinTestArgs(args []string) string {
 	}
 	return result
 }
+
+// allowForTest adds a command to the allowlist for the duration of a test,
+// skipping the test where the command is not installed (e.g. sh on Windows).
+func allowForTest(t *testing.T, cmd string, subcmds ...string) {
+	if _, err := exec.LookPath(cmd); err != nil {
+		t.Skipf("%s not installed", cmd)
+	}
+	allowedCommands[cmd] = subcmds
+	t.Cleanup(func() { delete(allowedCommands, cmd) })
+}
+
+func TestExecute_Stdin(t *testing.T) {
+	allowForTest(t, "cat", "-")
+
+	ctx := connectors.WithInput(context.Background(), connectors.Input{Stdin: []byte("yes\n")})
+	result, err := New("").Execute(ctx, "cat", []string{"-"})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if result.Stdout != "yes\n" {
+		t.Errorf("Stdout = %q, want the stdin bytes", result.Stdout)
+	}
+}
+
+func TestExecute_PTY(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("PTY mode is Linux only")
+	}
+	if _, err := os.Stat("/dev/ptmx"); err != nil {
+		t.Skip("no /dev/ptmx")
+	}
+	allowForTest(t, "sh", "-c")
+
+	// The script only answers when it is attached to a terminal
+	script := `if [ -t 0 ]; then read answer; echo "got $answer"; else echo "no tty"; exit 3; fi`
+	ctx := connectors.WithInput(context.Background(), connectors.Input{Stdin: []byte("y\n"), PTY: true})
+	result, err := New("").Execute(ctx, "sh", []string{"-c", script})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if result.ExitCode != 0 || !strings.Contains(result.Stdout, "got y") {
+		t.Errorf("Unexpected result: exit %d, stdout %q", result.ExitCode, result.Stdout)
+	}
+}
+
+func TestExecute_Env(t *testing.T) {
+	allowForTest(t, "sh", "-c")
+	t.Setenv("NEONA_TEST_INHERITED", "daemon")
+
+	l := New("")
+	l.SetEnvInherit([]string{"PATH", "NEONA_TEST_INHERITED"})
+	l.SetBaseEnv(map[string]string{"NEONA_TEST_BASE": "base", "NEONA_TEST_OVERRIDE": "base"})
+	ctx := connectors.WithEnv(context.Background(), map[string]string{"NEONA_TEST_OVERRIDE": "run"})
+	result, err := l.Execute(ctx, "sh", []string{"-c", `echo "$NEONA_TEST_INHERITED $NEONA_TEST_BASE $NEONA_TEST_OVERRIDE"`})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got := strings.TrimSpace(result.Stdout); got != "daemon base run" {
+		t.Errorf("env = %q, want %q", got, "daemon base run")
+	}
+}
+
+func TestExecute_EnvInherit(t *testing.T) {
+	allowForTest(t, "sh", "-c")
+	t.Setenv("NEONA_TEST_SECRET", "s3cret")
+	t.Setenv("LC_NEONA_TEST", "kept")
+
+	l := New("")
+	result, err := l.Execute(context.Background(), "sh", []string{"-c", `echo "[$NEONA_TEST_SECRET] [$LC_NEONA_TEST]"`})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got := strings.TrimSpace(result.Stdout); got != "[] [kept]" {
+		t.Errorf("env = %q, want the secret withheld and LC_* kept", got)
+	}
+
+	// A variable set for the run gets through whatever the policy
+	ctx := connectors.WithEnv(context.Background(), map[string]string{"NEONA_TEST_SECRET": "run"})
+	if result, _ := l.Execute(ctx, "sh", []string{"-c", `echo "$NEONA_TEST_SECRET"`}); strings.TrimSpace(result.Stdout) != "run" {
+		t.Errorf("Expected the run's variable, got %q", result.Stdout)
+	}
+
+	l.SetEnvInherit([]string{"*"})
+	if result, _ := l.Execute(context.Background(), "sh", []string{"-c", `echo "$NEONA_TEST_SECRET"`}); strings.TrimSpace(result.Stdout) != "s3cret" {
+		t.Errorf("Expected * to pass the environment, got %q", result.Stdout)
+	}
+}
+
+func TestExecute_OutputLimit(t *testing.T) {
+	allowForTest(t, "sh", "-c")
+
+	l := New("")
+	l.SetOutputLimit(10)
+	result, err := l.Execute(context.Background(), "sh", []string{"-c", "echo 0123456789abcdef"})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if result.Stdout != "0123456789" || !result.Truncated {
+		t.Errorf("Stdout = %q, Truncated = %v; want the first 10 bytes and truncated", result.Stdout, result.Truncated)
+	}
+}
+
+func TestExecute_DeniedSuggestions(t *testing.T) {
+	_, err := New("").Execute(context.Background(), "git", []string{"stauts"})
+
+	var denied *connectors.CommandDeniedError
+	if !errors.As(err, &denied) {
+		t.Fatalf("Expected a CommandDeniedError, got %v", err)
+	}
+	if len(denied.Suggestions) != 3 || denied.Suggestions[0] != "git status" {
+		t.Errorf("Suggestions = %v, want git status first", denied.Suggestions)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	l := New("/srv/default")
+	l.SetBaseEnv(map[string]string{"GOFLAGS": "-mod=mod"})
+
+	ctx := connectors.WithEnv(connectors.WithWorkDir(context.Background(), "/srv/task"), map[string]string{"CI": "1"})
+	plan, err := l.Plan(ctx, "go", []string{"test", "./..."})
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if plan.Dir != "/srv/task" || plan.Env["GOFLAGS"] != "-mod=mod" || plan.Env["CI"] != "1" {
+		t.Errorf("Unexpected plan: %+v", plan)
+	}
+
+	if _, err := l.Plan(context.Background(), "rm", []string{"-rf", "/"}); err == nil {
+		t.Error("Expected Plan to reject a command outside the allowlist")
+	}
+}
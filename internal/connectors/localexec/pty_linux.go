@@ -0,0 +1,119 @@
+//go:build linux
+
+package localexec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// runPTY runs cmd with a new pseudo-terminal as its controlling terminal
+// and standard streams. stdin is typed into the terminal; everything the
+// command writes to it is copied to out with CRLF turned back into LF.
+func runPTY(ctx context.Context, cmd *exec.Cmd, stdin []byte, out io.Writer) error {
+	master, slave, err := openPTY()
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	err = cmd.Start()
+	slave.Close()
+	if err != nil {
+		return err
+	}
+
+	go master.Write(stdin)
+
+	// Reads fail with EIO once the command and its children close the terminal
+	done := make(chan struct{})
+	lf := &lfWriter{w: out}
+	go func() {
+		io.Copy(lf, master)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		master.Close()
+		<-done
+	}
+
+	err = cmd.Wait()
+	lf.flush()
+	return err
+}
+
+// lfWriter turns the terminal's CRLF line endings into LF. A CR ending one
+// write is held back until the next shows whether an LF follows it.
+type lfWriter struct {
+	w  io.Writer
+	cr bool
+}
+
+func (l *lfWriter) Write(p []byte) (int, error) {
+	b := p
+	if l.cr {
+		l.cr = false
+		if len(b) == 0 || b[0] != '\n' {
+			l.w.Write([]byte{'\r'})
+		}
+	}
+	if len(b) > 0 && b[len(b)-1] == '\r' {
+		l.cr = true
+		b = b[:len(b)-1]
+	}
+	if _, err := l.w.Write(bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// flush writes a CR still held back.
+func (l *lfWriter) flush() {
+	if l.cr {
+		l.w.Write([]byte{'\r'})
+		l.cr = false
+	}
+}
+
+// openPTY allocates a pseudo-terminal pair from /dev/ptmx.
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open pty: %w", err)
+	}
+
+	var unlock int32
+	if err := ioctl(master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("unlock pty: %w", err)
+	}
+	var n uint32
+	if err := ioctl(master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("pty number: %w", err)
+	}
+
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("open pty slave: %w", err)
+	}
+	return master, slave, nil
+}
+
+func ioctl(fd, req, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
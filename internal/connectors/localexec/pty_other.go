@@ -0,0 +1,15 @@
+//go:build !linux
+
+package localexec
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+)
+
+// runPTY is only implemented on Linux.
+func runPTY(ctx context.Context, cmd *exec.Cmd, stdin []byte, out io.Writer) error {
+	return errors.New("interactive PTY mode is not supported on this platform")
+}
@@ -0,0 +1,169 @@
+package localexec
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Sandbox backends that can wrap a command.
+const (
+	SandboxBwrap       = "bwrap"        // bubblewrap, Linux
+	SandboxFirejail    = "firejail"     // Linux
+	SandboxSandboxExec = "sandbox-exec" // macOS
+)
+
+// SandboxProfile restricts what a sandboxed command can touch. The file
+// system is read-only apart from the command's workdir, a private /tmp and
+// Writable.
+type SandboxProfile struct {
+	// Network allows network access.
+	Network bool
+	// Writable lists further paths the command may write to.
+	Writable []string
+}
+
+// SandboxProfiles are the profiles runs can select by name.
+var SandboxProfiles = map[string]SandboxProfile{
+	"strict":  {},
+	"network": {Network: true},
+}
+
+// SandboxNone selects no sandbox, overriding the connector's default.
+const SandboxNone = "none"
+
+// DetectSandbox returns the first sandbox backend installed on this
+// platform, or "" when there is none.
+func DetectSandbox() string {
+	var candidates []string
+	switch runtime.GOOS {
+	case "linux":
+		candidates = []string{SandboxBwrap, SandboxFirejail}
+	case "darwin":
+		candidates = []string{SandboxSandboxExec}
+	}
+	for _, backend := range candidates {
+		if _, err := exec.LookPath(backend); err == nil {
+			return backend
+		}
+	}
+	return ""
+}
+
+// SetSandbox configures sandboxing. backend is one of the Sandbox*
+// constants, "auto" to use DetectSandbox (failing when nothing is
+// installed), or "" to disable sandboxing.
+// defaultProfile, when not empty or SandboxNone, is applied to runs that do
+// not select a profile themselves.
+// Must be called before executing commands - not safe for concurrent use.
+func (l *LocalExec) SetSandbox(backend, defaultProfile string) error {
+	if backend == "auto" {
+		if backend = DetectSandbox(); backend == "" {
+			return fmt.Errorf("no sandbox backend found on %s", runtime.GOOS)
+		}
+	}
+	switch backend {
+	case "", SandboxBwrap, SandboxFirejail, SandboxSandboxExec:
+	default:
+		return fmt.Errorf("unknown sandbox backend %q", backend)
+	}
+	if err := CheckSandboxProfile(defaultProfile); err != nil {
+		return err
+	}
+	if defaultProfile != "" && defaultProfile != SandboxNone && backend == "" {
+		return fmt.Errorf("sandbox profile %q needs a sandbox backend, and none is available", defaultProfile)
+	}
+	l.sandbox = backend
+	l.sandboxProfile = defaultProfile
+	return nil
+}
+
+// SandboxBackend returns the configured sandbox backend, or "".
+func (l *LocalExec) SandboxBackend() string {
+	return l.sandbox
+}
+
+// CheckSandboxProfile reports whether name selects a known profile; "" and
+// SandboxNone are accepted.
+func CheckSandboxProfile(name string) error {
+	if name == "" || name == SandboxNone {
+		return nil
+	}
+	if _, ok := SandboxProfiles[name]; !ok {
+		names := make([]string, 0, len(SandboxProfiles))
+		for n := range SandboxProfiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown sandbox profile %q (have %s, %s)", name, strings.Join(names, ", "), SandboxNone)
+	}
+	return nil
+}
+
+// sandboxFor returns the profile name applied to a run, "" for none.
+func (l *LocalExec) sandboxFor(requested string) string {
+	if requested == "" {
+		requested = l.sandboxProfile
+	}
+	if requested == SandboxNone {
+		return ""
+	}
+	return requested
+}
+
+// wrapSandbox returns the argv that runs path with args inside the sandbox
+// backend under profile, with dir writable.
+func wrapSandbox(backend string, profile SandboxProfile, dir, path string, args []string) ([]string, error) {
+	switch backend {
+	case SandboxBwrap:
+		argv := []string{SandboxBwrap, "--ro-bind", "/", "/", "--dev", "/dev", "--proc", "/proc", "--tmpfs", "/tmp"}
+		for _, p := range append([]string{dir}, profile.Writable...) {
+			argv = append(argv, "--bind", p, p)
+		}
+		if !profile.Network {
+			argv = append(argv, "--unshare-net")
+		}
+		argv = append(argv, "--die-with-parent", "--new-session", "--chdir", dir, "--", path)
+		return append(argv, args...), nil
+
+	case SandboxFirejail:
+		argv := []string{SandboxFirejail, "--quiet", "--noprofile", "--read-only=/", "--private-tmp"}
+		for _, p := range append([]string{dir}, profile.Writable...) {
+			argv = append(argv, "--read-write="+p)
+		}
+		if !profile.Network {
+			argv = append(argv, "--net=none")
+		}
+		argv = append(argv, "--", path)
+		return append(argv, args...), nil
+
+	case SandboxSandboxExec:
+		return append([]string{SandboxSandboxExec, "-p", seatbeltProfile(profile, dir), path}, args...), nil
+	}
+	return nil, fmt.Errorf("unknown sandbox backend %q", backend)
+}
+
+// seatbeltProfile renders profile in the SBPL language sandbox-exec reads.
+func seatbeltProfile(profile SandboxProfile, dir string) string {
+	var b strings.Builder
+	b.WriteString("(version 1)\n(allow default)\n(deny file-write*)\n(allow file-write*")
+	for _, p := range append([]string{dir, "/private/tmp", "/private/var/folders"}, profile.Writable...) {
+		fmt.Fprintf(&b, " (subpath %q)", p)
+	}
+	b.WriteString(" (literal \"/dev/null\") (literal \"/dev/tty\"))\n")
+	if !profile.Network {
+		b.WriteString("(deny network*)\n")
+	}
+	return b.String()
+}
+
+// sandboxDir returns the absolute directory a sandboxed command runs in.
+func sandboxDir(dir string) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	return os.Getwd()
+}
@@ -0,0 +1,58 @@
+package localexec
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/fentz26/neona/internal/connectors"
+)
+
+func TestWrapSandbox(t *testing.T) {
+	strict := SandboxProfiles["strict"]
+	network := SandboxProfile{Network: true, Writable: []string{"/cache"}}
+
+	tests := []struct {
+		backend string
+		profile SandboxProfile
+		want    string
+	}{
+		{SandboxBwrap, strict, "bwrap --ro-bind / / --dev /dev --proc /proc --tmpfs /tmp --bind /work /work --unshare-net --die-with-parent --new-session --chdir /work -- /usr/bin/go test ./..."},
+		{SandboxBwrap, network, "bwrap --ro-bind / / --dev /dev --proc /proc --tmpfs /tmp --bind /work /work --bind /cache /cache --die-with-parent --new-session --chdir /work -- /usr/bin/go test ./..."},
+		{SandboxFirejail, strict, "firejail --quiet --noprofile --read-only=/ --private-tmp --read-write=/work --net=none -- /usr/bin/go test ./..."},
+	}
+	for _, tt := range tests {
+		argv, err := wrapSandbox(tt.backend, tt.profile, "/work", "/usr/bin/go", []string{"test", "./..."})
+		if err != nil {
+			t.Fatalf("wrapSandbox(%s): %v", tt.backend, err)
+		}
+		if got := strings.Join(argv, " "); got != tt.want {
+			t.Errorf("wrapSandbox(%s) =\n%s\nwant\n%s", tt.backend, got, tt.want)
+		}
+	}
+
+	argv, err := wrapSandbox(SandboxSandboxExec, strict, "/work", "/usr/bin/go", []string{"test"})
+	if err != nil {
+		t.Fatalf("wrapSandbox(sandbox-exec): %v", err)
+	}
+	if argv[0] != "sandbox-exec" || argv[1] != "-p" || argv[3] != "/usr/bin/go" {
+		t.Errorf("Unexpected sandbox-exec argv: %q", argv)
+	}
+	if !strings.Contains(argv[2], `(subpath "/work")`) || !strings.Contains(argv[2], "(deny network*)") {
+		t.Errorf("Unexpected seatbelt profile:\n%s", argv[2])
+	}
+}
+
+func TestExecute_SandboxWithoutBackend(t *testing.T) {
+	ctx := connectors.WithSandbox(context.Background(), "strict")
+	if _, err := New("").Execute(ctx, "git", []string{"status"}); err == nil || !strings.Contains(err.Error(), "no sandbox backend") {
+		t.Errorf("Expected a run requesting a sandbox to fail without a backend, got %v", err)
+	}
+
+	if err := New("").SetSandbox("", "strict"); err == nil {
+		t.Error("Expected a default profile without a backend to be refused")
+	}
+	if err := New("").SetSandbox(SandboxBwrap, "paranoid"); err == nil {
+		t.Error("Expected an unknown profile to be refused")
+	}
+}
@@ -0,0 +1,91 @@
+package localexec
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// windowsExecExts are the executable extensions stripped from command
+// names on Windows, so "git.exe" and "GIT" match the "git" allowlist entry.
+var windowsExecExts = []string{".exe", ".com", ".cmd", ".bat", ".ps1"}
+
+// normalizeWindowsCommand returns the allowlist name for a Windows command:
+// lower-cased, without an executable extension. Names carrying a directory
+// are returned unchanged so that a path never matches an allowlist entry;
+// the executable is always found through PATH.
+func normalizeWindowsCommand(cmd string) string {
+	if strings.ContainsAny(cmd, `/\:`) {
+		return cmd
+	}
+	name := strings.ToLower(cmd)
+	ext := filepath.Ext(name)
+	for _, e := range windowsExecExts {
+		if ext == e {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+// quoteWindowsArg quotes an argument for a Windows command line so that
+// CommandLineToArgvW, which most programs use to split it, yields s.
+func quoteWindowsArg(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\v\"") {
+		return s
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	slashes := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			slashes++
+			b.WriteByte(c)
+		case '"':
+			// Backslashes before a quote are doubled, then the quote escaped
+			b.WriteString(strings.Repeat(`\`, slashes+1))
+			b.WriteByte(c)
+			slashes = 0
+		default:
+			slashes = 0
+			b.WriteByte(c)
+		}
+	}
+	// Backslashes before the closing quote are doubled
+	b.WriteString(strings.Repeat(`\`, slashes))
+	b.WriteByte('"')
+	return b.String()
+}
+
+// errUnsafeBatchArg rejects arguments cmd.exe would expand or split
+// whatever the quoting.
+var errUnsafeBatchArg = errors.New("argument contains characters cmd.exe cannot pass to a batch file safely (%, !, CR or LF)")
+
+// quoteCmdArg quotes an argument for a batch file run through cmd.exe.
+// Every argument is enclosed in double quotes, inside which cmd.exe treats
+// &, |, <, > and ^ literally, and embedded quotes are doubled. Variable
+// expansion (%VAR%, !VAR!) and line breaks cannot be escaped, so those
+// arguments are refused.
+func quoteCmdArg(s string) (string, error) {
+	if strings.ContainsAny(s, "%!\r\n") {
+		return "", errUnsafeBatchArg
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`, nil
+}
+
+// batchCommandLine builds the command line for running script with args
+// via `cmd.exe /d /s /c`. /s makes cmd.exe strip only the outer quotes.
+func batchCommandLine(comspec, script string, args []string) (string, error) {
+	parts := []string{quoteWindowsArg(comspec), "/d", "/s", "/c"}
+	inner := []string{`"` + script + `"`}
+	for _, arg := range args {
+		q, err := quoteCmdArg(arg)
+		if err != nil {
+			return "", err
+		}
+		inner = append(inner, q)
+	}
+	return strings.Join(parts, " ") + ` "` + strings.Join(inner, " ") + `"`, nil
+}
@@ -0,0 +1,56 @@
+package localexec
+
+import "testing"
+
+func TestNormalizeWindowsCommand(t *testing.T) {
+	tests := map[string]string{
+		"git":              "git",
+		"GIT.EXE":          "git",
+		"go.exe":           "go",
+		"npm.cmd":          "npm",
+		"build.ps1":        "build",
+		"tool.v2":          "tool.v2",
+		`C:\tools\git.exe`: `C:\tools\git.exe`,
+		`.\git.exe`:        `.\git.exe`,
+		"subdir/git.exe":   "subdir/git.exe",
+	}
+	for in, want := range tests {
+		if got := normalizeWindowsCommand(in); got != want {
+			t.Errorf("normalizeWindowsCommand(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestQuoteWindowsArg(t *testing.T) {
+	tests := map[string]string{
+		"":           `""`,
+		"plain":      "plain",
+		"two words":  `"two words"`,
+		`say "hi"`:   `"say \"hi\""`,
+		`C:\dir\`:    `C:\dir\`,
+		`C:\my dir\`: `"C:\my dir\\"`,
+		`a\"b`:       `"a\\\"b"`,
+	}
+	for in, want := range tests {
+		if got := quoteWindowsArg(in); got != want {
+			t.Errorf("quoteWindowsArg(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestBatchCommandLine(t *testing.T) {
+	line, err := batchCommandLine(`C:\Windows\System32\cmd.exe`, `C:\tools\npm.cmd`, []string{"run", "a&b", `say "hi"`})
+	if err != nil {
+		t.Fatalf("batchCommandLine: %v", err)
+	}
+	want := `C:\Windows\System32\cmd.exe /d /s /c ""C:\tools\npm.cmd" "run" "a&b" "say ""hi""""`
+	if line != want {
+		t.Errorf("batchCommandLine =\n%s\nwant\n%s", line, want)
+	}
+
+	for _, arg := range []string{"%PATH%", "!x!", "a\nb"} {
+		if _, err := batchCommandLine("cmd.exe", "npm.cmd", []string{arg}); err == nil {
+			t.Errorf("Expected %q to be refused", arg)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Discover starts every plugin executable in dir, in name order, with the
+// daemon variables matching envInherit. A plugin that fails to start, or
+// announces a name already taken by an earlier plugin or listed in
+// reserved, is logged and skipped. The caller must Close the returned
+// plugins.
+func Discover(dir string, envInherit []string, reserved ...string) ([]*Plugin, error) {
+	if err := checkPerms(dir, true); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read plugins: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	taken := make(map[string]bool)
+	for _, name := range reserved {
+		taken[name] = true
+	}
+	var plugins []*Plugin
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if strings.HasPrefix(e.Name(), ".") || !isExecutable(path) {
+			continue
+		}
+		if err := checkPerms(path, false); err != nil {
+			log.Printf("Skipping plugin: %v", err)
+			continue
+		}
+		p := New(path)
+		p.envInherit = envInherit
+		if err := p.Start(); err != nil {
+			log.Printf("Skipping plugin: %v", err)
+			continue
+		}
+		if taken[p.Name()] {
+			log.Printf("Skipping plugin %s: connector name %q is already in use", path, p.Name())
+			p.Close()
+			continue
+		}
+		taken[p.Name()] = true
+		plugins = append(plugins, p)
+	}
+	return plugins, nil
+}
+
+// isExecutable reports whether path looks like a program: any file with an
+// execute bit, or an .exe on Windows.
+func isExecutable(path string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Ext(path), ".exe")
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0o111 != 0
+}
+
+// checkPerms vets a plugin or the plugin directory: it must be a regular
+// file (or the directory), not a symlink, and not writable by group or
+// others.
+func checkPerms(path string, dir bool) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return fmt.Errorf("%s is a symlink", path)
+	case dir && !info.IsDir():
+		return fmt.Errorf("%s is not a directory", path)
+	case !dir && !info.Mode().IsRegular():
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o022 != 0 {
+		return fmt.Errorf("%s is writable by group or others", path)
+	}
+	return nil
+}
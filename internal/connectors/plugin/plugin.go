@@ -0,0 +1,429 @@
+// Package plugin runs connectors as separate executables, so third parties
+// can add connectors without recompiling Neona.
+//
+// A plugin is a long-lived process speaking newline-delimited JSON over
+// stdio. The daemon writes one request per line to the plugin's stdin and
+// reads one response per line from its stdout; stderr goes to the daemon
+// log. Requests are sent one at a time:
+//
+//	{"id":1,"method":"name","params":{"protocol":1}}
+//	{"id":1,"result":{"name":"k8s","protocol":1}}
+//
+//	{"id":2,"method":"is_allowed","params":{"command":"kubectl","args":["get","pods"]}}
+//	{"id":2,"result":{"allowed":true}}
+//
+//	{"id":3,"method":"execute","params":{"command":"kubectl","args":["get","pods"],"workdir":"/srv/app","env":{"CI":"1"},"stdin":"eWVzCg=="}}
+//	{"id":3,"result":{"exit_code":0,"stdout":"...","stderr":""}}
+//
+// A failed request answers with {"id":N,"error":"message"} instead of a
+// result. stdin is base64, as encoding/json encodes byte slices. Before
+// stopping a plugin the daemon sends {"id":N,"method":"shutdown"} and closes
+// its stdin; plugins should exit promptly.
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/fentz26/neona/internal/connectors"
+)
+
+// ProtocolVersion is the protocol version the daemon speaks.
+const ProtocolVersion = 1
+
+const (
+	// maxMessage bounds a single response line.
+	maxMessage = 64 << 20
+	// queryTimeout bounds name and is_allowed requests.
+	queryTimeout = 10 * time.Second
+	// stopTimeout is how long Close waits for a plugin to exit before
+	// killing it.
+	stopTimeout = 5 * time.Second
+	// maxBackoff caps the delay between restarts of a crashing plugin.
+	maxBackoff = time.Minute
+)
+
+// nameRE is the form plugin names must take, matching script names.
+var nameRE = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+type request struct {
+	ID     int64       `json:"id"`
+	Method string      `json:"method"`
+	Params interface{} `json:"params,omitempty"`
+}
+
+type response struct {
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type nameParams struct {
+	Protocol int `json:"protocol"`
+}
+
+type nameResult struct {
+	Name     string `json:"name"`
+	Protocol int    `json:"protocol"`
+}
+
+type isAllowedParams struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+type isAllowedResult struct {
+	Allowed bool `json:"allowed"`
+}
+
+type executeParams struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	WorkDir string            `json:"workdir,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Stdin   []byte            `json:"stdin,omitempty"`
+}
+
+type executeResult struct {
+	ExitCode int    `json:"exit_code"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+}
+
+// process is one running instance of a plugin.
+type process struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stdout    *os.File
+	responses chan response
+	exited    chan struct{}
+	done      chan struct{} // closed once the process is dropped
+	once      sync.Once
+}
+
+// release stops the reader from delivering further responses.
+func (p *process) release() {
+	p.once.Do(func() { close(p.done) })
+}
+
+// kill stops the process without waiting for it to finish cleanly.
+func (p *process) kill() {
+	p.release()
+	p.cmd.Process.Kill()
+	p.stdout.Close()
+	<-p.exited
+}
+
+// Plugin is a connector backed by a plugin executable. The process is
+// started by Start and restarted on the next request if it dies, backing
+// off while it keeps failing.
+type Plugin struct {
+	path        string
+	name        string
+	envInherit  []string
+	outputLimit int
+
+	mu       sync.Mutex
+	proc     *process
+	nextID   int64
+	failures int
+	retryAt  time.Time
+}
+
+// New creates a plugin connector for the executable at path. Call Start
+// before using it.
+func New(path string) *Plugin {
+	return &Plugin{path: path, envInherit: connectors.DefaultEnvInherit, outputLimit: connectors.DefaultOutputLimit}
+}
+
+// SetEnvInherit sets which of the daemon's variables the plugin process
+// inherits, as glob patterns; see connectors.ScrubEnv. It applies from the
+// next time the process starts. The default is
+// connectors.DefaultEnvInherit.
+func (p *Plugin) SetEnvInherit(patterns []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.envInherit = patterns
+}
+
+// SetOutputLimit caps how many bytes of stdout and of stderr are kept per
+// run; 0 or less keeps everything.
+// Must be called before executing commands - not safe for concurrent use.
+func (p *Plugin) SetOutputLimit(n int) {
+	p.outputLimit = n
+}
+
+// Path returns the plugin executable.
+func (p *Plugin) Path() string {
+	return p.path
+}
+
+// Name returns the connector name the plugin announced.
+func (p *Plugin) Name() string {
+	return p.name
+}
+
+// Capabilities reports what Execute supports. Plugins get stdin, workdir
+// and env in the execute request, and are killed when the run's context is
+// done; they cannot run on a terminal or in a sandbox.
+func (p *Plugin) Capabilities() connectors.Capabilities {
+	return connectors.Capabilities{Stdin: true, WorkDir: true, Env: true, Timeout: true}
+}
+
+// Start launches the plugin and asks for its name.
+func (p *Plugin) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	var res nameResult
+	if err := p.call(ctx, "name", nameParams{Protocol: ProtocolVersion}, &res); err != nil {
+		p.stop()
+		return err
+	}
+	if res.Protocol != ProtocolVersion {
+		p.stop()
+		return fmt.Errorf("plugin %s speaks protocol %d, want %d", p.path, res.Protocol, ProtocolVersion)
+	}
+	if !nameRE.MatchString(res.Name) {
+		p.stop()
+		return fmt.Errorf("plugin %s: invalid name %q", p.path, res.Name)
+	}
+	p.name = res.Name
+	return nil
+}
+
+// Close asks the plugin to shut down, killing it if it does not exit in
+// time. A later request starts it again.
+func (p *Plugin) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stop()
+	return nil
+}
+
+// stop ends the running process, if any. Callers hold p.mu.
+func (p *Plugin) stop() {
+	proc := p.proc
+	if proc == nil {
+		return
+	}
+	p.proc = nil
+	p.nextID++
+	writeRequest(proc.stdin, request{ID: p.nextID, Method: "shutdown"})
+	proc.stdin.Close()
+	select {
+	case <-proc.exited:
+		proc.release()
+		proc.stdout.Close()
+	case <-time.After(stopTimeout):
+		log.Printf("Plugin %s did not exit, killing it", p.path)
+		proc.kill()
+	}
+}
+
+// IsAllowed asks the plugin whether it may run a command. Commands are
+// refused while the plugin is unavailable.
+func (p *Plugin) IsAllowed(cmd string, args []string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	var res isAllowedResult
+	if err := p.call(ctx, "is_allowed", isAllowedParams{Command: cmd, Args: args}, &res); err != nil {
+		log.Printf("Plugin %s: is_allowed: %v", p.name, err)
+		return false
+	}
+	return res.Allowed
+}
+
+// Execute has the plugin run a command. Cancelling ctx kills the plugin
+// process; it is restarted for the next request.
+func (p *Plugin) Execute(ctx context.Context, cmd string, args []string) (*connectors.ExecResult, error) {
+	if connectors.InputFromContext(ctx).PTY {
+		return nil, fmt.Errorf("plugin %s does not support PTY mode", p.name)
+	}
+	// "none" is how a task label opts out of sandboxing
+	if profile := connectors.SandboxFromContext(ctx); profile != "" && profile != "none" {
+		return nil, fmt.Errorf("sandbox profile %q requested, but plugin %s cannot sandbox", profile, p.name)
+	}
+	if !p.IsAllowed(cmd, args) {
+		return nil, &connectors.CommandDeniedError{Command: cmd, Args: args, Suggestions: []string{}}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	params := executeParams{
+		Command: cmd,
+		Args:    args,
+		WorkDir: connectors.WorkDirFromContext(ctx),
+		Env:     connectors.EnvFromContext(ctx),
+		Stdin:   connectors.InputFromContext(ctx).Stdin,
+	}
+	var res executeResult
+	if err := p.call(ctx, "execute", params, &res); err != nil {
+		return nil, err
+	}
+
+	stdout := &connectors.LimitedBuffer{Limit: p.outputLimit}
+	stderr := &connectors.LimitedBuffer{Limit: p.outputLimit}
+	io.WriteString(stdout, res.Stdout)
+	io.WriteString(stderr, res.Stderr)
+	return &connectors.ExecResult{
+		Command:   cmd,
+		Args:      args,
+		ExitCode:  res.ExitCode,
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.Truncated() || stderr.Truncated(),
+	}, nil
+}
+
+// call sends one request and decodes its result, starting the process
+// first if needed. Callers hold p.mu.
+func (p *Plugin) call(ctx context.Context, method string, params, result interface{}) error {
+	if p.proc == nil {
+		if err := p.launch(); err != nil {
+			return err
+		}
+	}
+	proc := p.proc
+
+	p.nextID++
+	id := p.nextID
+	if err := writeRequest(proc.stdin, request{ID: id, Method: method, Params: params}); err != nil {
+		p.crashed(proc)
+		return fmt.Errorf("plugin %s: %w", p.path, err)
+	}
+
+	for {
+		select {
+		case resp, ok := <-proc.responses:
+			if !ok {
+				p.crashed(proc)
+				return fmt.Errorf("plugin %s exited during %s", p.path, method)
+			}
+			if resp.ID != id {
+				continue // answer to a request that was abandoned
+			}
+			p.failures = 0
+			if resp.Error != "" {
+				return fmt.Errorf("plugin %s: %s", p.path, resp.Error)
+			}
+			if err := json.Unmarshal(resp.Result, result); err != nil {
+				return fmt.Errorf("plugin %s: bad %s result: %w", p.path, method, err)
+			}
+			return nil
+		case <-ctx.Done():
+			// The protocol has no way to abandon a request
+			p.proc = nil
+			proc.kill()
+			return ctx.Err()
+		}
+	}
+}
+
+// launch starts the plugin process unless it is backing off after
+// crashes. Callers hold p.mu.
+func (p *Plugin) launch() error {
+	if wait := time.Until(p.retryAt); wait > 0 {
+		return fmt.Errorf("plugin %s unavailable after %d failures, retrying in %s", p.path, p.failures, wait.Round(time.Second))
+	}
+
+	cmd := exec.Command(p.path)
+	cmd.Env = append(connectors.ScrubEnv(os.Environ(), p.envInherit), fmt.Sprintf("NEONA_PLUGIN_PROTOCOL=%d", ProtocolVersion))
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	// A pipe of our own, so Wait does not close it under the reader
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = w
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		p.backoff()
+		return fmt.Errorf("start plugin %s: %w", p.path, err)
+	}
+	w.Close()
+
+	proc := &process{cmd: cmd, stdin: stdin, stdout: r, responses: make(chan response), exited: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		close(proc.exited)
+	}()
+	go readResponses(proc, p.path)
+	p.proc = proc
+	return nil
+}
+
+// crashed drops a process that stopped answering. Callers hold p.mu.
+func (p *Plugin) crashed(proc *process) {
+	if p.proc == proc {
+		p.proc = nil
+	}
+	proc.kill()
+	p.backoff()
+	log.Printf("Plugin %s stopped unexpectedly (%d in a row); restarting on the next request", p.path, p.failures)
+}
+
+// backoff delays the next start exponentially with each failure.
+func (p *Plugin) backoff() {
+	p.failures++
+	delay := time.Second << (p.failures - 1)
+	if delay > maxBackoff || delay <= 0 {
+		delay = maxBackoff
+	}
+	if p.failures == 1 {
+		delay = 0 // restart a one-off crash straight away
+	}
+	p.retryAt = time.Now().Add(delay)
+}
+
+func writeRequest(w io.Writer, req request) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// readResponses decodes response lines until the plugin's stdout closes or
+// the process is dropped.
+func readResponses(proc *process, path string) {
+	defer close(proc.responses)
+	scanner := bufio.NewScanner(proc.stdout)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxMessage)
+	for scanner.Scan() {
+		var resp response
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			log.Printf("Plugin %s: ignoring malformed response: %v", path, err)
+			continue
+		}
+		select {
+		case proc.responses <- resp:
+		case <-proc.done:
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, os.ErrClosed) {
+		log.Printf("Plugin %s: %v", path, err)
+	}
+}
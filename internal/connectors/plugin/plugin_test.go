@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/connectors"
+)
+
+// TestMain turns the test binary into a plugin when the wrapper written by
+// writePlugin runs it.
+func TestMain(m *testing.M) {
+	if name := os.Getenv("NEONA_TEST_PLUGIN"); name != "" {
+		servePlugin(name)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// servePlugin answers requests like a third-party plugin: it allows echo,
+// crash, hang and printenv, and echoes arguments, workdir and stdin back.
+func servePlugin(name string) {
+	scanner := bufio.NewScanner(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	for scanner.Scan() {
+		var req struct {
+			ID     int64           `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		json.Unmarshal(scanner.Bytes(), &req)
+		var result interface{}
+		switch req.Method {
+		case "name":
+			result = nameResult{Name: name, Protocol: ProtocolVersion}
+		case "is_allowed":
+			var p isAllowedParams
+			json.Unmarshal(req.Params, &p)
+			result = isAllowedResult{Allowed: p.Command == "echo" || p.Command == "crash" || p.Command == "hang" || p.Command == "printenv"}
+		case "execute":
+			var p executeParams
+			json.Unmarshal(req.Params, &p)
+			switch p.Command {
+			case "crash":
+				os.Exit(3)
+			case "hang":
+				time.Sleep(time.Hour)
+			case "printenv":
+				result = executeResult{Stdout: os.Getenv(p.Args[0])}
+				enc.Encode(map[string]interface{}{"id": req.ID, "result": result})
+				continue
+			}
+			result = executeResult{Stdout: strings.Join(p.Args, " ") + "|" + p.WorkDir + "|" + string(p.Stdin)}
+		case "shutdown":
+			return
+		}
+		enc.Encode(map[string]interface{}{"id": req.ID, "result": result})
+	}
+}
+
+// writePlugin installs a wrapper in dir that runs the test binary as a
+// plugin announcing name.
+func writePlugin(t *testing.T, dir, file, name string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("test plugins are shell wrappers")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, file)
+	script := "#!/bin/sh\nNEONA_TEST_PLUGIN=" + name + " exec '" + exe + "'\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func startForTest(t *testing.T) *Plugin {
+	p := New(writePlugin(t, t.TempDir(), "fake", "fake"))
+	if err := p.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestExecute(t *testing.T) {
+	p := startForTest(t)
+	if p.Name() != "fake" {
+		t.Errorf("Name = %q, want fake", p.Name())
+	}
+
+	if !p.IsAllowed("echo", nil) || p.IsAllowed("rm", []string{"-rf", "/"}) {
+		t.Error("Expected the plugin's allowlist to decide")
+	}
+
+	ctx := connectors.WithWorkDir(context.Background(), "/srv/app")
+	ctx = connectors.WithInput(ctx, connectors.Input{Stdin: []byte("yes")})
+	result, err := p.Execute(ctx, "echo", []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if result.Stdout != "a b|/srv/app|yes" {
+		t.Errorf("Stdout = %q", result.Stdout)
+	}
+
+	_, err = p.Execute(context.Background(), "rm", nil)
+	var denied *connectors.CommandDeniedError
+	if !errors.As(err, &denied) {
+		t.Errorf("Expected a CommandDeniedError, got %v", err)
+	}
+}
+
+func TestEnvInherit(t *testing.T) {
+	t.Setenv("NEONA_TEST_SECRET", "s3cret")
+	p := startForTest(t)
+
+	result, err := p.Execute(context.Background(), "printenv", []string{"NEONA_TEST_SECRET"})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if result.Stdout != "" {
+		t.Errorf("Expected the secret withheld from the plugin, got %q", result.Stdout)
+	}
+
+	// The plugin picks the policy up when it restarts
+	p.SetEnvInherit([]string{"NEONA_TEST_*"})
+	p.Close()
+	if result, _ := p.Execute(context.Background(), "printenv", []string{"NEONA_TEST_SECRET"}); result == nil || result.Stdout != "s3cret" {
+		t.Errorf("Expected the inherited variable, got %+v", result)
+	}
+}
+
+func TestRestartAfterCrash(t *testing.T) {
+	p := startForTest(t)
+
+	if _, err := p.Execute(context.Background(), "crash", nil); err == nil {
+		t.Fatal("Expected an error when the plugin exits mid-request")
+	}
+	// The first crash is restarted straight away
+	if _, err := p.Execute(context.Background(), "echo", []string{"again"}); err != nil {
+		t.Fatalf("Execute after crash: %v", err)
+	}
+}
+
+func TestExecuteCancel(t *testing.T) {
+	p := startForTest(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := p.Execute(ctx, "hang", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to stop the run, got %v", err)
+	}
+	if _, err := p.Execute(context.Background(), "echo", []string{"again"}); err != nil {
+		t.Fatalf("Execute after cancel: %v", err)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "a-fake", "fake")
+	writePlugin(t, dir, "b-dup", "fake")         // name already taken
+	writePlugin(t, dir, "c-reserved", "scripts") // reserved name
+	os.WriteFile(filepath.Join(dir, "README"), []byte("not a plugin"), 0o644)
+	os.Chmod(writePlugin(t, dir, "d-loose", "loose"), 0o777)
+
+	plugins, err := Discover(dir, connectors.DefaultEnvInherit, "localexec", "scripts")
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	defer func() {
+		for _, p := range plugins {
+			p.Close()
+		}
+	}()
+	if len(plugins) != 1 || plugins[0].Name() != "fake" || filepath.Base(plugins[0].Path()) != "a-fake" {
+		t.Errorf("Expected only a-fake, got %d plugins", len(plugins))
+	}
+}
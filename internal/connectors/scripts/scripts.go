@@ -0,0 +1,342 @@
+// Package scripts provides a connector that runs only named scripts from a
+// vetted directory, each with a schema for its arguments.
+//
+// A script is an executable file <name> next to a schema <name>.yaml:
+//
+//	description: Rebuild the search index for one shard
+//	args:
+//	  - name: shard
+//	    type: int
+//	    required: true
+//	  - name: mode
+//	    enum: [full, incremental]
+//
+// Arguments are positional, in schema order. Scripts without a schema are
+// not exposed.
+package scripts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/fentz26/neona/internal/connectors"
+)
+
+// Arg describes one positional script argument.
+type Arg struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Type is string (the default), int or bool.
+	Type     string   `yaml:"type,omitempty" json:"type,omitempty"`
+	Required bool     `yaml:"required,omitempty" json:"required,omitempty"`
+	Enum     []string `yaml:"enum,omitempty" json:"enum,omitempty"`
+	// Pattern is a regular expression the whole value must match.
+	Pattern string `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+}
+
+// Script is a runnable script and its argument schema.
+type Script struct {
+	Name        string `yaml:"-" json:"name"`
+	Description string `yaml:"description" json:"description,omitempty"`
+	Args        []Arg  `yaml:"args" json:"args"`
+
+	path string
+}
+
+// nameRE restricts script names to ones that are safe as file names and
+// cannot be mistaken for options.
+var nameRE = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// Library is the scripts connector.
+type Library struct {
+	dir         string
+	envInherit  []string
+	outputLimit int
+}
+
+// New creates a scripts connector for dir.
+func New(dir string) *Library {
+	return &Library{dir: dir, envInherit: connectors.DefaultEnvInherit, outputLimit: connectors.DefaultOutputLimit}
+}
+
+// SetOutputLimit caps how many bytes of stdout and of stderr are kept per
+// script run; 0 or less keeps everything.
+// Must be called before executing commands - not safe for concurrent use.
+func (l *Library) SetOutputLimit(n int) {
+	l.outputLimit = n
+}
+
+// SetEnvInherit sets which of the daemon's variables scripts inherit, as
+// glob patterns; see connectors.ScrubEnv. The default is
+// connectors.DefaultEnvInherit.
+// Must be called before executing commands - not safe for concurrent use.
+func (l *Library) SetEnvInherit(patterns []string) {
+	l.envInherit = patterns
+}
+
+// Name returns the connector identifier.
+func (l *Library) Name() string {
+	return "scripts"
+}
+
+// Capabilities reports what Execute supports: scripts cannot run on a
+// terminal or in a sandbox.
+func (l *Library) Capabilities() connectors.Capabilities {
+	return connectors.Capabilities{Stdin: true, WorkDir: true, Env: true, Timeout: true}
+}
+
+// Dir returns the script directory.
+func (l *Library) Dir() string {
+	return l.dir
+}
+
+// List returns the scripts in the directory, by name. The directory is read
+// on every call so scripts can be added without restarting the daemon.
+// Scripts that fail vetting are skipped.
+func (l *Library) List() ([]Script, error) {
+	if err := checkPerms(l.dir, true); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read scripts: %w", err)
+	}
+
+	var scripts []Script
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".yaml")
+		if !ok {
+			continue
+		}
+		if s, err := l.load(name); err == nil {
+			scripts = append(scripts, *s)
+		}
+	}
+	sort.Slice(scripts, func(i, j int) bool { return scripts[i].Name < scripts[j].Name })
+	return scripts, nil
+}
+
+// Lookup returns a vetted script by name.
+func (l *Library) Lookup(name string) (*Script, error) {
+	if err := checkPerms(l.dir, true); err != nil {
+		return nil, err
+	}
+	return l.load(name)
+}
+
+func (l *Library) load(name string) (*Script, error) {
+	if !nameRE.MatchString(name) {
+		return nil, fmt.Errorf("invalid script name %q", name)
+	}
+	path := filepath.Join(l.dir, name)
+	if err := checkPerms(path, false); err != nil {
+		return nil, err
+	}
+	schemaPath := path + ".yaml"
+	if err := checkPerms(schemaPath, false); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Script{}
+	if err := yaml.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("%s: %w", schemaPath, err)
+	}
+	for _, a := range s.Args {
+		switch a.Type {
+		case "", "string", "int", "bool":
+		default:
+			return nil, fmt.Errorf("%s: argument %s has unknown type %q", schemaPath, a.Name, a.Type)
+		}
+		if a.Pattern != "" {
+			if _, err := regexp.Compile(a.Pattern); err != nil {
+				return nil, fmt.Errorf("%s: argument %s: %w", schemaPath, a.Name, err)
+			}
+		}
+	}
+	s.Name, s.path = name, path
+	return s, nil
+}
+
+// checkPerms vets a script, schema or the script directory: it must be a
+// regular file (or the directory), not a symlink, and not writable by
+// group or others.
+func checkPerms(path string, dir bool) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return fmt.Errorf("%s is a symlink", path)
+	case dir && !info.IsDir():
+		return fmt.Errorf("%s is not a directory", path)
+	case !dir && !info.Mode().IsRegular():
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o022 != 0 {
+		return fmt.Errorf("%s is writable by group or others", path)
+	}
+	return nil
+}
+
+// Validate checks args against the script's schema.
+func (s *Script) Validate(args []string) error {
+	if len(args) > len(s.Args) {
+		return fmt.Errorf("%s takes at most %d arguments, got %d", s.Name, len(s.Args), len(args))
+	}
+	for i, a := range s.Args {
+		if i >= len(args) {
+			if a.Required {
+				return fmt.Errorf("%s: missing required argument %s", s.Name, a.Name)
+			}
+			continue
+		}
+		if err := a.check(args[i]); err != nil {
+			return fmt.Errorf("%s: argument %s: %w", s.Name, a.Name, err)
+		}
+	}
+	return nil
+}
+
+func (a Arg) check(v string) error {
+	switch a.Type {
+	case "int":
+		if _, err := strconv.Atoi(v); err != nil {
+			return fmt.Errorf("%q is not an integer", v)
+		}
+	case "bool":
+		if _, err := strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("%q is not a boolean", v)
+		}
+	}
+	if len(a.Enum) > 0 {
+		found := false
+		for _, e := range a.Enum {
+			found = found || e == v
+		}
+		if !found {
+			return fmt.Errorf("%q is not one of %s", v, strings.Join(a.Enum, ", "))
+		}
+	}
+	if a.Pattern != "" {
+		if ok, _ := regexp.MatchString(`^(?:`+a.Pattern+`)$`, v); !ok {
+			return fmt.Errorf("%q does not match %s", v, a.Pattern)
+		}
+	}
+	return nil
+}
+
+// IsAllowed reports whether cmd names a vetted script. Arguments are
+// checked by ValidateArgs.
+func (l *Library) IsAllowed(cmd string, args []string) bool {
+	_, err := l.Lookup(cmd)
+	return err == nil
+}
+
+// ValidateArgs checks args against the script's schema.
+func (l *Library) ValidateArgs(cmd string, args []string) error {
+	s, err := l.Lookup(cmd)
+	if err != nil {
+		return err
+	}
+	return s.Validate(args)
+}
+
+// SuggestAllowed returns up to n script names closest to cmd.
+func (l *Library) SuggestAllowed(cmd string, args []string, n int) []string {
+	scripts, err := l.List()
+	if err != nil {
+		return nil
+	}
+	names := make([]string, len(scripts))
+	for i, s := range scripts {
+		names[i] = s.Name
+	}
+	return connectors.Nearest(cmd, names, n)
+}
+
+// check returns the script for a run, or why it may not run.
+func (l *Library) check(ctx context.Context, cmd string, args []string) (*Script, error) {
+	s, err := l.Lookup(cmd)
+	if err != nil {
+		return nil, &connectors.CommandDeniedError{Command: cmd, Args: args, Suggestions: l.SuggestAllowed(cmd, args, 3)}
+	}
+	if err := s.Validate(args); err != nil {
+		return nil, err
+	}
+	// "none" is how a task label opts out of sandboxing
+	if profile := connectors.SandboxFromContext(ctx); profile != "" && profile != "none" {
+		return nil, fmt.Errorf("sandbox profile %q requested, but the scripts connector cannot sandbox", profile)
+	}
+	if connectors.InputFromContext(ctx).PTY {
+		return nil, errors.New("the scripts connector does not support PTY mode")
+	}
+	return s, nil
+}
+
+// Plan reports how Execute would run a script without starting it.
+func (l *Library) Plan(ctx context.Context, cmd string, args []string) (*connectors.ExecPlan, error) {
+	s, err := l.check(ctx, cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	return &connectors.ExecPlan{
+		Path:    s.path,
+		Command: cmd,
+		Args:    args,
+		Dir:     connectors.WorkDirFromContext(ctx),
+		Env:     connectors.EnvFromContext(ctx),
+	}, nil
+}
+
+// Execute runs a vetted script with schema-checked arguments.
+func (l *Library) Execute(ctx context.Context, cmd string, args []string) (*connectors.ExecResult, error) {
+	s, err := l.check(ctx, cmd, args)
+	if err != nil {
+		return nil, err
+	}
+
+	execCmd := exec.CommandContext(ctx, s.path, args...)
+	execCmd.Dir = connectors.WorkDirFromContext(ctx)
+	execCmd.Env = connectors.MergeEnv(connectors.ScrubEnv(os.Environ(), l.envInherit), connectors.EnvFromContext(ctx))
+	if in := connectors.InputFromContext(ctx); in.Stdin != nil {
+		execCmd.Stdin = bytes.NewReader(in.Stdin)
+	}
+	stdout := &connectors.LimitedBuffer{Limit: l.outputLimit}
+	stderr := &connectors.LimitedBuffer{Limit: l.outputLimit}
+	execCmd.Stdout, execCmd.Stderr = stdout, stderr
+
+	exitCode := 0
+	if err := execCmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("exec error: %w", err)
+		}
+		exitCode = exitErr.ExitCode()
+	}
+
+	return &connectors.ExecResult{
+		Command:   cmd,
+		Args:      args,
+		ExitCode:  exitCode,
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.Truncated() || stderr.Truncated(),
+	}, nil
+}
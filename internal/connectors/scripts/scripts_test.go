@@ -0,0 +1,155 @@
+package scripts
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/fentz26/neona/internal/connectors"
+)
+
+// writeScript adds a script and its schema to dir.
+func writeScript(t *testing.T, dir, name, body, schema string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".yaml"), []byte(schema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestLibrary(t *testing.T) *Library {
+	if runtime.GOOS == "windows" {
+		t.Skip("test scripts are shell scripts")
+	}
+	dir := t.TempDir()
+	writeScript(t, dir, "rebuild-index", `echo "shard $1 ${2:-incremental}"`, `
+description: Rebuild the search index for one shard
+args:
+  - name: shard
+    type: int
+    required: true
+  - name: mode
+    enum: [full, incremental]
+`)
+	writeScript(t, dir, "rotate-keys", `echo rotated`, "description: Rotate API keys\n")
+	return New(dir)
+}
+
+func TestList(t *testing.T) {
+	l := newTestLibrary(t)
+	// Executables without a schema are not exposed
+	os.WriteFile(filepath.Join(l.Dir(), "helper"), []byte("#!/bin/sh\n"), 0o755)
+
+	list, err := l.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 2 || list[0].Name != "rebuild-index" || list[1].Name != "rotate-keys" {
+		t.Fatalf("Unexpected scripts: %+v", list)
+	}
+	if len(list[0].Args) != 2 || list[0].Args[0].Type != "int" {
+		t.Errorf("Unexpected schema: %+v", list[0].Args)
+	}
+}
+
+func TestValidateArgs(t *testing.T) {
+	l := newTestLibrary(t)
+
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"3"}, true},
+		{[]string{"3", "full"}, true},
+		{[]string{}, false},                     // shard is required
+		{[]string{"three"}, false},              // not an int
+		{[]string{"3", "partial"}, false},       // not in the enum
+		{[]string{"3", "full", "extra"}, false}, // too many
+	}
+	for _, tt := range tests {
+		err := l.ValidateArgs("rebuild-index", tt.args)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateArgs(%v) = %v, want ok=%v", tt.args, err, tt.ok)
+		}
+	}
+}
+
+func TestIsAllowed_Vetting(t *testing.T) {
+	l := newTestLibrary(t)
+
+	if !l.IsAllowed("rotate-keys", nil) {
+		t.Error("Expected rotate-keys to be allowed")
+	}
+	for _, name := range []string{"missing", "../rotate-keys", "-rotate-keys", "rotate-keys.yaml"} {
+		if l.IsAllowed(name, nil) {
+			t.Errorf("Expected %q to be refused", name)
+		}
+	}
+
+	// A script others can modify is not vetted
+	os.Chmod(filepath.Join(l.Dir(), "rotate-keys"), 0o757)
+	if l.IsAllowed("rotate-keys", nil) {
+		t.Error("Expected a world-writable script to be refused")
+	}
+
+	// Nor is a symlink to a script outside the directory
+	outside := t.TempDir()
+	writeScript(t, outside, "evil", "echo evil", "")
+	os.Symlink(filepath.Join(outside, "evil"), filepath.Join(l.Dir(), "evil"))
+	os.WriteFile(filepath.Join(l.Dir(), "evil.yaml"), nil, 0o644)
+	if l.IsAllowed("evil", nil) {
+		t.Error("Expected a symlinked script to be refused")
+	}
+}
+
+func TestExecute(t *testing.T) {
+	l := newTestLibrary(t)
+
+	result, err := l.Execute(context.Background(), "rebuild-index", []string{"7", "full"})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if strings.TrimSpace(result.Stdout) != "shard 7 full" || result.ExitCode != 0 {
+		t.Errorf("Unexpected result: exit %d, stdout %q", result.ExitCode, result.Stdout)
+	}
+
+	if _, err := l.Execute(context.Background(), "rebuild-index", []string{"seven"}); err == nil {
+		t.Error("Expected Execute to check arguments")
+	}
+
+	_, err = l.Execute(context.Background(), "rebuild-indx", nil)
+	var denied *connectors.CommandDeniedError
+	if !errors.As(err, &denied) || len(denied.Suggestions) == 0 || denied.Suggestions[0] != "rebuild-index" {
+		t.Errorf("Expected a denial suggesting rebuild-index, got %v", err)
+	}
+
+	ctx := connectors.WithSandbox(context.Background(), "strict")
+	if _, err := l.Execute(ctx, "rotate-keys", nil); err == nil {
+		t.Error("Expected a sandboxed run to be refused")
+	}
+}
+
+func TestExecute_EnvInherit(t *testing.T) {
+	l := newTestLibrary(t)
+	writeScript(t, l.dir, "show-secret", `echo "[$NEONA_TEST_SECRET]"`, "description: Print the secret\n")
+	t.Setenv("NEONA_TEST_SECRET", "s3cret")
+
+	result, err := l.Execute(context.Background(), "show-secret", nil)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got := strings.TrimSpace(result.Stdout); got != "[]" {
+		t.Errorf("Expected the secret withheld, got %q", got)
+	}
+
+	l.SetEnvInherit([]string{"*"})
+	if result, _ := l.Execute(context.Background(), "show-secret", nil); strings.TrimSpace(result.Stdout) != "[s3cret]" {
+		t.Errorf("Expected * to pass the environment, got %q", result.Stdout)
+	}
+}
@@ -0,0 +1,49 @@
+package connectors
+
+import "sort"
+
+// Nearest returns up to n of candidates ranked by edit distance to target,
+// closest first; ties are broken alphabetically.
+func Nearest(target string, candidates []string, n int) []string {
+	type ranked struct {
+		name     string
+		distance int
+	}
+	all := make([]ranked, len(candidates))
+	for i, c := range candidates {
+		all[i] = ranked{c, editDistance(target, c)}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].distance != all[j].distance {
+			return all[i].distance < all[j].distance
+		}
+		return all[i].name < all[j].name
+	})
+
+	nearest := make([]string, 0, n)
+	for i := 0; i < len(all) && i < n; i++ {
+		nearest = append(nearest, all[i].name)
+	}
+	return nearest
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,131 @@
+package controlplane
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// ActorHeader optionally names the operator behind an admin request.
+const ActorHeader = "X-Neona-Actor"
+
+// SetAdminToken enables the /admin/ endpoints, which require
+// "Authorization: Bearer <token>". With no token they are disabled.
+// Must be called before Start() - not safe for concurrent use.
+func (s *Server) SetAdminToken(token string) {
+	s.adminToken = token
+}
+
+// requireAdmin rejects requests that do not carry the admin bearer token.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" {
+			writeError(w, "admin API disabled", http.StatusForbidden)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="neona-admin"`)
+			writeError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleAdmin handles /admin/tasks/{id}/force-release
+func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/admin/"), "/")
+
+	switch {
+	case len(parts) == 3 && parts[0] == "tasks" && parts[1] != "" && parts[2] == "force-release":
+		if r.Method != http.MethodPost {
+			writeError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if taskID, ok := s.resolveTaskID(w, parts[1]); ok {
+			s.forceReleaseTask(w, r, taskID)
+		}
+	default:
+		writeError(w, "not found", http.StatusNotFound)
+	}
+}
+
+type forceReleaseRequest struct {
+	Actor  string `json:"actor"`
+	Reason string `json:"reason"`
+}
+
+func (s *Server) forceReleaseTask(w http.ResponseWriter, r *http.Request, taskID string) {
+	var req forceReleaseRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Actor == "" {
+		req.Actor = r.Header.Get(ActorHeader)
+	}
+	if req.Actor == "" {
+		req.Actor = "admin"
+	}
+
+	result, err := s.service.ForceReleaseTask(taskID, req.Actor, req.Reason)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case ErrNotFound:
+			status = http.StatusNotFound
+		case ErrNoLease:
+			status = http.StatusConflict
+		}
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleEvents handles GET /events?holder=&since=&limit=
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	var since time.Time
+	if v := q.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			writeError(w, "invalid since (want RFC3339)", http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	// Authenticated callers only see their own holders' events
+	if PrincipalFromContext(r.Context()) != "" && !requireHolder(w, r, q.Get("holder")) {
+		return
+	}
+
+	events, err := s.service.ListEvents(q.Get("holder"), since, limit)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if events == nil {
+		events = []models.Event{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
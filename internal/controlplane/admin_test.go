@@ -0,0 +1,93 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+func TestForceRelease_RequiresAdminToken(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/tasks/x/force-release", nil)
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 with admin API disabled, got %d", w.Code)
+	}
+
+	s.SetAdminToken("secret")
+	req = httptest.NewRequest(http.MethodPost, "/admin/tasks/x/force-release", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with wrong token, got %d", w.Code)
+	}
+}
+
+func TestForceRelease_BreaksClaimAndNotifiesHolder(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	s.SetAdminToken("secret")
+
+	task, err := s.service.CreateTask("Stuck", "", store.TaskOptions{})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	if _, err := s.service.ClaimTask(task.ID, "agent-1", 300); err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/tasks/"+task.ID+"/force-release",
+		strings.NewReader(`{"reason":"agent hung"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set(ActorHeader, "ops@example")
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result ForceReleaseResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if result.PreviousHolder != "agent-1" || result.Actor != "ops@example" {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	got, _ := s.store.GetTask(task.ID)
+	if got.Status != models.TaskStatusPending || got.ClaimedBy != "" {
+		t.Errorf("Expected task reset to pending, got status=%s claimed_by=%q", got.Status, got.ClaimedBy)
+	}
+	if lease, _ := s.store.GetActiveLease(task.ID); lease != nil {
+		t.Error("Expected lease to be deleted")
+	}
+
+	// The previous holder can discover the forced release
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events?holder=agent-1", nil))
+	var events []models.Event
+	if err := json.NewDecoder(w.Body).Decode(&events); err != nil {
+		t.Fatalf("Failed to decode events: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != EventTaskForceReleased || events[0].TaskID != task.ID {
+		t.Errorf("Expected one force-release event, got %+v", events)
+	}
+
+	// A second force-release has nothing to break
+	req = httptest.NewRequest(http.MethodPost, "/admin/tasks/"+task.ID+"/force-release", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for unclaimed task, got %d", w.Code)
+	}
+}
@@ -0,0 +1,74 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes of API error responses. Clients branch on the code rather
+// than the message, which is meant for people and may change.
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeTooLarge         = "too_large"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal"
+	// CodeCommandDenied is a 403 for a command outside the allowlist.
+	CodeCommandDenied = "command_denied"
+	// CodeAmbiguousID is a 409 for a short task ID shared by several tasks.
+	CodeAmbiguousID = "ambiguous_id"
+	// CodeClaimLimit is a 409 for a claim by a holder already holding as
+	// many tasks as the daemon's claim config allows.
+	CodeClaimLimit = "claim_limit"
+	// CodeIdempotencyMismatch is a 422 for an Idempotency-Key already used
+	// with a different request body.
+	CodeIdempotencyMismatch = "idempotency_mismatch"
+)
+
+// ErrorResponse is the body of every 4xx and 5xx response.
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// errorCode returns the code for an error response with status.
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	default:
+		return CodeInternal
+	}
+}
+
+// writeError replies with msg as a JSON ErrorResponse. It stands in for
+// http.Error, so headers set beforehand, such as Retry-After, are kept.
+func writeError(w http.ResponseWriter, msg string, status int) {
+	writeErrorCode(w, msg, errorCode(status), status)
+}
+
+// writeErrorCode is writeError with a code more specific than the status's.
+func writeErrorCode(w http.ResponseWriter, msg, code string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: msg, Code: code})
+}
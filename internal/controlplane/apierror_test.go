@@ -0,0 +1,41 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/fentz26/neona/internal/store"
+)
+
+func TestErrorResponses(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	task, _ := s.service.CreateTask("Taken", "", store.TaskOptions{})
+	claimForTest(t, s, task.ID, "worker-1", nil)
+
+	tests := []struct {
+		name, method, path, body string
+		status                   int
+		code                     string
+	}{
+		{"missing task", http.MethodGet, "/tasks/missing", "", http.StatusNotFound, CodeNotFound},
+		{"bad json", http.MethodPost, "/tasks", "{", http.StatusBadRequest, CodeInvalidRequest},
+		{"claimed task", http.MethodPost, "/tasks/" + task.ID + "/claim", `{"holder_id":"worker-2"}`, http.StatusConflict, CodeConflict},
+	}
+	for _, tt := range tests {
+		w := doRequest(s, tt.method, tt.path, tt.body, nil)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.status, w.Code, w.Body.String())
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: Content-Type = %q, want application/json", tt.name, ct)
+		}
+		var resp ErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Code != tt.code || resp.Error == "" {
+			t.Errorf("%s: body = %+v, %v; want code %s with a message", tt.name, resp, err, tt.code)
+		}
+	}
+}
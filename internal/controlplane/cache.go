@@ -0,0 +1,70 @@
+package controlplane
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// maxCacheEntries bounds the read cache within a single store generation.
+const maxCacheEntries = 256
+
+// CacheStats reports read cache effectiveness.
+type CacheStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+// readCache memoizes hot reads until the store is next written. Entries are
+// tagged with the store generation observed before the read, so a write that
+// races with a read can never leave a stale value behind.
+type readCache struct {
+	mu      sync.Mutex
+	gen     uint64
+	entries map[string]interface{}
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func newReadCache() *readCache {
+	return &readCache{entries: make(map[string]interface{})}
+}
+
+// get returns the cached value for key if it was stored at generation gen.
+func (c *readCache) get(key string, gen uint64) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.gen == gen {
+		if v, ok := c.entries[key]; ok {
+			c.hits.Add(1)
+			return v, true
+		}
+	}
+	c.misses.Add(1)
+	return nil, false
+}
+
+// put stores a value read at generation gen, dropping everything cached at
+// older generations.
+func (c *readCache) put(key string, gen uint64, v interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen < c.gen {
+		return
+	}
+	if gen != c.gen || len(c.entries) >= maxCacheEntries {
+		c.gen = gen
+		c.entries = make(map[string]interface{})
+	}
+	c.entries[key] = v
+}
+
+func (c *readCache) stats() CacheStats {
+	c.mu.Lock()
+	n := len(c.entries)
+	c.mu.Unlock()
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: n}
+}
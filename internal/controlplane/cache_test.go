@@ -0,0 +1,63 @@
+package controlplane
+
+import (
+	"testing"
+
+	"github.com/fentz26/neona/internal/store"
+)
+
+func TestServiceCache_InvalidatedByWrites(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	svc := s.service
+
+	if _, err := svc.CreateTask("First", "", store.TaskOptions{}); err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+
+	tasks, err := svc.ListTasks("")
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("Expected 1 task, got %d (err=%v)", len(tasks), err)
+	}
+	if _, err := svc.ListTasks(""); err != nil {
+		t.Fatalf("ListTasks failed: %v", err)
+	}
+	if st := svc.CacheStats(); st.Hits != 1 || st.Misses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %+v", st)
+	}
+
+	// Writes that bypass the service (e.g. the scheduler) still invalidate
+	if _, err := s.store.CreateTask("Second", ""); err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	tasks, _ = svc.ListTasks("")
+	if len(tasks) != 2 {
+		t.Errorf("Expected 2 tasks after write, got %d", len(tasks))
+	}
+	if st := svc.CacheStats(); st.Misses != 2 {
+		t.Errorf("Expected a miss after write, got %+v", st)
+	}
+}
+
+func TestServiceCache_GetTaskReturnsCopy(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	svc := s.service
+
+	task, _ := svc.CreateTask("Original", "", store.TaskOptions{})
+
+	first, _ := svc.GetTask(task.ID)
+	first.Title = "Mutated"
+
+	second, _ := svc.GetTask(task.ID)
+	if second.Title != "Original" {
+		t.Errorf("Expected cached task to be unaffected by caller mutation, got %q", second.Title)
+	}
+	if st := svc.CacheStats(); st.Hits != 1 {
+		t.Errorf("Expected 1 hit, got %+v", st)
+	}
+
+	if missing, err := svc.GetTask("missing"); err != nil || missing != nil {
+		t.Errorf("Expected nil for missing task, got %v (err=%v)", missing, err)
+	}
+}
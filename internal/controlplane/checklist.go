@@ -0,0 +1,108 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// MaxChecklistItemLength caps the size of a checklist item in bytes.
+const MaxChecklistItemLength = 1024
+
+type addChecklistRequest struct {
+	Items []string `json:"items"`
+}
+
+// addChecklistItems handles POST /tasks/{id}/checklist.
+func (s *Server) addChecklistItems(w http.ResponseWriter, r *http.Request, taskID string) {
+	var req addChecklistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	var texts []string
+	for _, text := range req.Items {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		if len(text) > MaxChecklistItemLength {
+			writeError(w, "item too long", http.StatusRequestEntityTooLarge)
+			return
+		}
+		texts = append(texts, text)
+	}
+	if len(texts) == 0 {
+		writeError(w, "items required", http.StatusBadRequest)
+		return
+	}
+
+	items, err := s.service.AddChecklistItems(taskID, texts)
+	if err != nil {
+		if err == ErrNotFound {
+			writeError(w, "task not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(items)
+}
+
+// listChecklist handles GET /tasks/{id}/checklist.
+func (s *Server) listChecklist(w http.ResponseWriter, r *http.Request, taskID string) {
+	items, err := s.service.ListChecklist(taskID)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if items == nil {
+		items = []models.ChecklistItem{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+type checkItemRequest struct {
+	By string `json:"by"`
+}
+
+// checkItem handles POST /tasks/{id}/checklist/{item}/check and /uncheck.
+// Like comment authors, by defaults to the caller's principal and must
+// belong to it.
+func (s *Server) checkItem(w http.ResponseWriter, r *http.Request, taskID, itemID string, done bool) {
+	var req checkItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.By == "" {
+		req.By = PrincipalFromContext(r.Context())
+	}
+	if req.By != "" && !holderBound(r, req.By) {
+		writeError(w, "by not bound to authenticated principal", http.StatusForbidden)
+		return
+	}
+
+	item, err := s.service.CheckItem(taskID, itemID, done, req.By)
+	if err != nil {
+		if err == ErrNotFound {
+			writeError(w, "checklist item not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
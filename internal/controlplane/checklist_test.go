@@ -0,0 +1,62 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+func TestChecklist(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	s.service.SetRequireChecklist(true)
+
+	task, err := s.service.CreateTask("Login", "", store.TaskOptions{AcceptanceCriteria: []string{"SSO works"}})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleTaskByID(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	if w := do(http.MethodPost, "/tasks/"+task.ID+"/checklist", `{"items":["Docs updated"," "]}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 adding items, got %d: %s", w.Code, w.Body.String())
+	}
+	var items []models.ChecklistItem
+	json.NewDecoder(do(http.MethodGet, "/tasks/"+task.ID+"/checklist", "").Body).Decode(&items)
+	if len(items) != 2 || items[0].Text != "SSO works" || items[1].Text != "Docs updated" {
+		t.Fatalf("Expected acceptance criterion then added item, got %+v", items)
+	}
+
+	// Completion waits for every item
+	claim, err := s.service.ClaimTask(task.ID, "agent", 60)
+	if err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+	complete := `{"holder_id":"agent","holder_token":"` + claim.HolderToken + `"}`
+	if w := do(http.MethodPost, "/tasks/"+task.ID+"/complete", complete); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 completing with unchecked items, got %d", w.Code)
+	}
+
+	for _, item := range items {
+		w := do(http.MethodPost, "/tasks/"+task.ID+"/checklist/"+item.ID+"/check", `{"by":"alice"}`)
+		var checked models.ChecklistItem
+		json.NewDecoder(w.Body).Decode(&checked)
+		if w.Code != http.StatusOK || !checked.Done || checked.CheckedBy != "alice" {
+			t.Fatalf("Expected item checked, got %d %+v", w.Code, checked)
+		}
+	}
+	if w := do(http.MethodPost, "/tasks/"+task.ID+"/checklist/missing/check", ``); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown item, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/tasks/"+task.ID+"/complete", complete); w.Code != http.StatusOK {
+		t.Errorf("Expected completion once checked, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,52 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+func TestClaimNextEndpoint(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/tasks/claim-next", strings.NewReader(body)))
+		return w
+	}
+
+	if w := post(`{"holder_id":"agent-1"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 with no tasks, got %d", w.Code)
+	}
+	if w := post(`{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without holder_id, got %d", w.Code)
+	}
+
+	s.service.CreateTask("Docs", "", store.TaskOptions{Labels: []string{"docs"}})
+	build, _ := s.service.CreateTask("Build", "", store.TaskOptions{Labels: []string{"build"}})
+
+	w := post(`{"holder_id":"agent-1","label":"build","ttl_sec":60}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result struct {
+		Task  models.Task  `json:"task"`
+		Lease models.Lease `json:"lease"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if result.Task.ID != build.ID || result.Lease.HolderID != "agent-1" || result.Lease.TTLSec != 60 {
+		t.Errorf("Unexpected claim result: %+v", result)
+	}
+
+	if w := post(`{"holder_id":"agent-1","label":"build"}`); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 once build tasks are claimed, got %d", w.Code)
+	}
+}
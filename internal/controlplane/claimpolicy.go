@@ -0,0 +1,163 @@
+package controlplane
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// DefaultClaimConfig is the claim policy of a daemon without a claim config:
+// five-minute leases, uncapped, and no limit on claims per holder.
+func DefaultClaimConfig() models.ClaimConfig {
+	return models.ClaimConfig{ClaimPolicy: models.NewClaimPolicy(models.DefaultLeaseTTLSec, 0)}
+}
+
+// claimPolicyEntry is a policy in the claim config file. Settings left out
+// are inherited.
+type claimPolicyEntry struct {
+	LeaseTTL    *time.Duration `yaml:"lease_ttl"`
+	MaxLeaseTTL *time.Duration `yaml:"max_lease_ttl"`
+}
+
+// resolve returns the policy of e, taking settings it leaves out from base.
+func (e claimPolicyEntry) resolve(base models.ClaimPolicy) (models.ClaimPolicy, error) {
+	ttl, maxTTL := base.LeaseTTLSec, base.MaxLeaseTTLSec
+	if e.LeaseTTL != nil {
+		if *e.LeaseTTL < time.Second || *e.LeaseTTL%time.Second != 0 {
+			return models.ClaimPolicy{}, fmt.Errorf("lease_ttl %s is not a whole number of seconds", *e.LeaseTTL)
+		}
+		ttl = int(*e.LeaseTTL / time.Second)
+	}
+	if e.MaxLeaseTTL != nil {
+		if *e.MaxLeaseTTL < 0 || *e.MaxLeaseTTL%time.Second != 0 {
+			return models.ClaimPolicy{}, fmt.Errorf("max_lease_ttl %s is not a whole number of seconds", *e.MaxLeaseTTL)
+		}
+		maxTTL = int(*e.MaxLeaseTTL / time.Second)
+	}
+	if maxTTL > 0 && ttl > maxTTL {
+		return models.ClaimPolicy{}, fmt.Errorf("lease_ttl %ds is over max_lease_ttl %ds", ttl, maxTTL)
+	}
+	return models.NewClaimPolicy(ttl, maxTTL), nil
+}
+
+// LoadClaimConfig reads a YAML claim config. Settings left out keep their
+// defaults, and a project's settings those of the file:
+//
+//	lease_ttl: 5m
+//	max_lease_ttl: 1h
+//	max_claims_per_holder: 4
+//	projects:
+//	  web:
+//	    lease_ttl: 20m
+func LoadClaimConfig(path string) (models.ClaimConfig, error) {
+	cfg := DefaultClaimConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	var file struct {
+		claimPolicyEntry   `yaml:",inline"`
+		MaxClaimsPerHolder int                         `yaml:"max_claims_per_holder"`
+		Projects           map[string]claimPolicyEntry `yaml:"projects"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return cfg, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	if cfg.ClaimPolicy, err = file.resolve(cfg.ClaimPolicy); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if file.MaxClaimsPerHolder < 0 {
+		return cfg, fmt.Errorf("%s: max_claims_per_holder must not be negative", path)
+	}
+	cfg.MaxClaimsPerHolder = file.MaxClaimsPerHolder
+	for name, entry := range file.Projects {
+		if name == "" {
+			return cfg, fmt.Errorf("%s: empty project name", path)
+		}
+		policy, err := entry.resolve(cfg.ClaimPolicy)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: project %s: %w", path, name, err)
+		}
+		if cfg.Projects == nil {
+			cfg.Projects = make(map[string]models.ClaimPolicy)
+		}
+		cfg.Projects[name] = policy
+	}
+	return cfg, nil
+}
+
+// SetClaimConfig sets the lease TTLs claims get and the limits on them.
+// Must be called before serving requests - not safe for concurrent use.
+func (s *Service) SetClaimConfig(cfg models.ClaimConfig) {
+	s.claimConfig = cfg
+}
+
+// ClaimConfig returns the claim policy set with SetClaimConfig.
+func (s *Service) ClaimConfig() models.ClaimConfig {
+	return s.claimConfig
+}
+
+// claimPolicy returns the policy for a task's project. Without project
+// overrides the task is not read.
+func (s *Service) claimPolicy(taskID string) (models.ClaimPolicy, error) {
+	if len(s.claimConfig.Projects) == 0 {
+		return s.claimConfig.ClaimPolicy, nil
+	}
+	task, err := s.store.GetTask(taskID)
+	if err != nil || task == nil {
+		return s.claimConfig.ClaimPolicy, err
+	}
+	return s.claimConfig.For(models.TaskProject(task)), nil
+}
+
+// checkClaimLimit refuses a claim by a holder already holding
+// MaxClaimsPerHolder tasks. Concurrent claims by one holder may each pass
+// the check, so the limit can be overshot by those.
+func (s *Service) checkClaimLimit(holderID string) error {
+	limit := s.claimConfig.MaxClaimsPerHolder
+	if limit <= 0 {
+		return nil
+	}
+	leases, err := s.store.ListActiveLeases()
+	if err != nil {
+		return err
+	}
+	held := 0
+	for _, l := range leases {
+		if l.HolderID == holderID {
+			held++
+		}
+	}
+	if held >= limit {
+		return fmt.Errorf("%w: %s holds %d tasks", ErrClaimLimit, holderID, held)
+	}
+	return nil
+}
+
+// ConfigResponse is the body of GET /config: daemon settings clients should
+// follow rather than assume.
+type ConfigResponse struct {
+	Claims models.ClaimConfig `json:"claims"`
+}
+
+// handleConfig handles GET /config.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ConfigResponse{Claims: s.service.ClaimConfig()})
+}
@@ -0,0 +1,116 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+func TestLoadClaimConfig(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "claims.yaml")
+		os.WriteFile(path, []byte(content), 0600)
+		return path
+	}
+
+	cfg, err := LoadClaimConfig(write("lease_ttl: 2m\nmax_lease_ttl: 1h\nmax_claims_per_holder: 4\nprojects:\n  web:\n    lease_ttl: 20m\n  api:\n    max_lease_ttl: 10m\n"))
+	if err != nil {
+		t.Fatalf("LoadClaimConfig failed: %v", err)
+	}
+	if cfg.LeaseTTLSec != 120 || cfg.MaxLeaseTTLSec != 3600 || cfg.HeartbeatSec != 40 || cfg.MaxClaimsPerHolder != 4 {
+		t.Errorf("Defaults = %+v", cfg)
+	}
+	if web := cfg.For("web"); web.LeaseTTLSec != 1200 || web.MaxLeaseTTLSec != 3600 || web.HeartbeatSec != 400 {
+		t.Errorf("web = %+v, want a 20m lease keeping the file's cap", web)
+	}
+	if api := cfg.For("api"); api.LeaseTTLSec != 120 || api.TTL(0) != 120 || api.TTL(7200) != 600 {
+		t.Errorf("api = %+v, want the file's TTL capped at 10m", api)
+	}
+	if other := cfg.For("other"); other != cfg.ClaimPolicy {
+		t.Errorf("Expected projects without overrides to get the defaults, got %+v", other)
+	}
+
+	if cfg, err := LoadClaimConfig(write("")); err != nil || cfg.LeaseTTLSec != models.DefaultLeaseTTLSec {
+		t.Errorf("Expected an empty file to keep the defaults, got %+v, %v", cfg, err)
+	}
+	for _, bad := range []string{
+		"lease_ttl: 90m\nmax_lease_ttl: 1h\n",
+		"lease_ttl: 1500ms\n",
+		"max_claims_per_holder: -1\n",
+		"leaseTTL: 5m\n",
+		"projects:\n  web:\n    max_claims_per_holder: 1\n",
+	} {
+		if _, err := LoadClaimConfig(write(bad)); err == nil {
+			t.Errorf("Expected %q rejected", bad)
+		}
+	}
+}
+
+func TestClaimPolicy(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	cfg := DefaultClaimConfig()
+	cfg.ClaimPolicy = models.NewClaimPolicy(120, 600)
+	cfg.MaxClaimsPerHolder = 2
+	cfg.Projects = map[string]models.ClaimPolicy{"web": models.NewClaimPolicy(900, 0)}
+	s.service.SetClaimConfig(cfg)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/config", nil))
+	var resp ConfigResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Claims.LeaseTTLSec != 120 || resp.Claims.Projects["web"].LeaseTTLSec != 900 {
+		t.Fatalf("GET /config = %d %+v, %v", w.Code, resp, err)
+	}
+
+	plain, _ := s.service.CreateTask("Plain", "", store.TaskOptions{})
+	lease, err := s.service.ClaimTask(plain.ID, "agent-1", 0)
+	if err != nil || lease.TTLSec != 120 {
+		t.Fatalf("ClaimTask = %+v, %v, want the default 120s", lease, err)
+	}
+	if err := s.service.RenewLease(plain.ID, "agent-1", 3600); err != nil {
+		t.Fatal(err)
+	}
+	if lease, _ := s.store.GetActiveLease(plain.ID); time.Until(lease.ExpiresAt) > 10*time.Minute {
+		t.Errorf("Heartbeat renewed lease until %s, want it capped at 600s", lease.ExpiresAt)
+	}
+
+	// claim-next learns the project once it has the task
+	s.service.CreateTask("Deploy", "", store.TaskOptions{Labels: []string{"project:web"}})
+	w = post("/tasks/claim-next", `{"holder_id":"agent-1"}`)
+	var claimed store.ClaimResult
+	if err := json.NewDecoder(w.Body).Decode(&claimed); err != nil || claimed.Lease.TTLSec != 900 {
+		t.Fatalf("claim-next = %d %+v, %v, want web's 900s", w.Code, claimed.Lease, err)
+	}
+	if lease, _ := s.store.GetActiveLease(claimed.Task.ID); lease.TTLSec != 900 {
+		t.Errorf("Stored TTL = %d, want 900", lease.TTLSec)
+	}
+
+	extra, _ := s.service.CreateTask("Extra", "", store.TaskOptions{})
+	w = post("/tasks/"+extra.ID+"/claim", `{"holder_id":"agent-1"}`)
+	var apiErr ErrorResponse
+	json.NewDecoder(w.Body).Decode(&apiErr)
+	if w.Code != http.StatusConflict || apiErr.Code != CodeClaimLimit {
+		t.Errorf("Expected a third claim refused with %s, got %d %+v", CodeClaimLimit, w.Code, apiErr)
+	}
+	if w := post("/tasks/claim-next", `{"holder_id":"agent-1"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected claim-next refused at the limit, got %d", w.Code)
+	}
+	if _, err := s.service.ClaimTask(extra.ID, "agent-2", 0); err != nil {
+		t.Errorf("Expected another holder to claim, got %v", err)
+	}
+}
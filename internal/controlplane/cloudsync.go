@@ -0,0 +1,38 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fentz26/neona/internal/cloudsync"
+)
+
+// CloudSync reports the state of the neona.app cloud sync for the
+// /cloud/status endpoint.
+type CloudSync interface {
+	Status() (*cloudsync.Status, error)
+}
+
+// SetCloudSync sets the cloud syncer for the /cloud/status endpoint.
+// Must be called before Start() - not safe for concurrent use.
+func (s *Server) SetCloudSync(c CloudSync) {
+	s.cloudSync = c
+}
+
+// handleCloudStatus handles GET /cloud/status.
+func (s *Server) handleCloudStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := &cloudsync.Status{Conflicts: []cloudsync.Conflict{}}
+	if s.cloudSync != nil {
+		var err error
+		if status, err = s.cloudSync.Status(); err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,90 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// MaxCommentLength caps the size of a comment body in bytes.
+const MaxCommentLength = 16 * 1024
+
+type addCommentRequest struct {
+	Author string `json:"author"`
+	Body   string `json:"body"`
+}
+
+// addComment handles POST /tasks/{id}/comments. Authenticated callers may
+// omit author, which then defaults to their principal; any author they give
+// must belong to it, like holder IDs.
+func (s *Server) addComment(w http.ResponseWriter, r *http.Request, taskID string) {
+	var req addCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" {
+		writeError(w, "body required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Body) > MaxCommentLength {
+		writeError(w, "body too long", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if req.Author == "" {
+		req.Author = PrincipalFromContext(r.Context())
+	}
+	if req.Author == "" {
+		writeError(w, "author required", http.StatusBadRequest)
+		return
+	}
+	if !holderBound(r, req.Author) {
+		writeError(w, "author not bound to authenticated principal", http.StatusForbidden)
+		return
+	}
+
+	c, err := s.service.AddComment(taskID, req.Author, req.Body)
+	if err != nil {
+		if err == ErrNotFound {
+			writeError(w, "task not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
+
+// listComments handles GET /tasks/{id}/comments?since=<RFC3339>.
+func (s *Server) listComments(w http.ResponseWriter, r *http.Request, taskID string) {
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			writeError(w, "invalid since (want RFC3339)", http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+
+	comments, err := s.service.ListComments(taskID, since)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if comments == nil {
+		comments = []models.Comment{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comments)
+}
@@ -0,0 +1,134 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/scheduler"
+)
+
+// WorkerLister lists the scheduler's in-memory workers. A scheduler passed
+// to SetScheduler that implements it adds its workers to /debug/state.
+type WorkerLister interface {
+	GetWorkers() []*scheduler.WorkerInfo
+}
+
+// DebugState is the response of GET /debug/state: the coordination tables as
+// stored, the scheduler's view of them, and where the two disagree.
+type DebugState struct {
+	Leases  []models.Lease          `json:"leases"`
+	Locks   []models.Lock           `json:"locks"`
+	Tasks   []models.Task           `json:"tasks"` // claimed and running
+	Workers []*scheduler.WorkerInfo `json:"workers"`
+	Issues  []string                `json:"issues"`
+}
+
+// handleDebugState handles GET /debug/state.
+func (s *Server) handleDebugState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	state, err := s.debugState()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+func (s *Server) debugState() (*DebugState, error) {
+	state := &DebugState{Workers: []*scheduler.WorkerInfo{}}
+	var err error
+	if state.Leases, err = s.store.ListActiveLeases(); err != nil {
+		return nil, err
+	}
+	if state.Locks, err = s.store.ListLocks(); err != nil {
+		return nil, err
+	}
+	for _, status := range []models.TaskStatus{models.TaskStatusClaimed, models.TaskStatusRunning} {
+		tasks, err := s.store.ListTasks(string(status))
+		if err != nil {
+			return nil, err
+		}
+		state.Tasks = append(state.Tasks, tasks...)
+	}
+	if wl, ok := s.scheduler.(WorkerLister); ok {
+		state.Workers = wl.GetWorkers()
+		sort.Slice(state.Workers, func(i, j int) bool {
+			return state.Workers[i].StartedAt.Before(state.Workers[j].StartedAt)
+		})
+	}
+	if state.Leases == nil {
+		state.Leases = []models.Lease{}
+	}
+	if state.Locks == nil {
+		state.Locks = []models.Lock{}
+	}
+	if state.Tasks == nil {
+		state.Tasks = []models.Task{}
+	}
+	state.Issues = state.check()
+	return state, nil
+}
+
+// check cross-checks leases, locks, tasks and workers against each other.
+func (d *DebugState) check() []string {
+	issues := []string{}
+
+	leasesByTask := make(map[string][]models.Lease)
+	holders := make(map[string]bool)
+	for _, l := range d.Leases {
+		leasesByTask[l.TaskID] = append(leasesByTask[l.TaskID], l)
+		holders[l.HolderID] = true
+	}
+	tasks := make(map[string]models.Task)
+	for _, t := range d.Tasks {
+		tasks[t.ID] = t
+		leases := leasesByTask[t.ID]
+		if len(leases) == 0 {
+			issues = append(issues, fmt.Sprintf("task %s is %s by %s without an active lease", t.ID, t.Status, t.ClaimedBy))
+			continue
+		}
+		for _, l := range leases {
+			if l.HolderID != t.ClaimedBy {
+				issues = append(issues, fmt.Sprintf("lease %s on task %s is held by %s but the task is claimed by %s", l.ID, t.ID, l.HolderID, t.ClaimedBy))
+			}
+		}
+	}
+	for _, l := range d.Leases {
+		if _, ok := tasks[l.TaskID]; !ok {
+			issues = append(issues, fmt.Sprintf("lease %s is active on task %s, which is not claimed or running", l.ID, l.TaskID))
+		}
+	}
+	for taskID, leases := range leasesByTask {
+		if len(leases) > 1 {
+			issues = append(issues, fmt.Sprintf("task %s has %d active leases", taskID, len(leases)))
+		}
+	}
+
+	leases := make(map[string]models.Lease)
+	for _, l := range d.Leases {
+		leases[l.ID] = l
+	}
+	for _, w := range d.Workers {
+		if l, ok := leases[w.LeaseID]; !ok || l.TaskID != w.TaskID {
+			issues = append(issues, fmt.Sprintf("worker %s runs task %s without its lease %s", w.WorkerID, w.TaskID, w.LeaseID))
+		}
+	}
+
+	// The scheduler holds a task's mutex lock as the lease holder, so a mutex
+	// lock outliving its holder's lease blocks the key until it expires.
+	for _, l := range d.Locks {
+		if l.LockType == "mutex" && !holders[l.HolderID] {
+			issues = append(issues, fmt.Sprintf("mutex lock %s on %s is held by %s, which has no active lease", l.ID, l.ResourceID, l.HolderID))
+		}
+	}
+
+	sort.Strings(issues)
+	return issues
+}
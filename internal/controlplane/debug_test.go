@@ -0,0 +1,85 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fentz26/neona/internal/scheduler"
+	"github.com/fentz26/neona/internal/store"
+)
+
+// workerScheduler is a scheduler stub with in-memory workers.
+type workerScheduler []*scheduler.WorkerInfo
+
+func (s workerScheduler) GetStats() map[string]interface{}    { return map[string]interface{}{} }
+func (s workerScheduler) GetWorkers() []*scheduler.WorkerInfo { return s }
+
+func TestDebugState(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/debug/state", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, req)
+		return w
+	}
+	if w := get(""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 with admin API disabled, got %d", w.Code)
+	}
+	s.SetAdminToken("secret")
+	if w := get("wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with wrong token, got %d", w.Code)
+	}
+
+	task, err := s.service.CreateTask("Claimed", "", store.TaskOptions{})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	lease, err := s.service.ClaimTask(task.ID, "agent-1", 300)
+	if err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+	if _, err := s.store.AcquireLock(store.MutexResourceID("deploy"), "gone", "mutex", 300); err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	s.SetScheduler(workerScheduler{
+		{WorkerID: "agent-1", TaskID: task.ID, LeaseID: lease.ID},
+		{WorkerID: "w2", TaskID: "t2", LeaseID: "l2"},
+	})
+
+	w := get("secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var state DebugState
+	if err := json.NewDecoder(w.Body).Decode(&state); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(state.Leases) != 1 || state.Leases[0].ID != lease.ID {
+		t.Errorf("Leases = %+v", state.Leases)
+	}
+	if len(state.Locks) != 1 || len(state.Tasks) != 1 || len(state.Workers) != 2 {
+		t.Errorf("Expected 1 lock, 1 task and 2 workers, got %d, %d, %d", len(state.Locks), len(state.Tasks), len(state.Workers))
+	}
+	if len(state.Issues) != 2 ||
+		!strings.HasPrefix(state.Issues[0], "mutex lock") ||
+		!strings.HasPrefix(state.Issues[1], "worker w2") {
+		t.Errorf("Issues = %q, want the orphaned mutex lock and the worker without a lease", state.Issues)
+	}
+
+	// A claim whose lease lapsed is reported
+	s.store.DeleteLeasesForTask(task.ID)
+	w = get("secret")
+	state = DebugState{}
+	json.NewDecoder(w.Body).Decode(&state)
+	if !strings.Contains(strings.Join(state.Issues, "\n"), "task "+task.ID+" is claimed by agent-1 without an active lease") {
+		t.Errorf("Issues = %q, want the claim without a lease", state.Issues)
+	}
+}
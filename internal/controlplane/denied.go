@@ -0,0 +1,61 @@
+package controlplane
+
+import (
+	"sync"
+
+	"github.com/fentz26/neona/internal/connectors"
+)
+
+// maxDeniedCommands bounds the programs counted separately in the denied
+// command metric; further ones are counted under deniedOther.
+const maxDeniedCommands = 50
+
+const deniedOther = "_other"
+
+// deniedCounter counts commands refused by the connector's allowlist, per
+// program, so operators can see what agents keep reaching for.
+type deniedCounter struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func (d *deniedCounter) add(program string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.counts == nil {
+		d.counts = make(map[string]uint64)
+	}
+	if _, ok := d.counts[program]; !ok && len(d.counts) >= maxDeniedCommands {
+		program = deniedOther
+	}
+	d.counts[program]++
+}
+
+func (d *deniedCounter) snapshot() map[string]uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	counts := make(map[string]uint64, len(d.counts))
+	for program, n := range d.counts {
+		counts[program] = n
+	}
+	return counts
+}
+
+// denyCommand records a command the connector's allowlist rejected and
+// returns the error for the caller, with the nearest allowed commands when
+// the connector can suggest them.
+func (s *Service) denyCommand(conn connectors.Connector, taskID, holderID, command string, args []string) error {
+	denied := &connectors.CommandDeniedError{Command: command, Args: args, Suggestions: []string{}}
+	if sg, ok := conn.(connectors.Suggester); ok {
+		denied.Suggestions = sg.SuggestAllowed(command, args, 3)
+	}
+	s.denied.add(command)
+	s.pdr.Record("task.run.denied", map[string]interface{}{"task_id": taskID, "connector": conn.Name(), "command": command, "args": args}, "denied", taskID, "holder="+holderID)
+	return denied
+}
+
+// DeniedCommands returns how many run requests the connector's allowlist
+// refused, per program.
+func (s *Service) DeniedCommands() map[string]uint64 {
+	return s.denied.snapshot()
+}
@@ -5,7 +5,22 @@ import "errors"
 // Sentinel errors for control plane operations.
 var (
 	ErrAlreadyClaimed = errors.New("task already claimed")
+	ErrNotPending     = errors.New("task is not pending")
 	ErrNoLease        = errors.New("no active lease")
 	ErrNotOwner       = errors.New("not the lease owner")
 	ErrNotFound       = errors.New("resource not found")
+	ErrAmbiguousID    = errors.New("ambiguous task id")
+	ErrInvalidWorkDir = errors.New("invalid workdir")
+	ErrEnvNotAllowed  = errors.New("environment variable not allowed")
+	ErrInvalidArgs    = errors.New("invalid arguments")
+	ErrInvalidSpec    = errors.New("invalid task description")
+
+	ErrChecklistIncomplete = errors.New("checklist incomplete")
+	ErrInvalidParent       = errors.New("invalid parent task")
+	ErrOpenSubtasks        = errors.New("task has open subtasks")
+	ErrInvalidScope        = errors.New("invalid memory scope")
+	ErrInvalidRuleFile     = errors.New("invalid rule file")
+	ErrNoSteps             = errors.New("task has no steps")
+	ErrUnsupported         = errors.New("run needs features the connector lacks")
+	ErrClaimLimit          = errors.New("holder is at its claim limit")
 )
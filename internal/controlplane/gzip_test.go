@@ -0,0 +1,98 @@
+package controlplane
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+func TestGzip_CompressesResponse(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	if _, err := s.service.CreateTask("Big", "task", store.TaskOptions{}); err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/tasks", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Expected Content-Encoding gzip, got %q", got)
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Response is not gzip: %v", err)
+	}
+	var tasks []models.Task
+	if err := json.NewDecoder(zr).Decode(&tasks); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(tasks) != 1 {
+		t.Errorf("Expected 1 task, got %d", len(tasks))
+	}
+}
+
+func TestGzip_PlainWithoutAcceptEncoding(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	for _, enc := range []string{"", "gzip;q=0"} {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		if enc != "" {
+			req.Header.Set("Accept-Encoding", enc)
+		}
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, req)
+
+		if got := w.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Accept-Encoding %q: expected no Content-Encoding, got %q", enc, got)
+		}
+		if !json.Valid(w.Body.Bytes()) {
+			t.Errorf("Accept-Encoding %q: expected plain JSON body", enc)
+		}
+	}
+}
+
+func TestGzip_DecompressesRequest(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	io.WriteString(zw, `{"title":"Compressed","description":"body"}`)
+	zw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/tasks", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var task models.Task
+	if err := json.NewDecoder(w.Body).Decode(&task); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if task.Title != "Compressed" {
+		t.Errorf("Expected title Compressed, got %q", task.Title)
+	}
+
+	bad := httptest.NewRequest(http.MethodPost, "/tasks", bytes.NewReader([]byte("not gzip")))
+	bad.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, bad)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid gzip body, got %d", w.Code)
+	}
+}
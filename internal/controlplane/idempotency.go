@@ -0,0 +1,191 @@
+package controlplane
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+)
+
+// IdempotencyHeader is the request header carrying a client-chosen idempotency key.
+const IdempotencyHeader = "Idempotency-Key"
+
+// maxJSONBody is the largest JSON request body the API reads.
+const maxJSONBody = 1 << 20
+
+// captureWriter records the status and body written through it.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *captureWriter) WriteHeader(status int) {
+	c.status = status
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+// withIdempotency runs handle at most once per Idempotency-Key within scope.
+// Retries with the same key and body replay the original response; reusing
+// the key for a different body is refused with a 422. Server errors, and
+// handlers that panic, are not remembered so the request can be retried.
+// Keys are per principal, so one API key's responses are never replayed to
+// another.
+func (s *Server) withIdempotency(scope string, w http.ResponseWriter, r *http.Request, handle func(http.ResponseWriter)) {
+	s.idempotent(scope, w, r, handle, false)
+}
+
+// withIdempotentClaim is withIdempotency for claims. Holder tokens are only
+// ever stored hashed, so the response is remembered without its token, and
+// a replay carries a fresh one for the lease while it is still active.
+func (s *Server) withIdempotentClaim(scope string, w http.ResponseWriter, r *http.Request, handle func(http.ResponseWriter)) {
+	s.idempotent(scope, w, r, handle, true)
+}
+
+func (s *Server) idempotent(scope string, w http.ResponseWriter, r *http.Request, handle func(http.ResponseWriter), claim bool) {
+	key := r.Header.Get(IdempotencyHeader)
+	if key == "" {
+		handle(w)
+		return
+	}
+	if principal := PrincipalFromContext(r.Context()); principal != "" {
+		scope = principal + " " + scope
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBody))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		writeError(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+
+	rec, created, err := s.store.BeginIdempotent(scope, key, hash)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !created {
+		// Keys reserved before request hashes were stored have none
+		if rec.RequestHash != "" && rec.RequestHash != hash {
+			writeErrorCode(w, "idempotency key was already used for a different request", CodeIdempotencyMismatch, http.StatusUnprocessableEntity)
+			return
+		}
+		if rec.StatusCode == 0 {
+			writeError(w, "request with this idempotency key is in progress", http.StatusConflict)
+			return
+		}
+		response := rec.Response
+		if claim && rec.StatusCode == http.StatusOK {
+			if response, err = s.reissueClaimToken(response); err != nil {
+				writeError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if rec.StatusCode < 400 {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(rec.StatusCode)
+		w.Write(response)
+		return
+	}
+
+	// Release the key unless a response is stored for it, including when
+	// handle panics and the recovery middleware answers instead
+	stored := false
+	defer func() {
+		if stored {
+			return
+		}
+		if err := s.store.DeleteIdempotent(scope, key); err != nil {
+			log.Printf("Failed to release idempotency key %q: %v", key, err)
+		}
+	}()
+
+	cw := &captureWriter{ResponseWriter: w}
+	handle(cw)
+
+	if cw.status == 0 || cw.status >= 500 {
+		return
+	}
+	response := cw.body.Bytes()
+	if claim && cw.status == http.StatusOK {
+		if response, err = withClaimLease(response, func(lease map[string]json.RawMessage) error {
+			delete(lease, "holder_token")
+			return nil
+		}); err != nil {
+			log.Printf("Failed to store idempotent response for %q: %v", key, err)
+			return
+		}
+	}
+	if err := s.store.CompleteIdempotent(scope, key, cw.status, response); err != nil {
+		log.Printf("Failed to store idempotent response for %q: %v", key, err)
+		return
+	}
+	stored = true
+}
+
+// reissueClaimToken puts a fresh holder token in a stored claim response.
+func (s *Server) reissueClaimToken(response []byte) ([]byte, error) {
+	return withClaimLease(response, func(lease map[string]json.RawMessage) error {
+		var id, taskID string
+		json.Unmarshal(lease["id"], &id)
+		json.Unmarshal(lease["task_id"], &taskID)
+		token, err := s.service.ReissueHolderToken(taskID, id)
+		if err != nil || token == "" {
+			return err
+		}
+		lease["holder_token"], _ = json.Marshal(token)
+		return nil
+	})
+}
+
+// withClaimLease edits the lease in a claim response: the whole body for
+// POST /tasks/{id}/claim, its "lease" for POST /tasks/claim-next.
+func withClaimLease(response []byte, edit func(map[string]json.RawMessage) error) ([]byte, error) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(response, &body); err != nil {
+		return nil, err
+	}
+	lease := body
+	nested := body["lease"] != nil
+	if nested {
+		if err := json.Unmarshal(body["lease"], &lease); err != nil {
+			return nil, err
+		}
+	}
+	if err := edit(lease); err != nil {
+		return nil, err
+	}
+	if nested {
+		data, err := json.Marshal(lease)
+		if err != nil {
+			return nil, err
+		}
+		body["lease"] = data
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,207 @@
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+func TestCreateTask_IdempotencyKey(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	post := func(key string) (*httptest.ResponseRecorder, models.Task) {
+		req := httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{"title":"Retry me"}`))
+		if key != "" {
+			req.Header.Set(IdempotencyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		s.handleTasks(w, req)
+
+		var task models.Task
+		if err := json.NewDecoder(w.Body).Decode(&task); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return w, task
+	}
+
+	w1, first := post("key-1")
+	w2, second := post("key-1")
+	if w1.Code != http.StatusCreated || w2.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 for both requests, got %d and %d", w1.Code, w2.Code)
+	}
+	if first.ID != second.ID {
+		t.Errorf("Expected retry to return task %s, got %s", first.ID, second.ID)
+	}
+	if w2.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("Expected replayed response to be marked")
+	}
+
+	// A different key creates a new task
+	_, third := post("key-2")
+	if third.ID == first.ID {
+		t.Error("Expected a different key to create a new task")
+	}
+
+	tasks, err := s.store.ListTasks("")
+	if err != nil {
+		t.Fatalf("ListTasks failed: %v", err)
+	}
+	if len(tasks) != 2 {
+		t.Errorf("Expected 2 tasks, got %d", len(tasks))
+	}
+}
+
+func TestClaimTask_IdempotencyKey(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	task, err := s.store.CreateTask("Claim me", "")
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+
+	claim := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/tasks/"+task.ID+"/claim", strings.NewReader(`{"holder_id":"agent-1"}`))
+		req.Header.Set(IdempotencyHeader, "claim-1")
+		w := httptest.NewRecorder()
+		s.handleTaskByID(w, req)
+		return w
+	}
+
+	first := claim()
+	second := claim()
+	if first.Code != http.StatusOK {
+		t.Fatalf("Expected first claim to succeed, got %d: %s", first.Code, first.Body.String())
+	}
+	var lease1, lease2 models.Lease
+	json.Unmarshal(first.Body.Bytes(), &lease1)
+	json.Unmarshal(second.Body.Bytes(), &lease2)
+	if second.Code != http.StatusOK || lease2.ID != lease1.ID {
+		t.Fatalf("Expected retried claim to replay the original lease, got %d: %s", second.Code, second.Body.String())
+	}
+
+	// The stored response holds no token; the replay carries a new one,
+	// which replaces the first
+	rec, _, err := s.store.BeginIdempotent("POST /tasks/"+task.ID+"/claim", "claim-1", "")
+	if err != nil || strings.Contains(string(rec.Response), "holder_token") || strings.Contains(string(rec.Response), lease1.HolderToken) {
+		t.Errorf("Expected the stored response without the holder token, got %s (%v)", rec.Response, err)
+	}
+	if lease2.HolderToken == "" || lease2.HolderToken == lease1.HolderToken {
+		t.Fatalf("Expected a fresh holder token on replay, got %q", lease2.HolderToken)
+	}
+	if err := s.service.VerifyHolder(task.ID, "agent-1", lease2.HolderToken); err != nil {
+		t.Errorf("Expected the replayed token to verify: %v", err)
+	}
+	if err := s.service.VerifyHolder(task.ID, "agent-1", lease1.HolderToken); err == nil {
+		t.Error("Expected the first token to be replaced")
+	}
+}
+
+func TestClaimNext_IdempotencyKeyPerPrincipal(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	if _, err := s.store.CreateTask("Claim me", ""); err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+
+	claim := func(principal string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/tasks/claim-next", strings.NewReader(`{"holder_id":"`+principal+`/agent"}`))
+		req.Header.Set(IdempotencyHeader, "claim-1")
+		req = req.WithContext(context.WithValue(req.Context(), principalKey{}, principal))
+		w := httptest.NewRecorder()
+		s.handleTaskByID(w, req)
+		return w
+	}
+
+	first := claim("alice")
+	var res struct {
+		Lease models.Lease `json:"lease"`
+	}
+	json.Unmarshal(first.Body.Bytes(), &res)
+	if first.Code != http.StatusOK || res.Lease.HolderToken == "" {
+		t.Fatalf("Expected a claim with a holder token, got %d: %s", first.Code, first.Body.String())
+	}
+	replay := claim("alice")
+	var replayed struct {
+		Lease models.Lease `json:"lease"`
+	}
+	json.Unmarshal(replay.Body.Bytes(), &replayed)
+	if replayed.Lease.ID != res.Lease.ID || replayed.Lease.HolderToken == "" || replayed.Lease.HolderToken == res.Lease.HolderToken {
+		t.Errorf("Expected a replay of lease %s with a fresh token, got %s", res.Lease.ID, replay.Body.String())
+	}
+
+	// The same key from another principal is a request of its own
+	if w := claim("bob"); w.Code != http.StatusNoContent || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("Expected another principal's key not to replay, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestIdempotencyKey_DifferentBody(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(body))
+		req.Header.Set(IdempotencyHeader, "key-1")
+		w := httptest.NewRecorder()
+		s.handleTasks(w, req)
+		return w
+	}
+
+	if w := post(`{"title":"First"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	w := post(`{"title":"Second"}`)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), CodeIdempotencyMismatch) {
+		t.Errorf("Expected 422 %s for a reused key, got %d: %s", CodeIdempotencyMismatch, w.Code, w.Body.String())
+	}
+	if tasks, _ := s.store.ListTasks(""); len(tasks) != 1 {
+		t.Errorf("Expected 1 task, got %d", len(tasks))
+	}
+}
+
+func TestIdempotencyKey_BodyTooLarge(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	body := `{"title":"Big","description":"` + strings.Repeat("x", maxJSONBody) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(body))
+	req.Header.Set(IdempotencyHeader, "key-1")
+	w := httptest.NewRecorder()
+	s.handleTasks(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for an oversized body, got %d: %s", w.Code, w.Body.String())
+	}
+	if tasks, _ := s.store.ListTasks(""); len(tasks) != 0 {
+		t.Errorf("Expected no task, got %d", len(tasks))
+	}
+}
+
+func TestIdempotencyKey_ReleasedOnPanic(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	call := func(handle func(http.ResponseWriter)) (w *httptest.ResponseRecorder, panicked bool) {
+		req := httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{}`))
+		req.Header.Set(IdempotencyHeader, "key-1")
+		w = httptest.NewRecorder()
+		defer func() { panicked = recover() != nil }()
+		s.withIdempotency("POST /tasks", w, req, handle)
+		return w, false
+	}
+
+	if _, panicked := call(func(http.ResponseWriter) { panic("boom") }); !panicked {
+		t.Fatal("Expected the handler's panic to propagate")
+	}
+	w, _ := call(func(w http.ResponseWriter) { w.WriteHeader(http.StatusCreated) })
+	if w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("Expected the retry to run the handler, got %d (replayed %q)", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+}
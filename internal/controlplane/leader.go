@@ -0,0 +1,60 @@
+package controlplane
+
+import (
+	"net/http"
+	"strings"
+)
+
+// LeaderStatus reports this daemon's role among daemons sharing a database.
+type LeaderStatus interface {
+	IsLeader() bool
+	// LeaderAddr returns the leader's API base URL, or "" if none is known.
+	LeaderAddr() string
+}
+
+// LeaderHeader names the leader's API address on responses from followers.
+const LeaderHeader = "X-Neona-Leader"
+
+// SetLeader makes the server serve as one of several daemons. While it is
+// not the leader it serves reads and redirects writes to the leader.
+// Must be called before Start() - not safe for concurrent use.
+func (s *Server) SetLeader(l LeaderStatus) {
+	s.leader = l
+}
+
+// role returns "leader" or "follower", or "" for a standalone daemon.
+func (s *Server) role() string {
+	switch {
+	case s.leader == nil:
+		return ""
+	case s.leader.IsLeader():
+		return "leader"
+	default:
+		return "follower"
+	}
+}
+
+// followerWrites sends writes that reach a follower to the leader with a
+// 307, which clients replay with the same method and body. With no leader
+// elected yet it answers 503 so clients retry.
+func (s *Server) followerWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.leader.IsLeader() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		addr := s.leader.LeaderAddr()
+		if addr == "" {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, "no leader elected; retry shortly", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set(LeaderHeader, addr)
+		http.Redirect(w, r, strings.TrimRight(addr, "/")+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+	})
+}
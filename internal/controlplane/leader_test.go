@@ -0,0 +1,65 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeLeader struct {
+	leader bool
+	addr   string
+}
+
+func (f *fakeLeader) IsLeader() bool     { return f.leader }
+func (f *fakeLeader) LeaderAddr() string { return f.addr }
+
+func TestFollowerRedirectsWrites(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	l := &fakeLeader{addr: "http://10.0.0.2:7466"}
+	s.SetLeader(l)
+	h := s.Handler()
+
+	// Reads are served locally
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/tasks", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("GET /tasks on follower = %d, want 200", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/tasks?x=1", strings.NewReader(`{"title":"t"}`)))
+	if rr.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("POST /tasks on follower = %d, want 307", rr.Code)
+	}
+	if got := rr.Header().Get("Location"); got != "http://10.0.0.2:7466/tasks?x=1" {
+		t.Errorf("Location = %q", got)
+	}
+
+	// No leader elected yet
+	l.addr = ""
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{"title":"t"}`)))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("POST /tasks without leader = %d, want 503 with Retry-After", rr.Code)
+	}
+
+	var health HealthResponse
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+	json.NewDecoder(rr.Body).Decode(&health)
+	if health.Role != "follower" {
+		t.Errorf("Role = %q, want follower", health.Role)
+	}
+
+	// The leader takes writes itself
+	l.leader = true
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{"title":"t"}`)))
+	if rr.Code != http.StatusCreated && rr.Code != http.StatusOK {
+		t.Errorf("POST /tasks on leader = %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,81 @@
+package controlplane
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// Memory scope levels, narrowest first. Promotion moves an item to a
+// wider level.
+const (
+	scopeLevelTask = iota
+	scopeLevelProject
+	scopeLevelGlobal
+)
+
+// scopeLevel validates a memory scope and returns its level.
+func scopeLevel(scope string) (int, error) {
+	var name string
+	level := scopeLevelGlobal
+	switch {
+	case scope == models.MemoryScopeGlobal:
+		return level, nil
+	case strings.HasPrefix(scope, models.MemoryScopeProject):
+		name, level = strings.TrimPrefix(scope, models.MemoryScopeProject), scopeLevelProject
+	case strings.HasPrefix(scope, models.MemoryScopeTask):
+		name, level = strings.TrimPrefix(scope, models.MemoryScopeTask), scopeLevelTask
+	default:
+		return 0, fmt.Errorf("%w %q (want global, project:<name> or task:<id>)", ErrInvalidScope, scope)
+	}
+	if name == "" || strings.ContainsAny(name, ", \t\n") {
+		return 0, fmt.Errorf("%w %q: name must be non-empty without spaces or commas", ErrInvalidScope, scope)
+	}
+	return level, nil
+}
+
+// ParseScopes splits a comma-separated scope list such as
+// "project:web,global", validating each scope.
+func ParseScopes(list string) ([]string, error) {
+	var scopes []string
+	for _, scope := range strings.Split(list, ",") {
+		if scope = strings.TrimSpace(scope); scope == "" {
+			continue
+		}
+		if _, err := scopeLevel(scope); err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+// PromoteMemory moves a memory item to a wider scope, e.g. a task's learning
+// to its project or a project's to everyone. Moving an item to a narrower
+// or sibling scope fails with ErrInvalidScope.
+func (s *Service) PromoteMemory(id, scope string) (*models.MemoryItem, error) {
+	to, err := scopeLevel(scope)
+	if err != nil {
+		return nil, err
+	}
+	item, err := s.store.GetMemoryItem(id)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrNotFound
+	}
+	if item.Scope == scope {
+		return item, nil
+	}
+	if from, _ := scopeLevel(item.Scope); to <= from {
+		return nil, fmt.Errorf("%w: cannot move %s to %s, only to a wider scope", ErrInvalidScope, item.Scope, scope)
+	}
+	if err := s.store.SetMemoryScope(id, scope); err != nil {
+		return nil, err
+	}
+	s.pdr.Record("memory.promote", map[string]string{"id": id, "from": item.Scope, "to": scope}, "success", item.TaskID, "")
+	item.Scope = scope
+	return item, nil
+}
@@ -0,0 +1,119 @@
+package controlplane
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/fentz26/neona/internal/mcp"
+)
+
+// RouteCacheStatsProvider is implemented by routers that cache decisions.
+type RouteCacheStatsProvider interface {
+	Stats() mcp.RouteCacheStats
+}
+
+// requestKey identifies a request counter.
+type requestKey struct {
+	method string
+	code   int
+}
+
+// requestCounter counts the API's requests by method and status code.
+type requestCounter struct {
+	mu     sync.Mutex
+	counts map[requestKey]uint64
+}
+
+func (c *requestCounter) add(method string, code int) {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+	default:
+		// Clients choose the method, so others share a series
+		method = "other"
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[requestKey]uint64)
+	}
+	c.counts[requestKey{method, code}]++
+}
+
+func (c *requestCounter) snapshot() map[requestKey]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[requestKey]uint64, len(c.counts))
+	for k, n := range c.counts {
+		counts[k] = n
+	}
+	return counts
+}
+
+// countRequests counts each request by method and the status it was
+// answered with, for /metrics.
+func (s *Server) countRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		s.requests.add(r.Method, sw.status)
+	})
+}
+
+// handleMetrics handles GET /metrics in the Prometheus text format.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	cache := s.service.CacheStats()
+	writeMetric(w, "neona_read_cache_hits_total", "counter", "Task reads served from the read cache.", cache.Hits)
+	writeMetric(w, "neona_read_cache_misses_total", "counter", "Task reads that went to the store.", cache.Misses)
+	writeMetric(w, "neona_read_cache_entries", "gauge", "Entries in the read cache.", cache.Entries)
+
+	requests := s.requests.snapshot()
+	keys := make([]requestKey, 0, len(requests))
+	for k := range requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].code < keys[j].code
+	})
+	fmt.Fprint(w, "# HELP neona_http_requests_total API requests answered, by method and status code.\n# TYPE neona_http_requests_total counter\n")
+	for _, k := range keys {
+		fmt.Fprintf(w, "neona_http_requests_total{method=%q,code=\"%d\"} %d\n", k.method, k.code, requests[k])
+	}
+
+	denied := s.service.DeniedCommands()
+	programs := make([]string, 0, len(denied))
+	for program := range denied {
+		programs = append(programs, program)
+	}
+	sort.Strings(programs)
+	fmt.Fprint(w, "# HELP neona_commands_denied_total Run requests refused by the connector allowlist, by program.\n# TYPE neona_commands_denied_total counter\n")
+	for _, program := range programs {
+		fmt.Fprintf(w, "neona_commands_denied_total{command=%q} %d\n", program, denied[program])
+	}
+
+	if provider, ok := s.mcpRouter.(RouteCacheStatsProvider); ok {
+		routes := provider.Stats()
+		writeMetric(w, "neona_route_cache_hits_total", "counter", "MCP routing decisions served from the route cache.", routes.Hits)
+		writeMetric(w, "neona_route_cache_misses_total", "counter", "MCP routing decisions computed by the router.", routes.Misses)
+		writeMetric(w, "neona_route_cache_evictions_total", "counter", "Route cache entries evicted to stay within the size limit.", routes.Evictions)
+		writeMetric(w, "neona_route_cache_invalidations_total", "counter", "Route cache flushes, e.g. on config reload.", routes.Invalidations)
+		writeMetric(w, "neona_route_cache_entries", "gauge", "Entries in the route cache.", routes.Entries)
+		fmt.Fprintf(w, "# HELP neona_mcp_config_info MCP router configuration in use.\n# TYPE neona_mcp_config_info gauge\nneona_mcp_config_info{version=%q} 1\n", routes.ConfigVersion)
+	}
+}
+
+func writeMetric(w io.Writer, name, kind, help string, value interface{}) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+}
@@ -0,0 +1,203 @@
+package controlplane
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/fentz26/neona/internal/store"
+)
+
+// HolderTokenHeader carries the holder token issued with a claim. It may be
+// sent instead of the holder_token body field.
+const HolderTokenHeader = "X-Neona-Holder-Token"
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the authenticated principal, or "" when API
+// keys are not enabled.
+func PrincipalFromContext(ctx context.Context) string {
+	p, _ := ctx.Value(principalKey{}).(string)
+	return p
+}
+
+// RoleViewer marks a read-only API key in the keys file.
+const RoleViewer = "viewer"
+
+// apiKeyEntry is a principal's entry in the keys file: the key alone, or
+// the key with a role.
+type apiKeyEntry struct {
+	Key  string `yaml:"key"`
+	Role string `yaml:"role"`
+}
+
+func (e *apiKeyEntry) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&e.Key)
+	}
+	type plain apiKeyEntry
+	return node.Decode((*plain)(e))
+}
+
+// LoadAPIKeys reads a YAML file mapping principal names to API keys. It
+// returns the keys by principal and the principals whose keys are
+// read-only, marked with role viewer:
+//
+//	ci-runner: 3f9a...
+//	alice: 81c2...
+//	dashboard:
+//	  key: 5be0...
+//	  role: viewer
+func LoadAPIKeys(path string) (keys map[string]string, viewers []string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries map[string]apiKeyEntry
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	keys = make(map[string]string, len(entries))
+	for principal, entry := range entries {
+		if principal == "" || strings.Contains(principal, "/") {
+			return nil, nil, fmt.Errorf("invalid principal %q in %s", principal, path)
+		}
+		if len(entry.Key) < 16 {
+			return nil, nil, fmt.Errorf("API key for %q in %s is shorter than 16 characters", principal, path)
+		}
+		switch entry.Role {
+		case "":
+		case RoleViewer:
+			viewers = append(viewers, principal)
+		default:
+			return nil, nil, fmt.Errorf("unknown role %q for %q in %s", entry.Role, principal, path)
+		}
+		keys[principal] = entry.Key
+	}
+	return keys, viewers, nil
+}
+
+// SetAPIKeys enables API-key authentication for every endpoint but /health
+// and the admin ones. keys maps principal names to keys; callers send
+// "Authorization: Bearer <key>" and may only use holder IDs equal to their
+// principal or prefixed with "<principal>/". With no keys the API is open.
+// Must be called before Start() - not safe for concurrent use.
+func (s *Server) SetAPIKeys(keys map[string]string) {
+	s.apiKeys = make(map[string]string, len(keys))
+	for principal, key := range keys {
+		s.apiKeys[hashToken(key)] = principal
+	}
+}
+
+// SetViewers makes the keys of principals read-only: requests other than
+// GET and HEAD made with them are refused with a 403.
+// Must be called before Start() - not safe for concurrent use.
+func (s *Server) SetViewers(principals ...string) {
+	s.viewers = make(map[string]bool, len(principals))
+	for _, p := range principals {
+		s.viewers[p] = true
+	}
+}
+
+// publicPaths are served without an API key.
+var publicPaths = map[string]bool{
+	"/health": true,
+}
+
+// isAdminPath reports whether path takes the admin token instead of an API
+// key.
+func isAdminPath(path string) bool {
+	return strings.HasPrefix(path, "/admin/") || path == "/debug/state"
+}
+
+// authenticate guards every route: the admin routes with the admin token,
+// publicPaths not at all, and all others with an API key. Routes are
+// authenticated unless listed, so one added without thought is not open.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case publicPaths[r.URL.Path]:
+			next.ServeHTTP(w, r)
+		case isAdminPath(r.URL.Path):
+			s.requireAdmin(next.ServeHTTP)(w, r)
+		default:
+			s.requireAPIKey(next.ServeHTTP)(w, r)
+		}
+	})
+}
+
+// requireAPIKey resolves the bearer API key to a principal. Keys are looked
+// up by hash so the comparison does not leak key prefixes through timing.
+func (s *Server) requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(s.apiKeys) == 0 {
+			next(w, r)
+			return
+		}
+		key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		principal, known := s.apiKeys[hashToken(key)]
+		if !ok || !known {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="neona"`)
+			writeError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if s.viewers[principal] && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeError(w, "read-only API key", http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	}
+}
+
+// holderBound reports whether the request's principal may act as holderID.
+func holderBound(r *http.Request, holderID string) bool {
+	principal := PrincipalFromContext(r.Context())
+	if principal == "" {
+		return true
+	}
+	return holderID == principal || strings.HasPrefix(holderID, principal+"/")
+}
+
+// requireHolder rejects holder IDs outside the caller's principal. It writes
+// the error response and returns false on rejection.
+func requireHolder(w http.ResponseWriter, r *http.Request, holderID string) bool {
+	if holderID == "" {
+		writeError(w, "holder_id required", http.StatusBadRequest)
+		return false
+	}
+	if !holderBound(r, holderID) {
+		writeError(w, "holder_id not bound to authenticated principal", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// authorizeHolder checks that the caller owns the task's lease: the holder
+// ID must belong to its principal and the holder token must match the one
+// issued at claim time. It writes the error response and returns false on
+// rejection.
+func (s *Server) authorizeHolder(w http.ResponseWriter, r *http.Request, taskID, holderID, token string) bool {
+	if !requireHolder(w, r, holderID) {
+		return false
+	}
+	if token == "" {
+		token = r.Header.Get(HolderTokenHeader)
+	}
+	if err := s.service.VerifyHolder(taskID, holderID, token); err != nil {
+		status := http.StatusInternalServerError
+		if err == ErrNotOwner || err == ErrNoLease {
+			status = http.StatusForbidden
+		}
+		writeError(w, err.Error(), status)
+		return false
+	}
+	return true
+}
+
+func hashToken(token string) string {
+	return store.HashToken(token)
+}
@@ -0,0 +1,201 @@
+package controlplane
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fentz26/neona/internal/store"
+)
+
+// EventDBQuota is emitted when the database grows past a soft limit set
+// with SetDBQuota.
+const EventDBQuota = "db.quota_exceeded"
+
+// Default soft limits on the database.
+const (
+	DefaultDBMaxBytes = 1 << 30
+	DefaultDBMaxRows  = 1_000_000
+)
+
+// DBQuota holds soft limits on the database. Crossing one only warns; the
+// database keeps growing.
+type DBQuota struct {
+	// MaxBytes is the database file size to warn at; 0 disables it.
+	MaxBytes int64
+	// MaxRows is the row count to warn at in any one table; 0 disables it.
+	MaxRows int64
+}
+
+// DBWarning is a soft limit the database is over.
+type DBWarning struct {
+	Table      string `json:"table,omitempty"` // empty for the file size
+	Value      int64  `json:"value"`
+	Limit      int64  `json:"limit"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion"`
+}
+
+// SetDBQuota sets the soft limits CheckDBQuota warns at.
+// Must be called before serving requests - not safe for concurrent use.
+func (s *Service) SetDBQuota(q DBQuota) {
+	s.dbQuota = q
+}
+
+// dbUsageReports keeps the warnings found by the last check, so /stats can
+// show them without measuring the database on every request.
+type dbUsageReports struct {
+	mu       sync.Mutex
+	warnings []DBWarning
+}
+
+// DBWarnings returns the soft limits the database was over at the last
+// CheckDBQuota.
+func (s *Service) DBWarnings() []DBWarning {
+	s.dbUsage.mu.Lock()
+	defer s.dbUsage.mu.Unlock()
+	return append([]DBWarning(nil), s.dbUsage.warnings...)
+}
+
+// CheckDBQuota measures the database, emits EventDBQuota for every limit
+// newly crossed and returns those warnings. A limit is reported again once
+// usage has dropped below it and crosses it again. Without limits it does
+// nothing.
+func (s *Service) CheckDBQuota() ([]DBWarning, error) {
+	if s.dbQuota == (DBQuota{}) {
+		return nil, nil
+	}
+	size, err := s.store.Size()
+	if err != nil {
+		return nil, err
+	}
+	warnings := dbWarnings(size, s.dbQuota)
+
+	s.dbUsage.mu.Lock()
+	defer s.dbUsage.mu.Unlock()
+	reported := make(map[string]bool, len(s.dbUsage.warnings))
+	for _, w := range s.dbUsage.warnings {
+		reported[w.Table] = true
+	}
+	var found []DBWarning
+	for _, w := range warnings {
+		if reported[w.Table] {
+			continue
+		}
+		if _, err := s.store.AddEvent(EventDBQuota, "", "", w); err != nil {
+			return found, err
+		}
+		s.pdr.Record("db.quota_exceeded", map[string]interface{}{"table": w.Table, "value": w.Value, "limit": w.Limit}, "warning", "", w.Message)
+		found = append(found, w)
+	}
+	s.dbUsage.warnings = warnings
+	return found, nil
+}
+
+// dbWarnings compares the database's size with the quota, file size first
+// and then tables by name.
+func dbWarnings(size *store.SizeStats, q DBQuota) []DBWarning {
+	var warnings []DBWarning
+	if q.MaxBytes > 0 && size.Bytes >= q.MaxBytes {
+		warnings = append(warnings, DBWarning{
+			Value:      size.Bytes,
+			Limit:      q.MaxBytes,
+			Message:    fmt.Sprintf("Database is %s, over the %s warning size", formatBytes(size.Bytes), formatBytes(q.MaxBytes)),
+			Suggestion: largestTableSuggestion(size) + " SQLite reuses freed space but shrinks the file only on VACUUM.",
+		})
+	}
+	if q.MaxRows <= 0 {
+		return warnings
+	}
+	tables := make([]string, 0, len(size.Rows))
+	for table := range size.Rows {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		if n := size.Rows[table]; n >= q.MaxRows {
+			warnings = append(warnings, DBWarning{
+				Table:      table,
+				Value:      n,
+				Limit:      q.MaxRows,
+				Message:    fmt.Sprintf("Table %s has %d rows, over the %d row warning", table, n, q.MaxRows),
+				Suggestion: tableSuggestion(table),
+			})
+		}
+	}
+	return warnings
+}
+
+// largestTableSuggestion names the table with the most rows and how to
+// shrink it.
+func largestTableSuggestion(size *store.SizeStats) string {
+	largest := ""
+	for table, n := range size.Rows {
+		if largest == "" || n > size.Rows[largest] || n == size.Rows[largest] && table < largest {
+			largest = table
+		}
+	}
+	if largest == "" {
+		return "Back up the database and delete data you no longer need."
+	}
+	return fmt.Sprintf("%s has the most rows (%d). %s", largest, size.Rows[largest], tableSuggestion(largest))
+}
+
+// tableSuggestion says how to keep a table from growing.
+func tableSuggestion(table string) string {
+	switch table {
+	case store.TableRunOutput, store.TableRuns:
+		return "Lower the daemon's --run-output-limit to keep less output per run; neona db check --repair deletes runs of deleted tasks."
+	case store.TableMemory:
+		return "Raise --memory-dedup-similarity to merge near-duplicate memory items."
+	default:
+		return fmt.Sprintf("Neona keeps %s rows indefinitely; back up the database and delete old rows you no longer need.", table)
+	}
+}
+
+// formatBytes renders n in binary units, e.g. 1.5 GiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// DBQuotaJob calls CheckDBQuota periodically and posts each new warning to
+// its notifiers.
+type DBQuotaJob struct {
+	service   *Service
+	notifiers []Notifier
+	loop
+}
+
+// NewDBQuotaJob creates a job measuring the database every interval.
+func NewDBQuotaJob(service *Service, every time.Duration, notifiers ...Notifier) *DBQuotaJob {
+	j := &DBQuotaJob{service: service, notifiers: notifiers}
+	j.loop = loop{every: every, run: j.check}
+	return j
+}
+
+func (j *DBQuotaJob) check(ctx context.Context) {
+	warnings, err := j.service.CheckDBQuota()
+	if err != nil {
+		log.Printf("Database size: %v", err)
+	}
+	for _, w := range warnings {
+		log.Printf("Database size: %s. %s", w.Message, w.Suggestion)
+		for _, n := range j.notifiers {
+			if err := n.Notify(ctx, w.Message+". "+w.Suggestion); err != nil {
+				log.Printf("Database size: notification failed: %v", err)
+			}
+		}
+	}
+}
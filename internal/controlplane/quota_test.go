@@ -0,0 +1,65 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/store"
+)
+
+func TestDBQuota(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	if found, err := s.service.CheckDBQuota(); err != nil || found != nil {
+		t.Fatalf("Expected no check without limits, got %+v, %v", found, err)
+	}
+	s.service.SetDBQuota(DBQuota{MaxBytes: 1 << 40, MaxRows: 2})
+	s.store.CreateTask("One", "")
+	if found, _ := s.service.CheckDBQuota(); len(found) != 0 {
+		t.Fatalf("Expected no warnings under the limits, got %+v", found)
+	}
+
+	s.store.CreateTask("Two", "")
+	found, err := s.service.CheckDBQuota()
+	if err != nil || len(found) != 1 || found[0].Table != store.TableTasks || found[0].Value != 2 || found[0].Suggestion == "" {
+		t.Fatalf("Expected a warning for the tasks table, got %+v, %v", found, err)
+	}
+	if again, _ := s.service.CheckDBQuota(); len(again) != 0 {
+		t.Errorf("Expected the warning reported once, got %d more", len(again))
+	}
+	events, _ := s.service.ListEvents("", time.Time{}, 0)
+	var quota int
+	for _, e := range events {
+		if e.Type == EventDBQuota {
+			quota++
+		}
+	}
+	if quota != 1 {
+		t.Errorf("Expected one %s event, got %d", EventDBQuota, quota)
+	}
+
+	// The warning stays on /stats while the table is over the limit
+	w := httptest.NewRecorder()
+	s.handleStats(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var stats Stats
+	json.NewDecoder(w.Body).Decode(&stats)
+	if len(stats.DBWarnings) != 1 || !strings.Contains(stats.DBWarnings[0].Message, "tasks has 2 rows") {
+		t.Errorf("Expected the warning on /stats, got %+v", stats.DBWarnings)
+	}
+}
+
+func TestDBWarnings(t *testing.T) {
+	size := &store.SizeStats{Bytes: 3 << 29, Rows: map[string]int64{store.TableRunOutput: 50, store.TableTasks: 5}}
+	warnings := dbWarnings(size, DBQuota{MaxBytes: 1 << 30})
+	if len(warnings) != 1 || warnings[0].Table != "" {
+		t.Fatalf("Expected a file size warning, got %+v", warnings)
+	}
+	if !strings.Contains(warnings[0].Message, "1.5 GiB") || !strings.HasPrefix(warnings[0].Suggestion, "run_output has the most rows (50)") {
+		t.Errorf("Unexpected warning %+v", warnings[0])
+	}
+}
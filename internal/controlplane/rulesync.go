@@ -0,0 +1,137 @@
+package controlplane
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// maxRuleFileBytes caps the size of one synced rule file.
+const maxRuleFileBytes = 256 << 10
+
+// RuleFileTag tags memory items synced from rule files.
+const RuleFileTag = "rules"
+
+// RuleFile is a repository file of agent rules or project knowledge, such
+// as AGENTS.md or .cursorrules, as committed in the project.
+type RuleFile struct {
+	// Path is relative to the repository root, with forward slashes.
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// What SyncRuleFiles did with each file.
+const (
+	RuleFileAdded     = "added"
+	RuleFileUpdated   = "updated"
+	RuleFileUnchanged = "unchanged"
+	RuleFileRemoved   = "removed"
+)
+
+// RuleFileStatus is the outcome of syncing one rule file.
+type RuleFileStatus struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	// MemoryID is the item holding the file; it is empty for a removed
+	// file and for a file not yet added by a dry run.
+	MemoryID string `json:"memory_id,omitempty"`
+}
+
+// RuleSyncResult reports a rule file sync.
+type RuleSyncResult struct {
+	Scope string           `json:"scope"`
+	Files []RuleFileStatus `json:"files"`
+	// Stale counts the files that were, or with a dry run would be, added,
+	// updated or removed.
+	Stale  int  `json:"stale"`
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// SyncRuleFiles makes the project's memory reflect its rule files: each
+// file is kept as one item in scope project:<name>, tagged RuleFileTag and
+// tracked by its path and content hash. A file whose hash changed replaces
+// its item, and an item whose file is no longer listed is deleted, so files
+// must be the project's complete set. With dryRun nothing is written and
+// the result says what is stale.
+func (s *Service) SyncRuleFiles(project string, files []RuleFile, dryRun bool) (*RuleSyncResult, error) {
+	scope := models.MemoryScopeProject + project
+	if _, err := scopeLevel(scope); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(files))
+	for i, f := range files {
+		p := path.Clean(f.Path)
+		if f.Path == "" || path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+			return nil, fmt.Errorf("%w: path %q must be relative to the repository root", ErrInvalidRuleFile, f.Path)
+		}
+		if seen[p] {
+			return nil, fmt.Errorf("%w: %s listed twice", ErrInvalidRuleFile, p)
+		}
+		if len(f.Content) > maxRuleFileBytes {
+			return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrInvalidRuleFile, p, maxRuleFileBytes)
+		}
+		seen[p] = true
+		files[i].Path = p
+	}
+
+	existing, err := s.store.ListSourcedMemory(scope)
+	if err != nil {
+		return nil, err
+	}
+	synced := make(map[string]models.MemoryItem, len(existing))
+	for _, item := range existing {
+		synced[item.Source] = item
+	}
+
+	res := &RuleSyncResult{Scope: scope, Files: []RuleFileStatus{}, DryRun: dryRun}
+	for _, f := range files {
+		sum := sha256.Sum256([]byte(f.Content))
+		hash := hex.EncodeToString(sum[:])
+		st := RuleFileStatus{Path: f.Path, Status: RuleFileAdded}
+		if old, ok := synced[f.Path]; ok {
+			st.Status, st.MemoryID = RuleFileUpdated, old.ID
+			if old.SourceHash == hash {
+				st.Status = RuleFileUnchanged
+			}
+		}
+		if st.Status != RuleFileUnchanged {
+			res.Stale++
+			if !dryRun {
+				item, err := s.store.PutSourcedMemory(models.MemoryItem{
+					Content:    f.Content,
+					Tags:       RuleFileTag,
+					Scope:      scope,
+					Source:     f.Path,
+					SourceHash: hash,
+				})
+				if err != nil {
+					return nil, err
+				}
+				st.MemoryID = item.ID
+			}
+		}
+		res.Files = append(res.Files, st)
+	}
+	for _, item := range existing {
+		if seen[item.Source] {
+			continue
+		}
+		res.Stale++
+		if !dryRun {
+			if err := s.store.DeleteSourcedMemory(scope, item.Source); err != nil {
+				return nil, err
+			}
+		}
+		res.Files = append(res.Files, RuleFileStatus{Path: item.Source, Status: RuleFileRemoved})
+	}
+
+	if !dryRun {
+		s.pdr.Record("memory.sync_rules", map[string]int{"files": len(files)}, "success", "",
+			fmt.Sprintf("scope=%s stale=%d", scope, res.Stale))
+	}
+	return res, nil
+}
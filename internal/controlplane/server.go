@@ -3,14 +3,21 @@ package controlplane
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/fentz26/neona/internal/connectors"
+	"github.com/fentz26/neona/internal/connectors/scripts"
+	"github.com/fentz26/neona/internal/crash"
 	"github.com/fentz26/neona/internal/mcp"
 	"github.com/fentz26/neona/internal/models"
 	"github.com/fentz26/neona/internal/store"
+	"github.com/fentz26/neona/internal/transport"
 )
 
 // Version is set at build time or defaults to "dev".
@@ -21,23 +28,41 @@ type SchedulerStatsProvider interface {
 	GetStats() map[string]interface{}
 }
 
-// MCPRouter provides MCP routing for the /mcp/route endpoint.
+// MCPRouter provides MCP routing for the /mcp/route and /tasks/{id}/tools
+// endpoints.
 type MCPRouter interface {
 	Route(ctx context.Context, task mcp.Task) (*mcp.RoutingResult, error)
+	GetToolManifest(mcps []mcp.MCPServer) []mcp.Tool
+}
+
+// ScriptLibrary lists the vetted scripts for the /scripts endpoint.
+type ScriptLibrary interface {
+	Dir() string
+	List() ([]scripts.Script, error)
 }
 
 // Server provides the HTTP API for Neona.
 type Server struct {
 	service   *Service
-	store     *store.Store
+	store     Store
 	addr      string
 	server    *http.Server
 	scheduler SchedulerStatsProvider
 	mcpRouter MCPRouter
+	scripts   ScriptLibrary
+	mws       []Middleware
+	requests  requestCounter
+	leader    LeaderStatus
+	crash     *crash.Reporter
+	cloudSync CloudSync
+
+	adminToken string
+	apiKeys    map[string]string // key hash -> principal
+	viewers    map[string]bool   // read-only principals
 }
 
 // NewServer creates a new HTTP server.
-func NewServer(service *Service, s *store.Store, addr string) *Server {
+func NewServer(service *Service, s Store, addr string) *Server {
 	return &Server{
 		service: service,
 		store:   s,
@@ -57,35 +82,102 @@ func (s *Server) SetMCPRouter(router MCPRouter) {
 	s.mcpRouter = router
 }
 
-// Start starts the HTTP server.
-func (s *Server) Start() error {
+// SetCrashReporter writes a crash report for each handler panic.
+// Must be called before Start() - not safe for concurrent use.
+func (s *Server) SetCrashReporter(r *crash.Reporter) {
+	s.crash = r
+}
+
+// SetScriptLibrary sets the script library for the /scripts endpoint.
+// Must be called before Start() - not safe for concurrent use.
+func (s *Server) SetScriptLibrary(lib ScriptLibrary) {
+	s.scripts = lib
+}
+
+// Use appends middlewares (rate limits, tracing, ...) to the stack that
+// wraps every route. They run inside the default request ID, recovery,
+// logging, metrics, gzip and authentication layers.
+// Must be called before Start() - not safe for concurrent use.
+func (s *Server) Use(mws ...Middleware) {
+	s.mws = append(s.mws, mws...)
+}
+
+// Handler builds the routed handler wrapped in the middleware stack.
+func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 
 	// Task endpoints
 	mux.HandleFunc("/tasks", s.handleTasks)
 	mux.HandleFunc("/tasks/", s.handleTaskByID)
 
+	// Run artifacts
+	mux.HandleFunc("/runs/", s.handleRunByID)
+
 	// Memory endpoints
 	mux.HandleFunc("/memory", s.handleMemory)
+	mux.HandleFunc("/memory/", s.handleMemoryByID)
+	mux.HandleFunc("/memory/sync", s.syncRuleFiles)
 
 	// Worker pool monitor endpoint
 	mux.HandleFunc("/workers", s.handleWorkers)
 
+	// Queue summary for the TUI status bar
+	mux.HandleFunc("/stats", s.handleStats)
+
+	// Vetted scripts for the scripts connector
+	mux.HandleFunc("/scripts", s.handleScripts)
+
+	// Cloud sync state for `neona sync status`
+	mux.HandleFunc("/cloud/status", s.handleCloudStatus)
+
 	// MCP routing endpoint
 	mux.HandleFunc("/mcp/route", s.handleMCPRoute)
 
+	// Holder notifications (e.g. force-released claims)
+	mux.HandleFunc("/events", s.handleEvents)
+
+	// Admin endpoints (admin token required)
+	mux.HandleFunc("/admin/", s.handleAdmin)
+
+	// Lease, lock and worker tables with consistency checks (admin token required)
+	mux.HandleFunc("/debug/state", s.handleDebugState)
+
+	// Lease TTLs and claim limits clients should follow
+	mux.HandleFunc("/config", s.handleConfig)
+
+	// Request and cache metrics in the Prometheus text format
+	mux.HandleFunc("/metrics", s.handleMetrics)
+
 	// Health check with DB ping
 	mux.HandleFunc("/health", s.handleHealth)
 
+	mws := []Middleware{RequestID, recovery(s.crash), Logging, s.countRequests, Gzip}
+	if s.leader != nil {
+		mws = append(mws, s.followerWrites)
+	}
+	mws = append(mws, s.authenticate)
+	return Chain(mux, append(mws, s.mws...)...)
+}
+
+// Start starts the HTTP server.
+func (s *Server) Start() error {
 	s.server = &http.Server{
 		Addr:         s.addr,
-		Handler:      mux,
+		Handler:      s.Handler(),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
 
+	ln, err := transport.Listen(s.addr)
+	if err != nil {
+		return err
+	}
+	if path, ok := transport.SocketPath(s.addr); ok {
+		defer os.Remove(path)
+	}
+
 	log.Printf("Starting Neona daemon on %s", s.addr)
-	return s.server.ListenAndServe()
+	return s.server.Serve(ln)
 }
 
 // Shutdown gracefully shuts down the server.
@@ -99,12 +191,16 @@ type HealthResponse struct {
 	DB      string `json:"db"`
 	Version string `json:"version"`
 	Time    string `json:"time"`
+	// Role is "leader" or "follower" when several daemons share a database.
+	Role string `json:"role,omitempty"`
+
+	Cache *CacheStats `json:"cache,omitempty"`
 }
 
 // handleHealth handles GET /health
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -116,7 +212,10 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		DB:      "ok",
 		Version: Version,
 		Time:    time.Now().UTC().Format(time.RFC3339),
+		Role:    s.role(),
 	}
+	cache := s.service.CacheStats()
+	resp.Cache = &cache
 
 	// Perform lightweight DB ping
 	if err := s.store.Ping(ctx); err != nil {
@@ -138,12 +237,29 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleTasks(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
-		s.createTask(w, r)
+		s.withIdempotency("POST /tasks", w, r, func(w http.ResponseWriter) {
+			s.createTask(w, r)
+		})
 	case http.MethodGet:
 		s.listTasks(w, r)
 	default:
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// resolveTaskID expands a short task ID, replying with a 409 and false if it
+// is ambiguous.
+func (s *Server) resolveTaskID(w http.ResponseWriter, ref string) (string, bool) {
+	id, err := s.service.ResolveTaskID(ref)
+	if errors.Is(err, ErrAmbiguousID) {
+		writeErrorCode(w, err.Error(), CodeAmbiguousID, http.StatusConflict)
+		return "", false
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return "", false
 	}
+	return id, true
 }
 
 // handleTaskByID handles /tasks/{id}/*
@@ -152,7 +268,7 @@ func (s *Server) handleTaskByID(w http.ResponseWriter, r *http.Request) {
 	parts := strings.Split(path, "/")
 
 	if len(parts) == 0 || parts[0] == "" {
-		http.Error(w, "task id required", http.StatusBadRequest)
+		writeError(w, "task id required", http.StatusBadRequest)
 		return
 	}
 
@@ -162,21 +278,56 @@ func (s *Server) handleTaskByID(w http.ResponseWriter, r *http.Request) {
 		action = parts[1]
 	}
 
+	if taskID != "claim-next" {
+		var ok bool
+		if taskID, ok = s.resolveTaskID(w, taskID); !ok {
+			return
+		}
+	}
+
 	switch {
+	case taskID == "claim-next" && action == "" && r.Method == http.MethodPost:
+		s.withIdempotentClaim("POST /tasks/claim-next", w, r, func(w http.ResponseWriter) {
+			s.claimNextTask(w, r)
+		})
 	case action == "" && r.Method == http.MethodGet:
 		s.getTask(w, r, taskID)
 	case action == "claim" && r.Method == http.MethodPost:
-		s.claimTask(w, r, taskID)
+		s.withIdempotentClaim("POST /tasks/"+taskID+"/claim", w, r, func(w http.ResponseWriter) {
+			s.claimTask(w, r, taskID)
+		})
 	case action == "release" && r.Method == http.MethodPost:
 		s.releaseTask(w, r, taskID)
+	case action == "heartbeat" && r.Method == http.MethodPost:
+		s.heartbeatTask(w, r, taskID)
+	case action == "complete" && r.Method == http.MethodPost:
+		s.completeTask(w, r, taskID)
 	case action == "run" && r.Method == http.MethodPost:
 		s.runTask(w, r, taskID)
+	case action == "pipeline" && r.Method == http.MethodPost:
+		s.runPipeline(w, r, taskID)
+	case action == "runs" && r.Method == http.MethodPost:
+		s.recordRun(w, r, taskID)
 	case action == "logs" && r.Method == http.MethodGet:
 		s.getTaskLogs(w, r, taskID)
 	case action == "memory" && r.Method == http.MethodGet:
 		s.getTaskMemory(w, r, taskID)
+	case action == "tools" && r.Method == http.MethodGet:
+		s.getTaskTools(w, r, taskID)
+	case action == "comments" && r.Method == http.MethodGet:
+		s.listComments(w, r, taskID)
+	case action == "comments" && r.Method == http.MethodPost:
+		s.addComment(w, r, taskID)
+	case action == "subtasks" && r.Method == http.MethodGet:
+		s.listSubtasks(w, r, taskID)
+	case action == "checklist" && len(parts) == 2 && r.Method == http.MethodGet:
+		s.listChecklist(w, r, taskID)
+	case action == "checklist" && len(parts) == 2 && r.Method == http.MethodPost:
+		s.addChecklistItems(w, r, taskID)
+	case action == "checklist" && len(parts) == 4 && (parts[3] == "check" || parts[3] == "uncheck") && r.Method == http.MethodPost:
+		s.checkItem(w, r, taskID, parts[2], parts[3] == "check")
 	default:
-		http.Error(w, "not found", http.StatusNotFound)
+		writeError(w, "not found", http.StatusNotFound)
 	}
 }
 
@@ -188,27 +339,58 @@ func (s *Server) handleMemory(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		s.queryMemory(w, r)
 	default:
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 // --- Task Handlers ---
 
 type createTaskRequest struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	MutexKey    string   `json:"mutex_key"`
+	Labels      []string `json:"labels"`
+	Connector   string   `json:"connector"`
+	WorkDir     string   `json:"workdir"`
+
+	AcceptanceCriteria []string         `json:"acceptance_criteria"`
+	Commands           []string         `json:"commands"`
+	Steps              []models.RunStep `json:"steps"`
+	ParentID           string           `json:"parent_id"`
+	Priority           int              `json:"priority"`
+	EstimateSec        int              `json:"estimate_sec"`
+	DueAt              *time.Time       `json:"due_at"`
+	NotBefore          *time.Time       `json:"not_before"`
 }
 
 func (s *Server) createTask(w http.ResponseWriter, r *http.Request) {
 	var req createTaskRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		writeError(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
-	task, err := s.service.CreateTask(req.Title, req.Description)
+	task, err := s.service.CreateTask(req.Title, req.Description, store.TaskOptions{
+		MutexKey:  req.MutexKey,
+		Labels:    req.Labels,
+		Connector: req.Connector,
+		WorkDir:   req.WorkDir,
+
+		AcceptanceCriteria: req.AcceptanceCriteria,
+		Commands:           req.Commands,
+		Steps:              req.Steps,
+		ParentID:           req.ParentID,
+		Priority:           req.Priority,
+		EstimateSec:        req.EstimateSec,
+		DueAt:              req.DueAt,
+		NotBefore:          req.NotBefore,
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrInvalidWorkDir) || errors.Is(err, ErrInvalidSpec) || errors.Is(err, ErrInvalidParent) || errors.Is(err, ErrInvalidArgs) {
+			status = http.StatusBadRequest
+		}
+		writeError(w, err.Error(), status)
 		return
 	}
 
@@ -217,11 +399,26 @@ func (s *Server) createTask(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(task)
 }
 
+// listSubtasks handles GET /tasks/{id}/subtasks.
+func (s *Server) listSubtasks(w http.ResponseWriter, r *http.Request, taskID string) {
+	tasks, err := s.service.ListSubtasks(taskID)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tasks == nil {
+		tasks = []models.Task{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tasks)
+}
+
 func (s *Server) listTasks(w http.ResponseWriter, r *http.Request) {
 	status := r.URL.Query().Get("status")
 	tasks, err := s.service.ListTasks(status)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -234,13 +431,17 @@ func (s *Server) listTasks(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) getTask(w http.ResponseWriter, r *http.Request, taskID string) {
+	if r.URL.Query().Get("expand") != "" {
+		s.getTaskView(w, r, taskID)
+		return
+	}
 	task, err := s.service.GetTask(taskID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	if task == nil {
-		http.Error(w, "task not found", http.StatusNotFound)
+		writeError(w, "task not found", http.StatusNotFound)
 		return
 	}
 
@@ -249,28 +450,35 @@ func (s *Server) getTask(w http.ResponseWriter, r *http.Request, taskID string)
 }
 
 type claimRequest struct {
-	HolderID string `json:"holder_id"`
-	TTLSec   int    `json:"ttl_sec"`
+	HolderID    string `json:"holder_id"`
+	HolderToken string `json:"holder_token"` // heartbeat only
+	TTLSec      int    `json:"ttl_sec"`
 }
 
 func (s *Server) claimTask(w http.ResponseWriter, r *http.Request, taskID string) {
 	var req claimRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		writeError(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
-	if req.TTLSec == 0 {
-		req.TTLSec = 300 // default 5 minutes
+	if !requireHolder(w, r, req.HolderID) {
+		return
 	}
 
 	lease, err := s.service.ClaimTask(taskID, req.HolderID, req.TTLSec)
 	if err != nil {
 		status := http.StatusInternalServerError
-		if err == ErrAlreadyClaimed {
+		if errors.Is(err, ErrClaimLimit) {
+			writeErrorCode(w, err.Error(), CodeClaimLimit, http.StatusConflict)
+			return
+		}
+		if err == ErrAlreadyClaimed || err == ErrNotPending {
 			status = http.StatusConflict
+		} else if err == ErrNotFound {
+			status = http.StatusNotFound
 		}
-		http.Error(w, err.Error(), status)
+		writeError(w, err.Error(), status)
 		return
 	}
 
@@ -278,14 +486,57 @@ func (s *Server) claimTask(w http.ResponseWriter, r *http.Request, taskID string
 	json.NewEncoder(w).Encode(lease)
 }
 
+type claimNextRequest struct {
+	HolderID  string `json:"holder_id"`
+	TTLSec    int    `json:"ttl_sec"`
+	Label     string `json:"label"`
+	Connector string `json:"connector"`
+}
+
+// claimNextTask handles POST /tasks/claim-next. It responds 204 when no
+// pending task matches.
+func (s *Server) claimNextTask(w http.ResponseWriter, r *http.Request) {
+	var req claimNextRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if !requireHolder(w, r, req.HolderID) {
+		return
+	}
+	result, err := s.service.ClaimNextTask(req.HolderID, req.TTLSec, store.ClaimFilter{
+		Label:     req.Label,
+		Connector: req.Connector,
+	})
+	if errors.Is(err, ErrClaimLimit) {
+		writeErrorCode(w, err.Error(), CodeClaimLimit, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
 type releaseRequest struct {
-	HolderID string `json:"holder_id"`
+	HolderID    string `json:"holder_id"`
+	HolderToken string `json:"holder_token"`
 }
 
 func (s *Server) releaseTask(w http.ResponseWriter, r *http.Request, taskID string) {
 	var req releaseRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		writeError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if !s.authorizeHolder(w, r, taskID, req.HolderID, req.HolderToken) {
 		return
 	}
 
@@ -294,7 +545,7 @@ func (s *Server) releaseTask(w http.ResponseWriter, r *http.Request, taskID stri
 		if err == ErrNotOwner || err == ErrNoLease {
 			status = http.StatusForbidden
 		}
-		http.Error(w, err.Error(), status)
+		writeError(w, err.Error(), status)
 		return
 	}
 
@@ -302,26 +553,216 @@ func (s *Server) releaseTask(w http.ResponseWriter, r *http.Request, taskID stri
 	w.Write([]byte(`{"status":"released"}`))
 }
 
+// heartbeatTask handles POST /tasks/{id}/heartbeat, renewing the holder's lease.
+func (s *Server) heartbeatTask(w http.ResponseWriter, r *http.Request, taskID string) {
+	var req claimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if !s.authorizeHolder(w, r, taskID, req.HolderID, req.HolderToken) {
+		return
+	}
+
+	if err := s.service.RenewLease(taskID, req.HolderID, req.TTLSec); err != nil {
+		status := http.StatusInternalServerError
+		if err == ErrNotOwner {
+			status = http.StatusForbidden
+		}
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"renewed"}`))
+}
+
+func (s *Server) completeTask(w http.ResponseWriter, r *http.Request, taskID string) {
+	var req releaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if !s.authorizeHolder(w, r, taskID, req.HolderID, req.HolderToken) {
+		return
+	}
+
+	if err := s.service.CompleteTask(taskID, req.HolderID); err != nil {
+		status := http.StatusInternalServerError
+		if err == ErrNotOwner || err == ErrNoLease {
+			status = http.StatusForbidden
+		} else if errors.Is(err, ErrChecklistIncomplete) || errors.Is(err, ErrOpenSubtasks) {
+			status = http.StatusConflict
+		}
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"completed"}`))
+}
+
 type runRequest struct {
-	HolderID string   `json:"holder_id"`
-	Command  string   `json:"command"`
-	Args     []string `json:"args"`
+	HolderID    string            `json:"holder_id"`
+	HolderToken string            `json:"holder_token"`
+	Command     string            `json:"command"`
+	Args        []string          `json:"args"`
+	Stdin       string            `json:"stdin"`       // fed to the command's standard input
+	PTY         bool              `json:"pty"`         // run on a pseudo-terminal
+	Env         map[string]string `json:"env"`         // names must be allowlisted
+	TimeoutSec  int               `json:"timeout_sec"` // stop the command after this many seconds
+	DryRun      bool              `json:"dry_run"`     // check and describe the run without executing it
 }
 
 func (s *Server) runTask(w http.ResponseWriter, r *http.Request, taskID string) {
 	var req runRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		writeError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if !s.authorizeHolder(w, r, taskID, req.HolderID, req.HolderToken) {
+		return
+	}
+
+	if req.TimeoutSec < 0 {
+		writeError(w, "timeout_sec must not be negative", http.StatusBadRequest)
+		return
+	}
+	opts := RunOptions{
+		Input:   connectors.Input{Stdin: []byte(req.Stdin), PTY: req.PTY},
+		Env:     req.Env,
+		Timeout: time.Duration(req.TimeoutSec) * time.Second,
+	}
+	if req.DryRun {
+		s.planRun(w, r, taskID, req, opts)
+		return
+	}
+
+	run, err := s.service.RunTask(taskID, req.HolderID, req.Command, req.Args, opts)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+type pipelineRequest struct {
+	HolderID    string            `json:"holder_id"`
+	HolderToken string            `json:"holder_token"`
+	Env         map[string]string `json:"env"` // set for every step; names must be allowlisted
+}
+
+// runPipeline handles POST /tasks/{id}/pipeline, running the task's steps.
+func (s *Server) runPipeline(w http.ResponseWriter, r *http.Request, taskID string) {
+	var req pipelineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if !s.authorizeHolder(w, r, taskID, req.HolderID, req.HolderToken) {
+		return
+	}
+
+	res, err := s.service.RunPipeline(taskID, req.HolderID, RunOptions{Env: req.Env})
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// planRun answers a dry run request with the run's plan, including the MCP
+// servers the task would be routed to.
+func (s *Server) planRun(w http.ResponseWriter, r *http.Request, taskID string, req runRequest, opts RunOptions) {
+	plan, err := s.service.PlanRun(taskID, req.HolderID, req.Command, req.Args, opts)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+
+	if s.mcpRouter != nil {
+		task, err := s.service.GetTask(taskID)
+		if err == nil && task != nil {
+			result, err := s.mcpRouter.Route(r.Context(), mcp.Task{ID: task.ID, Title: task.Title, Description: task.Description})
+			if err != nil {
+				log.Printf("MCP routing failed for task %s: %v", task.ID, err)
+			} else {
+				for _, m := range result.SelectedMCPs {
+					plan.MCPServers = append(plan.MCPServers, m.Name)
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// writeRunError maps a RunTask or PlanRun error to its response. Denied
+// commands get a JSON body naming the closest allowed commands.
+func writeRunError(w http.ResponseWriter, err error) {
+	var denied *connectors.CommandDeniedError
+	if errors.As(err, &denied) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(struct {
+			ErrorResponse
+			*connectors.CommandDeniedError
+		}{ErrorResponse{denied.Error(), CodeCommandDenied}, denied})
+		return
+	}
+
+	status := http.StatusInternalServerError
+	if err == ErrNotOwner {
+		status = http.StatusForbidden
+	} else if errors.Is(err, ErrInvalidWorkDir) || err == ErrNoSteps {
+		status = http.StatusConflict
+	} else if err == ErrNotFound {
+		status = http.StatusNotFound
+	} else if errors.Is(err, ErrEnvNotAllowed) || errors.Is(err, ErrInvalidArgs) || errors.Is(err, ErrUnsupported) {
+		status = http.StatusBadRequest
+	}
+	writeError(w, err.Error(), status)
+}
+
+type recordRunRequest struct {
+	HolderID    string   `json:"holder_id"`
+	HolderToken string   `json:"holder_token"`
+	Command     string   `json:"command"`
+	Args        []string `json:"args"`
+	ExitCode    int      `json:"exit_code"`
+	Stdout      string   `json:"stdout"`
+	Stderr      string   `json:"stderr"`
+}
+
+// recordRun handles POST /tasks/{id}/runs, storing a run the holder executed
+// outside the daemon.
+func (s *Server) recordRun(w http.ResponseWriter, r *http.Request, taskID string) {
+	var req recordRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.Command == "" {
+		writeError(w, "command required", http.StatusBadRequest)
+		return
+	}
+	if !s.authorizeHolder(w, r, taskID, req.HolderID, req.HolderToken) {
 		return
 	}
 
-	run, err := s.service.RunTask(taskID, req.HolderID, req.Command, req.Args)
+	run, err := s.service.RecordRun(taskID, req.HolderID, req.Command, req.Args, req.ExitCode, req.Stdout, req.Stderr)
 	if err != nil {
 		status := http.StatusInternalServerError
 		if err == ErrNotOwner {
 			status = http.StatusForbidden
 		}
-		http.Error(w, err.Error(), status)
+		writeError(w, err.Error(), status)
 		return
 	}
 
@@ -329,10 +770,37 @@ func (s *Server) runTask(w http.ResponseWriter, r *http.Request, taskID string)
 	json.NewEncoder(w).Encode(run)
 }
 
+// Page sizes for GET /tasks/{id}/logs.
+const (
+	defaultLogsLimit = 20
+	maxLogsLimit     = 200
+)
+
+// getTaskLogs handles GET /tasks/{id}/logs. Runs are returned newest first
+// in pages of ?limit= (default 20, at most 200) starting at ?offset=; the
+// X-Total-Count header carries the task's run count.
 func (s *Server) getTaskLogs(w http.ResponseWriter, r *http.Request, taskID string) {
-	runs, err := s.service.GetTaskLogs(taskID)
+	limit, offset := defaultLogsLimit, 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxLogsLimit)
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	runs, total, err := s.service.ListTaskLogs(taskID, limit, offset)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -341,13 +809,14 @@ func (s *Server) getTaskLogs(w http.ResponseWriter, r *http.Request, taskID stri
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
 	json.NewEncoder(w).Encode(runs)
 }
 
 func (s *Server) getTaskMemory(w http.ResponseWriter, r *http.Request, taskID string) {
 	items, err := s.service.GetTaskMemory(taskID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -359,37 +828,204 @@ func (s *Server) getTaskMemory(w http.ResponseWriter, r *http.Request, taskID st
 	json.NewEncoder(w).Encode(items)
 }
 
+// toolManifestServer describes a selected MCP server. ToolsListed is false
+// when the registry only knows the server's tool count, in which case agents
+// should expose all of that server's local tools.
+type toolManifestServer struct {
+	Name        string   `json:"name"`
+	ToolCount   int      `json:"tool_count"`
+	Categories  []string `json:"categories,omitempty"`
+	ToolsListed bool     `json:"tools_listed"`
+}
+
+type toolManifestEntry struct {
+	Name        string `json:"name"` // namespaced: <server>__<tool>
+	Tool        string `json:"tool"`
+	Server      string `json:"server"`
+	Description string `json:"description,omitempty"`
+}
+
+type toolManifestResponse struct {
+	TaskID        string               `json:"task_id"`
+	Strategy      string               `json:"strategy,omitempty"`
+	Servers       []toolManifestServer `json:"servers"`
+	Tools         []toolManifestEntry  `json:"tools"`
+	TotalTools    int                  `json:"total_tools"`
+	FilteredTools int                  `json:"filtered_tools"`
+}
+
+// getTaskTools handles GET /tasks/{id}/tools, returning the tools the router
+// selected for the task so agents can expose exactly those.
+func (s *Server) getTaskTools(w http.ResponseWriter, r *http.Request, taskID string) {
+	if s.mcpRouter == nil {
+		writeError(w, "MCP router not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	task, err := s.service.GetTask(taskID)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if task == nil {
+		writeError(w, "task not found", http.StatusNotFound)
+		return
+	}
+
+	result, err := s.mcpRouter.Route(r.Context(), mcp.Task{ID: task.ID, Title: task.Title, Description: task.Description})
+	if err != nil {
+		log.Printf("MCP routing failed for task %s: %v", task.ID, err)
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := toolManifestResponse{
+		TaskID:        task.ID,
+		Strategy:      result.Strategy,
+		Servers:       make([]toolManifestServer, len(result.SelectedMCPs)),
+		Tools:         []toolManifestEntry{},
+		TotalTools:    result.TotalTools,
+		FilteredTools: result.FilteredTools,
+	}
+	for i, m := range result.SelectedMCPs {
+		resp.Servers[i] = toolManifestServer{
+			Name:        m.Name,
+			ToolCount:   m.ToolCount,
+			Categories:  m.Categories,
+			ToolsListed: len(m.Tools) > 0,
+		}
+	}
+	for _, tool := range s.mcpRouter.GetToolManifest(result.SelectedMCPs) {
+		resp.Tools = append(resp.Tools, toolManifestEntry{
+			Name:        tool.NamespacedName(),
+			Tool:        tool.Name,
+			Server:      tool.Server,
+			Description: tool.Description,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// --- Run Handlers ---
+
+// handleRunByID handles /runs/{id}/*
+func (s *Server) handleRunByID(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/runs/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		writeError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case parts[1] == "diff" && r.Method == http.MethodGet:
+		s.getRunDiff(w, r, parts[0])
+	case parts[1] == "retry" && r.Method == http.MethodPost:
+		s.retryRun(w, r, parts[0])
+	default:
+		writeError(w, "not found", http.StatusNotFound)
+	}
+}
+
+// getRunDiff handles GET /runs/{id}/diff, returning the workdir diff
+// captured when the run ended as a unified diff.
+func (s *Server) getRunDiff(w http.ResponseWriter, r *http.Request, runID string) {
+	diff, err := s.service.GetRunDiff(runID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == ErrNotFound {
+			status = http.StatusNotFound
+			err = errors.New("run not found or has no diff")
+		}
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	w.Write([]byte(diff))
+}
+
+type retryRunRequest struct {
+	HolderID    string            `json:"holder_id"`
+	HolderToken string            `json:"holder_token"`
+	Stdin       string            `json:"stdin"`
+	Env         map[string]string `json:"env"` // names must be allowlisted
+}
+
+// retryRun handles POST /runs/{id}/retry, re-executing the run's command
+// for its task as the task's holder.
+func (s *Server) retryRun(w http.ResponseWriter, r *http.Request, runID string) {
+	var req retryRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	prev, err := s.service.GetRun(runID)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+	if !s.authorizeHolder(w, r, prev.TaskID, req.HolderID, req.HolderToken) {
+		return
+	}
+
+	run, err := s.service.RetryRun(runID, req.HolderID, RunOptions{Input: connectors.Input{Stdin: []byte(req.Stdin)}, Env: req.Env})
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
 // --- Memory Handlers ---
 
 type addMemoryRequest struct {
 	TaskID  string `json:"task_id"`
 	Content string `json:"content"`
 	Tags    string `json:"tags"`
+	Scope   string `json:"scope"`
 }
 
 func (s *Server) addMemory(w http.ResponseWriter, r *http.Request) {
 	var req addMemoryRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		writeError(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
-	item, err := s.service.AddMemory(req.TaskID, req.Content, req.Tags)
+	item, err := s.service.AddMemory(req.TaskID, req.Content, req.Tags, req.Scope)
+	if errors.Is(err, ErrInvalidScope) {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// A duplicate returns the existing item rather than creating one
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	if !item.Duplicate {
+		w.WriteHeader(http.StatusCreated)
+	}
 	json.NewEncoder(w).Encode(item)
 }
 
+// queryMemory handles GET /memory?q=&scope=, where scope is a
+// comma-separated list such as project:web,global.
 func (s *Server) queryMemory(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
-	items, err := s.service.QueryMemory(query)
+	scopes, err := ParseScopes(r.URL.Query().Get("scope"))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items, err := s.service.QueryMemory(query, scopes...)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -401,12 +1037,113 @@ func (s *Server) queryMemory(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(items)
 }
 
+// handleMemoryByID routes /memory/{id}/... requests.
+func (s *Server) handleMemoryByID(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/memory/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		writeError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case parts[1] == "promote" && r.Method == http.MethodPost:
+		s.promoteMemory(w, r, parts[0])
+	default:
+		writeError(w, "not found", http.StatusNotFound)
+	}
+}
+
+type promoteMemoryRequest struct {
+	Scope string `json:"scope"`
+}
+
+// promoteMemory handles POST /memory/{id}/promote, moving the item to the
+// wider scope given in the body.
+func (s *Server) promoteMemory(w http.ResponseWriter, r *http.Request, id string) {
+	var req promoteMemoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	item, err := s.service.PromoteMemory(id, req.Scope)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == ErrNotFound {
+			status = http.StatusNotFound
+			err = errors.New("memory item not found")
+		} else if errors.Is(err, ErrInvalidScope) {
+			status = http.StatusBadRequest
+		}
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+type syncRuleFilesRequest struct {
+	Project string     `json:"project"`
+	Files   []RuleFile `json:"files"`
+	DryRun  bool       `json:"dry_run"`
+}
+
+// syncRuleFiles handles POST /memory/sync, bringing the project's memory in
+// line with the complete set of rule files in the body.
+func (s *Server) syncRuleFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req syncRuleFilesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	res, err := s.service.SyncRuleFiles(req.Project, req.Files, req.DryRun)
+	if errors.Is(err, ErrInvalidScope) || errors.Is(err, ErrInvalidRuleFile) {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
 // --- Worker Pool Handlers ---
 
 // handleWorkers handles GET /workers
+func (s *Server) handleScripts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := map[string]interface{}{"enabled": s.scripts != nil, "scripts": []scripts.Script{}}
+	if s.scripts != nil {
+		list, err := s.scripts.List()
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if list != nil {
+			resp["scripts"] = list
+		}
+		resp["dir"] = s.scripts.Dir()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
 func (s *Server) handleWorkers(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -414,15 +1151,24 @@ func (s *Server) handleWorkers(w http.ResponseWriter, r *http.Request) {
 		// Return empty response if scheduler not configured
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
+			"running":          false,
 			"active_workers":   0,
 			"global_max":       0,
 			"connector_counts": map[string]int{},
+			"label_limits":     map[string]interface{}{},
 			"workers":          []interface{}{},
+			"rate_limits":      map[string]interface{}{},
+			"throttled_tasks":  0,
+			"claims":           store.ClaimStats{},
+			"api_claims":       s.service.ClaimStats(),
 		})
 		return
 	}
 
+	// Claims by the scheduler and by external workers side by side show
+	// how much they contend
 	stats := s.scheduler.GetStats()
+	stats["api_claims"] = s.service.ClaimStats()
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
@@ -451,23 +1197,23 @@ type mcpServerInfo struct {
 // handleMCPRoute handles POST /mcp/route
 func (s *Server) handleMCPRoute(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	if s.mcpRouter == nil {
-		http.Error(w, "MCP router not configured", http.StatusServiceUnavailable)
+		writeError(w, "MCP router not configured", http.StatusServiceUnavailable)
 		return
 	}
 
 	var req mcpRouteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		writeError(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
 	if req.Title == "" {
-		http.Error(w, "title is required", http.StatusBadRequest)
+		writeError(w, "title is required", http.StatusBadRequest)
 		return
 	}
 
@@ -478,9 +1224,9 @@ func (s *Server) handleMCPRoute(w http.ResponseWriter, r *http.Request) {
 
 	result, err := s.mcpRouter.Route(r.Context(), task)
 	if err != nil {
-	    log.Printf("MCP routing failed: %v", err)
-	    http.Error(w, "internal server error", http.StatusInternalServerError)
-	    return
+		log.Printf("MCP routing failed: %v", err)
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
 	}
 
 	// Build response
@@ -498,9 +1244,9 @@ func (s *Server) handleMCPRoute(w http.ResponseWriter, r *http.Request) {
 		TotalTools:   result.TotalTools,
 		ToolBudget:   80, // Default budget
 	}
-w.Header().Set("Content-Type", "application/json")
-if err := json.NewEncoder(w).Encode(resp); err != nil {
-    log.Printf("Failed to encode MCP route response: %v", err)
-}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode MCP route response: %v", err)
+	}
 	json.NewEncoder(w).Encode(resp)
 }
@@ -1,15 +1,25 @@
 package controlplane
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/fentz26/neona/internal/audit"
+	"github.com/fentz26/neona/internal/cloudsync"
+	"github.com/fentz26/neona/internal/connectors"
 	"github.com/fentz26/neona/internal/connectors/localexec"
+	"github.com/fentz26/neona/internal/connectors/scripts"
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/scheduler"
 	"github.com/fentz26/neona/internal/store"
 )
 
@@ -126,3 +136,823 @@ func newTestServer(t *testing.T) (*Server, func()) {
 
 	return server, cleanup
 }
+
+func TestExternalRunLifecycle(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return w
+	}
+
+	task, _ := s.service.CreateTask("External", "", store.TaskOptions{})
+	base := "/tasks/" + task.ID
+	w := post(base+"/claim", `{"holder_id":"cli@host","ttl_sec":30}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("claim: expected 200, got %d", w.Code)
+	}
+	var lease models.Lease
+	json.NewDecoder(w.Body).Decode(&lease)
+	tok := `"holder_token":"` + lease.HolderToken + `"`
+
+	if w := post(base+"/heartbeat", `{"holder_id":"other","ttl_sec":30}`); w.Code != http.StatusForbidden {
+		t.Errorf("heartbeat by non-holder: expected 403, got %d", w.Code)
+	}
+	if w := post(base+"/heartbeat", `{"holder_id":"cli@host","ttl_sec":30,`+tok+`}`); w.Code != http.StatusOK {
+		t.Errorf("heartbeat: expected 200, got %d", w.Code)
+	}
+
+	if w := post(base+"/runs", `{"holder_id":"other","command":"go","args":["test"]}`); w.Code != http.StatusForbidden {
+		t.Errorf("record run by non-holder: expected 403, got %d", w.Code)
+	}
+	if w := post(base+"/runs", `{"holder_id":"cli@host","command":"go","args":["test"],"exit_code":0,"stdout":"ok",`+tok+`}`); w.Code != http.StatusOK {
+		t.Fatalf("record run: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	runs, _ := s.service.GetTaskLogs(task.ID)
+	if len(runs) != 1 || runs[0].Stdout != "ok" {
+		t.Errorf("Expected recorded run with stdout, got %+v", runs)
+	}
+
+	if w := post(base+"/complete", `{"holder_id":"other"}`); w.Code != http.StatusForbidden {
+		t.Errorf("complete by non-holder: expected 403, got %d", w.Code)
+	}
+	if w := post(base+"/complete", `{"holder_id":"cli@host",`+tok+`}`); w.Code != http.StatusOK {
+		t.Fatalf("complete: expected 200, got %d", w.Code)
+	}
+	got, _ := s.service.GetTask(task.ID)
+	if got.Status != models.TaskStatusCompleted {
+		t.Errorf("Expected completed, got %s", got.Status)
+	}
+	if w := post(base+"/heartbeat", `{"holder_id":"cli@host",`+tok+`}`); w.Code != http.StatusForbidden {
+		t.Errorf("heartbeat after complete: expected 403, got %d", w.Code)
+	}
+}
+
+func TestRunPassesInput(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := &dirConnector{}
+	s.service.connector = conn
+
+	task, _ := s.service.CreateTask("Interactive", "", store.TaskOptions{})
+	token := claimForTest(t, s, task.ID, "worker-1", nil)
+
+	body := `{"holder_id":"worker-1","holder_token":"` + token + `","command":"git","args":["status"],"stdin":"y\n","pty":true}`
+	if w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", body, nil); w.Code != http.StatusOK {
+		t.Fatalf("run: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(conn.inputs) != 1 || string(conn.inputs[0].Stdin) != "y\n" || !conn.inputs[0].PTY {
+		t.Errorf("Expected stdin and PTY passed to the connector, got %+v", conn.inputs)
+	}
+}
+
+func TestRunEnvAllowlist(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	s.service.connector = &dirConnector{}
+
+	task, _ := s.service.CreateTask("Env", "", store.TaskOptions{})
+	token := claimForTest(t, s, task.ID, "worker-1", nil)
+	run := func(env string) int {
+		body := `{"holder_id":"worker-1","holder_token":"` + token + `","command":"git","args":["status"],"env":` + env + `}`
+		return doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", body, nil).Code
+	}
+
+	if code := run(`{"LD_PRELOAD":"/tmp/evil.so"}`); code != http.StatusBadRequest {
+		t.Errorf("disallowed variable: expected 400, got %d", code)
+	}
+	if code := run(`{"CI":"1","NEONA_STEP":"lint"}`); code != http.StatusOK {
+		t.Errorf("allowlisted variables: expected 200, got %d", code)
+	}
+}
+
+func TestTaskLogsPagination(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	task, _ := s.service.CreateTask("Logs", "", store.TaskOptions{})
+	for i := 0; i < 3; i++ {
+		run, _ := s.service.store.CreateRun(task.ID, "git", []string{"status"})
+		s.service.store.FinishRun(run)
+	}
+
+	w := doRequest(s, http.MethodGet, "/tasks/"+task.ID+"/logs?limit=2&offset=2", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("logs: expected 200, got %d", w.Code)
+	}
+	var runs []models.Run
+	json.NewDecoder(w.Body).Decode(&runs)
+	if len(runs) != 1 {
+		t.Errorf("Expected 1 run on the second page, got %d", len(runs))
+	}
+	if total := w.Header().Get("X-Total-Count"); total != "3" {
+		t.Errorf("X-Total-Count = %q, want 3", total)
+	}
+
+	if w := doRequest(s, http.MethodGet, "/tasks/"+task.ID+"/logs?limit=0", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("limit=0: expected 400, got %d", w.Code)
+	}
+}
+
+func TestRunDeniedCommand(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	task, _ := s.service.CreateTask("Denied", "", store.TaskOptions{})
+	token := claimForTest(t, s, task.ID, "worker-1", nil)
+
+	body := `{"holder_id":"worker-1","holder_token":"` + token + `","command":"git","args":["stauts"]}`
+	w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", body, nil)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("run: expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Error       string   `json:"error"`
+		Code        string   `json:"code"`
+		Command     string   `json:"command"`
+		Suggestions []string `json:"suggestions"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Code != CodeCommandDenied || resp.Command != "git" || len(resp.Suggestions) == 0 || resp.Suggestions[0] != "git status" {
+		t.Errorf("Unexpected denial: %+v", resp)
+	}
+
+	// Nothing ran and the task keeps its claim
+	if runs, _ := s.service.GetTaskLogs(task.ID); len(runs) != 0 {
+		t.Errorf("Expected no runs, got %d", len(runs))
+	}
+	if got, _ := s.service.GetTask(task.ID); got.Status != models.TaskStatusClaimed {
+		t.Errorf("Expected task to stay claimed, got %s", got.Status)
+	}
+
+	counts, _ := s.service.store.(*store.Store).CountPDRBetween(time.Time{}, time.Now().Add(time.Minute))
+	found := false
+	for _, c := range counts {
+		found = found || (c.Action == "task.run.denied" && c.Outcome == "denied")
+	}
+	if !found {
+		t.Errorf("Expected a task.run.denied audit record, got %+v", counts)
+	}
+
+	metrics := doRequest(s, http.MethodGet, "/metrics", "", nil).Body.String()
+	if !strings.Contains(metrics, `neona_commands_denied_total{command="git"} 1`) {
+		t.Errorf("Metrics missing denied counter:\n%s", metrics)
+	}
+}
+
+func TestRunPipeline(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	s.service.connector = &exitConnector{}
+
+	steps := `[{"command":"false","continue_on_error":true},{"command":"git","args":["status"]},{"command":"false"},{"command":"make"}]`
+	w := doRequest(s, http.MethodPost, "/tasks", `{"title":"Pipeline","steps":`+steps+`}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var task models.Task
+	json.NewDecoder(w.Body).Decode(&task)
+	if len(task.Steps) != 4 || !task.Steps[0].ContinueOnError || task.Steps[1].Args[0] != "status" {
+		t.Fatalf("Unexpected steps: %+v", task.Steps)
+	}
+	token := claimForTest(t, s, task.ID, "worker-1", nil)
+
+	w = doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/pipeline", `{"holder_id":"worker-1","holder_token":"`+token+`"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("pipeline: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var res PipelineResult
+	json.NewDecoder(w.Body).Decode(&res)
+	if res.Status != models.TaskStatusFailed || len(res.Runs) != 3 || res.Skipped != 1 {
+		t.Errorf("Expected the pipeline to stop at the third step, got %s with %d runs, %d skipped", res.Status, len(res.Runs), res.Skipped)
+	}
+	if runs, _ := s.service.GetTaskLogs(task.ID); len(runs) != 3 {
+		t.Errorf("Expected a run recorded per step, got %d", len(runs))
+	}
+	if got, _ := s.service.GetTask(task.ID); got.Status != models.TaskStatusFailed {
+		t.Errorf("Expected the task failed, got %s", got.Status)
+	}
+
+	other, _ := s.service.CreateTask("No steps", "", store.TaskOptions{})
+	token = claimForTest(t, s, other.ID, "worker-1", nil)
+	if w := doRequest(s, http.MethodPost, "/tasks/"+other.ID+"/pipeline", `{"holder_id":"worker-1","holder_token":"`+token+`"}`, nil); w.Code != http.StatusConflict {
+		t.Errorf("task without steps: expected 409, got %d", w.Code)
+	}
+	if w := doRequest(s, http.MethodPost, "/tasks", `{"title":"Bad","steps":[{"command":" "}]}`, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("step without a command: expected 400, got %d", w.Code)
+	}
+}
+
+func TestRunPipelineOutputs(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	s.service.connector = &exitConnector{}
+
+	steps := `[
+		{"name":"version","command":"echo","args":["{\"tag\":\"v1.2\"}"],"outputs":[{"name":"tag","json":"tag"}]},
+		{"name":"build","command":"echo","args":["built {{version.tag}}"],"outputs":[{"name":"artifact","regex":"built (\\S+)"}]},
+		{"command":"false","args":["{{build.artifact}}"],"when":"version.exit_code == 0","continue_on_error":true},
+		{"command":"notify","when":"failure"}
+	]`
+	w := doRequest(s, http.MethodPost, "/tasks", `{"title":"Release","steps":`+steps+`}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var task models.Task
+	json.NewDecoder(w.Body).Decode(&task)
+	token := claimForTest(t, s, task.ID, "worker-1", nil)
+
+	w = doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/pipeline", `{"holder_id":"worker-1","holder_token":"`+token+`"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("pipeline: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var res PipelineResult
+	json.NewDecoder(w.Body).Decode(&res)
+	if res.Status != models.TaskStatusCompleted || len(res.Runs) != 3 || res.Skipped != 1 {
+		t.Fatalf("Expected three runs and the failure step skipped, got %s with %d runs, %d skipped", res.Status, len(res.Runs), res.Skipped)
+	}
+	if got := res.Runs[2].Args; len(got) != 1 || got[0] != "v1.2" {
+		t.Errorf("Expected the captured artifact passed on, got %v", got)
+	}
+	if res.Outputs["version"]["tag"] != "v1.2" || res.Outputs["build"]["artifact"] != "v1.2" {
+		t.Errorf("Unexpected outputs: %v", res.Outputs)
+	}
+
+	for _, bad := range []string{
+		`[{"command":"echo","args":["{{later.out}}"]},{"name":"later","command":"echo"}]`,
+		`[{"name":"a","command":"echo"},{"command":"echo","args":["{{a.missing}}"]}]`,
+		`[{"command":"echo","when":"sometimes"}]`,
+		`[{"name":"a","command":"echo","outputs":[{"name":"x","regex":"("}]}]`,
+	} {
+		if w := doRequest(s, http.MethodPost, "/tasks", `{"title":"Bad","steps":`+bad+`}`, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("steps %s: expected 400, got %d", bad, w.Code)
+		}
+	}
+}
+
+func TestRetryRun(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	s.service.connector = &exitConnector{}
+
+	task, _ := s.service.CreateTask("Flaky", "", store.TaskOptions{})
+	token := claimForTest(t, s, task.ID, "worker-1", nil)
+	holder := `"holder_id":"worker-1","holder_token":"` + token + `"`
+	w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", `{`+holder+`,"command":"echo","args":["one"]}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("run: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var first models.Run
+	json.NewDecoder(w.Body).Decode(&first)
+
+	w = doRequest(s, http.MethodPost, "/runs/"+first.ID+"/retry", `{`+holder+`}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("retry: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var retry models.Run
+	json.NewDecoder(w.Body).Decode(&retry)
+	if retry.ID == first.ID || retry.RetryOf != first.ID || retry.Command != "echo" || retry.Stdout != "one\n" {
+		t.Errorf("Expected a new run of the same command linked to the first, got %+v", retry)
+	}
+	runs, _ := s.service.GetTaskLogs(task.ID)
+	if len(runs) != 2 || runs[0].RetryOf != first.ID {
+		t.Errorf("Expected the link stored, got %+v", runs)
+	}
+
+	if w := doRequest(s, http.MethodPost, "/runs/"+first.ID+"/retry", `{"holder_id":"worker-2","holder_token":"`+token+`"}`, nil); w.Code != http.StatusForbidden {
+		t.Errorf("retry by another holder: expected 403, got %d", w.Code)
+	}
+	if w := doRequest(s, http.MethodPost, "/runs/no-such-run/retry", `{`+holder+`}`, nil); w.Code != http.StatusNotFound {
+		t.Errorf("missing run: expected 404, got %d", w.Code)
+	}
+}
+
+func TestRunCapabilities(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := &dirConnector{caps: &connectors.Capabilities{Env: true}}
+	s.service.connector = conn
+
+	task, _ := s.service.CreateTask("Limited", "", store.TaskOptions{})
+	token := claimForTest(t, s, task.ID, "worker-1", nil)
+	holder := `"holder_id":"worker-1","holder_token":"` + token + `"`
+
+	w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", `{`+holder+`,"command":"make","stdin":"y\n","pty":true}`, nil)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "dir does not support stdin, pty") {
+		t.Errorf("unsupported input: expected 400 naming the features, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", `{`+holder+`,"command":"make","timeout_sec":5}`, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("unsupported timeout: expected 400, got %d", w.Code)
+	}
+	if len(conn.dirs) != 0 {
+		t.Fatalf("Expected nothing executed, got %d runs", len(conn.dirs))
+	}
+
+	w = doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", `{`+holder+`,"command":"make","dry_run":true}`, nil)
+	var plan RunPlan
+	json.NewDecoder(w.Body).Decode(&plan)
+	if w.Code != http.StatusOK || !plan.Capabilities.Env || plan.Capabilities.Stdin {
+		t.Errorf("Expected the plan to list the connector's capabilities, got %d: %+v", w.Code, plan.Capabilities)
+	}
+
+	conn.caps = nil
+	if w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", `{`+holder+`,"command":"make","stdin":"y\n","timeout_sec":5}`, nil); w.Code != http.StatusOK {
+		t.Errorf("supported run: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", `{`+holder+`,"command":"make","timeout_sec":-1}`, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("negative timeout: expected 400, got %d", w.Code)
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	task, _ := s.service.CreateTask("Plan", "", store.TaskOptions{})
+	token := claimForTest(t, s, task.ID, "worker-1", nil)
+
+	body := `{"holder_id":"worker-1","holder_token":"` + token + `","command":"git","args":["status"],"env":{"CI":"1"},"dry_run":true}`
+	w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("dry run: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var plan RunPlan
+	json.NewDecoder(w.Body).Decode(&plan)
+	if !plan.DryRun || plan.Connector != "localexec" || plan.Command != "git" || plan.Env["CI"] != "1" {
+		t.Errorf("Unexpected plan: %+v", plan)
+	}
+
+	if runs, _ := s.service.GetTaskLogs(task.ID); len(runs) != 0 {
+		t.Errorf("Dry run recorded %d runs", len(runs))
+	}
+	if got, _ := s.service.GetTask(task.ID); got.Status != models.TaskStatusClaimed {
+		t.Errorf("Dry run changed task status to %s", got.Status)
+	}
+
+	// Dry runs go through the same checks as real ones
+	body = `{"holder_id":"worker-1","holder_token":"` + token + `","command":"rm","args":["-rf","/"],"dry_run":true}`
+	if w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", body, nil); w.Code != http.StatusForbidden {
+		t.Errorf("denied dry run: expected 403, got %d", w.Code)
+	}
+}
+
+func TestRunSandboxByLabel(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := &dirConnector{}
+	s.service.connector = conn
+	s.service.SetSandboxLabels(map[string]string{"untrusted": "strict"})
+
+	for _, labels := range [][]string{{"build", "untrusted"}, {"build"}} {
+		task, _ := s.service.CreateTask("Sandbox", "", store.TaskOptions{Labels: labels})
+		token := claimForTest(t, s, task.ID, "worker-1", nil)
+		body := `{"holder_id":"worker-1","holder_token":"` + token + `","command":"git","args":["status"]}`
+		if w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", body, nil); w.Code != http.StatusOK {
+			t.Fatalf("run: expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	if len(conn.sandboxes) != 2 || conn.sandboxes[0] != "strict" || conn.sandboxes[1] != "" {
+		t.Errorf("Expected the labelled task alone to be sandboxed, got %q", conn.sandboxes)
+	}
+}
+
+func TestSchedulerRunSandboxByLabel(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := &dirConnector{}
+	s.service.connector = conn
+	s.service.SetSandboxLabels(map[string]string{"untrusted": "strict"})
+
+	task, _ := s.service.CreateTask("Sandbox", "", store.TaskOptions{Labels: []string{"untrusted"}, Commands: []string{"git status"}})
+	cfg := scheduler.DefaultConfig()
+	cfg.PollIntervalMs, cfg.PollJitterMs = 10, 0
+	sch := scheduler.New(s.store.(*store.Store), s.service.pdr, conn, cfg)
+	sch.SetRunner(s.service)
+	sch.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, _ := s.service.GetTask(task.ID)
+		if got.Status == models.TaskStatusCompleted || got.Status == models.TaskStatusFailed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Task not finished by the scheduler, status %s", got.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	sch.Stop()
+
+	if len(conn.sandboxes) != 1 || conn.sandboxes[0] != "strict" {
+		t.Errorf("Expected the scheduler's run to be sandboxed, got %q", conn.sandboxes)
+	}
+	pdrs, _ := s.store.(*store.Store).ListTaskPDRs(task.ID, 50)
+	found := false
+	for _, p := range pdrs {
+		found = found || p.Action == "task.run"
+	}
+	if !found {
+		t.Error("Expected a task.run audit record for the scheduler's run")
+	}
+}
+
+func TestRunScriptsConnector(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test script is a shell script")
+	}
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := &dirConnector{}
+	s.service.connector = conn
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "greet"), []byte("#!/bin/sh\necho \"hello $1\"\n"), 0o755)
+	os.WriteFile(filepath.Join(dir, "greet.yaml"), []byte("args:\n  - name: who\n    required: true\n    enum: [world, team]\n"), 0o644)
+	lib := scripts.New(dir)
+	s.service.AddConnector(lib)
+	s.SetScriptLibrary(lib)
+
+	w := doRequest(s, http.MethodGet, "/scripts", "", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"greet"`) {
+		t.Fatalf("list: expected greet, got %d: %s", w.Code, w.Body.String())
+	}
+
+	task, _ := s.service.CreateTask("Greet", "", store.TaskOptions{Connector: "scripts"})
+	token := claimForTest(t, s, task.ID, "worker-1", nil)
+	run := func(command string, args ...string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{"holder_id": "worker-1", "holder_token": token, "command": command, "args": args})
+		return doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", string(body), nil)
+	}
+
+	if w := run("greet", "world"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "hello world") {
+		t.Errorf("run: expected 200 with the script's output, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := run("greet", "everyone"); w.Code != http.StatusBadRequest {
+		t.Errorf("argument outside the enum: expected 400, got %d", w.Code)
+	}
+	if w := run("git", "status"); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "greet") {
+		t.Errorf("unknown script: expected 403 suggesting greet, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(conn.dirs) != 0 {
+		t.Errorf("Expected no commands on the default connector, got %d", len(conn.dirs))
+	}
+
+	// Tasks for other connectors keep using the default one
+	other, _ := s.service.CreateTask("Status", "", store.TaskOptions{})
+	token = claimForTest(t, s, other.ID, "worker-1", nil)
+	body := `{"holder_id":"worker-1","holder_token":"` + token + `","command":"git","args":["status"]}`
+	if w := doRequest(s, http.MethodPost, "/tasks/"+other.ID+"/run", body, nil); w.Code != http.StatusOK || len(conn.dirs) != 1 {
+		t.Errorf("default connector: expected 200 and one command, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCreateTask_Frontmatter(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"title":       "Login",
+		"description": "---\nacceptance_criteria: [SSO works]\ncommands: [go test ./...]\nlabels: [auth]\nconnector: localexec\n---\nDetails.",
+		"labels":      []string{"backend"},
+	})
+	w := httptest.NewRecorder()
+	s.handleTasks(w, httptest.NewRequest(http.MethodPost, "/tasks", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created models.Task
+	json.NewDecoder(w.Body).Decode(&created)
+
+	task, err := s.store.GetTask(created.ID)
+	if err != nil || task == nil {
+		t.Fatalf("GetTask failed: %v", err)
+	}
+	if task.Description != "Details." {
+		t.Errorf("Expected frontmatter stripped from description, got %q", task.Description)
+	}
+	if len(task.AcceptanceCriteria) != 1 || task.AcceptanceCriteria[0] != "SSO works" {
+		t.Errorf("AcceptanceCriteria = %v", task.AcceptanceCriteria)
+	}
+	if len(task.Commands) != 1 || task.Commands[0] != "go test ./..." {
+		t.Errorf("Commands = %v", task.Commands)
+	}
+	if len(task.Labels) != 2 || task.Connector != "localexec" {
+		t.Errorf("Expected labels merged and connector set, got %v, %q", task.Labels, task.Connector)
+	}
+
+	// Frontmatter that does not parse is rejected rather than stored as text
+	w = httptest.NewRecorder()
+	s.handleTasks(w, httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{"title":"Bad","description":"---\nlabel: [x]\n---\n"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown frontmatter key, got %d", w.Code)
+	}
+}
+
+func TestSubtasks(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	s.handleTasks(w, httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{"title":"Child","parent_id":"missing"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown parent, got %d", w.Code)
+	}
+
+	parent, _ := s.service.CreateTask("Ship login", "", store.TaskOptions{})
+	child, err := s.service.CreateTask("Backend", "", store.TaskOptions{ParentID: parent.ID})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleTaskByID(w, httptest.NewRequest(http.MethodGet, "/tasks/"+parent.ID+"/subtasks", nil))
+	var subs []models.Task
+	json.NewDecoder(w.Body).Decode(&subs)
+	if w.Code != http.StatusOK || len(subs) != 1 || subs[0].ID != child.ID {
+		t.Fatalf("Expected the child listed, got %d %+v", w.Code, subs)
+	}
+
+	// A parent cannot be completed directly while its subtasks are open
+	claim, err := s.service.ClaimTask(parent.ID, "agent", 60)
+	if err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+	w = httptest.NewRecorder()
+	body := `{"holder_id":"agent","holder_token":"` + claim.HolderToken + `"}`
+	s.handleTaskByID(w, httptest.NewRequest(http.MethodPost, "/tasks/"+parent.ID+"/complete", strings.NewReader(body)))
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 completing a parent with open subtasks, got %d", w.Code)
+	}
+	s.service.ReleaseTask(parent.ID, "agent")
+
+	claim, err = s.service.ClaimTask(child.ID, "agent", 60)
+	if err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+	if err := s.service.CompleteTask(child.ID, "agent"); err != nil {
+		t.Fatalf("CompleteTask failed: %v", err)
+	}
+	if got, _ := s.service.GetTask(parent.ID); got.Status != models.TaskStatusCompleted {
+		t.Errorf("Expected the parent completed by roll-up, got %s", got.Status)
+	}
+}
+
+func TestGetTaskExpand(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	task, _ := s.service.CreateTask("Rich view", "", store.TaskOptions{})
+	if _, err := s.service.ClaimTask(task.ID, "agent", 60); err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		s.service.AddMemory(task.ID, fmt.Sprintf("note %d", i), "", "")
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleTaskByID(w, httptest.NewRequest(http.MethodGet, "/tasks/"+task.ID+query, nil))
+		return w
+	}
+
+	var plain map[string]interface{}
+	json.NewDecoder(get("").Body).Decode(&plain)
+	if _, ok := plain["history"]; ok {
+		t.Error("Expected no sections without ?expand=")
+	}
+
+	w := get("?expand=lease,memory,history,runs")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var view TaskView
+	json.NewDecoder(w.Body).Decode(&view)
+	if view.Task == nil || view.ID != task.ID {
+		t.Fatalf("Expected the task's fields inline, got %+v", view)
+	}
+	if view.Lease == nil || view.Lease.HolderID != "agent" || view.Lease.HolderToken != "" {
+		t.Errorf("Expected the active lease without its token, got %+v", view.Lease)
+	}
+	if view.Memory == nil || view.Memory.Count != 5 || len(view.Memory.Recent) != viewMemorySamples {
+		t.Errorf("Expected a memory count with samples, got %+v", view.Memory)
+	}
+	if len(view.History) != 7 || view.History[0].Action != "task.create" || view.History[1].Action != "task.claim" {
+		t.Errorf("Expected create, claim and the memory writes in the history, got %+v", view.History)
+	}
+	if view.RunCount == nil || *view.RunCount != 0 {
+		t.Errorf("Expected a run count of 0, got %v", view.RunCount)
+	}
+	if view.Routing != nil {
+		t.Error("Expected routing only when asked for")
+	}
+
+	if w := get("?expand=history&history_limit=1"); !strings.Contains(w.Body.String(), "memory.add") || strings.Contains(w.Body.String(), "task.claim") {
+		t.Errorf("Expected only the latest history entry, got %s", w.Body.String())
+	}
+	if w := get("?expand=bogus"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown section, got %d", w.Code)
+	}
+}
+
+func TestMemoryScopes(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	add := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleMemory(w, httptest.NewRequest(http.MethodPost, "/memory", strings.NewReader(body)))
+		return w
+	}
+	w := add(`{"task_id":"t1","content":"flaky deploys need a retry"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var learned models.MemoryItem
+	json.NewDecoder(w.Body).Decode(&learned)
+	if learned.Scope != "task:t1" {
+		t.Errorf("Scope = %q, want task:t1", learned.Scope)
+	}
+	add(`{"content":"deploys go through CI","scope":"project:web"}`)
+	add(`{"content":"deploys need the VPN"}`)
+	if w := add(`{"content":"x","scope":"team:web"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown scope, got %d", w.Code)
+	}
+
+	query := func(params string) []models.MemoryItem {
+		w := httptest.NewRecorder()
+		s.handleMemory(w, httptest.NewRequest(http.MethodGet, "/memory?"+params, nil))
+		var items []models.MemoryItem
+		json.NewDecoder(w.Body).Decode(&items)
+		return items
+	}
+	if items := query("q=deploys&scope=project:web"); len(items) != 1 || items[0].Scope != "project:web" {
+		t.Errorf("Expected only the project item, got %+v", items)
+	}
+	if items := query("q=deploys&scope=project:web,global"); len(items) != 2 {
+		t.Errorf("Expected the project and global items, got %d", len(items))
+	}
+
+	promote := func(id, scope string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleMemoryByID(w, httptest.NewRequest(http.MethodPost, "/memory/"+id+"/promote", strings.NewReader(`{"scope":"`+scope+`"}`)))
+		return w
+	}
+	if w := promote(learned.ID, "project:web"); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if items := query("scope=project:web"); len(items) != 2 {
+		t.Errorf("Expected the promoted item in the project, got %d items", len(items))
+	}
+	if w := promote(learned.ID, "task:t2"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for narrowing a scope, got %d", w.Code)
+	}
+	if w := promote(learned.ID, "project:api"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for moving to a sibling project, got %d", w.Code)
+	}
+	if w := promote("missing", "global"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing item, got %d", w.Code)
+	}
+}
+
+func TestMemoryDuplicates(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	add := func() (*httptest.ResponseRecorder, models.MemoryItem) {
+		w := httptest.NewRecorder()
+		s.handleMemory(w, httptest.NewRequest(http.MethodPost, "/memory", strings.NewReader(`{"task_id":"t1","content":"Run: make\nOutput: ok"}`)))
+		var item models.MemoryItem
+		json.Unmarshal(w.Body.Bytes(), &item)
+		return w, item
+	}
+	w, first := add()
+	if w.Code != http.StatusCreated || first.Duplicate {
+		t.Fatalf("Expected 201 for new content, got %d: %s", w.Code, w.Body.String())
+	}
+	w, again := add()
+	if w.Code != http.StatusOK || !again.Duplicate || again.ID != first.ID || again.SeenCount != 2 {
+		t.Errorf("Expected 200 with the existing item, got %d: %s", w.Code, w.Body.String())
+	}
+	if items, _ := s.service.GetTaskMemory("t1"); len(items) != 1 {
+		t.Errorf("Expected one stored item, got %d", len(items))
+	}
+}
+
+func TestSyncRuleFiles(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	sync := func(body string) (*httptest.ResponseRecorder, RuleSyncResult) {
+		w := httptest.NewRecorder()
+		s.syncRuleFiles(w, httptest.NewRequest(http.MethodPost, "/memory/sync", strings.NewReader(body)))
+		var res RuleSyncResult
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w, res
+	}
+	statuses := func(res RuleSyncResult) string {
+		var out []string
+		for _, f := range res.Files {
+			out = append(out, f.Path+"="+f.Status)
+		}
+		return strings.Join(out, " ")
+	}
+
+	w, res := sync(`{"project":"web","files":[{"path":"AGENTS.md","content":"Use pnpm"},{"path":"./.cursorrules","content":"No tabs"}]}`)
+	if w.Code != http.StatusOK || res.Scope != "project:web" || res.Stale != 2 || statuses(res) != "AGENTS.md=added .cursorrules=added" {
+		t.Fatalf("Expected both files added, got %d: %s", w.Code, w.Body.String())
+	}
+	items, _ := s.service.QueryMemory("", "project:web")
+	if len(items) != 2 || items[0].Tags != RuleFileTag || items[0].Source == "" {
+		t.Fatalf("Expected two synced items, got %+v", items)
+	}
+
+	// A check reports what changed without writing
+	changed := `{"project":"web","files":[{"path":"AGENTS.md","content":"Use pnpm 9"}]`
+	_, res = sync(changed + `,"dry_run":true}`)
+	if res.Stale != 2 || statuses(res) != "AGENTS.md=updated .cursorrules=removed" {
+		t.Errorf("Expected one update and one removal reported, got %+v", res)
+	}
+	if items, _ := s.service.QueryMemory("", "project:web"); len(items) != 2 {
+		t.Errorf("Expected a dry run to write nothing, got %+v", items)
+	}
+
+	_, res = sync(changed + `}`)
+	if items, _ := s.service.QueryMemory("", "project:web"); len(items) != 1 || items[0].Content != "Use pnpm 9" || items[0].ID != res.Files[0].MemoryID {
+		t.Errorf("Expected only the updated file kept, got %+v", items)
+	}
+	if _, res = sync(changed + `}`); res.Stale != 0 || statuses(res) != "AGENTS.md=unchanged" {
+		t.Errorf("Expected nothing stale after syncing, got %+v", res)
+	}
+
+	for _, body := range []string{
+		`{"project":"","files":[]}`,
+		`{"project":"web","files":[{"path":"../AGENTS.md","content":"x"}]}`,
+		`{"project":"web","files":[{"path":"AGENTS.md","content":"x"},{"path":"AGENTS.md","content":"y"}]}`,
+	} {
+		if w, _ := sync(body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
+
+// sharedPrefixStore reports every task ID lookup as ambiguous.
+type sharedPrefixStore struct {
+	Store
+}
+
+func (sharedPrefixStore) FindTaskIDs(prefix string, limit int) ([]string, error) {
+	return []string{prefix + "-1", prefix + "-2"}, nil
+}
+
+func TestShortTaskIDs(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	task, _ := s.service.CreateTask("Short", "", store.TaskOptions{})
+	short := task.ID[:8]
+
+	w := doRequest(s, http.MethodGet, "/tasks/"+short, "", nil)
+	var got models.Task
+	json.NewDecoder(w.Body).Decode(&got)
+	if w.Code != http.StatusOK || got.ID != task.ID {
+		t.Fatalf("GET /tasks/%s = %d %+v, want the task", short, w.Code, got)
+	}
+	claimForTest(t, s, short, "agent", nil)
+	if w := doRequest(s, http.MethodGet, "/tasks/"+task.ID[:3], "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a prefix below the minimum, got %d", w.Code)
+	}
+
+	s.service.store = sharedPrefixStore{s.service.store}
+	w = doRequest(s, http.MethodPost, "/tasks/"+short+"/claim", `{"holder_id":"other"}`, nil)
+	var resp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusConflict || resp.Code != CodeAmbiguousID || !strings.Contains(resp.Error, short+"-2") {
+		t.Errorf("Expected a 409 listing the matches, got %d %+v", w.Code, resp)
+	}
+	if w := doRequest(s, http.MethodGet, "/tasks/"+task.ID, "", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected a full ID to skip the prefix lookup, got %d", w.Code)
+	}
+}
+
+type fakeCloudSync struct{ status cloudsync.Status }
+
+func (f *fakeCloudSync) Status() (*cloudsync.Status, error) { return &f.status, nil }
+
+func TestCloudStatus(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	w := doRequest(s, http.MethodGet, "/cloud/status", "", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"enabled":false`) {
+		t.Fatalf("Expected sync reported disabled, got %d: %s", w.Code, w.Body.String())
+	}
+
+	s.SetCloudSync(&fakeCloudSync{status: cloudsync.Status{Enabled: true, Team: "core", Linked: 2}})
+	w = doRequest(s, http.MethodGet, "/cloud/status", "", nil)
+	var got cloudsync.Status
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if !got.Enabled || got.Team != "core" || got.Linked != 2 {
+		t.Errorf("Unexpected status: %s", w.Body.String())
+	}
+}
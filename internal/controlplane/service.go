@@ -3,73 +3,570 @@ package controlplane
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/fentz26/neona/internal/audit"
+	"github.com/fentz26/neona/internal/clock"
 	"github.com/fentz26/neona/internal/connectors"
 	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/pipeline"
 	"github.com/fentz26/neona/internal/store"
+	"github.com/fentz26/neona/internal/taskspec"
+	"github.com/fentz26/neona/internal/workspace"
 )
 
 // Service provides the control plane business logic.
 type Service struct {
-	store     *store.Store
+	store     Store
 	pdr       *audit.PDRWriter
-	connector connectors.Connector
+	connector connectors.Connector            // runs tasks without a registered connector
+	extra     map[string]connectors.Connector // by name; see AddConnector
+	cache     *readCache
+	roots     *workspace.Roots // allowed task workdirs; nil disables them
+	worktrees *workspace.WorktreeManager
+	prs       *workspace.PullRequestConfig // nil disables pull requests
+	envAllow  []string                     // variable name patterns runs may set
+	denied    deniedCounter
+	sandboxes map[string]string // task label -> connector sandbox profile
+
+	requireChecklist bool // refuse to complete tasks with unchecked items
+
+	staleFactor int // lease TTLs a quiet claim lasts before it is stale; 0 disables
+	stale       staleReports
+	dbQuota     DBQuota
+	dbUsage     dbUsageReports
+	claims      store.ClaimCounter // claims through the API
+	claimConfig models.ClaimConfig // lease TTLs and claim limits
+	clock       clock.Clock        // decides stale, overdue and scheduled tasks
 }
 
+// DefaultEnvAllowlist lists the variable names runs may set unless
+// SetEnvAllowlist replaces it. Patterns use path.Match syntax.
+var DefaultEnvAllowlist = []string{"CI", "NO_COLOR", "TZ", "GOFLAGS", "GOOS", "GOARCH", "CGO_ENABLED", "NEONA_*"}
+
 // NewService creates a new control plane service.
-func NewService(s *store.Store, pdr *audit.PDRWriter, conn connectors.Connector) *Service {
+func NewService(s Store, pdr *audit.PDRWriter, conn connectors.Connector) *Service {
 	return &Service{
 		store:     s,
 		pdr:       pdr,
 		connector: conn,
+		cache:     newReadCache(),
+		envAllow:  DefaultEnvAllowlist,
+
+		staleFactor: DefaultStaleFactor,
+		claimConfig: DefaultClaimConfig(),
+		clock:       clock.Real,
+	}
+}
+
+// SetClock replaces the clock that decides which tasks are stale, overdue
+// and still scheduled. It should be the store's clock, so the service and
+// the store agree on lease expiry.
+// Must be called before serving requests - not safe for concurrent use.
+func (s *Service) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetEnvAllowlist replaces the variable name patterns (path.Match syntax)
+// runs may set. An empty list forbids per-run variables.
+// Must be called before serving requests - not safe for concurrent use.
+func (s *Service) SetEnvAllowlist(patterns []string) {
+	s.envAllow = patterns
+}
+
+// AddConnector registers a further connector. Tasks whose connector field
+// names it run their commands through it; all others use the connector
+// given to NewService.
+// Must be called before serving requests - not safe for concurrent use.
+func (s *Service) AddConnector(conn connectors.Connector) {
+	if s.extra == nil {
+		s.extra = make(map[string]connectors.Connector)
+	}
+	s.extra[conn.Name()] = conn
+}
+
+// connectorFor returns the connector a task's commands run through.
+func (s *Service) connectorFor(task *models.Task) connectors.Connector {
+	if task != nil {
+		if conn, ok := s.extra[task.Connector]; ok {
+			return conn
+		}
+	}
+	return s.connector
+}
+
+// SetSandboxLabels selects the connector sandbox profile runs use by task
+// label. A task carrying several mapped labels uses the first one's.
+// Must be called before serving requests - not safe for concurrent use.
+func (s *Service) SetSandboxLabels(profiles map[string]string) {
+	s.sandboxes = profiles
+}
+
+// SetRequireChecklist makes CompleteTask refuse tasks whose checklist has
+// unchecked items.
+// Must be called before serving requests - not safe for concurrent use.
+func (s *Service) SetRequireChecklist(require bool) {
+	s.requireChecklist = require
+}
+
+// sandboxFor returns the sandbox profile selected by a task's labels, or "".
+func (s *Service) sandboxFor(task *models.Task) string {
+	for _, label := range task.Labels {
+		if profile, ok := s.sandboxes[label]; ok {
+			return profile
+		}
+	}
+	return ""
+}
+
+// checkEnv rejects per-run variables whose names match no allowlist pattern.
+func (s *Service) checkEnv(env map[string]string) error {
+	for name := range env {
+		allowed := false
+		for _, pattern := range s.envAllow {
+			if ok, _ := path.Match(pattern, name); ok {
+				allowed = true
+				break
+			}
+		}
+		if !allowed || name == "" || strings.ContainsAny(name, "=\x00") {
+			return fmt.Errorf("%w: %s", ErrEnvNotAllowed, name)
+		}
+	}
+	return nil
+}
+
+// SetWorkRoots sets the directories task workdirs must be inside. Without
+// roots, tasks with a workdir are rejected.
+// Must be called before serving requests - not safe for concurrent use.
+func (s *Service) SetWorkRoots(roots *workspace.Roots) {
+	s.roots = roots
+}
+
+// SetWorktrees enables a git worktree per claimed task. Tasks created with
+// an explicit workdir keep it.
+// Must be called before serving requests - not safe for concurrent use.
+func (s *Service) SetWorktrees(m *workspace.WorktreeManager) {
+	s.worktrees = m
+}
+
+// SetPullRequests opens a pull request for the branch of each task that
+// completes in its worktree with commits. Requires SetWorktrees.
+// Must be called before serving requests - not safe for concurrent use.
+func (s *Service) SetPullRequests(cfg workspace.PullRequestConfig) {
+	s.prs = &cfg
+}
+
+// provisionWorktree gives a newly claimed task its own worktree and makes it
+// the task's workdir. Failures are recorded but do not fail the claim; the
+// task then runs in the default directory.
+func (s *Service) provisionWorktree(task *models.Task) {
+	if s.worktrees == nil || task == nil {
+		return
+	}
+	wt := s.worktrees.Lookup(task.ID)
+	if task.WorkDir != "" && task.WorkDir != wt.Path {
+		return
+	}
+
+	wt, err := s.worktrees.Provision(task.ID)
+	if err != nil {
+		s.pdr.Record("worktree.create", map[string]string{"task_id": task.ID}, "error", task.ID, err.Error())
+		return
+	}
+	if task.WorkDir != wt.Path {
+		if err := s.store.SetTaskWorkDir(task.ID, wt.Path); err != nil {
+			s.pdr.Record("worktree.create", wt, "error", task.ID, err.Error())
+			return
+		}
+		task.WorkDir = wt.Path
+		s.pdr.Record("worktree.create", wt, "success", task.ID, "branch="+wt.Branch)
+	}
+}
+
+// finishWorktree applies the preserve policy to a finished task's worktree.
+func (s *Service) finishWorktree(taskID string, succeeded bool) {
+	if s.worktrees == nil {
+		return
+	}
+	if succeeded {
+		s.openPullRequest(taskID)
+	}
+	removed, err := s.worktrees.Finish(taskID, succeeded)
+	switch {
+	case err != nil:
+		s.pdr.Record("worktree.remove", map[string]string{"task_id": taskID}, "error", taskID, err.Error())
+	case removed:
+		s.pdr.Record("worktree.remove", map[string]string{"task_id": taskID}, "success", taskID, "")
+	}
+}
+
+// openPullRequest pushes a completed task's branch and opens a pull request
+// when the branch has commits. The URL is stored on the task. Failures are
+// recorded but do not fail the completion; the branch is kept either way.
+func (s *Service) openPullRequest(taskID string) {
+	if s.prs == nil {
+		return
+	}
+	task, err := s.store.GetTask(taskID)
+	if err != nil || task == nil || task.PRURL != "" {
+		return
 	}
+	wt := s.worktrees.Lookup(taskID)
+	if task.WorkDir != wt.Path {
+		return
+	}
+	if n, err := s.worktrees.Commits(wt); err != nil || n == 0 {
+		return
+	}
+
+	url, err := s.worktrees.OpenPullRequest(taskID, *s.prs, task.Title, s.pullRequestBody(task))
+	if err != nil {
+		s.pdr.Record("worktree.pr", wt, "error", taskID, err.Error())
+		return
+	}
+	if err := s.store.SetTaskPRURL(taskID, url); err != nil {
+		s.pdr.Record("worktree.pr", wt, "error", taskID, err.Error())
+		return
+	}
+	s.pdr.Record("worktree.pr", wt, "success", taskID, "url="+url)
+}
+
+// prMemoryItems caps how many memory items a pull request body summarizes.
+const prMemoryItems = 10
+
+// pullRequestBody builds a pull request description from the task and its
+// most recent memory items.
+func (s *Service) pullRequestBody(task *models.Task) string {
+	var b strings.Builder
+	if task.Description != "" {
+		b.WriteString(task.Description + "\n\n")
+	}
+	if items, err := s.store.GetMemoryForTask(task.ID); err == nil && len(items) > 0 {
+		if len(items) > prMemoryItems {
+			items = items[:prMemoryItems]
+		}
+		b.WriteString("## Notes\n\n")
+		for i := len(items) - 1; i >= 0; i-- {
+			line, _, _ := strings.Cut(strings.TrimSpace(items[i].Content), "\n")
+			b.WriteString("- " + line + "\n")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("Neona task: " + task.ID + "\n")
+	return b.String()
+}
+
+// resolveWorkDir validates a task workdir against the allowed roots.
+func (s *Service) resolveWorkDir(dir string) (string, error) {
+	if s.roots == nil {
+		return "", fmt.Errorf("%w: per-task workdirs are not enabled", ErrInvalidWorkDir)
+	}
+	real, err := s.roots.Resolve(dir)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidWorkDir, err)
+	}
+	return real, nil
 }
 
 // --- Task Operations ---
 
-// CreateTask creates a new task.
-func (s *Service) CreateTask(title, description string) (*models.Task, error) {
-	task, err := s.store.CreateTask(title, description)
+// CreateTask creates a new task. YAML frontmatter in the description is
+// moved into the task's fields: it fills the ones opts leaves empty and adds
+// to its labels.
+func (s *Service) CreateTask(title, description string, opts store.TaskOptions) (*models.Task, error) {
+	spec, body, err := taskspec.Parse(description)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+	}
+	if spec != nil {
+		description = body
+		opts.Labels = append(opts.Labels, spec.Labels...)
+		if opts.Connector == "" {
+			opts.Connector = spec.Connector
+		}
+		if len(opts.AcceptanceCriteria) == 0 {
+			opts.AcceptanceCriteria = spec.AcceptanceCriteria
+		}
+		if len(opts.Commands) == 0 {
+			opts.Commands = spec.Commands
+		}
+		if len(opts.Steps) == 0 {
+			opts.Steps = spec.Steps
+		}
+	}
+	if opts.EstimateSec < 0 {
+		return nil, fmt.Errorf("%w: estimate must not be negative", ErrInvalidArgs)
+	}
+	if err := pipeline.Validate(opts.Steps); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArgs, err)
+	}
+	if opts.ParentID != "" {
+		parent, err := s.store.GetTask(opts.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			return nil, fmt.Errorf("%w: task %s not found", ErrInvalidParent, opts.ParentID)
+		}
+		if parent.Status == models.TaskStatusCompleted || parent.Status == models.TaskStatusFailed {
+			return nil, fmt.Errorf("%w: task %s is %s", ErrInvalidParent, opts.ParentID, parent.Status)
+		}
+	}
+	if opts.WorkDir != "" {
+		dir, err := s.resolveWorkDir(opts.WorkDir)
+		if err != nil {
+			return nil, err
+		}
+		opts.WorkDir = dir
+	}
+
+	task, err := s.store.CreateTaskWithOptions(title, description, opts)
 	if err != nil {
 		return nil, err
 	}
+	// Each acceptance criterion starts out as an unchecked checklist item
+	if _, err := s.store.AddChecklistItems(task.ID, task.AcceptanceCriteria); err != nil {
+		return nil, err
+	}
 
-	s.pdr.Record("task.create", map[string]string{"title": title}, "success", task.ID, "")
+	s.pdr.Record("task.create", map[string]interface{}{"title": title, "mutex_key": task.MutexKey, "labels": task.Labels, "connector": task.Connector, "workdir": task.WorkDir, "parent_id": task.ParentID, "estimate_sec": task.EstimateSec, "due_at": task.DueAt, "not_before": task.NotBefore}, "success", task.ID, "")
+	annotateTask(task, s.clock.Now())
 	return task, nil
 }
 
+// ListSubtasks returns a task's direct subtasks, oldest first.
+func (s *Service) ListSubtasks(taskID string) ([]models.Task, error) {
+	tasks, err := s.store.ListSubtasks(taskID)
+	annotateTasks(tasks, s.clock.Now())
+	return tasks, err
+}
+
 // GetTask retrieves a task by ID.
 func (s *Service) GetTask(id string) (*models.Task, error) {
-	return s.store.GetTask(id)
+	key := "task:" + id
+	gen := s.store.Generation()
+	if v, ok := s.cache.get(key, gen); ok {
+		if v == nil {
+			return nil, nil
+		}
+		task := *v.(*models.Task)
+		annotateTask(&task, s.clock.Now())
+		return &task, nil
+	}
+
+	task, err := s.store.GetTask(id)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		s.cache.put(key, gen, nil)
+		return nil, nil
+	}
+	cached := *task
+	s.cache.put(key, gen, &cached)
+	annotateTask(task, s.clock.Now())
+	return task, nil
 }
 
-// ListTasks returns filtered tasks.
+// MinTaskIDPrefix is the shortest task ID prefix ResolveTaskID expands.
+const MinTaskIDPrefix = 4
+
+// ResolveTaskID expands the short task IDs the CLI and TUI show to the full
+// ID of the one task starting with ref. A ref that is a task ID, is shorter
+// than MinTaskIDPrefix or matches nothing is returned as is, leaving the
+// caller to report it missing. A prefix of several tasks fails with
+// ErrAmbiguousID naming them.
+func (s *Service) ResolveTaskID(ref string) (string, error) {
+	if len(ref) < MinTaskIDPrefix {
+		return ref, nil
+	}
+	if task, err := s.GetTask(ref); err != nil || task != nil {
+		return ref, err
+	}
+	const shown = 5
+	ids, err := s.store.FindTaskIDs(ref, shown+1)
+	if err != nil {
+		return "", err
+	}
+	switch len(ids) {
+	case 0:
+		return ref, nil
+	case 1:
+		return ids[0], nil
+	}
+	more := ""
+	if len(ids) > shown {
+		ids, more = ids[:shown], ", ..."
+	}
+	return "", fmt.Errorf("%w: %s matches %s%s", ErrAmbiguousID, ref, strings.Join(ids, ", "), more)
+}
+
+// ListScheduled is the ListTasks status filter for pending tasks that are
+// delayed until a later time.
+const ListScheduled = "scheduled"
+
+// ListTasks returns filtered tasks. The status ListScheduled returns the
+// pending tasks not yet due for dispatch, ListStale the stale claims.
 func (s *Service) ListTasks(status string) ([]models.Task, error) {
-	return s.store.ListTasks(status)
+	if status == ListStale {
+		return s.StaleTasks(s.clock.Now())
+	}
+	if status == ListScheduled {
+		pending, err := s.ListTasks(string(models.TaskStatusPending))
+		var scheduled []models.Task
+		for _, t := range pending {
+			if t.Scheduled {
+				scheduled = append(scheduled, t)
+			}
+		}
+		return scheduled, err
+	}
+
+	key := "tasks:" + status
+	gen := s.store.Generation()
+	if v, ok := s.cache.get(key, gen); ok {
+		tasks := append([]models.Task(nil), v.([]models.Task)...)
+		annotateTasks(tasks, s.clock.Now())
+		return tasks, nil
+	}
+
+	tasks, err := s.store.ListTasks(status)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(key, gen, append([]models.Task(nil), tasks...))
+	annotateTasks(tasks, s.clock.Now())
+	return tasks, nil
+}
+
+// ClaimStats counts the claims made through the API, by external workers,
+// that found a task: how many lost it to another holder and how long they
+// took.
+func (s *Service) ClaimStats() store.ClaimStats {
+	return s.claims.Stats()
+}
+
+// CacheStats returns read cache hit/miss counters.
+func (s *Service) CacheStats() CacheStats {
+	return s.cache.stats()
 }
 
 // ClaimTask claims a task with a lease atomically.
 func (s *Service) ClaimTask(taskID, holderID string, ttlSec int) (*models.Lease, error) {
+	if err := s.checkClaimLimit(holderID); err != nil {
+		return nil, err
+	}
+	policy, err := s.claimPolicy(taskID)
+	if err != nil {
+		return nil, err
+	}
+	ttlSec = policy.TTL(ttlSec)
+	start := time.Now()
 	result, err := s.store.ClaimTaskWithLeaseTx(taskID, holderID, ttlSec)
 	if err != nil {
 		// Map store errors to service errors
 		if err == store.ErrTaskNotClaimable {
-			return nil, ErrNotFound
+			task, _ := s.store.GetTask(taskID)
+			if task == nil {
+				return nil, ErrNotFound
+			}
+			s.claims.Record(start, task.Status == models.TaskStatusClaimed || task.Status == models.TaskStatusRunning)
+			return nil, ErrNotPending
 		}
+		s.claims.Record(start, err == store.ErrTaskAlreadyLeased)
 		if err == store.ErrTaskAlreadyLeased {
 			return nil, ErrAlreadyClaimed
 		}
 		return nil, err
 	}
+	s.claims.Record(start, false)
+
+	if err := s.issueHolderToken(result.Lease); err != nil {
+		return nil, err
+	}
+	s.provisionWorktree(result.Task)
 
 	s.pdr.Record("task.claim", map[string]interface{}{"task_id": taskID, "holder_id": holderID, "ttl": ttlSec}, "success", taskID, "")
 	return result.Lease, nil
 }
 
-// ReleaseTask releases a task claim.
-func (s *Service) ReleaseTask(taskID, holderID string) error {
+// ClaimNextTask claims the pending task matching the filter with the
+// highest priority, the oldest of those. It returns nil if no task is
+// eligible.
+func (s *Service) ClaimNextTask(holderID string, ttlSec int, filter store.ClaimFilter) (*store.ClaimResult, error) {
+	if err := s.checkClaimLimit(holderID); err != nil {
+		return nil, err
+	}
+	requested := ttlSec
+	ttlSec = s.claimConfig.TTL(requested)
+	start := time.Now()
+	task, lease, err := s.store.AtomicClaimNext(holderID, ttlSec, filter)
+	if task == nil && err == nil {
+		return nil, nil
+	}
+	s.claims.Record(start, errors.Is(err, store.ErrTaskAlreadyLeased))
+	if err != nil {
+		return nil, err
+	}
+	// The task, and so its project, is only known once claimed
+	if projectTTL := s.claimConfig.For(models.TaskProject(task)).TTL(requested); projectTTL != ttlSec {
+		if err := s.store.SetLeaseTTL(lease.ID, projectTTL); err != nil {
+			return nil, err
+		}
+		lease.ExpiresAt = lease.ExpiresAt.Add(time.Duration(projectTTL-ttlSec) * time.Second)
+		lease.TTLSec, ttlSec = projectTTL, projectTTL
+	}
+	if err := s.issueHolderToken(lease); err != nil {
+		return nil, err
+	}
+	s.provisionWorktree(task)
+
+	s.pdr.Record("task.claim", map[string]interface{}{"task_id": task.ID, "holder_id": holderID, "ttl": ttlSec, "label": filter.Label, "connector": filter.Connector}, "success", task.ID, "claim-next")
+	return &store.ClaimResult{Task: task, Lease: lease}, nil
+}
+
+// issueHolderToken attaches a fresh random token to a new lease and stores
+// its hash. Each claim gets a new token, so a token stops working once its
+// lease ends.
+func (s *Service) issueHolderToken(lease *models.Lease) error {
+	token, hash, err := store.NewHolderToken()
+	if err != nil {
+		return err
+	}
+	if err := s.store.SetLeaseTokenHash(lease.ID, hash); err != nil {
+		return fmt.Errorf("store holder token: %w", err)
+	}
+	lease.HolderToken = token
+	lease.TokenHash = hash
+	return nil
+}
+
+// ReissueHolderToken gives the task's lease leaseID a fresh holder token,
+// replacing the one issued with the claim, for a claim response replayed to
+// a client retrying with its idempotency key. It returns "" once the lease
+// is no longer active.
+func (s *Service) ReissueHolderToken(taskID, leaseID string) (string, error) {
+	lease, err := s.store.GetActiveLease(taskID)
+	if err != nil || lease == nil || lease.ID != leaseID {
+		return "", err
+	}
+	if err := s.issueHolderToken(lease); err != nil {
+		return "", err
+	}
+	return lease.HolderToken, nil
+}
+
+// VerifyHolder checks that holderID owns the task's active lease and that
+// token is the holder token issued with it. Leases created outside the API
+// (e.g. by the scheduler) have no token and cannot be verified.
+func (s *Service) VerifyHolder(taskID, holderID, token string) error {
 	lease, err := s.store.GetActiveLease(taskID)
 	if err != nil {
 		return err
@@ -77,14 +574,22 @@ func (s *Service) ReleaseTask(taskID, holderID string) error {
 	if lease == nil {
 		return ErrNoLease
 	}
-	if lease.HolderID != holderID {
+	if lease.HolderID != holderID || lease.TokenHash == "" ||
+		subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(lease.TokenHash)) != 1 {
 		return ErrNotOwner
 	}
+	return nil
+}
 
-	if err := s.store.DeleteLease(lease.ID); err != nil {
-		return err
-	}
-	if err := s.store.ReleaseTask(taskID); err != nil {
+// ReleaseTask releases a task claim held by holderID.
+func (s *Service) ReleaseTask(taskID, holderID string) error {
+	_, err := s.store.ReleaseTask(taskID, store.ReleaseOptions{HolderID: holderID})
+	switch {
+	case err == store.ErrTaskNotClaimed:
+		return ErrNoLease
+	case err == store.ErrNotHolder:
+		return ErrNotOwner
+	case err != nil:
 		return err
 	}
 
@@ -92,15 +597,175 @@ func (s *Service) ReleaseTask(taskID, holderID string) error {
 	return nil
 }
 
-// RunTask executes a command for a task.
-func (s *Service) RunTask(taskID, holderID, command string, args []string) (*models.Run, error) {
+// EventTaskForceReleased is emitted to the previous holder when an admin breaks its claim.
+const EventTaskForceReleased = "task.force_released"
+
+// ForceReleaseResult describes a forced release.
+type ForceReleaseResult struct {
+	TaskID         string `json:"task_id"`
+	PreviousHolder string `json:"previous_holder,omitempty"`
+	Actor          string `json:"actor"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// ForceReleaseTask breaks any claim on a task regardless of holder: it deletes
+// the task's leases, resets it to pending and notifies the previous holder.
+func (s *Service) ForceReleaseTask(taskID, actor, reason string) (*ForceReleaseResult, error) {
+	task, err := s.store.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		return nil, ErrNotFound
+	}
+
+	previous, err := s.store.ReleaseTask(taskID, store.ReleaseOptions{Force: true})
+	if err == store.ErrTaskNotClaimed {
+		return nil, ErrNoLease
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ForceReleaseResult{TaskID: taskID, PreviousHolder: previous, Actor: actor, Reason: reason}
+	s.pdr.Record("task.force_release", result, "success", taskID, fmt.Sprintf("actor=%s previous_holder=%s reason=%s", actor, previous, reason))
+	if previous != "" {
+		if _, err := s.store.AddEvent(EventTaskForceReleased, taskID, previous, result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// ListEvents returns events newer than since, optionally filtered by holder.
+func (s *Service) ListEvents(holderID string, since time.Time, limit int) ([]models.Event, error) {
+	return s.store.ListEvents(holderID, since, limit)
+}
+
+// RunOptions holds optional settings for RunTask.
+type RunOptions struct {
+	// Input is fed to the command; see connectors.Input.
+	Input connectors.Input
+	// Env sets variables for the command on top of the connector's base
+	// environment. Names must match the service's allowlist.
+	Env map[string]string
+	// Timeout, if positive, stops the command once it has run this long.
+	Timeout time.Duration
+}
+
+// prepareRun checks a run request the same way for real and dry runs and
+// for the scheduler's, and returns the connector to run it with and the
+// context to call it with, derived from ctx.
+func (s *Service) prepareRun(ctx context.Context, taskID, holderID, command string, args []string, opts RunOptions) (context.Context, connectors.Connector, error) {
 	// Verify claim
 	lease, err := s.store.GetActiveLease(taskID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if lease == nil || lease.HolderID != holderID {
-		return nil, ErrNotOwner
+		return nil, nil, ErrNotOwner
+	}
+	if err := s.checkEnv(opts.Env); err != nil {
+		return nil, nil, err
+	}
+	task, err := s.store.GetTask(taskID)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn := s.connectorFor(task)
+	if !conn.IsAllowed(command, args) {
+		return nil, nil, s.denyCommand(conn, taskID, holderID, command, args)
+	}
+	if v, ok := conn.(connectors.ArgValidator); ok {
+		if err := v.ValidateArgs(command, args); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidArgs, err)
+		}
+	}
+
+	// Re-check the workdir: it may have been replaced since the task was created
+	if task != nil && task.WorkDir != "" {
+		dir, err := s.resolveWorkDir(task.WorkDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		ctx = connectors.WithWorkDir(ctx, dir)
+	}
+	profile := ""
+	if task != nil {
+		if profile = s.sandboxFor(task); profile != "" {
+			ctx = connectors.WithSandbox(ctx, profile)
+		}
+	}
+
+	// Refuse what the connector would silently ignore or fail on
+	need := connectors.Capabilities{
+		Stdin:   len(opts.Input.Stdin) > 0,
+		PTY:     opts.Input.PTY,
+		WorkDir: connectors.WorkDirFromContext(ctx) != "",
+		Env:     len(opts.Env) > 0,
+		Timeout: opts.Timeout > 0,
+		// "none" is how a task label opts out of sandboxing
+		Sandbox: profile != "" && profile != "none",
+	}
+	if missing := conn.Capabilities().Missing(need); len(missing) > 0 {
+		return nil, nil, fmt.Errorf("%w: %s does not support %s", ErrUnsupported, conn.Name(), strings.Join(missing, ", "))
+	}
+
+	ctx = connectors.WithInput(ctx, opts.Input)
+	ctx = connectors.WithEnv(ctx, opts.Env)
+	return ctx, conn, nil
+}
+
+// RunPlan is the answer to a dry run: what a run request would execute.
+type RunPlan struct {
+	TaskID    string `json:"task_id"`
+	Connector string `json:"connector"`
+	connectors.ExecPlan
+	StdinLen int  `json:"stdin_len"`
+	PTY      bool `json:"pty"`
+	// Capabilities are the optional features the connector supports.
+	Capabilities connectors.Capabilities `json:"capabilities"`
+	// MCPServers lists the MCP servers routed to the task, when a router
+	// is configured.
+	MCPServers []string `json:"mcp_servers,omitempty"`
+	DryRun     bool     `json:"dry_run"`
+}
+
+// PlanRun validates a run request exactly like RunTask and reports what it
+// would execute, without starting the process, recording a run or
+// changing the task.
+func (s *Service) PlanRun(taskID, holderID, command string, args []string, opts RunOptions) (*RunPlan, error) {
+	ctx, conn, err := s.prepareRun(context.Background(), taskID, holderID, command, args, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &RunPlan{
+		TaskID:       taskID,
+		Connector:    conn.Name(),
+		ExecPlan:     connectors.ExecPlan{Command: command, Args: args, Dir: connectors.WorkDirFromContext(ctx), Env: opts.Env},
+		StdinLen:     len(opts.Input.Stdin),
+		PTY:          opts.Input.PTY,
+		Capabilities: conn.Capabilities(),
+		DryRun:       true,
+	}
+	if p, ok := conn.(connectors.Planner); ok {
+		ep, err := p.Plan(ctx, command, args)
+		if err != nil {
+			return nil, err
+		}
+		plan.ExecPlan = *ep
+	}
+
+	s.pdr.Record("task.run.dry_run", map[string]interface{}{"task_id": taskID, "command": command, "args": args, "dir": plan.Dir, "env": envNames(plan.Env)}, "planned", taskID, "holder="+holderID)
+	return plan, nil
+}
+
+// RunTask executes a command for a task.
+func (s *Service) RunTask(taskID, holderID, command string, args []string, opts RunOptions) (*models.Run, error) {
+	ctx, conn, err := s.prepareRun(context.Background(), taskID, holderID, command, args, opts)
+	if err != nil {
+		return nil, err
 	}
 
 	// Update task status
@@ -108,6 +773,30 @@ func (s *Service) RunTask(taskID, holderID, command string, args []string) (*mod
 		return nil, err
 	}
 
+	run, err := s.execRun(ctx, conn, taskID, command, args, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.finishRuns(taskID, run.ExitCode == 0)
+	return run, nil
+}
+
+// RunClaimed runs a command for a task the scheduler has claimed, checked,
+// executed and recorded like a RunTask by the task's holder, with stdin
+// fed to the command. Unlike RunTask it leaves the task's status to the
+// scheduler. It implements scheduler.TaskRunner.
+func (s *Service) RunClaimed(ctx context.Context, task *models.Task, command string, args []string, stdin []byte) (*models.Run, error) {
+	opts := RunOptions{Input: connectors.Input{Stdin: stdin}}
+	ctx, conn, err := s.prepareRun(ctx, task.ID, task.ClaimedBy, command, args, opts)
+	if err != nil {
+		return nil, err
+	}
+	return s.execRun(ctx, conn, task.ID, command, args, opts)
+}
+
+// execRun executes one command through conn and records it: the run, its
+// diff, its audit record and a memory item.
+func (s *Service) execRun(ctx context.Context, conn connectors.Connector, taskID, command string, args []string, opts RunOptions) (*models.Run, error) {
 	// Create run record
 	run, err := s.store.CreateRun(taskID, command, args)
 	if err != nil {
@@ -115,46 +804,222 @@ func (s *Service) RunTask(taskID, holderID, command string, args []string) (*mod
 	}
 
 	// Execute via connector
-	result, execErr := s.connector.Execute(context.Background(), command, args)
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	result, execErr := conn.Execute(ctx, command, args)
 
 	outcome := "success"
-	var exitCode int
-	var stdout, stderr string
-
 	if execErr != nil {
 		outcome = "error"
-		stderr = execErr.Error()
-		exitCode = -1
+		run.Stderr = execErr.Error()
+		run.ExitCode = -1
 	} else {
-		exitCode = result.ExitCode
-		stdout = result.Stdout
-		stderr = result.Stderr
-		if exitCode != 0 {
+		run.ExitCode = result.ExitCode
+		run.Stdout = result.Stdout
+		run.Stderr = result.Stderr
+		run.Truncated = result.Truncated
+		if run.ExitCode != 0 {
 			outcome = "failed"
 		}
 	}
 
-	// Update run record
-	if err := s.store.UpdateRun(run.ID, exitCode, stdout, stderr); err != nil {
+	// Update run record; this applies the store's output limit to run
+	if err := s.store.FinishRun(run); err != nil {
 		return nil, err
 	}
+	s.captureDiff(run, connectors.WorkDirFromContext(ctx))
 
-	// Update task status
+	// Record PDR
+	s.pdr.Record("task.run", map[string]interface{}{"task_id": taskID, "command": command, "args": args, "stdin_len": len(opts.Input.Stdin), "pty": opts.Input.PTY, "env": envNames(opts.Env), "sandbox": connectors.SandboxFromContext(ctx)}, outcome, taskID, "")
+
+	// Store run as memory item
+	s.store.AddMemory(taskID, "Run: "+command+" "+joinArgs(args)+"\nOutput: "+run.Stdout, "run,log")
+
+	return run, nil
+}
+
+// finishRuns completes or fails a task once its runs are done.
+func (s *Service) finishRuns(taskID string, ok bool) models.TaskStatus {
 	status := models.TaskStatusCompleted
-	if outcome != "success" {
+	if !ok {
 		status = models.TaskStatusFailed
 	}
 	s.store.UpdateTaskStatus(taskID, status)
+	s.finishWorktree(taskID, ok)
+	return status
+}
 
-	// Record PDR
-	s.pdr.Record("task.run", map[string]interface{}{"task_id": taskID, "command": command, "args": args}, outcome, taskID, "")
+// PipelineResult is the outcome of running a task's pipeline.
+type PipelineResult struct {
+	TaskID string            `json:"task_id"`
+	Status models.TaskStatus `json:"status"`
+	// Runs holds a run per executed step, in order.
+	Runs []models.Run `json:"runs"`
+	// Skipped counts the steps whose condition did not hold.
+	Skipped int `json:"skipped"`
+	// Outputs holds the outputs captured by each named step.
+	Outputs map[string]map[string]string `json:"outputs,omitempty"`
+}
 
-	// Store run as memory item
-	s.store.AddMemory(taskID, "Run: "+command+" "+joinArgs(args)+"\nOutput: "+stdout, "run,log")
+// RunPipeline executes a task's steps in order, recording each as a run.
+// A failing step fails the task and, by default, the steps after it are
+// skipped, unless the step continues on error. Each step's When decides
+// whether it runs, and its command and args are expanded with the outputs
+// of the steps before it. Steps without placeholders are checked against
+// the connector's policies before the first one runs; the others are
+// checked once expanded, and fail their step if denied.
+func (s *Service) RunPipeline(taskID, holderID string, opts RunOptions) (*PipelineResult, error) {
+	task, err := s.store.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		return nil, ErrNotFound
+	}
+	if len(task.Steps) == 0 {
+		return nil, ErrNoSteps
+	}
+	ctxs := make([]context.Context, len(task.Steps))
+	conns := make([]connectors.Connector, len(task.Steps))
+	for i, step := range task.Steps {
+		if pipeline.Templated(step) {
+			continue
+		}
+		if ctxs[i], conns[i], err = s.prepareRun(context.Background(), taskID, holderID, step.Command, step.Args, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.store.UpdateTaskStatus(taskID, models.TaskStatusRunning); err != nil {
+		return nil, err
+	}
+	res := &PipelineResult{TaskID: taskID, Runs: []models.Run{}}
+	st := pipeline.NewState()
+	for i, step := range task.Steps {
+		if !st.ShouldRun(step) {
+			res.Skipped++
+			continue
+		}
+		var run *models.Run
+		if conns[i] != nil {
+			run, err = s.execRun(ctxs[i], conns[i], taskID, step.Command, step.Args, opts)
+		} else {
+			run, err = s.execTemplated(st, taskID, holderID, step, opts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.Runs = append(res.Runs, *run)
+		if outputs := st.Record(step, run.ExitCode, run.Stdout); len(outputs) > 0 {
+			if res.Outputs == nil {
+				res.Outputs = make(map[string]map[string]string)
+			}
+			res.Outputs[step.Name] = outputs
+		}
+	}
+	ok := !st.Failed()
+	res.Status = s.finishRuns(taskID, ok)
 
-	run.ExitCode = exitCode
-	run.Stdout = stdout
-	run.Stderr = stderr
+	outcome := "success"
+	if !ok {
+		outcome = "failed"
+	}
+	s.pdr.Record("task.pipeline", map[string]interface{}{"task_id": taskID, "steps": len(task.Steps), "runs": len(res.Runs)}, outcome, taskID, "holder="+holderID)
+	return res, nil
+}
+
+// execTemplated expands a step with the outputs captured so far and runs
+// it. A step that cannot be expanded or is denied gets a failed run, so the
+// pipeline carries on as it would after any other failure.
+func (s *Service) execTemplated(st *pipeline.State, taskID, holderID string, step models.RunStep, opts RunOptions) (*models.Run, error) {
+	command, args, err := st.Expand(step)
+	if err == nil {
+		var ctx context.Context
+		var conn connectors.Connector
+		if ctx, conn, err = s.prepareRun(context.Background(), taskID, holderID, command, args, opts); err == nil {
+			return s.execRun(ctx, conn, taskID, command, args, opts)
+		}
+	} else {
+		command, args = step.Command, step.Args
+	}
+	run, cerr := s.store.CreateRun(taskID, command, args)
+	if cerr != nil {
+		return nil, cerr
+	}
+	run.ExitCode, run.Stderr = -1, err.Error()
+	if err := s.store.FinishRun(run); err != nil {
+		return nil, err
+	}
+	s.pdr.Record("task.run", map[string]interface{}{"task_id": taskID, "command": command, "args": args}, "error", taskID, err.Error())
+	return run, nil
+}
+
+// captureDiff stores the git diff of a run's workdir so reviewers can see
+// what the run changed. Runs without a workdir, outside a repository or
+// leaving no changes get no diff.
+func (s *Service) captureDiff(run *models.Run, dir string) {
+	if dir == "" {
+		return
+	}
+	diff, err := workspace.Diff(dir)
+	if err != nil {
+		s.pdr.Record("run.diff", map[string]string{"run_id": run.ID}, "error", run.TaskID, err.Error())
+		return
+	}
+	if diff == "" {
+		return
+	}
+	if err := s.store.SetRunDiff(run.ID, diff); err != nil {
+		s.pdr.Record("run.diff", map[string]string{"run_id": run.ID}, "error", run.TaskID, err.Error())
+		return
+	}
+	run.HasDiff = true
+}
+
+// GetRunDiff returns the workdir diff captured at the end of a run.
+func (s *Service) GetRunDiff(runID string) (string, error) {
+	diff, ok, err := s.store.GetRunDiff(runID)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrNotFound
+	}
+	return diff, nil
+}
+
+// GetRun returns a run, or ErrNotFound.
+func (s *Service) GetRun(runID string) (*models.Run, error) {
+	run, err := s.store.GetRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	if run == nil {
+		return nil, ErrNotFound
+	}
+	return run, nil
+}
+
+// RetryRun re-executes a run's command and args for its task, as RunTask
+// does, and links the new run to it. The holder must hold the task's
+// claim. The original run's stdin is not kept, so opts supplies any input.
+func (s *Service) RetryRun(runID, holderID string, opts RunOptions) (*models.Run, error) {
+	prev, err := s.GetRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	run, err := s.RunTask(prev.TaskID, holderID, prev.Command, prev.Args, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.SetRunRetryOf(run.ID, prev.ID); err != nil {
+		return nil, err
+	}
+	run.RetryOf = prev.ID
+	s.pdr.Record("run.retry", map[string]string{"run_id": run.ID, "retry_of": prev.ID}, "success", prev.TaskID, fmt.Sprintf("exit %d, was %d", run.ExitCode, prev.ExitCode))
 	return run, nil
 }
 
@@ -163,6 +1028,20 @@ func (s *Service) GetTaskLogs(taskID string) ([]models.Run, error) {
 	return s.store.GetRunsForTask(taskID)
 }
 
+// ListTaskLogs returns a page of a task's runs, newest first, and how many
+// runs the task has in total.
+func (s *Service) ListTaskLogs(taskID string, limit, offset int) ([]models.Run, int, error) {
+	total, err := s.store.CountTaskRuns(taskID)
+	if err != nil {
+		return nil, 0, err
+	}
+	runs, err := s.store.ListTaskRuns(taskID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
 // RenewLease renews a lease (heartbeat).
 func (s *Service) RenewLease(taskID, holderID string, ttlSec int) error {
 	lease, err := s.store.GetActiveLease(taskID)
@@ -172,24 +1051,130 @@ func (s *Service) RenewLease(taskID, holderID string, ttlSec int) error {
 	if lease == nil || lease.HolderID != holderID {
 		return ErrNotOwner
 	}
-	return s.store.RenewLease(lease.ID, ttlSec)
+	policy, err := s.claimPolicy(taskID)
+	if err != nil {
+		return err
+	}
+	return s.store.RenewLease(lease.ID, policy.TTL(ttlSec))
+}
+
+// RecordRun stores the result of a command the lease holder executed itself
+// (e.g. via `neona run exec`) rather than through the daemon's connector.
+func (s *Service) RecordRun(taskID, holderID, command string, args []string, exitCode int, stdout, stderr string) (*models.Run, error) {
+	lease, err := s.store.GetActiveLease(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if lease == nil || lease.HolderID != holderID {
+		return nil, ErrNotOwner
+	}
+
+	run, err := s.store.CreateRun(taskID, command, args)
+	if err != nil {
+		return nil, err
+	}
+	run.ExitCode, run.Stdout, run.Stderr = exitCode, stdout, stderr
+	if err := s.store.FinishRun(run); err != nil {
+		return nil, err
+	}
+	if task, err := s.store.GetTask(taskID); err == nil && task != nil && task.WorkDir != "" {
+		if dir, err := s.resolveWorkDir(task.WorkDir); err == nil {
+			s.captureDiff(run, dir)
+		}
+	}
+
+	outcome := "success"
+	if exitCode != 0 {
+		outcome = "failed"
+	}
+	s.pdr.Record("task.run", map[string]interface{}{"task_id": taskID, "command": command, "args": args}, outcome, taskID, "external holder="+holderID)
+	s.store.AddMemory(taskID, "Run: "+command+" "+joinArgs(args)+"\nOutput: "+run.Stdout, "run,log")
+
+	return run, nil
+}
+
+// CompleteTask marks a claimed task completed and ends the holder's lease.
+func (s *Service) CompleteTask(taskID, holderID string) error {
+	lease, err := s.store.GetActiveLease(taskID)
+	if err != nil {
+		return err
+	}
+	if lease == nil {
+		return ErrNoLease
+	}
+	if lease.HolderID != holderID {
+		return ErrNotOwner
+	}
+	subtasks, err := s.store.ListSubtasks(taskID)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subtasks {
+		if sub.Status != models.TaskStatusCompleted {
+			return fmt.Errorf("%w: %s (%s) is %s", ErrOpenSubtasks, sub.ID, sub.Title, sub.Status)
+		}
+	}
+	if s.requireChecklist {
+		items, err := s.store.ListChecklist(taskID)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if !item.Done {
+				return fmt.Errorf("%w: item %d (%s) is unchecked", ErrChecklistIncomplete, item.Position, item.Text)
+			}
+		}
+	}
+
+	if err := s.store.UpdateTaskStatus(taskID, models.TaskStatusCompleted); err != nil {
+		return err
+	}
+	if err := s.store.DeleteLease(lease.ID); err != nil {
+		return err
+	}
+	s.finishWorktree(taskID, true)
+
+	s.pdr.Record("task.complete", map[string]string{"task_id": taskID, "holder_id": holderID}, "success", taskID, "")
+	return nil
 }
 
 // --- Memory Operations ---
 
-// AddMemory adds a memory item.
-func (s *Service) AddMemory(taskID, content, tags string) (*models.MemoryItem, error) {
-	item, err := s.store.AddMemory(taskID, content, tags)
+// AddMemory adds a memory item to scope, or to the task's scope (global
+// without a task) when scope is empty. Content already in the scope is not
+// added again; the existing item is returned, marked Duplicate.
+func (s *Service) AddMemory(taskID, content, tags, scope string) (*models.MemoryItem, error) {
+	if scope != "" {
+		if _, err := scopeLevel(scope); err != nil {
+			return nil, err
+		}
+	}
+	added, err := s.store.AddMemoryBatch([]models.MemoryItem{{TaskID: taskID, Content: content, Tags: tags, Scope: scope}})
 	if err != nil {
 		return nil, err
 	}
-	s.pdr.Record("memory.add", map[string]string{"task_id": taskID, "content_len": fmt.Sprintf("%d", len(content))}, "success", taskID, "")
+	item := &added[0]
+	outcome := "success"
+	if item.Duplicate {
+		outcome = "duplicate"
+	}
+	s.pdr.Record("memory.add", map[string]string{"task_id": taskID, "scope": item.Scope, "content_len": fmt.Sprintf("%d", len(content))}, outcome, taskID, "id="+item.ID)
 	return item, nil
 }
 
-// QueryMemory searches memory items.
-func (s *Service) QueryMemory(query string) ([]models.MemoryItem, error) {
-	return s.store.QueryMemory(query)
+// AddMemoryBatch adds several memory items in a single store transaction.
+func (s *Service) AddMemoryBatch(items []models.MemoryItem) ([]models.MemoryItem, error) {
+	added, err := s.store.AddMemoryBatch(items)
+	if err != nil {
+		return nil, err
+	}
+	s.pdr.Record("memory.add_batch", map[string]int{"count": len(added)}, "success", "", "")
+	return added, nil
+}
+
+// QueryMemory searches memory items, in any of scopes when some are given.
+func (s *Service) QueryMemory(query string, scopes ...string) ([]models.MemoryItem, error) {
+	return s.store.QueryMemory(query, scopes...)
 }
 
 // GetTaskMemory returns memory items for a task.
@@ -197,6 +1182,101 @@ func (s *Service) GetTaskMemory(taskID string) ([]models.MemoryItem, error) {
 	return s.store.GetMemoryForTask(taskID)
 }
 
+// --- History Operations ---
+
+// GetActiveLease returns the task's unexpired lease, or nil.
+func (s *Service) GetActiveLease(taskID string) (*models.Lease, error) {
+	return s.store.GetActiveLease(taskID)
+}
+
+// TaskHistory returns the task's most recent limit audit records, oldest
+// first: its creation, claims, runs, releases and completion.
+func (s *Service) TaskHistory(taskID string, limit int) ([]models.PDREntry, error) {
+	// Records still queued by a buffered writer belong in the history too
+	if err := s.pdr.Flush(); err != nil {
+		return nil, err
+	}
+	return s.store.ListTaskPDRs(taskID, limit)
+}
+
+// --- Comment Operations ---
+
+// EventTaskComment is emitted to the task's current holder when someone else
+// comments on it.
+const EventTaskComment = "task.comment"
+
+// AddComment appends a comment to a task's discussion thread.
+func (s *Service) AddComment(taskID, author, body string) (*models.Comment, error) {
+	task, err := s.store.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		return nil, ErrNotFound
+	}
+
+	c, err := s.store.AddComment(taskID, author, body)
+	if err != nil {
+		return nil, err
+	}
+	s.pdr.Record("task.comment", map[string]string{"task_id": taskID, "author": author, "body_len": fmt.Sprintf("%d", len(body))}, "success", taskID, "author="+author)
+
+	if lease, err := s.store.GetActiveLease(taskID); err != nil {
+		return nil, err
+	} else if lease != nil && lease.HolderID != author {
+		if _, err := s.store.AddEvent(EventTaskComment, taskID, lease.HolderID, c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// ListComments returns a task's comments, oldest first.
+func (s *Service) ListComments(taskID string, since time.Time) ([]models.Comment, error) {
+	return s.store.ListComments(taskID, since)
+}
+
+// --- Checklist Operations ---
+
+// AddChecklistItems appends unchecked items to a task's checklist.
+func (s *Service) AddChecklistItems(taskID string, texts []string) ([]models.ChecklistItem, error) {
+	task, err := s.store.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		return nil, ErrNotFound
+	}
+	items, err := s.store.AddChecklistItems(taskID, texts)
+	if err != nil {
+		return nil, err
+	}
+	s.pdr.Record("task.checklist.add", map[string]interface{}{"task_id": taskID, "items": len(items)}, "success", taskID, "")
+	return items, nil
+}
+
+// ListChecklist returns a task's checklist in order.
+func (s *Service) ListChecklist(taskID string) ([]models.ChecklistItem, error) {
+	return s.store.ListChecklist(taskID)
+}
+
+// CheckItem checks (done) or unchecks an item of a task's checklist.
+func (s *Service) CheckItem(taskID, itemID string, done bool, by string) (*models.ChecklistItem, error) {
+	item, err := s.store.SetChecklistItemDone(taskID, itemID, done, by)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrNotFound
+	}
+	action := "task.checklist.check"
+	if !done {
+		action = "task.checklist.uncheck"
+	}
+	s.pdr.Record(action, map[string]interface{}{"task_id": taskID, "item_id": itemID, "by": by}, "success", taskID, item.Text)
+	return item, nil
+}
+
 // --- Lock Operations ---
 
 // AcquireLock acquires a lock on a resource.
@@ -218,6 +1298,17 @@ func (s *Service) ReleaseLock(lockID string) error {
 	return nil
 }
 
+// envNames returns the sorted names of env, leaving values (which may be
+// secrets) out of audit records.
+func envNames(env map[string]string) []string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func joinArgs(args []string) string {
 	result := ""
 	for _, a := range args {
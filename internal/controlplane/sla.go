@@ -0,0 +1,156 @@
+package controlplane
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// EventTaskSLABreached is emitted when a task is still open past its
+// deadline, to the current holder if the task is claimed.
+const EventTaskSLABreached = "task.sla_breached"
+
+// annotateTask sets the task's computed deadline and schedule flags as of
+// now.
+func annotateTask(t *models.Task, now time.Time) {
+	open := t.Status != models.TaskStatusCompleted && t.Status != models.TaskStatusFailed
+	t.Overdue = open && t.DueAt != nil && now.After(*t.DueAt)
+	t.SLABreached = t.Overdue || t.SLABreachedAt != nil
+	t.Scheduled = t.Status == models.TaskStatusPending && t.NotBefore != nil && t.NotBefore.After(now)
+}
+
+func annotateTasks(tasks []models.Task, now time.Time) {
+	for i := range tasks {
+		annotateTask(&tasks[i], now)
+	}
+}
+
+// CheckDeadlines records a breach for every open task past its deadline
+// and emits EventTaskSLABreached for it. It returns the tasks newly found
+// breached; each breach is reported once, even with several daemons
+// sharing the database.
+func (s *Service) CheckDeadlines(now time.Time) ([]models.Task, error) {
+	overdue, err := s.store.ListOverdueTasks(now)
+	if err != nil {
+		return nil, err
+	}
+
+	var breached []models.Task
+	for _, task := range overdue {
+		ok, err := s.store.MarkSLABreached(task.ID, now)
+		if err != nil {
+			return breached, err
+		}
+		if !ok {
+			continue
+		}
+		at := now.UTC()
+		task.SLABreachedAt = &at
+		annotateTask(&task, now)
+
+		holder := ""
+		if lease, err := s.store.GetActiveLease(task.ID); err != nil {
+			return breached, err
+		} else if lease != nil {
+			holder = lease.HolderID
+		}
+		payload := map[string]interface{}{"title": task.Title, "due_at": task.DueAt, "status": task.Status}
+		if _, err := s.store.AddEvent(EventTaskSLABreached, task.ID, holder, payload); err != nil {
+			return breached, err
+		}
+		s.pdr.Record("task.sla_breached", map[string]interface{}{"task_id": task.ID, "due_at": task.DueAt, "status": task.Status}, "breached", task.ID, "holder="+holder)
+		breached = append(breached, task)
+	}
+	return breached, nil
+}
+
+// Notifier delivers a message to a notification channel, such as a chat
+// webhook (see digest.WebhookNotifier).
+type Notifier interface {
+	Notify(ctx context.Context, text string) error
+}
+
+// DeadlineJob calls CheckDeadlines periodically and posts each breach to
+// its notifiers.
+type DeadlineJob struct {
+	service   *Service
+	notifiers []Notifier
+	loop
+}
+
+// NewDeadlineJob creates a job checking deadlines every interval.
+func NewDeadlineJob(service *Service, every time.Duration, notifiers ...Notifier) *DeadlineJob {
+	j := &DeadlineJob{service: service, notifiers: notifiers}
+	j.loop = loop{every: every, run: j.check}
+	return j
+}
+
+// loop runs a check now and then every interval, in the background from
+// Start until Stop.
+type loop struct {
+	every time.Duration
+	run   func(ctx context.Context)
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Start runs the job in the background until Stop is called.
+func (l *loop) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(l.every)
+		defer ticker.Stop()
+		for {
+			l.run(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the job and waits for an in-progress check to finish.
+func (l *loop) Stop() {
+	if l.cancel != nil {
+		l.cancel()
+	}
+	l.wg.Wait()
+}
+
+func (j *DeadlineJob) check(ctx context.Context) {
+	breached, err := j.service.CheckDeadlines(j.service.clock.Now())
+	if err != nil {
+		log.Printf("Deadlines: %v", err)
+	}
+	for _, task := range breached {
+		log.Printf("Deadlines: task %s (%s) missed its deadline", task.ID, task.Title)
+		text := slaBreachText(task)
+		for _, n := range j.notifiers {
+			if err := n.Notify(ctx, text); err != nil {
+				log.Printf("Deadlines: notification failed: %v", err)
+			}
+		}
+	}
+}
+
+func slaBreachText(t models.Task) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Task %q (%s) missed its deadline of %s", t.Title, t.ID, t.DueAt.Local().Format("2006-01-02 15:04"))
+	if t.ClaimedBy != "" {
+		fmt.Fprintf(&b, "; claimed by %s", t.ClaimedBy)
+	} else {
+		fmt.Fprintf(&b, "; %s", t.Status)
+	}
+	return b.String()
+}
@@ -0,0 +1,175 @@
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/clock"
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+type recordingNotifier struct{ texts []string }
+
+func (n *recordingNotifier) Notify(_ context.Context, text string) error {
+	n.texts = append(n.texts, text)
+	return nil
+}
+
+func TestDeadlines(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	due := time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+	s.handleTasks(w, httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{"title":"Hotfix","estimate_sec":1800,"due_at":"`+due+`"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var task models.Task
+	json.NewDecoder(w.Body).Decode(&task)
+	if task.EstimateSec != 1800 || task.DueAt == nil {
+		t.Fatalf("Expected estimate and deadline set, got %+v", task)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleTasks(w, httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{"title":"Bad","estimate_sec":-1}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a negative estimate, got %d", w.Code)
+	}
+
+	// Nothing is late yet
+	if breached, _ := s.service.CheckDeadlines(time.Now()); len(breached) != 0 {
+		t.Fatalf("Expected no breaches before the deadline, got %d", len(breached))
+	}
+	if _, err := s.service.ClaimTask(task.ID, "agent", 60); err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+
+	// Past the deadline the job reports the breach once, to the holder
+	notifier := &recordingNotifier{}
+	job := NewDeadlineJob(s.service, time.Minute, notifier)
+	later := time.Now().Add(2 * time.Minute)
+	breached, err := s.service.CheckDeadlines(later)
+	if err != nil || len(breached) != 1 || breached[0].ID != task.ID || !breached[0].Overdue {
+		t.Fatalf("Expected the task breached, got %+v, %v", breached, err)
+	}
+	if again, _ := s.service.CheckDeadlines(later); len(again) != 0 {
+		t.Errorf("Expected the breach reported once, got %d more", len(again))
+	}
+	events, _ := s.service.ListEvents("agent", time.Time{}, 0)
+	if len(events) != 1 || events[0].Type != EventTaskSLABreached || events[0].TaskID != task.ID {
+		t.Errorf("Expected a %s event for the holder, got %+v", EventTaskSLABreached, events)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	s.service.CreateTask("Docs", "", store.TaskOptions{DueAt: &past})
+	job.check(context.Background())
+	job.check(context.Background())
+	if len(notifier.texts) != 1 || !strings.Contains(notifier.texts[0], `"Docs"`) {
+		t.Errorf("Expected one notification for the late task, got %q", notifier.texts)
+	}
+
+	// Listings flag the breach even after the task completes
+	tasks, _ := s.service.ListTasks("")
+	for _, listed := range tasks {
+		if listed.ID == task.ID && (!listed.SLABreached || listed.Overdue) {
+			t.Errorf("Expected the claimed task breached but not yet overdue by the clock, got %+v", listed)
+		}
+	}
+	if err := s.service.CompleteTask(task.ID, "agent"); err != nil {
+		t.Fatalf("CompleteTask failed: %v", err)
+	}
+	got, _ := s.service.GetTask(task.ID)
+	if !got.SLABreached || got.Overdue {
+		t.Errorf("Expected a completed late task breached but not overdue, got overdue=%v breached=%v", got.Overdue, got.SLABreached)
+	}
+}
+
+func TestScheduledTasks(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	at := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	s.handleTasks(w, httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{"title":"Nightly","not_before":"`+at+`"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var task models.Task
+	json.NewDecoder(w.Body).Decode(&task)
+	if task.NotBefore == nil || !task.Scheduled {
+		t.Fatalf("Expected a scheduled task, got %+v", task)
+	}
+	s.service.CreateTask("Now", "", store.TaskOptions{})
+
+	list := func(status string) []models.Task {
+		w := httptest.NewRecorder()
+		s.handleTasks(w, httptest.NewRequest(http.MethodGet, "/tasks?status="+status, nil))
+		var tasks []models.Task
+		json.NewDecoder(w.Body).Decode(&tasks)
+		return tasks
+	}
+	if tasks := list("scheduled"); len(tasks) != 1 || tasks[0].ID != task.ID || !tasks[0].Scheduled {
+		t.Errorf("Expected only the delayed task listed as scheduled, got %+v", tasks)
+	}
+	if tasks := list("pending"); len(tasks) != 2 {
+		t.Errorf("Expected both tasks pending, got %d", len(tasks))
+	}
+
+	// Dispatch skips it, and the flag clears once it is eligible
+	if res, err := s.service.ClaimNextTask("w", 60, store.ClaimFilter{}); err != nil || res == nil || res.Task.Title != "Now" {
+		t.Fatalf("Expected the ready task dispatched, got %+v, %v", res, err)
+	}
+	if res, _ := s.service.ClaimNextTask("w", 60, store.ClaimFilter{}); res != nil {
+		t.Errorf("Expected the scheduled task held back, got %+v", res.Task)
+	}
+	got, _ := s.service.GetTask(task.ID)
+	annotateTask(got, got.NotBefore.Add(time.Second))
+	if got.Scheduled {
+		t.Error("Expected the task no longer scheduled after its not_before")
+	}
+}
+
+func TestServiceClock(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	c := clock.NewFake(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC))
+	s.store.(*store.Store).SetClock(c)
+	s.service.SetClock(c)
+
+	notBefore, due := c.Now().Add(time.Hour), c.Now().Add(2*time.Hour)
+	later, _ := s.service.CreateTask("Later", "", store.TaskOptions{NotBefore: &notBefore})
+	quiet, _ := s.service.CreateTask("Quiet", "", store.TaskOptions{DueAt: &due})
+	if !later.Scheduled || quiet.Overdue {
+		t.Fatalf("Expected the delayed task scheduled and nothing overdue, got %+v and %+v", later, quiet)
+	}
+	if _, err := s.service.ClaimTask(quiet.ID, "agent", 60); err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+
+	// Only the fake clock moving makes tasks eligible, overdue and stale
+	c.Advance(3 * time.Hour)
+	if got, _ := s.service.GetTask(later.ID); got.Scheduled {
+		t.Error("Expected the task no longer scheduled after its not_before")
+	}
+	if got, _ := s.service.GetTask(quiet.ID); !got.Overdue {
+		t.Error("Expected the claimed task overdue after its deadline")
+	}
+	if stale, _ := s.service.ListTasks(ListStale); len(stale) != 1 || stale[0].ID != quiet.ID {
+		t.Errorf("Expected the quiet claim stale, got %+v", stale)
+	}
+
+	deadlines, staleClaims := &recordingNotifier{}, &recordingNotifier{}
+	NewDeadlineJob(s.service, time.Minute, deadlines).check(context.Background())
+	NewStaleJob(s.service, time.Minute, staleClaims).check(context.Background())
+	if len(deadlines.texts) != 1 || len(staleClaims.texts) != 1 {
+		t.Errorf("Expected the jobs to report the task by the fake clock, got %q and %q", deadlines.texts, staleClaims.texts)
+	}
+}
@@ -0,0 +1,156 @@
+package controlplane
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// EventTaskStale is emitted to the holder of a stale claim.
+const EventTaskStale = "task.stale"
+
+// ListStale is the ListTasks status filter for stale claims: claimed or
+// running tasks whose holder has gone quiet for the stale factor's worth of
+// lease TTLs, without a heartbeat or a run.
+const ListStale = "stale"
+
+// DefaultStaleFactor is how many lease TTLs a quiet claim lasts before it
+// is stale, unless SetStaleFactor changes it.
+const DefaultStaleFactor = 3
+
+// SetStaleFactor sets how many lease TTLs a claim may go without a
+// heartbeat or run before it is stale; 0 disables stale claims.
+// Must be called before serving requests - not safe for concurrent use.
+func (s *Service) SetStaleFactor(n int) {
+	s.staleFactor = n
+}
+
+// StaleTasks returns the stale claims as of now, with LastActivityAt set.
+func (s *Service) StaleTasks(now time.Time) ([]models.Task, error) {
+	if s.staleFactor <= 0 {
+		return nil, nil
+	}
+	var stale []models.Task
+	for _, status := range []models.TaskStatus{models.TaskStatusClaimed, models.TaskStatusRunning} {
+		tasks, err := s.ListTasks(string(status))
+		if err != nil {
+			return nil, err
+		}
+		for _, task := range tasks {
+			last, ttl, err := s.lastActivity(task)
+			if err != nil {
+				return nil, err
+			}
+			if ttl > 0 && now.Sub(last) > time.Duration(s.staleFactor*ttl)*time.Second {
+				task.LastActivityAt = &last
+				stale = append(stale, task)
+			}
+		}
+	}
+	return stale, nil
+}
+
+// lastActivity returns when the holder of a claimed task was last heard
+// from and the TTL of its lease. A task without a lease has a TTL of 0.
+func (s *Service) lastActivity(task models.Task) (time.Time, int, error) {
+	lease, err := s.store.GetLatestLease(task.ID)
+	if err != nil || lease == nil {
+		return time.Time{}, 0, err
+	}
+	// Claims and heartbeats set the expiry a TTL ahead
+	last := lease.ExpiresAt.Add(-time.Duration(lease.TTLSec) * time.Second)
+	runs, err := s.store.ListTaskRuns(task.ID, 1, 0)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	for _, run := range runs {
+		for _, at := range []time.Time{run.StartedAt, run.EndedAt} {
+			if at.After(last) {
+				last = at
+			}
+		}
+	}
+	return last, lease.TTLSec, nil
+}
+
+// staleReports remembers the claims reported stale so each is reported
+// once. It is kept in memory: after a restart or a change of leader, claims
+// still stale are reported again.
+type staleReports struct {
+	mu     sync.Mutex
+	claims map[string]time.Time // task ID -> ClaimedAt of the reported claim
+}
+
+// CheckStaleClaims emits EventTaskStale for every claim newly found stale
+// and returns those tasks. A claim that recovers and goes quiet again is
+// reported again.
+func (s *Service) CheckStaleClaims(now time.Time) ([]models.Task, error) {
+	stale, err := s.StaleTasks(now)
+	if err != nil {
+		return nil, err
+	}
+
+	s.stale.mu.Lock()
+	defer s.stale.mu.Unlock()
+	claims := make(map[string]time.Time, len(stale))
+	var found []models.Task
+	for _, task := range stale {
+		var claimedAt time.Time
+		if task.ClaimedAt != nil {
+			claimedAt = *task.ClaimedAt
+		}
+		claims[task.ID] = claimedAt
+		if at, ok := s.stale.claims[task.ID]; ok && at.Equal(claimedAt) {
+			continue
+		}
+
+		payload := map[string]interface{}{"title": task.Title, "claimed_at": task.ClaimedAt, "last_activity_at": task.LastActivityAt}
+		if _, err := s.store.AddEvent(EventTaskStale, task.ID, task.ClaimedBy, payload); err != nil {
+			return found, err
+		}
+		s.pdr.Record("task.stale", map[string]interface{}{"task_id": task.ID, "last_activity_at": task.LastActivityAt}, "stale", task.ID, "holder="+task.ClaimedBy)
+		found = append(found, task)
+	}
+	s.stale.claims = claims
+	return found, nil
+}
+
+// StaleJob calls CheckStaleClaims periodically and posts each stale claim
+// to its notifiers.
+type StaleJob struct {
+	service   *Service
+	notifiers []Notifier
+	loop
+}
+
+// NewStaleJob creates a job checking for stale claims every interval.
+func NewStaleJob(service *Service, every time.Duration, notifiers ...Notifier) *StaleJob {
+	j := &StaleJob{service: service, notifiers: notifiers}
+	j.loop = loop{every: every, run: j.check}
+	return j
+}
+
+func (j *StaleJob) check(ctx context.Context) {
+	stale, err := j.service.CheckStaleClaims(j.service.clock.Now())
+	if err != nil {
+		log.Printf("Stale claims: %v", err)
+	}
+	for _, task := range stale {
+		log.Printf("Stale claims: task %s (%s) held by %s has gone quiet", task.ID, task.Title, task.ClaimedBy)
+		text := staleClaimText(task)
+		for _, n := range j.notifiers {
+			if err := n.Notify(ctx, text); err != nil {
+				log.Printf("Stale claims: notification failed: %v", err)
+			}
+		}
+	}
+}
+
+func staleClaimText(t models.Task) string {
+	return fmt.Sprintf("Task %q (%s) claimed by %s has had no heartbeat or run since %s",
+		t.Title, t.ID, t.ClaimedBy, t.LastActivityAt.Local().Format("2006-01-02 15:04"))
+}
@@ -0,0 +1,88 @@
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+func TestStaleClaims(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	quiet, _ := s.service.CreateTask("Quiet", "", store.TaskOptions{})
+	busy, _ := s.service.CreateTask("Long lease", "", store.TaskOptions{})
+	s.service.CreateTask("Unclaimed", "", store.TaskOptions{})
+	if _, err := s.service.ClaimTask(quiet.ID, "agent", 60); err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+	if _, err := s.service.ClaimTask(busy.ID, "other", 600); err != nil {
+		t.Fatalf("ClaimTask failed: %v", err)
+	}
+
+	// Three TTLs of silence make a claim stale
+	if stale, _ := s.service.StaleTasks(time.Now().Add(2 * time.Minute)); len(stale) != 0 {
+		t.Fatalf("Expected no stale claims within 3 TTLs, got %d", len(stale))
+	}
+	later := time.Now().Add(4 * time.Minute)
+	stale, err := s.service.CheckStaleClaims(later)
+	if err != nil || len(stale) != 1 || stale[0].ID != quiet.ID || stale[0].LastActivityAt == nil {
+		t.Fatalf("Expected the quiet claim stale, got %+v, %v", stale, err)
+	}
+	if again, _ := s.service.CheckStaleClaims(later); len(again) != 0 {
+		t.Errorf("Expected the stale claim reported once, got %d more", len(again))
+	}
+	events, _ := s.service.ListEvents("agent", time.Time{}, 0)
+	if len(events) != 1 || events[0].Type != EventTaskStale || events[0].TaskID != quiet.ID {
+		t.Errorf("Expected a %s event for the holder, got %+v", EventTaskStale, events)
+	}
+
+	// A heartbeat ten minutes ago leaves the claim stale by the clock too
+	lease, _ := s.service.GetActiveLease(quiet.ID)
+	if err := s.store.RenewLease(lease.ID, -540); err != nil {
+		t.Fatalf("RenewLease failed: %v", err)
+	}
+	w := httptest.NewRecorder()
+	s.handleTasks(w, httptest.NewRequest(http.MethodGet, "/tasks?status=stale", nil))
+	var listed []models.Task
+	json.NewDecoder(w.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0].ID != quiet.ID || listed[0].LastActivityAt == nil {
+		t.Fatalf("Expected the quiet claim listed as stale, got %+v", listed)
+	}
+	if since := time.Since(*listed[0].LastActivityAt); since < 9*time.Minute || since > 11*time.Minute {
+		t.Errorf("Expected the last activity at the heartbeat, got %s ago", since)
+	}
+
+	// The job posts claims it has not reported yet
+	notifier := &recordingNotifier{}
+	job := NewStaleJob(s.service, time.Minute, notifier)
+	job.check(context.Background())
+	if len(notifier.texts) != 0 {
+		t.Errorf("Expected the reported claim not posted again, got %q", notifier.texts)
+	}
+	s.service.stale.claims = nil
+	job.check(context.Background())
+	if len(notifier.texts) != 1 || !strings.Contains(notifier.texts[0], `"Quiet"`) {
+		t.Errorf("Expected one notification for the quiet claim, got %q", notifier.texts)
+	}
+
+	s.service.SetStaleFactor(0)
+	if stale, _ := s.service.StaleTasks(later); len(stale) != 0 {
+		t.Errorf("Expected a zero factor to disable stale claims, got %d", len(stale))
+	}
+}
+
+func TestStaleClaimText(t *testing.T) {
+	at := time.Date(2024, 5, 1, 9, 30, 0, 0, time.Local)
+	text := staleClaimText(models.Task{ID: "t1", Title: "Deploy", ClaimedBy: "agent", LastActivityAt: &at})
+	if !strings.Contains(text, `"Deploy"`) || !strings.Contains(text, "agent") || !strings.Contains(text, "2024-05-01 09:30") {
+		t.Errorf("staleClaimText = %q", text)
+	}
+}
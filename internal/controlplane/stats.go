@@ -0,0 +1,71 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// SchedulerDisabled is Stats.Scheduler for a daemon without a scheduler.
+const SchedulerDisabled = "disabled"
+
+// Stats is the body of GET /stats: the state of the task queue at a glance.
+type Stats struct {
+	// Scheduler is the scheduler's state: running, draining, drained,
+	// stopped or disabled.
+	Scheduler     string `json:"scheduler"`
+	ActiveWorkers int    `json:"active_workers"`
+	// Tasks counts tasks by status.
+	Tasks map[string]int `json:"tasks"`
+	Total int            `json:"total"`
+	// Overdue counts open tasks past their deadline.
+	Overdue int `json:"overdue"`
+	// Scheduled counts pending tasks held back by their not_before time.
+	Scheduled int `json:"scheduled"`
+	// DBWarnings lists the soft database limits crossed, as of the last
+	// check (see SetDBQuota).
+	DBWarnings []DBWarning `json:"db_warnings,omitempty"`
+}
+
+// TaskStats counts tasks by status, overdue and scheduled, and adds the
+// database warnings. The scheduler fields are left for the caller.
+func (s *Service) TaskStats() (*Stats, error) {
+	tasks, err := s.ListTasks("")
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{Tasks: map[string]int{}, Total: len(tasks), DBWarnings: s.DBWarnings()}
+	for _, t := range tasks {
+		stats.Tasks[string(t.Status)]++
+		if t.Overdue {
+			stats.Overdue++
+		}
+		if t.Scheduled {
+			stats.Scheduled++
+		}
+	}
+	return stats, nil
+}
+
+// handleStats handles GET /stats.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats, err := s.service.TaskStats()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stats.Scheduler = SchedulerDisabled
+	if s.scheduler != nil {
+		sched := s.scheduler.GetStats()
+		if state, ok := sched["state"].(string); ok {
+			stats.Scheduler = state
+		}
+		stats.ActiveWorkers, _ = sched["active_workers"].(int)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,92 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/store"
+)
+
+type stubScheduler map[string]interface{}
+
+func (s stubScheduler) GetStats() map[string]interface{} { return s }
+
+func TestStatsEndpoint(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	s.service.CreateTask("Late", "", store.TaskOptions{DueAt: &past})
+	s.service.CreateTask("Later", "", store.TaskOptions{NotBefore: &future})
+	claimed, _ := s.service.CreateTask("Busy", "", store.TaskOptions{})
+	claimForTest(t, s, claimed.ID, "worker-1", nil)
+
+	get := func() Stats {
+		t.Helper()
+		w := doRequest(s, http.MethodGet, "/stats", "", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var stats Stats
+		if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+			t.Fatalf("decode stats: %v", err)
+		}
+		return stats
+	}
+
+	stats := get()
+	if stats.Scheduler != SchedulerDisabled || stats.Total != 3 || stats.Tasks["pending"] != 2 || stats.Tasks["claimed"] != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if stats.Overdue != 1 || stats.Scheduled != 1 {
+		t.Errorf("Expected 1 overdue and 1 scheduled, got %+v", stats)
+	}
+
+	s.SetScheduler(stubScheduler{"state": "draining", "active_workers": 2})
+	if stats := get(); stats.Scheduler != "draining" || stats.ActiveWorkers != 2 {
+		t.Errorf("Expected the scheduler's state, got %+v", stats)
+	}
+}
+
+func TestClaimStats(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	task, _ := s.service.CreateTask("Contended", "", store.TaskOptions{})
+	claimForTest(t, s, task.ID, "worker-1", nil)
+	if w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/claim", `{"holder_id":"worker-2"}`, nil); w.Code != http.StatusConflict {
+		t.Fatalf("Expected 409 for the second claim, got %d", w.Code)
+	}
+	// Polls that find nothing are not attempts
+	if res, _ := s.service.ClaimNextTask("worker-2", 60, store.ClaimFilter{}); res != nil {
+		t.Fatalf("Expected nothing to claim, got %+v", res.Task)
+	}
+
+	type workerClaims struct {
+		Claims    store.ClaimStats `json:"claims"`
+		APIClaims store.ClaimStats `json:"api_claims"`
+	}
+	get := func() workerClaims {
+		t.Helper()
+		var stats workerClaims
+		w := doRequest(s, http.MethodGet, "/workers", "", nil)
+		if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+			t.Fatalf("decode workers: %v", err)
+		}
+		return stats
+	}
+	stats := get()
+	if api := stats.APIClaims; api.Attempts != 2 || api.Conflicts != 1 || api.AvgLatencyMs <= 0 {
+		t.Errorf("Expected 2 API claims with 1 conflict, got %+v", api)
+	}
+	if stats.Claims.Attempts != 0 {
+		t.Errorf("Expected no scheduler claims without a scheduler, got %+v", stats.Claims)
+	}
+
+	s.SetScheduler(stubScheduler{"claims": store.ClaimStats{Attempts: 5}})
+	if stats := get(); stats.Claims.Attempts != 5 || stats.APIClaims.Attempts != 2 {
+		t.Errorf("Expected the scheduler's and the API's claims side by side, got %+v", stats)
+	}
+}
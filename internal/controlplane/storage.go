@@ -0,0 +1,169 @@
+package controlplane
+
+import (
+	"context"
+	"time"
+
+	"github.com/fentz26/neona/internal/audit"
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+// TaskStore creates, reads and updates tasks.
+type TaskStore interface {
+	CreateTask(title, description string) (*models.Task, error)
+	CreateTaskWithOptions(title, description string, opts store.TaskOptions) (*models.Task, error)
+	// GetTask returns nil without an error when the task does not exist.
+	GetTask(id string) (*models.Task, error)
+	// FindTaskIDs returns up to limit IDs starting with prefix, in ID order.
+	FindTaskIDs(prefix string, limit int) ([]string, error)
+	// ListTasks returns tasks by priority, highest first, and newest first
+	// within a priority; all of them if status is "".
+	ListTasks(status string) ([]models.Task, error)
+	// UpdateTaskStatus completes a parent along with its last open subtask.
+	UpdateTaskStatus(id string, status models.TaskStatus) error
+	// ListSubtasks returns a task's direct subtasks, oldest first.
+	ListSubtasks(parentID string) ([]models.Task, error)
+	// ListOverdueTasks returns open tasks past their deadline whose breach
+	// is not recorded yet.
+	ListOverdueTasks(now time.Time) ([]models.Task, error)
+	// MarkSLABreached records a breach, reporting false if it already was.
+	MarkSLABreached(id string, at time.Time) (bool, error)
+	SetTaskWorkDir(id, dir string) error
+	SetTaskPRURL(id, url string) error
+	// ReleaseTask returns a claimed task to pending and deletes its leases
+	// in one step, failing with store.ErrTaskNotClaimed or
+	// store.ErrNotHolder. It returns the holder it was released from.
+	ReleaseTask(id string, opts store.ReleaseOptions) (string, error)
+}
+
+// LeaseStore claims tasks and keeps their leases.
+type LeaseStore interface {
+	// ClaimTaskWithLeaseTx claims a pending task and leases it in one step,
+	// failing with store.ErrTaskNotClaimable or store.ErrTaskAlreadyLeased.
+	ClaimTaskWithLeaseTx(taskID, holderID string, ttlSec int) (*store.ClaimResult, error)
+	AtomicClaimTask(holderID string, ttlSec int) (*models.Task, *models.Lease, error)
+	// AtomicClaimNext claims the eligible pending task of highest priority,
+	// the oldest of those, returning nils when there is none.
+	AtomicClaimNext(holderID string, ttlSec int, filter store.ClaimFilter) (*models.Task, *models.Lease, error)
+	// GetActiveLease returns nil without an error when the task has no
+	// unexpired lease.
+	GetActiveLease(taskID string) (*models.Lease, error)
+	// GetLatestLease returns the task's newest lease even if it expired,
+	// or nil.
+	GetLatestLease(taskID string) (*models.Lease, error)
+	// ListActiveLeases returns every unexpired lease, oldest first.
+	ListActiveLeases() ([]models.Lease, error)
+	RenewLease(leaseID string, ttlSec int) error
+	// SetLeaseTTL restarts a lease with a new TTL, recording it.
+	SetLeaseTTL(leaseID string, ttlSec int) error
+	SetLeaseTokenHash(leaseID, tokenHash string) error
+	DeleteLease(leaseID string) error
+	DeleteLeasesForTask(taskID string) error
+}
+
+// RunStore records command runs and their output.
+type RunStore interface {
+	CreateRun(taskID, command string, args []string) (*models.Run, error)
+	// FinishRun stores the result, capping output and updating run in place.
+	FinishRun(run *models.Run) error
+	// GetRun returns nil without an error when the run does not exist.
+	GetRun(id string) (*models.Run, error)
+	// SetRunRetryOf links a run to the run it re-executed.
+	SetRunRetryOf(id, retryOf string) error
+	GetRunsForTask(taskID string) ([]models.Run, error)
+	// ListTaskRuns returns a page of runs, newest first; a negative limit
+	// returns every run after offset.
+	ListTaskRuns(taskID string, limit, offset int) ([]models.Run, error)
+	CountTaskRuns(taskID string) (int, error)
+	SetRunDiff(id, diff string) error
+	GetRunDiff(id string) (diff string, ok bool, err error)
+}
+
+// MemoryStore keeps memory items.
+type MemoryStore interface {
+	AddMemory(taskID, content, tags string) (*models.MemoryItem, error)
+	AddMemoryBatch(items []models.MemoryItem) ([]models.MemoryItem, error)
+	QueryMemory(query string, scopes ...string) ([]models.MemoryItem, error)
+	GetMemoryForTask(taskID string) ([]models.MemoryItem, error)
+	GetMemoryItem(id string) (*models.MemoryItem, error)
+	SetMemoryScope(id, scope string) error
+	// Items synced from repository files, one per source and scope
+	ListSourcedMemory(scope string) ([]models.MemoryItem, error)
+	PutSourcedMemory(item models.MemoryItem) (*models.MemoryItem, error)
+	DeleteSourcedMemory(scope, source string) error
+}
+
+// EventStore keeps holder notifications.
+type EventStore interface {
+	AddEvent(eventType, taskID, holderID string, payload interface{}) (*models.Event, error)
+	ListEvents(holderID string, since time.Time, limit int) ([]models.Event, error)
+}
+
+// CommentStore keeps task discussion threads.
+type CommentStore interface {
+	AddComment(taskID, author, body string) (*models.Comment, error)
+	ListComments(taskID string, since time.Time) ([]models.Comment, error)
+}
+
+// ChecklistStore keeps task checklists.
+type ChecklistStore interface {
+	AddChecklistItems(taskID string, texts []string) ([]models.ChecklistItem, error)
+	ListChecklist(taskID string) ([]models.ChecklistItem, error)
+	// SetChecklistItemDone returns nil if the task has no such item.
+	SetChecklistItemDone(taskID, itemID string, done bool, by string) (*models.ChecklistItem, error)
+}
+
+// AuditLogStore reads back the audit trail written through audit.Store.
+type AuditLogStore interface {
+	// ListTaskPDRs returns a task's most recent records, oldest first.
+	ListTaskPDRs(taskID string, limit int) ([]models.PDREntry, error)
+}
+
+// LockStore grants resource locks.
+type LockStore interface {
+	// AcquireLock fails with store.ErrResourceLocked while another unexpired
+	// lock is held on the resource.
+	AcquireLock(resourceID, holderID, lockType string, ttlSec int) (*models.Lock, error)
+	ReleaseLock(lockID string) error
+	// ListLocks returns every unexpired lock, oldest first.
+	ListLocks() ([]models.Lock, error)
+}
+
+// IdempotencyStore remembers responses to requests sent with an
+// Idempotency-Key.
+type IdempotencyStore interface {
+	BeginIdempotent(scope, key, requestHash string) (*store.IdempotencyRecord, bool, error)
+	CompleteIdempotent(scope, key string, statusCode int, response []byte) error
+	DeleteIdempotent(scope, key string) error
+}
+
+// Store is everything the control plane needs from storage. store.Store
+// implements it on SQLite and store.Memory in memory, for tests and
+// embedding.
+type Store interface {
+	TaskStore
+	LeaseStore
+	RunStore
+	MemoryStore
+	EventStore
+	CommentStore
+	ChecklistStore
+	LockStore
+	IdempotencyStore
+	audit.Store
+	AuditLogStore
+
+	// Generation changes whenever the store is written; read caches key on it.
+	Generation() uint64
+	// Ping reports whether the store can serve requests.
+	Ping(ctx context.Context) error
+	// Size reports the database size and the row counts of its growing
+	// tables.
+	Size() (*store.SizeStats, error)
+}
+
+var (
+	_ Store = (*store.Store)(nil)
+	_ Store = (*store.Memory)(nil)
+)
@@ -0,0 +1,62 @@
+package controlplane
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fentz26/neona/internal/audit"
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+// newMemoryTestServer is newTestServer backed by the in-memory store, for
+// tests that need no SQLite behaviour.
+func newMemoryTestServer(t *testing.T, conn *dirConnector) (*Server, *store.Memory) {
+	t.Helper()
+	st := store.NewMemory()
+	service := NewService(st, audit.NewPDRWriter(st), conn)
+	return NewServer(service, st, "127.0.0.1:0"), st
+}
+
+func TestMemoryStoreLifecycle(t *testing.T) {
+	conn := &dirConnector{}
+	s, st := newMemoryTestServer(t, conn)
+
+	task, err := s.service.CreateTask("In memory", "", store.TaskOptions{Labels: []string{"build"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := claimForTest(t, s, task.ID, "worker-1", nil)
+	body := `{"holder_id":"worker-1","holder_token":"` + token + `","command":"git","args":["status"]}`
+	if w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", body, nil); w.Code != http.StatusOK {
+		t.Fatalf("run: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/complete", `{"holder_id":"worker-1","holder_token":"`+token+`"}`, nil); w.Code != http.StatusOK {
+		t.Fatalf("complete: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if len(conn.dirs) != 1 {
+		t.Errorf("Expected one command on the connector, got %d", len(conn.dirs))
+	}
+	if got, _ := s.service.GetTask(task.ID); got.Status != models.TaskStatusCompleted {
+		t.Errorf("Expected completed, got %s", got.Status)
+	}
+	if runs, _ := s.service.GetTaskLogs(task.ID); len(runs) != 1 {
+		t.Errorf("Expected one run, got %d", len(runs))
+	}
+	actions := map[string]bool{}
+	for _, e := range st.PDRs() {
+		actions[e.Action] = true
+	}
+	if !actions["task.claim"] || !actions["task.run"] {
+		t.Errorf("Expected claim and run audit records, got %v", actions)
+	}
+
+	if w := doRequest(s, http.MethodGet, "/health", "", nil); w.Code != http.StatusOK {
+		t.Errorf("health: expected 200, got %d", w.Code)
+	}
+	st.Close()
+	if w := doRequest(s, http.MethodGet, "/health", "", nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("health after close: expected 503, got %d", w.Code)
+	}
+}
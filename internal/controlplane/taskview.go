@@ -0,0 +1,188 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fentz26/neona/internal/mcp"
+	"github.com/fentz26/neona/internal/models"
+)
+
+// Sections GET /tasks/{id}?expand= can add to a task; "all" adds them all.
+var taskExpansions = []string{"lease", "runs", "memory", "history", "routing"}
+
+// Defaults for how much of each section a task view includes.
+const (
+	defaultViewRuns    = 5
+	defaultViewHistory = 20
+	viewMemorySamples  = 3
+)
+
+// TaskView is a task with the related records asked for with ?expand=.
+// Sections that were not asked for are omitted.
+type TaskView struct {
+	*models.Task
+
+	// Lease is the active lease; it is omitted when there is none.
+	Lease *models.Lease `json:"lease,omitempty"`
+	// Runs are the most recent runs, newest first, out of RunCount.
+	Runs     []models.Run `json:"runs,omitempty"`
+	RunCount *int         `json:"run_count,omitempty"`
+	Memory   *TaskMemory  `json:"memory,omitempty"`
+	// History is the task's audit trail, oldest first.
+	History []models.PDREntry `json:"history,omitempty"`
+	Routing *TaskRouting      `json:"routing,omitempty"`
+}
+
+// TaskMemory summarizes the memory items recorded for a task.
+type TaskMemory struct {
+	Count int `json:"count"`
+	// Recent holds the newest few items.
+	Recent []models.MemoryItem `json:"recent"`
+}
+
+// TaskRouting is the MCP routing decision for a task.
+type TaskRouting struct {
+	MCPs           []string `json:"mcps"`
+	MatchedRules   []string `json:"matched_rules"`
+	TotalTools     int      `json:"total_tools"`
+	FilteredTools  int      `json:"filtered_tools"`
+	Strategy       string   `json:"strategy,omitempty"`
+	Cached         bool     `json:"cached,omitempty"`
+	FallbackReason string   `json:"fallback_reason,omitempty"`
+}
+
+// parseExpand reads a comma-separated ?expand= list, returning the unknown
+// section if there is one.
+func parseExpand(v string) (map[string]bool, string) {
+	expand := make(map[string]bool)
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+		case name == "all":
+			for _, n := range taskExpansions {
+				expand[n] = true
+			}
+		case containsString(taskExpansions, name):
+			expand[name] = true
+		default:
+			return nil, name
+		}
+	}
+	return expand, ""
+}
+
+func containsString(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// viewLimit reads a positive page size from the query, capped at
+// maxLogsLimit. ok is false when the value is invalid.
+func viewLimit(r *http.Request, param string, def int) (n int, ok bool) {
+	v := r.URL.Query().Get(param)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return min(n, maxLogsLimit), true
+}
+
+// getTaskView handles GET /tasks/{id}?expand=lease,runs,memory,history,routing,
+// returning the task with the sections asked for in one response.
+// ?runs_limit= (default 5) and ?history_limit= (default 20) size the runs
+// and history sections.
+func (s *Server) getTaskView(w http.ResponseWriter, r *http.Request, taskID string) {
+	expand, unknown := parseExpand(r.URL.Query().Get("expand"))
+	if unknown != "" {
+		writeError(w, "unknown expand "+strconv.Quote(unknown)+" (want "+strings.Join(taskExpansions, ", ")+" or all)", http.StatusBadRequest)
+		return
+	}
+	runsLimit, ok := viewLimit(r, "runs_limit", defaultViewRuns)
+	if !ok {
+		writeError(w, "invalid runs_limit", http.StatusBadRequest)
+		return
+	}
+	historyLimit, ok := viewLimit(r, "history_limit", defaultViewHistory)
+	if !ok {
+		writeError(w, "invalid history_limit", http.StatusBadRequest)
+		return
+	}
+
+	task, err := s.service.GetTask(taskID)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if task == nil {
+		writeError(w, "task not found", http.StatusNotFound)
+		return
+	}
+	view := TaskView{Task: task}
+
+	if expand["lease"] {
+		if view.Lease, err = s.service.GetActiveLease(taskID); err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if expand["runs"] {
+		runs, total, err := s.service.ListTaskLogs(taskID, runsLimit, 0)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		view.Runs, view.RunCount = runs, &total
+	}
+	if expand["memory"] {
+		items, err := s.service.GetTaskMemory(taskID)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		view.Memory = &TaskMemory{Count: len(items), Recent: items[:min(len(items), viewMemorySamples)]}
+		if view.Memory.Recent == nil {
+			view.Memory.Recent = []models.MemoryItem{}
+		}
+	}
+	if expand["history"] {
+		if view.History, err = s.service.TaskHistory(taskID, historyLimit); err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	// Routing is left out when the daemon has no MCP router
+	if expand["routing"] && s.mcpRouter != nil {
+		result, err := s.mcpRouter.Route(r.Context(), mcp.Task{ID: task.ID, Title: task.Title, Description: task.Description})
+		if err != nil {
+			log.Printf("MCP routing failed for task %s: %v", task.ID, err)
+		} else {
+			view.Routing = &TaskRouting{
+				MCPs:           []string{},
+				MatchedRules:   append([]string{}, result.MatchedRules...),
+				TotalTools:     result.TotalTools,
+				FilteredTools:  result.FilteredTools,
+				Strategy:       result.Strategy,
+				Cached:         result.Cached,
+				FallbackReason: result.FallbackReason,
+			}
+			for _, m := range result.SelectedMCPs {
+				view.Routing.MCPs = append(view.Routing.MCPs, m.Name)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
@@ -0,0 +1,75 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fentz26/neona/internal/mcp"
+	"github.com/fentz26/neona/internal/store"
+)
+
+func TestTaskToolsEndpoint(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	// No router configured
+	task, _ := s.service.CreateTask("Open a pull request on github", "", store.TaskOptions{})
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tasks/"+task.ID+"/tools", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 without router, got %d", w.Code)
+	}
+
+	reg := mcp.NewRegistry()
+	reg.Register(mcp.MCPServer{Name: "filesystem", ToolCount: 12, Enabled: true})
+	reg.Register(mcp.MCPServer{Name: "github", Enabled: true, Tools: []mcp.Tool{
+		{Name: "create_pull_request", Description: "Open a PR"},
+		{Name: "create_issue"},
+	}})
+	reg.Register(mcp.MCPServer{Name: "slack", ToolCount: 8, Enabled: true})
+	s.SetMCPRouter(mcp.NewRouter(mcp.DefaultConfig(), reg))
+
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tasks/"+task.ID+"/tools", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp toolManifestResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.TaskID != task.ID || resp.Strategy != "keywords" {
+		t.Errorf("Unexpected task/strategy: %q/%q", resp.TaskID, resp.Strategy)
+	}
+
+	listed := make(map[string]bool)
+	for _, srv := range resp.Servers {
+		listed[srv.Name] = srv.ToolsListed
+	}
+	if tl, ok := listed["github"]; !ok || !tl {
+		t.Errorf("Expected github selected with tools listed, got %+v", resp.Servers)
+	}
+	if tl, ok := listed["filesystem"]; !ok || tl {
+		t.Errorf("Expected filesystem selected without tools listed, got %+v", resp.Servers)
+	}
+	if _, ok := listed["slack"]; ok {
+		t.Errorf("Did not expect slack to be selected")
+	}
+
+	if len(resp.Tools) != 2 {
+		t.Fatalf("Expected 2 tools, got %+v", resp.Tools)
+	}
+	if got := resp.Tools[0]; got.Name != "github__create_pull_request" || got.Tool != "create_pull_request" || got.Server != "github" {
+		t.Errorf("Unexpected tool entry: %+v", got)
+	}
+
+	// Unknown task
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tasks/does-not-exist/tools", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown task, got %d", w.Code)
+	}
+}
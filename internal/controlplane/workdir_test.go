@@ -0,0 +1,270 @@
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/fentz26/neona/internal/connectors"
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+	"github.com/fentz26/neona/internal/workspace"
+)
+
+// dirConnector records the workdir, input and sandbox profile of each
+// command it executes. It supports every feature unless caps is set.
+type dirConnector struct {
+	dirs      []string
+	inputs    []connectors.Input
+	sandboxes []string
+	caps      *connectors.Capabilities
+}
+
+func (c *dirConnector) Name() string                             { return "dir" }
+func (c *dirConnector) IsAllowed(cmd string, args []string) bool { return true }
+func (c *dirConnector) Capabilities() connectors.Capabilities {
+	if c.caps != nil {
+		return *c.caps
+	}
+	return connectors.Capabilities{Stdin: true, PTY: true, WorkDir: true, Env: true, Timeout: true, Sandbox: true}
+}
+func (c *dirConnector) Execute(ctx context.Context, cmd string, args []string) (*connectors.ExecResult, error) {
+	c.dirs = append(c.dirs, connectors.WorkDirFromContext(ctx))
+	c.inputs = append(c.inputs, connectors.InputFromContext(ctx))
+	c.sandboxes = append(c.sandboxes, connectors.SandboxFromContext(ctx))
+	return &connectors.ExecResult{Command: cmd, Args: args}, nil
+}
+
+// exitConnector runs every command, failing those named "false" and
+// printing the args of those named "echo".
+type exitConnector struct{ dirConnector }
+
+func (c *exitConnector) Execute(ctx context.Context, cmd string, args []string) (*connectors.ExecResult, error) {
+	res, err := c.dirConnector.Execute(ctx, cmd, args)
+	switch cmd {
+	case "false":
+		res.ExitCode = 1
+	case "echo":
+		res.Stdout = strings.Join(args, " ") + "\n"
+	}
+	return res, err
+}
+
+func TestTaskWorkDir(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := &dirConnector{}
+	s.service.connector = conn
+
+	root := t.TempDir()
+	checkout := filepath.Join(root, "api")
+	os.Mkdir(checkout, 0o755)
+
+	body := `{"title":"In checkout","workdir":"` + checkout + `"}`
+	if w := doRequest(s, http.MethodPost, "/tasks", body, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("workdir without roots: expected 400, got %d", w.Code)
+	}
+
+	roots, err := workspace.NewRoots(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.service.SetWorkRoots(roots)
+
+	if w := doRequest(s, http.MethodPost, "/tasks", `{"title":"Outside","workdir":"`+t.TempDir()+`"}`, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("workdir outside roots: expected 400, got %d", w.Code)
+	}
+
+	w := doRequest(s, http.MethodPost, "/tasks", body, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var task models.Task
+	json.NewDecoder(w.Body).Decode(&task)
+	want, _ := filepath.EvalSymlinks(checkout)
+	if task.WorkDir != want {
+		t.Errorf("Expected resolved workdir %q, got %q", want, task.WorkDir)
+	}
+
+	token := claimForTest(t, s, task.ID, "worker-1", nil)
+	run := `{"holder_id":"worker-1","holder_token":"` + token + `","command":"git","args":["status"]}`
+	if w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", run, nil); w.Code != http.StatusOK {
+		t.Fatalf("run: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(conn.dirs) != 1 || conn.dirs[0] != want {
+		t.Errorf("Expected command to run in %q, got %v", want, conn.dirs)
+	}
+
+	// A workdir removed after creation is refused at run time
+	other := doRequest(s, http.MethodPost, "/tasks", body, nil)
+	json.NewDecoder(other.Body).Decode(&task)
+	token = claimForTest(t, s, task.ID, "worker-1", nil)
+	os.RemoveAll(checkout)
+	run = `{"holder_id":"worker-1","holder_token":"` + token + `","command":"git","args":["status"]}`
+	if w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", run, nil); w.Code != http.StatusConflict {
+		t.Errorf("run in removed workdir: expected 409, got %d", w.Code)
+	}
+}
+
+func TestClaimProvisionsWorktree(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := &dirConnector{}
+	s.service.connector = conn
+
+	repo := t.TempDir()
+	for _, args := range [][]string{{"init", "-q"}, {"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "--allow-empty", "-m", "init"}} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	worktrees, err := workspace.NewWorktreeManager(workspace.WorktreeConfig{Repo: repo, Dir: filepath.Join(t.TempDir(), "wt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots, _ := workspace.NewRoots(worktrees.Dir())
+	s.service.SetWorkRoots(roots)
+	s.service.SetWorktrees(worktrees)
+
+	task, _ := s.service.CreateTask("Parallel", "", store.TaskOptions{})
+	token := claimForTest(t, s, task.ID, "worker-1", nil)
+
+	wt := worktrees.Lookup(task.ID)
+	got, _ := s.service.GetTask(task.ID)
+	if got.WorkDir != wt.Path {
+		t.Fatalf("Expected workdir %q after claim, got %q", wt.Path, got.WorkDir)
+	}
+
+	run := `{"holder_id":"worker-1","holder_token":"` + token + `","command":"git","args":["status"]}`
+	if w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", run, nil); w.Code != http.StatusOK {
+		t.Fatalf("run: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(conn.dirs) != 1 || conn.dirs[0] != wt.Path {
+		t.Errorf("Expected command to run in the worktree, got %v", conn.dirs)
+	}
+
+	// The run completed the task, so the worktree is cleaned up
+	if _, err := os.Stat(wt.Path); !os.IsNotExist(err) {
+		t.Errorf("Expected worktree removed after completion, stat err = %v", err)
+	}
+}
+
+func TestCompleteOpensPullRequest(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("fake gh is a shell script")
+	}
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	repo, remote := t.TempDir(), t.TempDir()
+	for _, c := range []struct {
+		dir  string
+		args []string
+	}{
+		{remote, []string{"init", "-q", "--bare"}},
+		{repo, []string{"init", "-q"}},
+		{repo, []string{"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "--allow-empty", "-m", "init"}},
+		{repo, []string{"remote", "add", "origin", remote}},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", c.dir}, c.args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", c.args, err, out)
+		}
+	}
+	gh := filepath.Join(t.TempDir(), "gh")
+	os.WriteFile(gh, []byte("#!/bin/sh\necho https://github.com/acme/api/pull/9\n"), 0o755)
+
+	worktrees, err := workspace.NewWorktreeManager(workspace.WorktreeConfig{Repo: repo, Dir: filepath.Join(t.TempDir(), "wt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots, _ := workspace.NewRoots(worktrees.Dir())
+	s.service.SetWorkRoots(roots)
+	s.service.SetWorktrees(worktrees)
+	s.service.SetPullRequests(workspace.PullRequestConfig{GH: gh})
+
+	// A task completed without commits gets no pull request
+	empty, _ := s.service.CreateTask("Nothing to do", "", store.TaskOptions{})
+	claimForTest(t, s, empty.ID, "worker-1", nil)
+	if err := s.service.CompleteTask(empty.ID, "worker-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.service.GetTask(empty.ID); got.PRURL != "" {
+		t.Errorf("Expected no PR without commits, got %q", got.PRURL)
+	}
+
+	task, _ := s.service.CreateTask("Fix login", "Users cannot log in", store.TaskOptions{})
+	claimForTest(t, s, task.ID, "worker-1", nil)
+	wt := worktrees.Lookup(task.ID)
+	if out, err := exec.Command("git", "-C", wt.Path, "-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "--allow-empty", "-m", "fix").CombinedOutput(); err != nil {
+		t.Fatalf("commit: %v: %s", err, out)
+	}
+	if err := s.service.CompleteTask(task.ID, "worker-1"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := s.service.GetTask(task.ID)
+	if got.PRURL != "https://github.com/acme/api/pull/9" {
+		t.Errorf("Expected PR URL recorded on the task, got %q", got.PRURL)
+	}
+}
+
+func TestRunCapturesDiff(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	s.service.connector = &dirConnector{}
+
+	repo := t.TempDir()
+	os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n"), 0o644)
+	for _, args := range [][]string{{"init", "-q"}, {"add", "main.go"}, {"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "-m", "init"}} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	roots, _ := workspace.NewRoots(repo)
+	s.service.SetWorkRoots(roots)
+
+	task, err := s.service.CreateTask("Edit", "", store.TaskOptions{WorkDir: repo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := claimForTest(t, s, task.ID, "worker-1", nil)
+
+	// The agent edits a file during the run
+	os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644)
+	body := `{"holder_id":"worker-1","holder_token":"` + token + `","command":"git","args":["status"]}`
+	w := doRequest(s, http.MethodPost, "/tasks/"+task.ID+"/run", body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("run: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var run models.Run
+	json.NewDecoder(w.Body).Decode(&run)
+	if !run.HasDiff {
+		t.Fatal("Expected run to report a captured diff")
+	}
+
+	w = doRequest(s, http.MethodGet, "/runs/"+run.ID+"/diff", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("diff: expected 200, got %d", w.Code)
+	}
+	if got := w.Body.String(); !strings.Contains(got, "+func main() {}") || !strings.Contains(got, "main.go") {
+		t.Errorf("Unexpected diff:\n%s", got)
+	}
+
+	if w := doRequest(s, http.MethodGet, "/runs/no-such-run/diff", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown run: expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,132 @@
+// Package crash turns recovered panics into crash reports: JSON files
+// holding the panic, its stack, the build it happened in and the audit
+// actions leading up to it, for `neona doctor --report` to share.
+package crash
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// Report is one crash.
+type Report struct {
+	Time      time.Time `json:"time"`
+	Version   string    `json:"version"`
+	OS        string    `json:"os"`
+	Arch      string    `json:"arch"`
+	GoVersion string    `json:"go_version"`
+	// Component is where the panic was recovered, e.g. "GET /tasks" or
+	// "scheduler worker".
+	Component string `json:"component"`
+	Panic     string `json:"panic"`
+	Stack     string `json:"stack"`
+	// RecentActions are the audit records written just before the crash,
+	// oldest first.
+	RecentActions []models.PDREntry `json:"recent_actions,omitempty"`
+}
+
+// Reporter writes crash reports to a directory. A nil *Reporter only logs
+// the panic.
+type Reporter struct {
+	dir     string
+	version string
+	recent  func() []models.PDREntry
+}
+
+// NewReporter returns a Reporter writing to dir. recent, if set, supplies
+// the audit actions included in each report.
+func NewReporter(dir, version string, recent func() []models.PDREntry) *Reporter {
+	return &Reporter{dir: dir, version: version, recent: recent}
+}
+
+// Dir returns the directory reports are written to.
+func (r *Reporter) Dir() string { return r.dir }
+
+// Capture logs a recovered panic with its stack and writes a crash report,
+// returning the report's path ("" if none was written). It is called from
+// the deferred function that recovered rec, with the stack from
+// debug.Stack.
+func (r *Reporter) Capture(component string, rec interface{}, stack []byte) string {
+	log.Printf("panic in %s: %v\n%s", component, rec, stack)
+	if r == nil {
+		return ""
+	}
+	report := &Report{
+		Time:      time.Now().UTC(),
+		Version:   r.version,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		GoVersion: runtime.Version(),
+		Component: component,
+		Panic:     fmt.Sprint(rec),
+		Stack:     string(stack),
+	}
+	if r.recent != nil {
+		report.RecentActions = r.recent()
+	}
+	path, err := r.write(report)
+	if err != nil {
+		log.Printf("Failed to write crash report: %v", err)
+		return ""
+	}
+	log.Printf("Crash report written to %s; run `neona doctor --report` to share it", path)
+	return path
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+func (r *Reporter) write(report *Report) (string, error) {
+	if err := os.MkdirAll(r.dir, 0700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	// Panics in several goroutines at once each get their own file
+	slug := strings.Trim(unsafeChars.ReplaceAllString(strings.ToLower(report.Component), "-"), "-")
+	f, err := os.CreateTemp(r.dir, fmt.Sprintf("crash-%s-%s-*.json", report.Time.Format("20060102T150405.000000000Z"), slug))
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// List returns the paths of the reports in dir, newest first. A missing
+// dir has none.
+func List(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "crash-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	// Names start with the time, so they sort by it
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	return paths, nil
+}
+
+// Load reads the report at path.
+func Load(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &report, nil
+}
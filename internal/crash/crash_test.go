@@ -0,0 +1,42 @@
+package crash
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+func TestCapture(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "crashes")
+	recent := []models.PDREntry{{Action: "task.claim", Outcome: "success"}}
+	r := NewReporter(dir, "1.2.0", func() []models.PDREntry { return recent })
+
+	first := r.Capture("GET /tasks", "boom", []byte("goroutine 1 [running]:"))
+	if first == "" {
+		t.Fatal("Expected a report written")
+	}
+	second := r.Capture("scheduler worker", "again", nil)
+
+	paths, err := List(dir)
+	if err != nil || len(paths) != 2 || paths[0] != second || paths[1] != first {
+		t.Fatalf("List = %v, %v; want newest first", paths, err)
+	}
+	report, err := Load(first)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if report.Version != "1.2.0" || report.Component != "GET /tasks" || report.Panic != "boom" ||
+		!strings.Contains(report.Stack, "goroutine 1") || len(report.RecentActions) != 1 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	var none *Reporter
+	if path := none.Capture("GET /tasks", "boom", nil); path != "" {
+		t.Errorf("Expected a nil reporter to only log, got %s", path)
+	}
+	if paths, err := List(filepath.Join(dir, "missing")); err != nil || len(paths) != 0 {
+		t.Errorf("List of a missing dir = %v, %v", paths, err)
+	}
+}
@@ -0,0 +1,240 @@
+// Package digest writes periodic summaries of control-plane activity into
+// memory: tasks completed and failed, notable runs and decisions recorded in
+// the audit trail. Digests can also be posted to notification channels.
+package digest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+// Tag marks digest memory items.
+const Tag = "digest"
+
+// maxListed caps how many tasks or runs a digest section names.
+const maxListed = 10
+
+// Report summarises activity in the window [Since, Until).
+type Report struct {
+	Since       time.Time
+	Until       time.Time
+	Completed   []models.Task
+	Failed      []models.Task
+	FailedRuns  []models.Run
+	SlowestRuns []models.Run
+	RunCount    int
+	Decisions   []store.PDRCount
+}
+
+// Build collects the report for [since, until) from the store.
+func Build(s *store.Store, since, until time.Time) (*Report, error) {
+	r := &Report{Since: since, Until: until}
+
+	var err error
+	if r.Completed, err = s.ListTasksUpdatedBetween(since, until, models.TaskStatusCompleted); err != nil {
+		return nil, err
+	}
+	if r.Failed, err = s.ListTasksUpdatedBetween(since, until, models.TaskStatusFailed); err != nil {
+		return nil, err
+	}
+	if r.Decisions, err = s.CountPDRBetween(since, until); err != nil {
+		return nil, err
+	}
+
+	runs, err := s.ListRunsBetween(since, until)
+	if err != nil {
+		return nil, err
+	}
+	r.RunCount = len(runs)
+	var finished []models.Run
+	for _, run := range runs {
+		if run.EndedAt.IsZero() {
+			continue
+		}
+		finished = append(finished, run)
+		if run.ExitCode != 0 {
+			r.FailedRuns = append(r.FailedRuns, run)
+		}
+	}
+	sort.SliceStable(finished, func(i, j int) bool {
+		return finished[i].EndedAt.Sub(finished[i].StartedAt) > finished[j].EndedAt.Sub(finished[j].StartedAt)
+	})
+	if len(finished) > 3 {
+		finished = finished[:3]
+	}
+	r.SlowestRuns = finished
+	return r, nil
+}
+
+// Empty reports whether nothing happened in the window.
+func (r *Report) Empty() bool {
+	return len(r.Completed) == 0 && len(r.Failed) == 0 && r.RunCount == 0 && len(r.Decisions) == 0
+}
+
+// Text renders the report as Markdown.
+func (r *Report) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Neona digest %s – %s\n\n", r.Since.Local().Format("2006-01-02 15:04"), r.Until.Local().Format("2006-01-02 15:04"))
+
+	if r.Empty() {
+		b.WriteString("No activity.\n")
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "Tasks: %d completed, %d failed. Runs: %d (%d failed).\n", len(r.Completed), len(r.Failed), r.RunCount, len(r.FailedRuns))
+
+	writeTasks(&b, "Completed", r.Completed)
+	writeTasks(&b, "Failed", r.Failed)
+
+	if len(r.FailedRuns) > 0 || len(r.SlowestRuns) > 0 {
+		b.WriteString("\n## Notable runs\n")
+		for i, run := range r.FailedRuns {
+			if i == maxListed {
+				fmt.Fprintf(&b, "- ... and %d more failed runs\n", len(r.FailedRuns)-maxListed)
+				break
+			}
+			fmt.Fprintf(&b, "- `%s` exited %d (task %s)\n", commandLine(run), run.ExitCode, shortID(run.TaskID))
+		}
+		for _, run := range r.SlowestRuns {
+			fmt.Fprintf(&b, "- `%s` took %s (task %s)\n", commandLine(run), run.EndedAt.Sub(run.StartedAt).Round(time.Second), shortID(run.TaskID))
+		}
+	}
+
+	if len(r.Decisions) > 0 {
+		b.WriteString("\n## Decisions\n")
+		for _, d := range r.Decisions {
+			fmt.Fprintf(&b, "- %s (%s): %d\n", d.Action, d.Outcome, d.Count)
+		}
+	}
+	return b.String()
+}
+
+func writeTasks(b *strings.Builder, heading string, tasks []models.Task) {
+	if len(tasks) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n## %s\n", heading)
+	for i, t := range tasks {
+		if i == maxListed {
+			fmt.Fprintf(b, "- ... and %d more\n", len(tasks)-maxListed)
+			return
+		}
+		fmt.Fprintf(b, "- %s (%s)\n", t.Title, shortID(t.ID))
+	}
+}
+
+func commandLine(run models.Run) string {
+	return strings.TrimSpace(run.Command + " " + strings.Join(run.Args, " "))
+}
+
+func shortID(id string) string {
+	if len(id) <= 8 {
+		return id
+	}
+	return id[:8]
+}
+
+// Notifier delivers a rendered digest to a notification channel.
+type Notifier interface {
+	Notify(ctx context.Context, text string) error
+}
+
+// Job writes a digest every Interval. The time of the last digest is read
+// back from memory, so restarts neither skip nor repeat a window.
+type Job struct {
+	store     *store.Store
+	interval  time.Duration
+	notifiers []Notifier
+
+	// checkEvery is how often the job looks for a due digest.
+	checkEvery time.Duration
+	now        func() time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewJob creates a digest job. A typical interval is 24h.
+func NewJob(s *store.Store, interval time.Duration, notifiers ...Notifier) *Job {
+	return &Job{
+		store:      s,
+		interval:   interval,
+		notifiers:  notifiers,
+		checkEvery: time.Minute,
+		now:        time.Now,
+	}
+}
+
+// Start runs the job in the background until Stop is called.
+func (j *Job) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		ticker := time.NewTicker(j.checkEvery)
+		defer ticker.Stop()
+		for {
+			if _, err := j.RunDue(ctx); err != nil {
+				log.Printf("Digest: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the job and waits for an in-progress digest to finish.
+func (j *Job) Stop() {
+	if j.cancel != nil {
+		j.cancel()
+	}
+	j.wg.Wait()
+}
+
+// RunDue writes a digest if one is due and returns it, or nil if not. The
+// window starts at the previous digest, or one interval ago if there is none.
+func (j *Job) RunDue(ctx context.Context) (*models.MemoryItem, error) {
+	now := j.now().UTC()
+	since := now.Add(-j.interval)
+
+	last, err := j.store.LatestMemoryWithTag(Tag)
+	if err != nil {
+		return nil, err
+	}
+	if last != nil {
+		if now.Sub(last.CreatedAt) < j.interval {
+			return nil, nil
+		}
+		since = last.CreatedAt
+	}
+
+	report, err := Build(j.store, since, now)
+	if err != nil {
+		return nil, fmt.Errorf("build: %w", err)
+	}
+	text := report.Text()
+
+	item, err := j.store.AddMemory("", text, Tag)
+	if err != nil {
+		return nil, fmt.Errorf("store: %w", err)
+	}
+
+	for _, n := range j.notifiers {
+		if err := n.Notify(ctx, text); err != nil {
+			log.Printf("Digest: notification failed: %v", err)
+		}
+	}
+	return item, nil
+}
@@ -0,0 +1,135 @@
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+func newTestStore(t *testing.T) *store.Store {
+	t.Helper()
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+type recordingNotifier struct{ texts []string }
+
+func (r *recordingNotifier) Notify(ctx context.Context, text string) error {
+	r.texts = append(r.texts, text)
+	return nil
+}
+
+func TestBuildReport(t *testing.T) {
+	s := newTestStore(t)
+	start := time.Now().Add(-time.Minute)
+
+	done, _ := s.CreateTask("Ship release", "")
+	s.UpdateTaskStatus(done.ID, models.TaskStatusCompleted)
+	broken, _ := s.CreateTask("Fix flaky test", "")
+	s.UpdateTaskStatus(broken.ID, models.TaskStatusFailed)
+	s.CreateTask("Still pending", "")
+
+	run, _ := s.CreateRun(broken.ID, "go", []string{"test", "./..."})
+	s.UpdateRun(run.ID, 1, "", "FAIL")
+	s.WritePDR("task.claim", "h", "success", done.ID, "")
+	s.WritePDR("task.claim", "h", "success", broken.ID, "")
+
+	r, err := Build(s, start, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if len(r.Completed) != 1 || len(r.Failed) != 1 || len(r.FailedRuns) != 1 {
+		t.Fatalf("Unexpected report: %+v", r)
+	}
+	if len(r.Decisions) != 1 || r.Decisions[0].Count != 2 {
+		t.Errorf("Expected 2 task.claim decisions, got %+v", r.Decisions)
+	}
+
+	text := r.Text()
+	for _, want := range []string{"Ship release", "Fix flaky test", "`go test ./...` exited 1", "task.claim (success): 2"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Digest missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "Still pending") {
+		t.Errorf("Digest should not list pending tasks:\n%s", text)
+	}
+
+	empty, _ := Build(s, start.Add(-48*time.Hour), start.Add(-24*time.Hour))
+	if !empty.Empty() || !strings.Contains(empty.Text(), "No activity") {
+		t.Errorf("Expected empty report, got:\n%s", empty.Text())
+	}
+}
+
+func TestJobRunsOncePerInterval(t *testing.T) {
+	s := newTestStore(t)
+	task, _ := s.CreateTask("Done", "")
+	s.UpdateTaskStatus(task.ID, models.TaskStatusCompleted)
+
+	notifier := &recordingNotifier{}
+	job := NewJob(s, 24*time.Hour, notifier)
+	base := time.Now()
+	job.now = func() time.Time { return base }
+
+	item, err := job.RunDue(context.Background())
+	if err != nil || item == nil {
+		t.Fatalf("Expected first digest to be written, got %v (err=%v)", item, err)
+	}
+	if item.Tags != Tag || !strings.Contains(item.Content, "Done") {
+		t.Errorf("Unexpected digest item: %+v", item)
+	}
+	if len(notifier.texts) != 1 {
+		t.Errorf("Expected one notification, got %d", len(notifier.texts))
+	}
+
+	// The previous digest is read back from memory, as after a restart
+	job = NewJob(s, 24*time.Hour, notifier)
+	job.now = func() time.Time { return base.Add(time.Hour) }
+	if item, _ := job.RunDue(context.Background()); item != nil {
+		t.Error("Expected no digest before the interval elapsed")
+	}
+
+	job.now = func() time.Time { return base.Add(25 * time.Hour) }
+	item, err = job.RunDue(context.Background())
+	if err != nil || item == nil {
+		t.Fatalf("Expected digest after the interval, got %v (err=%v)", item, err)
+	}
+	if strings.Contains(item.Content, "Done") {
+		t.Errorf("Second digest should only cover activity since the first:\n%s", item.Content)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var payload map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer srv.Close()
+
+	if err := NewWebhookNotifier(srv.URL).Notify(context.Background(), "hello"); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if payload["text"] != "hello" || payload["content"] != "hello" {
+		t.Errorf("Unexpected payload: %v", payload)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusForbidden)
+	}))
+	defer failing.Close()
+	if err := NewWebhookNotifier(failing.URL).Notify(context.Background(), "hello"); err == nil {
+		t.Error("Expected error for non-2xx response")
+	}
+}
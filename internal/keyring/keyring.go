@@ -0,0 +1,92 @@
+// Package keyring stores small secrets in the operating system keychain.
+//
+// It shells out to the platform tool rather than linking a native library:
+// `security` on macOS and `secret-tool` (libsecret) on Linux. Other platforms
+// return ErrUnsupported.
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when no secret is stored for the service/account.
+	ErrNotFound = errors.New("secret not found in keychain")
+	// ErrUnsupported is returned when no keychain tool is available.
+	ErrUnsupported = errors.New("OS keychain not supported on this platform")
+)
+
+// Get returns the secret stored for service and account.
+func Get(service, account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	default:
+		return "", ErrUnsupported
+	}
+
+	out, err := run(cmd, nil)
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", ErrUnsupported
+		}
+		// Both tools exit non-zero when nothing matches
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	secret := strings.TrimRight(out, "\r\n")
+	if secret == "" {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+// Set stores (or replaces) the secret for service and account.
+func Set(service, account, secret string) error {
+	var cmd *exec.Cmd
+	var stdin []byte
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "add-generic-password", "-U", "-s", service, "-a", account, "-w", secret)
+	case "linux":
+		cmd = exec.Command("secret-tool", "store", "--label", service+" "+account, "service", service, "account", account)
+		stdin = []byte(secret)
+	default:
+		return ErrUnsupported
+	}
+
+	if _, err := run(cmd, stdin); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return ErrUnsupported
+		}
+		return err
+	}
+	return nil
+}
+
+func run(cmd *exec.Cmd, stdin []byte) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %w: %s", cmd.Path, err, msg)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,164 @@
+// Package leader elects one daemon among several sharing a database to run
+// background jobs (the scheduler and digest). Election is a lease row in the
+// database: the leader renews it every third of the TTL, and when it stops
+// doing so a follower takes over once the lease expires.
+package leader
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fentz26/neona/internal/store"
+)
+
+// Name is the leader lease daemons compete for.
+const Name = "daemon"
+
+// DefaultTTL is how long a leader lease lasts without renewal, and so
+// roughly how long a failed leader goes unreplaced.
+const DefaultTTL = 15 * time.Second
+
+// Store persists the leader lease. store.Store and store.Memory implement it.
+type Store interface {
+	AcquireLeadership(name, holderID, addr string, ttl time.Duration) (bool, error)
+	ReleaseLeadership(name, holderID string) error
+	GetLeader(name string) (*store.Leadership, error)
+}
+
+// Elector campaigns for leadership on behalf of one daemon.
+type Elector struct {
+	store Store
+	id    string
+	addr  string
+	ttl   time.Duration
+
+	onElected func()
+	onDemoted func()
+
+	leader     atomic.Bool
+	leaderAddr atomic.Value // string
+	lastRenew  time.Time    // owned by the loop goroutine
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates an elector for the daemon id, which advertises its API at
+// addr so followers can send writes there.
+func New(s Store, id, addr string, ttl time.Duration) *Elector {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	e := &Elector{store: s, id: id, addr: addr, ttl: ttl}
+	e.leaderAddr.Store("")
+	return e
+}
+
+// OnChange sets callbacks run when this daemon becomes leader and when it
+// stops being leader. They run on the election goroutine, so leadership
+// does not change again until they return.
+// Must be called before Start() - not safe for concurrent use.
+func (e *Elector) OnChange(elected, demoted func()) {
+	e.onElected, e.onDemoted = elected, demoted
+}
+
+// ID returns the daemon's election identity.
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// IsLeader reports whether this daemon currently holds the lease.
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// LeaderAddr returns the API address of the current leader, or "" when no
+// leader is known.
+func (e *Elector) LeaderAddr() string {
+	return e.leaderAddr.Load().(string)
+}
+
+// Start campaigns in the background until Stop is called. The first attempt
+// is made before Start returns, so a daemon that finds no leader is elected
+// right away.
+func (e *Elector) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.campaign()
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				e.campaign()
+			}
+		}
+	}()
+}
+
+// Stop stops campaigning. A leader steps down and releases the lease so a
+// follower can take over without waiting for it to expire.
+func (e *Elector) Stop() {
+	if e.cancel != nil {
+		e.cancel()
+	}
+	e.wg.Wait()
+	if e.leader.Load() {
+		e.demote("shutting down")
+		if err := e.store.ReleaseLeadership(Name, e.id); err != nil {
+			log.Printf("Leader: release failed: %v", err)
+		}
+	}
+}
+
+// campaign renews or tries to take the lease once.
+func (e *Elector) campaign() {
+	now := time.Now()
+	ok, err := e.store.AcquireLeadership(Name, e.id, e.addr, e.ttl)
+	switch {
+	case err != nil:
+		log.Printf("Leader: %v", err)
+		// A leader that cannot renew must step down before its lease can
+		// expire and another daemon is elected alongside it.
+		if e.leader.Load() && now.Sub(e.lastRenew) >= e.ttl/2 {
+			e.demote("lease renewal failing")
+		}
+	case ok:
+		e.lastRenew = now
+		e.leaderAddr.Store(e.addr)
+		if !e.leader.Load() {
+			e.leader.Store(true)
+			log.Printf("Leader: %s elected", e.id)
+			if e.onElected != nil {
+				e.onElected()
+			}
+		}
+	default:
+		if e.leader.Load() {
+			e.demote("lease taken over")
+		}
+		addr := ""
+		if l, err := e.store.GetLeader(Name); err == nil && l != nil {
+			addr = l.Addr
+		}
+		e.leaderAddr.Store(addr)
+	}
+}
+
+func (e *Elector) demote(reason string) {
+	e.leader.Store(false)
+	e.leaderAddr.Store("")
+	log.Printf("Leader: %s stepping down (%s)", e.id, reason)
+	if e.onDemoted != nil {
+		e.onDemoted()
+	}
+}
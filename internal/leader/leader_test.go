@@ -0,0 +1,88 @@
+package leader
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/store"
+)
+
+// flakyStore fails lease operations while down is set.
+type flakyStore struct {
+	*store.Memory
+	down atomic.Bool
+}
+
+func (f *flakyStore) AcquireLeadership(name, holderID, addr string, ttl time.Duration) (bool, error) {
+	if f.down.Load() {
+		return false, errors.New("database unavailable")
+	}
+	return f.Memory.AcquireLeadership(name, holderID, addr, ttl)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestElectionAndFailover(t *testing.T) {
+	s := store.NewMemory()
+	const ttl = 60 * time.Millisecond
+
+	var elected, demoted atomic.Int32
+	a := New(s, "a", "http://a", ttl)
+	a.OnChange(func() { elected.Add(1) }, func() { demoted.Add(1) })
+	a.Start()
+	if !a.IsLeader() || elected.Load() != 1 {
+		t.Fatal("Expected the first daemon to be elected on Start")
+	}
+
+	b := New(s, "b", "http://b", ttl)
+	b.Start()
+	defer b.Stop()
+	if b.IsLeader() {
+		t.Fatal("Expected the second daemon to follow")
+	}
+	if b.LeaderAddr() != "http://a" {
+		t.Errorf("LeaderAddr = %q, want http://a", b.LeaderAddr())
+	}
+
+	// Stopping the leader hands over without waiting for the lease to expire
+	a.Stop()
+	if a.IsLeader() || demoted.Load() != 1 {
+		t.Error("Expected the stopped leader to step down")
+	}
+	waitFor(t, "b to take over", b.IsLeader)
+	if b.LeaderAddr() != "http://b" {
+		t.Errorf("LeaderAddr = %q, want http://b", b.LeaderAddr())
+	}
+}
+
+func TestLeaderStepsDownWhenRenewalFails(t *testing.T) {
+	s := &flakyStore{Memory: store.NewMemory()}
+	const ttl = 60 * time.Millisecond
+
+	a := New(s, "a", "", ttl)
+	a.Start()
+	defer a.Stop()
+	if !a.IsLeader() {
+		t.Fatal("Expected a to be elected")
+	}
+
+	s.down.Store(true)
+	waitFor(t, "a to step down", func() bool { return !a.IsLeader() })
+	if l, _ := s.GetLeader(Name); l != nil && time.Until(l.ExpiresAt) > ttl/2 {
+		t.Errorf("Expected a to step down before its lease expired, %s left", time.Until(l.ExpiresAt))
+	}
+
+	s.down.Store(false)
+	waitFor(t, "a to be re-elected", a.IsLeader)
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/fentz26/neona/internal/paths"
 	"gopkg.in/yaml.v3"
 )
 
@@ -12,7 +14,8 @@ import (
 type Config struct {
 	// Enabled toggles the MCP router on/off.
 	Enabled bool `yaml:"enabled"`
-	// Strategy determines routing approach: auto, keywords, manual.
+	// Strategy selects the registered router: auto, keywords, manual, or a
+	// strategy added with RegisterRouter.
 	Strategy string `yaml:"strategy"`
 	// MaxToolsPerTask is the tool budget per task.
 	MaxToolsPerTask int `yaml:"max_tools_per_task"`
@@ -26,6 +29,23 @@ type Config struct {
 	AlwaysOff []string `yaml:"always_off"`
 	// Rules define keyword-based routing rules.
 	Rules []RoutingRule `yaml:"rules"`
+	// LLM configures the "llm" strategy.
+	LLM LLMConfig `yaml:"llm,omitempty"`
+}
+
+// LLMConfig configures LLM-assisted routing against an OpenAI-compatible
+// chat completions endpoint.
+type LLMConfig struct {
+	// Endpoint is the chat completions URL, e.g. http://localhost:11434/v1/chat/completions.
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// Model is sent as the request's model name.
+	Model string `yaml:"model,omitempty"`
+	// APIKeyEnv names the environment variable holding the bearer key, if any.
+	APIKeyEnv string `yaml:"api_key_env,omitempty"`
+	// TimeoutMs bounds each request before falling back to keywords (default 3000).
+	TimeoutMs int `yaml:"timeout_ms,omitempty"`
+	// CacheSize is how many routing decisions are remembered (default 256).
+	CacheSize int `yaml:"cache_size,omitempty"`
 }
 
 // RoutingRule defines a keyword-based routing rule.
@@ -104,15 +124,10 @@ func LoadConfig(path string) (*Config, error) {
 	return cfg, nil
 }
 
-// LoadConfigFromHome loads configuration from ~/.neona/mcp.yaml.
+// LoadConfigFromHome loads configuration from the user config directory
+// (see paths.MCPConfigPath).
 func LoadConfigFromHome() (*Config, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return DefaultConfig(), nil
-	}
-
-	path := filepath.Join(home, ".neona", "mcp.yaml")
-	return LoadConfig(path)
+	return LoadConfig(paths.MCPConfigPath())
 }
 
 // SaveConfig saves configuration to a YAML file, creating parent directories if needed.
@@ -139,14 +154,9 @@ func SaveConfig(path string, cfg *Config) error {
 	return nil
 }
 
-// SaveConfigToHome saves configuration to ~/.neona/mcp.yaml.
+// SaveConfigToHome saves configuration to the user config directory.
 func SaveConfigToHome(cfg *Config) error {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("getting home dir: %w", err)
-	}
-	path := filepath.Join(home, ".neona", "mcp.yaml")
-	return SaveConfig(path, cfg)
+	return SaveConfig(filepath.Join(paths.ConfigDir(), paths.MCPConfigFile), cfg)
 }
 
 // Validate checks that the configuration is valid.
@@ -155,13 +165,8 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("max_tools_per_task must be at least 1")
 	}
 
-	validStrategies := map[string]bool{
-		"auto":     true,
-		"keywords": true,
-		"manual":   true,
-	}
-	if !validStrategies[c.Strategy] {
-		return fmt.Errorf("invalid strategy %q, must be: auto, keywords, or manual", c.Strategy)
+	if !isRegisteredStrategy(c.Strategy) {
+		return fmt.Errorf("invalid strategy %q, must be one of: %s", c.Strategy, strings.Join(RouterStrategies(), ", "))
 	}
 
 	return nil
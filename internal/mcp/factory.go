@@ -0,0 +1,87 @@
+package mcp
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// RouterFactory builds a Router for a configuration and registry.
+type RouterFactory func(cfg *Config, reg *Registry) (Router, error)
+
+var (
+	routerFactoriesMu sync.RWMutex
+	routerFactories   = map[string]RouterFactory{}
+)
+
+func init() {
+	keywords := func(cfg *Config, reg *Registry) (Router, error) {
+		return NewRouter(cfg, reg), nil
+	}
+	// "auto" and "manual" currently share the keyword router; manual
+	// selection is applied through Router.Override.
+	RegisterRouter("keywords", keywords)
+	RegisterRouter("auto", keywords)
+	RegisterRouter("manual", keywords)
+}
+
+// RegisterRouter makes a routing strategy selectable through the strategy
+// key in mcp.yaml. Third-party strategies call it from an init function in
+// a package linked into the binary, e.g. from a build-tagged file in
+// cmd/neona. It panics if the name is empty or already registered.
+func RegisterRouter(strategy string, factory RouterFactory) {
+	routerFactoriesMu.Lock()
+	defer routerFactoriesMu.Unlock()
+
+	if strategy == "" || factory == nil {
+		panic("mcp: RegisterRouter called with empty strategy or nil factory")
+	}
+	if _, dup := routerFactories[strategy]; dup {
+		panic("mcp: RegisterRouter called twice for strategy " + strategy)
+	}
+	routerFactories[strategy] = factory
+}
+
+// RouterStrategies returns the registered strategy names, sorted.
+func RouterStrategies() []string {
+	routerFactoriesMu.RLock()
+	defer routerFactoriesMu.RUnlock()
+
+	names := make([]string, 0, len(routerFactories))
+	for name := range routerFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewRouterFromConfig builds the router registered for cfg.Strategy.
+func NewRouterFromConfig(cfg *Config, reg *Registry) (Router, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if reg == nil {
+		reg = NewRegistry()
+		reg.RegisterDefaults()
+	}
+
+	routerFactoriesMu.RLock()
+	factory, ok := routerFactories[cfg.Strategy]
+	routerFactoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown routing strategy %q (registered: %v)", cfg.Strategy, RouterStrategies())
+	}
+
+	router, err := factory(cfg, reg)
+	if err != nil {
+		return nil, fmt.Errorf("build %s router: %w", cfg.Strategy, err)
+	}
+	return router, nil
+}
+
+func isRegisteredStrategy(strategy string) bool {
+	routerFactoriesMu.RLock()
+	defer routerFactoriesMu.RUnlock()
+	_, ok := routerFactories[strategy]
+	return ok
+}
@@ -0,0 +1,70 @@
+package mcp
+
+import (
+	"context"
+	"testing"
+)
+
+// fixedRouter always selects the same servers.
+type fixedRouter struct {
+	*KeywordRouter
+	names []string
+}
+
+func (f *fixedRouter) Route(ctx context.Context, task Task) (*RoutingResult, error) {
+	return f.KeywordRouter.Override(f.names).Route(ctx, task)
+}
+
+func TestRegisterRouterStrategy(t *testing.T) {
+	RegisterRouter("test-fixed", func(cfg *Config, reg *Registry) (Router, error) {
+		return &fixedRouter{KeywordRouter: NewRouter(cfg, reg), names: []string{"git"}}, nil
+	})
+
+	cfg := DefaultConfig()
+	cfg.Strategy = "test-fixed"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected registered strategy to validate, got %v", err)
+	}
+
+	router, err := NewRouterFromConfig(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewRouterFromConfig failed: %v", err)
+	}
+	if _, ok := router.(*fixedRouter); !ok {
+		t.Fatalf("Expected fixedRouter, got %T", router)
+	}
+	result, err := router.Route(context.Background(), Task{Title: "deploy to kubernetes"})
+	if err != nil {
+		t.Fatalf("Route failed: %v", err)
+	}
+	if len(result.SelectedMCPs) != 1 || result.SelectedMCPs[0].Name != "git" {
+		t.Errorf("Expected only git, got %+v", result.SelectedMCPs)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected duplicate registration to panic")
+		}
+	}()
+	RegisterRouter("test-fixed", func(cfg *Config, reg *Registry) (Router, error) { return nil, nil })
+}
+
+func TestBuiltinStrategiesUseKeywordRouter(t *testing.T) {
+	for _, strategy := range []string{"auto", "keywords", "manual"} {
+		cfg := DefaultConfig()
+		cfg.Strategy = strategy
+		router, err := NewRouterFromConfig(cfg, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", strategy, err)
+		}
+		if _, ok := router.(*KeywordRouter); !ok {
+			t.Errorf("%s: expected *KeywordRouter, got %T", strategy, router)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.Strategy = "nonexistent"
+	if _, err := NewRouterFromConfig(cfg, nil); err == nil {
+		t.Error("Expected error for unregistered strategy")
+	}
+}
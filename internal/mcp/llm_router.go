@@ -0,0 +1,274 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLLMTimeout   = 3 * time.Second
+	defaultLLMCacheSize = 256
+)
+
+func init() {
+	RegisterRouter("llm", func(cfg *Config, reg *Registry) (Router, error) {
+		return NewLLMRouter(cfg, reg)
+	})
+}
+
+// llmSystemPrompt instructs the model to answer with server names only.
+const llmSystemPrompt = `You select which MCP tool servers an AI agent needs for a task.
+Reply with only a JSON array of server names chosen from the list, e.g. ["git","github"].
+Pick the fewest servers that cover the task. Reply [] if none are needed.`
+
+// LLMRouter asks an LLM to pick MCP servers for a task from the registry's
+// metadata. Decisions are cached by a hash of their inputs. On timeout,
+// error or an unusable answer it falls back to keyword routing and says so
+// in RoutingResult.FallbackReason.
+type LLMRouter struct {
+	fallback *KeywordRouter
+	llm      LLMConfig
+	client   *http.Client
+
+	mu    sync.Mutex
+	cache map[string][]string
+	order []string // insertion order for eviction
+}
+
+// NewLLMRouter creates an LLM-assisted router from cfg.LLM.
+func NewLLMRouter(cfg *Config, reg *Registry) (*LLMRouter, error) {
+	fallback := NewRouter(cfg, reg)
+	llm := fallback.config.LLM
+	if llm.Endpoint == "" || llm.Model == "" {
+		return nil, fmt.Errorf("llm strategy requires llm.endpoint and llm.model")
+	}
+	timeout := defaultLLMTimeout
+	if llm.TimeoutMs > 0 {
+		timeout = time.Duration(llm.TimeoutMs) * time.Millisecond
+	}
+	if llm.CacheSize <= 0 {
+		llm.CacheSize = defaultLLMCacheSize
+	}
+
+	return &LLMRouter{
+		fallback: fallback,
+		llm:      llm,
+		client:   &http.Client{Timeout: timeout},
+		cache:    make(map[string][]string),
+	}, nil
+}
+
+// Route selects MCPs for a task using the LLM, or keywords on failure.
+func (r *LLMRouter) Route(ctx context.Context, task Task) (*RoutingResult, error) {
+	cfg := r.fallback.config
+	if !cfg.Enabled {
+		return r.fallback.Route(ctx, task)
+	}
+
+	candidates := make([]MCPServer, 0)
+	for _, mcp := range r.fallback.registry.GetEnabled() {
+		if !cfg.IsAlwaysOff(mcp.Name) {
+			candidates = append(candidates, mcp)
+		}
+	}
+
+	key := r.inputsHash(task, candidates)
+	names, cached := r.cached(key)
+	if !cached {
+		var err error
+		names, err = r.ask(ctx, task, candidates)
+		if err != nil {
+			log.Printf("MCP llm routing failed for task %s, using keywords: %v", task.ID, err)
+			result, ferr := r.fallback.Route(ctx, task)
+			if ferr != nil {
+				return nil, ferr
+			}
+			result.FallbackReason = err.Error()
+			return result, nil
+		}
+		r.store(key, names)
+	}
+
+	matched := make(map[string]bool)
+	for _, name := range cfg.AlwaysOn {
+		if !cfg.IsAlwaysOff(name) {
+			matched[name] = true
+		}
+	}
+	for _, name := range names {
+		matched[name] = true
+	}
+
+	selected, totalTools, filteredTools := r.fallback.applyToolBudget(r.fallback.buildMCPList(matched))
+	return &RoutingResult{
+		Task:          task,
+		SelectedMCPs:  selected,
+		MatchedRules:  []string{"llm"},
+		TotalTools:    totalTools,
+		FilteredTools: filteredTools,
+		Strategy:      "llm",
+		Cached:        cached,
+	}, nil
+}
+
+// GetToolManifest returns the filtered tool list from selected MCPs.
+func (r *LLMRouter) GetToolManifest(mcps []MCPServer) []Tool {
+	return r.fallback.GetToolManifest(mcps)
+}
+
+// Override returns a router that uses the given MCPs without asking the LLM.
+func (r *LLMRouter) Override(mcps []string) Router {
+	return r.fallback.Override(mcps)
+}
+
+// inputsHash identifies a routing decision by everything the LLM sees.
+func (r *LLMRouter) inputsHash(task Task, candidates []MCPServer) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00", r.llm.Model, task.Title, task.Description)
+	for _, c := range candidates {
+		fmt.Fprintf(h, "%s\x00", c.Name)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (r *LLMRouter) cached(key string) ([]string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names, ok := r.cache[key]
+	return names, ok
+}
+
+func (r *LLMRouter) store(key string, names []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.cache[key]; ok {
+		return
+	}
+	if len(r.order) >= r.llm.CacheSize {
+		delete(r.cache, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.cache[key] = names
+	r.order = append(r.order, key)
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature float64       `json:"temperature"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// ask sends the task and candidate servers to the LLM and returns the
+// chosen server names that exist among the candidates.
+func (r *LLMRouter) ask(ctx context.Context, task Task, candidates []MCPServer) ([]string, error) {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Task: %s\n", task.Title)
+	if task.Description != "" {
+		fmt.Fprintf(&prompt, "Details: %s\n", task.Description)
+	}
+	prompt.WriteString("\nAvailable servers:\n")
+	for _, c := range candidates {
+		fmt.Fprintf(&prompt, "- %s (%d tools; %s)\n", c.Name, c.ToolCount, strings.Join(c.Categories, ", "))
+	}
+
+	body, err := json.Marshal(chatRequest{
+		Model: r.llm.Model,
+		Messages: []chatMessage{
+			{Role: "system", Content: llmSystemPrompt},
+			{Role: "user", Content: prompt.String()},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.llm.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.llm.APIKeyEnv != "" {
+		if key := os.Getenv(r.llm.APIKeyEnv); key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("llm request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("llm returned %d: %s", resp.StatusCode, msg)
+	}
+
+	var chat chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chat); err != nil {
+		return nil, fmt.Errorf("decode llm response: %w", err)
+	}
+	if len(chat.Choices) == 0 {
+		return nil, fmt.Errorf("llm response has no choices")
+	}
+	return parseServerList(chat.Choices[0].Message.Content, candidates)
+}
+
+// parseServerList extracts the JSON array from the model's reply, tolerating
+// surrounding prose or code fences, and keeps only known candidates.
+func parseServerList(content string, candidates []MCPServer) ([]string, error) {
+	start, end := strings.Index(content, "["), strings.LastIndex(content, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("llm reply is not a JSON array: %q", truncateReply(content))
+	}
+	var names []string
+	if err := json.Unmarshal([]byte(content[start:end+1]), &names); err != nil {
+		return nil, fmt.Errorf("llm reply is not a JSON array of names: %q", truncateReply(content))
+	}
+
+	known := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		known[c.Name] = true
+	}
+	valid := make([]string, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if known[name] && !seen[name] {
+			seen[name] = true
+			valid = append(valid, name)
+		}
+	}
+	if len(names) > 0 && len(valid) == 0 {
+		return nil, fmt.Errorf("llm chose no known servers: %v", names)
+	}
+	return valid, nil
+}
+
+func truncateReply(s string) string {
+	if len(s) > 120 {
+		return s[:120] + "..."
+	}
+	return s
+}
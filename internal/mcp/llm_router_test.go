@@ -0,0 +1,122 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func llmServer(t *testing.T, reply string, delay time.Duration, calls *int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model != "test-model" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer sk-test" {
+			http.Error(w, "unauthorized "+auth, http.StatusUnauthorized)
+			return
+		}
+		time.Sleep(delay)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"role": "assistant", "content": reply}}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func llmConfig(endpoint string, timeoutMs int) *Config {
+	cfg := DefaultConfig()
+	cfg.Strategy = "llm"
+	cfg.LLM = LLMConfig{Endpoint: endpoint, Model: "test-model", APIKeyEnv: "NEONA_TEST_LLM_KEY", TimeoutMs: timeoutMs}
+	return cfg
+}
+
+func selectedNames(result *RoutingResult) []string {
+	names := make([]string, len(result.SelectedMCPs))
+	for i, m := range result.SelectedMCPs {
+		names[i] = m.Name
+	}
+	return names
+}
+
+func TestLLMRouterSelectsAndCaches(t *testing.T) {
+	t.Setenv("NEONA_TEST_LLM_KEY", "sk-test")
+	var calls int32
+	srv := llmServer(t, "Sure:\n```json\n[\"github\", \"not-a-server\"]\n```", 0, &calls)
+
+	router, err := NewRouterFromConfig(llmConfig(srv.URL, 1000), nil)
+	if err != nil {
+		t.Fatalf("NewRouterFromConfig failed: %v", err)
+	}
+	task := Task{ID: "t1", Title: "Triage open issues"}
+
+	result, err := router.Route(context.Background(), task)
+	if err != nil {
+		t.Fatalf("Route failed: %v", err)
+	}
+	names := strings.Join(selectedNames(result), ",")
+	if result.Strategy != "llm" || result.Cached || !strings.Contains(names, "github") || !strings.Contains(names, "filesystem") {
+		t.Errorf("Expected llm selection of github plus always-on filesystem, got %s %+v", names, result)
+	}
+	if strings.Contains(names, "not-a-server") {
+		t.Errorf("Unknown server should be dropped, got %s", names)
+	}
+
+	result, _ = router.Route(context.Background(), task)
+	if !result.Cached || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("Expected cached decision without a second call, cached=%v calls=%d", result.Cached, calls)
+	}
+
+	router.Route(context.Background(), Task{ID: "t2", Title: "Something else"})
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("Expected different inputs to query the LLM again, calls=%d", calls)
+	}
+}
+
+func TestLLMRouterFallsBackToKeywords(t *testing.T) {
+	t.Setenv("NEONA_TEST_LLM_KEY", "sk-test")
+	var calls int32
+	task := Task{ID: "t1", Title: "Deploy to vercel production"}
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+
+	cases := map[string]*httptest.Server{
+		"timeout":    llmServer(t, `["github"]`, 300*time.Millisecond, &calls),
+		"not a list": llmServer(t, "You should use github.", 0, &calls),
+		"only bogus": llmServer(t, `["nope"]`, 0, &calls),
+		"http error": notFound,
+	}
+	for name, srv := range cases {
+		router, err := NewLLMRouter(llmConfig(srv.URL, 100), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		result, err := router.Route(context.Background(), task)
+		if err != nil {
+			t.Fatalf("%s: Route failed: %v", name, err)
+		}
+		if result.Strategy != "keywords" || result.FallbackReason == "" {
+			t.Errorf("%s: expected keyword fallback with reason, got %+v", name, result)
+		}
+		if !strings.Contains(strings.Join(selectedNames(result), ","), "vercel") {
+			t.Errorf("%s: expected keyword rules to select vercel, got %v", name, selectedNames(result))
+		}
+	}
+}
+
+func TestLLMRouterRequiresEndpoint(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Strategy = "llm"
+	if _, err := NewRouterFromConfig(cfg, nil); err == nil {
+		t.Error("Expected error without llm.endpoint and llm.model")
+	}
+}
@@ -0,0 +1,186 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultRouteCacheTTL is how long a routing decision is reused.
+	DefaultRouteCacheTTL = 10 * time.Minute
+	// maxRouteCacheEntries bounds the route cache; the oldest entry is evicted.
+	maxRouteCacheEntries = 1024
+)
+
+// RouteCacheStats reports route cache effectiveness.
+type RouteCacheStats struct {
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	Invalidations uint64 `json:"invalidations"`
+	Entries       int    `json:"entries"`
+	ConfigVersion string `json:"config_version"`
+}
+
+type cachedRoute struct {
+	result  *RoutingResult
+	expires time.Time
+}
+
+// CachingRouter memoizes another router's decisions, keyed by a hash of the
+// task title, description and config version, so identical tasks are not
+// routed again on every dispatch. Results that fell back to keywords are not
+// cached, so a transient failure is retried on the next dispatch.
+type CachingRouter struct {
+	mu      sync.RWMutex
+	router  Router
+	version string
+	ttl     time.Duration
+	entries map[string]cachedRoute
+	order   []string // insertion order for eviction
+
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	evictions     atomic.Uint64
+	invalidations atomic.Uint64
+
+	now func() time.Time
+}
+
+// NewCachingRouter wraps router. A ttl of zero uses DefaultRouteCacheTTL.
+func NewCachingRouter(router Router, cfg *Config, ttl time.Duration) *CachingRouter {
+	if ttl <= 0 {
+		ttl = DefaultRouteCacheTTL
+	}
+	return &CachingRouter{
+		router:  router,
+		version: ConfigVersion(cfg),
+		ttl:     ttl,
+		entries: make(map[string]cachedRoute),
+		now:     time.Now,
+	}
+}
+
+// ConfigVersion returns a short hash identifying a configuration.
+func ConfigVersion(cfg *Config) string {
+	if cfg == nil {
+		return ""
+	}
+	data, _ := yaml.Marshal(cfg)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// Route returns a cached decision for identical task content, or routes
+// the task and caches the result.
+func (c *CachingRouter) Route(ctx context.Context, task Task) (*RoutingResult, error) {
+	c.mu.RLock()
+	router, version := c.router, c.version
+	entry, ok := c.entries[routeKey(version, task)]
+	c.mu.RUnlock()
+
+	if ok && c.now().Before(entry.expires) {
+		c.hits.Add(1)
+		result := *entry.result
+		result.Task = task
+		result.Cached = true
+		result.SelectedMCPs = append([]MCPServer(nil), entry.result.SelectedMCPs...)
+		return &result, nil
+	}
+	c.misses.Add(1)
+
+	result, err := router.Route(ctx, task)
+	if err != nil || result.FallbackReason != "" {
+		return result, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Skip storing if the config was reloaded while routing
+	if c.version == version {
+		c.put(routeKey(version, task), result)
+	}
+	return result, nil
+}
+
+// put stores a result. Callers must hold c.mu.
+func (c *CachingRouter) put(key string, result *RoutingResult) {
+	if _, exists := c.entries[key]; !exists {
+		for len(c.order) >= maxRouteCacheEntries {
+			delete(c.entries, c.order[0])
+			c.order = c.order[1:]
+			c.evictions.Add(1)
+		}
+		c.order = append(c.order, key)
+	}
+	stored := *result
+	stored.SelectedMCPs = append([]MCPServer(nil), result.SelectedMCPs...)
+	c.entries[key] = cachedRoute{result: &stored, expires: c.now().Add(c.ttl)}
+}
+
+// GetToolManifest returns the filtered tool list from selected MCPs.
+func (c *CachingRouter) GetToolManifest(mcps []MCPServer) []Tool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.router.GetToolManifest(mcps)
+}
+
+// Override returns an uncached router with manual MCP overrides.
+func (c *CachingRouter) Override(mcps []string) Router {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.router.Override(mcps)
+}
+
+// Reload swaps in a router built from a reloaded configuration and drops
+// every cached decision.
+func (c *CachingRouter) Reload(router Router, cfg *Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.router = router
+	c.version = ConfigVersion(cfg)
+	c.clear()
+}
+
+// Invalidate drops every cached decision.
+func (c *CachingRouter) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clear()
+}
+
+func (c *CachingRouter) clear() {
+	c.entries = make(map[string]cachedRoute)
+	c.order = nil
+	c.invalidations.Add(1)
+}
+
+// Stats returns cache counters.
+func (c *CachingRouter) Stats() RouteCacheStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return RouteCacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Evictions:     c.evictions.Load(),
+		Invalidations: c.invalidations.Load(),
+		Entries:       len(c.entries),
+		ConfigVersion: c.version,
+	}
+}
+
+func routeKey(version string, task Task) string {
+	h := sha256.New()
+	h.Write([]byte(version))
+	h.Write([]byte{0})
+	h.Write([]byte(task.Title))
+	h.Write([]byte{0})
+	h.Write([]byte(task.Description))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,93 @@
+package mcp
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// countingRouter counts Route calls on top of the keyword router.
+type countingRouter struct {
+	*KeywordRouter
+	calls    int
+	fallback string
+}
+
+func (c *countingRouter) Route(ctx context.Context, task Task) (*RoutingResult, error) {
+	c.calls++
+	result, err := c.KeywordRouter.Route(ctx, task)
+	if err == nil {
+		result.FallbackReason = c.fallback
+	}
+	return result, err
+}
+
+func TestCachingRouterReusesDecisions(t *testing.T) {
+	cfg := DefaultConfig()
+	inner := &countingRouter{KeywordRouter: NewRouter(cfg, nil)}
+	cache := NewCachingRouter(inner, cfg, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	first, _ := cache.Route(ctx, Task{ID: "a", Title: "Open a pull request"})
+	second, _ := cache.Route(ctx, Task{ID: "b", Title: "Open a pull request"})
+	if inner.calls != 1 {
+		t.Fatalf("Expected identical content to route once, got %d calls", inner.calls)
+	}
+	if first.Cached || !second.Cached || second.Task.ID != "b" || len(second.SelectedMCPs) != len(first.SelectedMCPs) {
+		t.Errorf("Unexpected cached result: first=%+v second=%+v", first, second)
+	}
+
+	cache.Route(ctx, Task{ID: "c", Title: "Open a pull request", Description: "different"})
+	if inner.calls != 2 {
+		t.Errorf("Expected different description to miss, got %d calls", inner.calls)
+	}
+
+	now = now.Add(2 * time.Minute)
+	cache.Route(ctx, Task{ID: "d", Title: "Open a pull request"})
+	if inner.calls != 3 {
+		t.Errorf("Expected expired entry to be routed again, got %d calls", inner.calls)
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Misses != 3 || stats.Entries != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestCachingRouterReloadInvalidates(t *testing.T) {
+	cfg := DefaultConfig()
+	inner := &countingRouter{KeywordRouter: NewRouter(cfg, nil)}
+	cache := NewCachingRouter(inner, cfg, time.Minute)
+	ctx := context.Background()
+	task := Task{Title: "Query the postgres database"}
+
+	cache.Route(ctx, task)
+	before := cache.Stats().ConfigVersion
+
+	reloaded := DefaultConfig()
+	reloaded.MaxToolsPerTask = 10
+	next := &countingRouter{KeywordRouter: NewRouter(reloaded, nil)}
+	cache.Reload(next, reloaded)
+
+	if cache.Stats().Entries != 0 || cache.Stats().ConfigVersion == before {
+		t.Errorf("Expected reload to clear entries and change version, got %+v", cache.Stats())
+	}
+	cache.Route(ctx, task)
+	if next.calls != 1 {
+		t.Errorf("Expected reloaded router to be used, got %d calls", next.calls)
+	}
+}
+
+func TestCachingRouterSkipsFallbacks(t *testing.T) {
+	cfg := DefaultConfig()
+	inner := &countingRouter{KeywordRouter: NewRouter(cfg, nil), fallback: "llm timeout"}
+	cache := NewCachingRouter(inner, cfg, time.Minute)
+
+	cache.Route(context.Background(), Task{Title: "Deploy"})
+	cache.Route(context.Background(), Task{Title: "Deploy"})
+	if inner.calls != 2 {
+		t.Errorf("Expected fallback results not to be cached, got %d calls", inner.calls)
+	}
+}
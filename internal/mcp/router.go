@@ -48,6 +48,7 @@ func (r *KeywordRouter) Route(ctx context.Context, task Task) (*RoutingResult, e
 			Task:         task,
 			SelectedMCPs: r.registry.GetEnabled(),
 			TotalTools:   r.registry.TotalToolCount(),
+			Strategy:     "disabled",
 		}, nil
 	}
 
@@ -107,6 +108,7 @@ func (r *KeywordRouter) Route(ctx context.Context, task Task) (*RoutingResult, e
 		MatchedRules:  matchedRules,
 		TotalTools:    totalTools,
 		FilteredTools: filteredTools,
+		Strategy:      "keywords",
 	}, nil
 }
 
@@ -172,6 +174,7 @@ func (r *KeywordRouter) routeWithOverrides(task Task) (*RoutingResult, error) {
 		MatchedRules:  []string{"override"},
 		TotalTools:    totalTools,
 		FilteredTools: totalTools,
+		Strategy:      "override",
 	}, nil
 }
 
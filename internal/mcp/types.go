@@ -18,6 +18,19 @@ type Tool struct {
 	Server      string `yaml:"server" json:"server"` // Parent server name
 }
 
+// ToolNamespaceSeparator joins server and tool names in namespaced tool
+// names. It is valid in MCP tool names, unlike "." or "/".
+const ToolNamespaceSeparator = "__"
+
+// NamespacedName returns the tool name qualified by its server, e.g.
+// "github__create_issue", so tools from different servers cannot collide.
+func (t Tool) NamespacedName() string {
+	if t.Server == "" {
+		return t.Name
+	}
+	return t.Server + ToolNamespaceSeparator + t.Name
+}
+
 // Task represents a task for routing decisions.
 type Task struct {
 	ID          string
@@ -32,4 +45,10 @@ type RoutingResult struct {
 	MatchedRules  []string    `json:"matched_rules"`
 	TotalTools    int         `json:"total_tools"`
 	FilteredTools int         `json:"filtered_tools"`
+	// Strategy names the router that produced the selection.
+	Strategy string `json:"strategy,omitempty"`
+	// Cached is set when the selection was reused from an earlier decision.
+	Cached bool `json:"cached,omitempty"`
+	// FallbackReason explains why a strategy fell back to keywords.
+	FallbackReason string `json:"fallback_reason,omitempty"`
 }
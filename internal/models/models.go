@@ -1,7 +1,11 @@
 // Package models defines the core domain types for Neona.
 package models
 
-import "time"
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
 
 // TaskStatus represents the current state of a task.
 type TaskStatus string
@@ -24,6 +28,44 @@ type Task struct {
 	UpdatedAt   time.Time  `json:"updated_at"`
 	ClaimedBy   string     `json:"claimed_by,omitempty"`
 	ClaimedAt   *time.Time `json:"claimed_at,omitempty"`
+	MutexKey    string     `json:"mutex_key,omitempty"`
+	Labels      []string   `json:"labels,omitempty"`
+	Connector   string     `json:"connector,omitempty"` // empty means any connector
+	WorkDir     string     `json:"workdir,omitempty"`   // empty means the daemon's working directory
+	PRURL       string     `json:"pr_url,omitempty"`    // pull request opened for the task's worktree branch
+	ParentID    string     `json:"parent_id,omitempty"` // task this one is a subtask of
+
+	// AcceptanceCriteria and Commands usually come from the description's
+	// frontmatter (see package taskspec).
+	AcceptanceCriteria []string `json:"acceptance_criteria,omitempty"`
+	Commands           []string `json:"commands,omitempty"`
+	// Steps is the task's pipeline: runs executed in order, stopping at the
+	// first failing step unless it continues on error.
+	Steps []RunStep `json:"steps,omitempty"`
+
+	// Priority orders claiming: pending tasks of higher priority are
+	// claimed first, and tasks of equal priority oldest first. 0 is normal.
+	Priority int `json:"priority,omitempty"`
+	// EstimateSec is how long the task is expected to take once claimed.
+	EstimateSec int `json:"estimate_sec,omitempty"`
+	// DueAt is the task's deadline (SLA).
+	DueAt *time.Time `json:"due_at,omitempty"`
+	// NotBefore delays the task: it is not dispatched until this time.
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	// SLABreachedAt is when the daemon noticed the task was still open past
+	// DueAt.
+	SLABreachedAt *time.Time `json:"sla_breached_at,omitempty"`
+	// Overdue and SLABreached are computed when the task is read: Overdue
+	// means it is still open past DueAt, SLABreached that it missed DueAt,
+	// whether or not it has finished since.
+	Overdue     bool `json:"overdue,omitempty"`
+	SLABreached bool `json:"sla_breached,omitempty"`
+	// Scheduled is computed when the task is read: it is pending but not
+	// dispatched before NotBefore.
+	Scheduled bool `json:"scheduled,omitempty"`
+	// LastActivityAt is set in listings of stale claims: when the holder
+	// last claimed the task, sent a heartbeat or ran a command.
+	LastActivityAt *time.Time `json:"last_activity_at,omitempty"`
 }
 
 // Lease represents a temporary claim on a task with TTL.
@@ -34,6 +76,107 @@ type Lease struct {
 	TTLSec    int       `json:"ttl_sec"`
 	ExpiresAt time.Time `json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
+	// HolderToken is issued once, in the claim response; only its hash is stored.
+	HolderToken string `json:"holder_token,omitempty"`
+	TokenHash   string `json:"-"`
+}
+
+// DefaultLeaseTTLSec is the TTL of claims and heartbeats that ask for none,
+// unless the daemon's claim config sets another.
+const DefaultLeaseTTLSec = 300
+
+// ClaimPolicy is the lease TTL claims get and how long they may ask for.
+type ClaimPolicy struct {
+	// LeaseTTLSec is the TTL of claims and heartbeats that ask for none.
+	LeaseTTLSec int `json:"lease_ttl_sec"`
+	// MaxLeaseTTLSec caps the TTL claims and heartbeats may ask for; 0 is
+	// no cap.
+	MaxLeaseTTLSec int `json:"max_lease_ttl_sec,omitempty"`
+	// HeartbeatSec is how often holders should heartbeat a lease of
+	// LeaseTTLSec: every third of it, so one missed heartbeat is survived.
+	HeartbeatSec int `json:"heartbeat_sec"`
+}
+
+// NewClaimPolicy returns the policy of a lease TTL and cap, with its
+// heartbeat interval.
+func NewClaimPolicy(ttlSec, maxTTLSec int) ClaimPolicy {
+	heartbeat := ttlSec / 3
+	if heartbeat < 1 {
+		heartbeat = 1
+	}
+	return ClaimPolicy{LeaseTTLSec: ttlSec, MaxLeaseTTLSec: maxTTLSec, HeartbeatSec: heartbeat}
+}
+
+// TTL returns the TTL granted to a claim or heartbeat asking for ttlSec,
+// where 0 asks for the default.
+func (p ClaimPolicy) TTL(ttlSec int) int {
+	if ttlSec <= 0 {
+		ttlSec = p.LeaseTTLSec
+	}
+	if p.MaxLeaseTTLSec > 0 && ttlSec > p.MaxLeaseTTLSec {
+		ttlSec = p.MaxLeaseTTLSec
+	}
+	return ttlSec
+}
+
+// ClaimConfig is the daemon's claim policy, with overrides for the tasks of
+// some projects (see TaskProject).
+type ClaimConfig struct {
+	ClaimPolicy
+	// MaxClaimsPerHolder limits how many tasks one holder may have claimed
+	// at once; 0 is no limit.
+	MaxClaimsPerHolder int `json:"max_claims_per_holder,omitempty"`
+	// Projects holds the complete policy of each project with overrides.
+	Projects map[string]ClaimPolicy `json:"projects,omitempty"`
+}
+
+// For returns the policy for the tasks of project.
+func (c ClaimConfig) For(project string) ClaimPolicy {
+	if p, ok := c.Projects[project]; ok && project != "" {
+		return p
+	}
+	return c.ClaimPolicy
+}
+
+// TaskProject names the project a task belongs to: the name in a
+// "project:<name>" label, or else the name of its workdir, as memory scopes
+// name projects. Tasks with neither belong to none.
+func TaskProject(t *Task) string {
+	for _, label := range t.Labels {
+		if name, ok := strings.CutPrefix(label, MemoryScopeProject); ok && name != "" {
+			return name
+		}
+	}
+	if t.WorkDir != "" {
+		return filepath.Base(t.WorkDir)
+	}
+	return ""
+}
+
+// RunStep is one run of a task's pipeline (see package pipeline).
+type RunStep struct {
+	// Name lets later steps refer to this one's exit code and outputs.
+	Name    string `json:"name,omitempty" yaml:"name"`
+	Command string `json:"command" yaml:"command"`
+	// Command and Args may use {{step.output}} and {{step.exit_code}}.
+	Args []string `json:"args,omitempty" yaml:"args"`
+	// ContinueOnError keeps the pipeline going when the step fails; its
+	// failure does not fail the task.
+	ContinueOnError bool `json:"continue_on_error,omitempty" yaml:"continue_on_error"`
+	// When decides whether the step runs: success (the default), failure,
+	// always, or a comparison such as "build.exit_code == 0".
+	When string `json:"when,omitempty" yaml:"when"`
+	// Outputs are values captured from the step's stdout.
+	Outputs []StepOutput `json:"outputs,omitempty" yaml:"outputs"`
+}
+
+// StepOutput captures a named value from a step's stdout, with either a
+// regular expression (its first group, or the whole match) or a dotted
+// path into stdout parsed as JSON, e.g. "release.tag".
+type StepOutput struct {
+	Name  string `json:"name" yaml:"name"`
+	Regex string `json:"regex,omitempty" yaml:"regex"`
+	JSON  string `json:"json,omitempty" yaml:"json"`
 }
 
 // Lock represents a resource lock (task-level or path-glob).
@@ -57,6 +200,14 @@ type Run struct {
 	Stderr    string    `json:"stderr"`
 	StartedAt time.Time `json:"started_at"`
 	EndedAt   time.Time `json:"ended_at"`
+	// HasDiff reports whether the workdir's git diff was captured at run
+	// end; fetch it from GET /runs/{id}/diff.
+	HasDiff bool `json:"has_diff,omitempty"`
+	// Truncated reports whether output past the daemon's per-stream limit
+	// was dropped.
+	Truncated bool `json:"truncated,omitempty"`
+	// RetryOf is the ID of the run this run re-executed, if any.
+	RetryOf string `json:"retry_of,omitempty"`
 }
 
 // PDREntry represents a Process Decision Record for audit.
@@ -76,5 +227,82 @@ type MemoryItem struct {
 	TaskID    string    `json:"task_id,omitempty"`
 	Content   string    `json:"content"`
 	Tags      string    `json:"tags,omitempty"` // comma-separated
+	Scope     string    `json:"scope"`          // see MemoryScopeGlobal
 	CreatedAt time.Time `json:"created_at"`
+
+	// SeenCount is how many times the content was added; duplicates are
+	// merged into the first item instead of stored again.
+	SeenCount  int        `json:"seen_count"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	// Duplicate is set in the response to an add that matched this item.
+	Duplicate bool `json:"duplicate,omitempty"`
+
+	// Source is the repository file a synced item was read from, such as
+	// AGENTS.md, and SourceHash the SHA-256 of that file's content when it
+	// was synced. Items added by hand have neither.
+	Source     string `json:"source,omitempty"`
+	SourceHash string `json:"source_hash,omitempty"`
+}
+
+// Memory scopes say who an item is shared with: everyone (global), the tasks
+// of one project ("project:<name>") or a single task ("task:<id>").
+const (
+	MemoryScopeGlobal  = "global"
+	MemoryScopeProject = "project:"
+	MemoryScopeTask    = "task:"
+)
+
+// DefaultMemoryScope is the scope of an item added without one: its task,
+// or global when it has none.
+func DefaultMemoryScope(taskID string) string {
+	if taskID == "" {
+		return MemoryScopeGlobal
+	}
+	return MemoryScopeTask + taskID
+}
+
+// Comment is a message in a task's discussion thread. Unlike memory items,
+// comments are conversation about the task, not knowledge to be recalled.
+type Comment struct {
+	ID        string    `json:"id"`
+	TaskID    string    `json:"task_id"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChecklistItem is one item of a task's checklist, such as an acceptance
+// criterion. Items are ordered by Position, starting at 1.
+type ChecklistItem struct {
+	ID        string     `json:"id"`
+	TaskID    string     `json:"task_id"`
+	Position  int        `json:"position"`
+	Text      string     `json:"text"`
+	Done      bool       `json:"done"`
+	CheckedBy string     `json:"checked_by,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Event notifies a holder (or anyone polling) about something that happened
+// to a task outside its control, e.g. an admin force-release.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	TaskID    string    `json:"task_id,omitempty"`
+	HolderID  string    `json:"holder_id,omitempty"`
+	Payload   string    `json:"payload,omitempty"` // JSON
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WorkerRecord is a persisted snapshot of an in-flight scheduler worker.
+type WorkerRecord struct {
+	WorkerID      string    `json:"worker_id"`
+	InstanceID    string    `json:"instance_id,omitempty"` // daemon running the worker
+	TaskID        string    `json:"task_id"`
+	LeaseID       string    `json:"lease_id"`
+	ConnectorName string    `json:"connector_name"`
+	State         string    `json:"state"` // "interrupted"
+	StartedAt     time.Time `json:"started_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
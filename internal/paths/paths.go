@@ -0,0 +1,224 @@
+// Package paths resolves where Neona keeps its data and configuration.
+//
+// Layout follows the XDG base directory spec:
+//
+//	data:   $NEONA_DATA_DIR,   else $XDG_DATA_HOME/neona,   else ~/.local/share/neona
+//	config: $NEONA_CONFIG_DIR, else $XDG_CONFIG_HOME/neona, else ~/.config/neona
+//
+// Older releases kept everything in ~/.neona; MigrateLegacy moves those files.
+package paths
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// File names within the data and config directories.
+const (
+	DBFile        = "neona.db"
+	LogFile       = "neona.log"
+	MCPConfigFile = "mcp.yaml"
+	ClaimsFile    = "claims.yaml"
+	ScriptsDir    = "scripts"
+	PluginsDir    = "plugins"
+	JournalFile   = "offline-journal.ndjson"
+	CrashesDir    = "crashes"
+	CloudSyncFile = "cloud-sync.json"
+	CloudKeysFile = "cloud-keys.json"
+)
+
+// DataDir returns the directory holding the database and logs.
+func DataDir() string {
+	return resolve("NEONA_DATA_DIR", "XDG_DATA_HOME", filepath.Join(".local", "share"))
+}
+
+// ConfigDir returns the directory holding user configuration and credentials.
+func ConfigDir() string {
+	return resolve("NEONA_CONFIG_DIR", "XDG_CONFIG_HOME", ".config")
+}
+
+// LegacyDir returns the pre-XDG ~/.neona directory.
+func LegacyDir() string {
+	return filepath.Join(home(), ".neona")
+}
+
+// ScriptsPath returns the directory of vetted scripts for the scripts
+// connector. MigrateLegacy leaves directories alone, so an existing
+// ~/.neona/scripts is used until it is moved by hand.
+func ScriptsPath() string {
+	path := filepath.Join(ConfigDir(), ScriptsDir)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		legacy := filepath.Join(LegacyDir(), ScriptsDir)
+		if _, err := os.Stat(legacy); err == nil {
+			return legacy
+		}
+	}
+	return path
+}
+
+// PluginsPath returns the directory the daemon discovers connector plugins
+// in.
+func PluginsPath() string {
+	return filepath.Join(ConfigDir(), PluginsDir)
+}
+
+// DBPath returns the default SQLite database path, honoring $NEONA_DB_PATH.
+func DBPath() string {
+	if path := os.Getenv("NEONA_DB_PATH"); path != "" {
+		return path
+	}
+	return filepath.Join(DataDir(), DBFile)
+}
+
+// LogPath returns the daemon log file path.
+func LogPath() string {
+	return filepath.Join(DataDir(), LogFile)
+}
+
+// JournalPath returns the file the CLI queues writes in while the daemon is
+// offline.
+func JournalPath() string {
+	return filepath.Join(DataDir(), JournalFile)
+}
+
+// CrashesPath returns the directory crash reports are written to.
+func CrashesPath() string {
+	return filepath.Join(DataDir(), CrashesDir)
+}
+
+// CloudSyncPath returns the file the cloud sync keeps its state in.
+func CloudSyncPath() string {
+	return filepath.Join(DataDir(), CloudSyncFile)
+}
+
+// CloudKeysPath returns the file holding the cloud sync encryption keys.
+func CloudKeysPath() string {
+	return filepath.Join(ConfigDir(), CloudKeysFile)
+}
+
+// ClaimsPath returns the daemon's claim config: lease TTLs and claim limits.
+func ClaimsPath() string {
+	return filepath.Join(ConfigDir(), ClaimsFile)
+}
+
+// MCPConfigPath returns the MCP routing config path. Until the legacy
+// directory has been migrated, an existing ~/.neona/mcp.yaml is preferred so
+// settings are not lost.
+func MCPConfigPath() string {
+	path := filepath.Join(ConfigDir(), MCPConfigFile)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		legacy := filepath.Join(LegacyDir(), MCPConfigFile)
+		if _, err := os.Stat(legacy); err == nil {
+			return legacy
+		}
+	}
+	return path
+}
+
+func resolve(override, xdg, fallback string) string {
+	if dir := os.Getenv(override); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv(xdg); dir != "" && filepath.IsAbs(dir) {
+		return filepath.Join(dir, "neona")
+	}
+	return filepath.Join(home(), fallback, "neona")
+}
+
+func home() string {
+	if dir, err := os.UserHomeDir(); err == nil {
+		return dir
+	}
+	return "."
+}
+
+// MigrateLegacy moves files from ~/.neona into the XDG directories. Files
+// that already exist at the destination are left alone, as are files Neona
+// doesn't know about. The legacy directory is removed once empty. It returns
+// the destination paths of the files it moved.
+//
+// Only the daemon should call this, before opening the database.
+func MigrateLegacy() ([]string, error) {
+	legacy := LegacyDir()
+	if _, err := os.Stat(legacy); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	dataDir, configDir := DataDir(), ConfigDir()
+
+	// Each group moves as a unit, keyed on its first file, so a database is
+	// never separated from its WAL and shared-memory files.
+	groups := []struct {
+		dir   string
+		names []string
+	}{
+		{dataDir, []string{DBFile, DBFile + "-wal", DBFile + "-shm"}},
+		{dataDir, []string{LogFile}},
+		{configDir, []string{MCPConfigFile}},
+	}
+
+	var moved []string
+	for _, g := range groups {
+		if filepath.Clean(g.dir) == filepath.Clean(legacy) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(legacy, g.names[0])); os.IsNotExist(err) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(g.dir, g.names[0])); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(g.dir, 0o700); err != nil {
+			return moved, fmt.Errorf("create %s: %w", g.dir, err)
+		}
+		for _, name := range g.names {
+			src, dst := filepath.Join(legacy, name), filepath.Join(g.dir, name)
+			if _, err := os.Stat(src); os.IsNotExist(err) {
+				continue
+			}
+			if err := moveFile(src, dst); err != nil {
+				return moved, fmt.Errorf("migrate %s: %w", src, err)
+			}
+			moved = append(moved, dst)
+		}
+	}
+
+	// Only succeeds if nothing else was left behind
+	os.Remove(legacy)
+	return moved, nil
+}
+
+// moveFile renames src to dst, copying when they are on different filesystems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
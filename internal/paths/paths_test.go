@@ -0,0 +1,116 @@
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirsRespectOverrides(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("NEONA_DATA_DIR", "")
+	t.Setenv("NEONA_CONFIG_DIR", "")
+	t.Setenv("NEONA_DB_PATH", "")
+
+	if got, want := DataDir(), filepath.Join(home, ".local", "share", "neona"); got != want {
+		t.Errorf("DataDir() = %q, want %q", got, want)
+	}
+	if got, want := ConfigDir(), filepath.Join(home, ".config", "neona"); got != want {
+		t.Errorf("ConfigDir() = %q, want %q", got, want)
+	}
+
+	t.Setenv("XDG_DATA_HOME", "/xdg/data")
+	t.Setenv("XDG_CONFIG_HOME", "relative/ignored")
+	if got, want := DataDir(), filepath.Join("/xdg/data", "neona"); got != want {
+		t.Errorf("DataDir() with XDG_DATA_HOME = %q, want %q", got, want)
+	}
+	if got, want := ConfigDir(), filepath.Join(home, ".config", "neona"); got != want {
+		t.Errorf("ConfigDir() with relative XDG_CONFIG_HOME = %q, want %q", got, want)
+	}
+
+	t.Setenv("NEONA_DATA_DIR", "/custom/data")
+	t.Setenv("NEONA_CONFIG_DIR", "/custom/config")
+	if got := DBPath(); got != filepath.Join("/custom/data", DBFile) {
+		t.Errorf("DBPath() = %q", got)
+	}
+	if got := ConfigDir(); got != "/custom/config" {
+		t.Errorf("ConfigDir() = %q", got)
+	}
+
+	t.Setenv("NEONA_DB_PATH", "/elsewhere/neona.db")
+	if got := DBPath(); got != "/elsewhere/neona.db" {
+		t.Errorf("DBPath() with NEONA_DB_PATH = %q", got)
+	}
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("NEONA_DB_PATH", "")
+	t.Setenv("NEONA_DATA_DIR", filepath.Join(home, "data"))
+	t.Setenv("NEONA_CONFIG_DIR", filepath.Join(home, "config"))
+
+	legacy := LegacyDir()
+	os.MkdirAll(legacy, 0o755)
+	for _, name := range []string{DBFile, DBFile + "-wal", LogFile, MCPConfigFile} {
+		os.WriteFile(filepath.Join(legacy, name), []byte(name), 0o600)
+	}
+
+	// Until migrated, the legacy MCP config is still found
+	if got := MCPConfigPath(); got != filepath.Join(legacy, MCPConfigFile) {
+		t.Errorf("MCPConfigPath() before migration = %q", got)
+	}
+
+	moved, err := MigrateLegacy()
+	if err != nil {
+		t.Fatalf("MigrateLegacy failed: %v", err)
+	}
+	if len(moved) != 4 {
+		t.Errorf("Expected 4 moved files, got %v", moved)
+	}
+	for _, path := range []string{DBPath(), DBPath() + "-wal", LogPath(), filepath.Join(ConfigDir(), MCPConfigFile)} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected %s after migration: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Error("Expected empty legacy directory to be removed")
+	}
+	if got := MCPConfigPath(); got != filepath.Join(ConfigDir(), MCPConfigFile) {
+		t.Errorf("MCPConfigPath() after migration = %q", got)
+	}
+}
+
+func TestMigrateLegacyKeepsExistingDatabase(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("NEONA_DB_PATH", "")
+	t.Setenv("NEONA_DATA_DIR", filepath.Join(home, "data"))
+	t.Setenv("NEONA_CONFIG_DIR", filepath.Join(home, "config"))
+
+	legacy := LegacyDir()
+	os.MkdirAll(legacy, 0o755)
+	os.WriteFile(filepath.Join(legacy, DBFile), []byte("old"), 0o600)
+	os.WriteFile(filepath.Join(legacy, DBFile+"-wal"), []byte("old-wal"), 0o600)
+	os.WriteFile(filepath.Join(legacy, "skills.json"), []byte("{}"), 0o600)
+
+	os.MkdirAll(DataDir(), 0o700)
+	os.WriteFile(DBPath(), []byte("new"), 0o600)
+
+	if _, err := MigrateLegacy(); err != nil {
+		t.Fatalf("MigrateLegacy failed: %v", err)
+	}
+
+	if data, _ := os.ReadFile(DBPath()); string(data) != "new" {
+		t.Errorf("Existing database was overwritten: %q", data)
+	}
+	if _, err := os.Stat(DBPath() + "-wal"); !os.IsNotExist(err) {
+		t.Error("Legacy WAL must not be moved next to a different database")
+	}
+	if _, err := os.Stat(filepath.Join(legacy, "skills.json")); err != nil {
+		t.Error("Unknown legacy files must be left in place")
+	}
+}
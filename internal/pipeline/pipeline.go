@@ -0,0 +1,298 @@
+// Package pipeline evaluates a task's steps as they run: whether each step
+// runs, the values substituted into its command, and the outputs it
+// captures for the steps after it.
+//
+//	steps:
+//	  - name: version
+//	    command: git
+//	    args: [describe, --tags]
+//	    outputs:
+//	      - {name: tag, regex: '^v(\S+)'}
+//	  - command: make
+//	    args: [release, 'VERSION={{version.tag}}']
+//	  - command: make
+//	    args: [rollback]
+//	    when: failure
+//
+// A step runs when its When holds. The default, success, holds until a step
+// fails without continuing on error; failure holds only after that, and
+// always holds either way. A comparison such as "version.exit_code != 0"
+// implies success as well, and is false if the step it names did not run.
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// Conditions a step's When may name besides a comparison.
+const (
+	WhenSuccess = "success"
+	WhenFailure = "failure"
+	WhenAlways  = "always"
+)
+
+// exitCodeVar is the variable every step that ran sets.
+const exitCodeVar = "exit_code"
+
+var (
+	namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+	// placeholder matches {{step.var}}.
+	placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\.([A-Za-z_][A-Za-z0-9_-]*)\s*\}\}`)
+	// comparison matches step.exit_code <op> <n>.
+	comparison = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_-]*)\.exit_code\s*(==|!=|<=|>=|<|>)\s*(-?\d+)$`)
+)
+
+// Validate checks steps before they are stored: names are unique, outputs
+// compile, and conditions and placeholders only refer to earlier steps.
+func Validate(steps []models.RunStep) error {
+	seen := make(map[string]bool)
+	outputs := make(map[string]map[string]bool)
+	for i, step := range steps {
+		n := i + 1
+		if strings.TrimSpace(step.Command) == "" {
+			return fmt.Errorf("step %d has no command", n)
+		}
+		refs := placeholder.FindAllStringSubmatch(strings.Join(append([]string{step.Command}, step.Args...), " "), -1)
+		for _, ref := range refs {
+			if !seen[ref[1]] {
+				return fmt.Errorf("step %d uses %s, which is not an earlier step", n, ref[0])
+			}
+			if ref[2] != exitCodeVar && !outputs[ref[1]][ref[2]] {
+				return fmt.Errorf("step %d uses %s, which step %s does not output", n, ref[0], ref[1])
+			}
+		}
+		if err := checkWhen(step.When, seen); err != nil {
+			return fmt.Errorf("step %d: %w", n, err)
+		}
+
+		if step.Name == "" {
+			if len(step.Outputs) > 0 {
+				return fmt.Errorf("step %d has outputs but no name", n)
+			}
+			continue
+		}
+		if !namePattern.MatchString(step.Name) {
+			return fmt.Errorf("step %d: invalid name %q", n, step.Name)
+		}
+		if seen[step.Name] {
+			return fmt.Errorf("step %d: duplicate name %q", n, step.Name)
+		}
+		seen[step.Name] = true
+		outputs[step.Name] = make(map[string]bool)
+		for _, out := range step.Outputs {
+			if !namePattern.MatchString(out.Name) || out.Name == exitCodeVar {
+				return fmt.Errorf("step %d: invalid output name %q", n, out.Name)
+			}
+			if (out.Regex == "") == (out.JSON == "") {
+				return fmt.Errorf("step %d: output %s needs a regex or a json path", n, out.Name)
+			}
+			if out.Regex != "" {
+				if _, err := regexp.Compile(out.Regex); err != nil {
+					return fmt.Errorf("step %d: output %s: %w", n, out.Name, err)
+				}
+			}
+			outputs[step.Name][out.Name] = true
+		}
+	}
+	return nil
+}
+
+// Templated reports whether step's command or args use placeholders, so
+// they are only known once the steps before it have run.
+func Templated(step models.RunStep) bool {
+	if placeholder.MatchString(step.Command) {
+		return true
+	}
+	for _, arg := range step.Args {
+		if placeholder.MatchString(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkWhen(when string, earlier map[string]bool) error {
+	switch when {
+	case "", WhenSuccess, WhenFailure, WhenAlways:
+		return nil
+	}
+	m := comparison.FindStringSubmatch(strings.TrimSpace(when))
+	if m == nil {
+		return fmt.Errorf("invalid condition %q: want success, failure, always or <step>.exit_code <op> <n>", when)
+	}
+	if !earlier[m[1]] {
+		return fmt.Errorf("condition %q names %s, which is not an earlier step", when, m[1])
+	}
+	return nil
+}
+
+// State tracks a pipeline while it runs. Steps must have passed Validate.
+type State struct {
+	failed bool
+	vars   map[string]map[string]string
+}
+
+// NewState returns the state of a pipeline about to start.
+func NewState() *State {
+	return &State{vars: make(map[string]map[string]string)}
+}
+
+// Failed reports whether a step has failed without continuing on error.
+func (s *State) Failed() bool { return s.failed }
+
+// ShouldRun reports whether step's condition holds.
+func (s *State) ShouldRun(step models.RunStep) bool {
+	switch step.When {
+	case "", WhenSuccess:
+		return !s.failed
+	case WhenFailure:
+		return s.failed
+	case WhenAlways:
+		return true
+	}
+	m := comparison.FindStringSubmatch(strings.TrimSpace(step.When))
+	if s.failed || m == nil {
+		return false
+	}
+	code, ok := s.vars[m[1]][exitCodeVar]
+	if !ok {
+		return false
+	}
+	got, _ := strconv.Atoi(code)
+	want, _ := strconv.Atoi(m[3])
+	switch m[2] {
+	case "==":
+		return got == want
+	case "!=":
+		return got != want
+	case "<":
+		return got < want
+	case "<=":
+		return got <= want
+	case ">":
+		return got > want
+	default:
+		return got >= want
+	}
+}
+
+// Expand returns step's command and args with placeholders replaced. It
+// fails if a placeholder names a step that did not run or an output it did
+// not capture.
+func (s *State) Expand(step models.RunStep) (string, []string, error) {
+	var missing []string
+	expand := func(v string) string {
+		return placeholder.ReplaceAllStringFunc(v, func(ref string) string {
+			m := placeholder.FindStringSubmatch(ref)
+			value, ok := s.vars[m[1]][m[2]]
+			if !ok {
+				missing = append(missing, m[1]+"."+m[2])
+			}
+			return value
+		})
+	}
+	command := expand(step.Command)
+	args := make([]string, len(step.Args))
+	for i, arg := range step.Args {
+		args[i] = expand(arg)
+	}
+	if len(missing) > 0 {
+		return "", nil, fmt.Errorf("no value for %s", strings.Join(missing, ", "))
+	}
+	return command, args, nil
+}
+
+// Record notes a step's result and returns the outputs it captured. An
+// output that does not match stdout is left unset.
+func (s *State) Record(step models.RunStep, exitCode int, stdout string) map[string]string {
+	if exitCode != 0 && !step.ContinueOnError {
+		s.failed = true
+	}
+	if step.Name == "" {
+		return nil
+	}
+	vars := map[string]string{exitCodeVar: strconv.Itoa(exitCode)}
+	s.vars[step.Name] = vars
+	if len(step.Outputs) == 0 {
+		return nil
+	}
+
+	captured := make(map[string]string)
+	var doc interface{}
+	parsed := false
+	for _, out := range step.Outputs {
+		var value string
+		var ok bool
+		if out.Regex != "" {
+			value, ok = matchRegex(out.Regex, stdout)
+		} else {
+			if !parsed {
+				parsed = true
+				if json.Unmarshal([]byte(stdout), &doc) != nil {
+					doc = nil
+				}
+			}
+			value, ok = lookupJSON(doc, out.JSON)
+		}
+		if ok {
+			vars[out.Name] = value
+			captured[out.Name] = value
+		}
+	}
+	return captured
+}
+
+// matchRegex returns the first group of pattern's first match in text, or
+// the whole match if it has no groups.
+func matchRegex(pattern, text string) (string, bool) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", false
+	}
+	m := re.FindStringSubmatch(text)
+	switch {
+	case m == nil:
+		return "", false
+	case len(m) > 1:
+		return m[1], true
+	default:
+		return m[0], true
+	}
+}
+
+// lookupJSON follows a dotted path of keys and array indexes into doc.
+// Strings are returned as is and other values as JSON.
+func lookupJSON(doc interface{}, path string) (string, bool) {
+	for _, key := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if doc, ok = v[key]; !ok {
+				return "", false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", false
+			}
+			doc = v[i]
+		default:
+			return "", false
+		}
+	}
+	switch v := doc.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	default:
+		data, _ := json.Marshal(v)
+		return string(data), true
+	}
+}
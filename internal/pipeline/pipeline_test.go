@@ -0,0 +1,109 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+func TestValidate(t *testing.T) {
+	valid := []models.RunStep{
+		{Name: "version", Command: "git", Outputs: []models.StepOutput{{Name: "tag", Regex: `^v(\S+)`}}},
+		{Command: "make", Args: []string{"VERSION={{version.tag}}"}, When: "version.exit_code == 0"},
+		{Command: "notify", Args: []string{"{{ version.exit_code }}"}, When: WhenAlways},
+	}
+	if err := Validate(valid); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		steps []models.RunStep
+		want  string
+	}{
+		{"no command", []models.RunStep{{Command: " "}}, "no command"},
+		{"later step", []models.RunStep{{Command: "make", Args: []string{"{{b.x}}"}}, {Name: "b", Command: "git"}}, "not an earlier step"},
+		{"undeclared output", []models.RunStep{{Name: "a", Command: "git"}, {Command: "{{a.tag}}"}}, "does not output"},
+		{"duplicate name", []models.RunStep{{Name: "a", Command: "git"}, {Name: "a", Command: "git"}}, "duplicate name"},
+		{"invalid name", []models.RunStep{{Name: "a.b", Command: "git"}}, "invalid name"},
+		{"unnamed outputs", []models.RunStep{{Command: "git", Outputs: []models.StepOutput{{Name: "x", Regex: "x"}}}}, "no name"},
+		{"both extractors", []models.RunStep{{Name: "a", Command: "git", Outputs: []models.StepOutput{{Name: "x", Regex: "x", JSON: "x"}}}}, "regex or a json path"},
+		{"bad regex", []models.RunStep{{Name: "a", Command: "git", Outputs: []models.StepOutput{{Name: "x", Regex: "("}}}}, "output x"},
+		{"bad condition", []models.RunStep{{Command: "git", When: "sometimes"}}, "invalid condition"},
+		{"condition on later step", []models.RunStep{{Command: "git", When: "b.exit_code != 0"}, {Name: "b", Command: "git"}}, "not an earlier step"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.steps)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestState(t *testing.T) {
+	build := models.RunStep{Name: "build", Command: "make", Outputs: []models.StepOutput{
+		{Name: "version", JSON: "release.version"},
+		{Name: "targets", JSON: "release.targets"},
+		{Name: "first", JSON: "release.targets.0"},
+		{Name: "missing", Regex: "nothing here"},
+	}}
+	st := NewState()
+	if !st.ShouldRun(build) {
+		t.Fatal("Expected the first step to run")
+	}
+	got := st.Record(build, 0, `{"release":{"version":"1.4.0","targets":["linux","darwin"]}}`)
+	want := map[string]string{"version": "1.4.0", "targets": `["linux","darwin"]`, "first": "linux"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected outputs %v, got %v", want, got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Output %s: expected %q, got %q", k, v, got[k])
+		}
+	}
+
+	cmd, args, err := st.Expand(models.RunStep{Command: "upload", Args: []string{"v{{build.version}}", "--code={{build.exit_code}}"}})
+	if err != nil || cmd != "upload" || args[0] != "v1.4.0" || args[1] != "--code=0" {
+		t.Errorf("Unexpected expansion: %s %v %v", cmd, args, err)
+	}
+	if _, _, err := st.Expand(models.RunStep{Command: "echo", Args: []string{"{{build.missing}}"}}); err == nil {
+		t.Error("Expected an error for an output that was not captured")
+	}
+
+	test := models.RunStep{Name: "test", Command: "make", Outputs: []models.StepOutput{{Name: "failures", Regex: `(\d+) failed`}}}
+	if got := st.Record(test, 2, "ok\n3 failed\n"); got["failures"] != "3" {
+		t.Errorf("Expected the regex group captured, got %v", got)
+	}
+	if !st.Failed() {
+		t.Error("Expected a non-zero exit to fail the pipeline")
+	}
+
+	when := map[string]bool{
+		"":                     false,
+		WhenSuccess:            false,
+		WhenFailure:            true,
+		WhenAlways:             true,
+		"test.exit_code == 2":  false, // comparisons imply success
+		"unrun.exit_code == 0": false,
+	}
+	for cond, want := range when {
+		if got := st.ShouldRun(models.RunStep{Command: "x", When: cond}); got != want {
+			t.Errorf("ShouldRun(%q) = %v, want %v", cond, got, want)
+		}
+	}
+
+	st = NewState()
+	st.Record(models.RunStep{Name: "lint", Command: "lint", ContinueOnError: true}, 1, "")
+	if st.Failed() {
+		t.Error("Expected a step continuing on error not to fail the pipeline")
+	}
+	if !st.ShouldRun(models.RunStep{Command: "fix", When: "lint.exit_code != 0"}) {
+		t.Error("Expected the comparison on the exit code to hold")
+	}
+	if st.ShouldRun(models.RunStep{Command: "fix", When: "lint.exit_code < 1"}) {
+		t.Error("Expected the comparison on the exit code not to hold")
+	}
+}
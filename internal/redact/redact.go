@@ -0,0 +1,152 @@
+// Package redact finds secrets and personal data in text and masks them
+// before the text is stored. A pattern is a named regular expression; when
+// it has a group named "secret", only that group is masked, so
+// "api_key=abc123..." keeps its key name:
+//
+//	api_key=[REDACTED:secret-assignment]
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Pattern is a named kind of sensitive text.
+type Pattern struct {
+	Name string
+	Re   *regexp.Regexp
+}
+
+// Defaults are the patterns enabled by the daemon's --redact flag.
+var Defaults = []Pattern{
+	{"private-key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"aws-access-key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github-token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"slack-token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"api-key", regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{"bearer-token", regexp.MustCompile(`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9._~+/-]{16,}=*)`)},
+	{"secret-assignment", regexp.MustCompile(`(?i)\b(?:api[_-]?key|secret|token|passw(?:or)?d)\b["']?\s*[:=]\s*["']?(?P<secret>[^\s"',;\[][^\s"',;]{7,})`)},
+	{"email", regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+}
+
+// ParsePattern parses a NAME=REGEX pattern spec, as given to
+// --redact-pattern.
+func ParsePattern(spec string) (Pattern, error) {
+	name, expr, ok := strings.Cut(spec, "=")
+	if !ok || name == "" || expr == "" {
+		return Pattern{}, fmt.Errorf("redaction pattern %q: want NAME=REGEX", spec)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Pattern{}, fmt.Errorf("redaction pattern %s: %w", name, err)
+	}
+	return Pattern{Name: name, Re: re}, nil
+}
+
+// Select returns Defaults without the named patterns, followed by extra.
+// It fails if a name to skip is not a default pattern.
+func Select(skip []string, extra ...Pattern) ([]Pattern, error) {
+	skipped := make(map[string]bool)
+	for _, name := range skip {
+		skipped[name] = true
+	}
+	var patterns []Pattern
+	for _, p := range Defaults {
+		if skipped[p.Name] {
+			delete(skipped, p.Name)
+			continue
+		}
+		patterns = append(patterns, p)
+	}
+	for name := range skipped {
+		return nil, fmt.Errorf("no default redaction pattern %q", name)
+	}
+	return append(patterns, extra...), nil
+}
+
+// Redactor masks the text matched by its patterns.
+type Redactor struct {
+	patterns []Pattern
+}
+
+// New creates a redactor applying patterns in order.
+func New(patterns ...Pattern) *Redactor {
+	return &Redactor{patterns: patterns}
+}
+
+// Finding is a match of a pattern in scanned text.
+type Finding struct {
+	Pattern string
+	Offset  int    // byte offset of the match in the text
+	Match   string // the sensitive text itself
+}
+
+// Scan returns the sensitive text in s, ordered by offset. A nil Redactor
+// finds nothing.
+func (r *Redactor) Scan(s string) []Finding {
+	if r == nil {
+		return nil
+	}
+	var findings []Finding
+	for _, p := range r.patterns {
+		for _, loc := range secretSpans(p.Re, s) {
+			findings = append(findings, Finding{Pattern: p.Name, Offset: loc[0], Match: s[loc[0]:loc[1]]})
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Offset < findings[j].Offset })
+	return findings
+}
+
+// Redact replaces the sensitive text in s with [REDACTED:<pattern>]. A nil
+// Redactor returns s unchanged.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, p := range r.patterns {
+		spans := secretSpans(p.Re, s)
+		if len(spans) == 0 {
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, loc := range spans {
+			b.WriteString(s[last:loc[0]])
+			b.WriteString("[REDACTED:" + p.Name + "]")
+			last = loc[1]
+		}
+		b.WriteString(s[last:])
+		s = b.String()
+	}
+	return s
+}
+
+// secretSpans returns the byte ranges re masks in s: each match, or its
+// "secret" group when re has one.
+func secretSpans(re *regexp.Regexp, s string) [][2]int {
+	group := re.SubexpIndex("secret")
+	var spans [][2]int
+	for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+		start, end := m[0], m[1]
+		if group > 0 {
+			if m[2*group] < 0 {
+				continue
+			}
+			start, end = m[2*group], m[2*group+1]
+		}
+		spans = append(spans, [2]int{start, end})
+	}
+	return spans
+}
+
+// Mask shortens a finding for display, keeping only enough to recognize it.
+func Mask(secret string) string {
+	runes := []rune(strings.Join(strings.Fields(secret), " "))
+	if len(runes) <= 8 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:4]) + "…" + string(runes[len(runes)-2:])
+}
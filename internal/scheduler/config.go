@@ -1,12 +1,34 @@
 // Package scheduler provides task dispatching with worker pool management.
 package scheduler
 
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
 // Config defines the scheduler configuration.
 type Config struct {
 	// GlobalMax is the maximum number of concurrent workers across all connectors.
 	GlobalMax int `yaml:"global_max"`
 	// ByConnector defines per-connector concurrency limits.
 	ByConnector map[string]int `yaml:"by_connector"`
+	// ByLabel limits how many tasks carrying a label run at once, e.g.
+	// {"prod-deploy": 1} to serialize deploys. Labels without a limit are
+	// not limited.
+	ByLabel map[string]int `yaml:"by_label"`
+	// DrainTimeoutSec is how long shutdown waits for in-flight workers before interrupting them.
+	DrainTimeoutSec int `yaml:"drain_timeout_sec"`
+	// PollIntervalMs is the base delay between dispatch cycles.
+	PollIntervalMs int `yaml:"poll_interval_ms"`
+	// PollJitterMs adds a random delay of up to this many milliseconds to each cycle.
+	PollJitterMs int `yaml:"poll_jitter_ms"`
+	// MaxClaimsPerCycle caps claims per dispatch cycle (0 fills all available capacity).
+	MaxClaimsPerCycle int `yaml:"max_claims_per_cycle"`
+	// RateLimits defines per-connector dispatch rate limits.
+	RateLimits map[string]RateLimit `yaml:"rate_limits"`
+	// TaskRateLimit limits how often the same task may be dispatched.
+	TaskRateLimit RateLimit `yaml:"task_rate_limit"`
 }
 
 // DefaultConfig returns the default scheduler configuration.
@@ -16,6 +38,10 @@ func DefaultConfig() *Config {
 		ByConnector: map[string]int{
 			"localexec": 5,
 		},
+		DrainTimeoutSec:   30,
+		PollIntervalMs:    1000,
+		PollJitterMs:      200,
+		MaxClaimsPerCycle: 0,
 	}
 }
 
@@ -27,3 +53,41 @@ func (c *Config) GetConnectorLimit(connectorName string) int {
 	// Default limit if not specified
 	return 1
 }
+
+// saturatedLabels returns the limited labels with as many tasks running as
+// their limit allows, given the running counts by label.
+func (c *Config) saturatedLabels(running map[string]int) []string {
+	var labels []string
+	for label, limit := range c.ByLabel {
+		if running[label] >= limit {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// DrainTimeout returns the shutdown drain timeout as a duration.
+func (c *Config) DrainTimeout() time.Duration {
+	if c.DrainTimeoutSec < 0 {
+		return 0
+	}
+	return time.Duration(c.DrainTimeoutSec) * time.Second
+}
+
+// PollInterval returns the base dispatch interval, defaulting to one second.
+func (c *Config) PollInterval() time.Duration {
+	if c.PollIntervalMs <= 0 {
+		return time.Second
+	}
+	return time.Duration(c.PollIntervalMs) * time.Millisecond
+}
+
+// NextPollDelay returns the delay before the next dispatch cycle, including jitter.
+func (c *Config) NextPollDelay() time.Duration {
+	delay := c.PollInterval()
+	if c.PollJitterMs > 0 {
+		delay += time.Duration(rand.Int63n(int64(c.PollJitterMs)+1)) * time.Millisecond
+	}
+	return delay
+}
@@ -0,0 +1,263 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fentz26/neona/internal/audit"
+	"github.com/fentz26/neona/internal/mcp"
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+// ErrNotAccepted is returned by an executor when nobody took the task on.
+// The worker releases the task back to pending instead of failing it.
+var ErrNotAccepted = errors.New("task not accepted")
+
+// Defaults for a DispatchExecutor.
+const (
+	DefaultAckTimeout   = 10 * time.Second
+	defaultDispatchPoll = time.Second
+	// dispatchMemoryItems caps the memory items sent with a task.
+	dispatchMemoryItems = 10
+)
+
+// RemoteAgent is an agent that takes tasks at a callback URL.
+type RemoteAgent struct {
+	Name string
+	URL  string
+}
+
+// DispatchStore is the store access a DispatchExecutor needs. store.Store
+// implements it.
+type DispatchStore interface {
+	GetTask(id string) (*models.Task, error)
+	GetActiveLease(taskID string) (*models.Lease, error)
+	SetLeaseTokenHash(leaseID, tokenHash string) error
+	ListChecklist(taskID string) ([]models.ChecklistItem, error)
+	ListComments(taskID string, since time.Time) ([]models.Comment, error)
+	GetMemoryForTask(taskID string) ([]models.MemoryItem, error)
+}
+
+// Dispatch is the body POSTed to a remote agent's callback URL.
+type Dispatch struct {
+	Task *models.Task `json:"task"`
+	// Lease carries the holder ID and holder token the agent reports back
+	// with: heartbeats, runs and completion go through the daemon's API.
+	Lease   *models.Lease   `json:"lease"`
+	API     string          `json:"api,omitempty"`
+	Context DispatchContext `json:"context"`
+	// Tools is the manifest of MCP tools routed to the task.
+	Tools []mcp.Tool `json:"tools"`
+}
+
+// DispatchContext is the context bundle sent with a task.
+type DispatchContext struct {
+	Checklist []models.ChecklistItem `json:"checklist"`
+	Comments  []models.Comment       `json:"comments"`
+	// Memory holds the newest memory items recorded for the task.
+	Memory []models.MemoryItem `json:"memory"`
+}
+
+// DispatchAck is an agent's reply to a Dispatch.
+type DispatchAck struct {
+	Accepted bool   `json:"accepted"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// DispatchExecutor pushes tasks to remote agents. It offers each task to
+// the agents in turn, POSTing a Dispatch to their callback URL, until one
+// replies with an accepting DispatchAck within AckTimeout. If none does,
+// the task is requeued. Once accepted, the task is the agent's: it reports
+// back through the API with the lease's holder token, and Execute returns
+// when the agent completes, fails or releases the task.
+type DispatchExecutor struct {
+	Agents []RemoteAgent
+	Store  DispatchStore
+	// API is the daemon's URL, passed on so agents know where to report.
+	API string
+	// Router, if set, selects the tools sent with each task.
+	Router mcp.Router
+	// PDR, if set, audits each offer as task.agent_ack.
+	PDR    *audit.PDRWriter
+	Client *http.Client
+	// AckTimeout bounds each offer; zero means DefaultAckTimeout.
+	AckTimeout time.Duration
+	// Poll is how often an accepted task's status is checked; zero means
+	// every second.
+	Poll time.Duration
+}
+
+// Name implements Executor. A DispatchExecutor stands in for the agent
+// executor.
+func (e *DispatchExecutor) Name() string { return ExecutorAgent }
+
+// Execute implements Executor.
+func (e *DispatchExecutor) Execute(ctx context.Context, task *models.Task) error {
+	lease, err := e.Store.GetActiveLease(task.ID)
+	if err != nil {
+		return err
+	}
+	if lease == nil {
+		return errors.New("task has no lease")
+	}
+	// Scheduler leases have no holder token; issue one for the agent
+	token, hash, err := store.NewHolderToken()
+	if err != nil {
+		return err
+	}
+	if err := e.Store.SetLeaseTokenHash(lease.ID, hash); err != nil {
+		return fmt.Errorf("store holder token: %w", err)
+	}
+	lease.HolderToken = token
+
+	d, err := e.bundle(ctx, task, lease)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	agent, err := e.offer(ctx, task.ID, body)
+	if err != nil {
+		return err
+	}
+	return e.await(ctx, task.ID, agent)
+}
+
+// bundle collects what an agent is sent with a task.
+func (e *DispatchExecutor) bundle(ctx context.Context, task *models.Task, lease *models.Lease) (*Dispatch, error) {
+	d := &Dispatch{Task: task, Lease: lease, API: e.API, Tools: []mcp.Tool{}}
+	var err error
+	if d.Context.Checklist, err = e.Store.ListChecklist(task.ID); err != nil {
+		return nil, err
+	}
+	if d.Context.Comments, err = e.Store.ListComments(task.ID, time.Time{}); err != nil {
+		return nil, err
+	}
+	if d.Context.Memory, err = e.Store.GetMemoryForTask(task.ID); err != nil {
+		return nil, err
+	}
+	if len(d.Context.Memory) > dispatchMemoryItems {
+		d.Context.Memory = d.Context.Memory[:dispatchMemoryItems]
+	}
+
+	if e.Router != nil {
+		result, err := e.Router.Route(ctx, mcp.Task{ID: task.ID, Title: task.Title, Description: task.Description})
+		if err != nil {
+			log.Printf("MCP routing error for task %s: %v", task.ID, err)
+		} else {
+			d.Tools = append(d.Tools, e.Router.GetToolManifest(result.SelectedMCPs)...)
+		}
+	}
+	return d, nil
+}
+
+// offer offers a task to each agent in turn, returning the first to accept.
+func (e *DispatchExecutor) offer(ctx context.Context, taskID string, body []byte) (RemoteAgent, error) {
+	if len(e.Agents) == 0 {
+		return RemoteAgent{}, fmt.Errorf("%w: no agents registered", ErrNotAccepted)
+	}
+	var refusals []string
+	for _, agent := range e.Agents {
+		ack, err := e.post(ctx, agent, body)
+		if ctx.Err() != nil {
+			return RemoteAgent{}, ctx.Err()
+		}
+		outcome, details := "accepted", ""
+		switch {
+		case err != nil:
+			outcome, details = "error", err.Error()
+		case !ack.Accepted:
+			outcome, details = "declined", ack.Reason
+		}
+		if e.PDR != nil {
+			e.PDR.Record("task.agent_ack", map[string]string{"task_id": taskID, "agent": agent.Name}, outcome, taskID, details)
+		}
+		if outcome == "accepted" {
+			log.Printf("Agent %s accepted task %s", agent.Name, taskID)
+			return agent, nil
+		}
+		refusals = append(refusals, fmt.Sprintf("%s %s", agent.Name, strings.TrimSpace(outcome+" "+details)))
+	}
+	return RemoteAgent{}, fmt.Errorf("%w: %s", ErrNotAccepted, strings.Join(refusals, "; "))
+}
+
+// post sends a Dispatch to an agent and reads its acknowledgement.
+func (e *DispatchExecutor) post(ctx context.Context, agent RemoteAgent, body []byte) (*DispatchAck, error) {
+	timeout := e.AckTimeout
+	if timeout <= 0 {
+		timeout = DefaultAckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, agent.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("no acknowledgement within %s", timeout)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var ack DispatchAck
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&ack); err != nil {
+		return nil, fmt.Errorf("decode acknowledgement: %w", err)
+	}
+	return &ack, nil
+}
+
+// await waits for an accepted task to leave the agent's hands.
+func (e *DispatchExecutor) await(ctx context.Context, taskID string, agent RemoteAgent) error {
+	poll := e.Poll
+	if poll <= 0 {
+		poll = defaultDispatchPoll
+	}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	for {
+		task, err := e.Store.GetTask(taskID)
+		if err != nil {
+			return err
+		}
+		if task == nil {
+			return errors.New("task deleted")
+		}
+		switch task.Status {
+		case models.TaskStatusCompleted:
+			return nil
+		case models.TaskStatusFailed:
+			return fmt.Errorf("agent %s failed the task", agent.Name)
+		case models.TaskStatusPending:
+			return fmt.Errorf("%w: agent %s released the task", ErrNotAccepted, agent.Name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/audit"
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+// ackAgent replies to every dispatch with ack, passing each on to got.
+func ackAgent(t *testing.T, ack DispatchAck, got chan<- Dispatch) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var d Dispatch
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			t.Errorf("Decode dispatch: %v", err)
+		}
+		if got != nil {
+			got <- d
+		}
+		json.NewEncoder(w).Encode(ack)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// silentAgent never acknowledges.
+func silentAgent(t *testing.T) *httptest.Server {
+	stop := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stop
+	}))
+	t.Cleanup(func() {
+		close(stop)
+		srv.Close()
+	})
+	return srv
+}
+
+func TestDispatchExecutor(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	task, _ := s.CreateTask("Review PR", "")
+	s.AddChecklistItems(task.ID, []string{"tests pass"})
+	if _, err := s.ClaimTaskWithLeaseTx(task.ID, "worker-1", 60); err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+
+	got := make(chan Dispatch, 1)
+	e := &DispatchExecutor{
+		Agents: []RemoteAgent{
+			{Name: "busy", URL: ackAgent(t, DispatchAck{Reason: "busy"}, nil).URL},
+			{Name: "reviewer", URL: ackAgent(t, DispatchAck{Accepted: true}, got).URL},
+		},
+		Store: s,
+		API:   "http://127.0.0.1:7466",
+		PDR:   audit.NewPDRWriter(s),
+		Poll:  10 * time.Millisecond,
+	}
+	done := make(chan error, 1)
+	go func() { done <- e.Execute(context.Background(), task) }()
+
+	d := <-got
+	lease, _ := s.GetActiveLease(task.ID)
+	if d.Task.ID != task.ID || d.Lease.HolderID != "worker-1" || store.HashToken(d.Lease.HolderToken) != lease.TokenHash {
+		t.Errorf("Expected the task and a holder token for its lease, got %+v", d.Lease)
+	}
+	if len(d.Context.Checklist) != 1 || d.API != e.API {
+		t.Errorf("Expected the context bundle, got %+v", d.Context)
+	}
+
+	// The agent reports back through the API
+	s.UpdateTaskStatus(task.ID, models.TaskStatusCompleted)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Execute did not return once the agent completed the task")
+	}
+
+	pdrs, _ := s.ListTaskPDRs(task.ID, 10)
+	var outcomes []string
+	for _, p := range pdrs {
+		if p.Action == "task.agent_ack" {
+			outcomes = append(outcomes, p.Outcome)
+		}
+	}
+	if len(outcomes) != 2 {
+		t.Errorf("Expected both offers audited, got %v", outcomes)
+	}
+}
+
+func TestDispatchExecutorNotAccepted(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	task, _ := s.CreateTask("Review PR", "")
+	s.ClaimTaskWithLeaseTx(task.ID, "worker-1", 60)
+
+	e := &DispatchExecutor{
+		Agents:     []RemoteAgent{{Name: "silent", URL: silentAgent(t).URL}},
+		Store:      s,
+		AckTimeout: 50 * time.Millisecond,
+	}
+	if err := e.Execute(context.Background(), task); !errors.Is(err, ErrNotAccepted) {
+		t.Fatalf("Expected ErrNotAccepted, got %v", err)
+	}
+}
+
+func TestSchedulerRequeuesUnacceptedTasks(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	cfg := &Config{GlobalMax: 1, ByConnector: map[string]int{"test": 1}, PollIntervalMs: 50}
+	sch := New(s, audit.NewPDRWriter(s), &mockConnector{name: "test"}, cfg)
+	sch.AddExecutor(&DispatchExecutor{
+		Agents:     []RemoteAgent{{Name: "silent", URL: silentAgent(t).URL}},
+		Store:      s,
+		AckTimeout: 50 * time.Millisecond,
+	})
+	task, _ := s.CreateTask("Review PR", "")
+
+	sch.Start()
+	defer sch.Stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		pdrs, _ := s.ListTaskPDRs(task.ID, 50)
+		for _, p := range pdrs {
+			if p.Action == "task.requeue" {
+				return
+			}
+			if p.Action == "task.execute" {
+				t.Fatalf("Expected the task requeued, got %s: %s", p.Outcome, p.Details)
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("Task was not requeued")
+}
@@ -0,0 +1,202 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fentz26/neona/internal/connectors"
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/pipeline"
+)
+
+// Executor carries out a task a scheduler worker has claimed. Execute
+// returns once the work is done: nil completes the task and an error fails
+// it. When ctx is cancelled the worker is being interrupted; Execute should
+// return promptly, and the task is kept claimed for Recover to requeue.
+type Executor interface {
+	Name() string
+	Execute(ctx context.Context, task *models.Task) error
+}
+
+// Executor names. A task runs on the executor its ExecutorLabel names, or
+// else on ExecutorConnector if it has commands or steps and ExecutorAgent
+// if not.
+const (
+	ExecutorConnector = "connector"
+	ExecutorAgent     = "agent"
+)
+
+// ExecutorLabel prefixes the label choosing a task's executor, e.g.
+// "executor:agent".
+const ExecutorLabel = "executor:"
+
+// executorName returns the name of the executor a task should run on.
+func executorName(task *models.Task) string {
+	for _, label := range task.Labels {
+		if name, ok := strings.CutPrefix(label, ExecutorLabel); ok && name != "" {
+			return name
+		}
+	}
+	if len(task.Commands) > 0 || len(task.Steps) > 0 {
+		return ExecutorConnector
+	}
+	return ExecutorAgent
+}
+
+// RunRecorder stores the runs executors make. store.Store implements it.
+type RunRecorder interface {
+	CreateRun(taskID, command string, args []string) (*models.Run, error)
+	// FinishRun stores the result, capping output and updating run in place.
+	FinishRun(run *models.Run) error
+}
+
+// TaskRunner runs one command for a task a worker has claimed and records
+// the run, checking the command as runs made through the API are checked:
+// the task's connector and its allowlist, the workdir and the sandbox its
+// labels pick. controlplane.Service implements it. The run is nil if the
+// command was refused or could not be recorded.
+type TaskRunner interface {
+	RunClaimed(ctx context.Context, task *models.Task, command string, args []string, stdin []byte) (*models.Run, error)
+}
+
+// ConnectorExecutor runs a task's pipeline through a connector, one step
+// after the other in the task's workdir, recording each run. Steps run as
+// their conditions say, with placeholders expanded from the outputs of the
+// steps before them, and the task fails if a step fails without continuing
+// on error. A task without steps runs its commands instead, stopping at the
+// first failure. Commands run through Runner when it is set, and straight
+// through Conn otherwise.
+type ConnectorExecutor struct {
+	Conn   connectors.Connector
+	Runs   RunRecorder
+	Runner TaskRunner
+}
+
+// Name implements Executor.
+func (e *ConnectorExecutor) Name() string { return ExecutorConnector }
+
+// Execute implements Executor.
+func (e *ConnectorExecutor) Execute(ctx context.Context, task *models.Task) error {
+	if len(task.Steps) > 0 {
+		return e.runSteps(ctx, task)
+	}
+	if len(task.Commands) == 0 {
+		return errors.New("task has no commands")
+	}
+	for _, line := range task.Commands {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := runCommand(ctx, e.Runner, e.Conn, e.Runs, task, fields[0], fields[1:], nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runSteps runs a task's pipeline, returning the first failure that was
+// not continued past.
+func (e *ConnectorExecutor) runSteps(ctx context.Context, task *models.Task) error {
+	st := pipeline.NewState()
+	var failure error
+	for _, step := range task.Steps {
+		if !st.ShouldRun(step) {
+			continue
+		}
+		cmd, args, err := st.Expand(step)
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.Command, err)
+		}
+		run, err := recordRun(ctx, e.Runner, e.Conn, e.Runs, task, cmd, args, nil)
+		if run == nil || (err != nil && ctx.Err() != nil) {
+			return err
+		}
+		st.Record(step, run.ExitCode, run.Stdout)
+		if err != nil && failure == nil && st.Failed() {
+			failure = err
+		}
+	}
+	return failure
+}
+
+// AgentExecutor hands a task to a coding agent's CLI, such as
+// "claude -p": it runs Command with Args through the connector in the
+// task's workdir, with the task's title and description on stdin, and
+// records the run. The connector must allow the command. As with
+// ConnectorExecutor, the command runs through Runner when it is set.
+type AgentExecutor struct {
+	Conn    connectors.Connector
+	Runs    RunRecorder
+	Runner  TaskRunner
+	Command string
+	Args    []string
+}
+
+// Name implements Executor.
+func (e *AgentExecutor) Name() string { return ExecutorAgent }
+
+// Execute implements Executor.
+func (e *AgentExecutor) Execute(ctx context.Context, task *models.Task) error {
+	prompt := task.Title
+	if task.Description != "" {
+		prompt += "\n\n" + task.Description
+	}
+	return runCommand(ctx, e.Runner, e.Conn, e.Runs, task, e.Command, e.Args, []byte(prompt))
+}
+
+// runCommand runs one command for a task and records the run. It fails if
+// the command cannot run or exits non-zero.
+func runCommand(ctx context.Context, runner TaskRunner, conn connectors.Connector, runs RunRecorder, task *models.Task, cmd string, args []string, stdin []byte) error {
+	_, err := recordRun(ctx, runner, conn, runs, task, cmd, args, stdin)
+	return err
+}
+
+// recordRun is runCommand returning the run as well. The run is nil only if
+// it was refused or could not be recorded.
+func recordRun(ctx context.Context, runner TaskRunner, conn connectors.Connector, runs RunRecorder, task *models.Task, cmd string, args []string, stdin []byte) (*models.Run, error) {
+	if runner != nil {
+		run, err := runner.RunClaimed(ctx, task, cmd, args, stdin)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("%s: %w", cmd, err)
+		case run.ExitCode == -1:
+			// The connector could not run the command
+			return run, fmt.Errorf("%s: %s", cmd, run.Stderr)
+		case run.ExitCode != 0:
+			return run, fmt.Errorf("%s exited with status %d", cmd, run.ExitCode)
+		}
+		return run, nil
+	}
+
+	run, err := runs.CreateRun(task.ID, cmd, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if task.WorkDir != "" {
+		ctx = connectors.WithWorkDir(ctx, task.WorkDir)
+	}
+	if stdin != nil {
+		ctx = connectors.WithInput(ctx, connectors.Input{Stdin: stdin})
+	}
+	result, execErr := conn.Execute(ctx, cmd, args)
+	if execErr != nil {
+		run.ExitCode, run.Stderr = -1, execErr.Error()
+	} else {
+		run.ExitCode, run.Stdout, run.Stderr, run.Truncated = result.ExitCode, result.Stdout, result.Stderr, result.Truncated
+	}
+	if err := runs.FinishRun(run); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case execErr != nil:
+		return run, fmt.Errorf("%s: %w", cmd, execErr)
+	case run.ExitCode != 0:
+		return run, fmt.Errorf("%s exited with status %d", cmd, run.ExitCode)
+	}
+	return run, nil
+}
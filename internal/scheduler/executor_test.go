@@ -0,0 +1,117 @@
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/audit"
+	"github.com/fentz26/neona/internal/connectors"
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+// exitConnector fails commands named "false" and remembers what was fed
+// to each command's stdin.
+type exitConnector struct {
+	mockConnector
+	mu    sync.Mutex
+	stdin []string
+}
+
+func (c *exitConnector) Execute(ctx context.Context, cmd string, args []string) (*connectors.ExecResult, error) {
+	c.mu.Lock()
+	c.stdin = append(c.stdin, string(connectors.InputFromContext(ctx).Stdin))
+	c.mu.Unlock()
+	res := &connectors.ExecResult{Command: cmd, Args: args}
+	if cmd == "false" {
+		res.ExitCode = 1
+	}
+	return res, nil
+}
+
+func TestExecutors(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	conn := &exitConnector{mockConnector: mockConnector{name: "test"}}
+	cfg := &Config{GlobalMax: 5, ByConnector: map[string]int{"test": 5}, PollIntervalMs: 50}
+	sch := New(s, audit.NewPDRWriter(s), conn, cfg)
+
+	create := func(title string, opts store.TaskOptions) *models.Task {
+		t.Helper()
+		task, err := s.CreateTaskWithOptions(title, "", opts)
+		if err != nil {
+			t.Fatalf("CreateTask failed: %v", err)
+		}
+		return task
+	}
+	build := create("Build", store.TaskOptions{Commands: []string{"make build", "make test"}})
+	broken := create("Broken", store.TaskOptions{Commands: []string{"false", "make test"}})
+	pipeline := create("Pipeline", store.TaskOptions{Steps: []models.RunStep{
+		{Command: "false", ContinueOnError: true},
+		{Command: "make", Args: []string{"test"}},
+	}})
+	rollback := create("Rollback", store.TaskOptions{Steps: []models.RunStep{
+		{Name: "deploy", Command: "false"},
+		{Command: "make", Args: []string{"smoke"}},
+		{Command: "rollback", Args: []string{"{{deploy.exit_code}}"}, When: "failure"},
+	}})
+	unknown := create("Unknown", store.TaskOptions{Commands: []string{"make"}, Labels: []string{ExecutorLabel + "robot"}})
+	manual := create("Write docs", store.TaskOptions{})
+
+	waitFor := func(task *models.Task, want models.TaskStatus) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if got, _ := s.GetTask(task.ID); got.Status == want {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		got, _ := s.GetTask(task.ID)
+		t.Fatalf("Task %q is %s, want %s", task.Title, got.Status, want)
+	}
+
+	sch.Start()
+	waitFor(build, models.TaskStatusCompleted)
+	waitFor(broken, models.TaskStatusFailed)
+	waitFor(pipeline, models.TaskStatusCompleted)
+	waitFor(rollback, models.TaskStatusFailed)
+	waitFor(unknown, models.TaskStatusFailed)
+	sch.Stop()
+
+	if runs, _ := s.GetRunsForTask(build.ID); len(runs) != 2 {
+		t.Errorf("Expected a run per command, got %d", len(runs))
+	}
+	if runs, _ := s.GetRunsForTask(broken.ID); len(runs) != 1 || runs[0].ExitCode != 1 {
+		t.Errorf("Expected the commands to stop at the failure, got %+v", runs)
+	}
+	if runs, _ := s.GetRunsForTask(pipeline.ID); len(runs) != 2 {
+		t.Errorf("Expected the pipeline to continue past the failed step, got %d runs", len(runs))
+	}
+	if runs, _ := s.GetRunsForTask(rollback.ID); len(runs) != 2 || runs[0].Command != "rollback" || runs[0].Args[0] != "1" {
+		t.Errorf("Expected only the failure step to run after the failure, got %+v", runs)
+	}
+	// Without an agent executor, tasks without commands are left to others
+	if got, _ := s.GetTask(manual.ID); got.Status != models.TaskStatusPending {
+		t.Fatalf("Expected the task without commands left pending, got %s", got.Status)
+	}
+
+	sch.AddExecutor(&AgentExecutor{Conn: conn, Runs: s, Command: "agent", Args: []string{"-p"}})
+	sch.Start()
+	defer sch.Stop()
+	waitFor(manual, models.TaskStatusCompleted)
+
+	runs, _ := s.GetRunsForTask(manual.ID)
+	if len(runs) != 1 || runs[0].Command != "agent" {
+		t.Errorf("Expected the agent run recorded, got %+v", runs)
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if last := conn.stdin[len(conn.stdin)-1]; !strings.Contains(last, "Write docs") {
+		t.Errorf("Expected the task fed to the agent, got %q", last)
+	}
+}
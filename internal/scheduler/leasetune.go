@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// LeaseTuning has the scheduler pick each worker's lease TTL from how long
+// recent tasks with the same labels ran, instead of the fixed TTL: the
+// 95th percentile of their run time, with a margin. Long tasks get leases
+// that survive a missed heartbeat or two, short ones leases that free the
+// task soon after a crash. Tasks without labels, or whose labels have too
+// little history, keep the fixed TTL.
+type LeaseTuning struct {
+	// Samples is how many of a label's latest finished tasks are looked at.
+	Samples int
+	// MinSamples is how many finished tasks with runs a label needs before
+	// its history is trusted.
+	MinSamples int
+	// Margin multiplies the 95th percentile.
+	Margin float64
+	// MinTTLSec and MaxTTLSec bound the tuned TTL; 0 leaves it unbounded.
+	MinTTLSec int
+	MaxTTLSec int
+}
+
+// DefaultLeaseTuning returns the tuning enabled by neona daemon
+// --lease-autotune, bounded at maxTTLSec when it is positive.
+func DefaultLeaseTuning(maxTTLSec int) *LeaseTuning {
+	return &LeaseTuning{
+		Samples:    50,
+		MinSamples: 5,
+		Margin:     1.5,
+		MinTTLSec:  30,
+		MaxTTLSec:  maxTTLSec,
+	}
+}
+
+// SetLeaseTuning tunes worker lease TTLs from run history; nil keeps them
+// at the fixed TTL.
+// Must be called before Start() - not safe for concurrent use.
+func (sch *Scheduler) SetLeaseTuning(t *LeaseTuning) {
+	sch.leaseTuning = t
+}
+
+// percentile95 returns the 95th percentile of durations, sorting them.
+func percentile95(durations []time.Duration) time.Duration {
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	i := int(math.Ceil(float64(len(durations))*0.95)) - 1
+	if i < 0 {
+		i = 0
+	}
+	return durations[i]
+}
+
+// tunedLeaseTTL returns the lease TTL for task from the history of its
+// labels, the longest if it has several, or 0 when there is not enough.
+func (sch *Scheduler) tunedLeaseTTL(task *models.Task) int {
+	t := sch.leaseTuning
+	if t == nil {
+		return 0
+	}
+	ttl := 0
+	for _, label := range task.Labels {
+		durations, err := sch.store.TaskRunDurations(label, t.Samples)
+		if err != nil {
+			log.Printf("Error reading run history of label %s: %v", label, err)
+			continue
+		}
+		if len(durations) == 0 || len(durations) < t.MinSamples {
+			continue
+		}
+		p95 := percentile95(durations)
+		if sec := int(math.Ceil(p95.Seconds() * t.Margin)); sec > ttl {
+			ttl = sec
+		}
+	}
+	if ttl == 0 {
+		return 0
+	}
+	if ttl < t.MinTTLSec {
+		ttl = t.MinTTLSec
+	}
+	if t.MaxTTLSec > 0 && ttl > t.MaxTTLSec {
+		ttl = t.MaxTTLSec
+	}
+	return ttl
+}
+
+// tuneLease re-times a freshly claimed lease to the task's tuned TTL, if
+// it has one.
+func (sch *Scheduler) tuneLease(task *models.Task, lease *models.Lease) {
+	ttl := sch.tunedLeaseTTL(task)
+	if ttl == 0 || ttl == lease.TTLSec {
+		return
+	}
+	if err := sch.store.SetLeaseTTL(lease.ID, ttl); err != nil {
+		log.Printf("Error tuning lease of task %s: %v", task.ID, err)
+		return
+	}
+	lease.ExpiresAt = lease.ExpiresAt.Add(time.Duration(ttl-lease.TTLSec) * time.Second)
+	lease.TTLSec = ttl
+	log.Printf("Lease of task %s tuned to %ds from the run history of its labels", task.ID, ttl)
+}
@@ -25,7 +25,7 @@ func Test10ParallelWorkers(t *testing.T) {
 	}
 	
 	sch := New(s, pdr, conn, cfg)
-	sch.workerDuration = 15 * time.Second // Long enough to keep all 10 tasks claimed simultaneously
+	simulate(sch, 15*time.Second) // Long enough to keep all 10 tasks claimed simultaneously
 	
 	// Create exactly 10 tasks
 	numTasks := 10
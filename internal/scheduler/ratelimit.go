@@ -0,0 +1,233 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit configures a token bucket that allows Burst dispatches at once,
+// refilled at PerMinute dispatches per minute.
+type RateLimit struct {
+	PerMinute int `yaml:"per_minute"`
+	Burst     int `yaml:"burst"`
+}
+
+// ParseRateLimit parses a limit written as PER_MINUTE or PER_MINUTE:BURST,
+// e.g. "30:5" for 30 dispatches a minute in bursts of up to 5.
+func ParseRateLimit(spec string) (RateLimit, error) {
+	perMinute, burst, hasBurst := strings.Cut(strings.TrimSpace(spec), ":")
+	var limit RateLimit
+	var err error
+	if limit.PerMinute, err = strconv.Atoi(perMinute); err != nil || limit.PerMinute < 1 {
+		return RateLimit{}, fmt.Errorf("rate limit %q: the rate must be a whole number of dispatches per minute, at least 1", spec)
+	}
+	if hasBurst {
+		if limit.Burst, err = strconv.Atoi(burst); err != nil || limit.Burst < 1 {
+			return RateLimit{}, fmt.Errorf("rate limit %q: the burst must be a whole number, at least 1", spec)
+		}
+	}
+	return limit, nil
+}
+
+// ParseRateLimits parses per-connector limits written as
+// CONNECTOR=PER_MINUTE[:BURST], keyed by connector name.
+func ParseRateLimits(specs []string) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit, len(specs))
+	for _, spec := range specs {
+		name, value, ok := strings.Cut(spec, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("rate limit %q: want CONNECTOR=PER_MINUTE[:BURST]", spec)
+		}
+		limit, err := ParseRateLimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("connector %s: %w", name, err)
+		}
+		limits[name] = limit
+	}
+	return limits, nil
+}
+
+// enabled reports whether the limit is configured.
+func (r RateLimit) enabled() bool {
+	return r.PerMinute > 0
+}
+
+// burst returns the bucket capacity, defaulting to one dispatch.
+func (r RateLimit) burst() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return 1
+}
+
+// LimiterState is a snapshot of a rate limiter for stats reporting.
+type LimiterState struct {
+	PerMinute int     `json:"per_minute"`
+	Burst     int     `json:"burst"`
+	Tokens    float64 `json:"tokens"`
+}
+
+// tokenBucket is a simple token bucket. It is not safe for concurrent use.
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: limit.burst(), last: now}
+}
+
+// refill adds tokens accrued since the last update.
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Minutes()
+	if elapsed > 0 {
+		b.tokens += elapsed * float64(b.limit.PerMinute)
+		if capacity := b.limit.burst(); b.tokens > capacity {
+			b.tokens = capacity
+		}
+	}
+	b.last = now
+}
+
+// available returns the number of whole dispatches allowed right now.
+func (b *tokenBucket) available(now time.Time) int {
+	b.refill(now)
+	return int(b.tokens)
+}
+
+// take consumes one token, returning false if none is available.
+func (b *tokenBucket) take(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// full reports whether the bucket has refilled completely.
+func (b *tokenBucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.limit.burst()
+}
+
+func (b *tokenBucket) state(now time.Time) LimiterState {
+	b.refill(now)
+	return LimiterState{
+		PerMinute: b.limit.PerMinute,
+		Burst:     int(b.limit.burst()),
+		Tokens:    b.tokens,
+	}
+}
+
+// rateLimiter tracks dispatch buckets per connector and per task.
+type rateLimiter struct {
+	mu         sync.Mutex
+	config     *Config
+	connectors map[string]*tokenBucket
+	tasks      map[string]*tokenBucket
+	now        func() time.Time
+}
+
+func newRateLimiter(cfg *Config) *rateLimiter {
+	return &rateLimiter{
+		config:     cfg,
+		connectors: make(map[string]*tokenBucket),
+		tasks:      make(map[string]*tokenBucket),
+		now:        time.Now,
+	}
+}
+
+// connectorBucket returns the bucket for a connector, or nil if it is unlimited.
+// Caller must hold mu.
+func (l *rateLimiter) connectorBucket(name string) *tokenBucket {
+	limit, ok := l.config.RateLimits[name]
+	if !ok || !limit.enabled() {
+		return nil
+	}
+	b, ok := l.connectors[name]
+	if !ok {
+		b = newTokenBucket(limit, l.now())
+		l.connectors[name] = b
+	}
+	return b
+}
+
+// connectorAllowance returns how many dispatches the connector may make now,
+// or -1 if it is unlimited.
+func (l *rateLimiter) connectorAllowance(name string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.connectorBucket(name)
+	if b == nil {
+		return -1
+	}
+	return b.available(l.now())
+}
+
+// throttledTasks returns the IDs of tasks that have exhausted their per-task
+// budget, pruning buckets that have fully refilled.
+func (l *rateLimiter) throttledTasks() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var ids []string
+	for id, b := range l.tasks {
+		if b.full(now) {
+			delete(l.tasks, id)
+			continue
+		}
+		if b.available(now) < 1 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// recordDispatch consumes tokens for a dispatch of taskID on a connector.
+func (l *rateLimiter) recordDispatch(connector, taskID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if b := l.connectorBucket(connector); b != nil {
+		b.take(now)
+	}
+	if l.config.TaskRateLimit.enabled() {
+		b, ok := l.tasks[taskID]
+		if !ok {
+			b = newTokenBucket(l.config.TaskRateLimit, now)
+			l.tasks[taskID] = b
+		}
+		b.take(now)
+	}
+}
+
+// stats returns a snapshot of connector limiters and the number of throttled tasks.
+func (l *rateLimiter) stats() (map[string]LimiterState, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	states := make(map[string]LimiterState)
+	for name := range l.config.RateLimits {
+		if b := l.connectorBucket(name); b != nil {
+			states[name] = b.state(now)
+		}
+	}
+
+	throttled := 0
+	for _, b := range l.tasks {
+		if b.available(now) < 1 {
+			throttled++
+		}
+	}
+	return states, throttled
+}
@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/audit"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+	b := newTokenBucket(RateLimit{PerMinute: 60, Burst: 2}, start)
+
+	if !b.take(start) || !b.take(start) {
+		t.Fatal("Expected burst of 2 to be available")
+	}
+	if b.take(start) {
+		t.Fatal("Expected bucket to be empty after burst")
+	}
+
+	// 60/min refills one token per second
+	if !b.take(start.Add(time.Second)) {
+		t.Error("Expected a token after one second")
+	}
+	if got := b.available(start.Add(time.Hour)); got != 2 {
+		t.Errorf("Expected refill to cap at burst 2, got %d", got)
+	}
+}
+
+func TestSchedulerConnectorRateLimit(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	pdr := audit.NewPDRWriter(s)
+	conn := &mockConnector{name: "test"}
+
+	for i := 0; i < 5; i++ {
+		if _, err := s.CreateTask("Task", "Description"); err != nil {
+			t.Fatalf("Failed to create task: %v", err)
+		}
+	}
+
+	cfg := &Config{
+		GlobalMax:   5,
+		ByConnector: map[string]int{"test": 5},
+		RateLimits: map[string]RateLimit{
+			"test": {PerMinute: 1, Burst: 2},
+		},
+	}
+	sch := New(s, pdr, conn, cfg)
+	simulate(sch, 10*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		sch.workerWG.Wait()
+	}()
+	sch.pollAndDispatch(ctx, ctx)
+	sch.pollAndDispatch(ctx, ctx)
+
+	stats := sch.GetStats()
+	if got := stats["active_workers"].(int); got != 2 {
+		t.Errorf("Expected rate limit to cap dispatch at 2, got %d", got)
+	}
+	limits := stats["rate_limits"].(map[string]LimiterState)
+	if state, ok := limits["test"]; !ok || state.Tokens >= 1 {
+		t.Errorf("Expected exhausted limiter state for connector, got %+v", limits)
+	}
+}
+
+func TestRateLimiterThrottlesTasks(t *testing.T) {
+	l := newRateLimiter(&Config{TaskRateLimit: RateLimit{PerMinute: 1}})
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	l.recordDispatch("test", "task-1")
+	if got := l.throttledTasks(); len(got) != 1 || got[0] != "task-1" {
+		t.Fatalf("Expected task-1 to be throttled, got %v", got)
+	}
+
+	// Once the bucket refills the task is released and pruned
+	now = now.Add(time.Minute)
+	if got := l.throttledTasks(); len(got) != 0 {
+		t.Errorf("Expected no throttled tasks after refill, got %v", got)
+	}
+	if len(l.tasks) != 0 {
+		t.Errorf("Expected refilled bucket to be pruned, got %d", len(l.tasks))
+	}
+}
+
+func TestParseRateLimits(t *testing.T) {
+	limits, err := ParseRateLimits([]string{"localexec=30:5", "test=2"})
+	if err != nil {
+		t.Fatalf("ParseRateLimits: %v", err)
+	}
+	if got := limits["localexec"]; got != (RateLimit{PerMinute: 30, Burst: 5}) {
+		t.Errorf("localexec = %+v, want 30/min bursts of 5", got)
+	}
+	if got := limits["test"]; got != (RateLimit{PerMinute: 2}) {
+		t.Errorf("test = %+v, want 2/min with the default burst", got)
+	}
+
+	for _, spec := range []string{"localexec", "=30", "localexec=", "localexec=0", "localexec=x:2", "localexec=30:0", "localexec=30:y"} {
+		if _, err := ParseRateLimits([]string{spec}); err == nil {
+			t.Errorf("ParseRateLimits(%q) succeeded, want an error", spec)
+		}
+	}
+	if _, err := ParseRateLimit("-1"); err == nil {
+		t.Error("ParseRateLimit(-1) succeeded, want an error")
+	}
+}
+
+func TestSchedulerParsedRateLimits(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.CreateTask("Task", "Description"); err != nil {
+			t.Fatalf("Failed to create task: %v", err)
+		}
+	}
+
+	// Limits as the daemon builds them from --rate-limit and --task-rate-limit
+	cfg := &Config{GlobalMax: 5, ByConnector: map[string]int{"test": 5}}
+	var err error
+	if cfg.RateLimits, err = ParseRateLimits([]string{"test=1"}); err != nil {
+		t.Fatalf("ParseRateLimits: %v", err)
+	}
+	if cfg.TaskRateLimit, err = ParseRateLimit("1"); err != nil {
+		t.Fatalf("ParseRateLimit: %v", err)
+	}
+	sch := New(s, audit.NewPDRWriter(s), &mockConnector{name: "test"}, cfg)
+	simulate(sch, 10*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		sch.workerWG.Wait()
+	}()
+	sch.pollAndDispatch(ctx, ctx)
+
+	stats := sch.GetStats()
+	if got := stats["active_workers"].(int); got != 1 {
+		t.Errorf("Expected the parsed limit to cap dispatch at 1, got %d", got)
+	}
+	if state, ok := stats["rate_limits"].(map[string]LimiterState)["test"]; !ok || state.PerMinute != 1 || state.Burst != 1 {
+		t.Errorf("Expected the parsed limit in stats, got %+v", stats["rate_limits"])
+	}
+}
@@ -3,19 +3,36 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"runtime/debug"
 	"sync"
 	"time"
 
 	"github.com/fentz26/neona/internal/audit"
+	"github.com/fentz26/neona/internal/clock"
 	"github.com/fentz26/neona/internal/connectors"
+	"github.com/fentz26/neona/internal/crash"
 	"github.com/fentz26/neona/internal/mcp"
 	"github.com/fentz26/neona/internal/models"
 	"github.com/fentz26/neona/internal/store"
 	"github.com/google/uuid"
 )
 
+// defaultLeaseTTLSec is the lease (and mutex lock) TTL given to scheduler workers.
+// Workers renew it every half TTL while they run.
+const defaultLeaseTTLSec = 300
+
+// Persisted worker states.
+const (
+	// workerStateRunning marks a worker that was in flight when last seen.
+	// Finding one at startup means the daemon died without shutting down.
+	workerStateRunning = "running"
+	// workerStateInterrupted marks a worker that was stopped before finishing.
+	workerStateInterrupted = "interrupted"
+)
+
 // WorkerInfo contains details about an active worker.
 type WorkerInfo struct {
 	WorkerID      string    `json:"worker_id"`
@@ -25,6 +42,20 @@ type WorkerInfo struct {
 	LeaseExpires  time.Time `json:"lease_expires"`
 	StartedAt     time.Time `json:"started_at"`
 	ConnectorName string    `json:"connector_name"`
+	MutexKey      string    `json:"mutex_key,omitempty"`
+	// Routing is the MCP routing decision for the task, when a router is set.
+	Routing *WorkerRouting `json:"routing,omitempty"`
+}
+
+// WorkerRouting records which MCP servers were selected for a worker's task
+// and why, so clients can see where a worker's tools came from.
+type WorkerRouting struct {
+	MCPs           []string `json:"mcps"`
+	MatchedRules   []string `json:"matched_rules"`
+	TotalTools     int      `json:"total_tools"`
+	Strategy       string   `json:"strategy,omitempty"`
+	Cached         bool     `json:"cached,omitempty"`
+	FallbackReason string   `json:"fallback_reason,omitempty"`
 }
 
 // Scheduler manages task dispatching and worker pools.
@@ -35,123 +66,401 @@ type Scheduler struct {
 	config    *Config
 
 	// MCP router for tool selection
-	mcpRouter *mcp.KeywordRouter
+	mcpRouter mcp.Router
+
+	// Executors carrying out claimed tasks, by name
+	executors map[string]Executor
+
+	// Dispatch rate limiting
+	limiter *rateLimiter
+
+	// Claim attempts that found a task, for contention telemetry
+	claims store.ClaimCounter
+
+	// clock stamps worker start and lease expiry times
+	clock clock.Clock
+
+	// crash, if set, writes a report for each recovered panic
+	crash *crash.Reporter
+
+	// instanceID stamps the worker records of this daemon, so Recover
+	// leaves those of other daemons sharing the database alone
+	instanceID string
 
 	// Worker pool state
 	mu              sync.Mutex
 	activeWorkers   int
 	connectorCounts map[string]int
+	labelCounts     map[string]int         // running tasks by limited label
 	workers         map[string]*WorkerInfo // Track per-worker details
 
-	// Control
-	ctx    context.Context
-	cancel context.CancelFunc
-	wg     sync.WaitGroup
+	// Control. lifecycleMu serializes Start/Stop/Drain; running is guarded by mu
+	// so GetStats can report it without blocking on a shutdown in progress.
+	lifecycleMu sync.Mutex
+	running     bool
+	state       string
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+
+	// Workers run under their own context so that shutdown can stop
+	// dispatching while letting in-flight work drain.
+	workerCancel context.CancelFunc
+	workerWG     sync.WaitGroup
+
+	// leaseTuning picks lease TTLs from run history when set
+	leaseTuning *LeaseTuning
 
 	// Test configuration
-	workerDuration time.Duration
+	leaseTTLSec int
+	// heartbeatEvery overrides the half-TTL heartbeat interval when set
+	heartbeatEvery time.Duration
 }
 
+// Scheduler states reported by GetStats. A draining scheduler dispatches
+// nothing new while its in-flight workers finish.
+const (
+	StateStopped  = "stopped"
+	StateRunning  = "running"
+	StateDraining = "draining"
+	StateDrained  = "drained"
+)
+
 // New creates a new scheduler.
 func New(s *store.Store, pdr *audit.PDRWriter, conn connectors.Connector, cfg *Config) *Scheduler {
 	if cfg == nil {
 		cfg = DefaultConfig()
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-
-	return &Scheduler{
+	sch := &Scheduler{
 		store:           s,
 		pdr:             pdr,
 		connector:       conn,
 		config:          cfg,
+		executors:       make(map[string]Executor),
 		connectorCounts: make(map[string]int),
+		labelCounts:     make(map[string]int),
 		workers:         make(map[string]*WorkerInfo),
-		ctx:             ctx,
-		cancel:          cancel,
-		workerDuration:  5 * time.Second, // Default duration
+		limiter:         newRateLimiter(cfg),
+		state:           StateStopped,
+		leaseTTLSec:     defaultLeaseTTLSec,
+		clock:           clock.Real,
 	}
+	sch.AddExecutor(&ConnectorExecutor{Conn: conn, Runs: s})
+	return sch
+}
+
+// AddExecutor registers an executor, replacing any of the same name. The
+// scheduler starts with a ConnectorExecutor; until an ExecutorAgent is
+// added, it dispatches only tasks with commands and leaves the rest to
+// external workers.
+// Must be called before Start() - not safe for concurrent use.
+func (sch *Scheduler) AddExecutor(e Executor) {
+	sch.executors[e.Name()] = e
+}
+
+// SetRunner makes the scheduler's connector executor run commands through
+// r, so they are checked and recorded like runs made through the API. Add
+// executors of other kinds with their Runner set as well.
+// Must be called before Start() - not safe for concurrent use.
+func (sch *Scheduler) SetRunner(r TaskRunner) {
+	sch.AddExecutor(&ConnectorExecutor{Conn: sch.connector, Runs: sch.store, Runner: r})
+}
+
+// SetClock replaces the clock stamping worker start and lease expiry
+// times. It should be the store's clock.
+// Must be called before Start() - not safe for concurrent use.
+func (sch *Scheduler) SetClock(c clock.Clock) {
+	sch.clock = c
+}
+
+// SetCrashReporter writes a crash report for each panic the scheduler
+// recovers from: in an executor, which fails the task, or in a dispatch
+// pass, which is skipped.
+// Must be called before Start() - not safe for concurrent use.
+func (sch *Scheduler) SetCrashReporter(r *crash.Reporter) {
+	sch.crash = r
+}
+
+// SetInstanceID names the daemon the scheduler runs in. It should stay the
+// same across restarts, and differ between daemons whose schedulers share a
+// database, so that each recovers only its own workers.
+// Must be called before Start() - not safe for concurrent use.
+func (sch *Scheduler) SetInstanceID(id string) {
+	sch.instanceID = id
+}
+
+// SetLeaseTTL sets the TTL of the leases (and mutex locks) scheduler
+// workers take, renewed every half of it.
+// Must be called before Start() - not safe for concurrent use.
+func (sch *Scheduler) SetLeaseTTL(ttlSec int) {
+	sch.leaseTTLSec = ttlSec
 }
 
 // SetMCPRouter sets the MCP router for tool selection.
 // Must be called before Start() - not safe for concurrent use.
-func (sch *Scheduler) SetMCPRouter(router *mcp.KeywordRouter) {
+func (sch *Scheduler) SetMCPRouter(router mcp.Router) {
 	sch.mcpRouter = router
 }
 
-// Start begins the scheduler loop.
+// Start begins the scheduler loop. It is a no-op if the scheduler is already
+// running, and may be called again after Stop or Drain.
 func (sch *Scheduler) Start() {
+	sch.lifecycleMu.Lock()
+	defer sch.lifecycleMu.Unlock()
+
 	sch.mu.Lock()
-	if sch.ctx.Err() != nil {
-		sch.mu.Unlock()
-		return
-	}
-	// Prevent double-start by checking whether a loop is already active.
-	// (A dedicated boolean flag is recommended if Start/Stop cycles are needed.)
-	if sch.activeWorkers < 0 { // sentinel: never true; replace with a real `running` flag in struct
+	if sch.running {
 		sch.mu.Unlock()
 		return
 	}
+	sch.running = true
+	sch.state = StateRunning
 	sch.mu.Unlock()
 
+	// Fresh contexts on every start so a stopped scheduler can be restarted
+	ctx, cancel := context.WithCancel(context.Background())
+	workerCtx, workerCancel := context.WithCancel(context.Background())
+	sch.cancel = cancel
+	sch.workerCancel = workerCancel
+
 	sch.wg.Add(1)
-	go sch.schedulerLoop()
+	go sch.schedulerLoop(ctx, workerCtx)
 	log.Println("Scheduler started")
 }
 
-// Stop gracefully stops the scheduler.
+// Stop stops the scheduler immediately, interrupting any in-flight workers.
 func (sch *Scheduler) Stop() {
+	sch.lifecycleMu.Lock()
+	defer sch.lifecycleMu.Unlock()
+
+	if !sch.IsRunning() {
+		return
+	}
+
 	sch.cancel()
 	sch.wg.Wait()
+	sch.workerCancel()
+	sch.workerWG.Wait()
+	sch.setStopped(StateStopped)
 	log.Println("Scheduler stopped")
 }
 
+// Drain stops dispatching new tasks and waits up to timeout for in-flight
+// workers to finish. Workers still running when the timeout elapses are
+// interrupted and persisted so Recover can requeue their tasks on the next start.
+func (sch *Scheduler) Drain(timeout time.Duration) {
+	sch.lifecycleMu.Lock()
+	defer sch.lifecycleMu.Unlock()
+
+	if !sch.IsRunning() {
+		return
+	}
+
+	sch.mu.Lock()
+	sch.state = StateDraining
+	sch.mu.Unlock()
+	sch.cancel()
+	sch.wg.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		sch.workerWG.Wait()
+		close(done)
+	}()
+
+	sch.mu.Lock()
+	inFlight := sch.activeWorkers
+	sch.mu.Unlock()
+	if inFlight > 0 {
+		log.Printf("Draining %d in-flight workers (timeout %s)...", inFlight, timeout)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Printf("Drain timeout elapsed, interrupting remaining workers")
+		sch.workerCancel()
+		<-done
+	}
+	sch.workerCancel()
+	sch.setStopped(StateDrained)
+	log.Println("Scheduler drained")
+}
+
+// IsRunning reports whether the scheduler loop is active.
+func (sch *Scheduler) IsRunning() bool {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	return sch.running
+}
+
+func (sch *Scheduler) setStopped(state string) {
+	sch.mu.Lock()
+	sch.running = false
+	sch.state = state
+	sch.mu.Unlock()
+}
+
+// Recover reconciles tasks left behind by this daemon's previous workers.
+// Workers interrupted during a graceful shutdown and workers that were still
+// running when the daemon died are both requeued, with a PDR entry recorded
+// for each. Workers of other instances are left to them; records written
+// before workers were stamped with an instance are taken as this daemon's.
+// It should be called before Start and returns the number of tasks
+// requeued.
+func (sch *Scheduler) Recover() (int, error) {
+	records, err := sch.store.ListWorkerRecords("")
+	if err != nil {
+		return 0, err
+	}
+
+	requeued := 0
+	for _, rec := range records {
+		if rec.InstanceID != "" && rec.InstanceID != sch.instanceID {
+			continue
+		}
+		// Tasks finished or claimed by someone else since are left alone
+		_, err := sch.store.ReleaseTask(rec.TaskID, store.ReleaseOptions{HolderID: rec.WorkerID})
+		if err != nil && err != store.ErrTaskNotClaimed && err != store.ErrNotHolder {
+			return requeued, err
+		}
+		if err == nil {
+			requeued++
+
+			action, reason := "task.requeue", "interrupted at shutdown"
+			if rec.State == workerStateRunning {
+				action, reason = "task.recover", "orphaned by daemon crash"
+			}
+			sch.pdr.Record(action, map[string]interface{}{
+				"task_id":   rec.TaskID,
+				"worker_id": rec.WorkerID,
+				"lease_id":  rec.LeaseID,
+			}, "success", rec.TaskID, fmt.Sprintf("Requeued task %s on worker %s", reason, rec.WorkerID))
+			log.Printf("Requeued task %s (%s on worker %s)", rec.TaskID, reason, rec.WorkerID)
+		}
+		if err := sch.store.DeleteLeasesForHolder(rec.WorkerID); err != nil {
+			return requeued, err
+		}
+		if err := sch.store.ReleaseLocksForHolder(rec.WorkerID); err != nil {
+			return requeued, err
+		}
+		if err := sch.store.DeleteWorkerRecord(rec.WorkerID); err != nil {
+			return requeued, err
+		}
+	}
+	return requeued, nil
+}
+
 // schedulerLoop polls for pending tasks and dispatches them to workers.
-func (sch *Scheduler) schedulerLoop() {
+func (sch *Scheduler) schedulerLoop(ctx, workerCtx context.Context) {
 	defer sch.wg.Done()
 
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+	// A timer rather than a ticker so every cycle gets fresh jitter
+	timer := time.NewTimer(sch.config.NextPollDelay())
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-sch.ctx.Done():
+		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			sch.pollAndDispatch()
+		case <-timer.C:
+			sch.safePollAndDispatch(ctx, workerCtx)
+			timer.Reset(sch.config.NextPollDelay())
 		}
 	}
 }
 
-// pollAndDispatch checks for pending tasks and dispatches them to workers.
-func (sch *Scheduler) pollAndDispatch() {
-	// Check if we have capacity for more workers
-	sch.mu.Lock()
-	if sch.activeWorkers >= sch.config.GlobalMax {
-		sch.mu.Unlock()
-		return
+// safePollAndDispatch is pollAndDispatch recovering from a panic, so one
+// bad pass does not take the daemon down.
+func (sch *Scheduler) safePollAndDispatch(ctx, workerCtx context.Context) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			sch.crash.Capture("scheduler dispatch", rec, debug.Stack())
+		}
+	}()
+	sch.pollAndDispatch(ctx, workerCtx)
+}
+
+// pollAndDispatch checks for pending tasks and dispatches as many as the
+// available capacity allows in a single pass.
+func (sch *Scheduler) pollAndDispatch(ctx, workerCtx context.Context) {
+	claims := sch.availableCapacity()
+	if limit := sch.config.MaxClaimsPerCycle; limit > 0 && claims > limit {
+		claims = limit
+	}
+	if allowance := sch.limiter.connectorAllowance(sch.connector.Name()); allowance >= 0 && claims > allowance {
+		claims = allowance
 	}
 
+	for i := 0; i < claims; i++ {
+		if ctx.Err() != nil || !sch.dispatchOne(ctx, workerCtx) {
+			return
+		}
+	}
+}
+
+// availableCapacity returns how many more workers may start right now under
+// the global and per-connector limits.
+func (sch *Scheduler) availableCapacity() int {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+
+	capacity := sch.config.GlobalMax - sch.activeWorkers
 	connectorName := sch.connector.Name()
-	connectorLimit := sch.config.GetConnectorLimit(connectorName)
-	if sch.connectorCounts[connectorName] >= connectorLimit {
-		sch.mu.Unlock()
-		return
+	if c := sch.config.GetConnectorLimit(connectorName) - sch.connectorCounts[connectorName]; c < capacity {
+		capacity = c
 	}
-	sch.mu.Unlock()
+	if capacity < 0 {
+		return 0
+	}
+	return capacity
+}
+
+// dispatchOne claims a single pending task and starts a worker for it.
+// It returns false when there was nothing to claim or the claim failed.
+func (sch *Scheduler) dispatchOne(ctx, workerCtx context.Context) bool {
+	connectorName := sch.connector.Name()
 
 	// Attempt to atomically claim a task
 	workerID := uuid.New().String()
-	task, lease, err := sch.store.AtomicClaimTask(workerID, 300)
+	start := time.Now()
+	sch.mu.Lock()
+	saturated := sch.config.saturatedLabels(sch.labelCounts)
+	sch.mu.Unlock()
+	task, lease, err := sch.store.AtomicClaimNext(workerID, sch.leaseTTLSec, store.ClaimFilter{
+		Exclude:       sch.limiter.throttledTasks(),
+		ExcludeLabels: saturated,
+		Connector:     connectorName,
+		WithCommands:  sch.executors[ExecutorAgent] == nil,
+	})
+	if task == nil && err == nil {
+		// No pending tasks
+		return false
+	}
+	sch.claims.Record(start, errors.Is(err, store.ErrTaskAlreadyLeased))
 	if err != nil {
 		log.Printf("Error claiming task: %v", err)
-		return
+		return false
 	}
-	if task == nil {
-		// No pending tasks
-		return
+
+	sch.tuneLease(task, lease)
+
+	// Hold the task's mutex key for the lifetime of the worker
+	if task.MutexKey != "" {
+		_, err := sch.store.AcquireLock(store.MutexResourceID(task.MutexKey), workerID, "mutex", lease.TTLSec)
+		if err != nil {
+			// Lost a race with another holder of the key; hand the task back
+			log.Printf("Mutex %q unavailable for task %s: %v", task.MutexKey, task.ID, err)
+			// An agent may have released the task itself
+			if _, err := sch.store.ReleaseTask(task.ID, store.ReleaseOptions{HolderID: workerID}); err != nil && !errors.Is(err, store.ErrTaskNotClaimed) {
+				log.Printf("Error releasing task: %v", err)
+			}
+			return false
+		}
 	}
 
+	sch.limiter.recordDispatch(connectorName, task.ID)
+
 	// Emit PDR for dispatch
 	sch.pdr.Record("task.dispatch", map[string]interface{}{
 		"task_id":   task.ID,
@@ -160,13 +469,14 @@ func (sch *Scheduler) pollAndDispatch() {
 	}, "success", task.ID, fmt.Sprintf("Dispatched to worker %s", workerID))
 
 	// Route MCPs for this task if router is configured
+	var routing *WorkerRouting
 	if sch.mcpRouter != nil {
 		mcpTask := mcp.Task{
 			ID:          task.ID,
 			Title:       task.Title,
 			Description: task.Description,
 		}
-		result, err := sch.mcpRouter.Route(sch.ctx, mcpTask)
+		result, err := sch.mcpRouter.Route(ctx, mcpTask)
 		if err != nil {
 			log.Printf("MCP routing error for task %s: %v", task.ID, err)
 		} else {
@@ -180,80 +490,257 @@ func (sch *Scheduler) pollAndDispatch() {
 				"selected_mcps": mcpNames,
 				"total_tools":   result.TotalTools,
 				"matched_rules": result.MatchedRules,
-			}, "success", task.ID, fmt.Sprintf("Routed to %d MCPs with %d tools", len(mcpNames), result.TotalTools))
+				"strategy":      result.Strategy,
+				"cached":        result.Cached,
+				"fallback":      result.FallbackReason,
+			}, "success", task.ID, fmt.Sprintf("Routed to %d MCPs with %d tools by %s strategy", len(mcpNames), result.TotalTools, result.Strategy))
 			log.Printf("Task %s routed to MCPs: %v (%d tools)", task.ID, mcpNames, result.TotalTools)
+			routing = &WorkerRouting{
+				MCPs:           mcpNames,
+				MatchedRules:   append([]string{}, result.MatchedRules...),
+				TotalTools:     result.TotalTools,
+				Strategy:       result.Strategy,
+				Cached:         result.Cached,
+				FallbackReason: result.FallbackReason,
+			}
 		}
 	}
 
 	log.Printf("Dispatched task %s (%s) to worker %s", task.ID, task.Title, workerID)
 
 	// Increment worker counts and store worker info
+	startedAt := sch.clock.Now()
 	sch.mu.Lock()
 	sch.activeWorkers++
 	sch.connectorCounts[connectorName]++
+	sch.countLabels(task, 1)
 	sch.workers[workerID] = &WorkerInfo{
 		WorkerID:      workerID,
 		TaskID:        task.ID,
 		TaskTitle:     task.Title,
 		LeaseID:       lease.ID,
 		LeaseExpires:  lease.ExpiresAt,
-		StartedAt:     time.Now(),
+		StartedAt:     startedAt,
 		ConnectorName: connectorName,
+		MutexKey:      task.MutexKey,
+		Routing:       routing,
 	}
 	sch.mu.Unlock()
 
+	// Persist the worker so a crash leaves enough behind for Recover
+	if err := sch.store.SaveWorkerRecord(&models.WorkerRecord{
+		WorkerID:      workerID,
+		InstanceID:    sch.instanceID,
+		TaskID:        task.ID,
+		LeaseID:       lease.ID,
+		ConnectorName: connectorName,
+		State:         workerStateRunning,
+		StartedAt:     startedAt,
+	}); err != nil {
+		log.Printf("Error persisting worker %s: %v", workerID, err)
+	}
+
 	// Start worker in goroutine
-	sch.wg.Add(1)
-	go sch.runWorker(task, lease, workerID)
+	sch.workerWG.Add(1)
+	go sch.runWorker(workerCtx, task, lease, workerID)
+	return true
+}
+
+// countLabels adds delta to the running counts of task's limited labels.
+// Callers hold sch.mu.
+func (sch *Scheduler) countLabels(task *models.Task, delta int) {
+	for _, label := range task.Labels {
+		if _, ok := sch.config.ByLabel[label]; ok {
+			sch.labelCounts[label] += delta
+		}
+	}
 }
 
 // runWorker executes a task in a worker.
-func (sch *Scheduler) runWorker(task *models.Task, lease *models.Lease, workerID string) {
-	defer sch.wg.Done()
+func (sch *Scheduler) runWorker(ctx context.Context, task *models.Task, lease *models.Lease, workerID string) {
+	defer sch.workerWG.Done()
 	defer func() {
 		// Decrement worker counts and remove from tracking
 		sch.mu.Lock()
 		sch.activeWorkers--
 		sch.connectorCounts[sch.connector.Name()]--
+		sch.countLabels(task, -1)
 		delete(sch.workers, workerID)
 		sch.mu.Unlock()
 	}()
 
-	// If we exit early (cancel/error), make the task claimable again.
+	// If we exit early on error, make the task claimable again.
 	released := false
+	interrupted := false
 	defer func() {
+		if !interrupted {
+			if err := sch.store.DeleteWorkerRecord(workerID); err != nil {
+				log.Printf("Error deleting worker record: %v", err)
+			}
+		}
 		if released {
-			if err := sch.store.ReleaseTask(task.ID); err != nil {
+			if _, err := sch.store.ReleaseTask(task.ID, store.ReleaseOptions{HolderID: workerID}); err != nil {
 				log.Printf("Error releasing task: %v", err)
 			}
-		}
-		if err := sch.store.DeleteLease(lease.ID); err != nil {
+		} else if err := sch.store.DeleteLease(lease.ID); err != nil {
 			log.Printf("Error deleting lease: %v", err)
 		}
+		if task.MutexKey != "" {
+			if err := sch.store.ReleaseLocksForHolder(workerID); err != nil {
+				log.Printf("Error releasing mutex %q: %v", task.MutexKey, err)
+			}
+		}
 	}()
 
-	log.Printf("Worker %s holding task %s (%s)", workerID, task.ID, task.Title)
+	// Keep the lease alive while the worker runs; registered after the
+	// cleanup above so the heartbeat stops before the lease is deleted.
+	hbCtx, stopHeartbeat := context.WithCancel(ctx)
+	hbDone := make(chan struct{})
+	go func() {
+		defer close(hbDone)
+		sch.heartbeat(hbCtx, task, lease, workerID)
+	}()
+	defer func() {
+		stopHeartbeat()
+		<-hbDone
+	}()
 
-	select {
-	case <-sch.ctx.Done():
-		log.Printf("Worker %s interrupted, releasing task %s", workerID, task.ID)
+	name := executorName(task)
+	log.Printf("Worker %s running task %s (%s) on the %s executor", workerID, task.ID, task.Title, name)
+	var execErr error
+	if executor := sch.executors[name]; executor != nil {
+		execErr = sch.execute(ctx, executor, task)
+	} else {
+		execErr = fmt.Errorf("no %q executor", name)
+	}
+	if ctx.Err() != nil {
+		// Keep the claim and persist the worker so the task is requeued
+		// with a record on the next start instead of silently bouncing back.
+		log.Printf("Worker %s interrupted, persisting task %s for requeue", workerID, task.ID)
+		interrupted = true
+		sch.persistInterrupted(task, lease, workerID)
+		return
+	}
+
+	if errors.Is(execErr, ErrNotAccepted) {
+		log.Printf("Worker %s requeueing task %s: %v", workerID, task.ID, execErr)
+		sch.pdr.Record("task.requeue", map[string]interface{}{
+			"task_id":   task.ID,
+			"worker_id": workerID,
+			"executor":  name,
+		}, "requeued", task.ID, execErr.Error())
 		released = true
 		return
-	case <-time.After(sch.workerDuration):
-		// Work complete
 	}
 
-	if err := sch.store.UpdateTaskStatus(task.ID, models.TaskStatusCompleted); err != nil {
-		log.Printf("Error completing task %s: %v", task.ID, err)
+	status, outcome, details := models.TaskStatusCompleted, "success", "Executed by "+name
+	if execErr != nil {
+		status, outcome, details = models.TaskStatusFailed, "failed", execErr.Error()
+		log.Printf("Worker %s failed task %s: %v", workerID, task.ID, execErr)
+	}
+	sch.pdr.Record("task.execute", map[string]interface{}{
+		"task_id":   task.ID,
+		"worker_id": workerID,
+		"executor":  name,
+	}, outcome, task.ID, details)
+
+	if err := sch.store.UpdateTaskStatus(task.ID, status); err != nil {
+		log.Printf("Error finishing task %s: %v", task.ID, err)
 		released = true
 		return
 	}
 
-	log.Printf("Worker %s completed task %s", workerID, task.ID)
+	log.Printf("Worker %s finished task %s: %s", workerID, task.ID, status)
+}
+
+// execute runs a task on an executor, turning a panic into an error so the
+// worker fails the task and cleans up after itself.
+func (sch *Scheduler) execute(ctx context.Context, e Executor, task *models.Task) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			sch.crash.Capture(fmt.Sprintf("scheduler worker (%s executor, task %s)", e.Name(), task.ID), rec, debug.Stack())
+			err = fmt.Errorf("%s executor panicked: %v", e.Name(), rec)
+		}
+	}()
+	return e.Execute(ctx, task)
+}
+
+// heartbeat renews a worker's lease (and mutex lock) every half TTL until ctx is done.
+func (sch *Scheduler) heartbeat(ctx context.Context, task *models.Task, lease *models.Lease, workerID string) {
+	interval := time.Duration(lease.TTLSec) * time.Second / 2
+	if sch.heartbeatEvery > 0 {
+		interval = sch.heartbeatEvery
+	}
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := sch.store.RenewLease(lease.ID, lease.TTLSec); err != nil {
+				log.Printf("Worker %s failed to renew lease %s: %v", workerID, lease.ID, err)
+				continue
+			}
+			if task.MutexKey != "" {
+				if err := sch.store.RenewLocksForHolder(workerID, lease.TTLSec); err != nil {
+					log.Printf("Worker %s failed to renew mutex %q: %v", workerID, task.MutexKey, err)
+				}
+			}
+
+			expires := sch.clock.Now().Add(time.Duration(lease.TTLSec) * time.Second)
+			sch.mu.Lock()
+			if w, ok := sch.workers[workerID]; ok {
+				w.LeaseExpires = expires
+			}
+			sch.mu.Unlock()
+		}
+	}
+}
+
+// persistInterrupted records an interrupted worker for recovery on the next start.
+func (sch *Scheduler) persistInterrupted(task *models.Task, lease *models.Lease, workerID string) {
+	sch.mu.Lock()
+	startedAt := sch.clock.Now()
+	if info, ok := sch.workers[workerID]; ok {
+		startedAt = info.StartedAt
+	}
+	sch.mu.Unlock()
+
+	rec := &models.WorkerRecord{
+		WorkerID:      workerID,
+		InstanceID:    sch.instanceID,
+		TaskID:        task.ID,
+		LeaseID:       lease.ID,
+		ConnectorName: sch.connector.Name(),
+		State:         workerStateInterrupted,
+		StartedAt:     startedAt,
+	}
+	if err := sch.store.SaveWorkerRecord(rec); err != nil {
+		log.Printf("Error persisting worker %s: %v", workerID, err)
+		return
+	}
+	sch.pdr.Record("task.interrupt", map[string]interface{}{
+		"task_id":   task.ID,
+		"worker_id": workerID,
+	}, "interrupted", task.ID, "Worker interrupted during shutdown")
+}
+
+// LabelLimit is a label's concurrency limit and the tasks carrying it that
+// are running.
+type LabelLimit struct {
+	Limit   int `json:"limit"`
+	Running int `json:"running"`
 }
 
 // GetStats returns current scheduler statistics.
 func (sch *Scheduler) GetStats() map[string]interface{} {
+	rateLimits, throttledTasks := sch.limiter.stats()
+
 	sch.mu.Lock()
 	defer sch.mu.Unlock()
 
@@ -261,6 +748,10 @@ func (sch *Scheduler) GetStats() map[string]interface{} {
 	for k, v := range sch.connectorCounts {
 		connectorCounts[k] = v
 	}
+	labelLimits := make(map[string]LabelLimit)
+	for label, limit := range sch.config.ByLabel {
+		labelLimits[label] = LabelLimit{Limit: limit, Running: sch.labelCounts[label]}
+	}
 
 	// Copy workers list (deep copy to prevent external mutation and data races).
 	// The caller will encode this to JSON after the lock is released.
@@ -271,10 +762,16 @@ func (sch *Scheduler) GetStats() map[string]interface{} {
 	}
 
 	return map[string]interface{}{
+		"rate_limits":      rateLimits,
+		"throttled_tasks":  throttledTasks,
+		"running":          sch.running,
+		"state":            sch.state,
 		"active_workers":   sch.activeWorkers,
 		"global_max":       sch.config.GlobalMax,
 		"connector_counts": connectorCounts,
+		"label_limits":     labelLimits,
 		"workers":          workers,
+		"claims":           sch.claims.Stats(),
 	}
 }
 
@@ -8,7 +8,11 @@ import (
 	"time"
 
 	"github.com/fentz26/neona/internal/audit"
+	"github.com/fentz26/neona/internal/clock"
 	"github.com/fentz26/neona/internal/connectors"
+	"github.com/fentz26/neona/internal/crash"
+	"github.com/fentz26/neona/internal/mcp"
+	"github.com/fentz26/neona/internal/models"
 	"github.com/fentz26/neona/internal/store"
 )
 
@@ -35,6 +39,10 @@ func (m *mockConnector) IsAllowed(cmd string, args []string) bool {
 	return true
 }
 
+func (m *mockConnector) Capabilities() connectors.Capabilities {
+	return connectors.Capabilities{}
+}
+
 func TestAtomicClaim(t *testing.T) {
 	s := newTestStore(t)
 	defer s.Close()
@@ -107,6 +115,7 @@ func TestSchedulerConcurrencyLimits(t *testing.T) {
 	}
 	
 	sch := New(s, pdr, conn, cfg)
+	simulate(sch, 5*time.Second)
 	
 	// Create multiple pending tasks
 	for i := 0; i < 10; i++ {
@@ -153,6 +162,9 @@ hasWorkers:
 	if count := connectorCounts["test"]; count > cfg.ByConnector["test"] {
 		t.Errorf("Connector workers %d exceeds limit %d", count, cfg.ByConnector["test"])
 	}
+	if claims := stats["claims"].(store.ClaimStats); claims.Attempts < int64(activeWorkers) || claims.Conflicts != 0 {
+		t.Errorf("Expected a claim attempt per worker and no conflicts, got %+v", claims)
+	}
 }
 
 func TestSchedulerDispatchPDR(t *testing.T) {
@@ -170,6 +182,7 @@ func TestSchedulerDispatchPDR(t *testing.T) {
 	}
 	
 	sch := New(s, pdr, conn, cfg)
+	simulate(sch, 5*time.Second)
 	
 	// Create a task
 	task, err := s.CreateTask("Test Task", "Description")
@@ -213,7 +226,7 @@ func TestSchedulerNoDoubleClaim(t *testing.T) {
 	}
 	
 	sch := New(s, pdr, conn, cfg)
-	sch.workerDuration = 10 * time.Second // Long enough to keep tasks claimed
+	simulate(sch, 10*time.Second) // Long enough to keep tasks claimed
 	
 	// Create tasks
 	numTasks := 5
@@ -275,6 +288,443 @@ allClaimed:
 	}
 }
 
+func TestSchedulerDrainPersistsAndRecovers(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	pdr := audit.NewPDRWriter(s)
+	conn := &mockConnector{name: "test"}
+
+	cfg := &Config{
+		GlobalMax: 2,
+		ByConnector: map[string]int{
+			"test": 2,
+		},
+	}
+
+	sch := New(s, pdr, conn, cfg)
+	simulate(sch, 30*time.Second) // Outlive the drain timeout
+
+	task, err := s.CreateTask("Long Task", "Description")
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+
+	sch.Start()
+
+	timeout := time.After(10 * time.Second)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for sch.GetStats()["active_workers"].(int) == 0 {
+		select {
+		case <-timeout:
+			sch.Stop()
+			t.Fatalf("Timeout waiting for task to be dispatched")
+		case <-ticker.C:
+		}
+	}
+
+	sch.Drain(200 * time.Millisecond)
+	if state := sch.GetStats()["state"]; state != StateDrained {
+		t.Errorf("Expected state %s after Drain, got %v", StateDrained, state)
+	}
+
+	// The interrupted task keeps its claim and the worker is persisted
+	got, _ := s.GetTask(task.ID)
+	if got.Status != "claimed" {
+		t.Errorf("Expected interrupted task to stay claimed, got %s", got.Status)
+	}
+	records, err := s.ListWorkerRecords(workerStateInterrupted)
+	if err != nil {
+		t.Fatalf("ListWorkerRecords failed: %v", err)
+	}
+	if len(records) != 1 || records[0].TaskID != task.ID {
+		t.Fatalf("Expected 1 persisted worker for task %s, got %+v", task.ID, records)
+	}
+
+	// A fresh scheduler requeues the task on recovery
+	next := New(s, pdr, conn, cfg)
+	n, err := next.Recover()
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 requeued task, got %d", n)
+	}
+
+	got, _ = s.GetTask(task.ID)
+	if got.Status != "pending" || got.ClaimedBy != "" {
+		t.Errorf("Expected task to be pending and unclaimed, got %s (%s)", got.Status, got.ClaimedBy)
+	}
+	records, _ = s.ListWorkerRecords("")
+	if len(records) != 0 {
+		t.Errorf("Expected worker records to be cleared, got %d", len(records))
+	}
+}
+
+func TestSchedulerRecoverAfterCrash(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	pdr := audit.NewPDRWriter(s)
+	conn := &mockConnector{name: "test"}
+
+	// Simulate a worker that was mid-flight when the daemon died
+	if _, err := s.CreateTask("Orphaned Task", "Description"); err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	task, lease, err := s.AtomicClaimTask("dead-worker", 300)
+	if err != nil || task == nil {
+		t.Fatalf("Failed to claim task: %v", err)
+	}
+	if err := s.SaveWorkerRecord(&models.WorkerRecord{
+		WorkerID:      "dead-worker",
+		TaskID:        task.ID,
+		LeaseID:       lease.ID,
+		ConnectorName: "test",
+		State:         workerStateRunning,
+		StartedAt:     time.Now().UTC(),
+	}); err != nil {
+		t.Fatalf("SaveWorkerRecord failed: %v", err)
+	}
+
+	sch := New(s, pdr, conn, nil)
+	n, err := sch.Recover()
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 recovered task, got %d", n)
+	}
+
+	got, _ := s.GetTask(task.ID)
+	if got.Status != "pending" {
+		t.Errorf("Expected recovered task to be pending, got %s", got.Status)
+	}
+	if active, _ := s.GetActiveLease(task.ID); active != nil {
+		t.Errorf("Expected orphaned lease to be removed, got %s", active.ID)
+	}
+}
+
+func TestSchedulerStartStopCycles(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	pdr := audit.NewPDRWriter(s)
+	conn := &mockConnector{name: "test"}
+	sch := New(s, pdr, conn, nil)
+	simulate(sch, 10*time.Second)
+
+	if sch.IsRunning() {
+		t.Fatal("Expected new scheduler not to be running")
+	}
+
+	// Stop before Start must be a no-op
+	sch.Stop()
+
+	for i := 0; i < 2; i++ {
+		sch.Start()
+		sch.Start() // double start is ignored
+		if !sch.IsRunning() {
+			t.Fatalf("Cycle %d: expected scheduler to be running", i)
+		}
+		if running := sch.GetStats()["running"].(bool); !running {
+			t.Errorf("Cycle %d: expected stats to report running", i)
+		}
+		if state := sch.GetStats()["state"]; state != StateRunning {
+			t.Errorf("Cycle %d: expected state %s, got %v", i, StateRunning, state)
+		}
+		sch.Stop()
+		if sch.IsRunning() {
+			t.Fatalf("Cycle %d: expected scheduler to be stopped", i)
+		}
+		if state := sch.GetStats()["state"]; state != StateStopped {
+			t.Errorf("Cycle %d: expected state %s, got %v", i, StateStopped, state)
+		}
+	}
+
+	// A restarted scheduler still dispatches work
+	task, err := s.CreateTask("After Restart", "Description")
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	sch.Start()
+	defer sch.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		got, _ := s.GetTask(task.ID)
+		if got.Status != "pending" {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Error("Expected restarted scheduler to dispatch the task")
+}
+
+func TestSchedulerBatchDispatch(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	pdr := audit.NewPDRWriter(s)
+	conn := &mockConnector{name: "test"}
+
+	for i := 0; i < 6; i++ {
+		if _, err := s.CreateTask("Task", "Description"); err != nil {
+			t.Fatalf("Failed to create task: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		maxClaims int
+		want      int
+	}{
+		{name: "fill capacity", maxClaims: 0, want: 3},
+		{name: "capped batch", maxClaims: 2, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				GlobalMax:         3,
+				ByConnector:       map[string]int{"test": 5},
+				MaxClaimsPerCycle: tt.maxClaims,
+			}
+			sch := New(s, pdr, conn, cfg)
+			simulate(sch, 10*time.Second)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			sch.pollAndDispatch(ctx, ctx)
+
+			if got := sch.GetStats()["active_workers"].(int); got != tt.want {
+				t.Errorf("Expected %d workers after one cycle, got %d", tt.want, got)
+			}
+
+			cancel()
+			sch.workerWG.Wait()
+		})
+	}
+}
+
+func TestConfigNextPollDelay(t *testing.T) {
+	cfg := &Config{PollIntervalMs: 500, PollJitterMs: 100}
+	for i := 0; i < 50; i++ {
+		d := cfg.NextPollDelay()
+		if d < 500*time.Millisecond || d > 600*time.Millisecond {
+			t.Fatalf("Delay %s outside [500ms, 600ms]", d)
+		}
+	}
+
+	if d := (&Config{}).NextPollDelay(); d != time.Second {
+		t.Errorf("Expected default delay of 1s, got %s", d)
+	}
+}
+
+func TestSchedulerMutexKeySerializesTasks(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	pdr := audit.NewPDRWriter(s)
+	conn := &mockConnector{name: "test"}
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.CreateTaskWithOptions("Deploy", "Description", store.TaskOptions{MutexKey: "deploy-prod"}); err != nil {
+			t.Fatalf("Failed to create task: %v", err)
+		}
+	}
+	if _, err := s.CreateTask("Unrelated", "Description"); err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+
+	cfg := &Config{GlobalMax: 5, ByConnector: map[string]int{"test": 5}}
+	sch := New(s, pdr, conn, cfg)
+	simulate(sch, 10*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		sch.workerWG.Wait()
+	}()
+	sch.pollAndDispatch(ctx, ctx)
+	sch.pollAndDispatch(ctx, ctx)
+
+	// Only one task per mutex key may be in flight, plus the unrelated task
+	if got := sch.GetStats()["active_workers"].(int); got != 2 {
+		t.Errorf("Expected 2 active workers, got %d", got)
+	}
+
+	lock, err := s.GetLock(store.MutexResourceID("deploy-prod"))
+	if err != nil {
+		t.Fatalf("GetLock failed: %v", err)
+	}
+	if lock == nil {
+		t.Fatal("Expected the mutex key to be locked while the worker runs")
+	}
+}
+
+func TestSchedulerLabelLimits(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	pdr := audit.NewPDRWriter(s)
+	conn := &mockConnector{name: "test"}
+
+	for i := 0; i < 3; i++ {
+		s.CreateTaskWithOptions("Deploy", "", store.TaskOptions{Labels: []string{"prod-deploy"}})
+		s.CreateTaskWithOptions("Migrate", "", store.TaskOptions{Labels: []string{"db", "ci"}})
+	}
+	s.CreateTask("Unrelated", "")
+
+	cfg := &Config{GlobalMax: 10, ByConnector: map[string]int{"test": 10}, ByLabel: map[string]int{"prod-deploy": 1, "db": 2}}
+	sch := New(s, pdr, conn, cfg)
+	simulate(sch, 10*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		sch.workerWG.Wait()
+	}()
+	sch.pollAndDispatch(ctx, ctx)
+	sch.pollAndDispatch(ctx, ctx)
+
+	// One deploy, two migrations and the unrelated task
+	stats := sch.GetStats()
+	if got := stats["active_workers"].(int); got != 4 {
+		t.Errorf("Expected 4 active workers, got %d", got)
+	}
+	limits := stats["label_limits"].(map[string]LabelLimit)
+	if got := limits["prod-deploy"]; got != (LabelLimit{Limit: 1, Running: 1}) {
+		t.Errorf("prod-deploy: expected 1 of 1 running, got %+v", got)
+	}
+	if got := limits["db"]; got != (LabelLimit{Limit: 2, Running: 2}) {
+		t.Errorf("db: expected 2 of 2 running, got %+v", got)
+	}
+	if _, ok := limits["ci"]; ok {
+		t.Error("Expected no entry for a label without a limit")
+	}
+
+	// A finished deploy frees its slot
+	cancel()
+	sch.workerWG.Wait()
+	if got := sch.GetStats()["label_limits"].(map[string]LabelLimit)["prod-deploy"].Running; got != 0 {
+		t.Errorf("Expected no deploy running after the workers stopped, got %d", got)
+	}
+}
+
+func TestWorkerHeartbeatRenewsLease(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	pdr := audit.NewPDRWriter(s)
+	conn := &mockConnector{name: "test"}
+
+	c := clock.NewFake(time.Now())
+	s.SetClock(c)
+
+	task, err := s.CreateTask("Long Task", "Description")
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+
+	sch := New(s, pdr, conn, nil)
+	sch.SetClock(c)
+	sch.leaseTTLSec = 60
+	sch.heartbeatEvery = 10 * time.Millisecond
+	simulate(sch, 10*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		sch.workerWG.Wait()
+	}()
+	sch.pollAndDispatch(ctx, ctx)
+	original, _ := s.GetActiveLease(task.ID)
+	if original == nil {
+		t.Fatal("Expected the task claimed")
+	}
+
+	// Wait for a heartbeat late in the lease, then outlive the original TTL
+	c.Advance(50 * time.Second)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lease, _ := s.GetActiveLease(task.ID)
+		if lease != nil && lease.ExpiresAt.After(original.ExpiresAt) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Lease was not renewed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Advance(20 * time.Second)
+
+	lease, err := s.GetActiveLease(task.ID)
+	if err != nil {
+		t.Fatalf("GetActiveLease failed: %v", err)
+	}
+	if lease == nil {
+		t.Fatal("Expected heartbeat to keep the lease alive past its original TTL")
+	}
+
+	workers := sch.GetWorkers()
+	if len(workers) != 1 || !workers[0].LeaseExpires.After(c.Now()) {
+		t.Errorf("Expected worker lease expiry to be refreshed, got %+v", workers)
+	}
+}
+
+// stubRouter returns a fixed routing decision for every task.
+type stubRouter struct {
+	result mcp.RoutingResult
+}
+
+func (r *stubRouter) Route(ctx context.Context, task mcp.Task) (*mcp.RoutingResult, error) {
+	result := r.result
+	result.Task = task
+	return &result, nil
+}
+
+func (r *stubRouter) GetToolManifest(mcps []mcp.MCPServer) []mcp.Tool { return nil }
+
+func (r *stubRouter) Override(mcps []string) mcp.Router { return r }
+
+func TestWorkerInfoIncludesRouting(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	if _, err := s.CreateTask("Open a PR", "Description"); err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+
+	sch := New(s, audit.NewPDRWriter(s), &mockConnector{name: "test"}, nil)
+	simulate(sch, 10*time.Second)
+	sch.SetMCPRouter(&stubRouter{result: mcp.RoutingResult{
+		SelectedMCPs: []mcp.MCPServer{{Name: "github"}, {Name: "filesystem"}},
+		MatchedRules: []string{"pr"},
+		TotalTools:   12,
+		Strategy:     "keyword",
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		sch.workerWG.Wait()
+	}()
+	sch.pollAndDispatch(ctx, ctx)
+
+	workers := sch.GetWorkers()
+	if len(workers) != 1 || workers[0].Routing == nil {
+		t.Fatalf("Expected one worker with routing, got %+v", workers)
+	}
+	r := workers[0].Routing
+	if len(r.MCPs) != 2 || r.MCPs[0] != "github" || len(r.MatchedRules) != 1 || r.MatchedRules[0] != "pr" {
+		t.Errorf("Unexpected routing %+v", r)
+	}
+	if r.TotalTools != 12 || r.Strategy != "keyword" {
+		t.Errorf("Unexpected routing %+v", r)
+	}
+}
+
 func newTestStore(t *testing.T) *store.Store {
 	tmpDir := t.TempDir()
 	dbPath := filepath.Join(tmpDir, "test.db")
@@ -285,3 +735,157 @@ func newTestStore(t *testing.T) *store.Store {
 	}
 	return s
 }
+
+// panicExecutor panics on every task.
+type panicExecutor struct{}
+
+func (panicExecutor) Name() string { return ExecutorAgent }
+
+func (panicExecutor) Execute(ctx context.Context, task *models.Task) error {
+	panic("executor bug")
+}
+
+func TestWorkerRecoversExecutorPanic(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	dir := t.TempDir()
+	sch := New(s, audit.NewPDRWriter(s), &mockConnector{name: "test"}, nil)
+	sch.AddExecutor(panicExecutor{})
+	sch.SetCrashReporter(crash.NewReporter(dir, "test", nil))
+	task, _ := s.CreateTask("Crashy", "")
+
+	ctx := context.Background()
+	sch.pollAndDispatch(ctx, ctx)
+	sch.workerWG.Wait()
+
+	got, _ := s.GetTask(task.ID)
+	if got.Status != models.TaskStatusFailed {
+		t.Errorf("Expected the task failed, got %s", got.Status)
+	}
+	if lease, _ := s.GetActiveLease(task.ID); lease != nil {
+		t.Error("Expected the worker to clean up its lease")
+	}
+	reports, _ := crash.List(dir)
+	if len(reports) != 1 {
+		t.Fatalf("Expected a crash report, got %v", reports)
+	}
+	if report, err := crash.Load(reports[0]); err != nil || report.Panic != "executor bug" {
+		t.Errorf("Unexpected report: %+v, %v", report, err)
+	}
+}
+
+func TestSchedulerTunesLeaseTTL(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	c := clock.NewFake(time.Now())
+	s.SetClock(c)
+
+	// Six finished builds, one of them far slower than the rest
+	for i, d := range []time.Duration{10, 10, 12, 10, 11, 100} {
+		task, _ := s.CreateTaskWithOptions("Build", "", store.TaskOptions{Labels: []string{"ci"}})
+		run, _ := s.CreateRun(task.ID, "make", nil)
+		c.Advance(d * time.Second)
+		s.FinishRun(run)
+		s.UpdateTaskStatus(task.ID, models.TaskStatusCompleted)
+		c.Advance(time.Duration(i+1) * time.Millisecond)
+	}
+	build, _ := s.CreateTaskWithOptions("Build", "", store.TaskOptions{Labels: []string{"ci", "new"}})
+	fresh, _ := s.CreateTaskWithOptions("Docs", "", store.TaskOptions{Labels: []string{"new"}})
+
+	sch := New(s, audit.NewPDRWriter(s), &mockConnector{name: "test"}, &Config{GlobalMax: 10, ByConnector: map[string]int{"test": 10}})
+	sch.SetClock(c)
+	simulate(sch, 10*time.Second)
+	sch.SetLeaseTuning(&LeaseTuning{Samples: 50, MinSamples: 5, Margin: 1.5, MinTTLSec: 30, MaxTTLSec: 120})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		sch.workerWG.Wait()
+	}()
+	sch.pollAndDispatch(ctx, ctx)
+
+	// The p95 of six builds is the slowest; 150s is capped at 120s
+	if lease, _ := s.GetActiveLease(build.ID); lease == nil || lease.TTLSec != 120 {
+		t.Errorf("Expected the build leased for 120s, got %+v", lease)
+	}
+	if lease, _ := s.GetActiveLease(fresh.ID); lease == nil || lease.TTLSec != defaultLeaseTTLSec {
+		t.Errorf("Expected a label without history to keep the fixed TTL, got %+v", lease)
+	}
+
+	sch.leaseTuning.MaxTTLSec = 0
+	if ttl := sch.tunedLeaseTTL(build); ttl != 150 {
+		t.Errorf("Uncapped TTL = %d, want 150", ttl)
+	}
+	sch.leaseTuning.MinSamples = 7
+	if ttl := sch.tunedLeaseTTL(build); ttl != 0 {
+		t.Errorf("Expected no tuning with too few samples, got %d", ttl)
+	}
+}
+
+func TestPercentile95(t *testing.T) {
+	durations := make([]time.Duration, 0, 100)
+	for i := 100; i > 0; i-- {
+		durations = append(durations, time.Duration(i)*time.Second)
+	}
+	if p := percentile95(durations); p != 95*time.Second {
+		t.Errorf("p95 of 1..100s = %s, want 95s", p)
+	}
+	if p := percentile95([]time.Duration{time.Second}); p != time.Second {
+		t.Errorf("p95 of one sample = %s", p)
+	}
+}
+
+func TestSchedulerRecoverOwnInstanceOnly(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	pdr := audit.NewPDRWriter(s)
+	conn := &mockConnector{name: "test"}
+
+	// One worker of this daemon that died with it, and one of another
+	// daemon on the same database that is still running its task
+	claim := func(workerID, instanceID string) *models.Task {
+		if _, err := s.CreateTask("Task of "+instanceID, "Description"); err != nil {
+			t.Fatalf("Failed to create task: %v", err)
+		}
+		task, lease, err := s.AtomicClaimTask(workerID, 300)
+		if err != nil || task == nil {
+			t.Fatalf("Failed to claim task: %v", err)
+		}
+		if err := s.SaveWorkerRecord(&models.WorkerRecord{
+			WorkerID:   workerID,
+			InstanceID: instanceID,
+			TaskID:     task.ID,
+			LeaseID:    lease.ID,
+			State:      workerStateRunning,
+			StartedAt:  time.Now().UTC(),
+		}); err != nil {
+			t.Fatalf("SaveWorkerRecord failed: %v", err)
+		}
+		return task
+	}
+	own := claim("own-worker", "host-a")
+	other := claim("other-worker", "host-b")
+
+	sch := New(s, pdr, conn, nil)
+	sch.SetInstanceID("host-a")
+	if n, err := sch.Recover(); err != nil || n != 1 {
+		t.Fatalf("Recover = %d, %v; want 1", n, err)
+	}
+
+	if got, _ := s.GetTask(own.ID); got.Status != "pending" {
+		t.Errorf("Expected own task to be requeued, got %s", got.Status)
+	}
+	if got, _ := s.GetTask(other.ID); got.Status != "claimed" || got.ClaimedBy != "other-worker" {
+		t.Errorf("Expected other daemon's task to stay claimed, got %s (%s)", got.Status, got.ClaimedBy)
+	}
+	if active, _ := s.GetActiveLease(other.ID); active == nil {
+		t.Error("Expected other daemon's lease to be kept")
+	}
+	records, _ := s.ListWorkerRecords("")
+	if len(records) != 1 || records[0].InstanceID != "host-b" {
+		t.Errorf("Expected only host-b's worker record left, got %+v", records)
+	}
+}
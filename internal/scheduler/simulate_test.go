@@ -0,0 +1,31 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// simulation is an Executor that pretends to work on a task for a while.
+type simulation struct {
+	name string
+	d    time.Duration
+}
+
+func (s simulation) Name() string { return s.name }
+
+func (s simulation) Execute(ctx context.Context, _ *models.Task) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(s.d):
+		return nil
+	}
+}
+
+// simulate makes sch spend d on every task instead of running it.
+func simulate(sch *Scheduler, d time.Duration) {
+	sch.AddExecutor(simulation{ExecutorConnector, d})
+	sch.AddExecutor(simulation{ExecutorAgent, d})
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ClaimStats describes the claims made through a ClaimCounter.
+type ClaimStats struct {
+	Attempts int64 `json:"attempts"`
+	// Conflicts counts attempts that lost the task to another holder, such
+	// as claims failing with ErrTaskAlreadyLeased.
+	Conflicts int64 `json:"conflicts"`
+	// AvgLatencyMs is the mean time an attempt took, in milliseconds.
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+// ClaimCounter counts claim attempts, conflicts and latency. The zero
+// value is ready to use; it is safe for concurrent use.
+type ClaimCounter struct {
+	attempts  atomic.Int64
+	conflicts atomic.Int64
+	nanos     atomic.Int64
+}
+
+// Record counts an attempt that started at start, and whether it lost the
+// task to another holder.
+func (c *ClaimCounter) Record(start time.Time, conflict bool) {
+	c.attempts.Add(1)
+	c.nanos.Add(int64(time.Since(start)))
+	if conflict {
+		c.conflicts.Add(1)
+	}
+}
+
+// Stats returns the counts so far.
+func (c *ClaimCounter) Stats() ClaimStats {
+	stats := ClaimStats{Attempts: c.attempts.Load(), Conflicts: c.conflicts.Load()}
+	if stats.Attempts > 0 {
+		stats.AvgLatencyMs = float64(c.nanos.Load()) / float64(stats.Attempts) / float64(time.Millisecond)
+	}
+	return stats
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EncryptionKeySize is the length of a content encryption key (AES-256).
+const EncryptionKeySize = 32
+
+// encryptedPrefix marks column values sealed by a Cipher.
+const encryptedPrefix = "enc:v1:"
+
+// ErrEncryptedContent is returned when reading sealed content without a key.
+var ErrEncryptedContent = errors.New("content is encrypted; a database encryption key is required")
+
+// Cipher seals sensitive content columns (memory content, run output) with
+// AES-256-GCM. Values are stored as "enc:v1:" + base64(nonce || ciphertext),
+// so encrypted and plaintext rows can coexist.
+type Cipher struct {
+	aead cipher.AEAD
+	// hashKey keys the hashes memory deduplication compares content by.
+	hashKey []byte
+}
+
+// NewCipher creates a Cipher from a 32-byte key.
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", EncryptionKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	hashKey := sha256.Sum256(append([]byte("neona memory hash\x00"), key...))
+	return &Cipher{aead: aead, hashKey: hashKey[:]}, nil
+}
+
+func (c *Cipher) seal(plaintext string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *Cipher) open(value string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("decode encrypted content: %w", err)
+	}
+	n := c.aead.NonceSize()
+	if len(data) < n {
+		return "", fmt.Errorf("encrypted content too short")
+	}
+	plain, err := c.aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt content (wrong key?): %w", err)
+	}
+	return string(plain), nil
+}
+
+// SetCipher enables encryption of memory content and run output. Existing
+// plaintext rows stay readable.
+// Must be called before the store is shared - not safe for concurrent use.
+func (s *Store) SetCipher(c *Cipher) {
+	s.cipher = c
+}
+
+// encrypt seals a content value if encryption is enabled.
+func (s *Store) encrypt(v string) (string, error) {
+	if s.cipher == nil || v == "" {
+		return v, nil
+	}
+	return s.cipher.seal(v)
+}
+
+// decrypt opens a content value if it was sealed.
+func (s *Store) decrypt(v string) (string, error) {
+	if !strings.HasPrefix(v, encryptedPrefix) {
+		return v, nil
+	}
+	if s.cipher == nil {
+		return "", ErrEncryptedContent
+	}
+	return s.cipher.open(v)
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// fuzzyDedupWindow is how many of a scope's most recent items a fuzzy
+// duplicate check compares new content with.
+const fuzzyDedupWindow = 200
+
+// SetMemoryDedup enables fuzzy deduplication of memory items: content whose
+// word similarity with a recent item in the same scope reaches threshold
+// (0 to 1, e.g. 0.9) counts as a duplicate of it. Exact duplicates are
+// always merged; a threshold of 0 disables the fuzzy check.
+// Must be called before the store is shared - not safe for concurrent use.
+func (s *Store) SetMemoryDedup(threshold float64) {
+	s.fuzzyDedup = threshold
+}
+
+// normalizeMemory is the form of content duplicates are compared in:
+// whitespace runs collapse to one space and case is ignored.
+func normalizeMemory(content string) string {
+	return strings.ToLower(strings.Join(strings.Fields(content), " "))
+}
+
+// memoryHash identifies normalized content for exact deduplication. With
+// encryption enabled it is keyed, so the hash does not reveal content that
+// can be guessed.
+func (s *Store) memoryHash(content string) string {
+	normalized := normalizeMemory(content)
+	if s.cipher != nil {
+		mac := hmac.New(sha256.New, s.cipher.hashKey)
+		mac.Write([]byte(normalized))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// similarity is the Jaccard similarity of the word sets of two normalized
+// texts: 1 for the same words, 0 for none in common.
+func similarity(a, b string) float64 {
+	words := make(map[string]bool)
+	for _, w := range strings.Fields(a) {
+		words[w] = true
+	}
+	other := make(map[string]bool)
+	shared := 0
+	for _, w := range strings.Fields(b) {
+		if !other[w] && words[w] {
+			shared++
+		}
+		other[w] = true
+	}
+	union := len(words) + len(other) - shared
+	if union == 0 {
+		return 1
+	}
+	return float64(shared) / float64(union)
+}
+
+// findDuplicate returns the ID of an item in the same scope that item
+// duplicates, or "" if there is none. Items synced from files are never
+// matched; a sync replaces them.
+func (s *Store) findDuplicate(tx *sql.Tx, item *models.MemoryItem, hash string) (string, error) {
+	var id string
+	err := tx.QueryRow(`SELECT id FROM memory_items WHERE content_hash = ? AND scope = ? AND COALESCE(source, '') = '' ORDER BY created_at LIMIT 1`, hash, item.Scope).Scan(&id)
+	if err != sql.ErrNoRows {
+		return id, err
+	}
+	if s.fuzzyDedup <= 0 {
+		return "", nil
+	}
+
+	rows, err := tx.Query(`SELECT `+memoryColumns+` FROM memory_items WHERE scope = ? AND COALESCE(source, '') = '' ORDER BY created_at DESC LIMIT ?`, item.Scope, fuzzyDedupWindow)
+	if err != nil {
+		return "", fmt.Errorf("query recent memory: %w", err)
+	}
+	defer rows.Close()
+	normalized := normalizeMemory(item.Content)
+	recent, err := s.scanMemoryItems(rows, func(other *models.MemoryItem) bool {
+		return similarity(normalized, normalizeMemory(other.Content)) >= s.fuzzyDedup
+	})
+	if err != nil || len(recent) == 0 {
+		return "", err
+	}
+	return recent[0].ID, nil
+}
+
+// backfillMemoryHashes hashes items written before deduplication, so new
+// items are merged with them too. Items that cannot be decrypted are left
+// for a daemon that has the key.
+func (s *Store) backfillMemoryHashes() error {
+	rows, err := s.db.Query(`SELECT id, content FROM memory_items WHERE content_hash IS NULL`)
+	if err != nil {
+		return fmt.Errorf("query unhashed memory: %w", err)
+	}
+	var items []models.MemoryItem
+	for rows.Next() {
+		var item models.MemoryItem
+		if err := rows.Scan(&item.ID, &item.Content); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan memory: %w", err)
+		}
+		if content, err := s.decrypt(item.Content); err == nil {
+			item.Content = content
+			items = append(items, item)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if _, err := s.exec(`UPDATE memory_items SET content_hash = ? WHERE id = ?`, s.memoryHash(item.Content), item.ID); err != nil {
+			return fmt.Errorf("hash memory: %w", err)
+		}
+	}
+	s.hashesBackfilled.Store(true)
+	return nil
+}
+
+// markSeen counts another sighting of a duplicated item and returns it.
+func (s *Store) markSeen(tx *sql.Tx, id string, now time.Time) (*models.MemoryItem, error) {
+	if _, err := tx.Exec(`UPDATE memory_items SET seen_count = seen_count + 1, last_seen_at = ? WHERE id = ?`, now, id); err != nil {
+		return nil, fmt.Errorf("update memory: %w", err)
+	}
+	rows, err := tx.Query(`SELECT `+memoryColumns+` FROM memory_items WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("query memory item: %w", err)
+	}
+	defer rows.Close()
+	items, err := s.scanMemoryItems(rows, nil)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	items[0].Duplicate = true
+	return &items[0], nil
+}
@@ -0,0 +1,188 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/google/uuid"
+)
+
+// Kinds of problem CheckIntegrity reports.
+const (
+	// IssueOrphanedLease is a lease on a task that is missing or not
+	// claimed or running.
+	IssueOrphanedLease = "orphaned_lease"
+	// IssueOrphanedRun is a run of a task that no longer exists.
+	IssueOrphanedRun = "orphaned_run"
+	// IssueClaimWithoutLease is a claimed or running task with no unexpired
+	// lease, so no holder can finish it and it is never claimed again.
+	IssueClaimWithoutLease = "claim_without_lease"
+	// IssueExpiredLock is a lock past its expiry that was never released.
+	IssueExpiredLock = "expired_lock"
+)
+
+// PDR action recorded for each repair made by RepairIntegrity.
+const pdrActionRepair = "db.repair"
+
+// IntegrityIssue is one inconsistency between the coordination tables.
+type IntegrityIssue struct {
+	Kind   string `json:"kind"`
+	ID     string `json:"id"` // lease, run, task or lock ID, by kind
+	TaskID string `json:"task_id,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// queryer is implemented by *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// CheckIntegrity reports orphaned leases and runs, tasks claimed without a
+// lease and expired locks. It changes nothing; see RepairIntegrity.
+func (s *Store) CheckIntegrity() ([]IntegrityIssue, error) {
+	return findIssues(s.rdb, s.now())
+}
+
+// RepairIntegrity finds the issues CheckIntegrity reports and fixes them in
+// one transaction: orphaned leases, orphaned runs with their output and
+// expired locks are deleted, and tasks claimed without a lease are returned
+// to pending. Each repair writes a "db.repair" PDR in the same transaction.
+// It returns the issues repaired.
+func (s *Store) RepairIntegrity() ([]IntegrityIssue, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := s.now()
+	issues, err := findIssues(tx, now)
+	if err != nil {
+		return nil, err
+	}
+	insertPDR := tx.Stmt(s.stmts.insertPDR)
+	for _, issue := range issues {
+		if err := repairIssue(tx, issue, now); err != nil {
+			return nil, fmt.Errorf("repair %s %s: %w", issue.Kind, issue.ID, err)
+		}
+		inputs, _ := json.Marshal(issue)
+		hash := sha256.Sum256(inputs)
+		if _, err := insertPDR.Exec(uuid.New().String(), pdrActionRepair, hex.EncodeToString(hash[:]),
+			"repaired", issue.TaskID, issue.Kind+": "+issue.Detail, now); err != nil {
+			return nil, fmt.Errorf("insert pdr: %w", err)
+		}
+	}
+	if len(issues) == 0 {
+		return nil, nil
+	}
+	return issues, s.commit(tx)
+}
+
+func repairIssue(tx *sql.Tx, issue IntegrityIssue, now time.Time) error {
+	var err error
+	switch issue.Kind {
+	case IssueOrphanedLease:
+		_, err = tx.Exec(`DELETE FROM leases WHERE id = ?`, issue.ID)
+	case IssueOrphanedRun:
+		if _, err = tx.Exec(`DELETE FROM run_output WHERE run_id = ?`, issue.ID); err == nil {
+			_, err = tx.Exec(`DELETE FROM runs WHERE id = ?`, issue.ID)
+		}
+	case IssueClaimWithoutLease:
+		if _, err = tx.Exec(
+			`UPDATE tasks SET status = ?, claimed_by = NULL, claimed_at = NULL, updated_at = ? WHERE id = ?`,
+			models.TaskStatusPending, now, issue.ID,
+		); err == nil {
+			_, err = tx.Exec(`DELETE FROM leases WHERE task_id = ?`, issue.ID)
+		}
+	case IssueExpiredLock:
+		_, err = tx.Exec(`DELETE FROM locks WHERE id = ?`, issue.ID)
+	}
+	return err
+}
+
+func findIssues(q queryer, now time.Time) ([]IntegrityIssue, error) {
+	var issues []IntegrityIssue
+	collect := func(query string, scan func(rows *sql.Rows) (IntegrityIssue, error), args ...interface{}) error {
+		rows, err := q.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			issue, err := scan(rows)
+			if err != nil {
+				return err
+			}
+			issues = append(issues, issue)
+		}
+		return rows.Err()
+	}
+
+	err := collect(`SELECT l.id, l.task_id, l.holder_id, COALESCE(t.status, '') FROM leases l
+		LEFT JOIN tasks t ON t.id = l.task_id
+		WHERE t.id IS NULL OR t.status NOT IN (?, ?) ORDER BY l.created_at`,
+		func(rows *sql.Rows) (IntegrityIssue, error) {
+			issue := IntegrityIssue{Kind: IssueOrphanedLease}
+			var holder, status string
+			err := rows.Scan(&issue.ID, &issue.TaskID, &holder, &status)
+			if status == "" {
+				issue.Detail = fmt.Sprintf("lease held by %s on a missing task", holder)
+			} else {
+				issue.Detail = fmt.Sprintf("lease held by %s on a %s task", holder, status)
+			}
+			return issue, err
+		}, models.TaskStatusClaimed, models.TaskStatusRunning)
+	if err != nil {
+		return nil, fmt.Errorf("check leases: %w", err)
+	}
+
+	err = collect(`SELECT r.id, r.task_id, r.command FROM runs r
+		LEFT JOIN tasks t ON t.id = r.task_id
+		WHERE t.id IS NULL ORDER BY r.started_at`,
+		func(rows *sql.Rows) (IntegrityIssue, error) {
+			issue := IntegrityIssue{Kind: IssueOrphanedRun}
+			var command string
+			err := rows.Scan(&issue.ID, &issue.TaskID, &command)
+			issue.Detail = fmt.Sprintf("run of %q for a missing task", command)
+			return issue, err
+		})
+	if err != nil {
+		return nil, fmt.Errorf("check runs: %w", err)
+	}
+
+	err = collect(`SELECT id, status, COALESCE(claimed_by, '') FROM tasks t
+		WHERE status IN (?, ?) AND NOT EXISTS (
+			SELECT 1 FROM leases l WHERE l.task_id = t.id AND l.expires_at > ?)
+		ORDER BY created_at`,
+		func(rows *sql.Rows) (IntegrityIssue, error) {
+			issue := IntegrityIssue{Kind: IssueClaimWithoutLease}
+			var status, holder string
+			err := rows.Scan(&issue.ID, &status, &holder)
+			issue.TaskID = issue.ID
+			issue.Detail = fmt.Sprintf("task %s by %s without an active lease", status, holder)
+			return issue, err
+		}, models.TaskStatusClaimed, models.TaskStatusRunning, now)
+	if err != nil {
+		return nil, fmt.Errorf("check tasks: %w", err)
+	}
+
+	err = collect(`SELECT id, resource_id, holder_id, expires_at FROM locks
+		WHERE expires_at <= ? ORDER BY created_at`,
+		func(rows *sql.Rows) (IntegrityIssue, error) {
+			issue := IntegrityIssue{Kind: IssueExpiredLock}
+			var resource, holder string
+			var expires time.Time
+			err := rows.Scan(&issue.ID, &resource, &holder, &expires)
+			issue.Detail = fmt.Sprintf("%s lock held by %s expired at %s", resource, holder, expires.UTC().Format(time.RFC3339))
+			return issue, err
+		}, now)
+	if err != nil {
+		return nil, fmt.Errorf("check locks: %w", err)
+	}
+	return issues, nil
+}
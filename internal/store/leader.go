@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Leadership is the current holder of a named leader lease.
+type Leadership struct {
+	Name     string `json:"name"`
+	HolderID string `json:"holder_id"`
+	// Addr is the API address the holder advertised, where followers send
+	// writes.
+	Addr       string    `json:"addr,omitempty"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// AcquireLeadership takes or renews the leader lease name for holderID for
+// ttl. It reports false, without an error, while another holder's lease is
+// unexpired. Several daemons sharing one database call it periodically to
+// elect the one that runs background jobs.
+func (s *Store) AcquireLeadership(name, holderID, addr string, ttl time.Duration) (bool, error) {
+	now := s.now()
+	res, err := s.exec(
+		`INSERT INTO leader_leases (name, holder_id, addr, acquired_at, expires_at) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(name) DO UPDATE SET
+		   acquired_at = CASE WHEN leader_leases.holder_id = excluded.holder_id THEN leader_leases.acquired_at ELSE excluded.acquired_at END,
+		   holder_id = excluded.holder_id, addr = excluded.addr, expires_at = excluded.expires_at
+		 WHERE leader_leases.holder_id = excluded.holder_id OR leader_leases.expires_at <= ?`,
+		name, holderID, nullString(addr), now, now.Add(ttl), now,
+	)
+	if err != nil {
+		return false, fmt.Errorf("acquire leadership: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ReleaseLeadership gives up the leader lease if holderID holds it, so
+// another holder can take over without waiting for it to expire.
+func (s *Store) ReleaseLeadership(name, holderID string) error {
+	_, err := s.exec(`DELETE FROM leader_leases WHERE name = ? AND holder_id = ?`, name, holderID)
+	if err != nil {
+		return fmt.Errorf("release leadership: %w", err)
+	}
+	return nil
+}
+
+// GetLeader returns the unexpired holder of the leader lease name, or nil
+// when there is none.
+func (s *Store) GetLeader(name string) (*Leadership, error) {
+	var l Leadership
+	var addr sql.NullString
+	err := s.rdb.QueryRow(
+		`SELECT name, holder_id, addr, acquired_at, expires_at FROM leader_leases WHERE name = ? AND expires_at > ?`,
+		name, s.now(),
+	).Scan(&l.Name, &l.HolderID, &addr, &l.AcquiredAt, &l.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get leader: %w", err)
+	}
+	l.Addr = addr.String
+	return &l, nil
+}
+
+// WatchExternalWrites bumps the generation when another process commits to
+// the database, until ctx is done. Daemons sharing a database run it so
+// caches keyed on Generation see each other's writes within interval.
+func (s *Store) WatchExternalWrites(ctx context.Context, interval time.Duration) {
+	// data_version is per connection and changes only on commits from other
+	// connections; the writer pool has exactly one, so own writes never
+	// show up here.
+	version := func() (int64, error) {
+		var v int64
+		err := s.db.QueryRowContext(ctx, `PRAGMA data_version`).Scan(&v)
+		return v, err
+	}
+	last, _ := version()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			v, err := version()
+			if err == nil && v != last {
+				last = v
+				s.gen.Add(1)
+			}
+		}
+	}
+}
@@ -0,0 +1,1250 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fentz26/neona/internal/clock"
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/redact"
+	"github.com/google/uuid"
+)
+
+// Memory is an in-memory store with the same semantics as Store for the
+// operations the control plane uses. Nothing survives the process; it is
+// meant for unit tests and for embedding Neona without a database. It is
+// safe for concurrent use.
+type Memory struct {
+	gen         atomic.Uint64
+	outputLimit int
+	fuzzyDedup  float64
+	redactor    *redact.Redactor
+	clock       clock.Clock
+
+	mu        sync.Mutex
+	closed    bool
+	tasks     []*models.Task // in creation order
+	leases    []*models.Lease
+	runs      []*memRun
+	memory    []models.MemoryItem
+	events    []models.Event
+	comments  []models.Comment
+	checklist []models.ChecklistItem
+	locks     []*models.Lock
+	idem      map[[2]string]*IdempotencyRecord
+	pdr       []models.PDREntry
+	leaders   map[string]*Leadership
+}
+
+type memRun struct {
+	run  models.Run
+	diff *string
+}
+
+// NewMemory creates an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		outputLimit: DefaultRunOutputLimit,
+		clock:       clock.Real,
+		idem:        make(map[[2]string]*IdempotencyRecord),
+		leaders:     make(map[string]*Leadership),
+	}
+}
+
+// SetClock replaces the clock, as Store.SetClock does.
+// Must be called before the store is shared - not safe for concurrent use.
+func (m *Memory) SetClock(c clock.Clock) {
+	m.clock = c
+}
+
+func (m *Memory) now() time.Time {
+	return m.clock.Now()
+}
+
+// SetRunOutputLimit caps how many bytes of stdout and of stderr are kept
+// per run, as Store.SetRunOutputLimit does.
+// Must be called before the store is shared - not safe for concurrent use.
+func (m *Memory) SetRunOutputLimit(n int) {
+	m.outputLimit = n
+}
+
+// SetMemoryDedup sets the similarity at which memory content counts as a
+// duplicate, as Store.SetMemoryDedup does.
+// Must be called before the store is shared - not safe for concurrent use.
+func (m *Memory) SetMemoryDedup(threshold float64) {
+	m.fuzzyDedup = threshold
+}
+
+// SetRedactor masks sensitive text in memory content and run output before
+// it is stored, as Store.SetRedactor does.
+// Must be called before the store is shared - not safe for concurrent use.
+func (m *Memory) SetRedactor(r *redact.Redactor) {
+	m.redactor = r
+}
+
+// Close makes Ping fail, as a closed database would.
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+// Ping reports whether the store is still open.
+func (m *Memory) Ping(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return errors.New("store is closed")
+	}
+	return ctx.Err()
+}
+
+// Generation returns a counter that changes whenever the store is written.
+func (m *Memory) Generation() uint64 {
+	return m.gen.Load()
+}
+
+// lock takes the mutex for a write; the returned func bumps the
+// generation and unlocks.
+func (m *Memory) lock() func() {
+	m.mu.Lock()
+	return func() {
+		m.gen.Add(1)
+		m.mu.Unlock()
+	}
+}
+
+// --- Tasks ---
+
+// CreateTask inserts a new task.
+func (m *Memory) CreateTask(title, description string) (*models.Task, error) {
+	return m.CreateTaskWithOptions(title, description, TaskOptions{})
+}
+
+// CreateTaskWithOptions inserts a new task with optional attributes.
+func (m *Memory) CreateTaskWithOptions(title, description string, opts TaskOptions) (*models.Task, error) {
+	now := m.now()
+	task := &models.Task{
+		ID:          uuid.New().String(),
+		Title:       title,
+		Description: description,
+		Status:      models.TaskStatusPending,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		MutexKey:    strings.TrimSpace(opts.MutexKey),
+		Labels:      splitLabels(joinLabels(opts.Labels)),
+		Connector:   strings.TrimSpace(opts.Connector),
+		WorkDir:     opts.WorkDir,
+
+		AcceptanceCriteria: append([]string(nil), opts.AcceptanceCriteria...),
+		Commands:           append([]string(nil), opts.Commands...),
+		Steps:              copySteps(opts.Steps),
+		ParentID:           opts.ParentID,
+		Priority:           opts.Priority,
+		EstimateSec:        opts.EstimateSec,
+	}
+	if opts.DueAt != nil {
+		due := opts.DueAt.UTC()
+		task.DueAt = &due
+	}
+	if opts.NotBefore != nil {
+		at := opts.NotBefore.UTC()
+		task.NotBefore = &at
+	}
+	defer m.lock()()
+	m.tasks = append(m.tasks, task)
+	return copyTask(task), nil
+}
+
+// task returns the stored task with id, or nil. Callers hold m.mu.
+func (m *Memory) task(id string) *models.Task {
+	for _, t := range m.tasks {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// updateTask applies fn to a stored task, if it exists.
+func (m *Memory) updateTask(id string, fn func(*models.Task)) error {
+	defer m.lock()()
+	if t := m.task(id); t != nil {
+		fn(t)
+		t.UpdatedAt = m.now()
+	}
+	return nil
+}
+
+// SetTaskWorkDir sets the directory a task's commands run in.
+func (m *Memory) SetTaskWorkDir(id, dir string) error {
+	return m.updateTask(id, func(t *models.Task) { t.WorkDir = dir })
+}
+
+// SetTaskPRURL records the pull request opened for a task.
+func (m *Memory) SetTaskPRURL(id, url string) error {
+	return m.updateTask(id, func(t *models.Task) { t.PRURL = url })
+}
+
+// UpdateTaskStatus updates the status of a task. Completing the last open
+// subtask of a parent completes the parent too, and so on up the tree.
+func (m *Memory) UpdateTaskStatus(id string, status models.TaskStatus) error {
+	defer m.lock()()
+	now := m.now()
+	t := m.task(id)
+	if t == nil {
+		return nil
+	}
+	t.Status, t.UpdatedAt = status, now
+	for status == models.TaskStatusCompleted && t.ParentID != "" {
+		parent := m.task(t.ParentID)
+		if parent == nil || parent.Status == models.TaskStatusCompleted {
+			break
+		}
+		for _, sub := range m.tasks {
+			if sub.ParentID == parent.ID && sub.Status != models.TaskStatusCompleted {
+				return nil
+			}
+		}
+		parent.Status, parent.UpdatedAt = models.TaskStatusCompleted, now
+		parent.ClaimedBy, parent.ClaimedAt = "", nil
+		kept := m.leases[:0]
+		for _, l := range m.leases {
+			if l.TaskID != parent.ID {
+				kept = append(kept, l)
+			}
+		}
+		m.leases = kept
+		t = parent
+	}
+	return nil
+}
+
+// ListOverdueTasks returns open tasks whose deadline is at or before now
+// and whose breach has not been recorded yet, earliest deadline first.
+func (m *Memory) ListOverdueTasks(now time.Time) ([]models.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tasks []models.Task
+	for _, t := range m.tasks {
+		if t.DueAt != nil && !t.DueAt.After(now) && t.SLABreachedAt == nil &&
+			t.Status != models.TaskStatusCompleted && t.Status != models.TaskStatusFailed {
+			tasks = append(tasks, *copyTask(t))
+		}
+	}
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].DueAt.Before(*tasks[j].DueAt) })
+	return tasks, nil
+}
+
+// MarkSLABreached records that a task missed its deadline, reporting false
+// when the breach was already recorded.
+func (m *Memory) MarkSLABreached(id string, at time.Time) (bool, error) {
+	defer m.lock()()
+	t := m.task(id)
+	if t == nil || t.SLABreachedAt != nil {
+		return false, nil
+	}
+	at = at.UTC()
+	t.SLABreachedAt = &at
+	return true, nil
+}
+
+// ListSubtasks returns a task's direct subtasks, oldest first.
+func (m *Memory) ListSubtasks(parentID string) ([]models.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tasks []models.Task
+	for _, t := range m.tasks {
+		if t.ParentID == parentID {
+			tasks = append(tasks, *copyTask(t))
+		}
+	}
+	return tasks, nil
+}
+
+// ReleaseTask returns a claimed or running task to pending, clearing its
+// claim and deleting its leases. It returns the holder the task was
+// released from, and fails with ErrTaskNotClaimed or ErrNotHolder.
+func (m *Memory) ReleaseTask(id string, opts ReleaseOptions) (string, error) {
+	defer m.lock()()
+	now := m.now()
+	t := m.task(id)
+	if t == nil || t.Status != models.TaskStatusClaimed && t.Status != models.TaskStatusRunning {
+		return "", ErrTaskNotClaimed
+	}
+
+	holder := t.ClaimedBy
+	if l := m.activeLease(id, now); l != nil {
+		holder = l.HolderID
+	}
+	if !opts.Force && holder != opts.HolderID {
+		return "", ErrNotHolder
+	}
+
+	t.Status, t.UpdatedAt = models.TaskStatusPending, now
+	t.ClaimedBy, t.ClaimedAt = "", nil
+	kept := m.leases[:0]
+	for _, l := range m.leases {
+		if l.TaskID != id {
+			kept = append(kept, l)
+		}
+	}
+	m.leases = kept
+	return holder, nil
+}
+
+// GetTask retrieves a task by ID, or nil if it does not exist.
+func (m *Memory) GetTask(id string) (*models.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t := m.task(id); t != nil {
+		return copyTask(t), nil
+	}
+	return nil, nil
+}
+
+// FindTaskIDs returns up to limit IDs of tasks whose ID starts with
+// prefix, in ID order.
+func (m *Memory) FindTaskIDs(prefix string, limit int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []string
+	for _, t := range m.tasks {
+		if strings.HasPrefix(t.ID, prefix) {
+			ids = append(ids, t.ID)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids, nil
+}
+
+// ListTasks returns all tasks, highest priority first and newest first
+// within a priority, optionally filtered by status.
+func (m *Memory) ListTasks(status string) ([]models.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tasks []models.Task
+	for i := len(m.tasks) - 1; i >= 0; i-- {
+		if status == "" || string(m.tasks[i].Status) == status {
+			tasks = append(tasks, *copyTask(m.tasks[i]))
+		}
+	}
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].Priority > tasks[j].Priority })
+	return tasks, nil
+}
+
+// --- Claims and leases ---
+
+// ClaimTaskWithLeaseTx atomically claims a pending task and creates a lease.
+func (m *Memory) ClaimTaskWithLeaseTx(taskID, holderID string, ttlSec int) (*ClaimResult, error) {
+	defer m.lock()()
+	now := m.now()
+	t := m.task(taskID)
+	if t == nil || t.Status != models.TaskStatusPending {
+		return nil, ErrTaskNotClaimable
+	}
+	if m.activeLease(taskID, now) != nil {
+		return nil, ErrTaskAlreadyLeased
+	}
+	lease := m.claim(t, holderID, ttlSec, now)
+	return &ClaimResult{Task: copyTask(t), Lease: lease}, nil
+}
+
+// AtomicClaimTask atomically claims the next pending task, by priority
+// then age, and creates a lease, returning nils if none is eligible.
+func (m *Memory) AtomicClaimTask(holderID string, ttlSec int) (*models.Task, *models.Lease, error) {
+	return m.AtomicClaimNext(holderID, ttlSec, ClaimFilter{})
+}
+
+// AtomicClaimNext atomically claims the pending task matching the filter
+// with the highest priority, the oldest of those, and creates a lease. It
+// returns nils if no task is eligible.
+func (m *Memory) AtomicClaimNext(holderID string, ttlSec int, filter ClaimFilter) (*models.Task, *models.Lease, error) {
+	defer m.lock()()
+	now := m.now()
+	var next *models.Task
+	for _, t := range m.tasks {
+		if (next == nil || t.Priority > next.Priority) && m.claimable(t, filter, now) {
+			next = t
+		}
+	}
+	if next == nil {
+		return nil, nil, nil
+	}
+	lease := m.claim(next, holderID, ttlSec, now)
+	return copyTask(next), lease, nil
+}
+
+// claimable mirrors the WHERE clause of nextPendingQuery. Callers hold m.mu.
+func (m *Memory) claimable(t *models.Task, filter ClaimFilter, now time.Time) bool {
+	if t.Status != models.TaskStatusPending || t.ClaimedBy != "" {
+		return false
+	}
+	if t.MutexKey != "" && m.heldLock(MutexResourceID(t.MutexKey), now) != nil {
+		return false
+	}
+	if m.activeLease(t.ID, now) != nil {
+		return false
+	}
+	if t.NotBefore != nil && t.NotBefore.After(now) {
+		return false
+	}
+	for _, sub := range m.tasks {
+		if sub.ParentID == t.ID {
+			return false
+		}
+	}
+	for _, id := range filter.Exclude {
+		if t.ID == id {
+			return false
+		}
+	}
+	if filter.Label != "" && !strings.Contains(joinLabels(t.Labels), ","+filter.Label+",") {
+		return false
+	}
+	for _, label := range filter.ExcludeLabels {
+		if strings.Contains(joinLabels(t.Labels), ","+label+",") {
+			return false
+		}
+	}
+	if filter.Connector != "" && t.Connector != "" && t.Connector != filter.Connector {
+		return false
+	}
+	if filter.WithCommands && len(t.Commands) == 0 && len(t.Steps) == 0 {
+		return false
+	}
+	return true
+}
+
+// claim marks t claimed and leases it, replacing any expired leases so the
+// task keeps at most one, as the SQL store's unique index requires.
+// Callers hold m.mu.
+func (m *Memory) claim(t *models.Task, holderID string, ttlSec int, now time.Time) *models.Lease {
+	kept := m.leases[:0]
+	for _, l := range m.leases {
+		if l.TaskID != t.ID || l.ExpiresAt.After(now) {
+			kept = append(kept, l)
+		}
+	}
+	m.leases = kept
+
+	claimedAt := now
+	t.Status = models.TaskStatusClaimed
+	t.ClaimedBy, t.ClaimedAt = holderID, &claimedAt
+	t.UpdatedAt = now
+
+	lease := &models.Lease{
+		ID:        uuid.New().String(),
+		TaskID:    t.ID,
+		HolderID:  holderID,
+		TTLSec:    ttlSec,
+		ExpiresAt: now.Add(time.Duration(ttlSec) * time.Second),
+		CreatedAt: now,
+	}
+	m.leases = append(m.leases, lease)
+	copied := *lease
+	return &copied
+}
+
+// activeLease returns the newest unexpired lease on a task. Callers hold
+// m.mu.
+func (m *Memory) activeLease(taskID string, now time.Time) *models.Lease {
+	for i := len(m.leases) - 1; i >= 0; i-- {
+		if l := m.leases[i]; l.TaskID == taskID && l.ExpiresAt.After(now) {
+			return l
+		}
+	}
+	return nil
+}
+
+// GetActiveLease returns the active lease for a task, if any.
+func (m *Memory) GetActiveLease(taskID string) (*models.Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l := m.activeLease(taskID, m.now()); l != nil {
+		copied := *l
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+// GetLatestLease returns a task's newest lease, expired or not, if any.
+func (m *Memory) GetLatestLease(taskID string) (*models.Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.leases) - 1; i >= 0; i-- {
+		if l := m.leases[i]; l.TaskID == taskID {
+			copied := *l
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+// updateLease applies fn to a stored lease, if it exists.
+func (m *Memory) updateLease(id string, fn func(*models.Lease)) error {
+	defer m.lock()()
+	for _, l := range m.leases {
+		if l.ID == id {
+			fn(l)
+		}
+	}
+	return nil
+}
+
+// ListActiveLeases returns all unexpired leases, oldest first.
+func (m *Memory) ListActiveLeases() ([]models.Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var leases []models.Lease
+	for _, l := range m.leases {
+		if l.ExpiresAt.After(now) {
+			leases = append(leases, *l)
+		}
+	}
+	return leases, nil
+}
+
+// RenewLease extends the expiry of a lease (heartbeat).
+func (m *Memory) RenewLease(leaseID string, ttlSec int) error {
+	expires := m.now().Add(time.Duration(ttlSec) * time.Second)
+	return m.updateLease(leaseID, func(l *models.Lease) { l.ExpiresAt = expires })
+}
+
+// SetLeaseTTL gives a lease a new TTL, expiring ttlSec from now.
+func (m *Memory) SetLeaseTTL(leaseID string, ttlSec int) error {
+	expires := m.now().Add(time.Duration(ttlSec) * time.Second)
+	return m.updateLease(leaseID, func(l *models.Lease) { l.TTLSec, l.ExpiresAt = ttlSec, expires })
+}
+
+// SetLeaseTokenHash stores the hash of the holder token issued for a lease.
+func (m *Memory) SetLeaseTokenHash(leaseID, tokenHash string) error {
+	return m.updateLease(leaseID, func(l *models.Lease) { l.TokenHash = tokenHash })
+}
+
+// deleteLeases removes the leases drop matches.
+func (m *Memory) deleteLeases(drop func(*models.Lease) bool) error {
+	defer m.lock()()
+	kept := m.leases[:0]
+	for _, l := range m.leases {
+		if !drop(l) {
+			kept = append(kept, l)
+		}
+	}
+	m.leases = kept
+	return nil
+}
+
+// DeleteLease removes a lease.
+func (m *Memory) DeleteLease(leaseID string) error {
+	return m.deleteLeases(func(l *models.Lease) bool { return l.ID == leaseID })
+}
+
+// DeleteLeasesForTask removes every lease on a task, expired or not.
+func (m *Memory) DeleteLeasesForTask(taskID string) error {
+	return m.deleteLeases(func(l *models.Lease) bool { return l.TaskID == taskID })
+}
+
+// --- Locks ---
+
+// heldLock returns the unexpired lock on a resource. Callers hold m.mu.
+func (m *Memory) heldLock(resourceID string, now time.Time) *models.Lock {
+	for _, l := range m.locks {
+		if l.ResourceID == resourceID && l.ExpiresAt.After(now) {
+			return l
+		}
+	}
+	return nil
+}
+
+// AcquireLock acquires a lock on a resource, failing with
+// ErrResourceLocked while another unexpired lock is held.
+func (m *Memory) AcquireLock(resourceID, holderID, lockType string, ttlSec int) (*models.Lock, error) {
+	defer m.lock()()
+	now := m.now()
+	if m.heldLock(resourceID, now) != nil {
+		return nil, ErrResourceLocked
+	}
+	kept := m.locks[:0]
+	for _, l := range m.locks {
+		if l.ResourceID != resourceID {
+			kept = append(kept, l)
+		}
+	}
+	lock := &models.Lock{
+		ID:         uuid.New().String(),
+		ResourceID: resourceID,
+		HolderID:   holderID,
+		LockType:   lockType,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(time.Duration(ttlSec) * time.Second),
+	}
+	m.locks = append(kept, lock)
+	copied := *lock
+	return &copied, nil
+}
+
+// ListLocks returns all unexpired locks, oldest first.
+func (m *Memory) ListLocks() ([]models.Lock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var locks []models.Lock
+	for _, l := range m.locks {
+		if l.ExpiresAt.After(now) {
+			locks = append(locks, *l)
+		}
+	}
+	return locks, nil
+}
+
+// ReleaseLock releases a lock.
+func (m *Memory) ReleaseLock(lockID string) error {
+	defer m.lock()()
+	for i, l := range m.locks {
+		if l.ID == lockID {
+			m.locks = append(m.locks[:i], m.locks[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// --- Leadership ---
+
+// AcquireLeadership takes or renews the leader lease name for holderID.
+func (m *Memory) AcquireLeadership(name, holderID, addr string, ttl time.Duration) (bool, error) {
+	defer m.lock()()
+	now := m.now()
+	l := m.leaders[name]
+	if l != nil && l.HolderID != holderID && l.ExpiresAt.After(now) {
+		return false, nil
+	}
+	if l == nil || l.HolderID != holderID {
+		l = &Leadership{Name: name, HolderID: holderID, AcquiredAt: now}
+		m.leaders[name] = l
+	}
+	l.Addr = addr
+	l.ExpiresAt = now.Add(ttl)
+	return true, nil
+}
+
+// ReleaseLeadership gives up the leader lease if holderID holds it.
+func (m *Memory) ReleaseLeadership(name, holderID string) error {
+	defer m.lock()()
+	if l := m.leaders[name]; l != nil && l.HolderID == holderID {
+		delete(m.leaders, name)
+	}
+	return nil
+}
+
+// GetLeader returns the unexpired holder of the leader lease name.
+func (m *Memory) GetLeader(name string) (*Leadership, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := m.leaders[name]
+	if l == nil || !l.ExpiresAt.After(m.now()) {
+		return nil, nil
+	}
+	copied := *l
+	return &copied, nil
+}
+
+// --- Idempotency ---
+
+// BeginIdempotent reserves an idempotency key for the request hashing to
+// requestHash. If the key is new it returns (nil, true); otherwise it
+// returns the existing record and false.
+func (m *Memory) BeginIdempotent(scope, key, requestHash string) (*IdempotencyRecord, bool, error) {
+	defer m.lock()()
+	now := m.now()
+	for k, rec := range m.idem {
+		if !rec.CreatedAt.After(now.Add(-IdempotencyTTL)) {
+			delete(m.idem, k)
+		}
+	}
+	if rec, ok := m.idem[[2]string{scope, key}]; ok {
+		copied := *rec
+		return &copied, false, nil
+	}
+	m.idem[[2]string{scope, key}] = &IdempotencyRecord{Scope: scope, Key: key, RequestHash: requestHash, CreatedAt: now}
+	return nil, true, nil
+}
+
+// CompleteIdempotent stores the response for a reserved idempotency key.
+func (m *Memory) CompleteIdempotent(scope, key string, statusCode int, response []byte) error {
+	defer m.lock()()
+	if rec, ok := m.idem[[2]string{scope, key}]; ok {
+		rec.StatusCode = statusCode
+		rec.Response = append([]byte(nil), response...)
+	}
+	return nil
+}
+
+// DeleteIdempotent forgets an idempotency key so the request can be retried.
+func (m *Memory) DeleteIdempotent(scope, key string) error {
+	defer m.lock()()
+	delete(m.idem, [2]string{scope, key})
+	return nil
+}
+
+// --- Runs ---
+
+// CreateRun inserts a new run record.
+func (m *Memory) CreateRun(taskID, command string, args []string) (*models.Run, error) {
+	run := models.Run{
+		ID:        uuid.New().String(),
+		TaskID:    taskID,
+		Command:   command,
+		Args:      append([]string(nil), args...),
+		StartedAt: m.now(),
+	}
+	defer m.lock()()
+	m.runs = append(m.runs, &memRun{run: run})
+	return copyRun(&run), nil
+}
+
+// findRun returns the stored run with id, or nil. Callers hold m.mu.
+func (m *Memory) findRun(id string) *memRun {
+	for _, r := range m.runs {
+		if r.run.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// FinishRun records a run's exit code and output and sets its end time,
+// capping output as Store.FinishRun does.
+func (m *Memory) FinishRun(run *models.Run) error {
+	run.Stdout, run.Stderr = m.redactor.Redact(run.Stdout), m.redactor.Redact(run.Stderr)
+	var cut bool
+	run.Stdout, cut = capOutput(run.Stdout, m.outputLimit)
+	run.Truncated = run.Truncated || cut
+	run.Stderr, cut = capOutput(run.Stderr, m.outputLimit)
+	run.Truncated = run.Truncated || cut
+	run.EndedAt = m.now()
+
+	defer m.lock()()
+	r := m.findRun(run.ID)
+	if r == nil {
+		return nil
+	}
+	r.run.ExitCode, r.run.Stdout, r.run.Stderr = run.ExitCode, run.Stdout, run.Stderr
+	r.run.Truncated, r.run.EndedAt = run.Truncated, run.EndedAt
+	return nil
+}
+
+// GetRun retrieves a run by ID, or nil if there is none.
+func (m *Memory) GetRun(id string) (*models.Run, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.findRun(id)
+	if r == nil {
+		return nil, nil
+	}
+	run := copyRun(&r.run)
+	run.HasDiff = r.diff != nil
+	return run, nil
+}
+
+// SetRunRetryOf links a run to the run it re-executed.
+func (m *Memory) SetRunRetryOf(id, retryOf string) error {
+	defer m.lock()()
+	if r := m.findRun(id); r != nil {
+		r.run.RetryOf = retryOf
+	}
+	return nil
+}
+
+// GetRunsForTask returns all runs for a task, newest first.
+func (m *Memory) GetRunsForTask(taskID string) ([]models.Run, error) {
+	return m.ListTaskRuns(taskID, -1, 0)
+}
+
+// ListTaskRuns returns a page of a task's runs, newest first. A negative
+// limit returns every run after offset.
+func (m *Memory) ListTaskRuns(taskID string, limit, offset int) ([]models.Run, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var runs []models.Run
+	for i := len(m.runs) - 1; i >= 0 && (limit < 0 || len(runs) < limit); i-- {
+		if m.runs[i].run.TaskID != taskID {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		run := copyRun(&m.runs[i].run)
+		run.HasDiff = m.runs[i].diff != nil
+		runs = append(runs, *run)
+	}
+	return runs, nil
+}
+
+// CountTaskRuns returns how many runs a task has.
+func (m *Memory) CountTaskRuns(taskID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, r := range m.runs {
+		if r.run.TaskID == taskID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// SetRunDiff stores the workdir diff captured at the end of a run.
+func (m *Memory) SetRunDiff(id, diff string) error {
+	defer m.lock()()
+	if r := m.findRun(id); r != nil {
+		r.diff = &diff
+	}
+	return nil
+}
+
+// GetRunDiff returns the diff captured for a run. ok is false when the run
+// does not exist or has no diff.
+func (m *Memory) GetRunDiff(id string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r := m.findRun(id); r != nil && r.diff != nil {
+		return *r.diff, true, nil
+	}
+	return "", false, nil
+}
+
+// --- PDR ---
+
+// WritePDR writes a Process Decision Record.
+func (m *Memory) WritePDR(action, inputsHash, outcome, taskID, details string) (*models.PDREntry, error) {
+	entry := models.PDREntry{
+		ID:         uuid.New().String(),
+		Action:     action,
+		InputsHash: inputsHash,
+		Outcome:    outcome,
+		TaskID:     taskID,
+		Details:    details,
+		Timestamp:  m.now(),
+	}
+	defer m.lock()()
+	m.pdr = append(m.pdr, entry)
+	return &entry, nil
+}
+
+// WritePDRBatch writes several Process Decision Records. Entries must
+// already carry their ID and timestamp.
+func (m *Memory) WritePDRBatch(entries []*models.PDREntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	defer m.lock()()
+	for _, e := range entries {
+		m.pdr = append(m.pdr, *e)
+	}
+	return nil
+}
+
+// ListTaskPDRs returns a task's most recent limit Process Decision
+// Records, oldest first.
+func (m *Memory) ListTaskPDRs(taskID string, limit int) ([]models.PDREntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var entries []models.PDREntry
+	for _, e := range m.pdr {
+		if e.TaskID == taskID {
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp.Before(entries[j].Timestamp) })
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
+
+// PDRs returns the records written so far, oldest first.
+func (m *Memory) PDRs() []models.PDREntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.PDREntry(nil), m.pdr...)
+}
+
+// --- Events ---
+
+// Size reports row counts; an in-memory store has no file, so Bytes is 0.
+// Run output is kept with its run and not counted.
+func (m *Memory) Size() (*SizeStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return &SizeStats{Rows: map[string]int64{
+		TableTasks:  int64(len(m.tasks)),
+		TableRuns:   int64(len(m.runs)),
+		TablePDR:    int64(len(m.pdr)),
+		TableMemory: int64(len(m.memory)),
+		TableEvents: int64(len(m.events)),
+	}}, nil
+}
+
+// AddEvent records an event addressed to a holder (holderID may be empty).
+func (m *Memory) AddEvent(eventType, taskID, holderID string, payload interface{}) (*models.Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal event payload: %w", err)
+	}
+	ev := models.Event{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		TaskID:    taskID,
+		HolderID:  holderID,
+		Payload:   string(data),
+		CreatedAt: m.now(),
+	}
+	defer m.lock()()
+	m.events = append(m.events, ev)
+	return &ev, nil
+}
+
+// ListEvents returns events newer than since, oldest first, optionally
+// filtered by holder.
+func (m *Memory) ListEvents(holderID string, since time.Time, limit int) ([]models.Event, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []models.Event
+	for _, ev := range m.events {
+		if len(events) == limit {
+			break
+		}
+		if ev.CreatedAt.After(since) && (holderID == "" || ev.HolderID == holderID) {
+			events = append(events, ev)
+		}
+	}
+	return events, nil
+}
+
+// --- Memory items ---
+
+// AddMemory inserts a memory item in its default scope.
+func (m *Memory) AddMemory(taskID, content, tags string) (*models.MemoryItem, error) {
+	items, err := m.AddMemoryBatch([]models.MemoryItem{{TaskID: taskID, Content: content, Tags: tags}})
+	if err != nil {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// AddMemoryBatch inserts several memory items, merging duplicates into the
+// items they repeat as Store.AddMemoryBatch does.
+func (m *Memory) AddMemoryBatch(items []models.MemoryItem) ([]models.MemoryItem, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	now := m.now()
+	out := make([]models.MemoryItem, len(items))
+	defer m.lock()()
+	for i, item := range items {
+		if item.Scope == "" {
+			item.Scope = models.DefaultMemoryScope(item.TaskID)
+		}
+		item.Content = m.redactor.Redact(item.Content)
+		if dup := m.findDuplicate(&item); dup != nil {
+			seen := now
+			dup.SeenCount++
+			dup.LastSeenAt = &seen
+			out[i] = *dup
+			out[i].Duplicate = true
+			continue
+		}
+		item.ID = uuid.New().String()
+		item.CreatedAt = now
+		item.SeenCount = 1
+		m.memory = append(m.memory, item)
+		out[i] = item
+	}
+	return out, nil
+}
+
+// findDuplicate returns the item in item's scope that it duplicates, or
+// nil. Items synced from files are never matched. Callers hold m.mu.
+func (m *Memory) findDuplicate(item *models.MemoryItem) *models.MemoryItem {
+	normalized := normalizeMemory(item.Content)
+	for i := range m.memory {
+		if m.memory[i].Scope == item.Scope && m.memory[i].Source == "" && normalizeMemory(m.memory[i].Content) == normalized {
+			return &m.memory[i]
+		}
+	}
+	if m.fuzzyDedup <= 0 {
+		return nil
+	}
+	checked := 0
+	for i := len(m.memory) - 1; i >= 0 && checked < fuzzyDedupWindow; i-- {
+		if m.memory[i].Scope != item.Scope || m.memory[i].Source != "" {
+			continue
+		}
+		checked++
+		if similarity(normalized, normalizeMemory(m.memory[i].Content)) >= m.fuzzyDedup {
+			return &m.memory[i]
+		}
+	}
+	return nil
+}
+
+// QueryMemory searches memory items by content, newest first, matching
+// case-insensitively like SQLite's LIKE. With scopes, only items in one of
+// them are returned.
+func (m *Memory) QueryMemory(query string, scopes ...string) ([]models.MemoryItem, error) {
+	needle := strings.ToLower(strings.TrimSpace(query))
+	return m.memoryItems(memoryQueryLimit, func(item *models.MemoryItem) bool {
+		if len(scopes) > 0 && !containsScope(scopes, item.Scope) {
+			return false
+		}
+		return strings.Contains(strings.ToLower(item.Content), needle)
+	}), nil
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMemoryForTask returns memory items for a specific task, newest first.
+func (m *Memory) GetMemoryForTask(taskID string) ([]models.MemoryItem, error) {
+	return m.memoryItems(-1, func(item *models.MemoryItem) bool {
+		return item.TaskID == taskID
+	}), nil
+}
+
+// GetMemoryItem returns a memory item by ID, or nil if it does not exist.
+func (m *Memory) GetMemoryItem(id string) (*models.MemoryItem, error) {
+	items := m.memoryItems(1, func(item *models.MemoryItem) bool { return item.ID == id })
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return &items[0], nil
+}
+
+// SetMemoryScope moves a memory item to another scope.
+func (m *Memory) SetMemoryScope(id, scope string) error {
+	defer m.lock()()
+	for i := range m.memory {
+		if m.memory[i].ID == id {
+			m.memory[i].Scope = scope
+		}
+	}
+	return nil
+}
+
+// ListSourcedMemory returns the items in scope synced from files, oldest
+// first.
+func (m *Memory) ListSourcedMemory(scope string) ([]models.MemoryItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var items []models.MemoryItem
+	for _, item := range m.memory {
+		if item.Scope == scope && item.Source != "" {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// PutSourcedMemory stores an item synced from a file, replacing the item
+// previously synced from the same source into its scope.
+func (m *Memory) PutSourcedMemory(item models.MemoryItem) (*models.MemoryItem, error) {
+	defer m.lock()()
+	m.deleteSourced(item.Scope, item.Source)
+	item.ID = uuid.New().String()
+	item.Content = m.redactor.Redact(item.Content)
+	item.CreatedAt = m.now()
+	item.SeenCount = 1
+	m.memory = append(m.memory, item)
+	return &item, nil
+}
+
+// DeleteSourcedMemory deletes the item synced from source into scope.
+func (m *Memory) DeleteSourcedMemory(scope, source string) error {
+	defer m.lock()()
+	m.deleteSourced(scope, source)
+	return nil
+}
+
+// deleteSourced drops the items synced from source into scope. Callers
+// hold m.mu.
+func (m *Memory) deleteSourced(scope, source string) {
+	kept := m.memory[:0]
+	for _, item := range m.memory {
+		if item.Scope != scope || item.Source != source {
+			kept = append(kept, item)
+		}
+	}
+	m.memory = kept
+}
+
+// memoryItems returns up to limit items accepted by keep, newest first.
+func (m *Memory) memoryItems(limit int, keep func(*models.MemoryItem) bool) []models.MemoryItem {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var items []models.MemoryItem
+	for i := len(m.memory) - 1; i >= 0 && (limit < 0 || len(items) < limit); i-- {
+		if keep(&m.memory[i]) {
+			items = append(items, m.memory[i])
+		}
+	}
+	return items
+}
+
+// --- Comments ---
+
+// AddComment appends a comment to a task's thread.
+func (m *Memory) AddComment(taskID, author, body string) (*models.Comment, error) {
+	c := models.Comment{
+		ID:        uuid.New().String(),
+		TaskID:    taskID,
+		Author:    author,
+		Body:      body,
+		CreatedAt: m.now(),
+	}
+	defer m.lock()()
+	m.comments = append(m.comments, c)
+	return &c, nil
+}
+
+// ListComments returns a task's comments, oldest first. A non-zero since
+// returns only comments created after it.
+func (m *Memory) ListComments(taskID string, since time.Time) ([]models.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var comments []models.Comment
+	for _, c := range m.comments {
+		if c.TaskID == taskID && c.CreatedAt.After(since) {
+			comments = append(comments, c)
+		}
+	}
+	return comments, nil
+}
+
+// --- Checklist ---
+
+// AddChecklistItems appends unchecked items to a task's checklist.
+func (m *Memory) AddChecklistItems(taskID string, texts []string) ([]models.ChecklistItem, error) {
+	defer m.lock()()
+	next := 1
+	for _, item := range m.checklist {
+		if item.TaskID == taskID && item.Position >= next {
+			next = item.Position + 1
+		}
+	}
+	now := m.now()
+	var items []models.ChecklistItem
+	for i, text := range texts {
+		item := models.ChecklistItem{ID: uuid.New().String(), TaskID: taskID, Position: next + i, Text: text, CreatedAt: now}
+		m.checklist = append(m.checklist, item)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// ListChecklist returns a task's checklist in order.
+func (m *Memory) ListChecklist(taskID string) ([]models.ChecklistItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var items []models.ChecklistItem
+	for _, item := range m.checklist {
+		if item.TaskID == taskID {
+			items = append(items, copyChecklistItem(item))
+		}
+	}
+	return items, nil
+}
+
+// SetChecklistItemDone checks or unchecks an item of a task's checklist,
+// recording who checked it. It returns nil if the task has no such item.
+func (m *Memory) SetChecklistItemDone(taskID, itemID string, done bool, by string) (*models.ChecklistItem, error) {
+	defer m.lock()()
+	for i := range m.checklist {
+		item := &m.checklist[i]
+		if item.ID != itemID || item.TaskID != taskID {
+			continue
+		}
+		item.Done, item.CheckedBy, item.CheckedAt = done, "", nil
+		if done {
+			now := m.now()
+			item.CheckedBy, item.CheckedAt = by, &now
+		}
+		copied := copyChecklistItem(*item)
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func copyChecklistItem(item models.ChecklistItem) models.ChecklistItem {
+	if item.CheckedAt != nil {
+		at := *item.CheckedAt
+		item.CheckedAt = &at
+	}
+	return item
+}
+
+func copySteps(steps []models.RunStep) []models.RunStep {
+	if steps == nil {
+		return nil
+	}
+	copied := make([]models.RunStep, len(steps))
+	for i, step := range steps {
+		step.Args = append([]string(nil), step.Args...)
+		copied[i] = step
+	}
+	return copied
+}
+
+func copyTask(t *models.Task) *models.Task {
+	copied := *t
+	copied.Labels = append([]string(nil), t.Labels...)
+	copied.AcceptanceCriteria = append([]string(nil), t.AcceptanceCriteria...)
+	copied.Commands = append([]string(nil), t.Commands...)
+	copied.Steps = copySteps(t.Steps)
+	if t.ClaimedAt != nil {
+		at := *t.ClaimedAt
+		copied.ClaimedAt = &at
+	}
+	if t.DueAt != nil {
+		at := *t.DueAt
+		copied.DueAt = &at
+	}
+	if t.SLABreachedAt != nil {
+		at := *t.SLABreachedAt
+		copied.SLABreachedAt = &at
+	}
+	if t.NotBefore != nil {
+		at := *t.NotBefore
+		copied.NotBefore = &at
+	}
+	return &copied
+}
+
+func copyRun(r *models.Run) *models.Run {
+	copied := *r
+	copied.Args = append([]string(nil), r.Args...)
+	return &copied
+}
@@ -0,0 +1,661 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/clock"
+	"github.com/fentz26/neona/internal/models"
+)
+
+// backend is the part of Store and Memory the parity tests exercise.
+type backend interface {
+	CreateTaskWithOptions(title, description string, opts TaskOptions) (*models.Task, error)
+	GetTask(id string) (*models.Task, error)
+	FindTaskIDs(prefix string, limit int) ([]string, error)
+	ListTasks(status string) ([]models.Task, error)
+	ReleaseTask(id string, opts ReleaseOptions) (string, error)
+	ClaimTaskWithLeaseTx(taskID, holderID string, ttlSec int) (*ClaimResult, error)
+	AtomicClaimNext(holderID string, ttlSec int, filter ClaimFilter) (*models.Task, *models.Lease, error)
+	GetActiveLease(taskID string) (*models.Lease, error)
+	GetLatestLease(taskID string) (*models.Lease, error)
+	ListActiveLeases() ([]models.Lease, error)
+	SetLeaseTTL(leaseID string, ttlSec int) error
+	DeleteLeasesForTask(taskID string) error
+	AcquireLock(resourceID, holderID, lockType string, ttlSec int) (*models.Lock, error)
+	ReleaseLock(lockID string) error
+	ListLocks() ([]models.Lock, error)
+	CreateRun(taskID, command string, args []string) (*models.Run, error)
+	FinishRun(run *models.Run) error
+	ListTaskRuns(taskID string, limit, offset int) ([]models.Run, error)
+	GetRun(id string) (*models.Run, error)
+	SetRunRetryOf(id, retryOf string) error
+	SetRunOutputLimit(n int)
+	SetClock(c clock.Clock)
+	BeginIdempotent(scope, key, requestHash string) (*IdempotencyRecord, bool, error)
+	CompleteIdempotent(scope, key string, statusCode int, response []byte) error
+	QueryMemory(query string, scopes ...string) ([]models.MemoryItem, error)
+	AddMemory(taskID, content, tags string) (*models.MemoryItem, error)
+	AddMemoryBatch(items []models.MemoryItem) ([]models.MemoryItem, error)
+	GetMemoryItem(id string) (*models.MemoryItem, error)
+	SetMemoryScope(id, scope string) error
+	SetMemoryDedup(threshold float64)
+	ListSourcedMemory(scope string) ([]models.MemoryItem, error)
+	PutSourcedMemory(item models.MemoryItem) (*models.MemoryItem, error)
+	DeleteSourcedMemory(scope, source string) error
+	AcquireLeadership(name, holderID, addr string, ttl time.Duration) (bool, error)
+	ReleaseLeadership(name, holderID string) error
+	GetLeader(name string) (*Leadership, error)
+	AddChecklistItems(taskID string, texts []string) ([]models.ChecklistItem, error)
+	ListChecklist(taskID string) ([]models.ChecklistItem, error)
+	SetChecklistItemDone(taskID, itemID string, done bool, by string) (*models.ChecklistItem, error)
+	UpdateTaskStatus(id string, status models.TaskStatus) error
+	ListSubtasks(parentID string) ([]models.Task, error)
+	ListOverdueTasks(now time.Time) ([]models.Task, error)
+	MarkSLABreached(id string, at time.Time) (bool, error)
+	Generation() uint64
+}
+
+// forEachBackend runs a test against the SQLite store and the in-memory one,
+// so the two keep the same semantics.
+func forEachBackend(t *testing.T, test func(t *testing.T, s backend)) {
+	t.Run("sqlite", func(t *testing.T) {
+		s := newTestStore(t)
+		defer s.Close()
+		test(t, s)
+	})
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemory())
+	})
+}
+
+func TestBackendExpiryFollowsClock(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		c := clock.NewFake(time.Date(2026, 3, 8, 1, 30, 0, 0, time.UTC))
+		s.SetClock(c)
+
+		task, _ := s.CreateTaskWithOptions("Leased", "", TaskOptions{})
+		if !task.CreatedAt.Equal(c.Now()) {
+			t.Errorf("CreatedAt = %v, want the clock's %v", task.CreatedAt, c.Now())
+		}
+		res, err := s.ClaimTaskWithLeaseTx(task.ID, "w1", 60)
+		if err != nil {
+			t.Fatalf("Claim: %v", err)
+		}
+		if !res.Lease.ExpiresAt.Equal(c.Now().Add(time.Minute)) {
+			t.Errorf("ExpiresAt = %v, want a minute after %v", res.Lease.ExpiresAt, c.Now())
+		}
+		c.Advance(59 * time.Second)
+		if lease, _ := s.GetActiveLease(task.ID); lease == nil {
+			t.Error("Expected the lease active before its TTL")
+		}
+		c.Advance(time.Second)
+		if lease, _ := s.GetActiveLease(task.ID); lease != nil {
+			t.Errorf("Expected the lease expired after its TTL, got %+v", lease)
+		}
+
+		if _, err := s.AcquireLock("repo", "w1", "exclusive", 30); err != nil {
+			t.Fatalf("AcquireLock: %v", err)
+		}
+		if lock, _ := s.AcquireLock("repo", "w2", "exclusive", 30); lock != nil {
+			t.Error("Expected the lock held")
+		}
+		c.Advance(31 * time.Second)
+		if lock, err := s.AcquireLock("repo", "w2", "exclusive", 30); err != nil || lock == nil {
+			t.Errorf("Expected the expired lock taken over, got %+v, %v", lock, err)
+		}
+
+		if ok, _ := s.AcquireLeadership("scheduler", "d1", "", 10*time.Second); !ok {
+			t.Fatal("Expected leadership acquired")
+		}
+		c.Advance(11 * time.Second)
+		if l, _ := s.GetLeader("scheduler"); l != nil {
+			t.Errorf("Expected leadership expired, got %+v", l)
+		}
+	})
+}
+
+func TestBackendFindTaskIDs(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		a, _ := s.CreateTaskWithOptions("A", "", TaskOptions{})
+		s.CreateTaskWithOptions("B", "", TaskOptions{})
+
+		if ids, err := s.FindTaskIDs(a.ID[:8], 2); err != nil || len(ids) != 1 || ids[0] != a.ID {
+			t.Errorf("FindTaskIDs(%s) = %v, %v; want %s", a.ID[:8], ids, err, a.ID)
+		}
+		if ids, _ := s.FindTaskIDs("", 1); len(ids) != 1 {
+			t.Errorf("FindTaskIDs with limit 1 = %v", ids)
+		}
+		if ids, _ := s.FindTaskIDs("%", 2); len(ids) != 0 {
+			t.Errorf("FindTaskIDs(%%) = %v, want no wildcard matches", ids)
+		}
+	})
+}
+
+func TestBackendSteps(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		steps := []models.RunStep{{Command: "go", Args: []string{"vet", "./..."}, ContinueOnError: true}, {Command: "make"}}
+		task, _ := s.CreateTaskWithOptions("Pipeline", "", TaskOptions{Steps: steps})
+		steps[0].Args[0] = "changed"
+
+		got, _ := s.GetTask(task.ID)
+		if len(got.Steps) != 2 || got.Steps[0].Args[0] != "vet" || !got.Steps[0].ContinueOnError || got.Steps[1].Command != "make" {
+			t.Fatalf("Steps = %+v", got.Steps)
+		}
+		if claimed, _, _ := s.AtomicClaimNext("w1", 60, ClaimFilter{WithCommands: true}); claimed == nil || claimed.ID != task.ID {
+			t.Errorf("Expected a task with steps to count as having commands, got %+v", claimed)
+		}
+	})
+}
+
+func TestBackendLatestLease(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		task, _ := s.CreateTaskWithOptions("Leased", "", TaskOptions{})
+		if lease, err := s.GetLatestLease(task.ID); err != nil || lease != nil {
+			t.Fatalf("GetLatestLease before a claim = %+v, %v", lease, err)
+		}
+		res, err := s.ClaimTaskWithLeaseTx(task.ID, "w1", -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if active, _ := s.GetActiveLease(task.ID); active != nil {
+			t.Fatalf("Expected the lease expired, got %+v", active)
+		}
+		if lease, err := s.GetLatestLease(task.ID); err != nil || lease == nil || lease.ID != res.Lease.ID {
+			t.Errorf("GetLatestLease = %+v, %v; want the expired lease", lease, err)
+		}
+	})
+}
+
+func TestBackendListLeasesAndLocks(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		live, _ := s.CreateTaskWithOptions("Live", "", TaskOptions{})
+		expired, _ := s.CreateTaskWithOptions("Expired", "", TaskOptions{})
+		res, err := s.ClaimTaskWithLeaseTx(live.ID, "w1", 60)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.ClaimTaskWithLeaseTx(expired.ID, "w2", -1); err != nil {
+			t.Fatal(err)
+		}
+		if leases, err := s.ListActiveLeases(); err != nil || len(leases) != 1 || leases[0].ID != res.Lease.ID {
+			t.Errorf("ListActiveLeases = %+v, %v; want only the live lease", leases, err)
+		}
+		if err := s.SetLeaseTTL(res.Lease.ID, 900); err != nil {
+			t.Fatal(err)
+		}
+		if lease, _ := s.GetActiveLease(live.ID); lease == nil || lease.TTLSec != 900 || time.Until(lease.ExpiresAt) < 14*time.Minute {
+			t.Errorf("Expected the lease retimed to 900s, got %+v", lease)
+		}
+
+		lock, err := s.AcquireLock(MutexResourceID("deploy"), "w1", "mutex", 60)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.AcquireLock("repo", "w2", "exclusive", -1)
+		if locks, err := s.ListLocks(); err != nil || len(locks) != 1 || locks[0].ID != lock.ID || locks[0].HolderID != "w1" {
+			t.Errorf("ListLocks = %+v, %v; want only the live lock", locks, err)
+		}
+	})
+}
+
+func TestBackendClaims(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		first, _ := s.CreateTaskWithOptions("First", "", TaskOptions{MutexKey: "deploy"})
+		second, _ := s.CreateTaskWithOptions("Second", "", TaskOptions{Labels: []string{"build", " ci ", "build"}, Connector: "shell"})
+		if got, _ := s.GetTask(second.ID); strings.Join(got.Labels, ",") != "build,ci" {
+			t.Errorf("Labels = %v, want build,ci", got.Labels)
+		}
+		if tasks, _ := s.ListTasks(""); len(tasks) != 2 || tasks[0].ID != second.ID {
+			t.Errorf("Expected tasks newest first")
+		}
+
+		// A held mutex key makes the first task ineligible
+		lock, err := s.AcquireLock(MutexResourceID("deploy"), "other", "mutex", 60)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.AcquireLock(MutexResourceID("deploy"), "third", "mutex", 60); !errors.Is(err, ErrResourceLocked) {
+			t.Errorf("Expected ErrResourceLocked, got %v", err)
+		}
+		if task, _, _ := s.AtomicClaimNext("w1", 60, ClaimFilter{Connector: "localexec"}); task != nil {
+			t.Errorf("Expected nothing claimable, got %s", task.Title)
+		}
+		if task, _, _ := s.AtomicClaimNext("w1", 60, ClaimFilter{WithCommands: true}); task != nil {
+			t.Errorf("Expected no task with commands, got %s", task.Title)
+		}
+		if task, _, _ := s.AtomicClaimNext("w1", 60, ClaimFilter{ExcludeLabels: []string{"deploy", "ci"}}); task != nil {
+			t.Errorf("Expected the labelled task excluded, got %s", task.Title)
+		}
+		task, lease, err := s.AtomicClaimNext("w1", 60, ClaimFilter{Label: "ci"})
+		if err != nil || task == nil || task.ID != second.ID || lease.HolderID != "w1" {
+			t.Fatalf("Expected the labelled task, got %+v (err=%v)", task, err)
+		}
+		if active, _ := s.GetActiveLease(second.ID); active == nil || active.ID != lease.ID {
+			t.Errorf("Expected the new lease to be active")
+		}
+
+		s.ReleaseLock(lock.ID)
+		if _, err := s.ClaimTaskWithLeaseTx(second.ID, "w2", 60); !errors.Is(err, ErrTaskNotClaimable) {
+			t.Errorf("Expected ErrTaskNotClaimable for a claimed task, got %v", err)
+		}
+		res, err := s.ClaimTaskWithLeaseTx(first.ID, "w2", 60)
+		if err != nil || res.Task.ClaimedBy != "w2" || res.Task.Status != models.TaskStatusClaimed {
+			t.Fatalf("Expected w2 to claim the first task, got %+v (err=%v)", res, err)
+		}
+
+		// Only the holder can release, and the lease goes with the claim
+		if _, err := s.ReleaseTask(first.ID, ReleaseOptions{HolderID: "w3"}); !errors.Is(err, ErrNotHolder) {
+			t.Errorf("Expected ErrNotHolder releasing another holder's task, got %v", err)
+		}
+		if holder, err := s.ReleaseTask(first.ID, ReleaseOptions{HolderID: "w2"}); err != nil || holder != "w2" {
+			t.Fatalf("Expected w2 to release its task, got %q, %v", holder, err)
+		}
+		if lease, _ := s.GetActiveLease(first.ID); lease != nil {
+			t.Errorf("Expected the lease deleted with the release, got %+v", lease)
+		}
+		if _, err := s.ReleaseTask(first.ID, ReleaseOptions{HolderID: "w2"}); !errors.Is(err, ErrTaskNotClaimed) {
+			t.Errorf("Expected ErrTaskNotClaimed releasing a pending task, got %v", err)
+		}
+		if _, err := s.ClaimTaskWithLeaseTx(first.ID, "w3", 60); err != nil {
+			t.Errorf("Expected the released task to be claimable at once, got %v", err)
+		}
+		if holder, err := s.ReleaseTask(first.ID, ReleaseOptions{Force: true}); err != nil || holder != "w3" {
+			t.Errorf("Expected a forced release from w3, got %q, %v", holder, err)
+		}
+	})
+}
+
+func TestBackendRuns(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		s.SetRunOutputLimit(4)
+		task, _ := s.CreateTaskWithOptions("Runs", "", TaskOptions{})
+		for _, out := range []string{"one", "two", "three!"} {
+			run, _ := s.CreateRun(task.ID, "echo", []string{out})
+			run.Stdout = out
+			if err := s.FinishRun(run); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		runs, err := s.ListTaskRuns(task.ID, 2, 0)
+		if err != nil || len(runs) != 2 {
+			t.Fatalf("Expected a page of 2 runs, got %d (err=%v)", len(runs), err)
+		}
+		if runs[0].Stdout != "thre" || !runs[0].Truncated || runs[1].Stdout != "two" || runs[1].Truncated {
+			t.Errorf("Expected newest first with capped output, got %q/%v, %q/%v", runs[0].Stdout, runs[0].Truncated, runs[1].Stdout, runs[1].Truncated)
+		}
+		if runs, _ := s.ListTaskRuns(task.ID, -1, 2); len(runs) != 1 || runs[0].Args[0] != "one" {
+			t.Errorf("Expected the oldest run after offset 2, got %+v", runs)
+		}
+
+		if err := s.SetRunRetryOf(runs[0].ID, runs[1].ID); err != nil {
+			t.Fatal(err)
+		}
+		run, err := s.GetRun(runs[0].ID)
+		if err != nil || run == nil || run.RetryOf != runs[1].ID || run.Stdout != "thre" {
+			t.Errorf("Expected the run linked to its predecessor, got %+v (err=%v)", run, err)
+		}
+		if run, err := s.GetRun("missing"); run != nil || err != nil {
+			t.Errorf("Expected nil for a missing run, got %+v (err=%v)", run, err)
+		}
+	})
+}
+
+func TestBackendIdempotencyAndMemory(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		gen := s.Generation()
+		if rec, created, err := s.BeginIdempotent("create", "k1", "h1"); err != nil || !created || rec != nil {
+			t.Fatalf("Expected a new key, got %+v, %v, %v", rec, created, err)
+		}
+		s.CompleteIdempotent("create", "k1", 201, []byte(`{"id":"x"}`))
+		rec, created, _ := s.BeginIdempotent("create", "k1", "h2")
+		if created || rec.StatusCode != 201 || string(rec.Response) != `{"id":"x"}` || rec.RequestHash != "h1" {
+			t.Errorf("Expected the stored response, got %+v", rec)
+		}
+
+		s.AddMemory("", "Use the Staging cluster", "note")
+		s.AddMemory("", "unrelated", "note")
+		if items, _ := s.QueryMemory("staging"); len(items) != 1 {
+			t.Errorf("Expected a case-insensitive match, got %d items", len(items))
+		}
+		if s.Generation() == gen {
+			t.Error("Expected writes to change the generation")
+		}
+	})
+}
+
+func TestBackendMemoryScopes(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		note, _ := s.AddMemory("task-1", "retry flaky deploys", "note")
+		if note.Scope != "task:task-1" {
+			t.Errorf("Scope = %q, want the task scope", note.Scope)
+		}
+		if global, _ := s.AddMemory("", "deploys need a VPN", ""); global.Scope != models.MemoryScopeGlobal {
+			t.Errorf("Scope = %q, want global", global.Scope)
+		}
+		s.AddMemoryBatch([]models.MemoryItem{{Content: "deploys go through CI", Scope: "project:web"}})
+
+		if items, _ := s.QueryMemory("deploys"); len(items) != 3 {
+			t.Errorf("Expected all scopes without a filter, got %d items", len(items))
+		}
+		if items, _ := s.QueryMemory("deploys", "project:web", models.MemoryScopeGlobal); len(items) != 2 {
+			t.Errorf("Expected the project and global items, got %d", len(items))
+		}
+
+		if err := s.SetMemoryScope(note.ID, "project:web"); err != nil {
+			t.Fatalf("SetMemoryScope failed: %v", err)
+		}
+		got, _ := s.GetMemoryItem(note.ID)
+		if got == nil || got.Scope != "project:web" || got.TaskID != "task-1" {
+			t.Errorf("Expected the item promoted with its task kept, got %+v", got)
+		}
+		if items, _ := s.QueryMemory("", "project:web"); len(items) != 2 {
+			t.Errorf("Expected 2 project items after promotion, got %d", len(items))
+		}
+		if missing, err := s.GetMemoryItem("missing"); missing != nil || err != nil {
+			t.Errorf("Expected nil for a missing item, got %+v, %v", missing, err)
+		}
+	})
+}
+
+func TestBackendMemoryDedup(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		first, _ := s.AddMemory("t1", "Run: go test ./...\nOutput: ok", "run,log")
+		again, err := s.AddMemory("t1", "run: go test   ./...\noutput: OK", "run,log")
+		if err != nil {
+			t.Fatalf("AddMemory failed: %v", err)
+		}
+		if !again.Duplicate || again.ID != first.ID || again.SeenCount != 2 || again.LastSeenAt == nil {
+			t.Errorf("Expected the repeat merged into the first item, got %+v", again)
+		}
+		// The same content in another scope is a separate item
+		if other, _ := s.AddMemory("t2", first.Content, ""); other.Duplicate {
+			t.Error("Expected no merging across scopes")
+		}
+		batch, _ := s.AddMemoryBatch([]models.MemoryItem{{Content: "use the VPN"}, {Content: "Use the  VPN"}})
+		if batch[0].Duplicate || !batch[1].Duplicate || batch[1].ID != batch[0].ID {
+			t.Errorf("Expected duplicates within a batch merged, got %+v", batch)
+		}
+		if items, _ := s.QueryMemory("go test"); len(items) != 2 || items[1].SeenCount != 2 {
+			t.Errorf("Expected two stored items with the count kept, got %+v", items)
+		}
+
+		// Near-duplicates merge only when fuzzy matching is on
+		near := "deploys to staging need the VPN and a fresh token"
+		s.AddMemory("", "deploys to staging need the VPN and a token", "")
+		if item, _ := s.AddMemory("", near, ""); item.Duplicate {
+			t.Error("Expected no fuzzy merging by default")
+		}
+		s.SetMemoryDedup(0.8)
+		if item, _ := s.AddMemory("", "deploys to staging need the VPN and a new token", ""); !item.Duplicate {
+			t.Error("Expected a near-duplicate merged with fuzzy matching")
+		}
+	})
+}
+
+func TestBackendSourcedMemory(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		const scope = "project:web"
+		note, _ := s.AddMemoryBatch([]models.MemoryItem{{Content: "Use pnpm, not npm", Scope: scope}})
+		first, err := s.PutSourcedMemory(models.MemoryItem{Content: "Use pnpm, not npm", Scope: scope, Source: "AGENTS.md", SourceHash: "h1"})
+		if err != nil {
+			t.Fatalf("PutSourcedMemory failed: %v", err)
+		}
+		if first.Duplicate || first.ID == note[0].ID {
+			t.Error("Expected a synced item stored apart from a matching note")
+		}
+		// Notes are not merged into synced items, which a later sync replaces
+		if again, _ := s.AddMemoryBatch([]models.MemoryItem{{Content: "use pnpm, not npm", Scope: scope}}); again[0].ID != note[0].ID {
+			t.Errorf("Expected the note merged into the earlier note, got %+v", again[0])
+		}
+
+		second, _ := s.PutSourcedMemory(models.MemoryItem{Content: "Use pnpm 9", Scope: scope, Source: "AGENTS.md", SourceHash: "h2"})
+		s.PutSourcedMemory(models.MemoryItem{Content: "No tabs", Scope: "project:api", Source: "AGENTS.md", SourceHash: "h3"})
+		items, _ := s.ListSourcedMemory(scope)
+		if len(items) != 1 || items[0].ID != second.ID || items[0].SourceHash != "h2" || items[0].Source != "AGENTS.md" {
+			t.Fatalf("Expected the file's item replaced, got %+v", items)
+		}
+
+		if err := s.DeleteSourcedMemory(scope, "AGENTS.md"); err != nil {
+			t.Fatalf("DeleteSourcedMemory failed: %v", err)
+		}
+		if items, _ := s.ListSourcedMemory(scope); len(items) != 0 {
+			t.Errorf("Expected no synced items left, got %+v", items)
+		}
+		if items, _ := s.ListSourcedMemory("project:api"); len(items) != 1 {
+			t.Errorf("Expected other projects untouched, got %+v", items)
+		}
+		if got, _ := s.GetMemoryItem(note[0].ID); got == nil {
+			t.Error("Expected notes kept")
+		}
+	})
+}
+
+func TestBackendSubtasks(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		parent, _ := s.CreateTaskWithOptions("Ship login", "", TaskOptions{})
+		first, _ := s.CreateTaskWithOptions("Backend", "", TaskOptions{ParentID: parent.ID})
+		second, _ := s.CreateTaskWithOptions("Frontend", "", TaskOptions{ParentID: parent.ID})
+		leaf, _ := s.CreateTaskWithOptions("Button", "", TaskOptions{ParentID: second.ID})
+
+		if subs, _ := s.ListSubtasks(parent.ID); len(subs) != 2 || subs[0].ID != first.ID || subs[1].ParentID != parent.ID {
+			t.Fatalf("Expected two subtasks oldest first, got %+v", subs)
+		}
+
+		// Parents are never handed out as work
+		claimed := map[string]bool{}
+		for {
+			task, _, err := s.AtomicClaimNext("w", 60, ClaimFilter{})
+			if err != nil {
+				t.Fatalf("AtomicClaimNext failed: %v", err)
+			}
+			if task == nil {
+				break
+			}
+			claimed[task.ID] = true
+		}
+		if len(claimed) != 2 || !claimed[first.ID] || !claimed[leaf.ID] {
+			t.Errorf("Expected only the leaf tasks to be claimed, got %v", claimed)
+		}
+
+		s.UpdateTaskStatus(first.ID, models.TaskStatusCompleted)
+		if got, _ := s.GetTask(parent.ID); got.Status == models.TaskStatusCompleted {
+			t.Error("Expected the parent to stay open while a subtask is open")
+		}
+		// Completing the last leaf rolls up through both levels
+		s.UpdateTaskStatus(leaf.ID, models.TaskStatusCompleted)
+		for _, id := range []string{second.ID, parent.ID} {
+			if got, _ := s.GetTask(id); got.Status != models.TaskStatusCompleted {
+				t.Errorf("Expected %s completed by roll-up, got %s", got.Title, got.Status)
+			}
+		}
+	})
+}
+
+func TestBackendDeadlines(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		now := time.Now().UTC()
+		past, future := now.Add(-time.Hour), now.Add(time.Hour)
+		late, _ := s.CreateTaskWithOptions("Late", "", TaskOptions{DueAt: &past, EstimateSec: 600})
+		s.CreateTaskWithOptions("On time", "", TaskOptions{DueAt: &future})
+		s.CreateTaskWithOptions("No deadline", "", TaskOptions{})
+		done, _ := s.CreateTaskWithOptions("Done late", "", TaskOptions{DueAt: &past})
+		s.UpdateTaskStatus(done.ID, models.TaskStatusCompleted)
+
+		got, _ := s.GetTask(late.ID)
+		if got.EstimateSec != 600 || got.DueAt == nil || !got.DueAt.Equal(past) {
+			t.Errorf("Expected estimate and deadline round-tripped, got %d %v", got.EstimateSec, got.DueAt)
+		}
+
+		overdue, err := s.ListOverdueTasks(now)
+		if err != nil {
+			t.Fatalf("ListOverdueTasks failed: %v", err)
+		}
+		if len(overdue) != 1 || overdue[0].ID != late.ID {
+			t.Fatalf("Expected only the open late task, got %+v", overdue)
+		}
+
+		if ok, err := s.MarkSLABreached(late.ID, now); err != nil || !ok {
+			t.Fatalf("Expected the first breach recorded, got %v, %v", ok, err)
+		}
+		if ok, _ := s.MarkSLABreached(late.ID, now); ok {
+			t.Error("Expected a breach to be recorded only once")
+		}
+		if overdue, _ := s.ListOverdueTasks(now); len(overdue) != 0 {
+			t.Errorf("Expected recorded breaches to be skipped, got %d", len(overdue))
+		}
+		if got, _ := s.GetTask(late.ID); got.SLABreachedAt == nil {
+			t.Error("Expected SLABreachedAt set")
+		}
+	})
+}
+
+func TestBackendNotBefore(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		later := time.Now().Add(time.Hour)
+		delayed, _ := s.CreateTaskWithOptions("Nightly report", "", TaskOptions{NotBefore: &later})
+		ready, _ := s.CreateTaskWithOptions("Fix login", "", TaskOptions{})
+
+		if got, _ := s.GetTask(delayed.ID); got.NotBefore == nil || !got.NotBefore.Equal(later.UTC()) {
+			t.Errorf("Expected not_before round-tripped, got %v", got.NotBefore)
+		}
+
+		// The older delayed task is skipped until its time comes
+		task, _, err := s.AtomicClaimNext("w", 60, ClaimFilter{})
+		if err != nil || task == nil || task.ID != ready.ID {
+			t.Fatalf("Expected the ready task claimed first, got %+v, %v", task, err)
+		}
+		if task, _, _ := s.AtomicClaimNext("w", 60, ClaimFilter{Label: "x"}); task != nil {
+			t.Errorf("Expected nothing eligible with a filter, got %s", task.Title)
+		}
+		if task, _, _ := s.AtomicClaimNext("w", 60, ClaimFilter{}); task != nil {
+			t.Fatalf("Expected the delayed task held back, got %s", task.Title)
+		}
+
+		past := time.Now().Add(-time.Second)
+		due, _ := s.CreateTaskWithOptions("Was delayed", "", TaskOptions{NotBefore: &past})
+		if task, _, _ := s.AtomicClaimNext("w", 60, ClaimFilter{}); task == nil || task.ID != due.ID {
+			t.Errorf("Expected a task past its not_before claimable, got %+v", task)
+		}
+	})
+}
+
+func TestBackendPriority(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		c := clock.NewFake(time.Now())
+		s.SetClock(c)
+		create := func(title string, priority int) *models.Task {
+			task, _ := s.CreateTaskWithOptions(title, "", TaskOptions{Priority: priority})
+			c.Advance(time.Millisecond)
+			return task
+		}
+		create("Chore", -1)
+		create("Feature", 0)
+		hotfix := create("Hotfix", 10)
+		create("Refactor", 0)
+		create("Outage", 10)
+
+		if got, _ := s.GetTask(hotfix.ID); got.Priority != 10 {
+			t.Errorf("Expected priority round-tripped, got %d", got.Priority)
+		}
+		tasks, _ := s.ListTasks("")
+		var listed []string
+		for _, task := range tasks {
+			listed = append(listed, task.Title)
+		}
+		if got := strings.Join(listed, ","); got != "Outage,Hotfix,Refactor,Feature,Chore" {
+			t.Errorf("ListTasks order = %s, want by priority then newest first", got)
+		}
+
+		var claimed []string
+		for {
+			task, _, err := s.AtomicClaimNext("w", 60, ClaimFilter{})
+			if err != nil || task == nil {
+				break
+			}
+			claimed = append(claimed, task.Title)
+		}
+		if got := strings.Join(claimed, ","); got != "Hotfix,Outage,Feature,Refactor,Chore" {
+			t.Errorf("Claim order = %s, want by priority then oldest first", got)
+		}
+	})
+}
+
+func TestBackendChecklist(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		task, _ := s.CreateTaskWithOptions("Login", "", TaskOptions{AcceptanceCriteria: []string{"SSO works"}, Commands: []string{"go test ./..."}})
+		if got, _ := s.GetTask(task.ID); len(got.AcceptanceCriteria) != 1 || len(got.Commands) != 1 {
+			t.Errorf("Expected criteria and commands to round-trip, got %+v", got)
+		}
+
+		s.AddChecklistItems(task.ID, []string{"First", "Second"})
+		s.AddChecklistItems(task.ID, []string{"Third"})
+		items, err := s.ListChecklist(task.ID)
+		if err != nil || len(items) != 3 {
+			t.Fatalf("Expected 3 items, got %d (err=%v)", len(items), err)
+		}
+		for i, item := range items {
+			if item.Position != i+1 || item.Done {
+				t.Errorf("Item %d = %+v, want position %d unchecked", i, item, i+1)
+			}
+		}
+
+		item, err := s.SetChecklistItemDone(task.ID, items[1].ID, true, "alice")
+		if err != nil || item == nil || !item.Done || item.CheckedBy != "alice" || item.CheckedAt == nil {
+			t.Fatalf("Expected item checked by alice, got %+v (err=%v)", item, err)
+		}
+		item, _ = s.SetChecklistItemDone(task.ID, items[1].ID, false, "alice")
+		if item.Done || item.CheckedBy != "" || item.CheckedAt != nil {
+			t.Errorf("Expected item unchecked, got %+v", item)
+		}
+
+		// Items are only reachable through their own task
+		if item, _ := s.SetChecklistItemDone("other", items[0].ID, true, "alice"); item != nil {
+			t.Errorf("Expected no item for another task, got %+v", item)
+		}
+	})
+}
+
+func TestBackendLeadership(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s backend) {
+		if ok, err := s.AcquireLeadership("daemon", "a", "http://a", time.Minute); err != nil || !ok {
+			t.Fatalf("Expected a to become leader, got %v (err=%v)", ok, err)
+		}
+		if ok, _ := s.AcquireLeadership("daemon", "b", "http://b", time.Minute); ok {
+			t.Error("Expected b to be refused while a's lease is live")
+		}
+		l, _ := s.GetLeader("daemon")
+		if l == nil || l.HolderID != "a" || l.Addr != "http://a" {
+			t.Fatalf("Expected a as leader, got %+v", l)
+		}
+		acquired := l.AcquiredAt
+		if ok, _ := s.AcquireLeadership("daemon", "a", "http://a", time.Minute); !ok {
+			t.Error("Expected a to renew its own lease")
+		}
+		if l, _ := s.GetLeader("daemon"); !l.AcquiredAt.Equal(acquired) {
+			t.Errorf("Expected renewal to keep AcquiredAt, got %v want %v", l.AcquiredAt, acquired)
+		}
+
+		// An expired lease can be taken over
+		s.AcquireLeadership("daemon", "a", "http://a", -time.Second)
+		if l, _ := s.GetLeader("daemon"); l != nil {
+			t.Errorf("Expected no leader once the lease expired, got %+v", l)
+		}
+		if ok, _ := s.AcquireLeadership("daemon", "b", "http://b", time.Minute); !ok {
+			t.Error("Expected b to take over the expired lease")
+		}
+
+		// Only the holder can release
+		s.ReleaseLeadership("daemon", "a")
+		if l, _ := s.GetLeader("daemon"); l == nil || l.HolderID != "b" {
+			t.Errorf("Expected b to stay leader, got %+v", l)
+		}
+		s.ReleaseLeadership("daemon", "b")
+		if ok, _ := s.AcquireLeadership("daemon", "a", "", time.Minute); !ok {
+			t.Error("Expected a released lease to be free")
+		}
+	})
+}
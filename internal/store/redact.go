@@ -0,0 +1,90 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/redact"
+)
+
+// SetRedactor masks sensitive text in memory content and run output before
+// it is stored. Rows already stored are left as they are; see ScanContent.
+// Must be called before the store is shared - not safe for concurrent use.
+func (s *Store) SetRedactor(r *redact.Redactor) {
+	s.redactor = r
+}
+
+// Kinds of stored content ScanContent visits.
+const (
+	ContentMemory    = "memory"
+	ContentRunStdout = "run.stdout"
+	ContentRunStderr = "run.stderr"
+)
+
+// ContentRef says where a piece of stored content is.
+type ContentRef struct {
+	Kind   string // ContentMemory, ContentRunStdout or ContentRunStderr
+	ID     string // memory item or run ID
+	TaskID string
+}
+
+// ScanContent calls fn with every memory item's content and every run's
+// output, decrypted, so they can be audited for leaked secrets. It stops at
+// the first error fn returns.
+func (s *Store) ScanContent(fn func(ref ContentRef, content string) error) error {
+	rows, err := s.rdb.Query(`SELECT ` + memoryColumns + ` FROM memory_items ORDER BY created_at`)
+	if err != nil {
+		return fmt.Errorf("query memory: %w", err)
+	}
+	var fnErr error
+	_, err = s.scanMemoryItems(rows, func(item *models.MemoryItem) bool {
+		if fnErr == nil {
+			fnErr = fn(ContentRef{Kind: ContentMemory, ID: item.ID, TaskID: item.TaskID}, item.Content)
+		}
+		return false
+	})
+	rows.Close()
+	if err != nil {
+		return err
+	}
+	if fnErr != nil {
+		return fnErr
+	}
+
+	// Run IDs are read first so loading output never holds two read
+	// connections at once
+	rows, err = s.rdb.Query(`SELECT id FROM runs ORDER BY started_at`)
+	if err != nil {
+		return fmt.Errorf("query runs: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan run: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		run, err := s.GetRun(id)
+		if err != nil {
+			return err
+		}
+		if run == nil {
+			continue
+		}
+		if err := fn(ContentRef{Kind: ContentRunStdout, ID: run.ID, TaskID: run.TaskID}, run.Stdout); err != nil {
+			return err
+		}
+		if err := fn(ContentRef{Kind: ContentRunStderr, ID: run.ID, TaskID: run.TaskID}, run.Stderr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
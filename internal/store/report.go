@@ -0,0 +1,122 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// PDRCount aggregates Process Decision Records by action and outcome.
+type PDRCount struct {
+	Action  string `json:"action"`
+	Outcome string `json:"outcome"`
+	Count   int    `json:"count"`
+}
+
+// ListTasksUpdatedBetween returns tasks in one of statuses whose last update
+// falls in [since, until), most recent first.
+func (s *Store) ListTasksUpdatedBetween(since, until time.Time, statuses ...models.TaskStatus) ([]models.Task, error) {
+	query := `SELECT ` + taskColumns + ` FROM tasks WHERE updated_at >= ? AND updated_at < ?`
+	args := []interface{}{since.UTC(), until.UTC()}
+	if len(statuses) > 0 {
+		query += ` AND status IN (?` + strings.Repeat(`, ?`, len(statuses)-1) + `)`
+		for _, st := range statuses {
+			args = append(args, string(st))
+		}
+	}
+	query += ` ORDER BY updated_at DESC`
+
+	rows, err := s.rdb.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []models.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, *task)
+	}
+	return tasks, rows.Err()
+}
+
+// ListRunsBetween returns runs that started in [since, until), newest first.
+// Output is not loaded; use GetRunsForTask for stdout and stderr.
+func (s *Store) ListRunsBetween(since, until time.Time) ([]models.Run, error) {
+	rows, err := s.rdb.Query(
+		`SELECT id, task_id, command, args, exit_code, started_at, ended_at FROM runs WHERE started_at >= ? AND started_at < ? ORDER BY started_at DESC`,
+		since.UTC(), until.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []models.Run
+	for rows.Next() {
+		var run models.Run
+		var argsJSON sql.NullString
+		var exitCode sql.NullInt64
+		var endedAt sql.NullTime
+		if err := rows.Scan(&run.ID, &run.TaskID, &run.Command, &argsJSON, &exitCode, &run.StartedAt, &endedAt); err != nil {
+			return nil, fmt.Errorf("scan run: %w", err)
+		}
+		if argsJSON.String != "" {
+			json.Unmarshal([]byte(argsJSON.String), &run.Args)
+		}
+		run.ExitCode = int(exitCode.Int64)
+		if endedAt.Valid {
+			run.EndedAt = endedAt.Time
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// CountPDRBetween counts decision records in [since, until) by action and
+// outcome, most frequent first.
+func (s *Store) CountPDRBetween(since, until time.Time) ([]PDRCount, error) {
+	rows, err := s.rdb.Query(
+		`SELECT action, outcome, COUNT(*) FROM pdr WHERE timestamp >= ? AND timestamp < ? GROUP BY action, outcome ORDER BY COUNT(*) DESC, action`,
+		since.UTC(), until.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query pdr: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []PDRCount
+	for rows.Next() {
+		var c PDRCount
+		if err := rows.Scan(&c.Action, &c.Outcome, &c.Count); err != nil {
+			return nil, fmt.Errorf("scan pdr count: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// LatestMemoryWithTag returns the newest memory item carrying tag, or nil.
+func (s *Store) LatestMemoryWithTag(tag string) (*models.MemoryItem, error) {
+	rows, err := s.rdb.Query(
+		`SELECT `+memoryColumns+` FROM memory_items WHERE ',' || REPLACE(tags, ' ', '') || ',' LIKE ? ESCAPE '\' ORDER BY created_at DESC LIMIT 1`,
+		"%,"+likeEscaper.Replace(tag)+",%",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query memory by tag: %w", err)
+	}
+	defer rows.Close()
+
+	items, err := s.scanMemoryItems(rows, nil)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return &items[0], nil
+}
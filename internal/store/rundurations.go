@@ -0,0 +1,49 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// TaskRunDurations returns how long each of the last limit finished tasks
+// carrying label spent running, newest first: the total time of its
+// finished runs. Tasks without a finished run are left out, so fewer than
+// limit durations may come back.
+func (s *Store) TaskRunDurations(label string, limit int) ([]time.Duration, error) {
+	rows, err := s.rdb.Query(
+		`SELECT t.id, r.started_at, r.ended_at FROM (
+			SELECT id, updated_at FROM tasks WHERE labels LIKE ? ESCAPE '\' AND status IN (?, ?) ORDER BY updated_at DESC LIMIT ?
+		) t JOIN runs r ON r.task_id = t.id WHERE r.ended_at IS NOT NULL ORDER BY t.updated_at DESC, t.id`,
+		"%,"+likeEscaper.Replace(label)+",%", models.TaskStatusCompleted, models.TaskStatusFailed, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query run durations: %w", err)
+	}
+	defer rows.Close()
+
+	var durations []time.Duration
+	last := ""
+	for rows.Next() {
+		var taskID string
+		var started time.Time
+		var ended sql.NullTime
+		if err := rows.Scan(&taskID, &started, &ended); err != nil {
+			return nil, fmt.Errorf("scan run duration: %w", err)
+		}
+		d := ended.Time.Sub(started)
+		if d < 0 {
+			d = 0
+		}
+		// Rows come grouped by task
+		if taskID == last {
+			durations[len(durations)-1] += d
+			continue
+		}
+		durations = append(durations, d)
+		last = taskID
+	}
+	return durations, rows.Err()
+}
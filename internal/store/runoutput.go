@@ -0,0 +1,136 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// DefaultRunOutputLimit is how many bytes of each output stream a run keeps
+// unless SetRunOutputLimit says otherwise.
+const DefaultRunOutputLimit = 1 << 20
+
+// RunChunkSize is the size of the rows run output is split into, so no
+// single value grows with a verbose command.
+const RunChunkSize = 64 << 10
+
+// Output streams as stored in run_output.stream.
+const (
+	streamStdout = "stdout"
+	streamStderr = "stderr"
+)
+
+// SetRunOutputLimit caps how many bytes of stdout and of stderr are kept
+// per run; output past the cap is dropped and the run marked truncated.
+// A limit of 0 or less keeps everything.
+// Must be called before the store is shared - not safe for concurrent use.
+func (s *Store) SetRunOutputLimit(n int) {
+	s.outputLimit = n
+}
+
+// FinishRun records a run's exit code and output and sets its end time.
+// Secrets in the output are masked (see SetRedactor), output over the
+// store's limit is cut and run.Truncated set; run is updated in place to
+// match what was stored.
+func (s *Store) FinishRun(run *models.Run) error {
+	run.Stdout, run.Stderr = s.redactor.Redact(run.Stdout), s.redactor.Redact(run.Stderr)
+	var cut bool
+	run.Stdout, cut = capOutput(run.Stdout, s.outputLimit)
+	run.Truncated = run.Truncated || cut
+	run.Stderr, cut = capOutput(run.Stderr, s.outputLimit)
+	run.Truncated = run.Truncated || cut
+	run.EndedAt = s.now()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM run_output WHERE run_id = ?`, run.ID); err != nil {
+		return fmt.Errorf("clear run output: %w", err)
+	}
+	for _, out := range []struct{ stream, data string }{{streamStdout, run.Stdout}, {streamStderr, run.Stderr}} {
+		for seq, chunk := range splitChunks(out.data, RunChunkSize) {
+			sealed, err := s.encrypt(chunk)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(
+				`INSERT INTO run_output (run_id, stream, seq, data) VALUES (?, ?, ?, ?)`,
+				run.ID, out.stream, seq, sealed,
+			); err != nil {
+				return fmt.Errorf("insert run output: %w", err)
+			}
+		}
+	}
+	if _, err := tx.Exec(
+		`UPDATE runs SET exit_code = ?, stdout = NULL, stderr = NULL, truncated = ?, ended_at = ? WHERE id = ?`,
+		run.ExitCode, run.Truncated, run.EndedAt, run.ID,
+	); err != nil {
+		return fmt.Errorf("update run: %w", err)
+	}
+	return s.commit(tx)
+}
+
+// loadRunOutput fills in output stored in run_output. Runs recorded before
+// output was chunked keep it in the runs table and have no chunks.
+func (s *Store) loadRunOutput(run *models.Run) error {
+	rows, err := s.rdb.Query(`SELECT stream, data FROM run_output WHERE run_id = ? ORDER BY stream, seq`, run.ID)
+	if err != nil {
+		return fmt.Errorf("query run output: %w", err)
+	}
+	defer rows.Close()
+
+	var stdout, stderr strings.Builder
+	for rows.Next() {
+		var stream, sealed string
+		if err := rows.Scan(&stream, &sealed); err != nil {
+			return fmt.Errorf("scan run output: %w", err)
+		}
+		chunk, err := s.decrypt(sealed)
+		if err != nil {
+			return err
+		}
+		if stream == streamStderr {
+			stderr.WriteString(chunk)
+		} else {
+			stdout.WriteString(chunk)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query run output: %w", err)
+	}
+	if stdout.Len() > 0 || stderr.Len() > 0 {
+		run.Stdout, run.Stderr = stdout.String(), stderr.String()
+	}
+	return nil
+}
+
+// capOutput cuts s to at most limit bytes without splitting a UTF-8
+// sequence. It reports whether anything was cut.
+func capOutput(s string, limit int) (string, bool) {
+	if limit <= 0 || len(s) <= limit {
+		return s, false
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut], true
+}
+
+// splitChunks splits s into pieces of at most size bytes.
+func splitChunks(s string, size int) []string {
+	var chunks []string
+	for len(s) > size {
+		chunks = append(chunks, s[:size])
+		s = s[size:]
+	}
+	if s != "" {
+		chunks = append(chunks, s)
+	}
+	return chunks
+}
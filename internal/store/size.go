@@ -0,0 +1,40 @@
+package store
+
+import "fmt"
+
+// Tables counted by Size, the ones that grow with use.
+const (
+	TableTasks     = "tasks"
+	TableRuns      = "runs"
+	TableRunOutput = "run_output"
+	TablePDR       = "pdr"
+	TableMemory    = "memory_items"
+	TableEvents    = "events"
+)
+
+var sizedTables = []string{TableTasks, TableRuns, TableRunOutput, TablePDR, TableMemory, TableEvents}
+
+// SizeStats is how much the database holds.
+type SizeStats struct {
+	// Bytes is the size of the database file, without its write-ahead log.
+	Bytes int64 `json:"bytes"`
+	// Rows counts the rows of the tables that grow with use, by table name.
+	Rows map[string]int64 `json:"rows"`
+}
+
+// Size reports the database file size and row counts. Counting scans each
+// table, so call it every few minutes at most.
+func (s *Store) Size() (*SizeStats, error) {
+	stats := &SizeStats{Rows: make(map[string]int64, len(sizedTables))}
+	if err := s.rdb.QueryRow(`SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()`).Scan(&stats.Bytes); err != nil {
+		return nil, fmt.Errorf("query size: %w", err)
+	}
+	for _, table := range sizedTables {
+		var n int64
+		if err := s.rdb.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+			return nil, fmt.Errorf("count %s: %w", table, err)
+		}
+		stats.Rows[table] = n
+	}
+	return stats, nil
+}
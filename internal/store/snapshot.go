@@ -0,0 +1,170 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// Snapshot is the portable content of a store: its tasks, memory and audit
+// trail. Leases, locks, runs, comments, checklists and events stay behind.
+type Snapshot struct {
+	Tasks  []models.Task
+	Memory []models.MemoryItem
+	PDR    []models.PDREntry
+}
+
+// RestoreResult counts the rows Restore inserted, and those it skipped
+// because the store already had them.
+type RestoreResult struct {
+	Tasks   int `json:"tasks"`
+	Memory  int `json:"memory"`
+	PDR     int `json:"pdr"`
+	Skipped int `json:"skipped"`
+}
+
+// Snapshot reads every task, memory item (decrypted) and PDR, oldest first.
+func (s *Store) Snapshot() (*Snapshot, error) {
+	snap := &Snapshot{}
+	rows, err := s.rdb.Query(`SELECT ` + taskColumns + ` FROM tasks ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("query tasks: %w", err)
+	}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan task: %w", err)
+		}
+		snap.Tasks = append(snap.Tasks, *task)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.rdb.Query(`SELECT ` + memoryColumns + ` FROM memory_items ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("query memory: %w", err)
+	}
+	snap.Memory, err = s.scanMemoryItems(rows, nil)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = s.rdb.Query(`SELECT id, action, inputs_hash, outcome, task_id, details, timestamp FROM pdr ORDER BY timestamp`)
+	if err != nil {
+		return nil, fmt.Errorf("query pdr: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e models.PDREntry
+		var task, details sql.NullString
+		if err := rows.Scan(&e.ID, &e.Action, &e.InputsHash, &e.Outcome, &task, &details, &e.Timestamp); err != nil {
+			return nil, fmt.Errorf("scan pdr: %w", err)
+		}
+		e.TaskID, e.Details = task.String, details.String
+		snap.PDR = append(snap.PDR, e)
+	}
+	return snap, rows.Err()
+}
+
+// snapshotTables are emptied by a replacing Restore, children first.
+var snapshotTables = []string{
+	"run_output", "runs", "leases", "locks", "worker_state", "events",
+	"task_comments", "task_checklist", "tasks", "memory_items", "pdr",
+}
+
+// Restore writes a snapshot in one transaction. With replace, the tasks,
+// memory and audit trail are deleted first, along with everything attached
+// to tasks. Otherwise the snapshot is merged: rows whose ID the store
+// already has are skipped, as are memory items duplicating one in their
+// scope. Claimed and running tasks are restored as pending, since their
+// leases are not part of a snapshot.
+func (s *Store) Restore(snap *Snapshot, replace bool) (*RestoreResult, error) {
+	if !s.hashesBackfilled.Load() {
+		if err := s.backfillMemoryHashes(); err != nil {
+			return nil, err
+		}
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if replace {
+		for _, table := range snapshotTables {
+			if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+				return nil, fmt.Errorf("clear %s: %w", table, err)
+			}
+		}
+	}
+
+	res := &RestoreResult{}
+	count := func(r sql.Result, n *int) {
+		if affected, _ := r.RowsAffected(); affected > 0 {
+			*n++
+		} else {
+			res.Skipped++
+		}
+	}
+	for _, t := range snap.Tasks {
+		if t.Status == models.TaskStatusClaimed || t.Status == models.TaskStatusRunning {
+			t.Status, t.ClaimedBy, t.ClaimedAt = models.TaskStatusPending, "", nil
+		}
+		r, err := tx.Exec(`INSERT OR IGNORE INTO tasks (`+taskColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			t.ID, t.Title, t.Description, t.Status, nullString(t.ClaimedBy), nullTime(t.ClaimedAt), t.CreatedAt, t.UpdatedAt,
+			nullString(t.MutexKey), nullString(joinLabels(t.Labels)), nullString(t.Connector), nullString(t.WorkDir), nullString(t.PRURL),
+			nullString(joinList(t.AcceptanceCriteria)), nullString(joinList(t.Commands)), nullString(t.ParentID),
+			nullInt(t.EstimateSec), nullTime(t.DueAt), nullTime(t.SLABreachedAt), nullTime(t.NotBefore), nullString(joinSteps(t.Steps)), t.Priority,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("insert task %s: %w", t.ID, err)
+		}
+		count(r, &res.Tasks)
+	}
+
+	for _, item := range snap.Memory {
+		if item.Scope == "" {
+			item.Scope = models.DefaultMemoryScope(item.TaskID)
+		}
+		if item.SeenCount < 1 {
+			item.SeenCount = 1
+		}
+		item.Content = s.redactor.Redact(item.Content)
+		hash := s.memoryHash(item.Content)
+		if item.Source == "" {
+			dupID, err := s.findDuplicate(tx, &item, hash)
+			if err != nil {
+				return nil, err
+			}
+			if dupID != "" {
+				res.Skipped++
+				continue
+			}
+		}
+		sealed, err := s.encrypt(item.Content)
+		if err != nil {
+			return nil, err
+		}
+		r, err := tx.Exec(`INSERT OR IGNORE INTO memory_items (id, task_id, content, tags, created_at, scope, content_hash, source, source_hash, seen_count, last_seen_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			item.ID, item.TaskID, sealed, item.Tags, item.CreatedAt, item.Scope, hash, item.Source, item.SourceHash, item.SeenCount, nullTime(item.LastSeenAt))
+		if err != nil {
+			return nil, fmt.Errorf("insert memory %s: %w", item.ID, err)
+		}
+		count(r, &res.Memory)
+	}
+
+	for _, e := range snap.PDR {
+		r, err := tx.Exec(`INSERT OR IGNORE INTO pdr (id, action, inputs_hash, outcome, task_id, details, timestamp) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			e.ID, e.Action, e.InputsHash, e.Outcome, e.TaskID, e.Details, e.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("insert pdr %s: %w", e.ID, err)
+		}
+		count(r, &res.PDR)
+	}
+	return res, s.commit(tx)
+}
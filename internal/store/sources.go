@@ -0,0 +1,60 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/google/uuid"
+)
+
+// ListSourcedMemory returns the items in scope synced from files, oldest
+// first.
+func (s *Store) ListSourcedMemory(scope string) ([]models.MemoryItem, error) {
+	rows, err := s.rdb.Query(
+		`SELECT `+memoryColumns+` FROM memory_items WHERE scope = ? AND COALESCE(source, '') <> '' ORDER BY created_at`,
+		scope,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query sourced memory: %w", err)
+	}
+	defer rows.Close()
+	return s.scanMemoryItems(rows, nil)
+}
+
+// PutSourcedMemory stores an item synced from a file, replacing the item
+// previously synced from the same source into its scope. Unlike
+// AddMemoryBatch it never merges the item into a duplicate, so each source
+// keeps exactly one item.
+func (s *Store) PutSourcedMemory(item models.MemoryItem) (*models.MemoryItem, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM memory_items WHERE scope = ? AND source = ?`, item.Scope, item.Source); err != nil {
+		return nil, fmt.Errorf("delete sourced memory: %w", err)
+	}
+	item.ID = uuid.New().String()
+	item.Content = s.redactor.Redact(item.Content)
+	item.CreatedAt = s.now()
+	item.SeenCount = 1
+	sealed, err := s.encrypt(item.Content)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Stmt(s.stmts.insertMemory).Exec(item.ID, item.TaskID, sealed, item.Tags, item.CreatedAt, item.Scope,
+		s.memoryHash(item.Content), item.Source, item.SourceHash); err != nil {
+		return nil, fmt.Errorf("insert memory: %w", err)
+	}
+	if err := s.commit(tx); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return &item, nil
+}
+
+// DeleteSourcedMemory deletes the item synced from source into scope.
+func (s *Store) DeleteSourcedMemory(scope, source string) error {
+	_, err := s.exec(`DELETE FROM memory_items WHERE scope = ? AND source = ?`, scope, source)
+	return err
+}
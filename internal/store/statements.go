@@ -0,0 +1,101 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// nextPendingQuery selects the claimable task of highest priority, oldest
+// first within a priority, skipping tasks whose
+// mutex key is currently locked, tasks still under a live lease, tasks
+// delayed until a later time and parent tasks, whose work is their
+// subtasks. Callers append extra filters before nextPendingOrder.
+const (
+	nextPendingQuery = `SELECT ` + taskColumns + ` FROM tasks
+		 WHERE status = ? AND claimed_by IS NULL
+		 AND (mutex_key IS NULL OR mutex_key = '' OR ('mutex:' || mutex_key) NOT IN
+		      (SELECT resource_id FROM locks WHERE expires_at > ?))
+		 AND NOT EXISTS (SELECT 1 FROM leases WHERE leases.task_id = tasks.id AND leases.expires_at > ?)
+		 AND (not_before IS NULL OR not_before <= ?)
+		 AND NOT EXISTS (SELECT 1 FROM tasks sub WHERE sub.parent_task_id = tasks.id)`
+	nextPendingOrder = ` ORDER BY priority DESC, created_at ASC LIMIT 1`
+)
+
+// statements holds precompiled SQL for the hot claim, lease and audit paths.
+// Inside a transaction use tx.Stmt to bind them to the transaction.
+type statements struct {
+	getTask       *sql.Stmt
+	nextPending   *sql.Stmt
+	claimTask     *sql.Stmt
+	insertLease   *sql.Stmt
+	clearExpired  *sql.Stmt
+	activeLeaseID *sql.Stmt
+	renewLease    *sql.Stmt
+	insertPDR     *sql.Stmt
+	insertMemory  *sql.Stmt
+}
+
+func prepareStatements(db *sql.DB) (*statements, error) {
+	st := &statements{}
+	defs := []struct {
+		dst   **sql.Stmt
+		query string
+	}{
+		{&st.getTask, `SELECT ` + taskColumns + ` FROM tasks WHERE id = ?`},
+		{&st.nextPending, nextPendingQuery + nextPendingOrder},
+		{&st.claimTask, `UPDATE tasks SET status = ?, claimed_by = ?, claimed_at = ?, updated_at = ? WHERE id = ? AND status = ?`},
+		{&st.insertLease, `INSERT INTO leases (id, task_id, holder_id, ttl_sec, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)`},
+		{&st.clearExpired, `DELETE FROM leases WHERE task_id = ? AND expires_at <= ?`},
+		{&st.activeLeaseID, `SELECT id FROM leases WHERE task_id = ? AND expires_at > ?`},
+		{&st.renewLease, `UPDATE leases SET expires_at = ? WHERE id = ?`},
+		{&st.insertPDR, `INSERT INTO pdr (id, action, inputs_hash, outcome, task_id, details, timestamp) VALUES (?, ?, ?, ?, ?, ?, ?)`},
+		{&st.insertMemory, `INSERT INTO memory_items (id, task_id, content, tags, created_at, scope, content_hash, source, source_hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`},
+	}
+	for _, d := range defs {
+		stmt, err := db.Prepare(d.query)
+		if err != nil {
+			st.close()
+			return nil, fmt.Errorf("prepare %q: %w", d.query, err)
+		}
+		*d.dst = stmt
+	}
+	return st, nil
+}
+
+func (st *statements) close() {
+	for _, stmt := range []*sql.Stmt{
+		st.getTask, st.nextPending, st.claimTask, st.insertLease, st.clearExpired,
+		st.activeLeaseID, st.renewLease, st.insertPDR, st.insertMemory,
+	} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
+
+// readStatements holds precompiled SQL for hot reads on the read-only pool.
+type readStatements struct {
+	getTask        *sql.Stmt
+	getActiveLease *sql.Stmt
+}
+
+func prepareReadStatements(db *sql.DB) (*readStatements, error) {
+	rs := &readStatements{}
+	var err error
+	if rs.getTask, err = db.Prepare(`SELECT ` + taskColumns + ` FROM tasks WHERE id = ?`); err != nil {
+		return nil, fmt.Errorf("prepare get task: %w", err)
+	}
+	if rs.getActiveLease, err = db.Prepare(`SELECT id, task_id, holder_id, ttl_sec, expires_at, created_at, COALESCE(token_hash, '') FROM leases WHERE task_id = ? AND expires_at > ? ORDER BY created_at DESC LIMIT 1`); err != nil {
+		rs.close()
+		return nil, fmt.Errorf("prepare get active lease: %w", err)
+	}
+	return rs, nil
+}
+
+func (rs *readStatements) close() {
+	for _, stmt := range []*sql.Stmt{rs.getTask, rs.getActiveLease} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
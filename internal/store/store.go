@@ -9,16 +9,55 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/fentz26/neona/internal/clock"
 	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/redact"
 	"github.com/google/uuid"
 	_ "modernc.org/sqlite"
 )
 
 // Store provides access to the Neona SQLite database.
+//
+// Locking model: the database runs in WAL mode and is opened twice.
+//   - db is the writer pool, capped at one connection. Every write and every
+//     read-then-write transaction (claims, lock acquisition, idempotency
+//     keys) goes through it, so SQLite never sees competing writers and
+//     transactions serialize in Go rather than on SQLITE_BUSY.
+//   - rdb is a read-only pool (query_only) used by List/Get/Query paths.
+//     WAL lets these readers run concurrently with each other and with the
+//     writer; each sees the last committed state, so a read issued after a
+//     write returns observes it.
 type Store struct {
-	db *sql.DB
+	db     *sql.DB
+	rdb    *sql.DB
+	stmts  *statements
+	rstmts *readStatements
+
+	// cipher, when set, seals memory content and run output at rest.
+	cipher *Cipher
+	// redactor, when set, masks secrets in memory content and run output
+	// before they are stored.
+	redactor *redact.Redactor
+
+	// outputLimit caps the bytes kept per run output stream.
+	outputLimit int
+
+	// clock stamps records and decides lease and lock expiry.
+	clock clock.Clock
+
+	// fuzzyDedup is the similarity at which memory content counts as a
+	// duplicate (0 merges exact duplicates only).
+	fuzzyDedup float64
+	// hashesBackfilled is set once items from before deduplication have
+	// content hashes.
+	hashesBackfilled atomic.Bool
+
+	// gen is bumped after every successful write so callers can cheaply
+	// tell whether data they cached is still current.
+	gen atomic.Uint64
 }
 
 // New creates a new Store and runs migrations.
@@ -29,33 +68,80 @@ func New(dbPath string) (*Store, error) {
 		return nil, fmt.Errorf("create db directory: %w", err)
 	}
 
-	// Open with WAL mode for better concurrency
-	db, err := sql.Open("sqlite", dbPath+"?_journal_mode=WAL&_busy_timeout=5000&_synchronous=NORMAL")
+	// Open the writer with WAL mode so readers don't block behind it
+	db, err := sql.Open("sqlite", dbPath+"?"+sqlitePragmas)
 	if err != nil {
 		return nil, fmt.Errorf("open db: %w", err)
 	}
-
-	// Set connection pool settings for concurrent access
 	db.SetMaxOpenConns(1) // SQLite only supports one writer at a time
 	db.SetMaxIdleConns(1)
 
-	s := &Store{db: db}
+	s := &Store{db: db, outputLimit: DefaultRunOutputLimit, clock: clock.Real}
 	if err := s.migrate(); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("migrate: %w", err)
 	}
 
+	// Open the read-only pool once the schema exists
+	rdb, err := sql.Open("sqlite", dbPath+"?"+sqlitePragmas+"&_pragma=query_only(1)")
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open read db: %w", err)
+	}
+	rdb.SetMaxOpenConns(maxReadConns)
+	rdb.SetMaxIdleConns(maxReadConns)
+	s.rdb = rdb
+
+	if s.stmts, err = prepareStatements(db); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("prepare statements: %w", err)
+	}
+	if s.rstmts, err = prepareReadStatements(rdb); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("prepare read statements: %w", err)
+	}
+
 	return s, nil
 }
 
-// Close closes the database connection.
+// SetClock replaces the clock that stamps records and expires leases,
+// locks and leadership, so tests can move time on instead of sleeping.
+// Must be called before the store is shared - not safe for concurrent use.
+func (s *Store) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// now returns the store's current time.
+func (s *Store) now() time.Time {
+	return s.clock.Now()
+}
+
+// sqlitePragmas are applied to every connection in both pools.
+const sqlitePragmas = "_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)"
+
+// maxReadConns caps the read-only pool.
+const maxReadConns = 4
+
+// Close closes the database connections.
 func (s *Store) Close() error {
+	if s.stmts != nil {
+		s.stmts.close()
+	}
+	if s.rstmts != nil {
+		s.rstmts.close()
+	}
+	if s.rdb != nil {
+		s.rdb.Close()
+	}
 	return s.db.Close()
 }
 
-// Ping checks the database connection is alive.
+// Ping checks both database pools are alive.
 func (s *Store) Ping(ctx context.Context) error {
-	return s.db.PingContext(ctx)
+	if err := s.db.PingContext(ctx); err != nil {
+		return err
+	}
+	return s.rdb.PingContext(ctx)
 }
 
 // migrate runs idempotent schema migrations.
@@ -104,6 +190,15 @@ func (s *Store) migrate() error {
 		FOREIGN KEY (task_id) REFERENCES tasks(id)
 	);
 
+	CREATE TABLE IF NOT EXISTS run_output (
+		run_id TEXT NOT NULL,
+		stream TEXT NOT NULL,
+		seq INTEGER NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (run_id, stream, seq),
+		FOREIGN KEY (run_id) REFERENCES runs(id)
+	);
+
 	CREATE TABLE IF NOT EXISTS pdr (
 		id TEXT PRIMARY KEY,
 		action TEXT NOT NULL,
@@ -122,21 +217,357 @@ func (s *Store) migrate() error {
 		created_at DATETIME NOT NULL
 	);
 
+	CREATE TABLE IF NOT EXISTS worker_state (
+		worker_id TEXT PRIMARY KEY,
+		task_id TEXT NOT NULL,
+		lease_id TEXT,
+		connector TEXT,
+		state TEXT NOT NULL,
+		started_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		scope TEXT NOT NULL,
+		key TEXT NOT NULL,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		response BLOB,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (scope, key)
+	);
+
+	CREATE TABLE IF NOT EXISTS events (
+		id TEXT PRIMARY KEY,
+		type TEXT NOT NULL,
+		task_id TEXT,
+		holder_id TEXT,
+		payload TEXT,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS task_comments (
+		id TEXT PRIMARY KEY,
+		task_id TEXT NOT NULL,
+		author TEXT NOT NULL,
+		body TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY (task_id) REFERENCES tasks(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS task_checklist (
+		id TEXT PRIMARY KEY,
+		task_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		text TEXT NOT NULL,
+		done INTEGER NOT NULL DEFAULT 0,
+		checked_by TEXT,
+		checked_at DATETIME,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY (task_id) REFERENCES tasks(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS leader_leases (
+		name TEXT PRIMARY KEY,
+		holder_id TEXT NOT NULL,
+		addr TEXT,
+		acquired_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL
+	);
+
 	CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks(status);
-	CREATE INDEX IF NOT EXISTS idx_leases_task_id ON leases(task_id);
 	CREATE INDEX IF NOT EXISTS idx_runs_task_id ON runs(task_id);
 	CREATE INDEX IF NOT EXISTS idx_memory_items_task_id ON memory_items(task_id);
+	CREATE INDEX IF NOT EXISTS idx_events_holder_id ON events(holder_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_task_comments_task_id ON task_comments(task_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_task_checklist_task_id ON task_checklist(task_id, position);
+	CREATE INDEX IF NOT EXISTS idx_pdr_task_id ON pdr(task_id, timestamp);
 	`
 
-	_, err := s.db.Exec(schema)
+	if _, err := s.db.Exec(schema); err != nil {
+		return err
+	}
+
+	// Columns added after the initial schema
+	columns := []struct{ table, column, def string }{
+		{"tasks", "mutex_key", "TEXT"},
+		{"tasks", "labels", "TEXT"},
+		{"tasks", "connector", "TEXT"},
+		{"leases", "token_hash", "TEXT"},
+		{"tasks", "workdir", "TEXT"},
+		{"tasks", "pr_url", "TEXT"},
+		{"runs", "diff", "TEXT"},
+		{"runs", "truncated", "INTEGER NOT NULL DEFAULT 0"},
+		{"tasks", "acceptance_criteria", "TEXT"},
+		{"tasks", "commands", "TEXT"},
+		{"tasks", "parent_task_id", "TEXT"},
+		{"tasks", "estimate_sec", "INTEGER"},
+		{"tasks", "due_at", "DATETIME"},
+		{"tasks", "sla_breached_at", "DATETIME"},
+		{"tasks", "not_before", "DATETIME"},
+		{"tasks", "steps", "TEXT"},
+		{"tasks", "priority", "INTEGER NOT NULL DEFAULT 0"},
+		{"runs", "retry_of", "TEXT"},
+		{"worker_state", "instance_id", "TEXT NOT NULL DEFAULT ''"},
+		{"idempotency_keys", "request_hash", "TEXT"},
+		{"memory_items", "scope", "TEXT"},
+		{"memory_items", "content_hash", "TEXT"},
+		{"memory_items", "seen_count", "INTEGER NOT NULL DEFAULT 1"},
+		{"memory_items", "last_seen_at", "DATETIME"},
+		{"memory_items", "source", "TEXT"},
+		{"memory_items", "source_hash", "TEXT"},
+	}
+	for _, c := range columns {
+		if err := s.addColumnIfMissing(c.table, c.column, c.def); err != nil {
+			return err
+		}
+	}
+
+	// Indexes on added columns
+	if _, err := s.db.Exec(`
+	CREATE INDEX IF NOT EXISTS idx_tasks_parent ON tasks(parent_task_id);
+	CREATE INDEX IF NOT EXISTS idx_tasks_due_at ON tasks(due_at);
+	CREATE INDEX IF NOT EXISTS idx_tasks_not_before ON tasks(not_before);
+	CREATE INDEX IF NOT EXISTS idx_tasks_claim_order ON tasks(status, priority DESC, created_at);
+	CREATE INDEX IF NOT EXISTS idx_memory_items_scope ON memory_items(scope, created_at);
+	CREATE INDEX IF NOT EXISTS idx_memory_items_hash ON memory_items(content_hash, scope);
+	CREATE INDEX IF NOT EXISTS idx_memory_items_source ON memory_items(scope, source);
+	`); err != nil {
+		return err
+	}
+
+	// Memory items from before scopes get the scope new items default to
+	if _, err := s.db.Exec(`UPDATE memory_items SET scope = CASE WHEN task_id IS NULL OR task_id = '' THEN ? ELSE ? || task_id END WHERE scope IS NULL`,
+		models.MemoryScopeGlobal, models.MemoryScopeTask); err != nil {
+		return err
+	}
+
+	return s.migrateLeases()
+}
+
+// migrateLeases enforces one lease row per task. SQLite cannot index only
+// unexpired rows, so expired leases are cleared whenever a task is leased
+// again (see insertLease) and the unique index covers the rest. Databases
+// from older versions may hold expired or overlapping leases; those are
+// dropped first, keeping the newest lease on each task.
+func (s *Store) migrateLeases() error {
+	if _, err := s.db.Exec(`DELETE FROM leases WHERE expires_at <= ?`, s.now()); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`
+	DELETE FROM leases WHERE EXISTS (
+		SELECT 1 FROM leases newer WHERE newer.task_id = leases.task_id
+		AND (newer.created_at > leases.created_at OR (newer.created_at = leases.created_at AND newer.rowid > leases.rowid)));
+	DROP INDEX IF EXISTS idx_leases_task_id;
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_leases_task_id_unique ON leases(task_id);
+	`)
+	return err
+}
+
+// Generation returns a counter that changes whenever the store is written.
+func (s *Store) Generation() uint64 {
+	return s.gen.Load()
+}
+
+// exec runs a write statement and bumps the generation.
+func (s *Store) exec(query string, args ...interface{}) (sql.Result, error) {
+	res, err := s.db.Exec(query, args...)
+	if err == nil {
+		s.gen.Add(1)
+	}
+	return res, err
+}
+
+// execStmt runs a prepared write statement and bumps the generation.
+func (s *Store) execStmt(stmt *sql.Stmt, args ...interface{}) (sql.Result, error) {
+	res, err := stmt.Exec(args...)
+	if err == nil {
+		s.gen.Add(1)
+	}
+	return res, err
+}
+
+// commit commits a write transaction and bumps the generation.
+func (s *Store) commit(tx *sql.Tx) error {
+	err := tx.Commit()
+	if err == nil {
+		s.gen.Add(1)
+	}
 	return err
 }
 
+// addColumnIfMissing adds a column to an existing table unless it is already present.
+func (s *Store) addColumnIfMissing(table, column, def string) error {
+	rows, err := s.db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return fmt.Errorf("inspect %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("inspect %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("inspect %s: %w", table, err)
+	}
+	rows.Close()
+
+	if _, err := s.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, def)); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
 // --- Task Operations ---
 
+// taskColumns is the column list read by scanTask.
+const taskColumns = `id, title, description, status, claimed_by, claimed_at, created_at, updated_at, mutex_key, labels, connector, workdir, pr_url, acceptance_criteria, commands, parent_task_id, estimate_sec, due_at, sla_breached_at, not_before, steps, priority`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTask scans a row selected with taskColumns into a task.
+func scanTask(row rowScanner) (*models.Task, error) {
+	task := &models.Task{}
+	var claimedAt, dueAt, breachedAt, notBefore sql.NullTime
+	var estimate sql.NullInt64
+	var claimedBy, mutexKey, labels, connector, workDir, prURL, criteria, commands, parentID, steps sql.NullString
+
+	if err := row.Scan(&task.ID, &task.Title, &task.Description, &task.Status, &claimedBy, &claimedAt, &task.CreatedAt, &task.UpdatedAt, &mutexKey, &labels, &connector, &workDir, &prURL, &criteria, &commands, &parentID, &estimate, &dueAt, &breachedAt, &notBefore, &steps, &task.Priority); err != nil {
+		return nil, err
+	}
+	if claimedBy.Valid {
+		task.ClaimedBy = claimedBy.String
+	}
+	if claimedAt.Valid {
+		task.ClaimedAt = &claimedAt.Time
+	}
+	task.MutexKey = mutexKey.String
+	task.Labels = splitLabels(labels.String)
+	task.Connector = connector.String
+	task.WorkDir = workDir.String
+	task.PRURL = prURL.String
+	task.AcceptanceCriteria = splitList(criteria.String)
+	task.Commands = splitList(commands.String)
+	if steps.String != "" {
+		json.Unmarshal([]byte(steps.String), &task.Steps)
+	}
+	task.ParentID = parentID.String
+	task.EstimateSec = int(estimate.Int64)
+	if dueAt.Valid {
+		task.DueAt = &dueAt.Time
+	}
+	if breachedAt.Valid {
+		task.SLABreachedAt = &breachedAt.Time
+	}
+	if notBefore.Valid {
+		task.NotBefore = &notBefore.Time
+	}
+	return task, nil
+}
+
+// joinList encodes a list of free-text items as a JSON array, or "" when
+// it is empty.
+func joinList(items []string) string {
+	if len(items) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(items)
+	return string(data)
+}
+
+// joinSteps encodes a pipeline as a JSON array, or "" when it is empty.
+func joinSteps(steps []models.RunStep) string {
+	if len(steps) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(steps)
+	return string(data)
+}
+
+func splitList(encoded string) []string {
+	var items []string
+	if encoded != "" {
+		json.Unmarshal([]byte(encoded), &items)
+	}
+	return items
+}
+
+// joinLabels encodes labels as ",a,b," so a single label can be matched
+// exactly with LIKE '%,label,%'.
+func joinLabels(labels []string) string {
+	var clean []string
+	seen := make(map[string]bool)
+	for _, l := range labels {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.Contains(l, ",") || seen[l] {
+			continue
+		}
+		seen[l] = true
+		clean = append(clean, l)
+	}
+	if len(clean) == 0 {
+		return ""
+	}
+	return "," + strings.Join(clean, ",") + ","
+}
+
+// likeEscaper escapes LIKE wildcards for use with ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func splitLabels(encoded string) []string {
+	encoded = strings.Trim(encoded, ",")
+	if encoded == "" {
+		return nil
+	}
+	return strings.Split(encoded, ",")
+}
+
+// TaskOptions holds optional attributes for a new task.
+type TaskOptions struct {
+	// MutexKey prevents tasks sharing the same key from running concurrently.
+	MutexKey string
+	// Labels are free-form tags workers can filter on when claiming.
+	Labels []string
+	// Connector restricts the task to workers for one connector.
+	Connector string
+	// WorkDir is the directory the task's commands run in. Callers must
+	// validate it against the allowed roots.
+	WorkDir string
+	// AcceptanceCriteria describe when the task is done.
+	AcceptanceCriteria []string
+	// Commands are the commands expected to be run for the task.
+	Commands []string
+	// Steps is the task's pipeline of runs.
+	Steps []models.RunStep
+	// ParentID makes the task a subtask of another. Callers must check the
+	// parent exists.
+	ParentID string
+	// Priority is claimed before lower priorities; 0 is normal.
+	Priority int
+	// EstimateSec is how long the task is expected to take once claimed.
+	EstimateSec int
+	// DueAt is the task's deadline.
+	DueAt *time.Time
+	// NotBefore keeps the task from being dispatched until this time.
+	NotBefore *time.Time
+}
+
 // CreateTask inserts a new task.
 func (s *Store) CreateTask(title, description string) (*models.Task, error) {
-	now := time.Now().UTC()
+	return s.CreateTaskWithOptions(title, description, TaskOptions{})
+}
+
+// CreateTaskWithOptions inserts a new task with optional attributes.
+func (s *Store) CreateTaskWithOptions(title, description string, opts TaskOptions) (*models.Task, error) {
+	now := s.now()
 	task := &models.Task{
 		ID:          uuid.New().String(),
 		Title:       title,
@@ -144,11 +575,33 @@ func (s *Store) CreateTask(title, description string) (*models.Task, error) {
 		Status:      models.TaskStatusPending,
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		MutexKey:    strings.TrimSpace(opts.MutexKey),
+		Connector:   strings.TrimSpace(opts.Connector),
+		WorkDir:     opts.WorkDir,
+
+		AcceptanceCriteria: append([]string(nil), opts.AcceptanceCriteria...),
+		Commands:           append([]string(nil), opts.Commands...),
+		Steps:              append([]models.RunStep(nil), opts.Steps...),
+		ParentID:           opts.ParentID,
+		Priority:           opts.Priority,
+		EstimateSec:        opts.EstimateSec,
 	}
-
-	_, err := s.db.Exec(
-		`INSERT INTO tasks (id, title, description, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
-		task.ID, task.Title, task.Description, task.Status, task.CreatedAt, task.UpdatedAt,
+	if opts.DueAt != nil {
+		due := opts.DueAt.UTC()
+		task.DueAt = &due
+	}
+	if opts.NotBefore != nil {
+		at := opts.NotBefore.UTC()
+		task.NotBefore = &at
+	}
+	labels := joinLabels(opts.Labels)
+	task.Labels = splitLabels(labels)
+
+	_, err := s.exec(
+		`INSERT INTO tasks (id, title, description, status, created_at, updated_at, mutex_key, labels, connector, workdir, acceptance_criteria, commands, parent_task_id, estimate_sec, due_at, not_before, steps, priority) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		task.ID, task.Title, task.Description, task.Status, task.CreatedAt, task.UpdatedAt, nullString(task.MutexKey), nullString(labels), nullString(task.Connector), nullString(task.WorkDir),
+		nullString(joinList(task.AcceptanceCriteria)), nullString(joinList(task.Commands)), nullString(task.ParentID),
+		nullInt(task.EstimateSec), nullTime(task.DueAt), nullTime(task.NotBefore), nullString(joinSteps(task.Steps)), task.Priority,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("insert task: %w", err)
@@ -156,44 +609,72 @@ func (s *Store) CreateTask(title, description string) (*models.Task, error) {
 	return task, nil
 }
 
-// GetTask retrieves a task by ID.
-func (s *Store) GetTask(id string) (*models.Task, error) {
-	task := &models.Task{}
-	var claimedAt sql.NullTime
-	var claimedBy sql.NullString
+// SetTaskWorkDir sets the directory a task's commands run in.
+func (s *Store) SetTaskWorkDir(id, dir string) error {
+	_, err := s.exec(`UPDATE tasks SET workdir = ?, updated_at = ? WHERE id = ?`, nullString(dir), s.now(), id)
+	if err != nil {
+		return fmt.Errorf("set task workdir: %w", err)
+	}
+	return nil
+}
 
-	err := s.db.QueryRow(
-		`SELECT id, title, description, status, claimed_by, claimed_at, created_at, updated_at FROM tasks WHERE id = ?`,
-		id,
-	).Scan(&task.ID, &task.Title, &task.Description, &task.Status, &claimedBy, &claimedAt, &task.CreatedAt, &task.UpdatedAt)
+// SetTaskPRURL records the pull request opened for a task.
+func (s *Store) SetTaskPRURL(id, url string) error {
+	_, err := s.exec(`UPDATE tasks SET pr_url = ?, updated_at = ? WHERE id = ?`, nullString(url), s.now(), id)
+	if err != nil {
+		return fmt.Errorf("set task pr url: %w", err)
+	}
+	return nil
+}
 
+// GetTask retrieves a task by ID.
+func (s *Store) GetTask(id string) (*models.Task, error) {
+	task, err := scanTask(s.rstmts.getTask.QueryRow(id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("query task: %w", err)
 	}
-	if claimedBy.Valid {
-		task.ClaimedBy = claimedBy.String
+	return task, nil
+}
+
+// FindTaskIDs returns up to limit IDs of tasks whose ID starts with
+// prefix, in ID order.
+func (s *Store) FindTaskIDs(prefix string, limit int) ([]string, error) {
+	// A range on the primary key rather than LIKE, which is case-insensitive,
+	// treats _ and % as wildcards and cannot use the index.
+	rows, err := s.rdb.Query(`SELECT id FROM tasks WHERE id >= ? AND id < ? ORDER BY id LIMIT ?`,
+		prefix, prefix+"\uffff", limit)
+	if err != nil {
+		return nil, fmt.Errorf("query task ids: %w", err)
 	}
-	if claimedAt.Valid {
-		task.ClaimedAt = &claimedAt.Time
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan task id: %w", err)
+		}
+		ids = append(ids, id)
 	}
-	return task, nil
+	return ids, rows.Err()
 }
 
-// ListTasks returns all tasks, optionally filtered by status.
+// ListTasks returns all tasks, highest priority first and newest first
+// within a priority, optionally filtered by status.
 func (s *Store) ListTasks(status string) ([]models.Task, error) {
-	query := `SELECT id, title, description, status, claimed_by, claimed_at, created_at, updated_at FROM tasks`
+	query := `SELECT ` + taskColumns + ` FROM tasks`
 	var args []interface{}
 
 	if status != "" {
 		query += ` WHERE status = ?`
 		args = append(args, status)
 	}
-	query += ` ORDER BY created_at DESC`
+	query += ` ORDER BY priority DESC, created_at DESC`
 
-	rows, err := s.db.Query(query, args...)
+	rows, err := s.rdb.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query tasks: %w", err)
 	}
@@ -201,36 +682,128 @@ func (s *Store) ListTasks(status string) ([]models.Task, error) {
 
 	var tasks []models.Task
 	for rows.Next() {
-		var task models.Task
-		var claimedAt sql.NullTime
-		var claimedBy sql.NullString
-		if err := rows.Scan(&task.ID, &task.Title, &task.Description, &task.Status, &claimedBy, &claimedAt, &task.CreatedAt, &task.UpdatedAt); err != nil {
+		task, err := scanTask(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan task: %w", err)
 		}
-		if claimedBy.Valid {
-			task.ClaimedBy = claimedBy.String
-		}
-		if claimedAt.Valid {
-			task.ClaimedAt = &claimedAt.Time
-		}
-		tasks = append(tasks, task)
+		tasks = append(tasks, *task)
 	}
 	return tasks, rows.Err()
 }
 
-// UpdateTaskStatus updates the status of a task.
+// UpdateTaskStatus updates the status of a task. Completing the last open
+// subtask of a parent completes the parent too, and so on up the tree.
 func (s *Store) UpdateTaskStatus(id string, status models.TaskStatus) error {
-	_, err := s.db.Exec(
-		`UPDATE tasks SET status = ?, updated_at = ? WHERE id = ?`,
-		status, time.Now().UTC(), id,
+	if status != models.TaskStatusCompleted {
+		_, err := s.exec(
+			`UPDATE tasks SET status = ?, updated_at = ? WHERE id = ?`,
+			status, s.now(), id,
+		)
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := s.now()
+	if _, err := tx.Exec(`UPDATE tasks SET status = ?, updated_at = ? WHERE id = ?`, status, now, id); err != nil {
+		return err
+	}
+	for {
+		var parentID sql.NullString
+		if err := tx.QueryRow(`SELECT parent_task_id FROM tasks WHERE id = ?`, id).Scan(&parentID); err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("query parent task: %w", err)
+		}
+		if parentID.String == "" {
+			break
+		}
+		var open int
+		if err := tx.QueryRow(
+			`SELECT COUNT(*) FROM tasks WHERE parent_task_id = ? AND status != ?`, parentID.String, models.TaskStatusCompleted,
+		).Scan(&open); err != nil {
+			return fmt.Errorf("count open subtasks: %w", err)
+		}
+		if open > 0 {
+			break
+		}
+		if _, err := tx.Exec(
+			`UPDATE tasks SET status = ?, claimed_by = NULL, claimed_at = NULL, updated_at = ? WHERE id = ? AND status != ?`,
+			models.TaskStatusCompleted, now, parentID.String, models.TaskStatusCompleted,
+		); err != nil {
+			return fmt.Errorf("complete parent task: %w", err)
+		}
+		if _, err := tx.Exec(`DELETE FROM leases WHERE task_id = ?`, parentID.String); err != nil {
+			return fmt.Errorf("delete parent leases: %w", err)
+		}
+		id = parentID.String
+	}
+	return s.commit(tx)
+}
+
+// ListOverdueTasks returns open tasks whose deadline is at or before now
+// and whose breach has not been recorded yet, earliest deadline first.
+func (s *Store) ListOverdueTasks(now time.Time) ([]models.Task, error) {
+	rows, err := s.rdb.Query(
+		`SELECT `+taskColumns+` FROM tasks WHERE due_at <= ? AND sla_breached_at IS NULL AND status NOT IN (?, ?) ORDER BY due_at ASC`,
+		now.UTC(), models.TaskStatusCompleted, models.TaskStatusFailed,
 	)
-	return err
+	if err != nil {
+		return nil, fmt.Errorf("query overdue tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []models.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan task: %w", err)
+		}
+		tasks = append(tasks, *task)
+	}
+	return tasks, rows.Err()
+}
+
+// MarkSLABreached records that a task missed its deadline. It reports
+// false when the breach was already recorded, so with several daemons on
+// one database exactly one of them reports each breach.
+func (s *Store) MarkSLABreached(id string, at time.Time) (bool, error) {
+	res, err := s.exec(`UPDATE tasks SET sla_breached_at = ? WHERE id = ? AND sla_breached_at IS NULL`, at.UTC(), id)
+	if err != nil {
+		return false, fmt.Errorf("mark sla breached: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ListSubtasks returns a task's direct subtasks, oldest first.
+func (s *Store) ListSubtasks(parentID string) ([]models.Task, error) {
+	rows, err := s.rdb.Query(`SELECT `+taskColumns+` FROM tasks WHERE parent_task_id = ? ORDER BY created_at ASC`, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("query subtasks: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []models.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan task: %w", err)
+		}
+		tasks = append(tasks, *task)
+	}
+	return tasks, rows.Err()
 }
 
 // ClaimTask marks a task as claimed by a holder.
 func (s *Store) ClaimTask(id, holderID string) error {
-	now := time.Now().UTC()
-	_, err := s.db.Exec(
+	now := s.now()
+	_, err := s.exec(
 		`UPDATE tasks SET status = ?, claimed_by = ?, claimed_at = ?, updated_at = ? WHERE id = ?`,
 		models.TaskStatusClaimed, holderID, now, now, id,
 	)
@@ -239,8 +812,8 @@ func (s *Store) ClaimTask(id, holderID string) error {
 
 // ClaimResult holds the result of an atomic claim operation.
 type ClaimResult struct {
-	Task  *models.Task
-	Lease *models.Lease
+	Task  *models.Task  `json:"task"`
+	Lease *models.Lease `json:"lease"`
 }
 
 // ErrTaskNotClaimable indicates the task cannot be claimed (not found or wrong status).
@@ -259,19 +832,10 @@ func (s *Store) ClaimTaskWithLeaseTx(taskID, holderID string, ttlSec int) (*Clai
 	}
 	defer tx.Rollback()
 
-	now := time.Now().UTC()
+	now := s.now()
 
 	// Step 1: Verify task exists and is claimable (pending status)
-	var task models.Task
-	var claimedAt sql.NullTime
-	var claimedBy sql.NullString
-
-	err = tx.QueryRow(
-		`SELECT id, title, description, status, claimed_by, claimed_at, created_at, updated_at
-		 FROM tasks WHERE id = ?`,
-		taskID,
-	).Scan(&task.ID, &task.Title, &task.Description, &task.Status, &claimedBy, &claimedAt, &task.CreatedAt, &task.UpdatedAt)
-
+	task, err := scanTask(tx.Stmt(s.stmts.getTask).QueryRow(taskID))
 	if err == sql.ErrNoRows {
 		return nil, ErrTaskNotClaimable
 	}
@@ -286,10 +850,7 @@ func (s *Store) ClaimTaskWithLeaseTx(taskID, holderID string, ttlSec int) (*Clai
 
 	// Step 2: Check for existing active lease
 	var existingLeaseID string
-	err = tx.QueryRow(
-		`SELECT id FROM leases WHERE task_id = ? AND expires_at > ?`,
-		taskID, now,
-	).Scan(&existingLeaseID)
+	err = tx.Stmt(s.stmts.activeLeaseID).QueryRow(taskID, now).Scan(&existingLeaseID)
 
 	if err != nil && err != sql.ErrNoRows {
 		return nil, fmt.Errorf("check existing lease: %w", err)
@@ -299,8 +860,7 @@ func (s *Store) ClaimTaskWithLeaseTx(taskID, holderID string, ttlSec int) (*Clai
 	}
 
 	// Step 3: Update task status to claimed
-	result, err := tx.Exec(
-		`UPDATE tasks SET status = ?, claimed_by = ?, claimed_at = ?, updated_at = ? WHERE id = ? AND status = ?`,
+	result, err := tx.Stmt(s.stmts.claimTask).Exec(
 		models.TaskStatusClaimed, holderID, now, now, taskID, models.TaskStatusPending,
 	)
 	if err != nil {
@@ -326,16 +886,12 @@ func (s *Store) ClaimTaskWithLeaseTx(taskID, holderID string, ttlSec int) (*Clai
 		CreatedAt: now,
 	}
 
-	_, err = tx.Exec(
-		`INSERT INTO leases (id, task_id, holder_id, ttl_sec, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
-		lease.ID, lease.TaskID, lease.HolderID, lease.TTLSec, lease.ExpiresAt, lease.CreatedAt,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("insert lease: %w", err)
+	if err := s.insertLease(tx, lease); err != nil {
+		return nil, err
 	}
 
 	// Step 5: Commit transaction
-	if err := tx.Commit(); err != nil {
+	if err := s.commit(tx); err != nil {
 		return nil, fmt.Errorf("commit transaction: %w", err)
 	}
 
@@ -346,25 +902,105 @@ func (s *Store) ClaimTaskWithLeaseTx(taskID, holderID string, ttlSec int) (*Clai
 	task.UpdatedAt = now
 
 	return &ClaimResult{
-		Task:  &task,
+		Task:  task,
 		Lease: lease,
 	}, nil
 }
 
-// ReleaseTask releases a task claim.
-func (s *Store) ReleaseTask(id string) error {
-	now := time.Now().UTC()
-	_, err := s.db.Exec(
+// ErrTaskNotClaimed indicates the task cannot be released (not found or
+// not claimed or running).
+var ErrTaskNotClaimed = fmt.Errorf("task not found or not claimed")
+
+// ErrNotHolder indicates a release by someone other than the task's holder.
+var ErrNotHolder = fmt.Errorf("not the task's holder")
+
+// ReleaseOptions says who is releasing a task.
+type ReleaseOptions struct {
+	// HolderID must hold the task: own its active lease or, when the lease
+	// has expired, its claim.
+	HolderID string
+	// Force releases the task whoever holds it, for admin overrides and
+	// crash recovery.
+	Force bool
+}
+
+// ReleaseTask returns a claimed or running task to pending. The claim is
+// cleared and every lease on the task deleted in one transaction, so the
+// task is immediately claimable again. It returns the holder the task was
+// released from, and fails with ErrTaskNotClaimed or ErrNotHolder.
+func (s *Store) ReleaseTask(id string, opts ReleaseOptions) (string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := s.now()
+	var status models.TaskStatus
+	var claimedBy sql.NullString
+	err = tx.QueryRow(`SELECT status, claimed_by FROM tasks WHERE id = ?`, id).Scan(&status, &claimedBy)
+	if err == sql.ErrNoRows || err == nil && status != models.TaskStatusClaimed && status != models.TaskStatusRunning {
+		return "", ErrTaskNotClaimed
+	}
+	if err != nil {
+		return "", fmt.Errorf("query task: %w", err)
+	}
+
+	holder := claimedBy.String
+	var leaseHolder string
+	err = tx.QueryRow(`SELECT holder_id FROM leases WHERE task_id = ? AND expires_at > ? ORDER BY created_at DESC LIMIT 1`, id, now).Scan(&leaseHolder)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("query lease: %w", err)
+	}
+	if leaseHolder != "" {
+		holder = leaseHolder
+	}
+	if !opts.Force && holder != opts.HolderID {
+		return "", ErrNotHolder
+	}
+
+	if _, err := tx.Exec(
 		`UPDATE tasks SET status = ?, claimed_by = NULL, claimed_at = NULL, updated_at = ? WHERE id = ?`,
 		models.TaskStatusPending, now, id,
-	)
-	return err
+	); err != nil {
+		return "", fmt.Errorf("release task: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM leases WHERE task_id = ?`, id); err != nil {
+		return "", fmt.Errorf("delete leases: %w", err)
+	}
+	return holder, s.commit(tx)
 }
 
 // AtomicClaimTask atomically claims a pending task and creates a lease.
 // Returns the task and lease if successful, or nil if the task is already claimed.
 func (s *Store) AtomicClaimTask(holderID string, ttlSec int) (*models.Task, *models.Lease, error) {
-	now := time.Now().UTC()
+	return s.AtomicClaimTaskExcluding(holderID, ttlSec, nil)
+}
+
+// AtomicClaimTaskExcluding is AtomicClaimTask but never claims one of the excluded task IDs.
+func (s *Store) AtomicClaimTaskExcluding(holderID string, ttlSec int, exclude []string) (*models.Task, *models.Lease, error) {
+	return s.AtomicClaimNext(holderID, ttlSec, ClaimFilter{Exclude: exclude})
+}
+
+// ClaimFilter narrows which pending task AtomicClaimNext may claim.
+type ClaimFilter struct {
+	// Exclude lists task IDs that must not be claimed.
+	Exclude []string
+	// Label, if set, requires the task to carry this label.
+	Label string
+	// ExcludeLabels skips tasks carrying any of these labels.
+	ExcludeLabels []string
+	// Connector, if set, matches tasks for this connector or for any connector.
+	Connector string
+	// WithCommands requires the task to have commands or steps.
+	WithCommands bool
+}
+
+// AtomicClaimNext atomically claims the pending task matching the filter
+// with the highest priority, the oldest of those, and creates a lease. It
+// returns nils if no task is eligible.
+func (s *Store) AtomicClaimNext(holderID string, ttlSec int, filter ClaimFilter) (*models.Task, *models.Lease, error) {
+	now := s.now()
 
 	// Start transaction for atomic claim
 	tx, err := s.db.Begin()
@@ -373,16 +1009,39 @@ func (s *Store) AtomicClaimTask(holderID string, ttlSec int) (*models.Task, *mod
 	}
 	defer tx.Rollback()
 
-	// Find and lock a pending task
-	var taskID, title, description string
-	var createdAt, updatedAt time.Time
-	err = tx.QueryRow(
-		`SELECT id, title, description, created_at, updated_at FROM tasks 
-		 WHERE status = ? AND claimed_by IS NULL 
-		 ORDER BY created_at ASC LIMIT 1`,
-		models.TaskStatusPending,
-	).Scan(&taskID, &title, &description, &createdAt, &updatedAt)
+	// Find and lock a pending task, skipping tasks whose mutex key is held.
+	// The common unfiltered case uses the prepared statement.
+	var row *sql.Row
+	if len(filter.Exclude) == 0 && filter.Label == "" && len(filter.ExcludeLabels) == 0 && filter.Connector == "" && !filter.WithCommands {
+		row = tx.Stmt(s.stmts.nextPending).QueryRow(models.TaskStatusPending, now, now, now)
+	} else {
+		query := nextPendingQuery
+		args := []interface{}{models.TaskStatusPending, now, now, now}
+		if len(filter.Exclude) > 0 {
+			query += ` AND id NOT IN (?` + strings.Repeat(`, ?`, len(filter.Exclude)-1) + `)`
+			for _, id := range filter.Exclude {
+				args = append(args, id)
+			}
+		}
+		if filter.Label != "" {
+			query += ` AND labels LIKE ? ESCAPE '\'`
+			args = append(args, "%,"+likeEscaper.Replace(filter.Label)+",%")
+		}
+		for _, label := range filter.ExcludeLabels {
+			query += ` AND (labels IS NULL OR labels NOT LIKE ? ESCAPE '\')`
+			args = append(args, "%,"+likeEscaper.Replace(label)+",%")
+		}
+		if filter.Connector != "" {
+			query += ` AND (connector IS NULL OR connector = '' OR connector = ?)`
+			args = append(args, filter.Connector)
+		}
+		if filter.WithCommands {
+			query += ` AND ((commands IS NOT NULL AND commands != '') OR (steps IS NOT NULL AND steps != ''))`
+		}
+		row = tx.QueryRow(query+nextPendingOrder, args...)
+	}
 
+	task, err := scanTask(row)
 	if err == sql.ErrNoRows {
 		return nil, nil, nil // No pending tasks
 	}
@@ -390,9 +1049,10 @@ func (s *Store) AtomicClaimTask(holderID string, ttlSec int) (*models.Task, *mod
 		return nil, nil, fmt.Errorf("query pending task: %w", err)
 	}
 
+	taskID := task.ID
+
 	// Claim the task
-	res, err := tx.Exec(
-		`UPDATE tasks SET status = ?, claimed_by = ?, claimed_at = ?, updated_at = ? WHERE id = ? AND status = ?`,
+	res, err := tx.Stmt(s.stmts.claimTask).Exec(
 		models.TaskStatusClaimed, holderID, now, now, taskID, models.TaskStatusPending,
 	)
 	if err != nil {
@@ -409,49 +1069,37 @@ func (s *Store) AtomicClaimTask(holderID string, ttlSec int) (*models.Task, *mod
 	}
 
 	// Create lease
-	leaseID := uuid.New().String()
-	expiresAt := now.Add(time.Duration(ttlSec) * time.Second)
-	_, err = tx.Exec(
-		`INSERT INTO leases (id, task_id, holder_id, ttl_sec, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
-		leaseID, taskID, holderID, ttlSec, expiresAt, now,
-	)
-	if err != nil {
-		return nil, nil, fmt.Errorf("create lease: %w", err)
-	}
-
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		return nil, nil, fmt.Errorf("commit transaction: %w", err)
-	}
-
-	task := &models.Task{
-		ID:          taskID,
-		Title:       title,
-		Description: description,
-		Status:      models.TaskStatusClaimed,
-		CreatedAt:   createdAt,
-		UpdatedAt:   now,
-		ClaimedBy:   holderID,
-		ClaimedAt:   &now,
-	}
-
 	lease := &models.Lease{
-		ID:        leaseID,
+		ID:        uuid.New().String(),
 		TaskID:    taskID,
 		HolderID:  holderID,
 		TTLSec:    ttlSec,
-		ExpiresAt: expiresAt,
+		ExpiresAt: now.Add(time.Duration(ttlSec) * time.Second),
 		CreatedAt: now,
 	}
+	if err := s.insertLease(tx, lease); err != nil {
+		return nil, nil, err
+	}
+
+	// Commit transaction
+	if err := s.commit(tx); err != nil {
+		return nil, nil, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	task.Status = models.TaskStatusClaimed
+	task.UpdatedAt = now
+	task.ClaimedBy = holderID
+	task.ClaimedAt = &now
 
 	return task, lease, nil
 }
 
 // --- Lease Operations ---
 
-// CreateLease creates a new lease for a task.
+// CreateLease creates a new lease for a task. It fails with
+// ErrTaskAlreadyLeased while the task has an unexpired lease.
 func (s *Store) CreateLease(taskID, holderID string, ttlSec int) (*models.Lease, error) {
-	now := time.Now().UTC()
+	now := s.now()
 	lease := &models.Lease{
 		ID:        uuid.New().String(),
 		TaskID:    taskID,
@@ -461,24 +1109,64 @@ func (s *Store) CreateLease(taskID, holderID string, ttlSec int) (*models.Lease,
 		CreatedAt: now,
 	}
 
-	_, err := s.db.Exec(
-		`INSERT INTO leases (id, task_id, holder_id, ttl_sec, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.insertLease(tx, lease); err != nil {
+		return nil, err
+	}
+	if err := s.commit(tx); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return lease, nil
+}
+
+// insertLease clears the task's expired leases and inserts lease. A task
+// holds at most one lease row, so a live lease fails the insert with
+// ErrTaskAlreadyLeased.
+func (s *Store) insertLease(tx *sql.Tx, lease *models.Lease) error {
+	if _, err := tx.Stmt(s.stmts.clearExpired).Exec(lease.TaskID, lease.CreatedAt); err != nil {
+		return fmt.Errorf("clear expired leases: %w", err)
+	}
+	_, err := tx.Stmt(s.stmts.insertLease).Exec(
 		lease.ID, lease.TaskID, lease.HolderID, lease.TTLSec, lease.ExpiresAt, lease.CreatedAt,
 	)
+	if isUniqueViolation(err) {
+		return ErrTaskAlreadyLeased
+	}
 	if err != nil {
-		return nil, fmt.Errorf("insert lease: %w", err)
+		return fmt.Errorf("insert lease: %w", err)
 	}
-	return lease, nil
+	return nil
+}
+
+// isUniqueViolation reports whether err is a UNIQUE constraint failure.
+func isUniqueViolation(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "UNIQUE constraint") || strings.Contains(err.Error(), "unique constraint"))
 }
 
 // GetActiveLease returns the active lease for a task, if any.
 func (s *Store) GetActiveLease(taskID string) (*models.Lease, error) {
 	lease := &models.Lease{}
-	err := s.db.QueryRow(
-		`SELECT id, task_id, holder_id, ttl_sec, expires_at, created_at FROM leases WHERE task_id = ? AND expires_at > ? ORDER BY created_at DESC LIMIT 1`,
-		taskID, time.Now().UTC(),
-	).Scan(&lease.ID, &lease.TaskID, &lease.HolderID, &lease.TTLSec, &lease.ExpiresAt, &lease.CreatedAt)
+	err := s.rstmts.getActiveLease.QueryRow(taskID, s.now()).Scan(&lease.ID, &lease.TaskID, &lease.HolderID, &lease.TTLSec, &lease.ExpiresAt, &lease.CreatedAt, &lease.TokenHash)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query lease: %w", err)
+	}
+	return lease, nil
+}
 
+// GetLatestLease returns a task's newest lease, expired or not, if any.
+func (s *Store) GetLatestLease(taskID string) (*models.Lease, error) {
+	lease := &models.Lease{}
+	err := s.rdb.QueryRow(`SELECT id, task_id, holder_id, ttl_sec, expires_at, created_at, COALESCE(token_hash, '') FROM leases WHERE task_id = ? ORDER BY created_at DESC LIMIT 1`, taskID).
+		Scan(&lease.ID, &lease.TaskID, &lease.HolderID, &lease.TTLSec, &lease.ExpiresAt, &lease.CreatedAt, &lease.TokenHash)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -488,18 +1176,184 @@ func (s *Store) GetActiveLease(taskID string) (*models.Lease, error) {
 	return lease, nil
 }
 
+// ListActiveLeases returns all unexpired leases, oldest first.
+func (s *Store) ListActiveLeases() ([]models.Lease, error) {
+	rows, err := s.rdb.Query(`SELECT id, task_id, holder_id, ttl_sec, expires_at, created_at, COALESCE(token_hash, '') FROM leases WHERE expires_at > ? ORDER BY created_at`, s.now())
+	if err != nil {
+		return nil, fmt.Errorf("query leases: %w", err)
+	}
+	defer rows.Close()
+
+	var leases []models.Lease
+	for rows.Next() {
+		var l models.Lease
+		if err := rows.Scan(&l.ID, &l.TaskID, &l.HolderID, &l.TTLSec, &l.ExpiresAt, &l.CreatedAt, &l.TokenHash); err != nil {
+			return nil, fmt.Errorf("scan lease: %w", err)
+		}
+		leases = append(leases, l)
+	}
+	return leases, rows.Err()
+}
+
 // RenewLease extends the expiry of a lease (heartbeat).
 func (s *Store) RenewLease(leaseID string, ttlSec int) error {
-	_, err := s.db.Exec(
-		`UPDATE leases SET expires_at = ? WHERE id = ?`,
-		time.Now().UTC().Add(time.Duration(ttlSec)*time.Second), leaseID,
+	_, err := s.execStmt(s.stmts.renewLease,
+		s.now().Add(time.Duration(ttlSec)*time.Second), leaseID,
 	)
 	return err
 }
 
+// SetLeaseTTL gives a lease a new TTL, expiring ttlSec from now. Unlike a
+// renewal, the TTL is recorded, as if the lease had been taken with it.
+func (s *Store) SetLeaseTTL(leaseID string, ttlSec int) error {
+	_, err := s.exec(`UPDATE leases SET ttl_sec = ?, expires_at = ? WHERE id = ?`,
+		ttlSec, s.now().Add(time.Duration(ttlSec)*time.Second), leaseID)
+	return err
+}
+
+// SetLeaseTokenHash stores the hash of the holder token issued for a lease.
+func (s *Store) SetLeaseTokenHash(leaseID, tokenHash string) error {
+	_, err := s.exec(`UPDATE leases SET token_hash = ? WHERE id = ?`, tokenHash, leaseID)
+	return err
+}
+
 // DeleteLease removes a lease.
 func (s *Store) DeleteLease(leaseID string) error {
-	_, err := s.db.Exec(`DELETE FROM leases WHERE id = ?`, leaseID)
+	_, err := s.exec(`DELETE FROM leases WHERE id = ?`, leaseID)
+	return err
+}
+
+// DeleteLeasesForTask removes every lease on a task, expired or not.
+func (s *Store) DeleteLeasesForTask(taskID string) error {
+	_, err := s.exec(`DELETE FROM leases WHERE task_id = ?`, taskID)
+	return err
+}
+
+// DeleteLeasesForHolder removes every lease held by a holder.
+func (s *Store) DeleteLeasesForHolder(holderID string) error {
+	_, err := s.exec(`DELETE FROM leases WHERE holder_id = ?`, holderID)
+	return err
+}
+
+// --- Worker State Operations ---
+
+// SaveWorkerRecord inserts or replaces the persisted state of a scheduler worker.
+func (s *Store) SaveWorkerRecord(rec *models.WorkerRecord) error {
+	rec.UpdatedAt = s.now()
+	_, err := s.exec(
+		`INSERT OR REPLACE INTO worker_state (worker_id, instance_id, task_id, lease_id, connector, state, started_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.WorkerID, rec.InstanceID, rec.TaskID, rec.LeaseID, rec.ConnectorName, rec.State, rec.StartedAt, rec.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("save worker record: %w", err)
+	}
+	return nil
+}
+
+// ListWorkerRecords returns persisted worker records, optionally filtered by state.
+func (s *Store) ListWorkerRecords(state string) ([]models.WorkerRecord, error) {
+	query := `SELECT worker_id, instance_id, task_id, lease_id, connector, state, started_at, updated_at FROM worker_state`
+	var args []interface{}
+
+	if state != "" {
+		query += ` WHERE state = ?`
+		args = append(args, state)
+	}
+	query += ` ORDER BY started_at ASC`
+
+	rows, err := s.rdb.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query worker records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []models.WorkerRecord
+	for rows.Next() {
+		var rec models.WorkerRecord
+		var leaseID, connector sql.NullString
+		if err := rows.Scan(&rec.WorkerID, &rec.InstanceID, &rec.TaskID, &leaseID, &connector, &rec.State, &rec.StartedAt, &rec.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan worker record: %w", err)
+		}
+		rec.LeaseID = leaseID.String
+		rec.ConnectorName = connector.String
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+// DeleteWorkerRecord removes the persisted state of a worker.
+func (s *Store) DeleteWorkerRecord(workerID string) error {
+	_, err := s.exec(`DELETE FROM worker_state WHERE worker_id = ?`, workerID)
+	return err
+}
+
+// --- Idempotency Operations ---
+
+// IdempotencyTTL is how long idempotency keys are remembered.
+const IdempotencyTTL = 24 * time.Hour
+
+// IdempotencyRecord is a stored response for an idempotency key.
+// A StatusCode of 0 means the original request is still in progress.
+type IdempotencyRecord struct {
+	Scope      string
+	Key        string
+	StatusCode int
+	Response   []byte
+	// RequestHash identifies the request the key was first used for, so a
+	// reuse with a different request can be refused.
+	RequestHash string
+	CreatedAt   time.Time
+}
+
+// BeginIdempotent reserves an idempotency key for the request hashing to
+// requestHash. If the key is new it returns (nil, true); otherwise it
+// returns the existing record and false.
+func (s *Store) BeginIdempotent(scope, key, requestHash string) (*IdempotencyRecord, bool, error) {
+	now := s.now()
+
+	// Forget expired keys so they can be reused
+	if _, err := s.exec(`DELETE FROM idempotency_keys WHERE created_at <= ?`, now.Add(-IdempotencyTTL)); err != nil {
+		return nil, false, fmt.Errorf("prune idempotency keys: %w", err)
+	}
+
+	res, err := s.exec(
+		`INSERT OR IGNORE INTO idempotency_keys (scope, key, status_code, request_hash, created_at) VALUES (?, ?, 0, ?, ?)`,
+		scope, key, requestHash, now,
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("reserve idempotency key: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, false, fmt.Errorf("check rows affected: %w", err)
+	} else if n == 1 {
+		return nil, true, nil
+	}
+
+	rec := &IdempotencyRecord{Scope: scope, Key: key}
+	var hash sql.NullString
+	err = s.db.QueryRow(
+		`SELECT status_code, response, request_hash, created_at FROM idempotency_keys WHERE scope = ? AND key = ?`,
+		scope, key,
+	).Scan(&rec.StatusCode, &rec.Response, &hash, &rec.CreatedAt)
+	if err != nil {
+		return nil, false, fmt.Errorf("query idempotency key: %w", err)
+	}
+	rec.RequestHash = hash.String
+	return rec, false, nil
+}
+
+// CompleteIdempotent stores the response for a reserved idempotency key.
+func (s *Store) CompleteIdempotent(scope, key string, statusCode int, response []byte) error {
+	_, err := s.exec(
+		`UPDATE idempotency_keys SET status_code = ?, response = ? WHERE scope = ? AND key = ?`,
+		statusCode, response, scope, key,
+	)
+	return err
+}
+
+// DeleteIdempotent forgets an idempotency key so the request can be retried.
+func (s *Store) DeleteIdempotent(scope, key string) error {
+	_, err := s.exec(`DELETE FROM idempotency_keys WHERE scope = ? AND key = ?`, scope, key)
 	return err
 }
 
@@ -525,7 +1379,7 @@ func (s *Store) AcquireLock(resourceID, holderID, lockType string, ttlSec int) (
 	}
 	defer tx.Rollback()
 
-	now := time.Now().UTC()
+	now := s.now()
 
 	// Step 1: Clean up expired locks for this resource within the transaction
 	_, err = tx.Exec(`DELETE FROM locks WHERE resource_id = ? AND expires_at <= ?`, resourceID, now)
@@ -565,14 +1419,14 @@ func (s *Store) AcquireLock(resourceID, holderID, lockType string, ttlSec int) (
 	)
 	if err != nil {
 		// Check if this is a UNIQUE constraint violation (race condition)
-		if strings.Contains(err.Error(), "UNIQUE constraint") || strings.Contains(err.Error(), "unique constraint") {
+		if isUniqueViolation(err) {
 			return nil, ErrResourceLocked
 		}
 		return nil, fmt.Errorf("insert lock: %w", err)
 	}
 
 	// Step 4: Commit transaction
-	if err := tx.Commit(); err != nil {
+	if err := s.commit(tx); err != nil {
 		return nil, fmt.Errorf("commit transaction: %w", err)
 	}
 
@@ -581,7 +1435,7 @@ func (s *Store) AcquireLock(resourceID, holderID, lockType string, ttlSec int) (
 
 // GetLock retrieves a lock by resource ID if it exists and is not expired.
 func (s *Store) GetLock(resourceID string) (*models.Lock, error) {
-	now := time.Now().UTC()
+	now := s.now()
 	lock := &models.Lock{}
 
 	err := s.db.QueryRow(
@@ -599,17 +1453,60 @@ func (s *Store) GetLock(resourceID string) (*models.Lock, error) {
 	return lock, nil
 }
 
+// ListLocks returns all unexpired locks, oldest first.
+func (s *Store) ListLocks() ([]models.Lock, error) {
+	rows, err := s.rdb.Query(
+		`SELECT id, resource_id, holder_id, lock_type, created_at, expires_at
+		 FROM locks WHERE expires_at > ? ORDER BY created_at`,
+		s.now(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query locks: %w", err)
+	}
+	defer rows.Close()
+
+	var locks []models.Lock
+	for rows.Next() {
+		var l models.Lock
+		if err := rows.Scan(&l.ID, &l.ResourceID, &l.HolderID, &l.LockType, &l.CreatedAt, &l.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan lock: %w", err)
+		}
+		locks = append(locks, l)
+	}
+	return locks, rows.Err()
+}
+
 // ReleaseLock releases a lock.
 func (s *Store) ReleaseLock(lockID string) error {
-	_, err := s.db.Exec(`DELETE FROM locks WHERE id = ?`, lockID)
+	_, err := s.exec(`DELETE FROM locks WHERE id = ?`, lockID)
+	return err
+}
+
+// ReleaseLocksForHolder releases every lock held by a holder.
+func (s *Store) ReleaseLocksForHolder(holderID string) error {
+	_, err := s.exec(`DELETE FROM locks WHERE holder_id = ?`, holderID)
 	return err
 }
 
+// RenewLocksForHolder extends the expiry of every lock held by a holder.
+func (s *Store) RenewLocksForHolder(holderID string, ttlSec int) error {
+	_, err := s.exec(
+		`UPDATE locks SET expires_at = ? WHERE holder_id = ?`,
+		s.now().Add(time.Duration(ttlSec)*time.Second), holderID,
+	)
+	return err
+}
+
+// MutexResourceID returns the lock resource ID used for a task mutex key.
+func MutexResourceID(key string) string {
+	return "mutex:" + key
+}
+
 // --- Run Operations ---
 
 // CreateRun inserts a new run record.
 func (s *Store) CreateRun(taskID, command string, args []string) (*models.Run, error) {
-	now := time.Now().UTC()
+	now := s.now()
 	argsJSON, _ := json.Marshal(args)
 
 	run := &models.Run{
@@ -620,7 +1517,7 @@ func (s *Store) CreateRun(taskID, command string, args []string) (*models.Run, e
 		StartedAt: now,
 	}
 
-	_, err := s.db.Exec(
+	_, err := s.exec(
 		`INSERT INTO runs (id, task_id, command, args, started_at) VALUES (?, ?, ?, ?, ?)`,
 		run.ID, run.TaskID, run.Command, string(argsJSON), run.StartedAt,
 	)
@@ -632,18 +1529,74 @@ func (s *Store) CreateRun(taskID, command string, args []string) (*models.Run, e
 
 // UpdateRun updates a run with results.
 func (s *Store) UpdateRun(id string, exitCode int, stdout, stderr string) error {
-	_, err := s.db.Exec(
-		`UPDATE runs SET exit_code = ?, stdout = ?, stderr = ?, ended_at = ? WHERE id = ?`,
-		exitCode, stdout, stderr, time.Now().UTC(), id,
-	)
-	return err
+	return s.FinishRun(&models.Run{ID: id, ExitCode: exitCode, Stdout: stdout, Stderr: stderr})
+}
+
+// runColumns is the column list read by scanRun.
+const runColumns = `id, task_id, command, args, exit_code, stdout, stderr, started_at, ended_at, diff IS NOT NULL, truncated, retry_of`
+
+// scanRun scans a row selected with runColumns into a run, decrypting its
+// output. Chunked output is not loaded; see loadRunOutput.
+func (s *Store) scanRun(row rowScanner) (*models.Run, error) {
+	var run models.Run
+	var argsJSON string
+	var endedAt sql.NullTime
+	var exitCode sql.NullInt64
+	var stdout, stderr, retryOf sql.NullString
+
+	if err := row.Scan(&run.ID, &run.TaskID, &run.Command, &argsJSON, &exitCode, &stdout, &stderr, &run.StartedAt, &endedAt, &run.HasDiff, &run.Truncated, &retryOf); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan run: %w", err)
+	}
+
+	if argsJSON != "" {
+		json.Unmarshal([]byte(argsJSON), &run.Args)
+	}
+	if exitCode.Valid {
+		run.ExitCode = int(exitCode.Int64)
+	}
+	var err error
+	if run.Stdout, err = s.decrypt(stdout.String); err != nil {
+		return nil, err
+	}
+	if run.Stderr, err = s.decrypt(stderr.String); err != nil {
+		return nil, err
+	}
+	if endedAt.Valid {
+		run.EndedAt = endedAt.Time
+	}
+	run.RetryOf = retryOf.String
+	return &run, nil
+}
+
+// GetRun retrieves a run by ID.
+func (s *Store) GetRun(id string) (*models.Run, error) {
+	run, err := s.scanRun(s.rdb.QueryRow(`SELECT `+runColumns+` FROM runs WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadRunOutput(run); err != nil {
+		return nil, err
+	}
+	return run, nil
 }
 
 // GetRunsForTask returns all runs for a task.
 func (s *Store) GetRunsForTask(taskID string) ([]models.Run, error) {
-	rows, err := s.db.Query(
-		`SELECT id, task_id, command, args, exit_code, stdout, stderr, started_at, ended_at FROM runs WHERE task_id = ? ORDER BY started_at DESC`,
-		taskID,
+	return s.ListTaskRuns(taskID, -1, 0)
+}
+
+// ListTaskRuns returns a page of a task's runs, newest first. A negative
+// limit returns every run after offset.
+func (s *Store) ListTaskRuns(taskID string, limit, offset int) ([]models.Run, error) {
+	rows, err := s.rdb.Query(
+		`SELECT `+runColumns+` FROM runs WHERE task_id = ? ORDER BY started_at DESC LIMIT ? OFFSET ?`,
+		taskID, limit, offset,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("query runs: %w", err)
@@ -652,41 +1605,78 @@ func (s *Store) GetRunsForTask(taskID string) ([]models.Run, error) {
 
 	var runs []models.Run
 	for rows.Next() {
-		var run models.Run
-		var argsJSON string
-		var endedAt sql.NullTime
-		var exitCode sql.NullInt64
-		var stdout, stderr sql.NullString
-
-		if err := rows.Scan(&run.ID, &run.TaskID, &run.Command, &argsJSON, &exitCode, &stdout, &stderr, &run.StartedAt, &endedAt); err != nil {
-			return nil, fmt.Errorf("scan run: %w", err)
+		run, err := s.scanRun(rows)
+		if err != nil {
+			return nil, err
 		}
+		runs = append(runs, *run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
-		if argsJSON != "" {
-			json.Unmarshal([]byte(argsJSON), &run.Args)
+	// Output is read after the rows are released so a page never holds two
+	// read connections at once
+	for i := range runs {
+		if err := s.loadRunOutput(&runs[i]); err != nil {
+			return nil, err
 		}
-		if exitCode.Valid {
-			run.ExitCode = int(exitCode.Int64)
-		}
-		if stdout.Valid {
-			run.Stdout = stdout.String
-		}
-		if stderr.Valid {
-			run.Stderr = stderr.String
-		}
-		if endedAt.Valid {
-			run.EndedAt = endedAt.Time
-		}
-		runs = append(runs, run)
 	}
-	return runs, rows.Err()
+	return runs, nil
+}
+
+// CountTaskRuns returns how many runs a task has.
+func (s *Store) CountTaskRuns(taskID string) (int, error) {
+	var n int
+	if err := s.rdb.QueryRow(`SELECT COUNT(*) FROM runs WHERE task_id = ?`, taskID).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count runs: %w", err)
+	}
+	return n, nil
+}
+
+// SetRunRetryOf links a run to the run it re-executed.
+func (s *Store) SetRunRetryOf(id, retryOf string) error {
+	if _, err := s.exec(`UPDATE runs SET retry_of = ? WHERE id = ?`, retryOf, id); err != nil {
+		return fmt.Errorf("set run retry: %w", err)
+	}
+	return nil
+}
+
+// SetRunDiff stores the workdir diff captured at the end of a run.
+func (s *Store) SetRunDiff(id, diff string) error {
+	sealed, err := s.encrypt(diff)
+	if err != nil {
+		return err
+	}
+	if _, err := s.exec(`UPDATE runs SET diff = ? WHERE id = ?`, sealed, id); err != nil {
+		return fmt.Errorf("set run diff: %w", err)
+	}
+	return nil
+}
+
+// GetRunDiff returns the diff captured for a run. ok is false when the run
+// does not exist or has no diff.
+func (s *Store) GetRunDiff(id string) (diff string, ok bool, err error) {
+	var sealed sql.NullString
+	err = s.rdb.QueryRow(`SELECT diff FROM runs WHERE id = ?`, id).Scan(&sealed)
+	if err == sql.ErrNoRows || (err == nil && !sealed.Valid) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("query run diff: %w", err)
+	}
+	if diff, err = s.decrypt(sealed.String); err != nil {
+		return "", false, err
+	}
+	return diff, true, nil
 }
 
 // --- PDR Operations ---
 
 // WritePDR writes a Process Decision Record.
 func (s *Store) WritePDR(action, inputsHash, outcome, taskID, details string) (*models.PDREntry, error) {
-	now := time.Now().UTC()
+	now := s.now()
 	pdr := &models.PDREntry{
 		ID:         uuid.New().String(),
 		Action:     action,
@@ -697,8 +1687,7 @@ func (s *Store) WritePDR(action, inputsHash, outcome, taskID, details string) (*
 		Timestamp:  now,
 	}
 
-	_, err := s.db.Exec(
-		`INSERT INTO pdr (id, action, inputs_hash, outcome, task_id, details, timestamp) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+	_, err := s.execStmt(s.stmts.insertPDR,
 		pdr.ID, pdr.Action, pdr.InputsHash, pdr.Outcome, pdr.TaskID, pdr.Details, pdr.Timestamp,
 	)
 	if err != nil {
@@ -707,73 +1696,481 @@ func (s *Store) WritePDR(action, inputsHash, outcome, taskID, details string) (*
 	return pdr, nil
 }
 
-// --- Memory Operations ---
+// ListTaskPDRs returns a task's most recent limit Process Decision
+// Records, oldest first.
+func (s *Store) ListTaskPDRs(taskID string, limit int) ([]models.PDREntry, error) {
+	rows, err := s.rdb.Query(
+		`SELECT id, action, inputs_hash, outcome, task_id, details, timestamp FROM (
+			SELECT * FROM pdr WHERE task_id = ? ORDER BY timestamp DESC LIMIT ?
+		) ORDER BY timestamp ASC`, taskID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query pdr: %w", err)
+	}
+	defer rows.Close()
 
-// AddMemory inserts a memory item.
-func (s *Store) AddMemory(taskID, content, tags string) (*models.MemoryItem, error) {
-	now := time.Now().UTC()
-	item := &models.MemoryItem{
+	var entries []models.PDREntry
+	for rows.Next() {
+		var e models.PDREntry
+		var task, details sql.NullString
+		if err := rows.Scan(&e.ID, &e.Action, &e.InputsHash, &e.Outcome, &task, &details, &e.Timestamp); err != nil {
+			return nil, fmt.Errorf("scan pdr: %w", err)
+		}
+		e.TaskID, e.Details = task.String, details.String
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// --- Event Operations ---
+
+// AddEvent records an event addressed to a holder (holderID may be empty).
+func (s *Store) AddEvent(eventType, taskID, holderID string, payload interface{}) (*models.Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal event payload: %w", err)
+	}
+	ev := &models.Event{
 		ID:        uuid.New().String(),
+		Type:      eventType,
 		TaskID:    taskID,
-		Content:   content,
-		Tags:      tags,
-		CreatedAt: now,
+		HolderID:  holderID,
+		Payload:   string(data),
+		CreatedAt: s.now(),
+	}
+
+	_, err = s.exec(
+		`INSERT INTO events (id, type, task_id, holder_id, payload, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		ev.ID, ev.Type, nullString(ev.TaskID), nullString(ev.HolderID), ev.Payload, ev.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert event: %w", err)
+	}
+	return ev, nil
+}
+
+// ListEvents returns events newer than since, oldest first, optionally
+// filtered by holder.
+func (s *Store) ListEvents(holderID string, since time.Time, limit int) ([]models.Event, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	query := `SELECT id, type, task_id, holder_id, payload, created_at FROM events WHERE created_at > ?`
+	args := []interface{}{since.UTC()}
+	if holderID != "" {
+		query += ` AND holder_id = ?`
+		args = append(args, holderID)
+	}
+	query += ` ORDER BY created_at ASC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.rdb.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		var ev models.Event
+		var taskID, holder, payload sql.NullString
+		if err := rows.Scan(&ev.ID, &ev.Type, &taskID, &holder, &payload, &ev.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan event: %w", err)
+		}
+		ev.TaskID, ev.HolderID, ev.Payload = taskID.String, holder.String, payload.String
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+// WritePDRBatch writes several Process Decision Records in one transaction.
+// Entries must already carry their ID and timestamp.
+func (s *Store) WritePDRBatch(entries []*models.PDREntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt := tx.Stmt(s.stmts.insertPDR)
+	for _, pdr := range entries {
+		if _, err := stmt.Exec(pdr.ID, pdr.Action, pdr.InputsHash, pdr.Outcome, pdr.TaskID, pdr.Details, pdr.Timestamp); err != nil {
+			return fmt.Errorf("insert pdr: %w", err)
+		}
+	}
+	return s.commit(tx)
+}
+
+// --- Memory Operations ---
+
+// memoryColumns is the column list read by scanMemoryItems.
+const memoryColumns = `id, task_id, content, tags, created_at, scope, seen_count, last_seen_at, source, source_hash`
+
+// AddMemory inserts a memory item in its default scope, or counts another
+// sighting of an existing item it duplicates (see AddMemoryBatch).
+func (s *Store) AddMemory(taskID, content, tags string) (*models.MemoryItem, error) {
+	items, err := s.AddMemoryBatch([]models.MemoryItem{{TaskID: taskID, Content: content, Tags: tags}})
+	if err != nil {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// AddMemoryBatch inserts several memory items in one transaction. Items
+// without a scope get their default one. An item whose content duplicates
+// one already in its scope (ignoring case and whitespace, or by similarity
+// with SetMemoryDedup) is not stored again: the existing item's seen count
+// goes up and it is returned in its place, marked Duplicate.
+func (s *Store) AddMemoryBatch(items []models.MemoryItem) ([]models.MemoryItem, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	if !s.hashesBackfilled.Load() {
+		if err := s.backfillMemoryHashes(); err != nil {
+			return nil, err
+		}
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := s.now()
+	stmt := tx.Stmt(s.stmts.insertMemory)
+	out := make([]models.MemoryItem, len(items))
+	for i, item := range items {
+		if item.Scope == "" {
+			item.Scope = models.DefaultMemoryScope(item.TaskID)
+		}
+		item.Content = s.redactor.Redact(item.Content)
+		hash := s.memoryHash(item.Content)
+		dupID, err := s.findDuplicate(tx, &item, hash)
+		if err != nil {
+			return nil, err
+		}
+		if dupID != "" {
+			existing, err := s.markSeen(tx, dupID, now)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = *existing
+			continue
+		}
+
+		item.ID = uuid.New().String()
+		item.CreatedAt = now
+		item.SeenCount = 1
+		sealed, err := s.encrypt(item.Content)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := stmt.Exec(item.ID, item.TaskID, sealed, item.Tags, item.CreatedAt, item.Scope, hash, item.Source, item.SourceHash); err != nil {
+			return nil, fmt.Errorf("insert memory: %w", err)
+		}
+		out[i] = item
+	}
+	if err := s.commit(tx); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return out, nil
+}
+
+// QueryMemory searches memory items by content. With scopes, only items in
+// one of them are returned.
+//
+// When encryption is enabled the content can't be matched in SQL, so recent
+// items are decrypted and filtered in memory instead.
+func (s *Store) QueryMemory(query string, scopes ...string) ([]models.MemoryItem, error) {
+	query = strings.TrimSpace(query)
+	where, args := scopeFilter(scopes)
+	if s.cipher != nil {
+		return s.queryMemoryDecrypted(query, where, args)
 	}
 
-	_, err := s.db.Exec(
-		`INSERT INTO memory_items (id, task_id, content, tags, created_at) VALUES (?, ?, ?, ?, ?)`,
-		item.ID, item.TaskID, item.Content, item.Tags, item.CreatedAt,
+	rows, err := s.rdb.Query(
+		`SELECT `+memoryColumns+` FROM memory_items WHERE content LIKE ?`+where+` ORDER BY created_at DESC LIMIT ?`,
+		append(append([]interface{}{"%" + query + "%"}, args...), memoryQueryLimit)...,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("insert memory: %w", err)
+		return nil, fmt.Errorf("query memory: %w", err)
 	}
-	return item, nil
+	defer rows.Close()
+	return s.scanMemoryItems(rows, nil)
 }
 
-// QueryMemory searches memory items by content.
-func (s *Store) QueryMemory(query string) ([]models.MemoryItem, error) {
-	rows, err := s.db.Query(
-		`SELECT id, task_id, content, tags, created_at FROM memory_items WHERE content LIKE ? ORDER BY created_at DESC LIMIT 50`,
-		"%"+strings.TrimSpace(query)+"%",
+// scopeFilter returns the SQL condition, appended after a WHERE clause, that
+// keeps items in one of scopes, and its arguments. No scopes keeps all.
+func scopeFilter(scopes []string) (string, []interface{}) {
+	if len(scopes) == 0 {
+		return "", nil
+	}
+	args := make([]interface{}, len(scopes))
+	for i, scope := range scopes {
+		args[i] = scope
+	}
+	return ` AND scope IN (?` + strings.Repeat(`, ?`, len(scopes)-1) + `)`, args
+}
+
+// memoryQueryLimit caps QueryMemory results.
+const memoryQueryLimit = 50
+
+// encryptedScanLimit caps how many recent items an encrypted search decrypts.
+const encryptedScanLimit = 5000
+
+func (s *Store) queryMemoryDecrypted(query, where string, args []interface{}) ([]models.MemoryItem, error) {
+	rows, err := s.rdb.Query(
+		`SELECT `+memoryColumns+` FROM memory_items WHERE 1 = 1`+where+` ORDER BY created_at DESC LIMIT ?`,
+		append(args, encryptedScanLimit)...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("query memory: %w", err)
 	}
 	defer rows.Close()
 
+	// Match SQLite LIKE, which is case-insensitive for ASCII
+	needle := strings.ToLower(query)
+	items, err := s.scanMemoryItems(rows, func(item *models.MemoryItem) bool {
+		return strings.Contains(strings.ToLower(item.Content), needle)
+	})
+	if len(items) > memoryQueryLimit {
+		items = items[:memoryQueryLimit]
+	}
+	return items, err
+}
+
+// scanMemoryItems decrypts and collects memory rows, keeping those accepted
+// by keep (all rows if keep is nil).
+func (s *Store) scanMemoryItems(rows *sql.Rows, keep func(*models.MemoryItem) bool) ([]models.MemoryItem, error) {
 	var items []models.MemoryItem
 	for rows.Next() {
 		var item models.MemoryItem
-		var taskID sql.NullString
-		if err := rows.Scan(&item.ID, &taskID, &item.Content, &item.Tags, &item.CreatedAt); err != nil {
+		var taskID, scope, source, sourceHash sql.NullString
+		var lastSeen sql.NullTime
+		if err := rows.Scan(&item.ID, &taskID, &item.Content, &item.Tags, &item.CreatedAt, &scope, &item.SeenCount, &lastSeen, &source, &sourceHash); err != nil {
 			return nil, fmt.Errorf("scan memory: %w", err)
 		}
-		if taskID.Valid {
-			item.TaskID = taskID.String
+		item.TaskID, item.Source, item.SourceHash = taskID.String, source.String, sourceHash.String
+		if lastSeen.Valid {
+			item.LastSeenAt = &lastSeen.Time
+		}
+		item.Scope = scope.String
+		if item.Scope == "" {
+			item.Scope = models.DefaultMemoryScope(item.TaskID)
+		}
+
+		content, err := s.decrypt(item.Content)
+		if err != nil {
+			return nil, err
+		}
+		item.Content = content
+
+		if keep == nil || keep(&item) {
+			items = append(items, item)
 		}
-		items = append(items, item)
 	}
 	return items, rows.Err()
 }
 
 // GetMemoryForTask returns memory items for a specific task.
 func (s *Store) GetMemoryForTask(taskID string) ([]models.MemoryItem, error) {
-	rows, err := s.db.Query(
-		`SELECT id, task_id, content, tags, created_at FROM memory_items WHERE task_id = ? ORDER BY created_at DESC`,
+	rows, err := s.rdb.Query(
+		`SELECT `+memoryColumns+` FROM memory_items WHERE task_id = ? ORDER BY created_at DESC`,
 		taskID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("query memory for task: %w", err)
 	}
 	defer rows.Close()
+	return s.scanMemoryItems(rows, nil)
+}
 
-	var items []models.MemoryItem
+// GetMemoryItem returns a memory item by ID, or nil if it does not exist.
+func (s *Store) GetMemoryItem(id string) (*models.MemoryItem, error) {
+	rows, err := s.rdb.Query(`SELECT `+memoryColumns+` FROM memory_items WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("query memory item: %w", err)
+	}
+	defer rows.Close()
+
+	items, err := s.scanMemoryItems(rows, nil)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// SetMemoryScope moves a memory item to another scope. The item keeps its
+// task ID, which records where it was learned.
+func (s *Store) SetMemoryScope(id, scope string) error {
+	_, err := s.exec(`UPDATE memory_items SET scope = ? WHERE id = ?`, scope, id)
+	return err
+}
+
+// --- Comment Operations ---
+
+// AddComment appends a comment to a task's thread.
+func (s *Store) AddComment(taskID, author, body string) (*models.Comment, error) {
+	c := &models.Comment{
+		ID:        uuid.New().String(),
+		TaskID:    taskID,
+		Author:    author,
+		Body:      body,
+		CreatedAt: s.now(),
+	}
+
+	sealed, err := s.encrypt(c.Body)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.exec(
+		`INSERT INTO task_comments (id, task_id, author, body, created_at) VALUES (?, ?, ?, ?, ?)`,
+		c.ID, c.TaskID, c.Author, sealed, c.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert comment: %w", err)
+	}
+	return c, nil
+}
+
+// ListComments returns a task's comments, oldest first. A non-zero since
+// returns only comments created after it.
+func (s *Store) ListComments(taskID string, since time.Time) ([]models.Comment, error) {
+	rows, err := s.rdb.Query(
+		`SELECT id, task_id, author, body, created_at FROM task_comments WHERE task_id = ? AND created_at > ? ORDER BY created_at ASC`,
+		taskID, since.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query comments: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []models.Comment
 	for rows.Next() {
-		var item models.MemoryItem
-		if err := rows.Scan(&item.ID, &item.TaskID, &item.Content, &item.Tags, &item.CreatedAt); err != nil {
-			return nil, fmt.Errorf("scan memory: %w", err)
+		var c models.Comment
+		if err := rows.Scan(&c.ID, &c.TaskID, &c.Author, &c.Body, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan comment: %w", err)
+		}
+		body, err := s.decrypt(c.Body)
+		if err != nil {
+			return nil, err
+		}
+		c.Body = body
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+// --- Checklist Operations ---
+
+// AddChecklistItems appends unchecked items to a task's checklist.
+func (s *Store) AddChecklistItems(taskID string, texts []string) ([]models.ChecklistItem, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var next int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(position), 0) + 1 FROM task_checklist WHERE task_id = ?`, taskID).Scan(&next); err != nil {
+		return nil, fmt.Errorf("query checklist position: %w", err)
+	}
+	now := s.now()
+	items := make([]models.ChecklistItem, len(texts))
+	for i, text := range texts {
+		items[i] = models.ChecklistItem{ID: uuid.New().String(), TaskID: taskID, Position: next + i, Text: text, CreatedAt: now}
+		if _, err := tx.Exec(
+			`INSERT INTO task_checklist (id, task_id, position, text, created_at) VALUES (?, ?, ?, ?, ?)`,
+			items[i].ID, taskID, items[i].Position, text, now,
+		); err != nil {
+			return nil, fmt.Errorf("insert checklist item: %w", err)
+		}
+	}
+	if err := s.commit(tx); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return items, nil
+}
+
+// ListChecklist returns a task's checklist in order.
+func (s *Store) ListChecklist(taskID string) ([]models.ChecklistItem, error) {
+	rows, err := s.rdb.Query(
+		`SELECT id, task_id, position, text, done, checked_by, checked_at, created_at FROM task_checklist WHERE task_id = ? ORDER BY position`,
+		taskID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query checklist: %w", err)
+	}
+	defer rows.Close()
+
+	var items []models.ChecklistItem
+	for rows.Next() {
+		var item models.ChecklistItem
+		var checkedBy sql.NullString
+		var checkedAt sql.NullTime
+		if err := rows.Scan(&item.ID, &item.TaskID, &item.Position, &item.Text, &item.Done, &checkedBy, &checkedAt, &item.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan checklist item: %w", err)
+		}
+		item.CheckedBy = checkedBy.String
+		if checkedAt.Valid {
+			item.CheckedAt = &checkedAt.Time
 		}
 		items = append(items, item)
 	}
 	return items, rows.Err()
 }
+
+// SetChecklistItemDone checks or unchecks an item of a task's checklist,
+// recording who checked it. It returns nil if the task has no such item.
+func (s *Store) SetChecklistItemDone(taskID, itemID string, done bool, by string) (*models.ChecklistItem, error) {
+	var checkedAt sql.NullTime
+	if done {
+		checkedAt = sql.NullTime{Time: s.now(), Valid: true}
+	} else {
+		by = ""
+	}
+	res, err := s.exec(
+		`UPDATE task_checklist SET done = ?, checked_by = ?, checked_at = ? WHERE id = ? AND task_id = ?`,
+		done, nullString(by), checkedAt, itemID, taskID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("update checklist item: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+	items, err := s.ListChecklist(taskID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		if items[i].ID == itemID {
+			return &items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// nullString maps an empty string to SQL NULL.
+func nullString(v string) sql.NullString {
+	return sql.NullString{String: v, Valid: v != ""}
+}
+
+// nullInt maps zero to SQL NULL.
+func nullInt(v int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(v), Valid: v != 0}
+}
+
+// nullTime maps a nil time to SQL NULL.
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
@@ -0,0 +1,224 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/google/uuid"
+)
+
+func BenchmarkAtomicClaimTask(b *testing.B) {
+	s := newTestStore(b)
+	defer s.Close()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := s.CreateTask(fmt.Sprintf("task-%d", i), ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		task, _, err := s.AtomicClaimTask("bench-worker", 300)
+		if err != nil || task == nil {
+			b.Fatalf("claim %d failed: task=%v err=%v", i, task, err)
+		}
+	}
+}
+
+func BenchmarkClaimTaskWithLeaseTx(b *testing.B) {
+	s := newTestStore(b)
+	defer s.Close()
+
+	ids := make([]string, b.N)
+	for i := range ids {
+		task, err := s.CreateTask(fmt.Sprintf("task-%d", i), "")
+		if err != nil {
+			b.Fatal(err)
+		}
+		ids[i] = task.ID
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.ClaimTaskWithLeaseTx(ids[i], "bench-agent", 300); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// seedTasks inserts n pending tasks in one transaction, which is much
+// faster than CreateTask for the large tables the list benchmarks need.
+func seedTasks(b *testing.B, s *Store, n int) []string {
+	b.Helper()
+	tx, err := s.db.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`INSERT INTO tasks (id, title, description, status, created_at, updated_at) VALUES (?, ?, '', ?, ?, ?)`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer stmt.Close()
+
+	ids := make([]string, n)
+	start := time.Now().UTC().Add(-time.Duration(n) * time.Millisecond)
+	for i := range ids {
+		ids[i] = uuid.New().String()
+		at := start.Add(time.Duration(i) * time.Millisecond)
+		if _, err := stmt.Exec(ids[i], fmt.Sprintf("task-%d", i), models.TaskStatusPending, at, at); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+	return ids
+}
+
+// contend runs claim b.N times, split across workers goroutines that share
+// one counter, so every claim competes for the store's writer.
+func contend(b *testing.B, workers int, claim func(worker, i int) error) {
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+
+	b.ResetTimer()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= b.N {
+					return
+				}
+				if err := claim(w, i); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	b.StopTimer()
+
+	close(errs)
+	if err := <-errs; err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkAtomicClaimTaskContended(b *testing.B) {
+	for _, workers := range []int{10, 100} {
+		b.Run(fmt.Sprintf("goroutines=%d", workers), func(b *testing.B) {
+			s := newTestStore(b)
+			defer s.Close()
+			seedTasks(b, s, b.N)
+
+			contend(b, workers, func(w, i int) error {
+				task, _, err := s.AtomicClaimTask(fmt.Sprintf("worker-%d", w), 300)
+				if err == nil && task == nil {
+					err = fmt.Errorf("claim %d found no pending task", i)
+				}
+				return err
+			})
+		})
+	}
+}
+
+func BenchmarkClaimTaskWithLeaseTxContended(b *testing.B) {
+	for _, workers := range []int{10, 100} {
+		b.Run(fmt.Sprintf("goroutines=%d", workers), func(b *testing.B) {
+			s := newTestStore(b)
+			defer s.Close()
+			ids := seedTasks(b, s, b.N)
+
+			contend(b, workers, func(w, i int) error {
+				_, err := s.ClaimTaskWithLeaseTx(ids[i], fmt.Sprintf("agent-%d", w), 300)
+				return err
+			})
+		})
+	}
+}
+
+func BenchmarkListTasks(b *testing.B) {
+	for _, n := range []int{10_000, 100_000} {
+		b.Run(fmt.Sprintf("tasks=%d", n), func(b *testing.B) {
+			s := newTestStore(b)
+			defer s.Close()
+			seedTasks(b, s, n)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tasks, err := s.ListTasks(string(models.TaskStatusPending))
+				if err != nil || len(tasks) != n {
+					b.Fatalf("listed %d tasks, want %d (err=%v)", len(tasks), n, err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkQueryMemory(b *testing.B) {
+	s := newTestStore(b)
+	defer s.Close()
+
+	const n = 10_000
+	items := make([]models.MemoryItem, n)
+	for i := range items {
+		items[i] = models.MemoryItem{Content: fmt.Sprintf("note %d about the staging cluster, build %d", i, i%97), Tags: "bench"}
+	}
+	if _, err := s.AddMemoryBatch(items); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.QueryMemory(fmt.Sprintf("build %d", i%97)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWritePDR(b *testing.B) {
+	s := newTestStore(b)
+	defer s.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.WritePDR("bench", "hash", "success", "", ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWritePDRBatch64(b *testing.B) {
+	s := newTestStore(b)
+	defer s.Close()
+
+	const batchSize = 64
+	batch := make([]*models.PDREntry, 0, batchSize)
+	flush := func() {
+		if err := s.WritePDRBatch(batch); err != nil {
+			b.Fatal(err)
+		}
+		batch = batch[:0]
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		batch = append(batch, &models.PDREntry{
+			ID: uuid.New().String(), Action: "bench", InputsHash: "hash", Outcome: "success", Timestamp: time.Now().UTC(),
+		})
+		if len(batch) == batchSize {
+			flush()
+		}
+	}
+	flush()
+}
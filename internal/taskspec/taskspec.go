@@ -0,0 +1,101 @@
+// Package taskspec parses YAML frontmatter at the top of a task description,
+// so tasks imported from markdown specs carry typed metadata:
+//
+//	---
+//	acceptance_criteria:
+//	  - Login works with SSO
+//	commands:
+//	  - go test ./...
+//	steps:
+//	  - {command: go, args: [vet, ./...], continue_on_error: true}
+//	  - {command: go, args: [test, ./...]}
+//	labels: [auth]
+//	connector: localexec
+//	---
+//	The rest of the description.
+package taskspec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// Spec is the metadata a description's frontmatter can set.
+type Spec struct {
+	AcceptanceCriteria []string         `yaml:"acceptance_criteria"`
+	Commands           []string         `yaml:"commands"`
+	Steps              []models.RunStep `yaml:"steps"`
+	Labels             []string         `yaml:"labels"`
+	Connector          string           `yaml:"connector"`
+}
+
+const delimiter = "---"
+
+// Parse splits description into its frontmatter and the markdown after it.
+// A description without frontmatter returns a nil spec and is unchanged.
+// Frontmatter that is not valid YAML, or has unknown keys, is an error so a
+// typo is not silently kept as text.
+func Parse(description string) (*Spec, string, error) {
+	text := strings.TrimPrefix(description, "\ufeff")
+	first, rest, ok := strings.Cut(text, "\n")
+	if !ok || strings.TrimSpace(first) != delimiter {
+		return nil, description, nil
+	}
+
+	var front strings.Builder
+	for {
+		line, after, more := strings.Cut(rest, "\n")
+		if strings.TrimRight(line, " \t\r") == delimiter {
+			spec, err := decode(front.String())
+			if err != nil {
+				return nil, description, err
+			}
+			return spec, strings.TrimLeft(after, "\r\n"), nil
+		}
+		if !more {
+			// No closing delimiter: a description that merely starts
+			// with a horizontal rule
+			return nil, description, nil
+		}
+		front.WriteString(line)
+		front.WriteByte('\n')
+		rest = after
+	}
+}
+
+func decode(front string) (*Spec, error) {
+	spec := &Spec{}
+	dec := yaml.NewDecoder(bytes.NewBufferString(front))
+	dec.KnownFields(true)
+	if err := dec.Decode(spec); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("description frontmatter: %w", err)
+	}
+	spec.AcceptanceCriteria = clean(spec.AcceptanceCriteria)
+	spec.Commands = clean(spec.Commands)
+	for i, step := range spec.Steps {
+		if spec.Steps[i].Command = strings.TrimSpace(step.Command); spec.Steps[i].Command == "" {
+			return nil, fmt.Errorf("description frontmatter: step %d has no command", i+1)
+		}
+	}
+	spec.Labels = clean(spec.Labels)
+	spec.Connector = strings.TrimSpace(spec.Connector)
+	return spec, nil
+}
+
+// clean trims entries and drops empty ones.
+func clean(items []string) []string {
+	var out []string
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package taskspec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+func TestParse(t *testing.T) {
+	desc := "---\nacceptance_criteria:\n  - Login works with SSO\n  - ''\ncommands: [go test ./...]\nsteps:\n  - {command: ' go ', args: [vet], continue_on_error: true}\nlabels: [auth, ' backend ']\nconnector: localexec\n---\n\n# Login\nDetails.\n"
+	spec, body, err := Parse(desc)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want := &Spec{
+		AcceptanceCriteria: []string{"Login works with SSO"},
+		Commands:           []string{"go test ./..."},
+		Steps:              []models.RunStep{{Command: "go", Args: []string{"vet"}, ContinueOnError: true}},
+		Labels:             []string{"auth", "backend"},
+		Connector:          "localexec",
+	}
+	if !reflect.DeepEqual(spec, want) {
+		t.Errorf("spec = %+v, want %+v", spec, want)
+	}
+	if body != "# Login\nDetails.\n" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestParseWithoutFrontmatter(t *testing.T) {
+	for _, desc := range []string{
+		"",
+		"Just text",
+		"---\nA horizontal rule with nothing closing it",
+		"Text\n---\nlabels: [x]\n---\n",
+	} {
+		spec, body, err := Parse(desc)
+		if err != nil || spec != nil || body != desc {
+			t.Errorf("Parse(%q) = %+v, %q, %v; want it unchanged", desc, spec, body, err)
+		}
+	}
+}
+
+func TestParseEmptyFrontmatter(t *testing.T) {
+	spec, body, err := Parse("---\n---\nBody")
+	if err != nil || spec == nil || body != "Body" {
+		t.Errorf("Parse = %+v, %q, %v", spec, body, err)
+	}
+}
+
+func TestParseRejectsBadFrontmatter(t *testing.T) {
+	for _, desc := range []string{
+		"---\nlabels: [unclosed\n---\nBody",
+		"---\nacceptance: [typo]\n---\nBody",
+	} {
+		if _, body, err := Parse(desc); err == nil || body != desc {
+			t.Errorf("Parse(%q) should fail and leave the description", desc)
+		}
+	}
+}
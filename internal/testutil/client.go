@@ -0,0 +1,272 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+// StatusError is returned for responses with a 4xx or 5xx status.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.Code, strings.TrimSpace(e.Body))
+}
+
+// Client is a typed client for the daemon's HTTP API.
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+	// Header is added to every request, e.g. Authorization for API keys.
+	Header http.Header
+}
+
+// NewClient returns a client for the API at baseURL.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTP:    &http.Client{Timeout: 30 * time.Second},
+		Header:  http.Header{},
+	}
+}
+
+// WithToken returns a copy of the client that sends token as a bearer
+// token: an API key, or the admin token for /admin/ endpoints.
+func (c *Client) WithToken(token string) *Client {
+	cp := *c
+	cp.Header = c.Header.Clone()
+	cp.Header.Set("Authorization", "Bearer "+token)
+	return &cp
+}
+
+// Do sends body as JSON and decodes the response into out, if both are
+// non-nil. It returns the response status, with a *StatusError for 4xx and
+// 5xx responses.
+func (c *Client) Do(method, path string, body, out interface{}) (int, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.BaseURL+path, r)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode >= 400 {
+		return resp.StatusCode, &StatusError{Code: resp.StatusCode, Body: string(data)}
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("decode %s %s: %w", method, path, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// TaskRequest is the body of POST /tasks.
+type TaskRequest struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	MutexKey    string   `json:"mutex_key,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+	Connector   string   `json:"connector,omitempty"`
+	WorkDir     string   `json:"workdir,omitempty"`
+}
+
+// CreateTask creates a task.
+func (c *Client) CreateTask(req TaskRequest) (*models.Task, error) {
+	var task models.Task
+	if _, err := c.Do(http.MethodPost, "/tasks", req, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// Task fetches a task.
+func (c *Client) Task(id string) (*models.Task, error) {
+	var task models.Task
+	if _, err := c.Do(http.MethodGet, "/tasks/"+id, nil, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// Tasks lists tasks, all of them if status is "".
+func (c *Client) Tasks(status string) ([]models.Task, error) {
+	path := "/tasks"
+	if status != "" {
+		path += "?status=" + url.QueryEscape(status)
+	}
+	var tasks []models.Task
+	if _, err := c.Do(http.MethodGet, path, nil, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// Claim claims a task for holder. A ttlSec of 0 uses the daemon's default.
+// The returned lease carries the holder token the other holder calls need.
+func (c *Client) Claim(taskID, holder string, ttlSec int) (*models.Lease, error) {
+	var lease models.Lease
+	body := map[string]interface{}{"holder_id": holder, "ttl_sec": ttlSec}
+	if _, err := c.Do(http.MethodPost, "/tasks/"+taskID+"/claim", body, &lease); err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// ClaimNext claims the next pending task, by priority then age, matching
+// label and connector, either of which may be "". It returns nil when no
+// task matches.
+func (c *Client) ClaimNext(holder, label, connector string) (*store.ClaimResult, error) {
+	var res store.ClaimResult
+	body := map[string]interface{}{"holder_id": holder, "label": label, "connector": connector}
+	code, err := c.Do(http.MethodPost, "/tasks/claim-next", body, &res)
+	if err != nil || code == http.StatusNoContent {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// holderBody identifies the lease holder in a request.
+func holderBody(lease *models.Lease) map[string]interface{} {
+	return map[string]interface{}{"holder_id": lease.HolderID, "holder_token": lease.HolderToken}
+}
+
+// Heartbeat renews the lease. A ttlSec of 0 uses the daemon's default.
+func (c *Client) Heartbeat(lease *models.Lease, ttlSec int) error {
+	body := holderBody(lease)
+	body["ttl_sec"] = ttlSec
+	_, err := c.Do(http.MethodPost, "/tasks/"+lease.TaskID+"/heartbeat", body, nil)
+	return err
+}
+
+// Release returns the leased task to pending.
+func (c *Client) Release(lease *models.Lease) error {
+	_, err := c.Do(http.MethodPost, "/tasks/"+lease.TaskID+"/release", holderBody(lease), nil)
+	return err
+}
+
+// Complete marks the leased task completed.
+func (c *Client) Complete(lease *models.Lease) error {
+	_, err := c.Do(http.MethodPost, "/tasks/"+lease.TaskID+"/complete", holderBody(lease), nil)
+	return err
+}
+
+// RunRequest is a command to run on a claimed task.
+type RunRequest struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args,omitempty"`
+	Stdin   string            `json:"stdin,omitempty"`
+	PTY     bool              `json:"pty,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+// Run runs a command on the leased task.
+func (c *Client) Run(lease *models.Lease, req RunRequest) (*models.Run, error) {
+	body := struct {
+		HolderID    string `json:"holder_id"`
+		HolderToken string `json:"holder_token"`
+		RunRequest
+	}{lease.HolderID, lease.HolderToken, req}
+	var run models.Run
+	if _, err := c.Do(http.MethodPost, "/tasks/"+lease.TaskID+"/run", body, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// Logs returns a task's runs, newest first.
+func (c *Client) Logs(taskID string, limit, offset int) ([]models.Run, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	if offset > 0 {
+		q.Set("offset", strconv.Itoa(offset))
+	}
+	path := "/tasks/" + taskID + "/logs"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var runs []models.Run
+	if _, err := c.Do(http.MethodGet, path, nil, &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// Comment adds a comment to a task.
+func (c *Client) Comment(taskID, author, body string) (*models.Comment, error) {
+	var comment models.Comment
+	req := map[string]string{"author": author, "body": body}
+	if _, err := c.Do(http.MethodPost, "/tasks/"+taskID+"/comments", req, &comment); err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// Comments lists a task's comments, oldest first.
+func (c *Client) Comments(taskID string) ([]models.Comment, error) {
+	var comments []models.Comment
+	if _, err := c.Do(http.MethodGet, "/tasks/"+taskID+"/comments", nil, &comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// Events lists notifications for holder after since; a zero since and a
+// limit of 0 use the daemon's defaults.
+func (c *Client) Events(holder string, since time.Time, limit int) ([]models.Event, error) {
+	q := url.Values{"holder": {holder}}
+	if !since.IsZero() {
+		q.Set("since", since.Format(time.RFC3339Nano))
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var events []models.Event
+	if _, err := c.Do(http.MethodGet, "/events?"+q.Encode(), nil, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// ForceRelease releases a task as an administrator, which requires a client
+// authenticated with the admin token.
+func (c *Client) ForceRelease(taskID, actor, reason string) error {
+	body := map[string]string{"actor": actor, "reason": reason}
+	_, err := c.Do(http.MethodPost, "/admin/tasks/"+taskID+"/force-release", body, nil)
+	return err
+}
@@ -0,0 +1,124 @@
+// Package testutil runs a Neona daemon in-process for end-to-end tests.
+//
+// StartDaemon serves the full HTTP API on a random local port with a
+// temporary SQLite database, and Client talks to it the way agents do:
+//
+//	d := testutil.StartDaemon(t, testutil.Options{})
+//	task := d.MustCreateTask(t, "Build")
+//	lease := d.MustClaim(t, task.ID, "worker-1")
+//	run := d.MustRun(t, lease, "go", "test", "./...")
+//
+// Everything is torn down when the test ends.
+package testutil
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/fentz26/neona/internal/audit"
+	"github.com/fentz26/neona/internal/connectors"
+	"github.com/fentz26/neona/internal/controlplane"
+	"github.com/fentz26/neona/internal/models"
+	"github.com/fentz26/neona/internal/store"
+)
+
+// Options configures a test daemon.
+type Options struct {
+	// Connector runs task commands. The default is a Recorder that allows
+	// every command.
+	Connector connectors.Connector
+	// AdminToken enables the /admin/ endpoints.
+	AdminToken string
+	// Configure, if set, is called before the daemon starts serving, to set
+	// up what Options does not cover (API keys, worktrees, MCP routing, ...).
+	Configure func(*controlplane.Service, *controlplane.Server)
+}
+
+// Daemon is a running in-process daemon.
+type Daemon struct {
+	// URL is the base URL of the API, e.g. http://127.0.0.1:41234.
+	URL string
+
+	Store     *store.Store
+	Service   *controlplane.Service
+	Server    *controlplane.Server
+	Connector connectors.Connector
+	// Recorder is the default connector, or nil when Options.Connector was
+	// set.
+	Recorder *Recorder
+
+	http *httptest.Server
+	pdr  *audit.PDRWriter
+}
+
+// StartDaemon starts a daemon for the duration of the test.
+func StartDaemon(t testing.TB, opts Options) *Daemon {
+	t.Helper()
+
+	st, err := store.New(filepath.Join(t.TempDir(), "neona.db"))
+	if err != nil {
+		t.Fatalf("testutil: open store: %v", err)
+	}
+	d := &Daemon{Store: st, Connector: opts.Connector, pdr: audit.NewPDRWriter(st)}
+	if d.Connector == nil {
+		d.Recorder = &Recorder{}
+		d.Connector = d.Recorder
+	}
+
+	d.Service = controlplane.NewService(st, d.pdr, d.Connector)
+	d.Server = controlplane.NewServer(d.Service, st, "127.0.0.1:0")
+	d.Server.SetAdminToken(opts.AdminToken)
+	if opts.Configure != nil {
+		opts.Configure(d.Service, d.Server)
+	}
+
+	d.http = httptest.NewServer(d.Server.Handler())
+	d.URL = d.http.URL
+	t.Cleanup(d.close)
+	return d
+}
+
+// close stops serving and releases the store.
+func (d *Daemon) close() {
+	d.http.Close()
+	d.pdr.Close()
+	d.Store.Close()
+}
+
+// Client returns a client for the daemon's API.
+func (d *Daemon) Client() *Client {
+	return NewClient(d.URL)
+}
+
+// MustCreateTask creates a task through the API, failing the test on error.
+func (d *Daemon) MustCreateTask(t testing.TB, title string) *models.Task {
+	t.Helper()
+	task, err := d.Client().CreateTask(TaskRequest{Title: title})
+	if err != nil {
+		t.Fatalf("testutil: create task: %v", err)
+	}
+	return task
+}
+
+// MustClaim claims a task for holder through the API, failing the test on
+// error.
+func (d *Daemon) MustClaim(t testing.TB, taskID, holder string) *models.Lease {
+	t.Helper()
+	lease, err := d.Client().Claim(taskID, holder, 0)
+	if err != nil {
+		t.Fatalf("testutil: claim %s: %v", taskID, err)
+	}
+	return lease
+}
+
+// MustRun runs a command on a claimed task through the API, failing the
+// test on error.
+func (d *Daemon) MustRun(t testing.TB, lease *models.Lease, command string, args ...string) *models.Run {
+	t.Helper()
+	run, err := d.Client().Run(lease, RunRequest{Command: command, Args: args})
+	if err != nil {
+		t.Fatalf("testutil: run %s: %v", command, err)
+	}
+	return run
+}
@@ -0,0 +1,139 @@
+package testutil
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/connectors"
+	"github.com/fentz26/neona/internal/controlplane"
+	"github.com/fentz26/neona/internal/models"
+)
+
+func TestDaemonLifecycle(t *testing.T) {
+	d := StartDaemon(t, Options{})
+	d.Recorder.Result = func(call Call) *connectors.ExecResult {
+		if call.Command == "false" {
+			return &connectors.ExecResult{ExitCode: 1, Stderr: "failed\n"}
+		}
+		return nil
+	}
+	c := d.Client()
+
+	task := d.MustCreateTask(t, "Build")
+	lease := d.MustClaim(t, task.ID, "worker-1")
+	if lease.HolderToken == "" {
+		t.Fatal("Expected the claim to return a holder token")
+	}
+
+	// Errors carry the response status
+	forged := &models.Lease{TaskID: task.ID, HolderID: "worker-1", HolderToken: "guess"}
+	err := c.Heartbeat(forged, 0)
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusForbidden {
+		t.Errorf("Expected a 403 with a wrong holder token, got %v", err)
+	}
+
+	run := d.MustRun(t, lease, "go", "test", "./...")
+	if run.ExitCode != 0 || run.Stdout != "go test ./...\n" {
+		t.Errorf("Unexpected run %+v", run)
+	}
+	if run, _ := c.Run(lease, RunRequest{Command: "false"}); run == nil || run.ExitCode != 1 {
+		t.Errorf("Expected the scripted failure, got %+v", run)
+	}
+	if calls := d.Recorder.Calls(); len(calls) != 2 || calls[0].Args[1] != "./..." {
+		t.Errorf("Expected 2 recorded calls, got %+v", calls)
+	}
+	if runs, err := c.Logs(task.ID, 0, 0); err != nil || len(runs) != 2 || runs[0].Command != "false" {
+		t.Errorf("Expected 2 runs newest first, got %d (err=%v)", len(runs), err)
+	}
+
+	if err := c.Heartbeat(lease, 60); err != nil {
+		t.Errorf("Heartbeat: %v", err)
+	}
+	if err := c.Complete(lease); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if got, _ := c.Task(task.ID); got.Status != models.TaskStatusCompleted {
+		t.Errorf("Status = %s, want completed", got.Status)
+	}
+	if res, err := c.ClaimNext("worker-2", "", ""); err != nil || res != nil {
+		t.Errorf("Expected nothing to claim, got %+v (err=%v)", res, err)
+	}
+}
+
+func TestDaemonEvents(t *testing.T) {
+	d := StartDaemon(t, Options{AdminToken: "secret"})
+	c := d.Client()
+
+	task, err := c.CreateTask(TaskRequest{Title: "Deploy", Labels: []string{"ops"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.ClaimNext("worker-1", "ops", "")
+	if err != nil || res == nil || res.Task.ID != task.ID {
+		t.Fatalf("Expected to claim the labelled task, got %+v (err=%v)", res, err)
+	}
+	since := time.Now().Add(-time.Second)
+
+	if _, err := c.Comment(task.ID, "reviewer", "Hold off until Friday"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ForceRelease(task.ID, "ops", "stuck"); err == nil {
+		t.Error("Expected force-release without the admin token to fail")
+	}
+	if err := c.WithToken("secret").ForceRelease(task.ID, "ops", "stuck"); err != nil {
+		t.Fatalf("ForceRelease: %v", err)
+	}
+
+	events, err := c.Events("worker-1", since, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	if got := strings.Join(types, ","); got != controlplane.EventTaskComment+","+controlplane.EventTaskForceReleased {
+		t.Errorf("Events = %s", got)
+	}
+	if got, _ := c.Task(task.ID); got.Status != models.TaskStatusPending {
+		t.Errorf("Status = %s, want pending", got.Status)
+	}
+}
+
+func TestDaemonConfigure(t *testing.T) {
+	conn := &Recorder{Allow: func(cmd string, _ []string) bool { return cmd == "make" }}
+	d := StartDaemon(t, Options{
+		Connector: conn,
+		Configure: func(_ *controlplane.Service, srv *controlplane.Server) {
+			srv.SetAPIKeys(map[string]string{"alice": "key-1"})
+		},
+	})
+	if d.Recorder != nil {
+		t.Error("Expected no default recorder with a custom connector")
+	}
+
+	if _, err := d.Client().CreateTask(TaskRequest{Title: "Anon"}); err == nil {
+		t.Fatal("Expected unauthenticated requests to be rejected")
+	}
+	c := d.Client().WithToken("key-1")
+	task, err := c.CreateTask(TaskRequest{Title: "Authed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lease, err := c.Claim(task.ID, "alice", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Run(lease, RunRequest{Command: "rm", Args: []string{"-rf", "/"}})
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusForbidden {
+		t.Errorf("Expected a 403 for a denied command, got %v", err)
+	}
+	if len(conn.Calls()) != 0 {
+		t.Error("Expected the denied command not to run")
+	}
+}
@@ -0,0 +1,82 @@
+package testutil
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/fentz26/neona/internal/connectors"
+)
+
+// Call is a command a Recorder was asked to run.
+type Call struct {
+	Command string
+	Args    []string
+	WorkDir string
+	Env     map[string]string
+	Input   connectors.Input
+	Sandbox string
+}
+
+// Recorder is a connector that runs nothing. It records each command and
+// answers with Result, or with exit code 0 and the command line echoed on
+// stdout.
+type Recorder struct {
+	// Allow decides IsAllowed; nil allows everything.
+	Allow func(cmd string, args []string) bool
+	// Result, if set, produces the result for a call.
+	Result func(call Call) *connectors.ExecResult
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Name returns the connector identifier.
+func (r *Recorder) Name() string {
+	return "recorder"
+}
+
+// Capabilities reports every feature but streaming, so any run can be
+// recorded.
+func (r *Recorder) Capabilities() connectors.Capabilities {
+	return connectors.Capabilities{Stdin: true, PTY: true, WorkDir: true, Env: true, Timeout: true, Sandbox: true}
+}
+
+// IsAllowed reports whether Allow accepts the command.
+func (r *Recorder) IsAllowed(cmd string, args []string) bool {
+	return r.Allow == nil || r.Allow(cmd, args)
+}
+
+// Execute records the call and returns its scripted result.
+func (r *Recorder) Execute(ctx context.Context, cmd string, args []string) (*connectors.ExecResult, error) {
+	if !r.IsAllowed(cmd, args) {
+		return nil, &connectors.CommandDeniedError{Command: cmd, Args: args, Suggestions: []string{}}
+	}
+	call := Call{
+		Command: cmd,
+		Args:    args,
+		WorkDir: connectors.WorkDirFromContext(ctx),
+		Env:     connectors.EnvFromContext(ctx),
+		Input:   connectors.InputFromContext(ctx),
+		Sandbox: connectors.SandboxFromContext(ctx),
+	}
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	r.mu.Unlock()
+
+	if r.Result != nil {
+		if res := r.Result(call); res != nil {
+			res.Command, res.Args = cmd, args
+			return res, nil
+		}
+	}
+	line := strings.TrimSpace(cmd + " " + strings.Join(args, " "))
+	return &connectors.ExecResult{Command: cmd, Args: args, Stdout: line + "\n"}, nil
+}
+
+// Calls returns the commands run so far, oldest first.
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
@@ -0,0 +1,138 @@
+// Package transport resolves Neona API addresses to listeners and HTTP clients.
+//
+// An address is either an HTTP URL (http://127.0.0.1:7466), a bare host:port
+// (127.0.0.1:7466), or a Unix domain socket (unix:///home/me/.neona/neona.sock).
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// UnixScheme prefixes Unix domain socket addresses.
+const UnixScheme = "unix://"
+
+// unixBaseURL is the placeholder base URL used for requests over a Unix socket.
+const unixBaseURL = "http://unix"
+
+// SocketPath returns the socket path if addr is a unix:// address.
+func SocketPath(addr string) (string, bool) {
+	if !strings.HasPrefix(addr, UnixScheme) {
+		return "", false
+	}
+	return strings.TrimPrefix(addr, UnixScheme), true
+}
+
+// Listen opens a listener for a daemon listen address. Unix sockets are
+// created with 0600 permissions so only the owning user can reach the API.
+func Listen(addr string) (net.Listener, error) {
+	path, ok := SocketPath(addr)
+	if !ok {
+		return net.Listen("tcp", strings.TrimPrefix(strings.TrimPrefix(addr, "http://"), "https://"))
+	}
+	if path == "" {
+		return nil, fmt.Errorf("empty unix socket path in %q", addr)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("create socket directory: %w", err)
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("chmod socket: %w", err)
+	}
+	return ln, nil
+}
+
+// removeStaleSocket deletes a socket file left behind by a daemon that is no
+// longer listening. It refuses to touch non-socket files or live sockets.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat socket: %w", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, 200*time.Millisecond); err == nil {
+		conn.Close()
+		return fmt.Errorf("another daemon is already listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("remove stale socket: %w", err)
+	}
+	return nil
+}
+
+// NewClient returns an HTTP client and the base URL to prefix request paths
+// with for an API address.
+func NewClient(addr string, timeout time.Duration) (*http.Client, string) {
+	path, ok := SocketPath(addr)
+	if !ok {
+		base := strings.TrimRight(addr, "/")
+		if !strings.Contains(base, "://") {
+			base = "http://" + base
+		}
+		return &http.Client{Timeout: timeout}, base
+	}
+
+	dialer := &net.Dialer{}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		},
+	}, unixBaseURL
+}
+
+// APIKeyEnv names the environment variable clients read their API key from.
+const APIKeyEnv = "NEONA_API_KEY"
+
+// WithAPIKey makes client send "Authorization: Bearer <key>" on every
+// request that does not set its own Authorization header. An empty key
+// leaves the client unchanged.
+func WithAPIKey(client *http.Client, key string) *http.Client {
+	if key == "" {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &bearerTransport{key: key, base: base}
+	return client
+}
+
+type bearerTransport struct {
+	key  string
+	base http.RoundTripper
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.key)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,96 @@
+package transport
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnixSocketRoundTrip(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "neona.sock")
+	addr := UnixScheme + sock
+
+	ln, err := Listen(addr)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	info, err := os.Stat(sock)
+	if err != nil {
+		t.Fatalf("Stat socket failed: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("Expected socket permissions 0600, got %o", perm)
+	}
+
+	client, base := NewClient(addr, time.Second)
+	resp, err := client.Get(base + "/health")
+	if err != nil {
+		t.Fatalf("GET over unix socket failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "/health" {
+		t.Errorf("Expected path /health, got %q", body)
+	}
+
+	// A second daemon must not steal a live socket
+	if _, err := Listen(addr); err == nil {
+		t.Error("Expected Listen on a live socket to fail")
+	}
+}
+
+func TestNewClientBaseURL(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"http://127.0.0.1:7466", "http://127.0.0.1:7466"},
+		{"http://127.0.0.1:7466/", "http://127.0.0.1:7466"},
+		{"127.0.0.1:7466", "http://127.0.0.1:7466"},
+		{"unix:///tmp/neona.sock", "http://unix"},
+	}
+	for _, tt := range tests {
+		if _, got := NewClient(tt.addr, time.Second); got != tt.want {
+			t.Errorf("NewClient(%q) base = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestWithAPIKey(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	client, base := NewClient(srv.URL, time.Second)
+	resp, err := WithAPIKey(client, "secret").Get(base + "/tasks")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if got != "Bearer secret" {
+		t.Errorf("Expected bearer header, got %q", got)
+	}
+
+	// A request's own credentials, such as an admin token, win
+	req, _ := http.NewRequest(http.MethodPost, base+"/admin/tasks/t1/force-release", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	if resp, err = client.Do(req); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if got != "Bearer admin" {
+		t.Errorf("Expected the request's own header, got %q", got)
+	}
+}
@@ -0,0 +1,97 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+)
+
+// actionClient is the subset of Client used to run quick actions.
+type actionClient interface {
+	Holds(taskID string) bool
+	ClaimTask(taskID string) error
+	ReleaseTask(taskID string) error
+	RunTask(taskID, command string, args []string) (int, error)
+	AddMemory(taskID, content string) (string, error)
+}
+
+// ActionStep records one step of a quick action.
+type ActionStep struct {
+	Command  string
+	ExitCode int
+	Skipped  bool // claim step skipped because the task was already held
+}
+
+// RunAction executes a "!" quick action against taskID. Each step is a TUI
+// command line (claim, release, run <cmd> [args...] or note <text>). The task
+// is claimed first unless this client already holds it, and the sequence
+// stops at the first failing step or non-zero exit code.
+func RunAction(c actionClient, item *SuggestionItem, args []string, taskID string) ([]ActionStep, error) {
+	if taskID == "" {
+		return nil, fmt.Errorf("no task selected")
+	}
+	steps := item.actionSteps(args, taskID)
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("action %q has no steps", item.Text)
+	}
+	if first := strings.Fields(steps[0]); len(first) == 0 || first[0] != "claim" {
+		steps = append([]string{"claim"}, steps...)
+	}
+
+	var done []ActionStep
+	for _, step := range steps {
+		fields := strings.Fields(step)
+		if len(fields) == 0 {
+			continue
+		}
+		result := ActionStep{Command: step}
+
+		switch fields[0] {
+		case "claim":
+			if c.Holds(taskID) {
+				result.Skipped = true
+			} else if err := c.ClaimTask(taskID); err != nil {
+				return done, fmt.Errorf("claim: %w", err)
+			}
+		case "release":
+			if err := c.ReleaseTask(taskID); err != nil {
+				return done, fmt.Errorf("release: %w", err)
+			}
+		case "run":
+			if len(fields) < 2 {
+				return done, fmt.Errorf("step %q: missing command", step)
+			}
+			exitCode, err := c.RunTask(taskID, fields[1], fields[2:])
+			if err != nil {
+				return done, fmt.Errorf("%s: %w", step, err)
+			}
+			result.ExitCode = exitCode
+			if exitCode != 0 {
+				done = append(done, result)
+				return done, fmt.Errorf("%s: exit %d", step, exitCode)
+			}
+		case "note":
+			if _, err := c.AddMemory(taskID, strings.Join(fields[1:], " ")); err != nil {
+				return done, fmt.Errorf("note: %w", err)
+			}
+		default:
+			return done, fmt.Errorf("step %q: unknown command %q", step, fields[0])
+		}
+		done = append(done, result)
+	}
+	return done, nil
+}
+
+// actionSteps expands the entry's Steps, or its Run line when it has none.
+func (item *SuggestionItem) actionSteps(args []string, taskID string) []string {
+	if len(item.Steps) == 0 {
+		if item.Run == "" {
+			return nil
+		}
+		return []string{item.Expand(args, taskID)}
+	}
+	steps := make([]string, len(item.Steps))
+	for i, step := range item.Steps {
+		steps[i] = expandTemplate(step, args, taskID, false)
+	}
+	return steps
+}
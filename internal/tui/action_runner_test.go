@@ -0,0 +1,94 @@
+package tui
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeActionClient struct {
+	held  map[string]bool
+	exits map[string]int // command -> exit code
+	calls []string
+}
+
+func (f *fakeActionClient) Holds(taskID string) bool { return f.held[taskID] }
+
+func (f *fakeActionClient) ClaimTask(taskID string) error {
+	f.calls = append(f.calls, "claim")
+	f.held[taskID] = true
+	return nil
+}
+
+func (f *fakeActionClient) ReleaseTask(taskID string) error {
+	f.calls = append(f.calls, "release")
+	delete(f.held, taskID)
+	return nil
+}
+
+func (f *fakeActionClient) RunTask(taskID, command string, args []string) (int, error) {
+	f.calls = append(f.calls, strings.Join(append([]string{"run", command}, args...), " "))
+	return f.exits[command], nil
+}
+
+func (f *fakeActionClient) AddMemory(taskID, content string) (string, error) {
+	f.calls = append(f.calls, "note "+content)
+	return "m1", nil
+}
+
+func TestRunActionClaimsThenRuns(t *testing.T) {
+	c := &fakeActionClient{held: map[string]bool{}}
+	s := NewSuggestions()
+
+	item, args := s.Lookup("!", "!test")
+	steps, err := RunAction(c, item, args, "t1")
+	if err != nil {
+		t.Fatalf("RunAction: %v", err)
+	}
+	if want := []string{"claim", "run go test ./..."}; !reflect.DeepEqual(c.calls, want) {
+		t.Errorf("calls = %v, want %v", c.calls, want)
+	}
+	if len(steps) != 2 || steps[1].ExitCode != 0 {
+		t.Errorf("Unexpected steps: %+v", steps)
+	}
+
+	// Already held: the claim step is skipped
+	c.calls = nil
+	item, args = s.Lookup("!", "!claim-and-run")
+	steps, err = RunAction(c, item, args, "t1")
+	if err != nil {
+		t.Fatalf("RunAction: %v", err)
+	}
+	if want := []string{"run git status"}; !reflect.DeepEqual(c.calls, want) {
+		t.Errorf("calls = %v, want %v", c.calls, want)
+	}
+	if !steps[0].Skipped {
+		t.Errorf("Expected claim step to be skipped: %+v", steps)
+	}
+}
+
+func TestRunActionCustomStepsStopOnFailure(t *testing.T) {
+	c := &fakeActionClient{held: map[string]bool{}, exits: map[string]int{"make": 2}}
+	s := NewSuggestions()
+	s.Add("!", SuggestionItem{
+		Text:  "ship",
+		Steps: []string{"run go vet {args}", "run make {1}", "note shipped {task}", "release"},
+	})
+
+	item, args := s.Lookup("!", "!ship ./cmd/...")
+	steps, err := RunAction(c, item, args, "t1")
+	if err == nil || !strings.Contains(err.Error(), "exit 2") {
+		t.Fatalf("Expected exit failure, got %v", err)
+	}
+	want := []string{"claim", "run go vet ./cmd/...", "run make ./cmd/..."}
+	if !reflect.DeepEqual(c.calls, want) {
+		t.Errorf("calls = %v, want %v", c.calls, want)
+	}
+	if last := steps[len(steps)-1]; last.ExitCode != 2 {
+		t.Errorf("Expected failing step recorded, got %+v", last)
+	}
+
+	if _, err := RunAction(c, item, nil, ""); err == nil {
+		t.Error("Expected error without a selected task")
+	}
+}
@@ -0,0 +1,120 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ActionsFile is the project-level file defining custom suggestions,
+// looked up in the .neona directory of the working directory.
+const ActionsFile = "actions.yaml"
+
+// ActionsPath returns the actions file path for the project rooted at dir.
+func ActionsPath(dir string) string {
+	return filepath.Join(dir, ".neona", ActionsFile)
+}
+
+// CustomSuggestion is an entry defined in actions.yaml.
+type CustomSuggestion struct {
+	Name        string   `yaml:"name"`
+	Args        string   `yaml:"args"`
+	Description string   `yaml:"description"`
+	Run         string   `yaml:"run"`
+	Steps       []string `yaml:"steps"` // quick actions only; run in order
+}
+
+// ActionsConfig holds the custom entries for each suggestion source.
+type ActionsConfig struct {
+	Commands   []CustomSuggestion `yaml:"commands"`   // "/"
+	References []CustomSuggestion `yaml:"references"` // "@"
+	Actions    []CustomSuggestion `yaml:"actions"`    // "!"
+}
+
+// LoadActions reads an actions file. A missing file yields an empty config.
+func LoadActions(path string) (*ActionsConfig, error) {
+	cfg := &ActionsConfig{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	for _, group := range []struct {
+		key     string
+		entries []CustomSuggestion
+	}{
+		{"commands", cfg.Commands},
+		{"references", cfg.References},
+		{"actions", cfg.Actions},
+	} {
+		for i, entry := range group.entries {
+			if strings.TrimSpace(entry.Name) == "" {
+				return nil, fmt.Errorf("%s: %s[%d]: name is required", path, group.key, i)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// Apply adds the configured entries to s.
+func (c *ActionsConfig) Apply(s *Suggestions) {
+	s.Add("/", toSuggestionItems(c.Commands, "command")...)
+	s.Add("@", toSuggestionItems(c.References, "reference")...)
+	s.Add("!", toSuggestionItems(c.Actions, "action")...)
+}
+
+func toSuggestionItems(entries []CustomSuggestion, typ string) []SuggestionItem {
+	items := make([]SuggestionItem, len(entries))
+	for i, e := range entries {
+		items[i] = SuggestionItem{
+			Text:        strings.Join(strings.Fields(e.Name), " "),
+			Args:        e.Args,
+			Description: e.Description,
+			Type:        typ,
+			Run:         e.Run,
+			Steps:       e.Steps,
+		}
+	}
+	return items
+}
+
+// Expand substitutes placeholders in the entry's Run template:
+// {1}..{9} are positional arguments, {args} is all arguments and {task} is
+// the selected task ID. Unused arguments are appended when the template has
+// no argument placeholders.
+func (item *SuggestionItem) Expand(args []string, taskID string) string {
+	return expandTemplate(item.Run, args, taskID, true)
+}
+
+func expandTemplate(tmpl string, args []string, taskID string, appendUnused bool) string {
+	out := tmpl
+	usesArgs := strings.Contains(out, "{args}")
+	for i := 9; i >= 1; i-- {
+		placeholder := "{" + strconv.Itoa(i) + "}"
+		if !strings.Contains(out, placeholder) {
+			continue
+		}
+		usesArgs = true
+		value := ""
+		if i <= len(args) {
+			value = args[i-1]
+		}
+		out = strings.ReplaceAll(out, placeholder, value)
+	}
+	out = strings.ReplaceAll(out, "{args}", strings.Join(args, " "))
+	out = strings.ReplaceAll(out, "{task}", taskID)
+	if appendUnused && !usesArgs && len(args) > 0 {
+		out += " " + strings.Join(args, " ")
+	}
+	return strings.Join(strings.Fields(out), " ")
+}
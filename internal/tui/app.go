@@ -4,6 +4,9 @@ package tui
 import (
 	"context"
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,6 +16,7 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/fentz26/neona/internal/agents"
 	"github.com/fentz26/neona/internal/auth"
+	"github.com/fentz26/neona/pkg/client"
 )
 
 var (
@@ -68,26 +72,55 @@ var (
 type App struct {
 	client       *Client
 	tasks        []TaskItem
+	taskList     taskList
 	selectedIdx  int
 	input        textinput.Model
 	viewport     viewport.Model
 	width        int
 	height       int
-	mode         string // "list", "detail", "agents", "workers"
+	mode         string // "list", "detail", "agents", "workers", "diff"
 	currentTask  *TaskDetail
 	runs         []RunDetail
 	memory       []MemoryDetail
+	comments     []CommentDetail
+	checklist    []ChecklistItemDetail
+	diffRun      *RunDetail
 	message      string
 	filter       string
 	filterIdx    int
 	loading      bool
 	agents       []agents.Agent
 	agentIdx     int
-	daemonOnline bool
+	health       *HealthMonitor
 	suggestions  *Suggestions
 	workersStats *WorkersStats
+	stats        *QueueStats
 	authManager  *auth.Manager
 	currentUser  *auth.User
+	// readOnly refuses commands that change the daemon's state
+	readOnly bool
+}
+
+// ReadOnlyEnv set to 1 starts the TUI in read-only mode, for dashboards on
+// shared screens; neona tui --read-only sets it.
+const ReadOnlyEnv = "NEONA_TUI_READ_ONLY"
+
+// mutatingCommands change the daemon's state.
+var mutatingCommands = map[string]bool{
+	"add": true, "claim": true, "release": true, "run": true,
+	"note": true, "comment": true, "check": true, "uncheck": true,
+}
+
+// isMutating reports whether a suggestion runs a mutating command, itself
+// or through the command line or steps it expands to.
+func isMutating(item SuggestionItem) bool {
+	lines := append([]string{item.Text, item.Run}, item.Steps...)
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) > 0 && mutatingCommands[fields[0]] {
+			return true
+		}
+	}
+	return false
 }
 
 var filters = []string{"", "pending", "claimed", "running", "completed", "failed"}
@@ -95,8 +128,13 @@ var filterNames = []string{"ALL", "PENDING", "CLAIMED", "RUNNING", "DONE", "FAIL
 
 // New creates a new TUI application.
 func New(apiAddr string) *App {
+	readOnly := os.Getenv(ReadOnlyEnv) == "1"
+
 	ti := textinput.New()
 	ti.Placeholder = "Type: add <title> | claim | run <cmd> | release | scan | login"
+	if readOnly {
+		ti.Placeholder = "Type: query <term> | agents | scan | whoami"
+	}
 	ti.Focus()
 	ti.CharLimit = 256
 	ti.Width = 80
@@ -114,15 +152,33 @@ func New(apiAddr string) *App {
 		currentUser = authMgr.GetUser()
 	}
 
+	// Project-specific commands, references and quick actions
+	suggestions := NewSuggestions()
+	var message string
+	if cwd, err := os.Getwd(); err == nil {
+		if actions, err := LoadActions(ActionsPath(cwd)); err != nil {
+			message = "Error: " + err.Error()
+		} else {
+			actions.Apply(suggestions)
+		}
+	}
+	suggestions.SetAgents(agentNames(detectedAgents))
+	if readOnly {
+		suggestions.Remove(isMutating)
+	}
+
 	return &App{
 		client:      NewClient(apiAddr),
 		input:       ti,
 		viewport:    vp,
 		mode:        "list",
 		agents:      detectedAgents,
-		suggestions: NewSuggestions(),
+		message:     message,
+		suggestions: suggestions,
 		authManager: authMgr,
 		currentUser: currentUser,
+		health:      NewHealthMonitor(),
+		readOnly:    readOnly,
 	}
 }
 
@@ -153,6 +209,11 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return a, tea.Quit
 
 		case "esc":
+			if a.mode == "diff" {
+				a.mode = "detail"
+				a.diffRun = nil
+				return a, nil
+			}
 			if a.mode == "detail" || a.mode == "agents" || a.mode == "workers" {
 				a.mode = "list"
 				a.currentTask = nil
@@ -162,6 +223,8 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "up", "k":
 			if a.suggestions.IsVisible() {
 				a.suggestions.Prev()
+			} else if a.mode == "diff" {
+				a.viewport.LineUp(1)
 			} else if a.mode == "list" && a.selectedIdx > 0 {
 				a.selectedIdx--
 			} else if a.mode == "agents" && a.agentIdx > 0 {
@@ -171,6 +234,8 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "down", "j":
 			if a.suggestions.IsVisible() {
 				a.suggestions.Next()
+			} else if a.mode == "diff" {
+				a.viewport.LineDown(1)
 			} else if a.mode == "list" && a.selectedIdx < len(a.tasks)-1 {
 				a.selectedIdx++
 			} else if a.mode == "agents" && a.agentIdx < len(a.agents)-1 {
@@ -181,6 +246,12 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// If suggestions visible, accept selection
 			if a.suggestions.IsVisible() {
 				if selected := a.suggestions.Selected(); selected != nil {
+					// Keep the "!" so arguments can be added before running
+					if selected.Type == "action" {
+						a.input.SetValue("!" + selected.Text + " ")
+						a.suggestions.Update("")
+						return a, nil
+					}
 					a.input.SetValue(selected.Text + " ")
 					a.suggestions.Update("")
 				}
@@ -200,6 +271,13 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// If suggestions visible, accept selection
 			if a.suggestions.IsVisible() {
 				if selected := a.suggestions.Selected(); selected != nil {
+					// Quick actions run immediately
+					if selected.Type == "action" {
+						item := *selected
+						a.input.SetValue("")
+						a.suggestions.Update("")
+						return a, a.executeAction(&item, nil)
+					}
 					a.input.SetValue(selected.Text + " ")
 					a.suggestions.Update("")
 				}
@@ -227,6 +305,16 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// Quick switch to agents view
 			a.mode = "agents"
 
+		case "d":
+			// Review the latest run's changes
+			if a.mode == "detail" && a.input.Value() == "" {
+				if run := latestDiffRun(a.runs); run != nil {
+					return a, a.fetchRunDiff(*run)
+				}
+				a.message = "No run with a captured diff"
+				return a, nil
+			}
+
 		case "w":
 			// Quick switch to workers view
 			a.mode = "workers"
@@ -243,21 +331,57 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tasksLoadedMsg:
 		a.loading = false
 		a.tasks = msg.tasks
+		a.taskList.SetTasks(msg.tasks)
 		if a.selectedIdx >= len(a.tasks) {
 			a.selectedIdx = max(0, len(a.tasks)-1)
 		}
+		cmds = append(cmds, a.loadTaskSuggestions(msg.tasks))
+
+	case suggestionsLoadedMsg:
+		a.suggestions.Refresh()
 
 	case taskDetailLoadedMsg:
 		a.currentTask = msg.task
 		a.runs = msg.runs
 		a.memory = msg.memory
+		a.comments = msg.comments
+		a.checklist = msg.checklist
+
+	case diffLoadedMsg:
+		a.mode = "diff"
+		a.diffRun = &msg.run
+		a.viewport.SetContent(colorizeDiff(msg.diff))
+		a.viewport.GotoTop()
 
 	case agentsScanMsg:
 		a.agents = msg.agents
+		a.suggestions.SetAgents(agentNames(a.agents))
 		a.message = fmt.Sprintf("✓ Found %d agents", len(a.agents))
 
+	case agentAddedMsg:
+		a.agents = append(a.agents, msg.agent)
+		a.suggestions.SetAgents(agentNames(a.agents))
+		a.message = fmt.Sprintf("✓ Added agent: %s", msg.agent.Name)
+
 	case daemonStatusMsg:
-		a.daemonOnline = msg.online
+		switch a.health.Record(msg.online, time.Now()) {
+		case HealthReconnected:
+			// Reload what may have changed, or failed to load, while away
+			a.message = "✓ Reconnected to daemon"
+			cmds = append(cmds, a.fetchTasks())
+		case HealthDown:
+			a.message = "Error: daemon unreachable at " + a.client.baseURL + "; retrying"
+		}
+		if msg.online {
+			cmds = append(cmds, a.fetchStats())
+		}
+		cmds = append(cmds, a.nextHealthCheck())
+
+	case statsFetchedMsg:
+		a.stats = msg.stats
+
+	case healthTickMsg:
+		return a, a.checkDaemon()
 
 	case workersFetchedMsg:
 		a.workersStats = msg.stats
@@ -276,7 +400,11 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return a, a.fetchTasks()
 
 	case errMsg:
-		a.message = "Error: " + msg.err.Error()
+		// While the daemon is down, keep its status rather than one
+		// error per failed request
+		if a.health.Online() {
+			a.message = errorMessage(msg.err)
+		}
 	}
 
 	// Update input
@@ -287,21 +415,6 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// Update suggestions based on input
 	a.suggestions.Update(a.input.Value())
 
-	// Populate dynamic suggestions for @
-	if strings.HasPrefix(a.input.Value(), "@") {
-		var agentNames []string
-		for _, ag := range a.agents {
-			agentNames = append(agentNames, ag.Name)
-		}
-		a.suggestions.SetAgents(agentNames)
-
-		var taskIDs []string
-		for _, t := range a.tasks {
-			taskIDs = append(taskIDs, t.ID)
-		}
-		a.suggestions.SetTasks(taskIDs)
-	}
-
 	return a, tea.Batch(cmds...)
 }
 
@@ -311,8 +424,11 @@ func (a *App) View() string {
 
 	// Header with daemon status
 	daemonStatus := agentOnlineStyle.Render("● DAEMON")
-	if !a.daemonOnline {
+	if !a.health.Online() {
 		daemonStatus = agentOfflineStyle.Render("○ DAEMON")
+		if a.health.Failures() > 0 {
+			daemonStatus += lipgloss.NewStyle().Foreground(mutedColor).Render(fmt.Sprintf(" retry in %s", a.health.Delay()))
+		}
 	}
 
 	// User status
@@ -323,14 +439,22 @@ func (a *App) View() string {
 
 	header := titleStyle.Render("🚀 NEONA Control Plane")
 	header += "  " + daemonStatus
+	if a.health.Online() && a.stats != nil {
+		header += a.renderQueueStatus()
+	}
 	header += "  " + lipgloss.NewStyle().Foreground(cyanColor).Render(fmt.Sprintf("[%d agents]", len(a.agents)))
 	header += "  " + userStatus
+	if a.readOnly {
+		header += "  " + lipgloss.NewStyle().Foreground(warningColor).Bold(true).Render("👁 READ-ONLY")
+	}
 
 	b.WriteString(header + "\n")
+	banners := a.renderDBWarnings()
+	b.WriteString(banners)
 	b.WriteString(strings.Repeat("─", a.width) + "\n")
 
 	// Main content area
-	contentHeight := a.height - 8
+	contentHeight := a.height - 8 - strings.Count(banners, "\n")
 	if contentHeight < 5 {
 		contentHeight = 5
 	}
@@ -346,6 +470,8 @@ func (a *App) View() string {
 		b.WriteString(a.renderAgentsPanel(contentHeight))
 	case "workers":
 		b.WriteString(a.renderWorkersPanel(contentHeight))
+	case "diff":
+		b.WriteString(a.renderDiff(contentHeight))
 	}
 
 	// Message bar
@@ -383,6 +509,10 @@ func (a *App) View() string {
 			workerCount = a.workersStats.ActiveWorkers
 		}
 		status = fmt.Sprintf(" Workers: %d | Esc:back | w:refresh", workerCount)
+	case "detail":
+		status = " d:diff | Esc:back | Enter:command | Ctrl+C:quit"
+	case "diff":
+		status = fmt.Sprintf(" Diff %3.f%% | ↑↓:scroll | Esc:back", a.viewport.ScrollPercent()*100)
 	default:
 		status = " Esc:back | Enter:command | Ctrl+C:quit"
 	}
@@ -391,6 +521,20 @@ func (a *App) View() string {
 	return b.String()
 }
 
+// scheduledBadge marks a pending task whose dispatch is delayed, with the
+// time it becomes eligible: the clock time today, or the date after.
+func scheduledBadge(notBefore *time.Time) string {
+	if notBefore == nil {
+		return "🕒 scheduled"
+	}
+	at := notBefore.Local()
+	layout := "Jan 2 15:04"
+	if now := time.Now(); at.YearDay() == now.YearDay() && at.Year() == now.Year() {
+		layout = "15:04"
+	}
+	return "🕒 scheduled " + at.Format(layout)
+}
+
 func (a *App) renderTaskList(height int) string {
 	if a.loading {
 		return "\n  Loading tasks...\n"
@@ -399,34 +543,7 @@ func (a *App) renderTaskList(height int) string {
 		return "\n  No tasks found. Type: add <title> to create one.\n"
 	}
 
-	var lines []string
-	for i, task := range a.tasks {
-		status := a.formatStatus(task.Status)
-
-		if i == a.selectedIdx {
-			line := selectedStyle.Render(fmt.Sprintf("▶ %s  %s", a.formatStatusPlain(task.Status), task.TaskTitle))
-			lines = append(lines, line)
-		} else {
-			line := taskItemStyle.Render(fmt.Sprintf("  %s  %s", status, task.TaskTitle))
-			lines = append(lines, line)
-		}
-	}
-
-	// Limit visible lines
-	if len(lines) > height {
-		start := a.selectedIdx - height/2
-		if start < 0 {
-			start = 0
-		}
-		end := start + height
-		if end > len(lines) {
-			end = len(lines)
-			start = max(0, end-height)
-		}
-		lines = lines[start:end]
-	}
-
-	return strings.Join(lines, "\n")
+	return a.taskList.Render(height, a.selectedIdx)
 }
 
 func (a *App) renderAgentsPanel(_ int) string {
@@ -485,13 +602,36 @@ func (a *App) renderTaskDetail(_ int) string {
 
 	b.WriteString(fmt.Sprintf("\n  📋 %s\n", lipgloss.NewStyle().Bold(true).Render(t.Title)))
 	b.WriteString(fmt.Sprintf("  ID: %s\n", t.ID[:8]))
-	b.WriteString(fmt.Sprintf("  Status: %s\n", a.formatStatus(t.Status)))
+	b.WriteString(fmt.Sprintf("  Status: %s\n", formatStatus(t.Status)))
 	if t.Description != "" {
 		b.WriteString(fmt.Sprintf("  Description: %s\n", t.Description))
 	}
 	if t.ClaimedBy != "" {
 		b.WriteString(fmt.Sprintf("  Claimed by: %s\n", t.ClaimedBy))
 	}
+	if t.Priority != 0 {
+		b.WriteString(fmt.Sprintf("  Priority: %d\n", t.Priority))
+	}
+	if t.EstimateSec > 0 {
+		b.WriteString(fmt.Sprintf("  Estimate: %s\n", time.Duration(t.EstimateSec)*time.Second))
+	}
+	if t.DueAt != nil {
+		due := t.DueAt.Local().Format("2006-01-02 15:04")
+		switch {
+		case t.Overdue:
+			due += " " + lipgloss.NewStyle().Foreground(errorColor).Render("⏰ overdue")
+		case t.SLABreached:
+			due += " " + lipgloss.NewStyle().Foreground(warningColor).Render("(missed)")
+		}
+		b.WriteString(fmt.Sprintf("  Due: %s\n", due))
+	}
+	if t.NotBefore != nil {
+		at := t.NotBefore.Local().Format("2006-01-02 15:04")
+		if t.Scheduled {
+			at += " " + lipgloss.NewStyle().Foreground(cyanColor).Render("🕒 scheduled")
+		}
+		b.WriteString(fmt.Sprintf("  Not before: %s\n", at))
+	}
 
 	if len(a.runs) > 0 {
 		b.WriteString("\n  📜 Recent Runs:\n")
@@ -503,7 +643,44 @@ func (a *App) renderTaskDetail(_ int) string {
 			if run.ExitCode != 0 {
 				exitStyle = lipgloss.NewStyle().Foreground(errorColor)
 			}
-			b.WriteString(fmt.Sprintf("    • %s (exit: %s)\n", run.Command, exitStyle.Render(fmt.Sprintf("%d", run.ExitCode))))
+			diffMark := ""
+			if run.HasDiff {
+				diffMark = " " + lipgloss.NewStyle().Foreground(cyanColor).Render("[diff]")
+			}
+			if run.Truncated {
+				diffMark += " " + lipgloss.NewStyle().Foreground(warningColor).Render("[truncated]")
+			}
+			b.WriteString(fmt.Sprintf("    • %s (exit: %s)%s\n", run.Command, exitStyle.Render(fmt.Sprintf("%d", run.ExitCode)), diffMark))
+		}
+	}
+
+	var subtasks []TaskItem
+	for _, t := range a.tasks {
+		if t.ParentID == a.currentTask.ID {
+			subtasks = append(subtasks, t)
+		}
+	}
+	if len(subtasks) > 0 {
+		b.WriteString("\n  🌳 Subtasks:\n")
+		for _, t := range subtasks {
+			b.WriteString(fmt.Sprintf("    %s  %s\n", formatStatus(t.Status), t.TaskTitle))
+		}
+	}
+
+	if len(a.checklist) > 0 {
+		done := 0
+		for _, item := range a.checklist {
+			if item.Done {
+				done++
+			}
+		}
+		b.WriteString(fmt.Sprintf("\n  ☑ Checklist (%d/%d):\n", done, len(a.checklist)))
+		for _, item := range a.checklist {
+			mark := lipgloss.NewStyle().Foreground(mutedColor).Render("[ ]")
+			if item.Done {
+				mark = lipgloss.NewStyle().Foreground(successColor).Render("[x]")
+			}
+			b.WriteString(fmt.Sprintf("    %d. %s %s\n", item.Position, mark, item.Text))
 		}
 	}
 
@@ -521,10 +698,25 @@ func (a *App) renderTaskDetail(_ int) string {
 		}
 	}
 
+	if len(a.comments) > 0 {
+		b.WriteString("\n  💬 Comments:\n")
+		// Latest few, oldest first like a chat
+		start := max(0, len(a.comments)-5)
+		for _, c := range a.comments[start:] {
+			body := c.Body
+			if len(body) > 60 {
+				body = body[:60] + "..."
+			}
+			b.WriteString(fmt.Sprintf("    %s %s: %s\n",
+				lipgloss.NewStyle().Foreground(mutedColor).Render(c.CreatedAt.Local().Format("01-02 15:04")),
+				lipgloss.NewStyle().Foreground(cyanColor).Render(c.Author), body))
+		}
+	}
+
 	return b.String()
 }
 
-func (a *App) formatStatus(status string) string {
+func formatStatus(status string) string {
 	switch status {
 	case "pending":
 		return lipgloss.NewStyle().Foreground(warningColor).Render("○ PENDING")
@@ -541,7 +733,7 @@ func (a *App) formatStatus(status string) string {
 	}
 }
 
-func (a *App) formatStatusPlain(status string) string {
+func formatStatusPlain(status string) string {
 	switch status {
 	case "pending":
 		return "○"
@@ -569,6 +761,24 @@ func (a *App) fetchTasks() tea.Cmd {
 	}
 }
 
+// loadTaskSuggestions builds the task references off the Update loop, so
+// a long task list does not delay typing.
+func (a *App) loadTaskSuggestions(tasks []TaskItem) tea.Cmd {
+	s := a.suggestions
+	return func() tea.Msg {
+		s.SetTasks(TaskSuggestions(tasks))
+		return suggestionsLoadedMsg{}
+	}
+}
+
+func agentNames(list []agents.Agent) []string {
+	names := make([]string, len(list))
+	for i, ag := range list {
+		names[i] = ag.Name
+	}
+	return names
+}
+
 func (a *App) fetchTaskDetail(taskID string) tea.Cmd {
 	return func() tea.Msg {
 		task, err := a.client.GetTask(taskID)
@@ -577,8 +787,30 @@ func (a *App) fetchTaskDetail(taskID string) tea.Cmd {
 		}
 		runs, _ := a.client.GetTaskLogs(taskID)
 		memory, _ := a.client.GetTaskMemory(taskID)
-		return taskDetailLoadedMsg{task, runs, memory}
+		comments, _ := a.client.GetTaskComments(taskID)
+		checklist, _ := a.client.GetTaskChecklist(taskID)
+		return taskDetailLoadedMsg{task, runs, memory, comments, checklist}
+	}
+}
+
+func (a *App) fetchRunDiff(run RunDetail) tea.Cmd {
+	return func() tea.Msg {
+		diff, err := a.client.GetRunDiff(run.ID)
+		if err != nil {
+			return errMsg{err}
+		}
+		return diffLoadedMsg{run, diff}
+	}
+}
+
+// renderDiff shows the selected run's diff in the scrollable viewport.
+func (a *App) renderDiff(height int) string {
+	if a.diffRun == nil {
+		return "\n  Loading...\n"
 	}
+	header := fmt.Sprintf("\n  🔍 Changes from run %s (%s)\n", a.diffRun.ID[:8], a.diffRun.Command)
+	a.viewport.Height = max(1, height-2)
+	return header + a.viewport.View()
 }
 
 func (a *App) scanAgents() tea.Cmd {
@@ -589,14 +821,68 @@ func (a *App) scanAgents() tea.Cmd {
 	}
 }
 
+// checkDaemon probes the daemon's health. Each result schedules the next
+// probe (see nextHealthCheck), so one probe is in flight at a time.
 func (a *App) checkDaemon() tea.Cmd {
 	return func() tea.Msg {
-		_, err := a.client.ListTasks("")
-		return daemonStatusMsg{online: err == nil}
+		ok, err := a.client.CheckHealth()
+		return daemonStatusMsg{online: ok && err == nil}
+	}
+}
+
+// nextHealthCheck waits out the monitor's delay, backing off while the
+// daemon is down, before probing again.
+func (a *App) nextHealthCheck() tea.Cmd {
+	return tea.Tick(a.health.Delay(), func(time.Time) tea.Msg {
+		return healthTickMsg{}
+	})
+}
+
+// executeAction runs a quick action against the selected task.
+func (a *App) executeAction(item *SuggestionItem, args []string) tea.Cmd {
+	taskID := ""
+	if len(a.tasks) > 0 {
+		taskID = a.tasks[a.selectedIdx].ID
+	}
+	return func() tea.Msg {
+		steps, err := RunAction(a.client, item, args, taskID)
+		if err != nil {
+			return commandResultMsg{fmt.Sprintf("Error: !%s: %v", item.Text, err)}
+		}
+		last := steps[len(steps)-1]
+		return commandResultMsg{fmt.Sprintf("✓ !%s: %d steps (last: %s, exit %d)", item.Text, len(steps), last.Command, last.ExitCode)}
+	}
+}
+
+func readOnlyRefusal(what string) tea.Cmd {
+	return func() tea.Msg {
+		return commandResultMsg{fmt.Sprintf("Read-only mode: %s is disabled", what)}
 	}
 }
 
 func (a *App) executeCommand(input string) tea.Cmd {
+	if strings.HasPrefix(input, "!") {
+		item, rest := a.suggestions.Lookup("!", input)
+		if item != nil && a.readOnly && isMutating(*item) {
+			return readOnlyRefusal(input)
+		}
+		if item == nil {
+			return func() tea.Msg {
+				return commandResultMsg{fmt.Sprintf("Unknown action: %s", input)}
+			}
+		}
+		return a.executeAction(item, rest)
+	}
+
+	// Custom commands expand into a built-in command line
+	if item, rest := a.suggestions.Lookup("/", input); item != nil && item.Run != "" {
+		taskID := ""
+		if len(a.tasks) > 0 {
+			taskID = a.tasks[a.selectedIdx].ID
+		}
+		input = item.Expand(rest, taskID)
+	}
+
 	parts := strings.Fields(input)
 	if len(parts) == 0 {
 		return nil
@@ -604,6 +890,9 @@ func (a *App) executeCommand(input string) tea.Cmd {
 
 	cmd := parts[0]
 	args := parts[1:]
+	if a.readOnly && mutatingCommands[cmd] {
+		return readOnlyRefusal(cmd)
+	}
 
 	return func() tea.Msg {
 		switch cmd {
@@ -614,7 +903,7 @@ func (a *App) executeCommand(input string) tea.Cmd {
 			title := strings.Join(args, " ")
 			id, err := a.client.CreateTask(title, "")
 			if err != nil {
-				return commandResultMsg{"Error: " + err.Error()}
+				return commandResultMsg{errorMessage(err)}
 			}
 			return commandResultMsg{fmt.Sprintf("✓ Created task: %s", id[:8])}
 
@@ -624,7 +913,10 @@ func (a *App) executeCommand(input string) tea.Cmd {
 			}
 			taskID := a.tasks[a.selectedIdx].ID
 			if err := a.client.ClaimTask(taskID); err != nil {
-				return commandResultMsg{"Error: " + err.Error()}
+				if client.IsConflict(err) {
+					return commandResultMsg{"Task is already claimed"}
+				}
+				return commandResultMsg{errorMessage(err)}
 			}
 			return commandResultMsg{"✓ Task claimed"}
 
@@ -634,7 +926,10 @@ func (a *App) executeCommand(input string) tea.Cmd {
 			}
 			taskID := a.tasks[a.selectedIdx].ID
 			if err := a.client.ReleaseTask(taskID); err != nil {
-				return commandResultMsg{"Error: " + err.Error()}
+				if client.IsForbidden(err) {
+					return commandResultMsg{"Task is claimed by another holder"}
+				}
+				return commandResultMsg{errorMessage(err)}
 			}
 			return commandResultMsg{"✓ Task released"}
 
@@ -650,7 +945,7 @@ func (a *App) executeCommand(input string) tea.Cmd {
 			runArgs := args[1:]
 			exitCode, err := a.client.RunTask(taskID, runCmd, runArgs)
 			if err != nil {
-				return commandResultMsg{"Error: " + err.Error()}
+				return commandResultMsg{errorMessage(err)}
 			}
 			return commandResultMsg{fmt.Sprintf("✓ Run completed (exit: %d)", exitCode)}
 
@@ -664,10 +959,40 @@ func (a *App) executeCommand(input string) tea.Cmd {
 			}
 			content := strings.Join(args, " ")
 			if _, err := a.client.AddMemory(taskID, content); err != nil {
-				return commandResultMsg{"Error: " + err.Error()}
+				return commandResultMsg{errorMessage(err)}
 			}
 			return commandResultMsg{"✓ Note added"}
 
+		case "comment":
+			if len(a.tasks) == 0 {
+				return commandResultMsg{"No task selected"}
+			}
+			if len(args) < 1 {
+				return commandResultMsg{"Usage: comment <text>"}
+			}
+			taskID := a.tasks[a.selectedIdx].ID
+			if err := a.client.AddComment(taskID, strings.Join(args, " ")); err != nil {
+				return commandResultMsg{errorMessage(err)}
+			}
+			return commandResultMsg{"✓ Comment added"}
+
+		case "check", "uncheck":
+			if len(a.tasks) == 0 {
+				return commandResultMsg{"No task selected"}
+			}
+			n := 0
+			if len(args) == 1 {
+				n, _ = strconv.Atoi(args[0])
+			}
+			if n < 1 {
+				return commandResultMsg{"Usage: " + cmd + " <item number>"}
+			}
+			taskID := a.tasks[a.selectedIdx].ID
+			if err := a.client.CheckItem(taskID, n, cmd == "check"); err != nil {
+				return commandResultMsg{errorMessage(err)}
+			}
+			return commandResultMsg{fmt.Sprintf("✓ Item %d %sed", n, cmd)}
+
 		case "query", "search":
 			if len(args) < 1 {
 				return commandResultMsg{"Usage: query <term>"}
@@ -675,15 +1000,13 @@ func (a *App) executeCommand(input string) tea.Cmd {
 			query := strings.Join(args, " ")
 			items, err := a.client.QueryMemory(query)
 			if err != nil {
-				return commandResultMsg{"Error: " + err.Error()}
+				return commandResultMsg{errorMessage(err)}
 			}
 			return commandResultMsg{fmt.Sprintf("Found %d items", len(items))}
 
 		case "scan":
 			detector := agents.NewDetector()
-			found := detector.Scan()
-			a.agents = found
-			return commandResultMsg{fmt.Sprintf("✓ Detected %d agents", len(found))}
+			return agentsScanMsg{detector.Scan()}
 
 		case "agents":
 			a.mode = "agents"
@@ -703,8 +1026,7 @@ func (a *App) executeCommand(input string) tea.Cmd {
 					Status:       "unknown",
 					AutoDetected: false,
 				}
-				a.agents = append(a.agents, newAgent)
-				return commandResultMsg{fmt.Sprintf("✓ Added agent: %s", name)}
+				return agentAddedMsg{newAgent}
 			}
 			return commandResultMsg{"Usage: agent add <name> <type>"}
 
@@ -738,7 +1060,7 @@ func (a *App) executeCommand(input string) tea.Cmd {
 			}
 			username := a.currentUser.Username
 			if err := a.authManager.Logout(); err != nil {
-				return commandResultMsg{"Error: " + err.Error()}
+				return commandResultMsg{errorMessage(err)}
 			}
 			a.currentUser = nil
 			return commandResultMsg{fmt.Sprintf("✓ Signed out from %s", username)}
@@ -766,6 +1088,14 @@ type commandResultMsg struct {
 	message string
 }
 
+// errorMessage describes a failed request in the status line.
+func errorMessage(err error) string {
+	if client.IsUnauthorized(err) {
+		return "Error: the daemon rejected the API key; set NEONA_API_KEY"
+	}
+	return "Error: " + err.Error()
+}
+
 type errMsg struct {
 	err error
 }
@@ -775,11 +1105,26 @@ type tasksLoadedMsg struct {
 }
 
 type taskDetailLoadedMsg struct {
-	task   *TaskDetail
-	runs   []RunDetail
-	memory []MemoryDetail
+	task      *TaskDetail
+	runs      []RunDetail
+	memory    []MemoryDetail
+	comments  []CommentDetail
+	checklist []ChecklistItemDetail
 }
 
+type diffLoadedMsg struct {
+	run  RunDetail
+	diff string
+}
+
+type agentAddedMsg struct {
+	agent agents.Agent
+}
+
+// suggestionsLoadedMsg reports that loadTaskSuggestions replaced the task
+// references.
+type suggestionsLoadedMsg struct{}
+
 type agentsScanMsg struct {
 	agents []agents.Agent
 }
@@ -788,12 +1133,64 @@ type daemonStatusMsg struct {
 	online bool
 }
 
+type healthTickMsg struct{}
+
 type workersFetchedMsg struct {
 	stats *WorkersStats
 }
 
 type tickMsg time.Time
 
+type statsFetchedMsg struct {
+	stats *QueueStats
+}
+
+// fetchStats loads the header's queue summary along with each health
+// probe. Daemons without /stats leave it out.
+func (a *App) fetchStats() tea.Cmd {
+	return func() tea.Msg {
+		stats, err := a.client.GetStats()
+		if err != nil {
+			return nil
+		}
+		return statsFetchedMsg{stats}
+	}
+}
+
+// renderQueueStatus shows the scheduler's state and the overdue and
+// scheduled task counts.
+func (a *App) renderQueueStatus() string {
+	color := mutedColor
+	switch a.stats.Scheduler {
+	case "running":
+		color = successColor
+	case "draining", "drained":
+		color = warningColor
+	}
+	out := "  " + lipgloss.NewStyle().Foreground(color).Render("⚙ "+a.stats.Scheduler)
+	if a.stats.Overdue > 0 {
+		out += "  " + overdueStyle.Render(fmt.Sprintf("⏰ %d overdue", a.stats.Overdue))
+	}
+	if a.stats.Scheduled > 0 {
+		out += "  " + scheduledStyle.Render(fmt.Sprintf("🕒 %d scheduled", a.stats.Scheduled))
+	}
+	return out
+}
+
+// renderDBWarnings shows a banner line for each soft database limit the
+// daemon found crossed.
+func (a *App) renderDBWarnings() string {
+	if !a.health.Online() || a.stats == nil {
+		return ""
+	}
+	var out string
+	for _, w := range a.stats.DBWarnings {
+		out += lipgloss.NewStyle().Foreground(warningColor).Bold(true).Render("⚠ "+w.Message) +
+			"  " + lipgloss.NewStyle().Foreground(mutedColor).Render(w.Suggestion) + "\n"
+	}
+	return out
+}
+
 func (a *App) fetchWorkers() tea.Cmd {
 	return func() tea.Msg {
 		stats, err := a.client.GetWorkers()
@@ -810,6 +1207,19 @@ func (a *App) tickCmd() tea.Cmd {
 	})
 }
 
+// formatClaimStats summarizes claim attempts for the workers panel.
+func formatClaimStats(c ClaimStats) string {
+	if c.Attempts == 0 {
+		return "no claims"
+	}
+	conflicts := fmt.Sprintf("%d conflicts", c.Conflicts)
+	if c.Conflicts > 0 {
+		conflicts = lipgloss.NewStyle().Foreground(warningColor).Render(
+			fmt.Sprintf("%s (%.0f%%)", conflicts, float64(c.Conflicts)*100/float64(c.Attempts)))
+	}
+	return fmt.Sprintf("%d attempts, %s, avg %.1fms", c.Attempts, conflicts, c.AvgLatencyMs)
+}
+
 func (a *App) renderWorkersPanel(_ int) string {
 	var b strings.Builder
 
@@ -827,6 +1237,11 @@ func (a *App) renderWorkersPanel(_ int) string {
 	activeStyle := lipgloss.NewStyle().Foreground(successColor).Bold(true)
 	maxStyle := lipgloss.NewStyle().Foreground(mutedColor)
 
+	schedulerState := lipgloss.NewStyle().Foreground(successColor).Render("● running")
+	if !stats.Running {
+		schedulerState = lipgloss.NewStyle().Foreground(errorColor).Render("○ stopped")
+	}
+	b.WriteString(fmt.Sprintf("  Scheduler: %s\n", schedulerState))
 	b.WriteString(fmt.Sprintf("  Active Workers: %s / %s\n\n",
 		activeStyle.Render(fmt.Sprintf("%d", stats.ActiveWorkers)),
 		maxStyle.Render(fmt.Sprintf("%d", stats.GlobalMax))))
@@ -840,6 +1255,44 @@ func (a *App) renderWorkersPanel(_ int) string {
 		b.WriteString("\n")
 	}
 
+	// Label concurrency limits, at capacity in the warning color
+	if len(stats.LabelLimits) > 0 {
+		b.WriteString("  Label Limits:\n")
+		labels := make([]string, 0, len(stats.LabelLimits))
+		for label := range stats.LabelLimits {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			l := stats.LabelLimits[label]
+			line := fmt.Sprintf("%d/%d running", l.Running, l.Limit)
+			if l.Running >= l.Limit {
+				line = lipgloss.NewStyle().Foreground(warningColor).Render(line)
+			}
+			b.WriteString(fmt.Sprintf("    • %s: %s\n", label, line))
+		}
+		b.WriteString("\n")
+	}
+
+	// Rate limiters
+	if len(stats.RateLimits) > 0 {
+		b.WriteString("  Rate Limits:\n")
+		for name, rl := range stats.RateLimits {
+			b.WriteString(fmt.Sprintf("    • %s: %.1f/%d tokens (%d/min)\n", name, rl.Tokens, rl.Burst, rl.PerMinute))
+		}
+		if stats.ThrottledTasks > 0 {
+			b.WriteString(fmt.Sprintf("    • throttled tasks: %d\n", stats.ThrottledTasks))
+		}
+		b.WriteString("\n")
+	}
+
+	// Claim contention between the scheduler and external workers
+	if stats.Claims.Attempts > 0 || stats.APIClaims.Attempts > 0 {
+		b.WriteString("  Claims:\n")
+		b.WriteString("    • scheduler: " + formatClaimStats(stats.Claims) + "\n")
+		b.WriteString("    • API: " + formatClaimStats(stats.APIClaims) + "\n\n")
+	}
+
 	// Workers table
 	if len(stats.Workers) == 0 {
 		b.WriteString("  " + lipgloss.NewStyle().Foreground(mutedColor).Render("No active workers") + "\n")
@@ -885,6 +1338,21 @@ func (a *App) renderWorkersPanel(_ int) string {
 				ttlStyle.Render(fmt.Sprintf("%-10s", ttlStr)),
 				w.ConnectorName,
 			))
+			if r := w.Routing; r != nil {
+				mcps := "none"
+				if len(r.MCPs) > 0 {
+					mcps = strings.Join(r.MCPs, ", ")
+				}
+				why := r.Strategy
+				if len(r.MatchedRules) > 0 {
+					why += ", rules: " + strings.Join(r.MatchedRules, ", ")
+				}
+				if r.FallbackReason != "" {
+					why += ", fallback: " + r.FallbackReason
+				}
+				b.WriteString(lipgloss.NewStyle().Foreground(mutedColor).Render(
+					fmt.Sprintf("            MCPs: %s (%d tools; %s)", mcps, r.TotalTools, why)) + "\n")
+			}
 		}
 	}
 
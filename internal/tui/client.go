@@ -1,164 +1,170 @@
 package tui
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
 	"os"
+	"sort"
+	"sync"
 	"time"
-)
 
-// DefaultClientTimeout is the default timeout for API requests.
-const DefaultClientTimeout = 10 * time.Second
+	"github.com/fentz26/neona/pkg/client"
+)
 
 // Client wraps HTTP calls to the Neona API
 type Client struct {
-	baseURL    string
-	holderID   string
-	httpClient *http.Client
+	baseURL  string
+	holderID string
+	api      *client.Client
+
+	mu     sync.Mutex
+	leases map[string]*client.Lease // task ID -> lease from our claim
 }
 
-// NewClient creates a new API client with timeout
-func NewClient(baseURL string) *Client {
+// NewClient creates a new API client. addr may be an HTTP URL or a unix://
+// socket address; timeouts, retries and the API key come from the
+// environment (see client.ConfigFromEnv), falling back to the defaults.
+func NewClient(addr string) *Client {
 	hostname, _ := os.Hostname()
+	holderID := os.Getenv("NEONA_HOLDER_ID")
+	if holderID == "" {
+		holderID = fmt.Sprintf("tui@%s", hostname)
+	}
+	cfg, _ := client.ConfigFromEnv()
+	cfg.Addr = addr
+	api := client.New(cfg)
 	return &Client{
-		baseURL:  baseURL,
-		holderID: fmt.Sprintf("tui@%s", hostname),
-		httpClient: &http.Client{
-			Timeout: DefaultClientTimeout,
-		},
+		baseURL:  api.BaseURL,
+		holderID: holderID,
+		api:      api,
+		leases:   make(map[string]*client.Lease),
 	}
 }
 
 // ListTasks fetches tasks from the API
 func (c *Client) ListTasks(status string) ([]TaskItem, error) {
-	url := c.baseURL + "/tasks"
-	if status != "" {
-		url += "?status=" + status
-	}
-
-	resp, err := c.httpClient.Get(url)
+	tasks, err := c.api.Tasks(status)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: %s", string(body))
-	}
-
-	var tasks []struct {
-		ID        string `json:"id"`
-		Title     string `json:"title"`
-		Status    string `json:"status"`
-		ClaimedBy string `json:"claimed_by"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&tasks); err != nil {
-		return nil, err
-	}
 
 	items := make([]TaskItem, len(tasks))
 	for i, t := range tasks {
 		items[i] = TaskItem{
 			ID:        t.ID,
 			TaskTitle: t.Title,
-			Status:    t.Status,
+			Status:    string(t.Status),
 			ClaimedBy: t.ClaimedBy,
+			ParentID:  t.ParentID,
+			CreatedAt: t.CreatedAt,
+			Priority:  t.Priority,
+			Overdue:   t.Overdue,
+			NotBefore: t.NotBefore,
+			Scheduled: t.Scheduled,
 		}
 	}
-	return items, nil
+	return treeOrder(items), nil
 }
 
-// GetTask fetches a single task
-func (c *Client) GetTask(id string) (*TaskDetail, error) {
-	resp, err := c.httpClient.Get(c.baseURL + "/tasks/" + id)
-	if err != nil {
-		return nil, err
+// treeOrder places subtasks right after their parent, oldest first, and
+// sets each task's Depth. Tasks whose parent is not in the list stay at the
+// top level in their original order.
+func treeOrder(tasks []TaskItem) []TaskItem {
+	present := make(map[string]bool, len(tasks))
+	for _, t := range tasks {
+		present[t.ID] = true
+	}
+	children := make(map[string][]TaskItem)
+	var roots []TaskItem
+	for _, t := range tasks {
+		if t.ParentID != "" && present[t.ParentID] {
+			// The list is newest first within a priority; prepend to get
+			// creation order
+			children[t.ParentID] = append([]TaskItem{t}, children[t.ParentID]...)
+		} else {
+			roots = append(roots, t)
+		}
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: %s", string(body))
+	// and sort subtasks of different priorities back into it
+	for _, subs := range children {
+		sort.SliceStable(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
 	}
 
-	var task struct {
-		ID          string `json:"id"`
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		Status      string `json:"status"`
-		ClaimedBy   string `json:"claimed_by"`
-		CreatedAt   string `json:"created_at"`
-		UpdatedAt   string `json:"updated_at"`
+	ordered := make([]TaskItem, 0, len(tasks))
+	var add func(t TaskItem, depth int)
+	add = func(t TaskItem, depth int) {
+		t.Depth = depth
+		ordered = append(ordered, t)
+		for _, c := range children[t.ID] {
+			add(c, depth+1)
+		}
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&task); err != nil {
-		return nil, err
+	for _, t := range roots {
+		add(t, 0)
 	}
+	return ordered
+}
 
+// GetTask fetches a single task
+func (c *Client) GetTask(id string) (*TaskDetail, error) {
+	task, err := c.api.Task(id)
+	if err != nil {
+		return nil, err
+	}
 	return &TaskDetail{
 		ID:          task.ID,
 		Title:       task.Title,
 		Description: task.Description,
-		Status:      task.Status,
+		Status:      string(task.Status),
 		ClaimedBy:   task.ClaimedBy,
-		CreatedAt:   task.CreatedAt,
-		UpdatedAt:   task.UpdatedAt,
+		CreatedAt:   task.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   task.UpdatedAt.Format(time.RFC3339),
+		Priority:    task.Priority,
+		EstimateSec: task.EstimateSec,
+		DueAt:       task.DueAt,
+		Overdue:     task.Overdue,
+		SLABreached: task.SLABreached,
+		NotBefore:   task.NotBefore,
+		Scheduled:   task.Scheduled,
 	}, nil
 }
 
 // GetTaskLogs fetches run logs for a task
 func (c *Client) GetTaskLogs(taskID string) ([]RunDetail, error) {
-	resp, err := c.httpClient.Get(c.baseURL + "/tasks/" + taskID + "/logs")
+	runs, _, err := c.api.Logs(taskID, 0, 0)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	var runs []struct {
-		ID       string `json:"id"`
-		Command  string `json:"command"`
-		ExitCode int    `json:"exit_code"`
-		Stdout   string `json:"stdout"`
-		Stderr   string `json:"stderr"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&runs); err != nil {
-		return nil, err
-	}
 
 	details := make([]RunDetail, len(runs))
 	for i, r := range runs {
 		details[i] = RunDetail{
-			ID:       r.ID,
-			Command:  r.Command,
-			ExitCode: r.ExitCode,
-			Stdout:   r.Stdout,
-			Stderr:   r.Stderr,
+			ID:        r.ID,
+			Command:   r.Command,
+			ExitCode:  r.ExitCode,
+			Stdout:    r.Stdout,
+			Stderr:    r.Stderr,
+			HasDiff:   r.HasDiff,
+			Truncated: r.Truncated,
 		}
 	}
 	return details, nil
 }
 
+// GetRunDiff fetches the workdir diff captured at the end of a run
+func (c *Client) GetRunDiff(runID string) (string, error) {
+	return c.api.RunDiff(runID)
+}
+
 // GetTaskMemory fetches memory items for a task
 func (c *Client) GetTaskMemory(taskID string) ([]MemoryDetail, error) {
-	resp, err := c.httpClient.Get(c.baseURL + "/tasks/" + taskID + "/memory")
+	items, err := c.api.TaskMemory(taskID)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	var items []struct {
-		ID      string `json:"id"`
-		Content string `json:"content"`
-		Tags    string `json:"tags"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
-		return nil, err
-	}
+	return memoryDetails(items), nil
+}
 
+func memoryDetails(items []client.MemoryItem) []MemoryDetail {
 	details := make([]MemoryDetail, len(items))
 	for i, m := range items {
 		details[i] = MemoryDetail{
@@ -167,181 +173,161 @@ func (c *Client) GetTaskMemory(taskID string) ([]MemoryDetail, error) {
 			Tags:    m.Tags,
 		}
 	}
-	return details, nil
+	return details
 }
 
-// CreateTask creates a new task
-func (c *Client) CreateTask(title, description string) (string, error) {
-	body := map[string]string{
-		"title":       title,
-		"description": description,
+// GetTaskComments fetches a task's comment thread, oldest first
+func (c *Client) GetTaskComments(taskID string) ([]CommentDetail, error) {
+	comments, err := c.api.Comments(taskID, time.Time{})
+	if err != nil {
+		return nil, err
 	}
-	resp, err := c.post("/tasks", body)
+
+	details := make([]CommentDetail, len(comments))
+	for i, m := range comments {
+		details[i] = CommentDetail{
+			ID:        m.ID,
+			Author:    m.Author,
+			Body:      m.Body,
+			CreatedAt: m.CreatedAt,
+		}
+	}
+	return details, nil
+}
+
+// GetTaskChecklist fetches a task's checklist in order
+func (c *Client) GetTaskChecklist(taskID string) ([]ChecklistItemDetail, error) {
+	items, err := c.api.Checklist(taskID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	var result struct {
-		ID string `json:"id"`
+	details := make([]ChecklistItemDetail, len(items))
+	for i, item := range items {
+		details[i] = ChecklistItemDetail{
+			ID:        item.ID,
+			Position:  item.Position,
+			Text:      item.Text,
+			Done:      item.Done,
+			CheckedBy: item.CheckedBy,
+		}
+	}
+	return details, nil
+}
+
+// CheckItem checks or unchecks the checklist item at position as this
+// client's holder ID
+func (c *Client) CheckItem(taskID string, position int, done bool) error {
+	items, err := c.GetTaskChecklist(taskID)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if item.Position == position {
+			_, err := c.api.CheckItem(taskID, item.ID, done, c.holderID)
+			return err
+		}
 	}
-	if err := json.Unmarshal(resp, &result); err != nil {
+	return fmt.Errorf("no checklist item %d", position)
+}
+
+// AddComment posts a comment to a task as this client's holder ID
+func (c *Client) AddComment(taskID, body string) error {
+	_, err := c.api.Comment(taskID, c.holderID, body)
+	return err
+}
+
+// CreateTask creates a new task
+func (c *Client) CreateTask(title, description string) (string, error) {
+	task, err := c.api.CreateTask(client.CreateTaskRequest{Title: title, Description: description})
+	if err != nil {
 		return "", err
 	}
-	return result.ID, nil
+	return task.ID, nil
 }
 
 // ClaimTask claims a task
 func (c *Client) ClaimTask(taskID string) error {
-	body := map[string]interface{}{
-		"holder_id": c.holderID,
-		"ttl_sec":   300,
+	lease, err := c.api.Claim(taskID, c.holderID, 0)
+	if err != nil {
+		return err
 	}
-	_, err := c.post("/tasks/"+taskID+"/claim", body)
-	return err
+	c.mu.Lock()
+	c.leases[taskID] = lease
+	c.mu.Unlock()
+	return nil
+}
+
+// lease returns this client's lease on taskID. Without a claim it is a
+// lease with no token, which the daemon accepts when it does not require
+// holder tokens.
+func (c *Client) lease(taskID string) *client.Lease {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if lease := c.leases[taskID]; lease != nil {
+		return lease
+	}
+	return &client.Lease{TaskID: taskID, HolderID: c.holderID}
+}
+
+// Holds reports whether this client has claimed taskID and not released it.
+func (c *Client) Holds(taskID string) bool {
+	return c.lease(taskID).HolderToken != ""
 }
 
 // ReleaseTask releases a task
 func (c *Client) ReleaseTask(taskID string) error {
-	body := map[string]string{
-		"holder_id": c.holderID,
+	err := c.api.Release(c.lease(taskID))
+	if err == nil {
+		c.mu.Lock()
+		delete(c.leases, taskID)
+		c.mu.Unlock()
 	}
-	_, err := c.post("/tasks/"+taskID+"/release", body)
 	return err
 }
 
 // RunTask runs a command for a task
 func (c *Client) RunTask(taskID, command string, args []string) (int, error) {
-	body := map[string]interface{}{
-		"holder_id": c.holderID,
-		"command":   command,
-		"args":      args,
-	}
-	resp, err := c.post("/tasks/"+taskID+"/run", body)
+	run, err := c.api.Run(c.lease(taskID), client.RunRequest{Command: command, Args: args})
 	if err != nil {
 		return -1, err
 	}
-
-	var result struct {
-		ExitCode int `json:"exit_code"`
-	}
-	if err := json.Unmarshal(resp, &result); err != nil {
-		return -1, err
-	}
-	return result.ExitCode, nil
+	return run.ExitCode, nil
 }
 
 // AddMemory adds a memory item
 func (c *Client) AddMemory(taskID, content string) (string, error) {
-	body := map[string]string{
-		"task_id": taskID,
-		"content": content,
-		"tags":    "note",
-	}
-	resp, err := c.post("/memory", body)
+	item, err := c.api.AddMemory(client.MemoryRequest{TaskID: taskID, Content: content, Tags: "note"})
 	if err != nil {
 		return "", err
 	}
-
-	var result struct {
-		ID string `json:"id"`
-	}
-	if err := json.Unmarshal(resp, &result); err != nil {
-		return "", err
-	}
-	return result.ID, nil
+	return item.ID, nil
 }
 
 // QueryMemory searches memory
 func (c *Client) QueryMemory(query string) ([]MemoryDetail, error) {
-	resp, err := c.httpClient.Get(c.baseURL + "/memory?q=" + url.QueryEscape(query))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var items []struct {
-		ID      string `json:"id"`
-		Content string `json:"content"`
-		Tags    string `json:"tags"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
-		return nil, err
-	}
-
-	details := make([]MemoryDetail, len(items))
-	for i, m := range items {
-		details[i] = MemoryDetail{
-			ID:      m.ID,
-			Content: m.Content,
-			Tags:    m.Tags,
-		}
-	}
-	return details, nil
-}
-
-func (c *Client) post(path string, data interface{}) ([]byte, error) {
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := c.httpClient.Post(c.baseURL+path, "application/json", bytes.NewReader(jsonData))
+	items, err := c.api.Memory(query)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("API error: %s", string(body))
-	}
-
-	return body, nil
+	return memoryDetails(items), nil
 }
 
 // CheckHealth checks if the daemon is healthy
 func (c *Client) CheckHealth() (bool, error) {
-	resp, err := c.httpClient.Get(c.baseURL + "/health")
-	if err != nil {
-		return false, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return false, nil
-	}
-
-	var health struct {
-		OK bool `json:"ok"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+	health, err := c.api.Health()
+	if health == nil {
 		return false, err
 	}
+	return health.OK && err == nil, nil
+}
 
-	return health.OK, nil
+// GetStats fetches the task queue summary shown in the header
+func (c *Client) GetStats() (*QueueStats, error) {
+	return c.api.Stats()
 }
 
 // GetWorkers fetches worker pool statistics from the daemon
 func (c *Client) GetWorkers() (*WorkersStats, error) {
-	resp, err := c.httpClient.Get(c.baseURL + "/workers")
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: %s", string(body))
-	}
-
-	var stats WorkersStats
-	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
-		return nil, err
-	}
-
-	return &stats, nil
+	return c.api.Workers()
 }
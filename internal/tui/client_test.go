@@ -0,0 +1,29 @@
+package tui
+
+import "testing"
+
+func TestTreeOrder(t *testing.T) {
+	// Newest first, as the API lists them
+	tasks := []TaskItem{
+		{ID: "c2", ParentID: "p"},
+		{ID: "orphan", ParentID: "gone"},
+		{ID: "g1", ParentID: "c1"},
+		{ID: "c1", ParentID: "p"},
+		{ID: "p"},
+		{ID: "solo"},
+	}
+	got := treeOrder(tasks)
+
+	want := []struct {
+		id    string
+		depth int
+	}{{"orphan", 0}, {"p", 0}, {"c1", 1}, {"g1", 2}, {"c2", 1}, {"solo", 0}}
+	if len(got) != len(want) {
+		t.Fatalf("Got %d tasks, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].ID != w.id || got[i].Depth != w.depth {
+			t.Errorf("Position %d = %s at depth %d, want %s at depth %d", i, got[i].ID, got[i].Depth, w.id, w.depth)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	diffAddStyle  = lipgloss.NewStyle().Foreground(successColor)
+	diffDelStyle  = lipgloss.NewStyle().Foreground(errorColor)
+	diffHunkStyle = lipgloss.NewStyle().Foreground(cyanColor)
+	diffFileStyle = lipgloss.NewStyle().Bold(true).Foreground(fgColor)
+)
+
+// colorizeDiff styles a unified diff line by line: file headers bold, hunk
+// headers cyan, additions green and deletions red.
+func colorizeDiff(diff string) string {
+	lines := strings.Split(strings.TrimRight(diff, "\n"), "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "diff --git"), strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			lines[i] = diffFileStyle.Render(line)
+		case strings.HasPrefix(line, "@@"):
+			lines[i] = diffHunkStyle.Render(line)
+		case strings.HasPrefix(line, "+"):
+			lines[i] = diffAddStyle.Render(line)
+		case strings.HasPrefix(line, "-"):
+			lines[i] = diffDelStyle.Render(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// latestDiffRun returns the most recent run with a captured diff, or nil.
+// Runs are ordered newest first.
+func latestDiffRun(runs []RunDetail) *RunDetail {
+	for i := range runs {
+		if runs[i].HasDiff {
+			return &runs[i]
+		}
+	}
+	return nil
+}
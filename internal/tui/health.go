@@ -0,0 +1,92 @@
+package tui
+
+import "time"
+
+// Health probe timing. While the daemon is up it is probed every
+// healthInterval; once a probe fails the delay starts at healthMinBackoff
+// and doubles with each further failure, up to healthMaxBackoff.
+const (
+	healthInterval   = 5 * time.Second
+	healthMinBackoff = 500 * time.Millisecond
+	healthMaxBackoff = 30 * time.Second
+)
+
+// HealthChange is how a probe result changed the daemon's known state.
+type HealthChange int
+
+const (
+	HealthUnchanged HealthChange = iota
+	// HealthUp is a successful first probe.
+	HealthUp
+	// HealthDown is the first failed probe after the daemon was up, or a
+	// failed first probe.
+	HealthDown
+	// HealthReconnected is a successful probe after failures.
+	HealthReconnected
+)
+
+// HealthMonitor caches the daemon's health between probes and decides
+// when to probe next. It is not safe for concurrent use; the App updates
+// it from Update.
+type HealthMonitor struct {
+	interval, minBackoff, maxBackoff time.Duration
+
+	known     bool
+	online    bool
+	failures  int
+	checkedAt time.Time
+}
+
+// NewHealthMonitor returns a monitor with the default timing. Until the
+// first probe the daemon counts as offline.
+func NewHealthMonitor() *HealthMonitor {
+	return &HealthMonitor{interval: healthInterval, minBackoff: healthMinBackoff, maxBackoff: healthMaxBackoff}
+}
+
+// Online reports whether the last probe reached the daemon.
+func (h *HealthMonitor) Online() bool {
+	return h.online
+}
+
+// Failures is the number of probes that have failed in a row.
+func (h *HealthMonitor) Failures() int {
+	return h.failures
+}
+
+// CheckedAt is when the last probe finished.
+func (h *HealthMonitor) CheckedAt() time.Time {
+	return h.checkedAt
+}
+
+// Record stores a probe result and reports how it changed the state.
+func (h *HealthMonitor) Record(online bool, at time.Time) HealthChange {
+	was, known := h.online, h.known
+	h.known, h.online, h.checkedAt = true, online, at
+	if online {
+		h.failures = 0
+	} else {
+		h.failures++
+	}
+	switch {
+	case known && was == online:
+		return HealthUnchanged
+	case online && known:
+		return HealthReconnected
+	case online:
+		return HealthUp
+	default:
+		return HealthDown
+	}
+}
+
+// Delay is how long to wait before the next probe.
+func (h *HealthMonitor) Delay() time.Duration {
+	if h.online || h.failures == 0 {
+		return h.interval
+	}
+	delay := h.minBackoff << (h.failures - 1)
+	if delay > h.maxBackoff || delay <= 0 {
+		delay = h.maxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,60 @@
+package tui
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthMonitorTransitions(t *testing.T) {
+	h := NewHealthMonitor()
+	now := time.Now()
+
+	steps := []struct {
+		online bool
+		want   HealthChange
+	}{
+		{false, HealthDown},
+		{false, HealthUnchanged},
+		{true, HealthReconnected},
+		{true, HealthUnchanged},
+		{false, HealthDown},
+	}
+	for i, s := range steps {
+		if got := h.Record(s.online, now); got != s.want {
+			t.Fatalf("step %d: Record(%v) = %v, want %v", i, s.online, got, s.want)
+		}
+	}
+	if h.Online() || h.Failures() != 1 || !h.CheckedAt().Equal(now) {
+		t.Errorf("state = online %v failures %d, want offline with 1 failure", h.Online(), h.Failures())
+	}
+
+	if got := NewHealthMonitor().Record(true, now); got != HealthUp {
+		t.Errorf("first successful probe = %v, want HealthUp", got)
+	}
+}
+
+func TestHealthMonitorDelay(t *testing.T) {
+	h := NewHealthMonitor()
+	if got := h.Delay(); got != healthInterval {
+		t.Errorf("initial delay = %v, want %v", got, healthInterval)
+	}
+
+	want := []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second}
+	for i, w := range want {
+		h.Record(false, time.Now())
+		if got := h.Delay(); got != w {
+			t.Errorf("delay after %d failures = %v, want %v", i+1, got, w)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		h.Record(false, time.Now())
+	}
+	if got := h.Delay(); got != healthMaxBackoff {
+		t.Errorf("delay after many failures = %v, want cap %v", got, healthMaxBackoff)
+	}
+
+	h.Record(true, time.Now())
+	if got := h.Delay(); got != healthInterval {
+		t.Errorf("delay once back online = %v, want %v", got, healthInterval)
+	}
+}
@@ -0,0 +1,33 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadOnlyCommands(t *testing.T) {
+	s := NewSuggestions()
+	s.Add("/", SuggestionItem{Text: "lint", Run: "run golangci-lint run"}, SuggestionItem{Text: "docs", Run: "query docs"})
+	s.Remove(isMutating)
+	for _, text := range []string{"add", "claim", "run", "lint"} {
+		if item, _ := s.Lookup("/", text); item != nil {
+			t.Errorf("Expected %s to be hidden, got %+v", text, item)
+		}
+	}
+	for _, text := range []string{"query", "docs", "agents"} {
+		if item, _ := s.Lookup("/", text); item == nil {
+			t.Errorf("Expected %s to stay", text)
+		}
+	}
+	if len(s.sources["!"]) != 0 {
+		t.Errorf("Expected built-in actions to be hidden, got %+v", s.sources["!"])
+	}
+
+	a := &App{readOnly: true, suggestions: NewSuggestions(), tasks: []TaskItem{{ID: "t1"}}}
+	for _, input := range []string{"claim", "run go test", "!claim-and-run"} {
+		msg, ok := a.executeCommand(input)().(commandResultMsg)
+		if !ok || !strings.HasPrefix(msg.message, "Read-only mode") {
+			t.Errorf("%q: expected a read-only refusal, got %+v", input, msg)
+		}
+	}
+}
@@ -3,12 +3,22 @@ package tui
 import (
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/charmbracelet/lipgloss"
 )
 
-// Suggestions provides autocomplete for commands
+// Suggestions provides autocomplete for commands. The "@" references
+// combine the static "@" source with the agents and tasks set by SetAgents
+// and SetTasks, which may be called from any goroutine.
 type Suggestions struct {
+	sources map[string][]SuggestionItem // entries per prefix
+
+	mu         sync.Mutex
+	agents     []SuggestionItem
+	tasks      []SuggestionItem
+	references []SuggestionItem // "@" entries, rebuilt when a source changes
+
 	items        []SuggestionItem
 	filtered     []SuggestionItem
 	selectedIdx  int
@@ -20,38 +30,148 @@ type Suggestions struct {
 // SuggestionItem represents a single autocomplete suggestion
 type SuggestionItem struct {
 	Text        string
+	Args        string // argument placeholder shown after Text, e.g. "<title>"
 	Description string
-	Type        string // "command", "agent", "task", "action"
+	Type        string   // "command", "agent", "task", "action", "reference"
+	Run         string   // command line a custom entry expands to; see Expand
+	Steps       []string // quick action steps, run by RunAction
 }
 
 var commandSuggestions = []SuggestionItem{
-	{Text: "add", Description: "Create a new task", Type: "command"},
+	{Text: "add", Args: "<title>", Description: "Create a new task", Type: "command"},
 	{Text: "claim", Description: "Claim the selected task", Type: "command"},
 	{Text: "release", Description: "Release the selected task", Type: "command"},
-	{Text: "run", Description: "Execute a command on selected task", Type: "command"},
-	{Text: "note", Description: "Add a memory note", Type: "command"},
-	{Text: "query", Description: "Search memory items", Type: "command"},
+	{Text: "run", Args: "<command> [args...]", Description: "Execute a command on selected task", Type: "command"},
+	{Text: "note", Args: "<content>", Description: "Add a memory note", Type: "command"},
+	{Text: "comment", Args: "<text>", Description: "Comment on the selected task", Type: "command"},
+	{Text: "check", Args: "<item>", Description: "Check an item of the selected task's checklist", Type: "command"},
+	{Text: "uncheck", Args: "<item>", Description: "Uncheck an item of the selected task's checklist", Type: "command"},
+	{Text: "query", Args: "<term>", Description: "Search memory items", Type: "command"},
 	{Text: "scan", Description: "Scan for AI agents", Type: "command"},
 	{Text: "agents", Description: "View connected agents", Type: "command"},
-	{Text: "agent add", Description: "Manually add an agent", Type: "command"},
+	{Text: "agent add", Args: "<name> <type>", Description: "Manually add an agent", Type: "command"},
 	{Text: "login", Description: "Sign in to your Neona account", Type: "command"},
 	{Text: "logout", Description: "Sign out of your account", Type: "command"},
 	{Text: "whoami", Description: "Show current user info", Type: "command"},
 }
 
 var actionSuggestions = []SuggestionItem{
-	{Text: "claim-and-run", Description: "Claim task and run git status", Type: "action"},
-	{Text: "test", Description: "Run 'go test ./...'", Type: "action"},
-	{Text: "diff", Description: "Run 'git diff'", Type: "action"},
-	{Text: "status", Description: "Run 'git status'", Type: "action"},
+	{Text: "claim-and-run", Description: "Claim task and run git status", Type: "action", Steps: []string{"claim", "run git status"}},
+	{Text: "test", Description: "Run 'go test ./...'", Type: "action", Run: "run go test ./..."},
+	{Text: "diff", Description: "Run 'git diff'", Type: "action", Run: "run git diff"},
+	{Text: "status", Description: "Run 'git status'", Type: "action", Run: "run git status"},
+}
+
+// registered holds entries added by RegisterSuggestions, keyed by prefix.
+var registered = map[string][]SuggestionItem{}
+
+// RegisterSuggestions adds entries to the "/", "@" or "!" source of every
+// Suggestions created afterwards. It is meant to be called from init
+// functions and is not safe for concurrent use.
+func RegisterSuggestions(prefix string, items ...SuggestionItem) {
+	if !isSuggestionPrefix(prefix) {
+		panic(fmt.Sprintf("tui: unknown suggestion prefix %q", prefix))
+	}
+	registered[prefix] = append(registered[prefix], items...)
+}
+
+func isSuggestionPrefix(prefix string) bool {
+	return prefix == "/" || prefix == "@" || prefix == "!"
 }
 
 // NewSuggestions creates a new suggestions handler
 func NewSuggestions() *Suggestions {
-	return &Suggestions{
-		items:   commandSuggestions,
+	s := &Suggestions{
+		sources: map[string][]SuggestionItem{
+			"/": append([]SuggestionItem{}, commandSuggestions...),
+			"@": nil,
+			"!": append([]SuggestionItem{}, actionSuggestions...),
+		},
 		visible: false,
 	}
+	for prefix, items := range registered {
+		s.Add(prefix, items...)
+	}
+	s.items = s.sources["/"]
+	return s
+}
+
+// Add appends entries to the source for prefix. Entries whose Text matches
+// an existing entry replace it, so config can override built-ins.
+func (s *Suggestions) Add(prefix string, items ...SuggestionItem) {
+	if !isSuggestionPrefix(prefix) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if prefix == "@" {
+		s.references = nil
+	}
+	for _, item := range items {
+		if item.Type == "" {
+			item.Type = defaultSuggestionType(prefix)
+		}
+		replaced := false
+		for i, existing := range s.sources[prefix] {
+			if existing.Text == item.Text {
+				s.sources[prefix][i] = item
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			s.sources[prefix] = append(s.sources[prefix], item)
+		}
+	}
+}
+
+// Remove drops the entries of every source for which drop reports true.
+func (s *Suggestions) Remove(drop func(SuggestionItem) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for prefix, items := range s.sources {
+		kept := items[:0:0]
+		for _, item := range items {
+			if !drop(item) {
+				kept = append(kept, item)
+			}
+		}
+		s.sources[prefix] = kept
+	}
+	s.references = nil
+}
+
+// Lookup finds the entry for prefix whose Text is the longest word-wise
+// prefix of input, returning it with the remaining arguments.
+func (s *Suggestions) Lookup(prefix, input string) (*SuggestionItem, []string) {
+	fields := strings.Fields(strings.TrimPrefix(input, prefix))
+	var best *SuggestionItem
+	bestLen := 0
+	for i := range s.sources[prefix] {
+		item := &s.sources[prefix][i]
+		words := strings.Fields(item.Text)
+		if len(words) <= bestLen || len(words) > len(fields) {
+			continue
+		}
+		if strings.Join(fields[:len(words)], " ") == strings.Join(words, " ") {
+			best, bestLen = item, len(words)
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	return best, fields[bestLen:]
+}
+
+func defaultSuggestionType(prefix string) string {
+	switch prefix {
+	case "/":
+		return "command"
+	case "@":
+		return "reference"
+	default:
+		return "action"
+	}
 }
 
 // Update updates suggestions based on current input
@@ -68,23 +188,19 @@ func (s *Suggestions) Update(input string) {
 	switch firstChar {
 	case "/":
 		s.prefix = "/"
-		s.items = commandSuggestions // Reset to commands
+		s.items = s.sources["/"] // Reset to commands
 		s.visible = true
 		query := strings.ToLower(strings.TrimPrefix(input, "/"))
 		s.filter(query)
 	case "@":
 		s.prefix = "@"
-		// For @, start with empty list until agents/tasks are populated
-		// Do NOT reuse previous s.items if it was commands
-		if len(s.items) > 0 && s.items[0].Type == "command" {
-			s.items = []SuggestionItem{}
-		}
+		s.items = s.referenceItems()
 		s.visible = true
 		query := strings.ToLower(strings.TrimPrefix(input, "@"))
 		s.filter(query)
 	case "!":
 		s.prefix = "!"
-		s.items = actionSuggestions // Reset to actions
+		s.items = s.sources["!"] // Reset to actions
 		s.visible = true
 		query := strings.ToLower(strings.TrimPrefix(input, "!"))
 		s.filter(query)
@@ -97,38 +213,66 @@ func (s *Suggestions) Update(input string) {
 	s.currentInput = input
 }
 
-// SetAgents updates the agent suggestions
-func (s *Suggestions) SetAgents(agents []string) {
-	if s.prefix == "@" {
-		s.items = make([]SuggestionItem, len(agents))
-		for i, agent := range agents {
-			s.items[i] = SuggestionItem{
-				Text:        agent,
-				Description: "Reference this agent",
-				Type:        "agent",
-			}
+// SetAgents replaces the agent references.
+func (s *Suggestions) SetAgents(names []string) {
+	items := make([]SuggestionItem, len(names))
+	for i, name := range names {
+		items[i] = SuggestionItem{Text: name, Description: "Reference this agent", Type: "agent"}
+	}
+	s.mu.Lock()
+	s.agents, s.references = items, nil
+	s.mu.Unlock()
+}
+
+// SetTasks replaces the task references.
+func (s *Suggestions) SetTasks(items []SuggestionItem) {
+	s.mu.Lock()
+	s.tasks, s.references = items, nil
+	s.mu.Unlock()
+}
+
+// TaskSuggestions returns the references for tasks, described by their
+// titles.
+func TaskSuggestions(tasks []TaskItem) []SuggestionItem {
+	items := make([]SuggestionItem, len(tasks))
+	for i, t := range tasks {
+		desc := t.TaskTitle
+		if desc == "" {
+			desc = "Reference this task"
 		}
-		query := strings.ToLower(strings.TrimPrefix(s.currentInput, "@"))
-		s.filter(query)
+		items[i] = SuggestionItem{Text: t.ID, Description: desc, Type: "task"}
 	}
+	return items
 }
 
-// SetTasks updates the task suggestions
-func (s *Suggestions) SetTasks(tasks []string) {
+// Refresh filters again with the current input, showing references set
+// since the last Update.
+func (s *Suggestions) Refresh() {
 	if s.prefix == "@" {
-		// Add tasks to agent suggestions
-		taskItems := make([]SuggestionItem, len(tasks))
-		for i, task := range tasks {
-			taskItems[i] = SuggestionItem{
-				Text:        task,
-				Description: "Reference this task",
-				Type:        "task",
+		s.Update(s.currentInput)
+	}
+}
+
+// referenceItems returns the "@" entries: custom references, then agents,
+// then tasks, keeping the first entry for each Text.
+func (s *Suggestions) referenceItems() []SuggestionItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.references != nil {
+		return s.references
+	}
+	seen := make(map[string]bool)
+	refs := []SuggestionItem{}
+	for _, source := range [][]SuggestionItem{s.sources["@"], s.agents, s.tasks} {
+		for _, item := range source {
+			if !seen[item.Text] {
+				seen[item.Text] = true
+				refs = append(refs, item)
 			}
 		}
-		s.items = append(s.items, taskItems...)
-		query := strings.ToLower(strings.TrimPrefix(s.currentInput, "@"))
-		s.filter(query)
 	}
+	s.references = refs
+	return refs
 }
 
 func (s *Suggestions) filter(query string) {
@@ -227,14 +371,19 @@ func (s *Suggestions) Render(width int) string {
 			break
 		}
 
+		text := item.Text
+		if item.Args != "" {
+			text += " " + item.Args
+		}
+
 		line := ""
 		if i == s.selectedIdx {
-			line = selectedStyle.Render("▶ " + item.Text)
+			line = selectedStyle.Render("▶ " + text)
 			if item.Description != "" {
 				line += " " + selectedStyle.Render(item.Description)
 			}
 		} else {
-			line = itemStyle.Render("  " + item.Text)
+			line = itemStyle.Render("  " + text)
 			if item.Description != "" {
 				line += " " + descStyle.Render(item.Description)
 			}
@@ -0,0 +1,169 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCustomSuggestions(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".neona"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	yaml := `
+commands:
+  - name: lint
+    args: "[path]"
+    description: Run the linter on the selected task
+    run: run golangci-lint run {args}
+  - name: add
+    args: "<title>"
+    description: Create a bug task
+    run: add [bug] {args}
+references:
+  - name: docs/ARCHITECTURE.md
+    description: Architecture overview
+actions:
+  - name: e2e
+    description: Run end-to-end tests
+    run: run make e2e
+`
+	if err := os.WriteFile(ActionsPath(dir), []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadActions(ActionsPath(dir))
+	if err != nil {
+		t.Fatalf("LoadActions: %v", err)
+	}
+	s := NewSuggestions()
+	cfg.Apply(s)
+
+	s.Update("/li")
+	if sel := s.Selected(); sel == nil || sel.Text != "lint" || sel.Args != "[path]" {
+		t.Errorf("Expected lint suggestion, got %+v", sel)
+	}
+
+	// Overriding a built-in replaces it rather than duplicating it
+	adds := 0
+	for _, item := range s.sources["/"] {
+		if item.Text == "add" {
+			adds++
+			if item.Description != "Create a bug task" {
+				t.Errorf("Expected overridden add, got %+v", item)
+			}
+		}
+	}
+	if adds != 1 {
+		t.Errorf("Expected one add command, got %d", adds)
+	}
+
+	s.Update("@")
+	s.SetAgents([]string{"claude"})
+	s.Refresh()
+	if len(s.filtered) != 2 || s.filtered[0].Type != "reference" {
+		t.Errorf("Expected custom reference before agents, got %+v", s.filtered)
+	}
+
+	s.Update("!e2")
+	if sel := s.Selected(); sel == nil || sel.Run != "run make e2e" {
+		t.Errorf("Expected e2e action, got %+v", sel)
+	}
+
+	item, rest := s.Lookup("/", "lint ./internal/...")
+	if item == nil || item.Text != "lint" {
+		t.Fatalf("Lookup failed: %+v", item)
+	}
+	if got := item.Expand(rest, "t1"); got != "run golangci-lint run ./internal/..." {
+		t.Errorf("Unexpected expansion: %q", got)
+	}
+}
+
+func TestReferenceSuggestions(t *testing.T) {
+	s := NewSuggestions()
+	s.Add("@", SuggestionItem{Text: "claude", Description: "Custom"})
+	s.SetAgents([]string{"claude", "codex"})
+	tasks := []TaskItem{{ID: "t1", TaskTitle: "Build"}, {ID: "t2"}}
+	s.SetTasks(TaskSuggestions(tasks))
+	s.SetTasks(TaskSuggestions(tasks))
+
+	s.Update("@")
+	var got []string
+	for _, item := range s.filtered {
+		got = append(got, item.Type+":"+item.Text)
+	}
+	want := "reference:claude agent:codex task:t1 task:t2"
+	if strings.Join(got, " ") != want {
+		t.Errorf("references = %v, want %s", got, want)
+	}
+	if s.filtered[2].Description != "Build" {
+		t.Errorf("task description = %q, want its title", s.filtered[2].Description)
+	}
+
+	// Sources set from another goroutine show up on Refresh
+	done := make(chan struct{})
+	go func() {
+		s.SetTasks(TaskSuggestions([]TaskItem{{ID: "t3"}}))
+		close(done)
+	}()
+	s.Update("@t")
+	<-done
+	s.Refresh()
+	if len(s.filtered) != 1 || s.filtered[0].Text != "t3" {
+		t.Errorf("after SetTasks, filtered = %+v, want t3", s.filtered)
+	}
+}
+
+func TestLoadActionsMissingAndInvalid(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := LoadActions(ActionsPath(dir))
+	if err != nil || len(cfg.Commands) != 0 {
+		t.Fatalf("Expected empty config for missing file, got %+v, %v", cfg, err)
+	}
+
+	path := filepath.Join(dir, ActionsFile)
+	os.WriteFile(path, []byte("actions:\n  - run: make\n"), 0o644)
+	if _, err := LoadActions(path); err == nil {
+		t.Error("Expected error for entry without name")
+	}
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		run  string
+		args []string
+		want string
+	}{
+		{"run go test {args}", []string{"./...", "-v"}, "run go test ./... -v"},
+		{"run git log -n {1} {2}", []string{"5"}, "run git log -n 5"},
+		{"note reviewed {task}", nil, "note reviewed t1"},
+		{"run make", []string{"lint"}, "run make lint"},
+	}
+	for _, tt := range tests {
+		item := SuggestionItem{Run: tt.run}
+		if got := item.Expand(tt.args, "t1"); got != tt.want {
+			t.Errorf("Expand(%q, %v) = %q, want %q", tt.run, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestRegisterSuggestions(t *testing.T) {
+	defer func(saved map[string][]SuggestionItem) { registered = saved }(registered)
+	registered = map[string][]SuggestionItem{}
+
+	RegisterSuggestions("!", SuggestionItem{Text: "deploy", Description: "Deploy preview"})
+	s := NewSuggestions()
+	s.Update("!dep")
+	if sel := s.Selected(); sel == nil || sel.Type != "action" {
+		t.Errorf("Expected registered action, got %+v", sel)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic for unknown prefix")
+		}
+	}()
+	RegisterSuggestions("#", SuggestionItem{Text: "x"})
+}
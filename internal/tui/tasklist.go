@@ -0,0 +1,141 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	overdueStyle   = lipgloss.NewStyle().Foreground(errorColor)
+	scheduledStyle = lipgloss.NewStyle().Foreground(cyanColor)
+)
+
+// taskList renders the task list a window at a time. Rows are rendered the
+// first time they scroll into view and kept until their task changes, so a
+// frame costs the same with ten thousand tasks as with ten.
+type taskList struct {
+	tasks []TaskItem
+	// rows caches each task's unselected line; "" means not rendered yet.
+	rows []string
+	// labels caches formatStatus per status.
+	labels map[string]string
+	// day is when the cache was filled; scheduled badges read "15:04" for
+	// today only, so rows are rendered again the next day.
+	day int
+}
+
+// SetTasks replaces the tasks, keeping the rendered rows of tasks that did
+// not change.
+func (l *taskList) SetTasks(tasks []TaskItem) {
+	prev := make(map[string]int, len(l.tasks))
+	for i, t := range l.tasks {
+		if l.rows[i] != "" {
+			prev[t.ID] = i
+		}
+	}
+	rows := make([]string, len(tasks))
+	for i, t := range tasks {
+		if j, ok := prev[t.ID]; ok && sameRow(l.tasks[j], t) {
+			rows[i] = l.rows[j]
+		}
+	}
+	l.tasks, l.rows = tasks, rows
+}
+
+// sameRow reports whether two versions of a task render the same line.
+func sameRow(a, b TaskItem) bool {
+	if a.ID != b.ID || a.TaskTitle != b.TaskTitle || a.Status != b.Status || a.Depth != b.Depth ||
+		a.Overdue != b.Overdue || a.Scheduled != b.Scheduled {
+		return false
+	}
+	if a.NotBefore == nil || b.NotBefore == nil {
+		return a.NotBefore == b.NotBefore
+	}
+	return a.NotBefore.Equal(*b.NotBefore)
+}
+
+// Window returns the range of rows shown in height lines, centered on
+// selected where the list allows.
+func (l *taskList) Window(height, selected int) (start, end int) {
+	n := len(l.tasks)
+	if n <= height {
+		return 0, n
+	}
+	start = max(0, selected-height/2)
+	end = start + height
+	if end > n {
+		end = n
+		start = n - height
+	}
+	return start, end
+}
+
+// Render returns the visible rows with selected highlighted.
+func (l *taskList) Render(height, selected int) string {
+	if day := time.Now().YearDay(); day != l.day {
+		l.day = day
+		for i := range l.rows {
+			l.rows[i] = ""
+		}
+	}
+
+	start, end := l.Window(height, selected)
+	lines := make([]string, 0, end-start)
+	for i := start; i < end; i++ {
+		if i == selected {
+			lines = append(lines, l.renderSelected(l.tasks[i]))
+			continue
+		}
+		if l.rows[i] == "" {
+			l.rows[i] = l.renderRow(l.tasks[i])
+		}
+		lines = append(lines, l.rows[i])
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (l *taskList) renderRow(task TaskItem) string {
+	title := indentTitle(task)
+	if task.Overdue {
+		title += "  " + overdueStyle.Render("⏰ overdue")
+	}
+	if task.Scheduled {
+		title += "  " + scheduledStyle.Render(scheduledBadge(task.NotBefore))
+	}
+	return taskItemStyle.Render(fmt.Sprintf("  %s  %s", l.label(task.Status), title))
+}
+
+func (l *taskList) renderSelected(task TaskItem) string {
+	title := indentTitle(task)
+	if task.Overdue {
+		title += "  ⏰ overdue"
+	}
+	if task.Scheduled {
+		title += "  " + scheduledBadge(task.NotBefore)
+	}
+	return selectedStyle.Render(fmt.Sprintf("▶ %s  %s", formatStatusPlain(task.Status), title))
+}
+
+// label returns the styled status, formatting each status once.
+func (l *taskList) label(status string) string {
+	if label, ok := l.labels[status]; ok {
+		return label
+	}
+	if l.labels == nil {
+		l.labels = make(map[string]string)
+	}
+	label := formatStatus(status)
+	l.labels[status] = label
+	return label
+}
+
+// indentTitle places a subtask under its parent.
+func indentTitle(task TaskItem) string {
+	if task.Depth == 0 {
+		return task.TaskTitle
+	}
+	return strings.Repeat("  ", task.Depth-1) + "└ " + task.TaskTitle
+}
@@ -0,0 +1,78 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func manyTasks(n int) []TaskItem {
+	tasks := make([]TaskItem, n)
+	for i := range tasks {
+		tasks[i] = TaskItem{ID: fmt.Sprintf("t%d", i), TaskTitle: fmt.Sprintf("Task %d", i), Status: "pending"}
+	}
+	return tasks
+}
+
+func TestTaskListWindow(t *testing.T) {
+	var l taskList
+	l.SetTasks(manyTasks(100))
+
+	tests := []struct{ selected, start, end int }{
+		{0, 0, 10},
+		{50, 45, 55},
+		{99, 90, 100},
+	}
+	for _, tt := range tests {
+		if start, end := l.Window(10, tt.selected); start != tt.start || end != tt.end {
+			t.Errorf("Window(10, %d) = %d, %d; want %d, %d", tt.selected, start, end, tt.start, tt.end)
+		}
+	}
+
+	out := l.Render(10, 50)
+	if lines := strings.Split(out, "\n"); len(lines) != 10 || !strings.Contains(lines[5], "▶") || !strings.Contains(lines[5], "Task 50") {
+		t.Errorf("Render(10, 50) = %q, want 10 lines with task 50 selected in the middle", out)
+	}
+
+	// Only the visible rows are rendered
+	rendered := 0
+	for _, row := range l.rows {
+		if row != "" {
+			rendered++
+		}
+	}
+	if rendered != 9 {
+		t.Errorf("rendered %d rows, want the 9 visible unselected ones", rendered)
+	}
+}
+
+func TestTaskListKeepsUnchangedRows(t *testing.T) {
+	var l taskList
+	tasks := manyTasks(3)
+	l.SetTasks(tasks)
+	l.Render(10, -1)
+
+	next := manyTasks(4)
+	next[1].Status = "completed"
+	next[0], next[2] = next[2], next[0]
+	l.SetTasks(next)
+
+	if l.rows[0] == "" || l.rows[2] == "" {
+		t.Error("moved but unchanged tasks lost their rendered rows")
+	}
+	if l.rows[1] != "" || l.rows[3] != "" {
+		t.Error("changed and new tasks kept stale rows")
+	}
+	if out := l.Render(10, -1); !strings.Contains(strings.Split(out, "\n")[1], "DONE") {
+		t.Errorf("changed task not rendered again: %q", out)
+	}
+}
+
+func BenchmarkTaskListRender(b *testing.B) {
+	var l taskList
+	l.SetTasks(manyTasks(10000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Render(40, i%10000)
+	}
+}
@@ -1,6 +1,10 @@
 package tui
 
-import "time"
+import (
+	"time"
+
+	"github.com/fentz26/neona/pkg/client"
+)
 
 // TaskItem is a summary of a task for the list view
 type TaskItem struct {
@@ -8,6 +12,18 @@ type TaskItem struct {
 	TaskTitle string
 	Status    string
 	ClaimedBy string
+	ParentID  string
+	CreatedAt time.Time
+	// Priority is claimed before lower priorities; 0 is normal
+	Priority int
+	// Depth is how deep the task sits in the subtask tree; see treeOrder
+	Depth int
+	// Overdue is set while the task is open past its deadline
+	Overdue bool
+	// NotBefore is set, with Scheduled, while dispatch of a pending task is
+	// delayed until then
+	NotBefore *time.Time
+	Scheduled bool
 }
 
 // TaskDetail is the full task information
@@ -19,6 +35,13 @@ type TaskDetail struct {
 	ClaimedBy   string
 	CreatedAt   string
 	UpdatedAt   string
+	Priority    int
+	EstimateSec int
+	DueAt       *time.Time
+	Overdue     bool
+	SLABreached bool
+	NotBefore   *time.Time
+	Scheduled   bool
 }
 
 // RunDetail represents a run record
@@ -28,6 +51,9 @@ type RunDetail struct {
 	ExitCode int
 	Stdout   string
 	Stderr   string
+	HasDiff  bool
+	// Truncated is set when the daemon cut the run's output
+	Truncated bool
 }
 
 // MemoryDetail represents a memory item
@@ -37,21 +63,31 @@ type MemoryDetail struct {
 	Tags    string
 }
 
-// WorkerInfo represents an active worker
-type WorkerInfo struct {
-	WorkerID      string    `json:"worker_id"`
-	TaskID        string    `json:"task_id"`
-	TaskTitle     string    `json:"task_title"`
-	LeaseID       string    `json:"lease_id"`
-	LeaseExpires  time.Time `json:"lease_expires"`
-	StartedAt     time.Time `json:"started_at"`
-	ConnectorName string    `json:"connector_name"`
+// ChecklistItemDetail represents an item of a task's checklist
+type ChecklistItemDetail struct {
+	ID        string `json:"id"`
+	Position  int    `json:"position"`
+	Text      string `json:"text"`
+	Done      bool   `json:"done"`
+	CheckedBy string `json:"checked_by"`
 }
 
-// WorkersStats contains scheduler worker pool statistics
-type WorkersStats struct {
-	ActiveWorkers   int            `json:"active_workers"`
-	GlobalMax       int            `json:"global_max"`
-	ConnectorCounts map[string]int `json:"connector_counts"`
-	Workers         []WorkerInfo   `json:"workers"`
+// CommentDetail represents a comment on a task
+type CommentDetail struct {
+	ID        string
+	Author    string
+	Body      string
+	CreatedAt time.Time
 }
+
+// Worker pool statistics, as the daemon reports them
+type (
+	WorkersStats   = client.WorkersStats
+	ClaimStats     = client.ClaimStats
+	WorkerInfo     = client.Worker
+	WorkerRouting  = client.WorkerRouting
+	RateLimitState = client.RateLimitState
+)
+
+// QueueStats summarizes the task queue for the header
+type QueueStats = client.Stats
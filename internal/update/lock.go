@@ -0,0 +1,77 @@
+package update
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrLocked is returned when another neona process is checking for or
+// installing an update.
+var ErrLocked = errors.New("another neona process is updating")
+
+// staleLockAge is how old a lock file must be to be taken over. A lock that
+// old was left by a process that died mid-update; a live one finishes well
+// within it.
+const staleLockAge = 10 * time.Minute
+
+// acquireLock takes the lock file at path, which works across processes on
+// every platform because creating a file exclusively is atomic. It returns
+// ErrLocked while another process holds it. Call the returned func to
+// release it.
+func acquireLock(path string) (func(), error) {
+	unlock, err := createLock(path)
+	if !errors.Is(err, os.ErrExist) {
+		return unlock, err
+	}
+	if !isStale(path) {
+		return nil, ErrLocked
+	}
+
+	// Two processes that both find the lock stale must not both clear it:
+	// the second would remove the lock the first just took. Only the one
+	// that creates the takeover marker clears it, after checking again.
+	marker := path + ".takeover"
+	unmark, err := createLock(marker)
+	if errors.Is(err, os.ErrExist) {
+		if isStale(marker) {
+			// Left by a process that died mid-takeover; the next call proceeds
+			os.Remove(marker)
+		}
+		return nil, ErrLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer unmark()
+
+	if !isStale(path) {
+		return nil, ErrLocked
+	}
+	os.Remove(path)
+	unlock, err = createLock(path)
+	if errors.Is(err, os.ErrExist) {
+		return nil, ErrLocked
+	}
+	return unlock, err
+}
+
+// createLock creates the lock file at path holding this process's PID,
+// failing with an error wrapping os.ErrExist if it is already there.
+func createLock(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("update lock: %w", err)
+	}
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	f.Close()
+	return func() { os.Remove(path) }, nil
+}
+
+// isStale reports whether the lock file at path is old enough to take over,
+// or is gone.
+func isStale(path string) bool {
+	info, err := os.Stat(path)
+	return err != nil || time.Since(info.ModTime()) >= staleLockAge
+}
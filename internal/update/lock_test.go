@@ -0,0 +1,107 @@
+package update
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "update.lock")
+
+	unlock, err := acquireLock(path)
+	if err != nil {
+		t.Fatalf("acquireLock: %v", err)
+	}
+	if _, err := acquireLock(path); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Expected ErrLocked while held, got %v", err)
+	}
+	unlock()
+	unlock, err = acquireLock(path)
+	if err != nil {
+		t.Fatalf("Expected the released lock taken, got %v", err)
+	}
+
+	// A lock left by a process that died is taken over
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acquireLock(path); err != nil {
+		t.Errorf("Expected the stale lock taken over, got %v", err)
+	}
+	unlock()
+}
+
+func TestAcquireLockStaleTakeoverRace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "update.lock")
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.WriteFile(path, []byte("1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// Everyone finds the lock stale at once; only one may take it over
+	const racers = 20
+	var wg sync.WaitGroup
+	var held atomic.Int32
+	start := make(chan struct{})
+	for i := 0; i < racers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if _, err := acquireLock(path); err == nil {
+				held.Add(1)
+			} else if !errors.Is(err, ErrLocked) {
+				t.Errorf("acquireLock: %v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	if got := held.Load(); got != 1 {
+		t.Errorf("Expected exactly one process to take over the stale lock, got %d", got)
+	}
+
+	// A takeover marker left by a process that died is cleared
+	marker := path + ".takeover"
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(marker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(marker, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acquireLock(path); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Expected ErrLocked while the marker is cleared, got %v", err)
+	}
+	if _, err := acquireLock(path); err != nil {
+		t.Errorf("Expected the stale lock taken over after the marker was cleared, got %v", err)
+	}
+}
+
+func TestSaveCache(t *testing.T) {
+	dir := t.TempDir()
+	c := &Checker{configDir: dir, cache: &UpdateCache{LastCheck: 42, LatestVersion: "1.2.0"}}
+	if err := c.saveCache(); err != nil {
+		t.Fatalf("saveCache: %v", err)
+	}
+
+	loaded := &Checker{configDir: dir}
+	if err := loaded.loadCache(); err != nil || loaded.cache.LatestVersion != "1.2.0" {
+		t.Fatalf("loadCache = %+v, %v", loaded.cache, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the cache file left, got %d entries", len(entries))
+	}
+}
@@ -3,6 +3,7 @@ package update
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,6 +14,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/fentz26/neona/internal/paths"
 )
 
 const (
@@ -58,12 +61,7 @@ type Checker struct {
 
 // NewChecker creates a new update checker.
 func NewChecker() (*Checker, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
-	}
-
-	configDir := filepath.Join(homeDir, ".config", "neona")
+	configDir := paths.ConfigDir()
 	if err := os.MkdirAll(configDir, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create config directory: %w", err)
 	}
@@ -158,12 +156,18 @@ func (c *Checker) GetDownloadURL() string {
 	return c.cache.DownloadURL
 }
 
-// DownloadAndInstall downloads and installs the latest version.
+// DownloadAndInstall downloads and installs the latest version. It returns
+// ErrLocked if another process is updating.
 func (c *Checker) DownloadAndInstall() error {
+	unlock, err := acquireLock(c.lockPath())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	if c.cache == nil || c.cache.DownloadURL == "" {
 		// Try to get fresh release info
-		_, _, err := c.CheckForUpdate()
-		if err != nil {
+		if _, _, err := c.CheckForUpdate(); err != nil {
 			return err
 		}
 	}
@@ -255,7 +259,13 @@ func (c *Checker) loadCache() error {
 	return nil
 }
 
-// saveCache saves the cache to disk.
+// lockPath returns the path to the lock file guarding updates.
+func (c *Checker) lockPath() string {
+	return filepath.Join(c.configDir, "update.lock")
+}
+
+// saveCache saves the cache to disk. It writes a temporary file and renames
+// it over the cache, so a process reading the cache never sees half of it.
 func (c *Checker) saveCache() error {
 	if c.cache == nil {
 		return nil
@@ -266,7 +276,19 @@ func (c *Checker) saveCache() error {
 		return err
 	}
 
-	return os.WriteFile(c.cachePath(), data, 0600)
+	tmp, err := os.CreateTemp(c.configDir, "update_cache-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.cachePath())
 }
 
 // findAssetURL finds the download URL for the current OS/arch.
@@ -333,7 +355,8 @@ func copyFile(src, dst string) error {
 }
 
 // CheckAndAutoUpdate checks for updates and installs if available.
-// Returns true if updated (caller should restart).
+// Returns true if updated (caller should restart). If another process is
+// already checking or updating, it leaves the update to that process.
 func CheckAndAutoUpdate() (bool, error) {
 	checker, err := NewChecker()
 	if err != nil {
@@ -344,6 +367,22 @@ func CheckAndAutoUpdate() (bool, error) {
 		return false, nil
 	}
 
+	unlock, err := acquireLock(checker.lockPath())
+	if errors.Is(err, ErrLocked) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	// Another process may have checked and released the lock since we
+	// read the cache
+	_ = checker.loadCache()
+	if !checker.ShouldCheck() {
+		return false, nil
+	}
+
 	// Simple check without full TUI for the auto-check on startup
 	hasUpdate, _, err := checker.CheckForUpdate()
 	if err != nil {
@@ -356,15 +395,26 @@ func CheckAndAutoUpdate() (bool, error) {
 
 	// If update found, run the full TUI update
 	fmt.Println() // distinct from previous output
-	return true, RunSelfUpdate()
+	return true, runSelfUpdate(checker)
 }
 
-// RunSelfUpdate performs the self-update process with a rich TUI.
+// RunSelfUpdate performs the self-update process with a rich TUI. It
+// returns ErrLocked if another process is updating.
 func RunSelfUpdate() error {
 	checker, err := NewChecker()
 	if err != nil {
 		return err
 	}
+	unlock, err := acquireLock(checker.lockPath())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return runSelfUpdate(checker)
+}
+
+// runSelfUpdate is RunSelfUpdate for a caller holding the update lock.
+func runSelfUpdate(checker *Checker) error {
 
 	// 1. Current Version
 	fmt.Printf("┌  Current version: %s\n", Version)
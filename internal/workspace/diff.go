@@ -0,0 +1,29 @@
+package workspace
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// MaxDiffBytes caps the diff Diff returns; longer diffs are cut and marked.
+const MaxDiffBytes = 1 << 20
+
+// Diff returns the uncommitted changes in dir against HEAD, staged or not,
+// as a unified diff. It returns "" without error when dir is not inside a
+// git repository.
+func Diff(dir string) (string, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return "", nil
+	}
+	if _, err := git(dir, "rev-parse", "--verify", "HEAD"); err != nil {
+		return "", nil
+	}
+	out, err := gitRaw(dir, "diff", "--no-color", "--no-ext-diff", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("diff %s: %w", dir, err)
+	}
+	if len(out) > MaxDiffBytes {
+		out = out[:MaxDiffBytes] + "\n... diff truncated ...\n"
+	}
+	return out, nil
+}
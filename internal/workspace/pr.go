@@ -0,0 +1,63 @@
+package workspace
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// PullRequestConfig configures opening a pull request for a task branch.
+type PullRequestConfig struct {
+	// Remote is the git remote branches are pushed to (default "origin").
+	Remote string
+	// Base is the branch the pull request targets; empty uses the
+	// repository's default branch.
+	Base string
+	// Draft opens pull requests as drafts.
+	Draft bool
+	// GH is the GitHub CLI binary (default "gh").
+	GH string
+}
+
+// OpenPullRequest pushes the task's branch and opens a GitHub pull request
+// for it with the gh CLI. It returns the pull request URL.
+func (m *WorktreeManager) OpenPullRequest(taskID string, cfg PullRequestConfig, title, body string) (string, error) {
+	if cfg.Remote == "" {
+		cfg.Remote = "origin"
+	}
+	if cfg.GH == "" {
+		cfg.GH = "gh"
+	}
+	wt := m.Lookup(taskID)
+
+	if _, err := git(m.cfg.Repo, "push", "-u", cfg.Remote, wt.Branch); err != nil {
+		return "", fmt.Errorf("push %s: %w", wt.Branch, err)
+	}
+
+	args := []string{"pr", "create", "--head", wt.Branch, "--title", title, "--body", body}
+	if cfg.Base != "" {
+		args = append(args, "--base", cfg.Base)
+	}
+	if cfg.Draft {
+		args = append(args, "--draft")
+	}
+	cmd := exec.Command(cfg.GH, args...)
+	cmd.Dir = m.cfg.Repo
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("gh pr create: %s", msg)
+		}
+		return "", fmt.Errorf("gh pr create: %w", err)
+	}
+
+	// gh prints the new pull request's URL as its last line
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	url := strings.TrimSpace(lines[len(lines)-1])
+	if !strings.HasPrefix(url, "http") {
+		return "", fmt.Errorf("gh pr create: unexpected output %q", stdout.String())
+	}
+	return url, nil
+}
@@ -0,0 +1,61 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestOpenPullRequest(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake gh is a shell script")
+	}
+	repo := newTestRepo(t)
+	remote := t.TempDir()
+	if _, err := git(remote, "init", "-q", "--bare"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := git(repo, "remote", "add", "origin", remote); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fake gh records its arguments and prints a URL like the real one
+	bin := t.TempDir()
+	argsFile := filepath.Join(bin, "args")
+	gh := filepath.Join(bin, "gh")
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + argsFile + "\necho 'Creating pull request...'\necho https://github.com/acme/api/pull/7\n"
+	if err := os.WriteFile(gh, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewWorktreeManager(WorktreeConfig{Repo: repo, Dir: filepath.Join(t.TempDir(), "wt")})
+	if err != nil {
+		t.Fatalf("NewWorktreeManager: %v", err)
+	}
+	wt, err := m.Provision("33333333-cccc")
+	if err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+	if _, err := git(wt.Path, "commit", "-q", "--allow-empty", "-m", "work"); err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := m.OpenPullRequest("33333333-cccc", PullRequestConfig{Base: "main", Draft: true, GH: gh}, "Fix it", "body")
+	if err != nil {
+		t.Fatalf("OpenPullRequest: %v", err)
+	}
+	if url != "https://github.com/acme/api/pull/7" {
+		t.Errorf("url = %q", url)
+	}
+	if _, err := git(remote, "rev-parse", "--verify", "refs/heads/"+wt.Branch); err != nil {
+		t.Errorf("Expected branch pushed to remote: %v", err)
+	}
+	data, _ := os.ReadFile(argsFile)
+	got := strings.Join(strings.Fields(string(data)), " ")
+	want := "pr create --head " + wt.Branch + " --title Fix it --body body --base main --draft"
+	if got != want {
+		t.Errorf("gh args = %q, want %q", got, want)
+	}
+}
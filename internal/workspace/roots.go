@@ -0,0 +1,88 @@
+// Package workspace decides where tasks execute on disk.
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutsideRoots is returned for a directory that is not inside any
+// allowed root.
+var ErrOutsideRoots = errors.New("directory is outside the allowed roots")
+
+// Roots is the set of directories task working directories must live in.
+type Roots struct {
+	dirs []string // absolute, symlinks resolved
+}
+
+// NewRoots returns roots for dirs. Each must be an existing directory.
+func NewRoots(dirs ...string) (*Roots, error) {
+	r := &Roots{}
+	for _, dir := range dirs {
+		real, err := realDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("workdir root %s: %w", dir, err)
+		}
+		r.dirs = append(r.dirs, real)
+	}
+	return r, nil
+}
+
+// List returns the resolved root directories.
+func (r *Roots) List() []string {
+	return append([]string(nil), r.dirs...)
+}
+
+// Resolve validates dir and returns its absolute, symlink-free path. A
+// relative dir is taken relative to the first root. The result must be an
+// existing directory inside one of the roots; symlinks are resolved first so
+// they cannot point outside.
+func (r *Roots) Resolve(dir string) (string, error) {
+	if len(r.dirs) == 0 {
+		return "", ErrOutsideRoots
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(r.dirs[0], dir)
+	}
+	real, err := realDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range r.dirs {
+		if within(root, real) {
+			return real, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %w", dir, ErrOutsideRoots)
+}
+
+func realDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	return real, nil
+}
+
+// within reports whether path is root or below it.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
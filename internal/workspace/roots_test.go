@@ -0,0 +1,71 @@
+package workspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRootsResolve(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	sub := filepath.Join(root, "checkouts", "api")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	escape := filepath.Join(root, "escape")
+	if err := os.Symlink(outside, escape); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	file := filepath.Join(root, "file.txt")
+	os.WriteFile(file, []byte("x"), 0o644)
+
+	roots, err := NewRoots(root)
+	if err != nil {
+		t.Fatalf("NewRoots: %v", err)
+	}
+	realSub, _ := filepath.EvalSymlinks(sub)
+
+	tests := []struct {
+		name    string
+		dir     string
+		want    string
+		outside bool
+		fail    bool
+	}{
+		{name: "absolute", dir: sub, want: realSub},
+		{name: "relative to first root", dir: "checkouts/api", want: realSub},
+		{name: "root itself", dir: root, want: roots.List()[0]},
+		{name: "dot-dot escape", dir: filepath.Join(root, "..", filepath.Base(outside)), outside: true},
+		{name: "symlink escape", dir: escape, outside: true},
+		{name: "missing", dir: filepath.Join(root, "nope"), fail: true},
+		{name: "not a directory", dir: file, fail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := roots.Resolve(tt.dir)
+			switch {
+			case tt.outside:
+				if !errors.Is(err, ErrOutsideRoots) {
+					t.Errorf("Resolve(%s) = %q, %v; want ErrOutsideRoots", tt.dir, got, err)
+				}
+			case tt.fail:
+				if err == nil {
+					t.Errorf("Resolve(%s) = %q; want error", tt.dir, got)
+				}
+			case err != nil || got != tt.want:
+				t.Errorf("Resolve(%s) = %q, %v; want %q", tt.dir, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRootsRejectsMissingDir(t *testing.T) {
+	if _, err := NewRoots(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected error for missing root")
+	}
+	if _, err := (&Roots{}).Resolve("/tmp"); !errors.Is(err, ErrOutsideRoots) {
+		t.Errorf("Expected ErrOutsideRoots without roots, got %v", err)
+	}
+}
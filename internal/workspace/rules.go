@@ -0,0 +1,125 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RuleFilePatterns match the agent rule and knowledge files FindRuleFiles
+// collects, relative to the repository root.
+var RuleFilePatterns = []string{
+	"AGENTS.md",
+	"CLAUDE.md",
+	"GEMINI.md",
+	".cursorrules",
+	".windsurfrules",
+	".clinerules",
+	".github/copilot-instructions.md",
+	".cursor/rules/*.mdc",
+}
+
+// RuleFile is a rule file's path, relative to the repository root with
+// forward slashes, and its content.
+type RuleFile struct {
+	Path    string
+	Content string
+}
+
+// RuleSource describes where FindRuleFiles read files from.
+type RuleSource struct {
+	// Root is the repository root, or the directory itself outside git.
+	Root string
+	// Commit is the HEAD commit the files were read at; it is empty when
+	// they were read from disk.
+	Commit string
+}
+
+// FindRuleFiles returns the rule files matching RuleFilePatterns in the
+// repository containing dir, sorted by path. By default they are read as
+// committed at HEAD, so uncommitted edits are left out; with worktree, or
+// when dir is not in a git repository with commits, they are read from
+// disk.
+func FindRuleFiles(dir string, worktree bool) ([]RuleFile, RuleSource, error) {
+	src := RuleSource{Root: dir}
+	if _, err := exec.LookPath("git"); err == nil {
+		if top, err := git(dir, "rev-parse", "--show-toplevel"); err == nil {
+			src.Root = top
+			if head, err := git(top, "rev-parse", "--verify", "HEAD"); err == nil && !worktree {
+				src.Commit = head
+				files, err := committedRuleFiles(top, head)
+				return files, src, err
+			}
+		}
+	}
+	files, err := diskRuleFiles(src.Root)
+	return files, src, err
+}
+
+// committedRuleFiles reads the rule files in commit.
+func committedRuleFiles(repo, commit string) ([]RuleFile, error) {
+	out, err := git(repo, "ls-tree", "-r", "--name-only", "-z", commit)
+	if err != nil {
+		return nil, err
+	}
+	var files []RuleFile
+	for _, name := range strings.Split(out, "\x00") {
+		if name == "" || !isRuleFile(name) {
+			continue
+		}
+		content, err := gitRaw(repo, "show", commit+":"+name)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+		files = append(files, RuleFile{Path: name, Content: content})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// diskRuleFiles reads the rule files under root from disk.
+func diskRuleFiles(root string) ([]RuleFile, error) {
+	var files []RuleFile
+	for _, pattern := range RuleFilePatterns {
+		matches, err := filepath.Glob(filepath.Join(root, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			data, err := os.ReadFile(match)
+			if err != nil {
+				return nil, err
+			}
+			rel, err := filepath.Rel(root, match)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, RuleFile{Path: filepath.ToSlash(rel), Content: string(data)})
+		}
+	}
+	if len(files) == 0 {
+		if _, err := os.Stat(root); errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+func isRuleFile(name string) bool {
+	for _, pattern := range RuleFilePatterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,294 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyPath is the project policy file, relative to the repository root.
+const PolicyPath = ".ai/policy.yaml"
+
+// RuleFormat is an agent's instruction file that WriteRules can write.
+type RuleFormat struct {
+	Name string
+	// Path is where the file goes, relative to the repository root.
+	Path string
+	// Detect lists paths whose presence means the agent is in use.
+	Detect []string
+	// Frontmatter, when set, starts the file, which is then generated as a
+	// whole. Without it the generated rules are kept in a marked block so
+	// the rest of the file stays hand-written.
+	Frontmatter string
+}
+
+// RuleFormats are the formats WriteRules can write, by name.
+var RuleFormats = map[string]RuleFormat{
+	"claude": {
+		Name:   "claude",
+		Path:   "CLAUDE.md",
+		Detect: []string{"CLAUDE.md", ".claude"},
+	},
+	"cursor": {
+		Name:        "cursor",
+		Path:        ".cursor/rules/neona.mdc",
+		Detect:      []string{".cursor", ".cursorrules"},
+		Frontmatter: "---\ndescription: Project rules and knowledge shared through Neona\nalwaysApply: true\n---\n",
+	},
+}
+
+// RuleFormatNames returns the names of RuleFormats, sorted.
+func RuleFormatNames() []string {
+	var names []string
+	for name := range RuleFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DetectRuleFormats returns the formats of the agents in use in root.
+func DetectRuleFormats(root string) []RuleFormat {
+	var found []RuleFormat
+	for _, name := range RuleFormatNames() {
+		f := RuleFormats[name]
+		for _, p := range f.Detect {
+			if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(p))); err == nil {
+				found = append(found, f)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// PolicySection is a top-level section of the policy file, such as
+// task_execution, with its settings in file order.
+type PolicySection struct {
+	Name     string
+	Settings []PolicySetting
+}
+
+// PolicySetting is one key: value setting of a policy section.
+type PolicySetting struct {
+	Key   string
+	Value string
+}
+
+// LoadPolicy reads the policy file in root. A missing file is no policy.
+func LoadPolicy(root string) ([]PolicySection, error) {
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(PolicyPath)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", PolicyPath, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	var sections []PolicySection
+	top := doc.Content[0].Content
+	for i := 0; i+1 < len(top); i += 2 {
+		section := PolicySection{Name: top[i].Value}
+		if body := top[i+1]; body.Kind == yaml.MappingNode {
+			for j := 0; j+1 < len(body.Content); j += 2 {
+				if v := body.Content[j+1]; v.Kind == yaml.ScalarNode {
+					section.Settings = append(section.Settings, PolicySetting{Key: body.Content[j].Value, Value: v.Value})
+				}
+			}
+		}
+		sections = append(sections, section)
+	}
+	return sections, nil
+}
+
+// policyRules phrase the settings of the default policy file as
+// instructions; other settings are listed as they are.
+var policyRules = map[string]string{
+	"claim_required=true":            "Claim a task in Neona before working on it.",
+	"direct_main_write=false":        "Do not commit directly to the main branch; changes go through review.",
+	"autonomous_task_creation=false": "Do not create tasks on your own initiative.",
+	"secrets_access=false":           "Do not read or use secrets, credentials or other sensitive data.",
+	"speculative_changes=false":      "Do not make speculative changes outside the task's scope.",
+	"minimal_diff=true":              "Keep diffs minimal and avoid unrelated refactors.",
+	"evidence_required=true":         "Provide evidence that the task is complete.",
+	"test_evidence=true":             "Include test results or logs with completed work.",
+	"diff_required=true":             "Show the diff of what changed.",
+	"respect_locks=true":             "Respect file and module locks held by other agents.",
+	"bypass_tests=false":             "Never bypass tests or CI.",
+	"enforce_policy=true":            "Follow these policy constraints.",
+}
+
+// RuleNote is a memory item to include in exported rules. Items synced
+// from a rule file carry its path as Source.
+type RuleNote struct {
+	Content string
+	Source  string
+}
+
+// RuleTool is an MCP server that is always available to tasks.
+type RuleTool struct {
+	Name       string
+	Categories []string
+}
+
+// RulesExport is the Neona state rendered into an instruction file.
+type RulesExport struct {
+	Scope  string
+	Policy []PolicySection
+	Notes  []RuleNote
+	Tools  []RuleTool
+}
+
+// Markers around the generated block of a file without frontmatter.
+const (
+	rulesBegin = "<!-- neona:rules:begin -->"
+	rulesEnd   = "<!-- neona:rules:end -->"
+)
+
+// Render returns the rules in format f. Notes synced from f's own file or
+// from a generated file are left out, and so is a generated block in a
+// synced file, so rules exported for one agent do not echo back through
+// another's file.
+func (e RulesExport) Render(f RuleFormat) string {
+	var b strings.Builder
+	b.WriteString("# Neona project rules\n\n")
+	fmt.Fprintf(&b, "Generated by `neona export rules` from %s. Run it again to update; edits here are overwritten.\n", e.Scope)
+
+	if len(e.Policy) > 0 {
+		b.WriteString("\n## Policy\n")
+		for _, section := range e.Policy {
+			if len(section.Settings) == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, "\n### %s\n\n", humanize(section.Name))
+			for _, s := range section.Settings {
+				rule, ok := policyRules[s.Key+"="+s.Value]
+				if !ok {
+					rule = humanize(s.Key) + ": " + s.Value
+				}
+				fmt.Fprintf(&b, "- %s\n", rule)
+			}
+		}
+	}
+
+	if len(e.Tools) > 0 {
+		b.WriteString("\n## Tools\n\nThese MCP servers are always available to tasks:\n\n")
+		for _, t := range e.Tools {
+			if len(t.Categories) > 0 {
+				fmt.Fprintf(&b, "- %s (%s)\n", t.Name, strings.Join(t.Categories, ", "))
+			} else {
+				fmt.Fprintf(&b, "- %s\n", t.Name)
+			}
+		}
+	}
+
+	var notes []string
+	for _, n := range e.Notes {
+		content := strings.TrimSpace(stripGenerated(n.Content))
+		switch {
+		case n.Source == f.Path || isGeneratedFile(n.Source) || content == "":
+		case n.Source != "":
+			fmt.Fprintf(&b, "\n## From %s\n\n%s\n", n.Source, demoteHeadings(content))
+		default:
+			notes = append(notes, "- "+strings.ReplaceAll(content, "\n", "\n  "))
+		}
+	}
+	if len(notes) > 0 {
+		fmt.Fprintf(&b, "\n## Project knowledge\n\n%s\n", strings.Join(notes, "\n"))
+	}
+
+	if f.Frontmatter != "" {
+		return f.Frontmatter + "\n" + b.String()
+	}
+	return rulesBegin + "\n" + b.String() + rulesEnd + "\n"
+}
+
+// stripGenerated removes the generated block from a synced file.
+func stripGenerated(content string) string {
+	begin := strings.Index(content, rulesBegin)
+	end := strings.Index(content, rulesEnd)
+	if begin < 0 || end < begin {
+		return content
+	}
+	return content[:begin] + content[end+len(rulesEnd):]
+}
+
+func isGeneratedFile(path string) bool {
+	for _, f := range RuleFormats {
+		if f.Frontmatter != "" && f.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// demoteHeadings nests a synced file's Markdown headings under the section
+// it is rendered in.
+func demoteHeadings(content string) string {
+	lines := strings.Split(content, "\n")
+	fenced := false
+	for i, line := range lines {
+		if strings.HasPrefix(line, "```") {
+			fenced = !fenced
+		}
+		if !fenced && strings.HasPrefix(line, "#") {
+			lines[i] = "##" + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func humanize(key string) string {
+	s := strings.ReplaceAll(key, "_", " ")
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// Merge returns the file content after writing rendered into existing: a
+// generated file is replaced, and a marked block replaces the previous
+// block or is appended after the hand-written content.
+func (f RuleFormat) Merge(existing, rendered string) string {
+	if f.Frontmatter != "" {
+		return rendered
+	}
+	begin := strings.Index(existing, rulesBegin)
+	end := strings.Index(existing, rulesEnd)
+	if begin >= 0 && end > begin {
+		return existing[:begin] + rendered + strings.TrimPrefix(existing[end+len(rulesEnd):], "\n")
+	}
+	if strings.TrimSpace(existing) == "" {
+		return rendered
+	}
+	return strings.TrimRight(existing, "\n") + "\n\n" + rendered
+}
+
+// WriteRules renders e in format f into root, keeping any hand-written part
+// of the file. It reports whether the file changed.
+func WriteRules(root string, f RuleFormat, e RulesExport) (bool, error) {
+	p := filepath.Join(root, filepath.FromSlash(f.Path))
+	existing, err := os.ReadFile(p)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	content := f.Merge(string(existing), e.Render(f))
+	if content == string(existing) {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(p, []byte(content), 0o644)
+}
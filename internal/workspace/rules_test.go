@@ -0,0 +1,101 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindRuleFiles(t *testing.T) {
+	repo := newTestRepo(t)
+	os.MkdirAll(filepath.Join(repo, ".cursor", "rules"), 0o755)
+	os.WriteFile(filepath.Join(repo, "AGENTS.md"), []byte("Use pnpm"), 0o644)
+	os.WriteFile(filepath.Join(repo, ".cursor", "rules", "go.mdc"), []byte("gofmt"), 0o644)
+	os.WriteFile(filepath.Join(repo, "README.md"), []byte("not a rule file"), 0o644)
+	git(repo, "add", ".")
+	if _, err := git(repo, "commit", "-q", "-m", "rules"); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(repo, "AGENTS.md"), []byte("Use pnpm 9"), 0o644)
+	os.WriteFile(filepath.Join(repo, "CLAUDE.md"), []byte("uncommitted"), 0o644)
+
+	// Committed content by default, from any directory in the repository
+	files, src, err := FindRuleFiles(filepath.Join(repo, ".cursor"), false)
+	if err != nil {
+		t.Fatalf("FindRuleFiles: %v", err)
+	}
+	if src.Commit == "" || len(files) != 2 || files[0].Path != ".cursor/rules/go.mdc" || files[1].Content != "Use pnpm" {
+		t.Errorf("Expected the two committed files, got %+v from %+v", files, src)
+	}
+
+	files, src, err = FindRuleFiles(repo, true)
+	if err != nil {
+		t.Fatalf("FindRuleFiles(worktree): %v", err)
+	}
+	if src.Commit != "" || len(files) != 3 || files[1].Path != "AGENTS.md" || files[1].Content != "Use pnpm 9" {
+		t.Errorf("Expected the files on disk, got %+v", files)
+	}
+
+	// Outside git the directory is read from disk
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ".cursorrules"), []byte("No tabs"), 0o644)
+	if files, src, _ := FindRuleFiles(dir, false); len(files) != 1 || src.Root != dir || src.Commit != "" {
+		t.Errorf("Expected .cursorrules read from disk, got %+v from %+v", files, src)
+	}
+}
+
+func TestExportRules(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, ".ai"), 0o755)
+	os.WriteFile(filepath.Join(root, PolicyPath), []byte("task_execution:\n  claim_required: true\n  max_parallel: 3\nsafety:\n  secrets_access: false\n"), 0o644)
+	os.WriteFile(filepath.Join(root, "CLAUDE.md"), []byte("# Notes\n\nHand-written.\n"), 0o644)
+
+	policy, err := LoadPolicy(root)
+	if err != nil || len(policy) != 2 || policy[0].Settings[1] != (PolicySetting{Key: "max_parallel", Value: "3"}) {
+		t.Fatalf("Expected two policy sections in file order, got %+v (err=%v)", policy, err)
+	}
+	if formats := DetectRuleFormats(root); len(formats) != 1 || formats[0].Name != "claude" {
+		t.Errorf("Expected claude detected, got %+v", formats)
+	}
+
+	export := RulesExport{
+		Scope:  "project:web",
+		Policy: policy,
+		Tools:  []RuleTool{{Name: "filesystem", Categories: []string{"files"}}},
+		Notes: []RuleNote{
+			{Source: "AGENTS.md", Content: "# Build\nUse pnpm"},
+			{Source: "CLAUDE.md", Content: "Hand-written."},
+			{Content: "Staging needs the VPN"},
+		},
+	}
+	cursor := export.Render(RuleFormats["cursor"])
+	for _, want := range []string{"alwaysApply: true", "- Claim a task in Neona before working on it.", "- Max parallel: 3", "- filesystem (files)", "## From AGENTS.md\n\n### Build", "## From CLAUDE.md", "- Staging needs the VPN"} {
+		if !strings.Contains(cursor, want) {
+			t.Errorf("Expected the cursor rules to contain %q:\n%s", want, cursor)
+		}
+	}
+
+	// CLAUDE.md keeps its hand-written part and leaves out its own content
+	if changed, err := WriteRules(root, RuleFormats["claude"], export); err != nil || !changed {
+		t.Fatalf("WriteRules = %v, %v; want written", changed, err)
+	}
+	data, _ := os.ReadFile(filepath.Join(root, "CLAUDE.md"))
+	if !strings.HasPrefix(string(data), "# Notes\n\nHand-written.\n\n"+rulesBegin) || strings.Contains(string(data), "From CLAUDE.md") {
+		t.Errorf("Expected the rules appended after the hand-written part:\n%s", data)
+	}
+	if changed, _ := WriteRules(root, RuleFormats["claude"], export); changed {
+		t.Error("Expected an unchanged export to leave the file alone")
+	}
+
+	// Syncing the file back does not echo the generated block
+	export.Notes = []RuleNote{{Source: "CLAUDE.md", Content: string(data)}}
+	if cursor := export.Render(RuleFormats["cursor"]); strings.Count(cursor, "## Policy") != 1 || !strings.Contains(cursor, "Hand-written.") {
+		t.Errorf("Expected the synced CLAUDE.md without its generated block:\n%s", cursor)
+	}
+	export.Notes = nil
+	WriteRules(root, RuleFormats["claude"], export)
+	if data, _ := os.ReadFile(filepath.Join(root, "CLAUDE.md")); strings.Count(string(data), rulesBegin) != 1 || strings.Contains(string(data), "VPN") {
+		t.Errorf("Expected the block replaced in place:\n%s", data)
+	}
+}
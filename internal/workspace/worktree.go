@@ -0,0 +1,183 @@
+package workspace
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Preserve policies for worktrees of finished tasks.
+const (
+	PreserveNever  = "never"  // always remove the worktree
+	PreserveFailed = "failed" // keep it when the task failed
+	PreserveAlways = "always" // never remove it
+)
+
+// WorktreeConfig configures per-task git worktrees.
+type WorktreeConfig struct {
+	// Repo is the base repository worktrees are created from.
+	Repo string
+	// Dir is where worktrees are created, one subdirectory per task.
+	Dir string
+	// BaseRef is the commit-ish new branches start from (default HEAD).
+	BaseRef string
+	// BranchPrefix is prepended to task branch names (default "neona/").
+	BranchPrefix string
+	// Preserve is PreserveNever, PreserveFailed (default) or PreserveAlways.
+	Preserve string
+}
+
+// Worktree is a task's checkout.
+type Worktree struct {
+	TaskID string `json:"task_id"`
+	Path   string `json:"path"`
+	Branch string `json:"branch"`
+	Base   string `json:"base"`
+}
+
+// WorktreeManager provisions and removes per-task git worktrees so agents
+// can work on one repository in parallel without sharing a checkout.
+type WorktreeManager struct {
+	cfg WorktreeConfig
+}
+
+// NewWorktreeManager validates cfg and creates the worktree directory.
+func NewWorktreeManager(cfg WorktreeConfig) (*WorktreeManager, error) {
+	if cfg.BaseRef == "" {
+		cfg.BaseRef = "HEAD"
+	}
+	if cfg.BranchPrefix == "" {
+		cfg.BranchPrefix = "neona/"
+	}
+	switch cfg.Preserve {
+	case "":
+		cfg.Preserve = PreserveFailed
+	case PreserveNever, PreserveFailed, PreserveAlways:
+	default:
+		return nil, fmt.Errorf("unknown worktree preserve policy %q (want never, failed or always)", cfg.Preserve)
+	}
+
+	repo, err := filepath.Abs(cfg.Repo)
+	if err != nil {
+		return nil, err
+	}
+	top, err := git(repo, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("worktree repo %s: %w", cfg.Repo, err)
+	}
+	cfg.Repo = top
+	if _, err := git(cfg.Repo, "rev-parse", "--verify", cfg.BaseRef+"^{commit}"); err != nil {
+		return nil, fmt.Errorf("worktree base %s: %w", cfg.BaseRef, err)
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create worktree dir: %w", err)
+	}
+	if cfg.Dir, err = realDir(cfg.Dir); err != nil {
+		return nil, err
+	}
+	return &WorktreeManager{cfg: cfg}, nil
+}
+
+// Dir returns the directory holding the worktrees.
+func (m *WorktreeManager) Dir() string {
+	return m.cfg.Dir
+}
+
+// Lookup returns the worktree a task would use, without creating it.
+func (m *WorktreeManager) Lookup(taskID string) *Worktree {
+	return &Worktree{
+		TaskID: taskID,
+		Path:   filepath.Join(m.cfg.Dir, taskID),
+		Branch: m.cfg.BranchPrefix + shortID(taskID),
+		Base:   m.cfg.BaseRef,
+	}
+}
+
+// Provision returns the task's worktree, creating it and its branch from
+// BaseRef if needed. An existing worktree (e.g. from an earlier claim of
+// the same task) is reused as is.
+func (m *WorktreeManager) Provision(taskID string) (*Worktree, error) {
+	wt := m.Lookup(taskID)
+	if _, err := os.Stat(filepath.Join(wt.Path, ".git")); err == nil {
+		return wt, nil
+	}
+
+	// Forget worktrees whose directories were deleted by hand
+	if _, err := git(m.cfg.Repo, "worktree", "prune"); err != nil {
+		return nil, err
+	}
+
+	// The branch survives worktree removal, so re-attach it if present
+	args := []string{"worktree", "add", "-b", wt.Branch, wt.Path, wt.Base}
+	if _, err := git(m.cfg.Repo, "rev-parse", "--verify", "refs/heads/"+wt.Branch); err == nil {
+		args = []string{"worktree", "add", wt.Path, wt.Branch}
+	}
+	if _, err := git(m.cfg.Repo, args...); err != nil {
+		return nil, fmt.Errorf("create worktree for task %s: %w", taskID, err)
+	}
+	return wt, nil
+}
+
+// Commits returns how many commits the task's branch has beyond its base.
+func (m *WorktreeManager) Commits(wt *Worktree) (int, error) {
+	out, err := git(m.cfg.Repo, "rev-list", "--count", wt.Base+".."+wt.Branch)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(out)
+}
+
+// Finish applies the preserve policy to a finished task's worktree. It
+// returns true if the worktree was removed. The branch is deleted with it
+// only when it has no commits beyond its base, so work is never lost.
+func (m *WorktreeManager) Finish(taskID string, succeeded bool) (bool, error) {
+	wt := m.Lookup(taskID)
+	if _, err := os.Stat(wt.Path); os.IsNotExist(err) {
+		return false, nil
+	}
+	if m.cfg.Preserve == PreserveAlways || (m.cfg.Preserve == PreserveFailed && !succeeded) {
+		return false, nil
+	}
+
+	if _, err := git(m.cfg.Repo, "worktree", "remove", "--force", wt.Path); err != nil {
+		return false, fmt.Errorf("remove worktree for task %s: %w", taskID, err)
+	}
+	if n, err := m.Commits(wt); err == nil && n == 0 {
+		if _, err := git(m.cfg.Repo, "branch", "-D", wt.Branch); err != nil {
+			return true, fmt.Errorf("delete branch %s: %w", wt.Branch, err)
+		}
+	}
+	return true, nil
+}
+
+// git runs a git command in dir and returns its trimmed stdout.
+func git(dir string, args ...string) (string, error) {
+	out, err := gitRaw(dir, args...)
+	return strings.TrimSpace(out), err
+}
+
+// gitRaw runs a git command in dir and returns its stdout as is.
+func gitRaw(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+func shortID(id string) string {
+	if len(id) <= 8 {
+		return id
+	}
+	return id[:8]
+}
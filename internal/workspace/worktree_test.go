@@ -0,0 +1,120 @@
+package workspace
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// newTestRepo creates a repository with one commit.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"commit", "-q", "--allow-empty", "-m", "initial"},
+	} {
+		if _, err := git(repo, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repo
+}
+
+func TestWorktreeLifecycle(t *testing.T) {
+	repo := newTestRepo(t)
+	m, err := NewWorktreeManager(WorktreeConfig{Repo: repo, Dir: filepath.Join(t.TempDir(), "wt")})
+	if err != nil {
+		t.Fatalf("NewWorktreeManager: %v", err)
+	}
+
+	wt, err := m.Provision("11111111-aaaa")
+	if err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+	if wt.Branch != "neona/11111111" || filepath.Dir(wt.Path) != m.Dir() {
+		t.Errorf("Unexpected worktree: %+v", wt)
+	}
+	if branch, _ := git(wt.Path, "branch", "--show-current"); branch != wt.Branch {
+		t.Errorf("Worktree on branch %q, want %q", branch, wt.Branch)
+	}
+
+	// Provisioning again reuses the checkout
+	os.WriteFile(filepath.Join(wt.Path, "work.txt"), []byte("wip"), 0o644)
+	if _, err := m.Provision("11111111-aaaa"); err != nil {
+		t.Fatalf("re-Provision: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(wt.Path, "work.txt")); err != nil {
+		t.Error("Expected re-provision to keep the existing checkout")
+	}
+
+	git(wt.Path, "add", "work.txt")
+	if _, err := git(wt.Path, "commit", "-q", "-m", "work"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := m.Commits(wt); err != nil || n != 1 {
+		t.Errorf("Commits = %d, %v; want 1", n, err)
+	}
+
+	// Failed tasks keep their worktree under the default policy
+	if removed, err := m.Finish("11111111-aaaa", false); err != nil || removed {
+		t.Errorf("Finish(failed) = %v, %v; want preserved", removed, err)
+	}
+	if removed, err := m.Finish("11111111-aaaa", true); err != nil || !removed {
+		t.Fatalf("Finish(succeeded) = %v, %v; want removed", removed, err)
+	}
+	if _, err := os.Stat(wt.Path); !os.IsNotExist(err) {
+		t.Error("Expected worktree directory to be removed")
+	}
+	if _, err := git(repo, "rev-parse", "--verify", "refs/heads/"+wt.Branch); err != nil {
+		t.Error("Expected branch with commits to be kept")
+	}
+
+	// The kept branch is re-attached on the next claim
+	if _, err := m.Provision("11111111-aaaa"); err != nil {
+		t.Fatalf("Provision after removal: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(wt.Path, "work.txt")); err != nil {
+		t.Error("Expected re-attached branch to contain earlier commits")
+	}
+}
+
+func TestWorktreeFinishDeletesEmptyBranch(t *testing.T) {
+	repo := newTestRepo(t)
+	m, err := NewWorktreeManager(WorktreeConfig{Repo: repo, Dir: filepath.Join(t.TempDir(), "wt"), Preserve: PreserveNever})
+	if err != nil {
+		t.Fatalf("NewWorktreeManager: %v", err)
+	}
+	wt, err := m.Provision("22222222-bbbb")
+	if err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+	if removed, err := m.Finish("22222222-bbbb", false); err != nil || !removed {
+		t.Fatalf("Finish = %v, %v; want removed", removed, err)
+	}
+	if _, err := git(repo, "rev-parse", "--verify", "refs/heads/"+wt.Branch); err == nil {
+		t.Error("Expected branch without commits to be deleted")
+	}
+}
+
+func TestNewWorktreeManagerValidates(t *testing.T) {
+	repo := newTestRepo(t)
+	if _, err := NewWorktreeManager(WorktreeConfig{Repo: t.TempDir(), Dir: t.TempDir()}); err == nil {
+		t.Error("Expected error for a directory that is not a repository")
+	}
+	if _, err := NewWorktreeManager(WorktreeConfig{Repo: repo, Dir: t.TempDir(), BaseRef: "no-such-ref"}); err == nil {
+		t.Error("Expected error for unknown base ref")
+	}
+	if _, err := NewWorktreeManager(WorktreeConfig{Repo: repo, Dir: t.TempDir(), Preserve: "sometimes"}); err == nil {
+		t.Error("Expected error for unknown preserve policy")
+	}
+}
@@ -3,6 +3,7 @@
 Mirrors the Go TUI client (internal/tui/client.go) for API compatibility.
 """
 
+import os
 import socket
 import httpx
 from dataclasses import dataclass
@@ -89,16 +90,20 @@ class NeonaClient:
     """
     
     DEFAULT_TIMEOUT = 10.0
-    DEFAULT_TTL_SEC = 300  # 5 minutes, same as Go
+    DEFAULT_TTL_SEC = 0  # the daemon's default, from its claim config (GET /config)
     
-    def __init__(self, base_url: str = "http://127.0.0.1:7466"):
+    def __init__(self, base_url: str = "http://127.0.0.1:7466", api_key: Optional[str] = None):
         """Initialize client with base URL.
         
         Args:
             base_url: Base URL of Neona daemon (default: http://127.0.0.1:7466)
+            api_key: API key for daemons started with --api-keys (default: $NEONA_API_KEY)
         """
         self.base_url = base_url
-        self.client = httpx.AsyncClient(base_url=base_url, timeout=self.DEFAULT_TIMEOUT)
+        if api_key is None:
+            api_key = os.environ.get("NEONA_API_KEY", "")
+        headers = {"Authorization": f"Bearer {api_key}"} if api_key else {}
+        self.client = httpx.AsyncClient(base_url=base_url, timeout=self.DEFAULT_TIMEOUT, headers=headers)
         # Generate holder_id same as Go TUI: "tui@<hostname>"
         self.holder_id = f"tui@{socket.gethostname()}"
     
@@ -231,7 +236,7 @@ class NeonaClient:
         
         Args:
             task_id: Task ID to claim
-            ttl_sec: Lease TTL in seconds (default: 300)
+            ttl_sec: Lease TTL in seconds (default: 0, the daemon's default)
             
         Returns:
             Lease info from daemon
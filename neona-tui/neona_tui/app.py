@@ -1,5 +1,7 @@
 """Main Textual application for Neona TUI."""
 
+import os
+
 from textual.app import App, ComposeResult
 from textual.containers import Container, Vertical, Horizontal
 from textual.widgets import Header, Footer, Static, Input, DataTable
@@ -9,6 +11,9 @@ from rich.text import Text
 
 from .api_client import NeonaClient, NeonaAPIError, HealthResponse
 
+# Commands that change tasks, refused in read-only mode (neona tui --read-only)
+MUTATING_COMMANDS = {"add", "claim", "release", "run", "note"}
+
 
 class StatusBar(Static):
     """Custom status bar showing daemon status and version."""
@@ -102,6 +107,9 @@ class NeonaTUI(App):
         self.tasks: list[dict] = []
         self.message = ""
         self.last_health = HealthResponse(ok=False, db="", version="", time="")
+        self.read_only = os.environ.get("NEONA_TUI_READ_ONLY") == "1"
+        if self.read_only:
+            self.sub_title = "Read-only"
     
     def compose(self) -> ComposeResult:
         """Create child widgets for the app."""
@@ -233,6 +241,10 @@ class NeonaTUI(App):
         action = parts[0].lower()
         args_str = parts[1] if len(parts) > 1 else ""
         
+        if self.read_only and action in MUTATING_COMMANDS:
+            self.show_message(f"Read-only mode: {action} is disabled", error=True)
+            return
+        
         try:
             if action == "add":
                 await self.cmd_add(args_str)
@@ -0,0 +1,275 @@
+// Package client is a Go client for the Neona daemon's HTTP API, for tools
+// and CI scripts that coordinate work through Neona:
+//
+//	c, err := client.NewFromEnv()
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	task, err := c.CreateTask(client.CreateTaskRequest{Title: "Build"})
+//	...
+//	lease, err := c.Claim(task.ID, "ci/build-42", 0)
+//	...
+//	run, err := c.Run(lease, client.RunRequest{Command: "go", Args: []string{"test", "./..."}})
+//	...
+//	err = c.Complete(lease)
+//
+// The client reaches the daemon the way the neona CLI does: it honors
+// NEONA_API, NEONA_API_KEY, NEONA_API_TIMEOUT and NEONA_API_RETRIES, and
+// retries idempotent requests that fail transiently.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/fentz26/neona/internal/apiclient"
+)
+
+// Config configures a client: the API address, API key, the timeout of each
+// request attempt and how many times idempotent requests are retried.
+type Config = apiclient.Config
+
+// ConfigFromEnv returns the default config overridden by the NEONA_API*
+// environment variables.
+func ConfigFromEnv() (Config, error) {
+	return apiclient.FromEnv()
+}
+
+// Error codes of an APIError; see IsNotFound and friends.
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeTooLarge         = "too_large"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal"
+	// CodeCommandDenied is a 403 for a command outside the daemon's
+	// allowlist; its Body decodes as a CommandDenied.
+	CodeCommandDenied = "command_denied"
+	// CodeAmbiguousID is a 409 for a short task ID that more than one task
+	// starts with; the Message lists them.
+	CodeAmbiguousID = "ambiguous_id"
+)
+
+// APIError is returned for responses with a 4xx or 5xx status.
+type APIError struct {
+	StatusCode int
+	// Code classifies the error, e.g. CodeNotFound. Daemons that predate
+	// error codes get the code implied by the status.
+	Code string
+	// Message is the daemon's description of the error.
+	Message string
+	// Body is the raw response body.
+	Body string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (%d): %s", e.StatusCode, e.Message)
+}
+
+// newAPIError parses an error response, a JSON {"error", "code"} object or
+// plain text.
+func newAPIError(status int, body []byte) *APIError {
+	e := &APIError{StatusCode: status, Body: strings.TrimSpace(string(body))}
+	var resp struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	if json.Unmarshal(body, &resp) == nil && resp.Error != "" {
+		e.Message, e.Code = resp.Error, resp.Code
+	} else {
+		e.Message = e.Body
+	}
+	if e.Code == "" {
+		e.Code = statusCode(status)
+	}
+	return e
+}
+
+// statusCode returns the error code implied by an HTTP status.
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	default:
+		return CodeInternal
+	}
+}
+
+// ErrorCode returns the code of the APIError in err's chain, or "" if
+// there is none.
+func ErrorCode(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+// IsNotFound reports whether err is an APIError for a missing resource.
+func IsNotFound(err error) bool { return ErrorCode(err) == CodeNotFound }
+
+// IsConflict reports whether err is an APIError for a request that
+// conflicts with the resource's state, such as claiming a claimed task.
+func IsConflict(err error) bool { return ErrorCode(err) == CodeConflict }
+
+// IsUnauthorized reports whether err is an APIError for a missing or
+// invalid API key or token.
+func IsUnauthorized(err error) bool { return ErrorCode(err) == CodeUnauthorized }
+
+// IsForbidden reports whether err is an APIError for a request the caller
+// may not make, such as acting on another holder's lease or running a
+// denied command.
+func IsForbidden(err error) bool {
+	code := ErrorCode(err)
+	return code == CodeForbidden || code == CodeCommandDenied
+}
+
+// Client is a typed client for the daemon's HTTP API. It is safe for
+// concurrent use.
+type Client struct {
+	// BaseURL prefixes request paths, e.g. http://127.0.0.1:7466.
+	BaseURL string
+	HTTP    *http.Client
+	// Header is added to every request.
+	Header http.Header
+}
+
+// New returns a client configured by cfg.
+func New(cfg Config) *Client {
+	httpClient, base := apiclient.NewClient(cfg)
+	return &Client{BaseURL: base, HTTP: httpClient, Header: http.Header{}}
+}
+
+// NewFromEnv returns a client configured by ConfigFromEnv.
+func NewFromEnv() (*Client, error) {
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return New(cfg), nil
+}
+
+// WithToken returns a copy of the client that sends token as its bearer
+// token instead of the configured API key, e.g. the admin token for
+// ForceRelease.
+func (c *Client) WithToken(token string) *Client {
+	cp := *c
+	cp.Header = c.Header.Clone()
+	cp.Header.Set("Authorization", "Bearer "+token)
+	return &cp
+}
+
+// Raw sends a request with body as its JSON payload, if non-nil, and
+// returns the response body. Transport failures are wrapped, so errors.As
+// still finds the underlying *net.OpError.
+func (c *Client) Raw(method, path string, body []byte, header http.Header) ([]byte, error) {
+	_, data, err := c.send(method, path, body, header)
+	return data, err
+}
+
+// Do sends body as JSON and decodes the response into out, if both are
+// non-nil. It returns the response status, with an *APIError for 4xx and
+// 5xx responses.
+func (c *Client) Do(method, path string, body, out interface{}) (int, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return 0, err
+		}
+	}
+	resp, respBody, err := c.send(method, path, data, nil)
+	if resp == nil {
+		return 0, err
+	}
+	if err == nil {
+		err = decode(method, path, respBody, out)
+	}
+	return resp.StatusCode, err
+}
+
+// send performs a request and reads the whole response body. The returned
+// response is non-nil whenever the daemon answered.
+func (c *Client) send(method, path string, body []byte, header http.Header) (*http.Response, []byte, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.BaseURL+path, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp, nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return resp, data, newAPIError(resp.StatusCode, data)
+	}
+	return resp, data, nil
+}
+
+// post sends a POST with an optional Idempotency-Key.
+func (c *Client) post(path string, body interface{}, idempotencyKey string, out interface{}) error {
+	if idempotencyKey == "" {
+		_, err := c.Do(http.MethodPost, path, body, out)
+		return err
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	_, resp, err := c.send(http.MethodPost, path, data, http.Header{"Idempotency-Key": {idempotencyKey}})
+	if err != nil {
+		return err
+	}
+	return decode(http.MethodPost, path, resp, out)
+}
+
+func decode(method, path string, data []byte, out interface{}) error {
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decode %s %s: %w", method, path, err)
+	}
+	return nil
+}
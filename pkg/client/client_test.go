@@ -0,0 +1,229 @@
+package client_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fentz26/neona/internal/testutil"
+	"github.com/fentz26/neona/pkg/client"
+)
+
+func newClient(d *testutil.Daemon) *client.Client {
+	return client.New(client.Config{Addr: d.URL, Timeout: 5 * time.Second})
+}
+
+func TestTaskLifecycle(t *testing.T) {
+	d := testutil.StartDaemon(t, testutil.Options{AdminToken: "admin"})
+	c := newClient(d)
+
+	health, err := c.Health()
+	if err != nil || !health.OK {
+		t.Fatalf("Health = %+v, %v", health, err)
+	}
+
+	task, err := c.CreateTask(client.CreateTaskRequest{Title: "Build", IdempotencyKey: "build-1"})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	again, err := c.CreateTask(client.CreateTaskRequest{Title: "Build", IdempotencyKey: "build-1"})
+	if err != nil || again.ID != task.ID {
+		t.Fatalf("CreateTask replay = %v, %v; want task %s", again, err, task.ID)
+	}
+	if _, err := c.AddChecklistItems(task.ID, "tests pass"); err != nil {
+		t.Fatalf("AddChecklistItems failed: %v", err)
+	}
+	if stats, err := c.Stats(); err != nil || stats.Tasks["pending"] != 1 || stats.Scheduler != "disabled" {
+		t.Fatalf("Stats = %+v, %v", stats, err)
+	}
+
+	res, err := c.ClaimNext("ci/1", "", "", 0)
+	if err != nil || res == nil || res.Task.ID != task.ID {
+		t.Fatalf("ClaimNext = %+v, %v; want task %s", res, err, task.ID)
+	}
+	lease := res.Lease
+	if err := c.Heartbeat(lease, 60); err != nil {
+		t.Fatalf("Heartbeat failed: %v", err)
+	}
+
+	plan, err := c.PlanRun(lease, client.RunRequest{Command: "go", Args: []string{"test"}})
+	if err != nil || !plan.DryRun || plan.Command != "go" || !plan.Capabilities.Stdin {
+		t.Fatalf("PlanRun = %+v, %v", plan, err)
+	}
+	if _, err := c.Run(lease, client.RunRequest{Command: "go", Args: []string{"test"}}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if _, err := c.RecordRun(lease, client.RecordedRun{Command: "make", ExitCode: 2}); err != nil {
+		t.Fatalf("RecordRun failed: %v", err)
+	}
+	runs, total, err := c.Logs(task.ID, 1, 0)
+	if err != nil || len(runs) != 1 || total != 2 || runs[0].Command != "make" {
+		t.Fatalf("Logs = %d runs of %d, %v; want the newest of 2", len(runs), total, err)
+	}
+
+	items, err := c.Checklist(task.ID)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("Checklist = %v, %v", items, err)
+	}
+	if item, err := c.CheckItem(task.ID, items[0].ID, true, "ci/1"); err != nil || !item.Done {
+		t.Fatalf("CheckItem = %+v, %v", item, err)
+	}
+	if _, err := c.Comment(task.ID, "ci/1", "green"); err != nil {
+		t.Fatalf("Comment failed: %v", err)
+	}
+	if comments, err := c.Comments(task.ID, time.Time{}); err != nil || len(comments) != 1 {
+		t.Fatalf("Comments = %v, %v", comments, err)
+	}
+	if err := c.Complete(lease); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+
+	view, err := c.TaskView(task.ID, []string{"all"}, 0, 0)
+	if err != nil || view.Status != client.TaskStatusCompleted || view.RunCount == nil || *view.RunCount != 2 {
+		t.Fatalf("TaskView = %+v, %v", view, err)
+	}
+	if len(view.History) == 0 {
+		t.Error("TaskView has no history")
+	}
+}
+
+func TestRunPipeline(t *testing.T) {
+	d := testutil.StartDaemon(t, testutil.Options{})
+	c := newClient(d)
+
+	task, err := c.CreateTask(client.CreateTaskRequest{Title: "CI", Steps: []client.RunStep{
+		{Command: "go", Args: []string{"vet", "./..."}},
+		{Command: "go", Args: []string{"test", "./..."}},
+	}})
+	if err != nil || len(task.Steps) != 2 {
+		t.Fatalf("CreateTask = %+v, %v", task, err)
+	}
+	lease, err := c.Claim(task.ID, "ci/1", 0)
+	if err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	res, err := c.RunPipeline(lease, nil)
+	if err != nil || res.Status != client.TaskStatusCompleted || len(res.Runs) != 2 || res.Runs[1].Args[0] != "test" {
+		t.Fatalf("RunPipeline = %+v, %v", res, err)
+	}
+}
+
+func TestDaemonConfig(t *testing.T) {
+	d := testutil.StartDaemon(t, testutil.Options{})
+	c := newClient(d)
+
+	cfg, err := c.DaemonConfig()
+	if err != nil || cfg.Claims.LeaseTTLSec != client.DefaultLeaseTTLSec || cfg.Claims.HeartbeatSec != client.DefaultLeaseTTLSec/3 {
+		t.Fatalf("DaemonConfig = %+v, %v", cfg, err)
+	}
+	task, _ := c.CreateTask(client.CreateTaskRequest{Title: "Deploy", Labels: []string{"project:web"}})
+	lease, err := c.Claim(task.ID, "ci/1", 0)
+	if err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	if want := cfg.Claims.For(client.TaskProject(task)).LeaseTTLSec; lease.TTLSec != want {
+		t.Errorf("Claim TTL = %d, want the daemon's %d", lease.TTLSec, want)
+	}
+}
+
+func TestRetryRun(t *testing.T) {
+	d := testutil.StartDaemon(t, testutil.Options{})
+	c := newClient(d)
+
+	task, _ := c.CreateTask(client.CreateTaskRequest{Title: "Flaky"})
+	lease, err := c.Claim(task.ID, "ci/1", 0)
+	if err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	run, err := c.Run(lease, client.RunRequest{Command: "go", Args: []string{"test", "./..."}})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	retry, err := c.RetryRun(lease, run.ID, nil)
+	if err != nil || retry.RetryOf != run.ID || retry.Command != "go" || retry.Args[0] != "test" {
+		t.Fatalf("RetryRun = %+v, %v", retry, err)
+	}
+	if _, err := c.RetryRun(lease, "missing", nil); !client.IsNotFound(err) {
+		t.Errorf("RetryRun(missing) error = %v, want not found", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	d := testutil.StartDaemon(t, testutil.Options{AdminToken: "admin"})
+	c := newClient(d)
+
+	_, err := c.Task("missing")
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || !client.IsNotFound(err) {
+		t.Fatalf("Task(missing) error = %v, want a 404 APIError", err)
+	}
+	if apiErr.Message != "task not found" {
+		t.Errorf("Message = %q, want the daemon's message without the JSON", apiErr.Message)
+	}
+
+	if res, err := c.ClaimNext("ci/1", "", "", 0); err != nil || res != nil {
+		t.Fatalf("ClaimNext with nothing pending = %+v, %v; want nil", res, err)
+	}
+
+	task, _ := c.CreateTask(client.CreateTaskRequest{Title: "Stuck"})
+	if _, err := c.Claim(task.ID, "ci/1", 0); err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	if _, err := c.Claim(task.ID, "ci/2", 0); !client.IsConflict(err) {
+		t.Fatalf("Claim of a claimed task = %v, want a conflict", err)
+	}
+	if _, err := c.ForceRelease(task.ID, "ops", "stuck"); !client.IsUnauthorized(err) {
+		t.Fatalf("ForceRelease without the admin token = %v, want 401", err)
+	}
+	res, err := c.WithToken("admin").ForceRelease(task.ID, "ops", "stuck")
+	if err != nil || res.PreviousHolder != "ci/1" {
+		t.Fatalf("ForceRelease = %+v, %v", res, err)
+	}
+	events, err := c.Events("ci/1", time.Time{}, 0)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("Events = %v, %v; want the force-release", events, err)
+	}
+}
+
+func TestAPIErrorPlainText(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "go away", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	_, err := client.New(client.Config{Addr: srv.URL}).Task("t1")
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "go away" || !client.IsForbidden(err) {
+		t.Fatalf("error = %#v, want a forbidden APIError from the status", err)
+	}
+	if client.IsNotFound(err) || client.ErrorCode(errors.New("offline")) != "" {
+		t.Error("error kinds matched an unrelated error")
+	}
+}
+
+func TestMemory(t *testing.T) {
+	d := testutil.StartDaemon(t, testutil.Options{})
+	c := newClient(d)
+
+	item, err := c.AddMemory(client.MemoryRequest{Content: "use make test", Scope: "project:web"})
+	if err != nil {
+		t.Fatalf("AddMemory failed: %v", err)
+	}
+	dup, err := c.AddMemory(client.MemoryRequest{Content: "use make test", Scope: "project:web"})
+	if err != nil || !dup.Duplicate || dup.ID != item.ID {
+		t.Fatalf("AddMemory duplicate = %+v, %v", dup, err)
+	}
+	if items, err := c.Memory("make", "project:web"); err != nil || len(items) != 1 {
+		t.Fatalf("Memory = %v, %v", items, err)
+	}
+	if p, err := c.PromoteMemory(item.ID, "global"); err != nil || p.Scope != "global" {
+		t.Fatalf("PromoteMemory = %+v, %v", p, err)
+	}
+
+	res, err := c.SyncRuleFiles("web", []client.RuleFile{{Path: "AGENTS.md", Content: "# Rules"}}, false)
+	if err != nil || res.Stale != 1 || res.Files[0].Status != "added" {
+		t.Fatalf("SyncRuleFiles = %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// MemoryRequest is the body of POST /memory.
+type MemoryRequest struct {
+	TaskID  string `json:"task_id,omitempty"`
+	Content string `json:"content"`
+	// Tags is comma-separated.
+	Tags string `json:"tags,omitempty"`
+	// Scope is global, project:<name> or task:<id>; it defaults to the
+	// task's scope, or global without a task.
+	Scope string `json:"scope,omitempty"`
+}
+
+// AddMemory adds a memory item. Content already stored in the scope is not
+// added again: the existing item is returned with Duplicate set.
+func (c *Client) AddMemory(req MemoryRequest) (*MemoryItem, error) {
+	var item MemoryItem
+	if _, err := c.Do(http.MethodPost, "/memory", req, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// Memory searches memory for query, in all scopes or only those given.
+// An empty query lists the newest items.
+func (c *Client) Memory(query string, scopes ...string) ([]MemoryItem, error) {
+	q := url.Values{}
+	if query != "" {
+		q.Set("q", query)
+	}
+	if len(scopes) > 0 {
+		q.Set("scope", strings.Join(scopes, ","))
+	}
+	path := "/memory"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var items []MemoryItem
+	if _, err := c.Do(http.MethodGet, path, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// PromoteMemory moves a memory item to a wider scope.
+func (c *Client) PromoteMemory(id, scope string) (*MemoryItem, error) {
+	var item MemoryItem
+	body := map[string]string{"scope": scope}
+	if _, err := c.Do(http.MethodPost, "/memory/"+id+"/promote", body, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// SyncRuleFiles makes the project's memory reflect files, which must be the
+// project's complete set of rule files. With dryRun nothing is written and
+// the result says what is stale.
+func (c *Client) SyncRuleFiles(project string, files []RuleFile, dryRun bool) (*RuleSyncResult, error) {
+	var res RuleSyncResult
+	body := map[string]interface{}{"project": project, "files": files, "dry_run": dryRun}
+	if _, err := c.Do(http.MethodPost, "/memory/sync", body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
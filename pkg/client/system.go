@@ -0,0 +1,118 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Health checks the daemon. A daemon that answered but is unhealthy, e.g.
+// with its database unavailable, returns its health report along with an
+// *APIError.
+func (c *Client) Health() (*HealthResponse, error) {
+	resp, data, err := c.send(http.MethodGet, "/health", nil, nil)
+	if resp == nil {
+		return nil, err
+	}
+	var health HealthResponse
+	if jsonErr := json.Unmarshal(data, &health); jsonErr != nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to parse health response: %w", jsonErr)
+	}
+	return &health, err
+}
+
+// Workers returns the state of the daemon's scheduler worker pool.
+func (c *Client) Workers() (*WorkersStats, error) {
+	var stats WorkersStats
+	if _, err := c.Do(http.MethodGet, "/workers", nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Stats summarizes the task queue and the scheduler's state.
+func (c *Client) Stats() (*Stats, error) {
+	var stats Stats
+	if _, err := c.Do(http.MethodGet, "/stats", nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// DaemonConfig returns the daemon's lease TTLs and claim limits.
+func (c *Client) DaemonConfig() (*DaemonConfig, error) {
+	var cfg DaemonConfig
+	if _, err := c.Do(http.MethodGet, "/config", nil, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Scripts lists the daemon's script library.
+func (c *Client) Scripts() (*ScriptLibrary, error) {
+	var lib ScriptLibrary
+	if _, err := c.Do(http.MethodGet, "/scripts", nil, &lib); err != nil {
+		return nil, err
+	}
+	return &lib, nil
+}
+
+// CloudSyncStatus reports the state of the daemon's neona.app cloud sync.
+func (c *Client) CloudSyncStatus() (*CloudSyncStatus, error) {
+	var status CloudSyncStatus
+	if _, err := c.Do(http.MethodGet, "/cloud/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Route asks the daemon which MCP servers it would route a task with this
+// title and description to.
+func (c *Client) Route(title, description string) (*Route, error) {
+	var route Route
+	body := map[string]string{"title": title, "description": description}
+	if _, err := c.Do(http.MethodPost, "/mcp/route", body, &route); err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
+// Events lists notifications for holder after since; a zero since and a
+// limit of 0 use the daemon's defaults.
+func (c *Client) Events(holder string, since time.Time, limit int) ([]Event, error) {
+	q := url.Values{"holder": {holder}}
+	if !since.IsZero() {
+		q.Set("since", since.Format(time.RFC3339Nano))
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var events []Event
+	if _, err := c.Do(http.MethodGet, "/events?"+q.Encode(), nil, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Metrics returns the daemon's metrics in the Prometheus text format.
+func (c *Client) Metrics() (string, error) {
+	data, err := c.Raw(http.MethodGet, "/metrics", nil, nil)
+	return string(data), err
+}
+
+// ForceRelease releases a task as an administrator, whoever holds it. It
+// requires a client made with WithToken and the daemon's admin token.
+func (c *Client) ForceRelease(taskID, actor, reason string) (*ForceReleaseResult, error) {
+	var res ForceReleaseResult
+	body := map[string]string{"actor": actor, "reason": reason}
+	if _, err := c.Do(http.MethodPost, "/admin/tasks/"+taskID+"/force-release", body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
@@ -0,0 +1,361 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CreateTaskRequest is the body of POST /tasks.
+type CreateTaskRequest struct {
+	Title string `json:"title"`
+	// Description may open with YAML frontmatter setting the fields below.
+	Description string   `json:"description,omitempty"`
+	MutexKey    string   `json:"mutex_key,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+	Connector   string   `json:"connector,omitempty"`
+	WorkDir     string   `json:"workdir,omitempty"`
+
+	AcceptanceCriteria []string   `json:"acceptance_criteria,omitempty"`
+	Commands           []string   `json:"commands,omitempty"`
+	Steps              []RunStep  `json:"steps,omitempty"`
+	ParentID           string     `json:"parent_id,omitempty"`
+	Priority           int        `json:"priority,omitempty"`
+	EstimateSec        int        `json:"estimate_sec,omitempty"`
+	DueAt              *time.Time `json:"due_at,omitempty"`
+	NotBefore          *time.Time `json:"not_before,omitempty"`
+
+	// IdempotencyKey, when set, makes retries of the request within 24
+	// hours return the task created by the first one.
+	IdempotencyKey string `json:"-"`
+}
+
+// CreateTask creates a task.
+func (c *Client) CreateTask(req CreateTaskRequest) (*Task, error) {
+	var task Task
+	if err := c.post("/tasks", req, req.IdempotencyKey, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// Task fetches a task.
+func (c *Client) Task(id string) (*Task, error) {
+	var task Task
+	if _, err := c.Do(http.MethodGet, "/tasks/"+id, nil, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// TaskView fetches a task with the sections named in expand: lease, runs,
+// memory, history and routing, or all. runsLimit and historyLimit size
+// those sections; 0 uses the daemon's defaults.
+func (c *Client) TaskView(id string, expand []string, runsLimit, historyLimit int) (*TaskView, error) {
+	q := url.Values{"expand": {strings.Join(expand, ",")}}
+	if runsLimit > 0 {
+		q.Set("runs_limit", strconv.Itoa(runsLimit))
+	}
+	if historyLimit > 0 {
+		q.Set("history_limit", strconv.Itoa(historyLimit))
+	}
+	var view TaskView
+	if _, err := c.Do(http.MethodGet, "/tasks/"+id+"?"+q.Encode(), nil, &view); err != nil {
+		return nil, err
+	}
+	return &view, nil
+}
+
+// Tasks lists tasks by priority, highest first, then newest first: all of them if status is "", or those
+// with a status, ListScheduled or ListStale.
+func (c *Client) Tasks(status string) ([]Task, error) {
+	path := "/tasks"
+	if status != "" {
+		path += "?status=" + url.QueryEscape(status)
+	}
+	var tasks []Task
+	if _, err := c.Do(http.MethodGet, path, nil, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// Subtasks lists a task's subtasks.
+func (c *Client) Subtasks(taskID string) ([]Task, error) {
+	var tasks []Task
+	if _, err := c.Do(http.MethodGet, "/tasks/"+taskID+"/subtasks", nil, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// Claim claims a task for holder. A ttlSec of 0 uses the daemon's default.
+// The returned lease carries the holder token the other holder calls need.
+func (c *Client) Claim(taskID, holder string, ttlSec int) (*Lease, error) {
+	var lease Lease
+	body := map[string]interface{}{"holder_id": holder, "ttl_sec": ttlSec}
+	if _, err := c.Do(http.MethodPost, "/tasks/"+taskID+"/claim", body, &lease); err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// ClaimNext claims the dispatchable task of highest priority, the oldest of
+// those, matching label and connector, either of which may be "". A ttlSec
+// of 0 uses the daemon's default. It returns nil when no task matches.
+func (c *Client) ClaimNext(holder, label, connector string, ttlSec int) (*ClaimResult, error) {
+	var res ClaimResult
+	body := map[string]interface{}{"holder_id": holder, "label": label, "connector": connector, "ttl_sec": ttlSec}
+	code, err := c.Do(http.MethodPost, "/tasks/claim-next", body, &res)
+	if err != nil || code == http.StatusNoContent {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// holderBody identifies the lease holder in a request.
+func holderBody(lease *Lease) map[string]interface{} {
+	return map[string]interface{}{"holder_id": lease.HolderID, "holder_token": lease.HolderToken}
+}
+
+// Heartbeat renews the lease. A ttlSec of 0 uses the daemon's default.
+func (c *Client) Heartbeat(lease *Lease, ttlSec int) error {
+	body := holderBody(lease)
+	body["ttl_sec"] = ttlSec
+	_, err := c.Do(http.MethodPost, "/tasks/"+lease.TaskID+"/heartbeat", body, nil)
+	return err
+}
+
+// Release returns the leased task to pending.
+func (c *Client) Release(lease *Lease) error {
+	_, err := c.Do(http.MethodPost, "/tasks/"+lease.TaskID+"/release", holderBody(lease), nil)
+	return err
+}
+
+// Complete marks the leased task completed.
+func (c *Client) Complete(lease *Lease) error {
+	_, err := c.Do(http.MethodPost, "/tasks/"+lease.TaskID+"/complete", holderBody(lease), nil)
+	return err
+}
+
+// RunRequest is a command to run on a claimed task. Env names must be on
+// the daemon's allowlist.
+type RunRequest struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args,omitempty"`
+	Stdin   string            `json:"stdin,omitempty"`
+	PTY     bool              `json:"pty,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	// TimeoutSec, if positive, stops the command after that many seconds.
+	TimeoutSec int `json:"timeout_sec,omitempty"`
+}
+
+// runBody is a RunRequest on behalf of a lease holder.
+type runBody struct {
+	HolderID    string `json:"holder_id"`
+	HolderToken string `json:"holder_token"`
+	RunRequest
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// Run runs a command on the leased task. A command outside the daemon's
+// allowlist fails with an APIError with CodeCommandDenied whose Body is a
+// CommandDenied.
+func (c *Client) Run(lease *Lease, req RunRequest) (*Run, error) {
+	var run Run
+	body := runBody{HolderID: lease.HolderID, HolderToken: lease.HolderToken, RunRequest: req}
+	if _, err := c.Do(http.MethodPost, "/tasks/"+lease.TaskID+"/run", body, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// RetryRun runs a previous run's command and args again on the leased
+// task. The new run's RetryOf links it to the one it retried, so the two
+// can be compared. env is set for the command.
+func (c *Client) RetryRun(lease *Lease, runID string, env map[string]string) (*Run, error) {
+	var run Run
+	body := struct {
+		HolderID    string            `json:"holder_id"`
+		HolderToken string            `json:"holder_token"`
+		Env         map[string]string `json:"env,omitempty"`
+	}{lease.HolderID, lease.HolderToken, env}
+	if _, err := c.Do(http.MethodPost, "/runs/"+runID+"/retry", body, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// PipelineResult is the outcome of RunPipeline.
+type PipelineResult struct {
+	TaskID string     `json:"task_id"`
+	Status TaskStatus `json:"status"`
+	// Runs holds a run per executed step, in order.
+	Runs []Run `json:"runs"`
+	// Skipped counts the steps whose condition did not hold.
+	Skipped int `json:"skipped"`
+	// Outputs holds the outputs captured by each named step.
+	Outputs map[string]map[string]string `json:"outputs,omitempty"`
+}
+
+// RunPipeline runs the task's steps in order on the daemon. Once a step
+// fails without continuing on error, only steps whose condition allows it
+// still run. env is set for every step.
+func (c *Client) RunPipeline(lease *Lease, env map[string]string) (*PipelineResult, error) {
+	var res PipelineResult
+	body := struct {
+		HolderID    string            `json:"holder_id"`
+		HolderToken string            `json:"holder_token"`
+		Env         map[string]string `json:"env,omitempty"`
+	}{lease.HolderID, lease.HolderToken, env}
+	if _, err := c.Do(http.MethodPost, "/tasks/"+lease.TaskID+"/pipeline", body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// PlanRun checks a run like Run and reports what would execute, without
+// running anything.
+func (c *Client) PlanRun(lease *Lease, req RunRequest) (*RunPlan, error) {
+	var plan RunPlan
+	body := runBody{HolderID: lease.HolderID, HolderToken: lease.HolderToken, RunRequest: req, DryRun: true}
+	if _, err := c.Do(http.MethodPost, "/tasks/"+lease.TaskID+"/run", body, &plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// RecordedRun is a command the holder ran itself, to record on the task.
+type RecordedRun struct {
+	Command  string   `json:"command"`
+	Args     []string `json:"args,omitempty"`
+	ExitCode int      `json:"exit_code"`
+	Stdout   string   `json:"stdout,omitempty"`
+	Stderr   string   `json:"stderr,omitempty"`
+}
+
+// RecordRun records a run executed outside the daemon on the leased task.
+func (c *Client) RecordRun(lease *Lease, r RecordedRun) (*Run, error) {
+	body := struct {
+		HolderID    string `json:"holder_id"`
+		HolderToken string `json:"holder_token"`
+		RecordedRun
+	}{lease.HolderID, lease.HolderToken, r}
+	var run Run
+	if _, err := c.Do(http.MethodPost, "/tasks/"+lease.TaskID+"/runs", body, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// Logs returns a page of a task's runs, newest first, and the task's total
+// run count. A limit of 0 uses the daemon's default page size.
+func (c *Client) Logs(taskID string, limit, offset int) ([]Run, int, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	if offset > 0 {
+		q.Set("offset", strconv.Itoa(offset))
+	}
+	path := "/tasks/" + taskID + "/logs"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	resp, data, err := c.send(http.MethodGet, path, nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	var runs []Run
+	if err := decode(http.MethodGet, path, data, &runs); err != nil {
+		return nil, 0, err
+	}
+	total, _ := strconv.Atoi(resp.Header.Get("X-Total-Count"))
+	return runs, total, nil
+}
+
+// RunDiff returns the workdir diff captured when a run ended, as a unified
+// diff.
+func (c *Client) RunDiff(runID string) (string, error) {
+	data, err := c.Raw(http.MethodGet, "/runs/"+runID+"/diff", nil, nil)
+	return string(data), err
+}
+
+// TaskMemory lists the memory items recorded for a task.
+func (c *Client) TaskMemory(taskID string) ([]MemoryItem, error) {
+	var items []MemoryItem
+	if _, err := c.Do(http.MethodGet, "/tasks/"+taskID+"/memory", nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// TaskTools returns the MCP tools routed to a task.
+func (c *Client) TaskTools(taskID string) (*ToolManifest, error) {
+	var m ToolManifest
+	if _, err := c.Do(http.MethodGet, "/tasks/"+taskID+"/tools", nil, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Comment adds a comment to a task. An empty author defaults to the
+// principal of the client's API key.
+func (c *Client) Comment(taskID, author, body string) (*Comment, error) {
+	var comment Comment
+	req := map[string]string{"author": author, "body": body}
+	if _, err := c.Do(http.MethodPost, "/tasks/"+taskID+"/comments", req, &comment); err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// Comments lists a task's comments after since, oldest first; a zero since
+// lists them all.
+func (c *Client) Comments(taskID string, since time.Time) ([]Comment, error) {
+	path := "/tasks/" + taskID + "/comments"
+	if !since.IsZero() {
+		path += "?since=" + url.QueryEscape(since.Format(time.RFC3339Nano))
+	}
+	var comments []Comment
+	if _, err := c.Do(http.MethodGet, path, nil, &comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// Checklist lists a task's checklist in order.
+func (c *Client) Checklist(taskID string) ([]ChecklistItem, error) {
+	var items []ChecklistItem
+	if _, err := c.Do(http.MethodGet, "/tasks/"+taskID+"/checklist", nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// AddChecklistItems appends items to a task's checklist.
+func (c *Client) AddChecklistItems(taskID string, items ...string) ([]ChecklistItem, error) {
+	var added []ChecklistItem
+	body := map[string][]string{"items": items}
+	if _, err := c.Do(http.MethodPost, "/tasks/"+taskID+"/checklist", body, &added); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// CheckItem checks, or with done false unchecks, a checklist item by its
+// ID. An empty by defaults to the principal of the client's API key.
+func (c *Client) CheckItem(taskID, itemID string, done bool, by string) (*ChecklistItem, error) {
+	action := "uncheck"
+	if done {
+		action = "check"
+	}
+	var item ChecklistItem
+	body := map[string]string{"by": by}
+	if _, err := c.Do(http.MethodPost, "/tasks/"+taskID+"/checklist/"+itemID+"/"+action, body, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
@@ -0,0 +1,373 @@
+package client
+
+import (
+	"time"
+
+	"github.com/fentz26/neona/internal/models"
+)
+
+// Records the API returns as is.
+type (
+	Task          = models.Task
+	TaskStatus    = models.TaskStatus
+	Lease         = models.Lease
+	Run           = models.Run
+	RunStep       = models.RunStep
+	MemoryItem    = models.MemoryItem
+	Comment       = models.Comment
+	ChecklistItem = models.ChecklistItem
+	Event         = models.Event
+	PDREntry      = models.PDREntry
+	ClaimPolicy   = models.ClaimPolicy
+	ClaimConfig   = models.ClaimConfig
+)
+
+// DefaultLeaseTTLSec is the lease TTL of daemons too old to serve
+// DaemonConfig.
+const DefaultLeaseTTLSec = models.DefaultLeaseTTLSec
+
+// TaskProject names the project whose claim policy applies to a task (see
+// ClaimConfig.For).
+func TaskProject(t *Task) string {
+	return models.TaskProject(t)
+}
+
+// DaemonConfig is the body of GET /config: settings clients should follow
+// rather than assume, such as the lease TTL to heartbeat against.
+type DaemonConfig struct {
+	Claims ClaimConfig `json:"claims"`
+}
+
+// Task statuses.
+const (
+	TaskStatusPending   = models.TaskStatusPending
+	TaskStatusClaimed   = models.TaskStatusClaimed
+	TaskStatusRunning   = models.TaskStatusRunning
+	TaskStatusCompleted = models.TaskStatusCompleted
+	TaskStatusFailed    = models.TaskStatusFailed
+)
+
+// ListScheduled lists pending tasks held back by their not_before time; pass
+// it to Tasks like a status.
+const ListScheduled = "scheduled"
+
+// ListStale lists claims whose holder has sent no heartbeat and run no
+// command for the daemon's --stale-factor lease TTLs, with LastActivityAt
+// set; pass it to Tasks like a status.
+const ListStale = "stale"
+
+// HealthResponse is the body of GET /health.
+type HealthResponse struct {
+	OK      bool   `json:"ok"`
+	DB      string `json:"db"`
+	Version string `json:"version"`
+	Time    string `json:"time"`
+	// Role is "leader" or "follower" when several daemons share a database.
+	Role string `json:"role,omitempty"`
+}
+
+// ClaimResult is a task claimed with ClaimNext and its lease.
+type ClaimResult struct {
+	Task  *Task  `json:"task"`
+	Lease *Lease `json:"lease"`
+}
+
+// TaskView is a task with the related records asked for by TaskView's
+// expand list. Sections that were not asked for are omitted.
+type TaskView struct {
+	*Task
+
+	// Lease is the active lease; it is omitted when there is none.
+	Lease *Lease `json:"lease,omitempty"`
+	// Runs are the most recent runs, newest first, out of RunCount.
+	Runs     []Run       `json:"runs,omitempty"`
+	RunCount *int        `json:"run_count,omitempty"`
+	Memory   *TaskMemory `json:"memory,omitempty"`
+	// History is the task's audit trail, oldest first.
+	History []PDREntry   `json:"history,omitempty"`
+	Routing *TaskRouting `json:"routing,omitempty"`
+}
+
+// TaskMemory summarizes the memory items recorded for a task.
+type TaskMemory struct {
+	Count int `json:"count"`
+	// Recent holds the newest few items.
+	Recent []MemoryItem `json:"recent"`
+}
+
+// TaskRouting is the MCP routing decision for a task.
+type TaskRouting struct {
+	MCPs           []string `json:"mcps"`
+	MatchedRules   []string `json:"matched_rules"`
+	TotalTools     int      `json:"total_tools"`
+	FilteredTools  int      `json:"filtered_tools"`
+	Strategy       string   `json:"strategy,omitempty"`
+	Cached         bool     `json:"cached,omitempty"`
+	FallbackReason string   `json:"fallback_reason,omitempty"`
+}
+
+// RunPlan is what a dry run would execute.
+type RunPlan struct {
+	TaskID    string `json:"task_id"`
+	Connector string `json:"connector"`
+	// Path is the resolved executable, when the connector can tell.
+	Path    string   `json:"path,omitempty"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Dir     string   `json:"dir,omitempty"`
+	// Env holds the variables set on top of the daemon's environment.
+	Env         map[string]string `json:"env,omitempty"`
+	Sandbox     string            `json:"sandbox,omitempty"`
+	SandboxArgv []string          `json:"sandbox_argv,omitempty"`
+	StdinLen    int               `json:"stdin_len"`
+	PTY         bool              `json:"pty"`
+	// Capabilities are the optional features the connector supports.
+	Capabilities Capabilities `json:"capabilities"`
+	// MCPServers lists the MCP servers routed to the task, when the daemon
+	// has a router.
+	MCPServers []string `json:"mcp_servers,omitempty"`
+	DryRun     bool     `json:"dry_run"`
+}
+
+// Capabilities lists the optional features a connector supports. Runs that
+// need one the task's connector lacks are refused with CodeInvalidRequest.
+type Capabilities struct {
+	Streaming bool `json:"streaming"`
+	Stdin     bool `json:"stdin"`
+	PTY       bool `json:"pty"`
+	WorkDir   bool `json:"workdir"`
+	Env       bool `json:"env"`
+	Timeout   bool `json:"timeout"`
+	Sandbox   bool `json:"sandbox"`
+}
+
+// CommandDenied is the body of a 403 for a command outside the daemon's
+// allowlist; decode it from an APIError's Body.
+type CommandDenied struct {
+	Error       string   `json:"error"`
+	Code        string   `json:"code"`
+	Command     string   `json:"command"`
+	Args        []string `json:"args"`
+	Suggestions []string `json:"suggestions"`
+}
+
+// ToolManifest lists the MCP tools routed to a task.
+type ToolManifest struct {
+	TaskID        string       `json:"task_id"`
+	Strategy      string       `json:"strategy,omitempty"`
+	Servers       []ToolServer `json:"servers"`
+	Tools         []Tool       `json:"tools"`
+	TotalTools    int          `json:"total_tools"`
+	FilteredTools int          `json:"filtered_tools"`
+}
+
+// ToolServer is a selected MCP server. ToolsListed is false when the daemon
+// only knows the server's tool count; expose all of its local tools then.
+type ToolServer struct {
+	Name        string   `json:"name"`
+	ToolCount   int      `json:"tool_count"`
+	Categories  []string `json:"categories,omitempty"`
+	ToolsListed bool     `json:"tools_listed"`
+}
+
+// Tool is a routed MCP tool. Name is namespaced as <server>__<tool>.
+type Tool struct {
+	Name        string `json:"name"`
+	Tool        string `json:"tool"`
+	Server      string `json:"server"`
+	Description string `json:"description,omitempty"`
+}
+
+// Route is the MCP routing decision for a task description.
+type Route struct {
+	SelectedMCPs []RouteServer `json:"selected_mcps"`
+	MatchedRules []string      `json:"matched_rules"`
+	TotalTools   int           `json:"total_tools"`
+	ToolBudget   int           `json:"tool_budget"`
+}
+
+// RouteServer is an MCP server selected by Route.
+type RouteServer struct {
+	Name      string `json:"name"`
+	ToolCount int    `json:"tool_count"`
+}
+
+// RuleFile is a repository file of agent rules, such as AGENTS.md, to sync
+// into project memory.
+type RuleFile struct {
+	// Path is relative to the repository root, with forward slashes.
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// RuleSyncResult reports a rule file sync.
+type RuleSyncResult struct {
+	Scope string           `json:"scope"`
+	Files []RuleFileStatus `json:"files"`
+	// Stale counts the files that were, or with a dry run would be, added,
+	// updated or removed.
+	Stale  int  `json:"stale"`
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// RuleFileStatus is what a sync did with one rule file: "added",
+// "updated", "unchanged" or "removed".
+type RuleFileStatus struct {
+	Path     string `json:"path"`
+	Status   string `json:"status"`
+	MemoryID string `json:"memory_id,omitempty"`
+}
+
+// Stats summarizes the daemon's task queue.
+type Stats struct {
+	// Scheduler is the scheduler's state: running, draining, drained,
+	// stopped or disabled.
+	Scheduler     string `json:"scheduler"`
+	ActiveWorkers int    `json:"active_workers"`
+	// Tasks counts tasks by status.
+	Tasks map[string]int `json:"tasks"`
+	Total int            `json:"total"`
+	// Overdue counts open tasks past their deadline.
+	Overdue int `json:"overdue"`
+	// Scheduled counts pending tasks held back by their not_before time.
+	Scheduled int `json:"scheduled"`
+	// DBWarnings lists the soft database limits crossed, as of the
+	// daemon's last check.
+	DBWarnings []DBWarning `json:"db_warnings,omitempty"`
+}
+
+// DBWarning is a soft database limit the daemon found crossed.
+type DBWarning struct {
+	Table      string `json:"table,omitempty"` // empty for the file size
+	Value      int64  `json:"value"`
+	Limit      int64  `json:"limit"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion"`
+}
+
+// WorkersStats describes the daemon's scheduler worker pool.
+type WorkersStats struct {
+	Running         bool                      `json:"running"`
+	ActiveWorkers   int                       `json:"active_workers"`
+	GlobalMax       int                       `json:"global_max"`
+	ConnectorCounts map[string]int            `json:"connector_counts"`
+	LabelLimits     map[string]LabelLimit     `json:"label_limits"`
+	Workers         []Worker                  `json:"workers"`
+	RateLimits      map[string]RateLimitState `json:"rate_limits"`
+	ThrottledTasks  int                       `json:"throttled_tasks"`
+	// Claims counts the scheduler's claims and APIClaims those of external
+	// workers through the API; conflicts in either show them contending.
+	Claims    ClaimStats `json:"claims"`
+	APIClaims ClaimStats `json:"api_claims"`
+}
+
+// ClaimStats counts claim attempts that found a task. Polls that find
+// nothing to claim are not counted.
+type ClaimStats struct {
+	Attempts int64 `json:"attempts"`
+	// Conflicts counts attempts that lost the task to another holder.
+	Conflicts    int64   `json:"conflicts"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+// Worker is a task the scheduler is working on.
+type Worker struct {
+	WorkerID      string         `json:"worker_id"`
+	TaskID        string         `json:"task_id"`
+	TaskTitle     string         `json:"task_title"`
+	LeaseID       string         `json:"lease_id"`
+	LeaseExpires  time.Time      `json:"lease_expires"`
+	StartedAt     time.Time      `json:"started_at"`
+	ConnectorName string         `json:"connector_name"`
+	MutexKey      string         `json:"mutex_key,omitempty"`
+	Routing       *WorkerRouting `json:"routing,omitempty"`
+}
+
+// WorkerRouting is the MCP routing decision for a worker's task.
+type WorkerRouting struct {
+	MCPs           []string `json:"mcps"`
+	MatchedRules   []string `json:"matched_rules"`
+	TotalTools     int      `json:"total_tools"`
+	Strategy       string   `json:"strategy,omitempty"`
+	Cached         bool     `json:"cached,omitempty"`
+	FallbackReason string   `json:"fallback_reason,omitempty"`
+}
+
+// LabelLimit is a label's concurrency limit (--label-limit) and how many
+// tasks carrying it are running.
+type LabelLimit struct {
+	Limit   int `json:"limit"`
+	Running int `json:"running"`
+}
+
+// RateLimitState is the state of a connector's dispatch rate limiter.
+type RateLimitState struct {
+	PerMinute int     `json:"per_minute"`
+	Burst     int     `json:"burst"`
+	Tokens    float64 `json:"tokens"`
+}
+
+// ScriptLibrary lists the vetted scripts the daemon runs through its scripts
+// connector.
+type ScriptLibrary struct {
+	Enabled bool     `json:"enabled"`
+	Dir     string   `json:"dir,omitempty"`
+	Scripts []Script `json:"scripts"`
+}
+
+// Script is a script in the library and the arguments it takes.
+type Script struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Args        []ScriptArg `json:"args"`
+}
+
+// ScriptArg is an argument of a script. Type is string (the default), int
+// or bool; Pattern is a regular expression the whole value must match.
+type ScriptArg struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Type        string   `json:"type,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+}
+
+// CloudSyncStatus is the state of the neona.app cloud sync: its settings,
+// the last pass and the latest status conflicts.
+type CloudSyncStatus struct {
+	Enabled   bool                `json:"enabled"`
+	URL       string              `json:"url,omitempty"`
+	Device    string              `json:"device,omitempty"`
+	Labels    []string            `json:"labels,omitempty"`
+	Memory    bool                `json:"memory,omitempty"`
+	Team      string              `json:"team,omitempty"`
+	Policy    string              `json:"conflict_policy,omitempty"`
+	Encrypted bool                `json:"encrypted,omitempty"`
+	KeyID     string              `json:"key_id,omitempty"`
+	LastSync  *time.Time          `json:"last_sync,omitempty"`
+	LastError string              `json:"last_error,omitempty"`
+	Pushed    int                 `json:"pushed"`
+	Pulled    int                 `json:"pulled"`
+	Linked    int                 `json:"linked"`
+	Conflicts []CloudSyncConflict `json:"conflicts"`
+}
+
+// CloudSyncConflict is a task whose status changed both locally and in the
+// cloud between two syncs. Kept is the side that won: local or remote.
+type CloudSyncConflict struct {
+	TaskID       string    `json:"task_id"`
+	RemoteID     string    `json:"remote_id"`
+	LocalStatus  string    `json:"local_status"`
+	RemoteStatus string    `json:"remote_status"`
+	Kept         string    `json:"kept"`
+	At           time.Time `json:"at"`
+}
+
+// ForceReleaseResult reports an administrator's release of a task.
+type ForceReleaseResult struct {
+	TaskID         string `json:"task_id"`
+	PreviousHolder string `json:"previous_holder,omitempty"`
+	Actor          string `json:"actor"`
+	Reason         string `json:"reason,omitempty"`
+}